@@ -4,10 +4,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"golang.org/x/term"
+
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/buildconfig"
 	"github.com/osbuild/images/internal/cmdutil"
@@ -16,6 +19,7 @@ import (
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distro/generic"
 	"github.com/osbuild/images/pkg/distrofactory"
+	"github.com/osbuild/images/pkg/lockfile"
 	"github.com/osbuild/images/pkg/manifestgen"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/reporegistry"
@@ -53,6 +57,22 @@ func run() error {
 	flag.StringVar(&bootcBuildRef, "bootc-build-ref", "", "separate build container image ref")
 	flag.BoolVar(&bootcRemote, "bootc-remote", false, "use org.osbuild.skopeo sources instead of containers-storage")
 
+	// lockfile args
+	var lockfilePath string
+	var writeLockfile bool
+	flag.StringVar(&lockfilePath, "lockfile", "", "use the packages, containers and ostree commits locked in the given lockfile instead of resolving them")
+	flag.BoolVar(&writeLockfile, "write-lockfile", false, "write the lockfile of the resolved packages, containers and ostree commits to the build directory")
+
+	// progress args
+	var progress string
+	flag.StringVar(&progress, "progress", "auto", "build progress output: auto (bar on a terminal, verbose otherwise), bar, json (JSON lines on stdout) or verbose (osbuild output)")
+
+	// report args
+	var writeReport bool
+	var compareReport string
+	flag.BoolVar(&writeReport, "report", false, "write a timing report of the pipelines and stages to the build directory")
+	flag.StringVar(&compareReport, "compare-report", "", "compare the timing report with the given report of a previous build (implies -report)")
+
 	flag.Parse()
 
 	if imgTypeName == "" || configFile == "" {
@@ -64,6 +84,17 @@ func run() error {
 		flag.Usage()
 		os.Exit(1)
 	}
+	if progress == "auto" {
+		progress = "verbose"
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			progress = "bar"
+		}
+	}
+	if progress != "bar" && progress != "json" && progress != "verbose" {
+		fmt.Fprintf(os.Stderr, "error: invalid -progress %q\n", progress)
+		flag.Usage()
+		os.Exit(1)
+	}
 	if distroName != "" && bootcRef != "" {
 		fmt.Fprintf(os.Stderr, "error: -distro and -bootc-ref are mutually exclusive\n")
 		flag.Usage()
@@ -197,6 +228,22 @@ func run() error {
 	if archName != arch.Current().String() {
 		manifestOpts.UseBootstrapContainer = true
 	}
+	if lockfilePath != "" {
+		manifestOpts.Lockfile, err = lockfile.Load(lockfilePath)
+		if err != nil {
+			return err
+		}
+	}
+	if writeLockfile {
+		manifestOpts.LockfileWriter = func(filename string, content io.Reader) error {
+			data, err := io.ReadAll(content)
+			if err != nil {
+				return err
+			}
+			// nolint:gosec
+			return os.WriteFile(filepath.Join(buildDir, filename), data, 0644)
+		}
+	}
 	// add RHSM fact to detect changes
 	config.Options.Facts = &facts.ImageOptions{
 		APIType: facts.TEST_APITYPE,
@@ -233,16 +280,42 @@ func run() error {
 	fmt.Printf("Building manifest: %s\n", manifestPath)
 
 	jobOutput := filepath.Join(outputDir, buildName)
-	_, err = osbuild.RunOSBuild(mf, &osbuild.OSBuildOptions{
+	osbuildOpts := &osbuild.OSBuildOptions{
 		StoreDir:    osbuildStore,
 		OutputDir:   jobOutput,
 		Exports:     imgType.Exports(),
 		Checkpoints: checkpoints,
 		JSONOutput:  false,
-	})
+	}
+	var pb *progressBar
+	switch progress {
+	case "bar":
+		pb = newProgressBar(os.Stdout)
+		osbuildOpts.Progress = pb.update
+		osbuildOpts.Stdout = io.Discard
+		osbuildOpts.BuildLog = &pb.output
+		osbuildOpts.BuildLogMu = &pb.mu
+	case "json":
+		osbuildOpts.Progress = osbuild.NewProgressJSONWriter(os.Stdout).Write
+		osbuildOpts.Stdout = os.Stderr
+	}
+	var timings *osbuild.TimingRecorder
+	if writeReport || compareReport != "" {
+		timings = &osbuild.TimingRecorder{}
+		osbuildOpts.Progress = recordTimings(timings, osbuildOpts.Progress)
+	}
+	_, err = osbuild.RunOSBuild(mf, osbuildOpts)
+	if pb != nil {
+		pb.finish(err, os.Stderr)
+	}
 	if err != nil {
 		return err
 	}
+	if timings != nil {
+		if err := writeBuildReport(timings, osbuildStore, buildDir, compareReport); err != nil {
+			return err
+		}
+	}
 
 	fmt.Printf("Jobs done. Results saved in\n%s\n", outputDir)
 	return nil
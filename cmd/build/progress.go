@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+const progressBarWidth = 30
+
+// progressBar renders the osbuild progress events as a single line progress
+// bar. The build output is kept and only shown if the build fails.
+type progressBar struct {
+	w io.Writer
+
+	// output is the osbuild output, stdout and stderr of osbuild are
+	// written to it as well (see osbuild.OSBuildOptions.BuildLogMu)
+	mu     sync.Mutex
+	output bytes.Buffer
+	failed bool
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w}
+}
+
+func (pb *progressBar) update(ev *osbuild.Event) error {
+	switch ev.Type {
+	case osbuild.EventLog:
+		pb.mu.Lock()
+		fmt.Fprintln(&pb.output, ev.Message)
+		pb.mu.Unlock()
+	case osbuild.EventStageEnd, osbuild.EventPipelineEnd:
+		if !ev.Success {
+			pb.failed = true
+		}
+	}
+
+	status := ev.Pipeline
+	if ev.Stage != "" {
+		status += ": " + ev.Stage
+	}
+	filled := int(ev.Percent / 100 * progressBarWidth)
+	fmt.Fprintf(pb.w, "\r\033[K[%s%s] %3.0f%% %s",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled), ev.Percent, status)
+	return nil
+}
+
+// finish ends the progress bar line and writes the build output to errOut
+// if the build failed.
+func (pb *progressBar) finish(buildErr error, errOut io.Writer) {
+	fmt.Fprintln(pb.w)
+	if buildErr != nil || pb.failed {
+		_, _ = errOut.Write(pb.output.Bytes())
+	}
+}
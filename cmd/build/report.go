@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// recordTimings records the timings of the build before passing the
+// progress events on to next. Without a progress callback the osbuild
+// output would be lost to the monitor, so the log lines are printed.
+func recordTimings(timings *osbuild.TimingRecorder, next func(*osbuild.Event) error) func(*osbuild.Event) error {
+	if next == nil {
+		next = func(ev *osbuild.Event) error {
+			if ev.Type == osbuild.EventLog {
+				fmt.Println(ev.Message)
+			}
+			return nil
+		}
+	}
+	return func(ev *osbuild.Event) error {
+		if err := timings.Record(ev); err != nil {
+			return err
+		}
+		return next(ev)
+	}
+}
+
+// writeBuildReport writes the timing report to the build directory and
+// prints it, compared to the report at comparePath if set.
+func writeBuildReport(timings *osbuild.TimingRecorder, storeDir, buildDir, comparePath string) error {
+	report, err := timings.Report(storeDir)
+	if err != nil {
+		return fmt.Errorf("cannot create build report: %w", err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	reportPath := filepath.Join(buildDir, "report.json")
+	// nolint:gosec
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write build report %q: %w", reportPath, err)
+	}
+
+	fmt.Printf("Build report saved in %s\n\n", reportPath)
+	if err := report.Write(os.Stdout); err != nil {
+		return err
+	}
+	if comparePath == "" {
+		return nil
+	}
+
+	data, err = os.ReadFile(comparePath)
+	if err != nil {
+		return fmt.Errorf("cannot read build report: %w", err)
+	}
+	var previous osbuild.BuildReport
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return fmt.Errorf("cannot parse build report %q: %w", comparePath, err)
+	}
+	fmt.Printf("\nCompared to %s:\n\n", comparePath)
+	return osbuild.CompareReports(&previous, report, nil).Write(os.Stdout)
+}
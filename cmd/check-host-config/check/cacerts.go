@@ -14,6 +14,7 @@ func init() {
 		Name:                   "cacerts",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, cacertsCheck)
 }
 
@@ -12,6 +12,7 @@ func init() {
 		Name:                   "directories",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, directoriesCheck)
 }
 
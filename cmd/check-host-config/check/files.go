@@ -14,6 +14,7 @@ func init() {
 		Name:                   "files",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, filesCheck)
 }
 
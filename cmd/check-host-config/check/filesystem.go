@@ -14,6 +14,7 @@ func init() {
 		Name:                   "filesystem",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 		RunOn:                  []string{"!rhel-8.4", "!rhel-8.6", "!rhel-8.8", "!rhel-8.10"},
 	}, filesystemCheck)
 }
@@ -15,6 +15,7 @@ func init() {
 		Name:                   "hostname",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, hostnameCheck)
 }
 
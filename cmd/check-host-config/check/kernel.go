@@ -1,6 +1,7 @@
 package check
 
 import (
+	"errors"
 	"log"
 	"strings"
 
@@ -12,6 +13,7 @@ func init() {
 		Name:                   "kernel",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 		TempDisabled:           "https://github.com/osbuild/images/pull/2175",
 	}, kernelCheck)
 }
@@ -27,11 +29,15 @@ func kernelCheck(meta *Metadata, config *buildconfig.BuildConfig) error {
 	// reliable.
 	if expected.Name != "" {
 		_, _, _, err := ExecString("rpm", "-q", "--provides", expected.Name)
-		if err != nil {
+		switch {
+		case errors.Is(err, ErrOfflineUnsupported):
+			// the package database of offline images cannot be queried
+			log.Printf("Not checking kernel package %s on an offline image\n", expected.Name)
+		case err != nil:
 			return Fail("kernel package not found:", expected.Name, "error:", err)
+		default:
+			log.Printf("Kernel name check passed: %s is installed\n", expected.Name)
 		}
-
-		log.Printf("Kernel name check passed: %s is installed\n", expected.Name)
 	}
 
 	if len(expected.Append) > 0 {
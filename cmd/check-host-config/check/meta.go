@@ -13,6 +13,7 @@ type Metadata struct {
 	RequiresBootc          bool     // Ensure Options.Bootc is not nil, skip the check otherwise
 	TempDisabled           string   // Set to non-empty string with URL to issue tracker to disable the check temporarily
 	RunOn                  []string // List of OS IDs to run the check on (prefix with `!` to exclude)
+	Offline                bool     // Check also works on the tree of an image that is not booted, see UseImageTree
 }
 
 // CheckFunc is the function type that all checks must implement.
@@ -0,0 +1,372 @@
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/inspect"
+)
+
+// ErrOfflineUnsupported is returned by Exec for commands that cannot be
+// emulated on the tree of an image.
+var ErrOfflineUnsupported = errors.New("not supported on an offline image")
+
+// offline implements the mockable functions of the package on the tree of
+// an image that is not booted. Commands used by the checks that support
+// offline images (see Metadata.Offline) are emulated by reading the
+// configuration files from the tree.
+type offline struct {
+	tree *inspect.Tree
+}
+
+// UseImageTree replaces the mockable functions of the package so that the
+// checks inspect the tree of an image instead of the running system. The
+// returned function restores the original functions.
+func UseImageTree(tree *inspect.Tree) (restore func()) {
+	o := &offline{tree: tree}
+
+	origExec, origExists, origExistsDir := Exec, Exists, ExistsDir
+	origStat, origGrep, origReadFile := Stat, Grep, ReadFile
+	origLookupUID, origLookupGID, origParseOSRelease := LookupUID, LookupGID, ParseOSRelease
+
+	Exec = o.exec
+	Exists = o.exists
+	ExistsDir = o.existsDir
+	Stat = o.stat
+	Grep = o.grep
+	ReadFile = o.readFile
+	LookupUID = o.lookupUID
+	LookupGID = o.lookupGID
+	ParseOSRelease = o.parseOSRelease
+
+	return func() {
+		Exec, Exists, ExistsDir = origExec, origExists, origExistsDir
+		Stat, Grep, ReadFile = origStat, origGrep, origReadFile
+		LookupUID, LookupGID, ParseOSRelease = origLookupUID, origLookupGID, origParseOSRelease
+	}
+}
+
+// treePath converts an absolute path of the system to a path of the tree.
+func treePath(name string) string {
+	p := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+func (o *offline) exists(name string) bool {
+	log.Printf("Exists: %s\n", name)
+	_, err := o.tree.Stat(treePath(name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Exists failed: %s (error: %v)\n", name, err)
+	}
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+func (o *offline) existsDir(name string) bool {
+	log.Printf("ExistsDir: %s\n", name)
+	info, err := o.tree.Stat(treePath(name))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("ExistsDir failed: %s (error: %v)\n", name, err)
+		}
+		return false
+	}
+	return info.IsDir()
+}
+
+// offlineFileInfo returns the owner of a file of the tree as
+// *syscall.Stat_t, like os.Stat on the running system.
+type offlineFileInfo struct {
+	fs.FileInfo
+	stat *syscall.Stat_t
+}
+
+func (fi *offlineFileInfo) Sys() any {
+	return fi.stat
+}
+
+func (o *offline) stat(name string) (os.FileInfo, error) {
+	log.Printf("Stat: %s\n", name)
+	info, err := o.tree.Stat(treePath(name))
+	if err != nil {
+		return nil, err
+	}
+	stat := &syscall.Stat_t{}
+	if owner, ok := info.Sys().(*inspect.Owner); ok {
+		stat.Uid, stat.Gid = owner.UID, owner.GID
+	}
+	return &offlineFileInfo{FileInfo: info, stat: stat}, nil
+}
+
+func (o *offline) grep(pattern, filename string) (bool, error) {
+	log.Printf("Grep: %s %s\n", pattern, filename)
+	content, err := o.tree.ReadFile(treePath(filename))
+	if err != nil {
+		log.Printf("Grep failed: %s %s (error: %v)\n", pattern, filename, err)
+		return false, err
+	}
+	return strings.Contains(string(content), pattern), nil
+}
+
+func (o *offline) readFile(filename string) ([]byte, error) {
+	log.Printf("ReadFile: %s\n", filename)
+	var data []byte
+	var err error
+	if filename == "/proc/cmdline" {
+		data, err = o.kernelCmdline()
+	} else {
+		data, err = o.tree.ReadFile(treePath(filename))
+	}
+	if err != nil {
+		log.Printf("ReadFile failed: %s (error: %v)\n", filename, err)
+	}
+	return data, err
+}
+
+// kernelCmdline returns the kernel command line of the default boot loader
+// entry (the first in the sort order) or of /etc/kernel/cmdline.
+func (o *offline) kernelCmdline() ([]byte, error) {
+	entries, err := o.tree.ReadDir("boot/loader/entries")
+	if err == nil {
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), ".conf") {
+				continue
+			}
+			data, err := o.tree.ReadFile(path.Join("boot/loader/entries", entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			for scanner.Scan() {
+				if options, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "options"); ok {
+					return []byte(strings.TrimSpace(options) + "\n"), nil
+				}
+			}
+		}
+	}
+	data, err := o.tree.ReadFile("etc/kernel/cmdline")
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the kernel command line in the boot loader entries or /etc/kernel/cmdline: %w", err)
+	}
+	return data, nil
+}
+
+// accountID returns the numeric ID of a user or group in the passwd or
+// group database of the tree. The databases in /usr/lib are used by
+// ostree based images (nss-altfiles).
+func (o *offline) accountID(db, name string) (uint32, error) {
+	for _, dir := range []string{"etc", "usr/lib"} {
+		data, err := o.tree.ReadFile(path.Join(dir, db))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), ":")
+			if len(fields) < 3 || fields[0] != name {
+				continue
+			}
+			id, err := strconv.ParseUint(fields[2], 10, 32)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse ID of %q in %s: %w", name, db, err)
+			}
+			return uint32(id), nil
+		}
+	}
+	return 0, fmt.Errorf("%q not found in %s", name, db)
+}
+
+func (o *offline) lookupUID(username string) (uint32, error) {
+	return o.accountID("passwd", username)
+}
+
+func (o *offline) lookupGID(groupname string) (uint32, error) {
+	return o.accountID("group", groupname)
+}
+
+func (o *offline) parseOSRelease(osReleasePath string) (*OSRelease, error) {
+	log.Printf("ParseOSRelease: reading from image tree\n")
+	osrelease, err := distro.ReadOSReleaseFromFS(o.tree)
+	if err != nil {
+		log.Printf("ParseOSRelease failed: %v\n", err)
+		return nil, err
+	}
+	return newOSRelease(osrelease), nil
+}
+
+// exec emulates the commands used by the checks that support offline
+// images, other commands return ErrOfflineUnsupported.
+func (o *offline) exec(name string, arg ...string) ([]byte, []byte, int, error) {
+	cmdStr := strings.Join(append([]string{name}, arg...), " ")
+	if name == "sudo" && len(arg) > 0 {
+		name, arg = arg[0], arg[1:]
+	}
+
+	var stdout, stderr string
+	var exitCode int
+	var err error
+	switch {
+	case name == "id" && len(arg) == 1:
+		stdout, stderr, exitCode, err = o.id(arg[0])
+	case name == "systemctl" && len(arg) == 2 && arg[0] == "is-enabled":
+		stdout, stderr, exitCode, err = o.isEnabled(arg[1])
+	case name == "systemctl" && slices.Equal(arg, []string{"list-unit-files", "--state=masked"}):
+		stdout, err = o.listMaskedUnits()
+	case name == "lsblk" && slices.Equal(arg, []string{"-J", "-o", "MOUNTPOINTS,FSTYPE"}):
+		stdout, err = o.lsblk()
+	default:
+		exitCode, err = 127, ErrOfflineUnsupported
+	}
+	if err != nil && exitCode == 0 {
+		exitCode = 1
+	}
+
+	if err != nil {
+		log.Printf("Exec (offline): %s (%s)\n%s\n%s", cmdStr, err, stdout, stderr)
+	} else {
+		log.Printf("Exec (offline): %s\n", cmdStr)
+	}
+	return []byte(stdout), []byte(stderr), exitCode, err
+}
+
+func (o *offline) id(user string) (string, string, int, error) {
+	uid, err := o.lookupUID(user)
+	if err != nil {
+		return "", fmt.Sprintf("id: '%s': no such user", user), 1, err
+	}
+	return fmt.Sprintf("uid=%d(%s)\n", uid, user), "", 0, nil
+}
+
+var unitDirs = []string{"etc/systemd/system", "usr/lib/systemd/system", "lib/systemd/system"}
+
+// isMasked returns whether the unit is linked to /dev/null in the
+// configuration directory.
+func (o *offline) isMasked(unit string) bool {
+	target, err := o.tree.ReadLink(path.Join("etc/systemd/system", unit))
+	return err == nil && target == "/dev/null"
+}
+
+// isEnabled emulates "systemctl is-enabled" for units that are enabled by
+// symlinks in the .wants, .requires or .upholds directories of
+// /etc/systemd/system, which is what "systemctl enable" creates.
+func (o *offline) isEnabled(unit string) (string, string, int, error) {
+	if !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+	if o.isMasked(unit) {
+		return "masked\n", "", 1, fmt.Errorf("unit %s is masked", unit)
+	}
+
+	entries, err := o.tree.ReadDir("etc/systemd/system")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", 1, err
+	}
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if !entry.IsDir() || (ext != ".wants" && ext != ".requires" && ext != ".upholds") {
+			continue
+		}
+		if _, err := o.tree.Lstat(path.Join("etc/systemd/system", entry.Name(), unit)); err == nil {
+			return "enabled\n", "", 0, nil
+		}
+	}
+
+	for _, dir := range unitDirs {
+		data, err := o.tree.ReadFile(path.Join(dir, unit))
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(string(data), "[Install]") {
+			return "static\n", "", 0, nil
+		}
+		return "disabled\n", "", 1, fmt.Errorf("unit %s is disabled", unit)
+	}
+	stderr := fmt.Sprintf("Failed to get unit file state for %s: No such file or directory", unit)
+	return "", stderr, 1, errors.New(stderr)
+}
+
+// listMaskedUnits emulates "systemctl list-unit-files --state=masked".
+func (o *offline) listMaskedUnits() (string, error) {
+	entries, err := o.tree.ReadDir("etc/systemd/system")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("UNIT FILE STATE PRESET\n")
+	count := 0
+	for _, entry := range entries {
+		if o.isMasked(entry.Name()) {
+			fmt.Fprintf(&sb, "%s masked -\n", entry.Name())
+			count++
+		}
+	}
+	fmt.Fprintf(&sb, "\n%d unit files listed.\n", count)
+	return sb.String(), nil
+}
+
+// lsblk emulates "lsblk -J -o MOUNTPOINTS,FSTYPE" with the filesystems
+// that would be mounted on boot: the root filesystem, the entries of
+// /etc/fstab and the mount units in /etc/systemd/system.
+func (o *offline) lsblk() (string, error) {
+	mountpoint := func(p string) lsblkDevice {
+		return lsblkDevice{Mountpoints: []*string{&p}}
+	}
+	devices := []lsblkDevice{mountpoint("/")}
+
+	fstab, err := o.tree.Fstab()
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range fstab {
+		switch {
+		case entry.FSType == "swap":
+			swap, mp := "swap", "[SWAP]"
+			devices = append(devices, lsblkDevice{FSType: &swap, Mountpoints: []*string{&mp}})
+		case strings.HasPrefix(entry.Mountpoint, "/") && entry.Mountpoint != "/":
+			devices = append(devices, mountpoint(entry.Mountpoint))
+		}
+	}
+
+	entries, err := o.tree.ReadDir("etc/systemd/system")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	for _, entry := range entries {
+		if path.Ext(entry.Name()) != ".mount" {
+			continue
+		}
+		data, err := o.tree.ReadFile(path.Join("etc/systemd/system", entry.Name()))
+		if err != nil {
+			return "", err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			if where, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "Where="); ok {
+				devices = append(devices, mountpoint(strings.TrimSpace(where)))
+			}
+		}
+	}
+
+	out, err := json.Marshal(lsblkOutput{BlockDevices: devices})
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,175 @@
+package check_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	check "github.com/osbuild/images/cmd/check-host-config/check"
+	"github.com/osbuild/images/pkg/inspect"
+)
+
+// makeImageTree returns the tree of an image with the given files, values
+// starting with "->" are symlink targets.
+func makeImageTree(t *testing.T, files map[string]string) *inspect.Tree {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		if target, ok := strings.CutPrefix(content, "->"); ok {
+			require.NoError(t, os.Symlink(target, p))
+			continue
+		}
+		require.NoError(t, os.WriteFile(p, []byte(content), 0640))
+	}
+	tree, err := inspect.Open(dir, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { tree.Close() })
+	return tree
+}
+
+var offlineTestFiles = map[string]string{
+	"etc/os-release":             "->../usr/lib/os-release",
+	"usr/lib/os-release":         "ID=fedora\nVERSION_ID=43\n",
+	"etc/passwd":                 "root:x:0:0:root:/root:/bin/bash\nadmin:x:1000:1000::/home/admin:/bin/bash\n",
+	"etc/group":                  "root:x:0:\nadmin:x:1000:\n",
+	"etc/hostname":               "offline.example.com\n",
+	"etc/fstab":                  "UUID=1234 / xfs defaults 0 0\nUUID=5678 /home xfs defaults 0 0\nUUID=9abc none swap defaults 0 0\n",
+	"etc/motd":                   "hello\n",
+	"etc/kernel/cmdline":         "root=UUID=1234 console=ttyS0\n",
+	"boot/loader/entries/a.conf": "title Fedora\noptions root=UUID=1234 debug\n",
+
+	"usr/lib/systemd/system/sshd.service":                     "[Unit]\n[Service]\n[Install]\nWantedBy=multi-user.target\n",
+	"usr/lib/systemd/system/cups.service":                     "[Unit]\n[Service]\n[Install]\nWantedBy=multi-user.target\n",
+	"usr/lib/systemd/system/static.service":                   "[Unit]\n[Service]\n",
+	"etc/systemd/system/multi-user.target.wants/sshd.service": "->/usr/lib/systemd/system/sshd.service",
+	"etc/systemd/system/bluetooth.service":                    "->/dev/null",
+	"etc/systemd/system/data.mount":                           "[Mount]\nWhat=/dev/vdb\nWhere=/data\n",
+}
+
+func TestOfflineChecks(t *testing.T) {
+	restore := check.UseImageTree(makeImageTree(t, offlineTestFiles))
+	defer restore()
+
+	hostname := "offline.example.com"
+	tests := []struct {
+		check          string
+		customizations *blueprint.Customizations
+		wantErr        error
+	}{
+		{
+			check:          "users",
+			customizations: &blueprint.Customizations{User: []blueprint.UserCustomization{{Name: "admin"}}},
+		},
+		{
+			check:          "users",
+			customizations: &blueprint.Customizations{User: []blueprint.UserCustomization{{Name: "missing"}}},
+			wantErr:        check.ErrCheckFailed,
+		},
+		{
+			check:          "hostname",
+			customizations: &blueprint.Customizations{Hostname: &hostname},
+		},
+		{
+			check:          "srv-enabled",
+			customizations: &blueprint.Customizations{Services: &blueprint.ServicesCustomization{Enabled: []string{"sshd"}}},
+		},
+		{
+			check:          "srv-enabled",
+			customizations: &blueprint.Customizations{Services: &blueprint.ServicesCustomization{Enabled: []string{"cups"}}},
+			wantErr:        check.ErrCheckFailed,
+		},
+		{
+			check:          "srv-disabled",
+			customizations: &blueprint.Customizations{Services: &blueprint.ServicesCustomization{Disabled: []string{"cups.service"}}},
+		},
+		{
+			check:          "srv-disabled",
+			customizations: &blueprint.Customizations{Services: &blueprint.ServicesCustomization{Disabled: []string{"sshd", "missing"}}},
+			wantErr:        check.ErrCheckFailed,
+		},
+		{
+			check:          "srv-masked",
+			customizations: &blueprint.Customizations{Services: &blueprint.ServicesCustomization{Masked: []string{"bluetooth"}}},
+		},
+		{
+			check:          "srv-masked",
+			customizations: &blueprint.Customizations{Services: &blueprint.ServicesCustomization{Masked: []string{"cups"}}},
+			wantErr:        check.ErrCheckFailed,
+		},
+		{
+			check: "filesystem",
+			customizations: &blueprint.Customizations{Filesystem: []blueprint.FilesystemCustomization{
+				{Mountpoint: "/"}, {Mountpoint: "/home"}, {Mountpoint: "/data"},
+			}},
+		},
+		{
+			check: "filesystem",
+			customizations: &blueprint.Customizations{Filesystem: []blueprint.FilesystemCustomization{
+				{Mountpoint: "/var"},
+			}},
+			wantErr: check.ErrCheckFailed,
+		},
+		{
+			check: "files",
+			customizations: &blueprint.Customizations{Files: []blueprint.FileCustomization{
+				{Path: "/etc/motd", Mode: "0640", Data: "hello\n"},
+			}},
+		},
+		{
+			check: "files",
+			customizations: &blueprint.Customizations{Files: []blueprint.FileCustomization{
+				{Path: "/etc/motd", Data: "goodbye\n"},
+			}},
+			wantErr: check.ErrCheckFailed,
+		},
+		{
+			check:          "kernel",
+			customizations: &blueprint.Customizations{Kernel: &blueprint.KernelCustomization{Name: "kernel", Append: "debug"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.check, func(t *testing.T) {
+			chk := check.MustFindCheckByName(tt.check)
+			require.True(t, chk.Meta.Offline)
+			err := chk.Func(chk.Meta, buildConfig(tt.customizations))
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOfflineLookupAndOSRelease(t *testing.T) {
+	restore := check.UseImageTree(makeImageTree(t, offlineTestFiles))
+	defer restore()
+
+	uid, err := check.LookupUID("admin")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1000), uid)
+	_, err = check.LookupGID("missing")
+	assert.Error(t, err)
+
+	osRelease, err := check.ParseOSRelease("")
+	require.NoError(t, err)
+	assert.Equal(t, &check.OSRelease{ID: "fedora", VersionID: "43", MajorVersion: 43}, osRelease)
+
+	cmdline, err := check.ReadFile("/proc/cmdline")
+	require.NoError(t, err)
+	assert.Equal(t, "root=UUID=1234 debug\n", string(cmdline))
+
+	_, _, code, err := check.Exec("sudo", "dnf", "check-update")
+	assert.ErrorIs(t, err, check.ErrOfflineUnsupported)
+	assert.Equal(t, 127, code)
+}
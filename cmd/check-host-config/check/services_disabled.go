@@ -11,6 +11,7 @@ func init() {
 		Name:                   "srv-disabled",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, servicesDisabledCheck)
 }
 
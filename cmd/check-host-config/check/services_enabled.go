@@ -11,6 +11,7 @@ func init() {
 		Name:                   "srv-enabled",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, servicesEnabledCheck)
 }
 
@@ -11,6 +11,7 @@ func init() {
 		Name:                   "srv-masked",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, servicesMaskedCheck)
 }
 
@@ -11,6 +11,7 @@ func init() {
 		Name:                   "users",
 		RequiresBlueprint:      true,
 		RequiresCustomizations: true,
+		Offline:                true,
 	}, usersCheck)
 }
 
@@ -33,6 +33,11 @@ var ParseOSRelease = func(osReleasePath string) (*OSRelease, error) {
 		return nil, err
 	}
 
+	return newOSRelease(osrelease), nil
+}
+
+// newOSRelease returns the parsed fields of the os-release key/value pairs.
+func newOSRelease(osrelease map[string]string) *OSRelease {
 	release := &OSRelease{
 		ID:        osrelease["ID"],
 		VersionID: osrelease["VERSION_ID"],
@@ -55,7 +60,7 @@ var ParseOSRelease = func(osReleasePath string) (*OSRelease, error) {
 		}
 	}
 
-	return release, nil
+	return release
 }
 
 // ExecCommand is mockable version of os/exec.Command
@@ -14,6 +14,7 @@ import (
 
 	"github.com/osbuild/images/cmd/check-host-config/check"
 	"github.com/osbuild/images/internal/buildconfig"
+	"github.com/osbuild/images/pkg/inspect"
 )
 
 // waitForSystem waits until the system is reported by systemd as "running" or the timeout is reached.
@@ -61,7 +62,9 @@ func shouldRunOn(osRelease *check.OSRelease, runOn []string) bool {
 }
 
 // runChecks runs all checks sequentially and processes their results.
-func runChecks(checks []check.RegisteredCheck, config *buildconfig.BuildConfig, osRelease *check.OSRelease, quiet bool) bool {
+// With offline set, only the checks that support the tree of an image that
+// is not booted are run.
+func runChecks(checks []check.RegisteredCheck, config *buildconfig.BuildConfig, osRelease *check.OSRelease, quiet, offline bool) bool {
 	defer log.SetPrefix("")
 	if quiet {
 		log.SetOutput(io.Discard)
@@ -77,6 +80,8 @@ func runChecks(checks []check.RegisteredCheck, config *buildconfig.BuildConfig,
 		switch {
 		case !shouldRunOn(osRelease, meta.RunOn):
 			err = check.Skip(osRelease.ID + "-" + osRelease.VersionID + " excluded via RunOn: " + strings.Join(meta.RunOn, ", "))
+		case offline && !meta.Offline:
+			err = check.Skip("requires a running system")
 		case meta.TempDisabled != "":
 			err = check.Skip("temporarily disabled: " + meta.TempDisabled)
 		case meta.RequiresBlueprint && (config == nil || config.Blueprint == nil):
@@ -123,10 +128,12 @@ func main() {
 
 	waitTimeout := flag.Duration("wait-timeout", 15*time.Minute, "timeout for waiting for system to be running (0 to skip)")
 	quiet := flag.Bool("quiet", false, "less logging output")
+	image := flag.String("image", "", "check the built image (disk image, tar archive, OCI layout or ostree repository) instead of the running system")
+	ref := flag.String("ref", "", "ostree ref or commit to check with -image, needed if the repository has multiple refs")
 	flag.Parse()
 	configFile := flag.Arg(0)
 	if configFile == "" {
-		log.Fatalf("Missing build config file, usage: %s <config.json>", os.Args[0])
+		log.Fatalf("Missing build config file, usage: %s [-image <image>] <config.json>", os.Args[0])
 	}
 
 	var config *buildconfig.BuildConfig
@@ -136,7 +143,15 @@ func main() {
 		log.Fatalf("Failed to load build config: %v\n", err)
 	}
 
-	if err := waitForSystem(*waitTimeout); err != nil {
+	if *image != "" {
+		tree, err := inspect.Open(*image, &inspect.Options{Ref: *ref})
+		if err != nil {
+			log.Fatalf("Failed to open image: %v\n", err)
+		}
+		defer tree.Close()
+		restore := check.UseImageTree(tree)
+		defer restore()
+	} else if err := waitForSystem(*waitTimeout); err != nil {
 		log.Fatalf("Problem during waiting for system to be running: %v\n", err)
 	}
 
@@ -145,7 +160,7 @@ func main() {
 		log.Println("Could not parse /etc/os-release, RunOn filtering disabled")
 	}
 
-	if !runChecks(checks, config, osRelease, *quiet) {
+	if !runChecks(checks, config, osRelease, *quiet, *image != "") {
 		log.Fatalf("Host check with config %q failed, return code 1\n", configFile)
 	}
 }
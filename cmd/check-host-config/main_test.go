@@ -147,7 +147,7 @@ func TestRunChecks_RequiresBootc(t *testing.T) {
 				},
 			}
 
-			runChecks([]check.RegisteredCheck{dummyCheck}, tt.config, nil, true)
+			runChecks([]check.RegisteredCheck{dummyCheck}, tt.config, nil, true, false)
 			if checkRan != tt.wantCheckRan {
 				t.Errorf("check ran = %v, want %v", checkRan, tt.wantCheckRan)
 			}
@@ -326,3 +326,24 @@ func TestSmokeAll(t *testing.T) {
 		})
 	}
 }
+
+func TestRunChecks_Offline(t *testing.T) {
+	for _, supported := range []bool{false, true} {
+		checkRan := false
+		dummyCheck := check.RegisteredCheck{
+			Meta: &check.Metadata{
+				Name:    "test-offline-check",
+				Offline: supported,
+			},
+			Func: func(meta *check.Metadata, config *buildconfig.BuildConfig) error {
+				checkRan = true
+				return nil
+			},
+		}
+
+		runChecks([]check.RegisteredCheck{dummyCheck}, nil, nil, true, true)
+		if checkRan != supported {
+			t.Errorf("check ran = %v, want %v", checkRan, supported)
+		}
+	}
+}
@@ -233,6 +233,7 @@ func makeManifestJob(
 	cacheRoot string,
 	path string,
 	content map[string]bool,
+	depsolveCache bool,
 	metadata bool,
 	tmpdirRoot string,
 	bootcRemote bool,
@@ -323,6 +324,7 @@ func makeManifestJob(
 		var depsolvedSets map[string]depsolvednf.DepsolveResult
 		if content["packages"] {
 			solver := depsolvednf.NewSolver(distribution.ModulePlatformID(), distribution.Releasever(), archName, distribution.Name(), cacheDir)
+			solver.SetPersistentResultCache(depsolveCache)
 			depsolvedSets, err = solver.DepsolveAll(common.Must(manifest.GetPackageSetChains()))
 			if err != nil {
 				err = fmt.Errorf("[%s] depsolve failed: %s", filename, err.Error())
@@ -448,8 +450,9 @@ func main() {
 	flag.BoolVar(&buildconfigAllowUnknown, "buildconfig-allow-unknown", false, "allow unknown keys in buildconfig")
 
 	// content args
-	var packages, containers, commits, flatpaks, fakeBootc bool
+	var packages, depsolveCache, containers, commits, flatpaks, fakeBootc bool
 	flag.BoolVar(&packages, "packages", true, "depsolve package sets")
+	flag.BoolVar(&depsolveCache, "depsolve-cache", false, "reuse depsolve results of earlier runs while the repository metadata is unchanged")
 	flag.BoolVar(&containers, "containers", true, "resolve container checksums")
 	flag.BoolVar(&commits, "commits", false, "resolve ostree commit IDs")
 	flag.BoolVar(&flatpaks, "flatpaks", false, "resolve flatpak checksums")
@@ -575,7 +578,7 @@ func main() {
 					if dryRun {
 						fmt.Printf("%s,%s,%s,%s\n", distribution.Name(), archName, imgType.Name(), itConfig.Name)
 					} else {
-						job := makeManifestJob(itConfig, imgType, distribution, repos, archName, cacheRoot, outputDir, contentResolve, metadata, tmpdirRoot, false, "")
+						job := makeManifestJob(itConfig, imgType, distribution, repos, archName, cacheRoot, outputDir, contentResolve, depsolveCache, metadata, tmpdirRoot, false, "")
 						jobs = append(jobs, job)
 					}
 				}
@@ -642,7 +645,7 @@ func main() {
 						fmt.Printf("%s,%s,%s,%s\n", distribution.Name(), archName, imgType.Name(), itConfig.Name)
 					} else {
 						var repos []rpmmd.RepoConfig
-						job := makeManifestJob(itConfig, imgType, distribution, repos, archName, cacheRoot, outputDir, contentResolve, metadata, tmpdirRoot, bootcRemote, bootcInstallerRef)
+						job := makeManifestJob(itConfig, imgType, distribution, repos, archName, cacheRoot, outputDir, contentResolve, depsolveCache, metadata, tmpdirRoot, bootcRemote, bootcInstallerRef)
 						jobs = append(jobs, job)
 					}
 				}
@@ -731,7 +734,7 @@ func main() {
 						}
 
 						var repos []rpmmd.RepoConfig
-						job := makeManifestJob(itConfig, imgType, distribution, repos, archName, cacheRoot, outputDir, contentResolve, metadata, tmpdirRoot, bootcRemote, bootcInstallerRef)
+						job := makeManifestJob(itConfig, imgType, distribution, repos, archName, cacheRoot, outputDir, contentResolve, depsolveCache, metadata, tmpdirRoot, bootcRemote, bootcInstallerRef)
 						jobs = append(jobs, job)
 					}
 				}
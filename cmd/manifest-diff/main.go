@@ -0,0 +1,167 @@
+// Standalone executable that explains the differences between two osbuild
+// manifests, like added packages or changed stage options:
+//
+//	go run ./cmd/manifest-diff old/manifest.json new/manifest.json
+//
+// The manifests can also be outputs of gen-manifests, and directories are
+// compared file by file, to review the effect of a change to the distro
+// definitions on all manifests:
+//
+//	go run ./cmd/manifest-diff ref-manifests/ new-manifests/
+//
+// The exit code is 1 if there are differences.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/osbuild/images/pkg/osbuild/manifestdiff"
+)
+
+// readManifest returns the manifest in the given file, which is either an
+// osbuild manifest or the output of gen-manifests.
+func readManifest(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var genManifestsOutput struct {
+		Manifest json.RawMessage `json:"manifest"`
+	}
+	if err := json.Unmarshal(data, &genManifestsOutput); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	if genManifestsOutput.Manifest != nil {
+		return genManifestsOutput.Manifest, nil
+	}
+	return data, nil
+}
+
+func diffFiles(from, to string) (*manifestdiff.Report, error) {
+	a, err := readManifest(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readManifest(to)
+	if err != nil {
+		return nil, err
+	}
+	report, err := manifestdiff.Diff(a, b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare %s and %s: %w", from, to, err)
+	}
+	return report, nil
+}
+
+func jsonFiles(dir string) ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for idx, name := range names {
+		names[idx] = filepath.Base(name)
+	}
+	return names, nil
+}
+
+func run() (bool, error) {
+	var jsonOutput bool
+	flag.BoolVar(&jsonOutput, "json", false, "print the differences as json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-json] <old> <new>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	from, to := flag.Arg(0), flag.Arg(1)
+
+	// reports by file name, with a single entry for files
+	reports := make(map[string]*manifestdiff.Report)
+	var added, removed []string
+	st, err := os.Stat(from)
+	if err != nil {
+		return false, err
+	}
+	if st.IsDir() {
+		fromNames, err := jsonFiles(from)
+		if err != nil {
+			return false, err
+		}
+		toNames, err := jsonFiles(to)
+		if err != nil {
+			return false, err
+		}
+		for _, name := range fromNames {
+			if !slices.Contains(toNames, name) {
+				removed = append(removed, name)
+				continue
+			}
+			report, err := diffFiles(filepath.Join(from, name), filepath.Join(to, name))
+			if err != nil {
+				return false, err
+			}
+			if !report.Empty() {
+				reports[name] = report
+			}
+		}
+		for _, name := range toNames {
+			if !slices.Contains(fromNames, name) {
+				added = append(added, name)
+			}
+		}
+	} else {
+		report, err := diffFiles(from, to)
+		if err != nil {
+			return false, err
+		}
+		if !report.Empty() {
+			reports[filepath.Base(to)] = report
+		}
+	}
+	differs := len(reports) > 0 || len(added) > 0 || len(removed) > 0
+
+	if jsonOutput {
+		out := struct {
+			Added   []string                        `json:"added,omitempty"`
+			Removed []string                        `json:"removed,omitempty"`
+			Reports map[string]*manifestdiff.Report `json:"reports,omitempty"`
+		}{added, removed, reports}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return differs, enc.Encode(out)
+	}
+
+	for _, name := range removed {
+		fmt.Printf("- %s\n", name)
+	}
+	for _, name := range added {
+		fmt.Printf("+ %s\n", name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(reports)) {
+		if st.IsDir() {
+			fmt.Printf("=== %s\n", name)
+		}
+		fmt.Print(reports[name])
+	}
+	return differs, nil
+}
+
+func main() {
+	differs, err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if differs {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,110 @@
+// Standalone executable that renders the laid out partition table of an image
+// type, to review the effect of changes to the partition tables in the
+// distro definitions. The layout can be saved as json and compared with the
+// layout after a change:
+//
+//	go run ./cmd/partition-table -distro fedora-42 -type qcow2 -json > old.json
+//	(change the definitions)
+//	go run ./cmd/partition-table -distro fedora-42 -type qcow2 -diff old.json
+//
+// The partition table is created like for an image without customizations,
+// including the required minimum partition sizes and the default filesystem
+// of the image type.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/distrofactory"
+)
+
+func partitionTable(distroName, archName, imgTypeName string, size uint64) (*disk.PartitionTable, error) {
+	distribution := distrofactory.NewDefault().GetDistro(distroName)
+	if distribution == nil {
+		return nil, fmt.Errorf("invalid or unsupported distribution: %q", distroName)
+	}
+	archi, err := distribution.GetArch(archName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arch name %q for distro %q: %w", archName, distroName, err)
+	}
+	imgType, err := archi.GetImageType(imgTypeName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image type %q for distro %q and arch %q: %w", imgTypeName, distroName, archName, err)
+	}
+
+	ptImgType, ok := imgType.(distro.PartitionTableImageType)
+	if !ok {
+		return nil, fmt.Errorf("image type %q cannot generate its partition table", imgTypeName)
+	}
+
+	// use a fixed seed so the output is stable
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+	options := distro.ImageOptions{
+		Size: size,
+	}
+	return ptImgType.GenPartitionTable(&blueprint.Customizations{}, options, rng)
+}
+
+func run() error {
+	var distroName, archName, imgTypeName, diffFile string
+	var size uint64
+	var jsonOutput bool
+	flag.StringVar(&distroName, "distro", "", "distribution (required)")
+	flag.StringVar(&archName, "arch", arch.Current().String(), "architecture")
+	flag.StringVar(&imgTypeName, "type", "", "image type name (required)")
+	flag.Uint64Var(&size, "size", 0, "image size in bytes (default: the default size of the image type)")
+	flag.BoolVar(&jsonOutput, "json", false, "print the layout as json")
+	flag.StringVar(&diffFile, "diff", "", "compare the layout with the json layout in the given file")
+	flag.Parse()
+
+	if distroName == "" || imgTypeName == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	pt, err := partitionTable(distroName, archName, imgTypeName, size)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case jsonOutput:
+		out, err := json.MarshalIndent(pt.Layout(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case diffFile != "":
+		data, err := os.ReadFile(diffFile)
+		if err != nil {
+			return err
+		}
+		var oldLayout []disk.LayoutEntry
+		if err := json.Unmarshal(data, &oldLayout); err != nil {
+			return fmt.Errorf("cannot read layout from %q: %w", diffFile, err)
+		}
+		for _, change := range disk.DiffLayout(oldLayout, pt.Layout()) {
+			fmt.Println(change)
+		}
+	default:
+		return pt.RenderLayout(os.Stdout)
+	}
+
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
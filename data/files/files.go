@@ -2,5 +2,5 @@ package files
 
 import "embed"
 
-//go:embed pxetree/* iso/*
+//go:embed pxetree/* iso/* hyperv/*
 var Data embed.FS
@@ -0,0 +1,25 @@
+# Creates a Hyper-V generation 2 virtual machine that boots from the
+# @VHDX@ disk next to this script. Hyper-V can only import virtual machine
+# configurations that it exported itself, so the virtual machine is created
+# from scratch instead.
+#
+# Run it from an elevated PowerShell in the directory the archive was
+# extracted to, the disk is used in place:
+#
+#   .\@SCRIPT@ -Name my-vm -SwitchName "Default Switch"
+param(
+    [string]$Name = "@NAME@",
+    [string]$SwitchName = "Default Switch",
+    [long]$MemoryStartupBytes = 2GB,
+    [int]$ProcessorCount = 2
+)
+
+$ErrorActionPreference = "Stop"
+
+$vhdx = Join-Path $PSScriptRoot "@VHDX@"
+$vm = New-VM -Name $Name -Generation 2 -MemoryStartupBytes $MemoryStartupBytes -VHDPath $vhdx -SwitchName $SwitchName
+Set-VMProcessor -VM $vm -Count $ProcessorCount
+# the shim of the image is signed by the Microsoft UEFI CA and not by the
+# Microsoft Windows CA that is the default of generation 2 machines
+Set-VMFirmware -VM $vm -EnableSecureBoot On -SecureBootTemplate MicrosoftUEFICertificateAuthority
+$vm
@@ -0,0 +1,449 @@
+// Package buildpolicy implements organisation-wide rules for blueprints that
+// are checked before a manifest is generated, e.g. forbidden packages or
+// allowed repositories. Unlike the path policies of pkg/policies, which
+// protect the image from customizations that break it, build policies are
+// defined by the users of the library.
+//
+// Policies are YAML documents:
+//
+//	name: corp-baseline
+//	forbidden_packages:
+//	  - telnet-server
+//	  - "rsh*"
+//	required_kernel_args:
+//	  - audit=1
+//	minimum_partition_sizes:
+//	  /: 10 GiB
+//	  /var/log: 2 GiB
+//	forbidden_users:
+//	  - admin
+//	forbidden_groups:
+//	  - wheel
+//	openscap_profile: xccdf_org.ssgproject.content_profile_cis
+//	allowed_repositories:
+//	  - https://mirror.example.com/
+package buildpolicy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// Rule names, used in the Rule field of violations.
+const (
+	RuleForbiddenPackages     = "forbidden_packages"
+	RuleRequiredKernelArgs    = "required_kernel_args"
+	RuleMinimumPartitionSizes = "minimum_partition_sizes"
+	RuleForbiddenUsers        = "forbidden_users"
+	RuleForbiddenGroups       = "forbidden_groups"
+	RuleOpenSCAPProfile       = "openscap_profile"
+	RuleAllowedRepositories   = "allowed_repositories"
+)
+
+// Policy is a set of rules for blueprints. Empty rules are not checked.
+type Policy struct {
+	// Name identifies the policy in violation reports.
+	Name string `yaml:"name"`
+
+	// ForbiddenPackages are shell patterns (see path.Match) of package
+	// names that must not be requested by the blueprint. They are matched
+	// against the packages, the modules and the package groups of the
+	// blueprint, package groups as "@<group>" like in dnf(8), so that
+	// e.g. "@container-management" forbids that group.
+	ForbiddenPackages []string `yaml:"forbidden_packages"`
+
+	// RequiredKernelArgs must be in the kernel command line, i.e. in the
+	// default kernel arguments of the image type or appended by the
+	// blueprint.
+	RequiredKernelArgs []string `yaml:"required_kernel_args"`
+
+	// MinimumPartitionSizes are the minimum sizes of the filesystems of
+	// mountpoints. The mountpoints need to be separate filesystems, with
+	// the size requested by the blueprint or, if the blueprint does not
+	// customize the mountpoint, by the partition table of the image type.
+	// Image types without a partition table are not checked.
+	MinimumPartitionSizes map[string]datasizes.Size `yaml:"minimum_partition_sizes"`
+
+	// ForbiddenUsers and ForbiddenGroups are names of users and groups
+	// that must not be created by the blueprint.
+	ForbiddenUsers  []string `yaml:"forbidden_users"`
+	ForbiddenGroups []string `yaml:"forbidden_groups"`
+
+	// OpenSCAPProfile is the ID of the OpenSCAP profile the blueprint
+	// needs to apply.
+	OpenSCAPProfile string `yaml:"openscap_profile"`
+
+	// AllowedRepositories are URL prefixes, all URLs of the repositories
+	// used for the build need to start with one of them.
+	AllowedRepositories []string `yaml:"allowed_repositories"`
+}
+
+// Parse reads a policy document.
+func Parse(r io.Reader) (*Policy, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("cannot parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Load reads the policy document at the given path.
+func Load(filename string) (*Policy, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return p, nil
+}
+
+// Validate returns an error if the rules of the policy are invalid.
+func (p *Policy) Validate() error {
+	for _, pattern := range p.ForbiddenPackages {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid package pattern %q in %s: %w", pattern, RuleForbiddenPackages, err)
+		}
+	}
+	for mountpoint := range p.MinimumPartitionSizes {
+		if !path.IsAbs(mountpoint) || path.Clean(mountpoint) != mountpoint {
+			return fmt.Errorf("invalid mountpoint %q in %s", mountpoint, RuleMinimumPartitionSizes)
+		}
+	}
+	for _, prefix := range p.AllowedRepositories {
+		if prefix == "" {
+			return fmt.Errorf("empty URL prefix in %s", RuleAllowedRepositories)
+		}
+	}
+	return nil
+}
+
+// Violation is a blueprint setting that does not comply with a rule.
+type Violation struct {
+	// Rule is the name of the violated rule, one of the Rule* constants.
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// Error is returned by Check if there are violations.
+type Error struct {
+	Policy     string
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, 0, len(e.Violations)+1)
+	name := ""
+	if e.Policy != "" {
+		name = fmt.Sprintf(" %q", e.Policy)
+	}
+	lines = append(lines, fmt.Sprintf("blueprint violates policy%s:", name))
+	for _, v := range e.Violations {
+		lines = append(lines, "  "+v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check evaluates the policy and returns an *Error with all violations, or
+// nil if the blueprint complies with the policy.
+func (p *Policy) Check(bp *blueprint.Blueprint, imgType distro.ImageType, repos []rpmmd.RepoConfig) error {
+	violations, err := p.Evaluate(bp, imgType, repos)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &Error{Policy: p.Name, Violations: violations}
+	}
+	return nil
+}
+
+// Evaluate returns the violations of the policy by a blueprint for the
+// image type. The repositories are the base repositories of the build, the
+// custom repositories of the blueprint are checked as well.
+func (p *Policy) Evaluate(bp *blueprint.Blueprint, imgType distro.ImageType, repos []rpmmd.RepoConfig) ([]Violation, error) {
+	if bp == nil {
+		bp = &blueprint.Blueprint{}
+	}
+	var violations []Violation
+	for _, eval := range []func(*blueprint.Blueprint, distro.ImageType, []rpmmd.RepoConfig) ([]Violation, error){
+		p.checkPackages,
+		p.checkKernelArgs,
+		p.checkPartitionSizes,
+		p.checkAccounts,
+		p.checkOpenSCAP,
+		p.checkRepositories,
+	} {
+		v, err := eval(bp, imgType, repos)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, v...)
+	}
+	return violations, nil
+}
+
+func (p *Policy) checkPackages(bp *blueprint.Blueprint, _ distro.ImageType, _ []rpmmd.RepoConfig) ([]Violation, error) {
+	if len(p.ForbiddenPackages) == 0 {
+		return nil, nil
+	}
+	type request struct {
+		kind string
+		name string
+	}
+	var requests []request
+	for _, pkg := range bp.Packages {
+		requests = append(requests, request{"package", pkg.Name})
+	}
+	if kernel := bp.Customizations.GetKernel(); kernel != nil && kernel.Name != "" {
+		requests = append(requests, request{"package", kernel.Name})
+	}
+	for _, module := range bp.Modules {
+		requests = append(requests, request{"module", module.Name})
+	}
+	for _, group := range bp.Groups {
+		requests = append(requests, request{"package group", "@" + group.Name})
+	}
+
+	var violations []Violation
+	for _, req := range requests {
+		for _, pattern := range p.ForbiddenPackages {
+			// patterns are validated when the policy is loaded
+			if ok, _ := path.Match(pattern, req.name); ok {
+				violations = append(violations, Violation{
+					Rule:    RuleForbiddenPackages,
+					Message: fmt.Sprintf("%s %q is forbidden (%q)", req.kind, req.name, pattern),
+				})
+				break
+			}
+		}
+	}
+	return violations, nil
+}
+
+func (p *Policy) checkKernelArgs(bp *blueprint.Blueprint, imgType distro.ImageType, _ []rpmmd.RepoConfig) ([]Violation, error) {
+	var args []string
+	if it, ok := imgType.(distro.ImageConfigImageType); ok {
+		if imageConfig := it.DefaultImageConfig(); imageConfig != nil {
+			for _, options := range imageConfig.KernelOptions {
+				args = append(args, strings.Fields(options)...)
+			}
+		}
+	}
+	if kernel := bp.Customizations.GetKernel(); kernel != nil {
+		args = append(args, strings.Fields(kernel.Append)...)
+	}
+	var violations []Violation
+	for _, required := range p.RequiredKernelArgs {
+		if !slices.Contains(args, required) {
+			violations = append(violations, Violation{
+				Rule:    RuleRequiredKernelArgs,
+				Message: fmt.Sprintf("kernel argument %q is required", required),
+			})
+		}
+	}
+	return violations, nil
+}
+
+// requestedSizes returns the sizes of the mountpoints that are customized
+// in the blueprint.
+func requestedSizes(bp *blueprint.Blueprint) (map[string]datasizes.Size, error) {
+	sizes := make(map[string]datasizes.Size)
+	for _, fs := range bp.Customizations.GetFilesystems() {
+		sizes[fs.Mountpoint] = datasizes.Size(fs.MinSize)
+	}
+
+	partitioning, err := bp.Customizations.GetPartitioning()
+	if err != nil {
+		return nil, err
+	}
+	if partitioning == nil {
+		return sizes, nil
+	}
+	for _, part := range partitioning.Partitions {
+		switch part.Type {
+		case "plain", "":
+			if part.Mountpoint != "" {
+				sizes[part.Mountpoint] = datasizes.Size(part.MinSize)
+			}
+		case "lvm":
+			for _, lv := range part.LogicalVolumes {
+				if lv.Mountpoint != "" {
+					sizes[lv.Mountpoint] = datasizes.Size(lv.MinSize)
+				}
+			}
+		case "btrfs":
+			// subvolumes share the space of the volume
+			for _, subvol := range part.Subvolumes {
+				if subvol.Mountpoint != "" {
+					sizes[subvol.Mountpoint] = datasizes.Size(part.MinSize)
+				}
+			}
+		}
+	}
+	return sizes, nil
+}
+
+func (p *Policy) checkPartitionSizes(bp *blueprint.Blueprint, imgType distro.ImageType, _ []rpmmd.RepoConfig) ([]Violation, error) {
+	if len(p.MinimumPartitionSizes) == 0 || imgType == nil {
+		return nil, nil
+	}
+	basePT, err := imgType.BasePartitionTable()
+	if err != nil {
+		return nil, err
+	}
+	if basePT == nil {
+		// nothing to check for e.g. containers and archives
+		return nil, nil
+	}
+	sizes, err := requestedSizes(bp)
+	if err != nil {
+		return nil, err
+	}
+
+	mountpoints := make([]string, 0, len(p.MinimumPartitionSizes))
+	for mountpoint := range p.MinimumPartitionSizes {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+	sort.Strings(mountpoints)
+
+	var violations []Violation
+	for _, mountpoint := range mountpoints {
+		minSize := p.MinimumPartitionSizes[mountpoint]
+		size, ok := sizes[mountpoint]
+		if !ok {
+			if !basePT.ContainsMountpoint(mountpoint) {
+				violations = append(violations, Violation{
+					Rule:    RuleMinimumPartitionSizes,
+					Message: fmt.Sprintf("%s needs to be a separate filesystem of at least %d bytes", mountpoint, minSize),
+				})
+				continue
+			}
+			if size, err = basePT.GetMountpointSize(mountpoint); err != nil {
+				return nil, err
+			}
+		}
+		if size < minSize {
+			violations = append(violations, Violation{
+				Rule:    RuleMinimumPartitionSizes,
+				Message: fmt.Sprintf("%s has %d bytes, at least %d bytes are required", mountpoint, size, minSize),
+			})
+		}
+	}
+	return violations, nil
+}
+
+func (p *Policy) checkAccounts(bp *blueprint.Blueprint, _ distro.ImageType, _ []rpmmd.RepoConfig) ([]Violation, error) {
+	var violations []Violation
+	for _, user := range bp.Customizations.GetUsers() {
+		if slices.Contains(p.ForbiddenUsers, user.Name) {
+			violations = append(violations, Violation{
+				Rule:    RuleForbiddenUsers,
+				Message: fmt.Sprintf("user %q is forbidden", user.Name),
+			})
+		}
+	}
+	groups, err := bp.Customizations.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if slices.Contains(p.ForbiddenGroups, group.Name) {
+			violations = append(violations, Violation{
+				Rule:    RuleForbiddenGroups,
+				Message: fmt.Sprintf("group %q is forbidden", group.Name),
+			})
+		}
+	}
+	// users are added to forbidden groups as supplementary groups too
+	for _, user := range bp.Customizations.GetUsers() {
+		for _, group := range user.Groups {
+			if slices.Contains(p.ForbiddenGroups, group) {
+				violations = append(violations, Violation{
+					Rule:    RuleForbiddenGroups,
+					Message: fmt.Sprintf("user %q is in forbidden group %q", user.Name, group),
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+func (p *Policy) checkOpenSCAP(bp *blueprint.Blueprint, _ distro.ImageType, _ []rpmmd.RepoConfig) ([]Violation, error) {
+	if p.OpenSCAPProfile == "" {
+		return nil, nil
+	}
+	oscap := bp.Customizations.GetOpenSCAP()
+	switch {
+	case oscap == nil:
+		return []Violation{{
+			Rule:    RuleOpenSCAPProfile,
+			Message: fmt.Sprintf("OpenSCAP profile %q is required", p.OpenSCAPProfile),
+		}}, nil
+	case oscap.ProfileID != p.OpenSCAPProfile:
+		return []Violation{{
+			Rule:    RuleOpenSCAPProfile,
+			Message: fmt.Sprintf("OpenSCAP profile %q is required, got %q", p.OpenSCAPProfile, oscap.ProfileID),
+		}}, nil
+	}
+	return nil, nil
+}
+
+func (p *Policy) checkRepositories(bp *blueprint.Blueprint, _ distro.ImageType, repos []rpmmd.RepoConfig) ([]Violation, error) {
+	if len(p.AllowedRepositories) == 0 {
+		return nil, nil
+	}
+	customRepos, err := bp.Customizations.GetRepositories()
+	if err != nil {
+		return nil, err
+	}
+	customRepoConfigs, _, err := blueprint.RepoCustomizationsToRepoConfigAndGPGKeyFiles(customRepos)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := func(url string) bool {
+		for _, prefix := range p.AllowedRepositories {
+			if strings.HasPrefix(url, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	var violations []Violation
+	for _, repo := range append(slices.Clone(repos), customRepoConfigs...) {
+		urls := append(slices.Clone(repo.BaseURLs), repo.Metalink, repo.MirrorList)
+		for _, url := range urls {
+			if url != "" && !allowed(url) {
+				violations = append(violations, Violation{
+					Rule:    RuleAllowedRepositories,
+					Message: fmt.Sprintf("repository %q uses URL %q that is not allowed", repo.Id, url),
+				})
+			}
+		}
+	}
+	return violations, nil
+}
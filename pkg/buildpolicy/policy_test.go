@@ -0,0 +1,249 @@
+package buildpolicy_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/buildpolicy"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+const testPolicy = `
+name: corp-baseline
+forbidden_packages:
+  - telnet-server
+  - "rsh*"
+required_kernel_args:
+  - audit=1
+minimum_partition_sizes:
+  /boot: 1 GiB
+  /var/log: 2 GiB
+forbidden_users:
+  - admin
+forbidden_groups:
+  - wheel
+openscap_profile: xccdf_org.ssgproject.content_profile_cis
+allowed_repositories:
+  - https://mirror.example.com/
+`
+
+// fakeImageType only implements the methods used by the evaluator.
+type fakeImageType struct {
+	distro.ImageType
+	pt          *disk.PartitionTable
+	imageConfig *distro.ImageConfig
+}
+
+func (f *fakeImageType) BasePartitionTable() (*disk.PartitionTable, error) {
+	return f.pt, nil
+}
+
+func (f *fakeImageType) DefaultImageConfig() *distro.ImageConfig {
+	return f.imageConfig
+}
+
+func newFakeImageType() *fakeImageType {
+	pt := testdisk.TestPartitionTables()["plain"]
+	return &fakeImageType{pt: &pt}
+}
+
+func TestParse(t *testing.T) {
+	p, err := buildpolicy.Parse(strings.NewReader(testPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, "corp-baseline", p.Name)
+	assert.Equal(t, []string{"telnet-server", "rsh*"}, p.ForbiddenPackages)
+	assert.Equal(t, map[string]datasizes.Size{
+		"/boot":    1 * datasizes.GiB,
+		"/var/log": 2 * datasizes.GiB,
+	}, p.MinimumPartitionSizes)
+	assert.Equal(t, []string{"https://mirror.example.com/"}, p.AllowedRepositories)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		expErr string
+	}{
+		{"unknown_rule: true\n", "field unknown_rule not found"},
+		{"forbidden_packages: ['[']\n", `invalid package pattern "[" in forbidden_packages`},
+		{"minimum_partition_sizes: {var: 1 GiB}\n", `invalid mountpoint "var" in minimum_partition_sizes`},
+		{"allowed_repositories: ['']\n", "empty URL prefix in allowed_repositories"},
+	} {
+		_, err := buildpolicy.Parse(strings.NewReader(tc.policy))
+		assert.ErrorContains(t, err, tc.expErr)
+	}
+}
+
+func TestEvaluateCompliant(t *testing.T) {
+	p, err := buildpolicy.Parse(strings.NewReader(testPolicy))
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Packages: []blueprint.Package{{Name: "vim-enhanced"}},
+		Customizations: &blueprint.Customizations{
+			Kernel: &blueprint.KernelCustomization{Append: "quiet audit=1"},
+			Filesystem: []blueprint.FilesystemCustomization{
+				{Mountpoint: "/boot", MinSize: 1 * datasizes.GiB},
+				{Mountpoint: "/var/log", MinSize: 4 * datasizes.GiB},
+			},
+			User: []blueprint.UserCustomization{{Name: "alice", Groups: []string{"users"}}},
+			OpenSCAP: &blueprint.OpenSCAPCustomization{
+				ProfileID: "xccdf_org.ssgproject.content_profile_cis",
+			},
+		},
+	}
+	repos := []rpmmd.RepoConfig{
+		{Id: "baseos", BaseURLs: []string{"https://mirror.example.com/baseos/"}},
+	}
+	violations, err := p.Evaluate(bp, newFakeImageType(), repos)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.NoError(t, p.Check(bp, newFakeImageType(), repos))
+}
+
+func TestEvaluateViolations(t *testing.T) {
+	p, err := buildpolicy.Parse(strings.NewReader(testPolicy))
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Packages: []blueprint.Package{{Name: "telnet-server"}, {Name: "rsh-server"}, {Name: "vim"}},
+		Customizations: &blueprint.Customizations{
+			Kernel: &blueprint.KernelCustomization{Append: "audit=0"},
+			User: []blueprint.UserCustomization{
+				{Name: "admin"},
+				{Name: "alice", Groups: []string{"wheel"}},
+			},
+			Group: []blueprint.GroupCustomization{{Name: "wheel"}},
+			OpenSCAP: &blueprint.OpenSCAPCustomization{
+				ProfileID: "xccdf_org.ssgproject.content_profile_ospp",
+			},
+		},
+	}
+	repos := []rpmmd.RepoConfig{
+		{Id: "baseos", BaseURLs: []string{"https://mirror.example.com/baseos/"}},
+		{Id: "other", Metalink: "https://other.example.com/metalink"},
+	}
+	violations, err := p.Evaluate(bp, newFakeImageType(), repos)
+	require.NoError(t, err)
+	assert.Equal(t, []buildpolicy.Violation{
+		{Rule: buildpolicy.RuleForbiddenPackages, Message: `package "telnet-server" is forbidden ("telnet-server")`},
+		{Rule: buildpolicy.RuleForbiddenPackages, Message: `package "rsh-server" is forbidden ("rsh*")`},
+		{Rule: buildpolicy.RuleRequiredKernelArgs, Message: `kernel argument "audit=1" is required`},
+		{Rule: buildpolicy.RuleMinimumPartitionSizes, Message: "/boot has 524288000 bytes, at least 1073741824 bytes are required"},
+		{Rule: buildpolicy.RuleMinimumPartitionSizes, Message: "/var/log needs to be a separate filesystem of at least 2147483648 bytes"},
+		{Rule: buildpolicy.RuleForbiddenUsers, Message: `user "admin" is forbidden`},
+		{Rule: buildpolicy.RuleForbiddenGroups, Message: `group "wheel" is forbidden`},
+		{Rule: buildpolicy.RuleForbiddenGroups, Message: `user "alice" is in forbidden group "wheel"`},
+		{Rule: buildpolicy.RuleOpenSCAPProfile, Message: `OpenSCAP profile "xccdf_org.ssgproject.content_profile_cis" is required, got "xccdf_org.ssgproject.content_profile_ospp"`},
+		{Rule: buildpolicy.RuleAllowedRepositories, Message: `repository "other" uses URL "https://other.example.com/metalink" that is not allowed`},
+	}, violations)
+
+	err = p.Check(bp, newFakeImageType(), repos)
+	var policyErr *buildpolicy.Error
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, violations, policyErr.Violations)
+	assert.Contains(t, err.Error(), `blueprint violates policy "corp-baseline":`)
+}
+
+func TestEvaluateModulesAndGroups(t *testing.T) {
+	p := &buildpolicy.Policy{
+		ForbiddenPackages: []string{"rsh*", "@container-*"},
+	}
+	bp := &blueprint.Blueprint{
+		Modules: []blueprint.Package{{Name: "rsh", Version: "1.0"}, {Name: "nodejs"}},
+		Groups:  []blueprint.Group{{Name: "core"}, {Name: "container-management"}},
+	}
+	violations, err := p.Evaluate(bp, newFakeImageType(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []buildpolicy.Violation{
+		{Rule: buildpolicy.RuleForbiddenPackages, Message: `module "rsh" is forbidden ("rsh*")`},
+		{Rule: buildpolicy.RuleForbiddenPackages, Message: `package group "@container-management" is forbidden ("@container-*")`},
+	}, violations)
+}
+
+func TestEvaluateDefaultKernelArgs(t *testing.T) {
+	p := &buildpolicy.Policy{
+		RequiredKernelArgs: []string{"audit=1", "console=ttyS0"},
+	}
+	imgType := newFakeImageType()
+	imgType.imageConfig = &distro.ImageConfig{
+		KernelOptions: []string{"console=tty0 console=ttyS0"},
+	}
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Kernel: &blueprint.KernelCustomization{Append: "audit=1"},
+		},
+	}
+	violations, err := p.Evaluate(bp, imgType, nil)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+
+	violations, err = p.Evaluate(bp, newFakeImageType(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []buildpolicy.Violation{
+		{Rule: buildpolicy.RuleRequiredKernelArgs, Message: `kernel argument "console=ttyS0" is required`},
+	}, violations)
+}
+
+func TestEvaluatePartitionSizesWithoutPartitionTable(t *testing.T) {
+	p := &buildpolicy.Policy{
+		MinimumPartitionSizes: map[string]datasizes.Size{"/var": 1 * datasizes.GiB},
+	}
+	violations, err := p.Evaluate(&blueprint.Blueprint{}, &fakeImageType{}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+func TestEvaluatePartitioningCustomizations(t *testing.T) {
+	p := &buildpolicy.Policy{
+		MinimumPartitionSizes: map[string]datasizes.Size{
+			"/":    10 * datasizes.GiB,
+			"/var": 5 * datasizes.GiB,
+		},
+	}
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Disk: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "lvm",
+						VGCustomization: blueprint.VGCustomization{
+							Name: "vg",
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									Name:    "root",
+									MinSize: 12 * datasizes.GiB,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/",
+										FSType:     "xfs",
+									},
+								},
+								{
+									Name:    "var",
+									MinSize: 1 * datasizes.GiB,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/var",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	violations, err := p.Evaluate(bp, newFakeImageType(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []buildpolicy.Violation{
+		{Rule: buildpolicy.RuleMinimumPartitionSizes, Message: "/var has 1073741824 bytes, at least 5368709120 bytes are required"},
+	}, violations)
+}
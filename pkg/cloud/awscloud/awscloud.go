@@ -16,6 +16,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
+	"github.com/aws/aws-sdk-go-v2/service/ebs"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -30,6 +31,7 @@ type AWS struct {
 	s3         s3Client
 	s3uploader s3Uploader
 	s3presign  s3Presign
+	ebs        ebsClient
 }
 
 // Allow to mock the EC2 SnapshotImportedWaiter for testing purposes
@@ -42,6 +44,11 @@ var newInstanceRunningWaiterEC2 = func(client ec2.DescribeInstancesAPIClient, op
 	return ec2.NewInstanceRunningWaiter(client, optFns...)
 }
 
+// Allow to mock the EC2 SnapshotCompletedWaiter for testing purposes
+var newSnapshotCompletedWaiterEC2 = func(client ec2.DescribeSnapshotsAPIClient, optFns ...func(*ec2.SnapshotCompletedWaiterOptions)) snapshotCompletedWaiterEC2 {
+	return ec2.NewSnapshotCompletedWaiter(client, optFns...)
+}
+
 var newTerminateInstancesWaiterEC2 = func(client ec2.DescribeInstancesAPIClient, optFns ...func(*ec2.InstanceTerminatedWaiterOptions)) instanceTerminatedWaiterEC2 {
 	return ec2.NewInstanceTerminatedWaiter(client, optFns...)
 }
@@ -63,6 +70,7 @@ func newAwsFromConfig(cfg aws.Config) *AWS {
 		s3:         s3cli,
 		s3uploader: transfermanager.New(s3cli),
 		s3presign:  s3.NewPresignClient(s3cli),
+		ebs:        ebs.NewFromConfig(cfg),
 	}
 }
 
@@ -168,6 +176,7 @@ func newAwsFromCredsWithEndpoint(optsFunc config.LoadOptionsFunc, region, endpoi
 		s3:         s3cli,
 		s3uploader: transfermanager.New(s3cli),
 		s3presign:  s3.NewPresignClient(s3cli),
+		ebs:        ebs.NewFromConfig(cfg),
 	}, nil
 }
 
@@ -233,6 +242,11 @@ func ec2BootMode(bootMode *platform.BootMode) (ec2types.BootModeValues, error) {
 	}
 }
 
+var rpmArchToEC2Arch = map[arch.Arch]ec2types.ArchitectureValues{
+	arch.ARCH_X86_64:  ec2types.ArchitectureValuesX8664,
+	arch.ARCH_AARCH64: ec2types.ArchitectureValuesArm64,
+}
+
 // Register is a function that imports a snapshot, waits for the snapshot to
 // fully import, tags the snapshot, cleans up the image in S3, and registers
 // an AMI in AWS.
@@ -240,11 +254,6 @@ func ec2BootMode(bootMode *platform.BootMode) (ec2types.BootModeValues, error) {
 // mode is not specified, then the instances launched from this AMI use the
 // default boot mode value of the instance type.
 func (a *AWS) Register(name, bucket, key string, tags []AWSTag, shareWith []string, architecture arch.Arch, bootMode *platform.BootMode, importRole *string) (string, string, error) {
-	rpmArchToEC2Arch := map[arch.Arch]ec2types.ArchitectureValues{
-		arch.ARCH_X86_64:  ec2types.ArchitectureValuesX8664,
-		arch.ARCH_AARCH64: ec2types.ArchitectureValuesArm64,
-	}
-
 	ec2Arch, validArch := rpmArchToEC2Arch[architecture]
 	if !validArch {
 		return "", "", fmt.Errorf("ec2 doesn't support the following arch: %s", architecture)
@@ -302,6 +311,32 @@ func (a *AWS) Register(name, bucket, key string, tags []AWSTag, shareWith []stri
 		return "", "", err
 	}
 
+	snapshotID := *snapWaitOutput.ImportSnapshotTasks[0].SnapshotTaskDetail.SnapshotId
+	imageID, err := a.registerSnapshot(name, snapshotID, tags, shareWith, ec2Arch, ec2BootMode)
+	if err != nil {
+		return "", "", err
+	}
+
+	return imageID, snapshotID, nil
+}
+
+// RegisterSnapshot tags the given (completed) snapshot and registers an
+// AMI from it. See Register for the meaning of the other arguments.
+func (a *AWS) RegisterSnapshot(name, snapshotID string, tags []AWSTag, shareWith []string, architecture arch.Arch, bootMode *platform.BootMode) (string, error) {
+	ec2Arch, validArch := rpmArchToEC2Arch[architecture]
+	if !validArch {
+		return "", fmt.Errorf("ec2 doesn't support the following arch: %s", architecture)
+	}
+
+	ec2BootMode, err := ec2BootMode(bootMode)
+	if err != nil {
+		return "", fmt.Errorf("ec2 doesn't support the following boot mode: %s", bootMode)
+	}
+
+	return a.registerSnapshot(name, snapshotID, tags, shareWith, ec2Arch, ec2BootMode)
+}
+
+func (a *AWS) registerSnapshot(name, snapshotID string, tags []AWSTag, shareWith []string, ec2Arch ec2types.ArchitectureValues, ec2BootMode ec2types.BootModeValues) (string, error) {
 	ec2Tags := []ec2types.Tag{
 		{
 			Key:   aws.String("Name"),
@@ -315,9 +350,8 @@ func (a *AWS) Register(name, bucket, key string, tags []AWSTag, shareWith []stri
 		})
 	}
 
-	snapshotID := *snapWaitOutput.ImportSnapshotTasks[0].SnapshotTaskDetail.SnapshotId
 	// Tag the snapshot with the image name.
-	_, err = a.ec2.CreateTags(
+	_, err := a.ec2.CreateTags(
 		context.TODO(),
 		&ec2.CreateTagsInput{
 			Resources: []string{snapshotID},
@@ -325,7 +359,7 @@ func (a *AWS) Register(name, bucket, key string, tags []AWSTag, shareWith []stri
 		},
 	)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
 	olog.Printf("[AWS] 📋 Registering AMI from imported snapshot: %s", snapshotID)
@@ -349,7 +383,7 @@ func (a *AWS) Register(name, bucket, key string, tags []AWSTag, shareWith []stri
 		},
 	)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
 	imageID := aws.ToString(registerOutput.ImageId)
@@ -364,17 +398,17 @@ func (a *AWS) Register(name, bucket, key string, tags []AWSTag, shareWith []stri
 		},
 	)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
 	if len(shareWith) > 0 {
 		err = a.ShareImage(imageID, []string{snapshotID}, shareWith)
 		if err != nil {
-			return "", "", err
+			return "", err
 		}
 	}
 
-	return imageID, snapshotID, nil
+	return imageID, nil
 }
 
 func (a *AWS) DeleteObject(bucket, key string) error {
@@ -689,6 +723,17 @@ func (a *AWS) GetInstanceAddress(instanceID string) (string, error) {
 	return *reservation.Instances[0].PublicIpAddress, nil
 }
 
+// DeleteSnapshot deletes the given EBS snapshot.
+func (a *AWS) DeleteSnapshot(snapshotID string) error {
+	_, err := a.ec2.DeleteSnapshot(
+		context.TODO(),
+		&ec2.DeleteSnapshotInput{
+			SnapshotId: aws.String(snapshotID),
+		},
+	)
+	return err
+}
+
 // DeleteEC2Image deletes the specified image and all of its associated snapshots
 func (a *AWS) DeleteEC2Image(imageID string) error {
 	img, err := a.ec2.DescribeImages(
@@ -33,6 +33,27 @@ func MockNewSnapshotImportedWaiterEC2(out *ec2.DescribeImportSnapshotTasksOutput
 	}
 }
 
+type fakeNewSnapshotCompletedWaiterEC2 struct {
+	returnDescribeSnapshotsErr error
+}
+
+func (f *fakeNewSnapshotCompletedWaiterEC2) Wait(ctx context.Context, params *ec2.DescribeSnapshotsInput, maxWaitDur time.Duration, optFns ...func(*ec2.SnapshotCompletedWaiterOptions)) error {
+	return f.returnDescribeSnapshotsErr
+}
+
+func MockNewSnapshotCompletedWaiterEC2(err error) (restore func()) {
+	original := newSnapshotCompletedWaiterEC2
+	newSnapshotCompletedWaiterEC2 = func(client ec2.DescribeSnapshotsAPIClient, optFns ...func(*ec2.SnapshotCompletedWaiterOptions)) snapshotCompletedWaiterEC2 {
+		return &fakeNewSnapshotCompletedWaiterEC2{
+			returnDescribeSnapshotsErr: err,
+		}
+	}
+
+	return func() {
+		newSnapshotCompletedWaiterEC2 = original
+	}
+}
+
 type fakeNewInstanceRunningWaiterEC2 struct {
 	returnDescribeInstancesErr error
 }
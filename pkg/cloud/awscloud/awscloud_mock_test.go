@@ -2,8 +2,16 @@ package awscloud_test
 
 import (
 	"context"
+	// #nosec G501
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsSigner "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -61,6 +69,10 @@ type fakeEC2Client struct {
 	deleteSnapshot      *ec2.DeleteSnapshotOutput
 	deleteSnapshotErr   error
 
+	describeSnapshotsCalls []*ec2.DescribeSnapshotsInput
+	describeSnapshots      *ec2.DescribeSnapshotsOutput
+	describeSnapshotsErr   error
+
 	describeImportSnapshotTasksCalls []*ec2.DescribeImportSnapshotTasksInput
 	describeImportSnapshotTasks      *ec2.DescribeImportSnapshotTasksOutput
 	describeImportSnapshotTasksErr   error
@@ -176,6 +188,14 @@ func (f *fakeEC2Client) DeleteSnapshot(ctx context.Context, input *ec2.DeleteSna
 	return f.deleteSnapshot, nil
 }
 
+func (f *fakeEC2Client) DescribeSnapshots(ctx context.Context, input *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	f.describeSnapshotsCalls = append(f.describeSnapshotsCalls, input)
+	if f.describeSnapshotsErr != nil {
+		return nil, f.describeSnapshotsErr
+	}
+	return f.describeSnapshots, nil
+}
+
 func (f *fakeEC2Client) DescribeImportSnapshotTasks(ctx context.Context, input *ec2.DescribeImportSnapshotTasksInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImportSnapshotTasksOutput, error) {
 	f.describeImportSnapshotTasksCalls = append(f.describeImportSnapshotTasksCalls, input)
 	if f.describeImportSnapshotTasksErr != nil {
@@ -222,6 +242,29 @@ type fakeS3Client struct {
 	getBucketAclCalls []s3.GetBucketAclInput
 	bucketAcl         *s3.GetBucketAclOutput
 	getBucketAclErr   error
+
+	headObjectCalls []s3.HeadObjectInput
+	headObject      *s3.HeadObjectOutput
+	headObjectErr   error
+
+	createMultipartUploadCalls []s3.CreateMultipartUploadInput
+	// parts are uploaded concurrently
+	uploadPartMu    sync.Mutex
+	uploadPartCalls []s3.UploadPartInput
+	// the number of parts that are uploaded at the moment and the
+	// maximum of it
+	uploadPartInFlight    int
+	uploadPartMaxInFlight int
+	// uploadPartDelay keeps every part upload busy for the given time
+	uploadPartDelay time.Duration
+	// fail the upload of parts once this many parts were uploaded
+	uploadPartFailAfter int
+	uploadPartErr       error
+	// uploaded parts by number
+	parts                        map[int32]s3types.Part
+	listPartsCalls               []s3.ListPartsInput
+	completeMultipartUploadCalls []s3.CompleteMultipartUploadInput
+	abortMultipartUploadCalls    []s3.AbortMultipartUploadInput
 }
 
 var _ awscloud.S3Client = (*fakeS3Client)(nil)
@@ -266,6 +309,83 @@ func (f *fakeS3Client) GetBucketAcl(ctx context.Context, input *s3.GetBucketAclI
 	return f.bucketAcl, nil
 }
 
+func (f *fakeS3Client) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.headObjectCalls = append(f.headObjectCalls, *input)
+	if f.headObjectErr != nil {
+		return nil, f.headObjectErr
+	}
+	return f.headObject, nil
+}
+
+func (f *fakeS3Client) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.createMultipartUploadCalls = append(f.createMultipartUploadCalls, *input)
+	f.parts = map[int32]s3types.Part{}
+	return &s3.CreateMultipartUploadOutput{
+		UploadId: aws.String("upload-id"),
+	}, nil
+}
+
+func (f *fakeS3Client) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	f.uploadPartMu.Lock()
+	defer f.uploadPartMu.Unlock()
+	if f.uploadPartErr != nil && len(f.uploadPartCalls) >= f.uploadPartFailAfter {
+		return nil, f.uploadPartErr
+	}
+	f.uploadPartCalls = append(f.uploadPartCalls, *input)
+
+	f.uploadPartInFlight++
+	f.uploadPartMaxInFlight = max(f.uploadPartMaxInFlight, f.uploadPartInFlight)
+	f.uploadPartMu.Unlock()
+	time.Sleep(f.uploadPartDelay)
+	f.uploadPartMu.Lock()
+	f.uploadPartInFlight--
+
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	sha256sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sha256sum[:])
+	if checksum != aws.ToString(input.ChecksumSHA256) {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	// #nosec G401
+	etag := fmt.Sprintf(`"%x"`, md5.Sum(data))
+	f.parts[aws.ToInt32(input.PartNumber)] = s3types.Part{
+		PartNumber:     input.PartNumber,
+		ETag:           aws.String(etag),
+		Size:           aws.Int64(int64(len(data))),
+		ChecksumSHA256: aws.String(checksum),
+	}
+	return &s3.UploadPartOutput{
+		ETag:           aws.String(etag),
+		ChecksumSHA256: aws.String(checksum),
+	}, nil
+}
+
+func (f *fakeS3Client) ListParts(ctx context.Context, input *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	f.listPartsCalls = append(f.listPartsCalls, *input)
+	var parts []s3types.Part
+	for _, p := range f.parts {
+		parts = append(parts, p)
+	}
+	return &s3.ListPartsOutput{
+		Parts: parts,
+	}, nil
+}
+
+func (f *fakeS3Client) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.completeMultipartUploadCalls = append(f.completeMultipartUploadCalls, *input)
+	return &s3.CompleteMultipartUploadOutput{
+		Location: aws.String(fmt.Sprintf("https://%s.s3.amazonaws.com/%s", *input.Bucket, *input.Key)),
+	}, nil
+}
+
+func (f *fakeS3Client) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.abortMultipartUploadCalls = append(f.abortMultipartUploadCalls, *input)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
 type fakeS3Uploader struct {
 	uploadCalls []transfermanager.UploadObjectInput
 	uploadErr   error
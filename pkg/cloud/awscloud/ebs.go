@@ -0,0 +1,200 @@
+package awscloud
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ebs"
+	ebstypes "github.com/aws/aws-sdk-go-v2/service/ebs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/olog"
+)
+
+// EBSBlockSize is the size of the blocks written with the EBS direct
+// APIs, the only block size supported by PutSnapshotBlock.
+const EBSBlockSize = 512 * datasizes.KiB
+
+// DefaultEBSUploadThreads is the number of blocks written in parallel.
+const DefaultEBSUploadThreads = 16
+
+// WriteSnapshotEBSDirect writes the image read from r directly into a new
+// EBS snapshot using the EBS direct APIs, without staging it in S3. Blocks
+// that contain only zeros are skipped as a new snapshot reads as zeros.
+// The size of the image must be known upfront to size the snapshot.
+// It waits for the snapshot to be completed and returns its ID. The
+// snapshot is deleted if it cannot be written.
+func (a *AWS) WriteSnapshotEBSDirect(r io.Reader, size uint64, name string, tags []AWSTag) (string, error) {
+	if size == 0 {
+		return "", fmt.Errorf("the image size is required to write an EBS snapshot")
+	}
+	ctx := context.TODO()
+
+	ebsTags := []ebstypes.Tag{{Key: aws.String("Name"), Value: aws.String(name)}}
+	for _, t := range tags {
+		ebsTags = append(ebsTags, ebstypes.Tag{Key: aws.String(t.Name), Value: aws.String(t.Value)})
+	}
+	olog.Printf("[AWS] 📸 Starting EBS snapshot for image: %s", name)
+	snapshot, err := a.ebs.StartSnapshot(ctx, &ebs.StartSnapshotInput{
+		// #nosec G115
+		VolumeSize:  aws.Int64(int64((size + datasizes.GiB - 1) / datasizes.GiB)),
+		Description: aws.String(fmt.Sprintf("Image Builder AWS EBS direct import of %s", name)),
+		Tags:        ebsTags,
+		ClientToken: aws.String(uuid.New().String()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot start EBS snapshot: %w", err)
+	}
+	snapshotID := aws.ToString(snapshot.SnapshotId)
+
+	if err := a.writeSnapshotEBSDirect(ctx, snapshotID, aws.ToInt32(snapshot.BlockSize), r); err != nil {
+		olog.Printf("[AWS] 🧹 Deleting EBS snapshot %s", snapshotID)
+		_, delErr := a.ec2.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{
+			SnapshotId: aws.String(snapshotID),
+		})
+		if delErr != nil {
+			return "", fmt.Errorf("%w (cannot delete snapshot %s: %v)", err, snapshotID, delErr)
+		}
+		return "", err
+	}
+
+	return snapshotID, nil
+}
+
+// writeSnapshotEBSDirect writes the blocks of the started snapshot,
+// completes it and waits for it to become available.
+func (a *AWS) writeSnapshotEBSDirect(ctx context.Context, snapshotID string, blockSize int32, r io.Reader) error {
+	if blockSize != 0 && blockSize != int32(EBSBlockSize) {
+		return fmt.Errorf("unsupported EBS snapshot block size %d", blockSize)
+	}
+
+	checksums, err := a.putSnapshotBlocks(ctx, snapshotID, r)
+	if err != nil {
+		return err
+	}
+
+	// the aggregated checksum covers the written blocks in index order
+	aggregate := sha256.New()
+	var indexes []int32
+	for idx := range checksums {
+		indexes = append(indexes, idx)
+	}
+	slices.Sort(indexes)
+	for _, idx := range indexes {
+		sum, err := base64.StdEncoding.DecodeString(checksums[idx])
+		if err != nil {
+			return err
+		}
+		aggregate.Write(sum)
+	}
+
+	olog.Printf("[AWS] 📸 Completing EBS snapshot %s (%d blocks written)", snapshotID, len(checksums))
+	_, err = a.ebs.CompleteSnapshot(ctx, &ebs.CompleteSnapshotInput{
+		SnapshotId: aws.String(snapshotID),
+		// #nosec G115
+		ChangedBlocksCount:        aws.Int32(int32(len(checksums))),
+		Checksum:                  aws.String(base64.StdEncoding.EncodeToString(aggregate.Sum(nil))),
+		ChecksumAlgorithm:         ebstypes.ChecksumAlgorithmChecksumAlgorithmSha256,
+		ChecksumAggregationMethod: ebstypes.ChecksumAggregationMethodChecksumAggregationLinear,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot complete EBS snapshot %s: %w", snapshotID, err)
+	}
+
+	olog.Printf("[AWS] 🚚 Waiting for snapshot to be completed: %s", snapshotID)
+	snapWaiter := newSnapshotCompletedWaiterEC2(a.ec2)
+	return snapWaiter.Wait(
+		ctx,
+		&ec2.DescribeSnapshotsInput{
+			SnapshotIds: []string{snapshotID},
+		},
+		time.Hour*24,
+	)
+}
+
+// putSnapshotBlocks writes all non-zero blocks read from r into the
+// snapshot and returns the checksums of the written blocks by index.
+func (a *AWS) putSnapshotBlocks(ctx context.Context, snapshotID string, r io.Reader) (map[int32]string, error) {
+	checksums := map[int32]string{}
+	var checksumsMu sync.Mutex
+
+	// This channel simulates behavior of a semaphore and bounds the number of parallel threads
+	semaphore := make(chan int, DefaultEBSUploadThreads)
+	// Forward error from goroutine to the caller
+	errorInGoroutine := make(chan error, 1)
+	var wg sync.WaitGroup
+
+	zeros := make([]byte, EBSBlockSize)
+	for index := int32(0); ; index++ {
+		buffer := make([]byte, EBSBlockSize)
+		n, err := io.ReadFull(r, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("reading the image failed: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+		// A partial last block is padded with the zeros already in the
+		// buffer, blocks always have to be written in full.
+		if !bytes.Equal(zeros, buffer) {
+			sum := sha256.Sum256(buffer)
+			checksum := base64.StdEncoding.EncodeToString(sum[:])
+			block := &ebs.PutSnapshotBlockInput{
+				SnapshotId:        aws.String(snapshotID),
+				BlockIndex:        aws.Int32(index),
+				BlockData:         bytes.NewReader(buffer),
+				DataLength:        aws.Int32(int32(EBSBlockSize)),
+				Checksum:          aws.String(checksum),
+				ChecksumAlgorithm: ebstypes.ChecksumAlgorithmChecksumAlgorithmSha256,
+			}
+
+			select {
+			case err := <-errorInGoroutine:
+				wg.Wait()
+				return nil, err
+			default:
+			}
+
+			wg.Add(1)
+			semaphore <- 1
+			go func(index int32) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				if _, err := a.ebs.PutSnapshotBlock(ctx, block); err != nil {
+					// Send the error to the error channel in a non-blocking way. If there is already an error, just discard this one
+					select {
+					case errorInGoroutine <- fmt.Errorf("cannot write block %d of snapshot %s: %w", index, snapshotID, err):
+					default:
+					}
+					return
+				}
+				checksumsMu.Lock()
+				checksums[index] = checksum
+				checksumsMu.Unlock()
+			}(index)
+		}
+		if n < len(buffer) {
+			break
+		}
+	}
+	wg.Wait()
+
+	// Check any errors during the transmission using a nonblocking read from the channel
+	select {
+	case err := <-errorInGoroutine:
+		return nil, err
+	default:
+	}
+
+	return checksums, nil
+}
@@ -0,0 +1,251 @@
+package awscloud_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ebs"
+	ebstypes "github.com/aws/aws-sdk-go-v2/service/ebs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/cloud/awscloud"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+type fakeEBSClient struct {
+	mu sync.Mutex
+
+	startSnapshotCalls []*ebs.StartSnapshotInput
+	startSnapshotErr   error
+
+	putSnapshotBlockCalls []*ebs.PutSnapshotBlockInput
+	putSnapshotBlockData  map[int32][]byte
+	putSnapshotBlockErr   error
+
+	completeSnapshotCalls []*ebs.CompleteSnapshotInput
+	completeSnapshotErr   error
+}
+
+func (f *fakeEBSClient) StartSnapshot(ctx context.Context, input *ebs.StartSnapshotInput, optFns ...func(*ebs.Options)) (*ebs.StartSnapshotOutput, error) {
+	f.startSnapshotCalls = append(f.startSnapshotCalls, input)
+	if f.startSnapshotErr != nil {
+		return nil, f.startSnapshotErr
+	}
+	return &ebs.StartSnapshotOutput{
+		SnapshotId: aws.String("snap-0123"),
+		BlockSize:  aws.Int32(int32(awscloud.EBSBlockSize)),
+	}, nil
+}
+
+func (f *fakeEBSClient) PutSnapshotBlock(ctx context.Context, input *ebs.PutSnapshotBlockInput, optFns ...func(*ebs.Options)) (*ebs.PutSnapshotBlockOutput, error) {
+	data, err := io.ReadAll(input.BlockData)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.putSnapshotBlockCalls = append(f.putSnapshotBlockCalls, input)
+	if f.putSnapshotBlockData == nil {
+		f.putSnapshotBlockData = map[int32][]byte{}
+	}
+	f.putSnapshotBlockData[aws.ToInt32(input.BlockIndex)] = data
+	if f.putSnapshotBlockErr != nil {
+		return nil, f.putSnapshotBlockErr
+	}
+	return &ebs.PutSnapshotBlockOutput{}, nil
+}
+
+func (f *fakeEBSClient) CompleteSnapshot(ctx context.Context, input *ebs.CompleteSnapshotInput, optFns ...func(*ebs.Options)) (*ebs.CompleteSnapshotOutput, error) {
+	f.completeSnapshotCalls = append(f.completeSnapshotCalls, input)
+	if f.completeSnapshotErr != nil {
+		return nil, f.completeSnapshotErr
+	}
+	return &ebs.CompleteSnapshotOutput{}, nil
+}
+
+// testEBSImage returns an image of 3.5 blocks where the second block only
+// contains zeros
+func testEBSImage() []byte {
+	img := bytes.Repeat([]byte{1}, int(awscloud.EBSBlockSize))
+	img = append(img, make([]byte, awscloud.EBSBlockSize)...)
+	img = append(img, bytes.Repeat([]byte{3}, int(awscloud.EBSBlockSize))...)
+	return append(img, bytes.Repeat([]byte{4}, int(awscloud.EBSBlockSize/2))...)
+}
+
+func TestWriteSnapshotEBSDirectHappy(t *testing.T) {
+	restore := awscloud.MockNewSnapshotCompletedWaiterEC2(nil)
+	defer restore()
+
+	febs := &fakeEBSClient{}
+	a := awscloud.NewAWSForTestWithEBS(&fakeEC2Client{}, febs)
+
+	img := testEBSImage()
+	snapshotID, err := a.WriteSnapshotEBSDirect(bytes.NewReader(img), uint64(len(img)), "image-name", []awscloud.AWSTag{{Name: "key", Value: "value"}})
+	require.NoError(t, err)
+	require.Equal(t, "snap-0123", snapshotID)
+
+	require.Len(t, febs.startSnapshotCalls, 1)
+	require.Equal(t, int64(1), aws.ToInt64(febs.startSnapshotCalls[0].VolumeSize))
+	require.Equal(t, []ebstypes.Tag{
+		{Key: aws.String("Name"), Value: aws.String("image-name")},
+		{Key: aws.String("key"), Value: aws.String("value")},
+	}, febs.startSnapshotCalls[0].Tags)
+
+	// the zero block is skipped
+	require.Len(t, febs.putSnapshotBlockCalls, 3)
+	for _, call := range febs.putSnapshotBlockCalls {
+		data := febs.putSnapshotBlockData[aws.ToInt32(call.BlockIndex)]
+		require.Equal(t, "snap-0123", aws.ToString(call.SnapshotId))
+		require.Len(t, data, int(awscloud.EBSBlockSize))
+		require.Equal(t, int32(awscloud.EBSBlockSize), aws.ToInt32(call.DataLength))
+		sum := sha256.Sum256(data)
+		require.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), aws.ToString(call.Checksum))
+		require.Equal(t, ebstypes.ChecksumAlgorithmChecksumAlgorithmSha256, call.ChecksumAlgorithm)
+	}
+	blocks := febs.putSnapshotBlockData
+	require.Contains(t, blocks, int32(0))
+	require.NotContains(t, blocks, int32(1))
+	require.Contains(t, blocks, int32(2))
+	require.Contains(t, blocks, int32(3))
+	// the last block is padded with zeros
+	require.Equal(t, append(bytes.Repeat([]byte{4}, int(awscloud.EBSBlockSize/2)), make([]byte, awscloud.EBSBlockSize/2)...), blocks[3])
+
+	aggregate := sha256.New()
+	for _, idx := range []int32{0, 2, 3} {
+		sum := sha256.Sum256(blocks[idx])
+		aggregate.Write(sum[:])
+	}
+	require.Len(t, febs.completeSnapshotCalls, 1)
+	require.Equal(t, &ebs.CompleteSnapshotInput{
+		SnapshotId:                aws.String("snap-0123"),
+		ChangedBlocksCount:        aws.Int32(3),
+		Checksum:                  aws.String(base64.StdEncoding.EncodeToString(aggregate.Sum(nil))),
+		ChecksumAlgorithm:         ebstypes.ChecksumAlgorithmChecksumAlgorithmSha256,
+		ChecksumAggregationMethod: ebstypes.ChecksumAggregationMethodChecksumAggregationLinear,
+	}, febs.completeSnapshotCalls[0])
+}
+
+func TestWriteSnapshotEBSDirectVolumeSizeRoundsUp(t *testing.T) {
+	restore := awscloud.MockNewSnapshotCompletedWaiterEC2(nil)
+	defer restore()
+
+	febs := &fakeEBSClient{}
+	a := awscloud.NewAWSForTestWithEBS(&fakeEC2Client{}, febs)
+
+	// the content is shorter than the size, the rest reads as zeros
+	_, err := a.WriteSnapshotEBSDirect(bytes.NewReader(nil), 2*datasizes.GiB+1, "image-name", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), aws.ToInt64(febs.startSnapshotCalls[0].VolumeSize))
+	require.Len(t, febs.putSnapshotBlockCalls, 0)
+	require.Equal(t, int32(0), aws.ToInt32(febs.completeSnapshotCalls[0].ChangedBlocksCount))
+}
+
+func TestWriteSnapshotEBSDirectErrors(t *testing.T) {
+	img := testEBSImage()
+
+	testCases := []struct {
+		name      string
+		febs      *fakeEBSClient
+		size      uint64
+		waiterErr error
+		deleteErr error
+		errMsg    string
+		deleted   bool
+	}{
+		{
+			name:   "no-size",
+			febs:   &fakeEBSClient{},
+			errMsg: "the image size is required to write an EBS snapshot",
+		},
+		{
+			name:   "start-error",
+			febs:   &fakeEBSClient{startSnapshotErr: fmt.Errorf("start-error")},
+			size:   uint64(len(img)),
+			errMsg: "cannot start EBS snapshot: start-error",
+		},
+		{
+			name:    "put-error",
+			febs:    &fakeEBSClient{putSnapshotBlockErr: fmt.Errorf("put-error")},
+			size:    uint64(len(img)),
+			errMsg:  "put-error",
+			deleted: true,
+		},
+		{
+			name:    "complete-error",
+			febs:    &fakeEBSClient{completeSnapshotErr: fmt.Errorf("complete-error")},
+			size:    uint64(len(img)),
+			errMsg:  "cannot complete EBS snapshot snap-0123: complete-error",
+			deleted: true,
+		},
+		{
+			name:      "waiter-error",
+			febs:      &fakeEBSClient{},
+			size:      uint64(len(img)),
+			waiterErr: fmt.Errorf("waiter-error"),
+			errMsg:    "waiter-error",
+			deleted:   true,
+		},
+		{
+			name:      "delete-error",
+			febs:      &fakeEBSClient{putSnapshotBlockErr: fmt.Errorf("put-error")},
+			size:      uint64(len(img)),
+			deleteErr: fmt.Errorf("delete-error"),
+			errMsg:    "put-error (cannot delete snapshot snap-0123: delete-error)",
+			deleted:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			restore := awscloud.MockNewSnapshotCompletedWaiterEC2(tc.waiterErr)
+			defer restore()
+
+			fec2 := &fakeEC2Client{
+				deleteSnapshot:    &ec2.DeleteSnapshotOutput{},
+				deleteSnapshotErr: tc.deleteErr,
+			}
+			a := awscloud.NewAWSForTestWithEBS(fec2, tc.febs)
+			_, err := a.WriteSnapshotEBSDirect(bytes.NewReader(img), tc.size, "image-name", nil)
+			require.ErrorContains(t, err, tc.errMsg)
+			if tc.deleted {
+				require.Len(t, fec2.deleteSnapshotCalls, 1)
+				require.Equal(t, "snap-0123", aws.ToString(fec2.deleteSnapshotCalls[0].SnapshotId))
+			} else {
+				require.Len(t, fec2.deleteSnapshotCalls, 0)
+			}
+		})
+	}
+}
+
+func TestRegisterSnapshot(t *testing.T) {
+	fec2 := &fakeEC2Client{
+		registerImage: &ec2.RegisterImageOutput{
+			ImageId: aws.String("ami-0123"),
+		},
+		createTags: &ec2.CreateTagsOutput{},
+	}
+	a := awscloud.NewAWSForTestWithEBS(fec2, nil)
+
+	imageID, err := a.RegisterSnapshot("image-name", "snap-0123", nil, nil, arch.ARCH_AARCH64, common.ToPtr(platform.BOOT_UEFI))
+	require.NoError(t, err)
+	require.Equal(t, "ami-0123", imageID)
+
+	require.Len(t, fec2.registerImageCalls, 1)
+	registerInput := fec2.registerImageCalls[0]
+	require.Equal(t, "image-name", *registerInput.Name)
+	require.Equal(t, ec2types.ArchitectureValuesArm64, registerInput.Architecture)
+	require.Equal(t, ec2types.BootModeValuesUefi, registerInput.BootMode)
+	require.Equal(t, "snap-0123", *registerInput.BlockDeviceMappings[0].Ebs.SnapshotId)
+}
@@ -10,6 +10,7 @@ type EC2Client = ec2Client
 type S3Client = s3Client
 type S3Uploader = s3Uploader
 type S3Presign = s3Presign
+type EBSClient = ebsClient
 
 func EC2BootMode(bootMode *platform.BootMode) (ec2types.BootModeValues, error) {
 	return ec2BootMode(bootMode)
@@ -24,6 +25,13 @@ func NewAWSForTest(ec2cli EC2Client, s3cli S3Client, upldr S3Uploader, sign S3Pr
 	}
 }
 
+func NewAWSForTestWithEBS(ec2cli EC2Client, ebscli EBSClient) *AWS {
+	return &AWS{
+		ec2: ec2cli,
+		ebs: ebscli,
+	}
+}
+
 func MockNewAwsClient(f func(string, string) (awsClient, error)) (restore func()) {
 	saved := newAwsClient
 	newAwsClient = f
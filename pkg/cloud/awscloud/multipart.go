@@ -0,0 +1,495 @@
+package awscloud
+
+import (
+	"bytes"
+	"context"
+	// S3 ETags of unencrypted parts are MD5 hashes
+	/* #nosec G501 */
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/olog"
+)
+
+// DefaultMultipartPartSize is the part size used for multipart uploads if
+// none is given. With the S3 limit of 10000 parts this allows objects of up
+// to ~625 GiB.
+const DefaultMultipartPartSize = 64 * datasizes.MiB
+
+// DefaultMultipartConcurrency is the number of parts that are uploaded at
+// the same time if none is given, the same as for the transfer manager.
+const DefaultMultipartConcurrency = 5
+
+// S3 limits, see
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/qfacts.html
+const (
+	minMultipartPartSize = 5 * datasizes.MiB
+	maxMultipartParts    = 10000
+)
+
+type MultipartUploadOptions struct {
+	// StateFile is the path of a file where the state of the upload is
+	// persisted after every uploaded part. If the file exists, the upload
+	// it describes is resumed and only the parts that are missing or that
+	// do not match the checksum of the local data are uploaded. The file is
+	// removed once the upload is completed.
+	// If empty, the upload is not resumable and it is aborted on error.
+	StateFile string
+	// PartSize of the upload, defaults to DefaultMultipartPartSize. When
+	// resuming, the part size of the persisted upload is used.
+	PartSize uint64
+	// Concurrency is the number of parts that are uploaded at the same
+	// time, defaults to DefaultMultipartConcurrency. Every part that is
+	// uploaded is kept in memory.
+	Concurrency int
+}
+
+// MultipartPart describes a single uploaded part.
+type MultipartPart struct {
+	PartNumber int32  `json:"part_number"`
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
+	// base64 encoded, as used by the S3 API
+	SHA256 string `json:"sha256"`
+	// hex encoded
+	MD5 string `json:"md5"`
+}
+
+// MultipartUploadState is the state of a multipart upload as persisted in
+// MultipartUploadOptions.StateFile.
+type MultipartUploadState struct {
+	Bucket   string          `json:"bucket"`
+	Key      string          `json:"key"`
+	UploadID string          `json:"upload_id"`
+	PartSize int64           `json:"part_size"`
+	Parts    []MultipartPart `json:"parts"`
+}
+
+// LoadMultipartUploadState loads the upload state from the given file. If
+// the file does not exist, nil is returned.
+func LoadMultipartUploadState(path string) (*MultipartUploadState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read multipart upload state: %w", err)
+	}
+	var state MultipartUploadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse multipart upload state %q: %w", path, err)
+	}
+	if state.UploadID == "" || state.PartSize <= 0 {
+		return nil, fmt.Errorf("invalid multipart upload state %q", path)
+	}
+	return &state, nil
+}
+
+// save atomically writes the state to the given path, a partially written
+// state file must never be picked up when resuming.
+func (s *MultipartUploadState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot save multipart upload state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot save multipart upload state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot save multipart upload state: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *MultipartUploadState) part(number int32) *MultipartPart {
+	for i := range s.Parts {
+		if s.Parts[i].PartNumber == number {
+			return &s.Parts[i]
+		}
+	}
+	return nil
+}
+
+func (s *MultipartUploadState) setPart(p MultipartPart) {
+	if existing := s.part(p.PartNumber); existing != nil {
+		*existing = p
+		return
+	}
+	s.Parts = append(s.Parts, p)
+}
+
+// MultipartUploadOutput describes a completed multipart upload together
+// with the values S3 is expected to report for the object.
+type MultipartUploadOutput struct {
+	Location string
+	Size     int64
+	// ETag is the expected multipart ETag of the object, i.e. the MD5 of
+	// the concatenated part MD5s followed by the number of parts.
+	ETag string
+	// ChecksumSHA256 is the expected composite SHA256 checksum of the
+	// object in the "<base64>-<parts>" form reported by S3.
+	ChecksumSHA256 string
+}
+
+// UploadMultipart uploads the content of the reader as a multipart upload,
+// verifying the SHA256 checksum of every part on the S3 side. See
+// MultipartUploadOptions for how the upload can be resumed.
+func (a *AWS) UploadMultipart(r io.Reader, bucket, key string, opts *MultipartUploadOptions) (res *MultipartUploadOutput, err error) {
+	if opts == nil {
+		opts = &MultipartUploadOptions{}
+	}
+	ctx := context.TODO()
+
+	var state *MultipartUploadState
+	if opts.StateFile != "" {
+		state, err = LoadMultipartUploadState(opts.StateFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if state != nil {
+		if state.Bucket != bucket || state.Key != key {
+			return nil, fmt.Errorf("multipart upload state %q is for %s/%s, not %s/%s", opts.StateFile, state.Bucket, state.Key, bucket, key)
+		}
+		olog.Printf("[AWS] 🔁 Resuming multipart upload to S3: %s/%s", bucket, key)
+		if err := a.syncMultipartParts(ctx, state); err != nil {
+			return nil, err
+		}
+	} else {
+		partSize := opts.PartSize
+		if partSize == 0 {
+			partSize = DefaultMultipartPartSize
+		}
+		if partSize < minMultipartPartSize {
+			return nil, fmt.Errorf("multipart part size %d is smaller than the minimum of %d", partSize, minMultipartPartSize)
+		}
+		olog.Printf("[AWS] 🚀 Starting multipart upload to S3: %s/%s", bucket, key)
+		created, err := a.s3.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot create multipart upload: %w", err)
+		}
+		state = &MultipartUploadState{
+			Bucket:   bucket,
+			Key:      key,
+			UploadID: aws.ToString(created.UploadId),
+			// #nosec G115
+			PartSize: int64(partSize),
+		}
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if opts.StateFile != "" {
+			if sErr := state.save(opts.StateFile); sErr != nil {
+				err = errors.Join(err, sErr)
+				return
+			}
+			olog.Printf("[AWS] ⏸ Multipart upload state saved to %s, retry to resume", opts.StateFile)
+			return
+		}
+		_, aErr := a.s3.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(state.UploadID),
+		})
+		err = errors.Join(err, aErr)
+	}()
+
+	if opts.StateFile != "" {
+		if err := state.save(opts.StateFile); err != nil {
+			return nil, err
+		}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultMultipartConcurrency
+	}
+	parts, err := a.uploadMultipartParts(ctx, r, state, opts.StateFile, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	var completed []s3types.CompletedPart
+	var size int64
+	etagHash := md5.New() // #nosec G401
+	checksumHash := sha256.New()
+	for _, part := range parts {
+		md5sum, err := hex.DecodeString(part.MD5)
+		if err != nil {
+			return nil, err
+		}
+		sha256sum, err := base64.StdEncoding.DecodeString(part.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		etagHash.Write(md5sum)
+		checksumHash.Write(sha256sum)
+		size += part.Size
+		completed = append(completed, s3types.CompletedPart{
+			PartNumber:     aws.Int32(part.PartNumber),
+			ETag:           aws.String(part.ETag),
+			ChecksumSHA256: aws.String(part.SHA256),
+		})
+	}
+
+	out, err := a.s3.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(state.UploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{
+			Parts: completed,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot complete multipart upload: %w", err)
+	}
+
+	if opts.StateFile != "" {
+		if err := os.Remove(opts.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			olog.Printf("[AWS] ‼ Failed to remove multipart upload state %s: %v", opts.StateFile, err)
+		}
+	}
+
+	return &MultipartUploadOutput{
+		Location:       aws.ToString(out.Location),
+		Size:           size,
+		ETag:           fmt.Sprintf("%x-%d", etagHash.Sum(nil), len(completed)),
+		ChecksumSHA256: fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(checksumHash.Sum(nil)), len(completed)),
+	}, nil
+}
+
+// multipartJob is a part read from the image that is waiting for a worker
+type multipartJob struct {
+	partNumber int32
+	data       []byte
+}
+
+// uploadMultipartParts reads the parts from the reader and uploads them with
+// at most concurrency workers, which also bounds the number of parts kept in
+// memory. The state and the state file are only updated by one worker at a
+// time. The uploaded parts are returned ordered by their number.
+func (a *AWS) uploadMultipartParts(ctx context.Context, r io.Reader, state *MultipartUploadState, stateFile string, concurrency int) ([]MultipartPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	uploaded := map[int32]MultipartPart{}
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	jobs := make(chan multipartJob)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				part, err := a.uploadMultipartPart(ctx, state, &mu, job.partNumber, job.data)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				uploaded[part.PartNumber] = *part
+				if stateFile != "" {
+					err = state.save(stateFile)
+				}
+				mu.Unlock()
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	var numParts int32
+	for partNumber := int32(1); ; partNumber++ {
+		buf := make([]byte, state.PartSize)
+		n, rErr := io.ReadFull(r, buf)
+		if rErr != nil && rErr != io.EOF && rErr != io.ErrUnexpectedEOF {
+			fail(fmt.Errorf("reading the image failed: %w", rErr))
+			break
+		}
+		// S3 needs at least one (possibly empty) part
+		if n == 0 && partNumber > 1 {
+			break
+		}
+		if partNumber > maxMultipartParts {
+			fail(fmt.Errorf("image does not fit into %d parts of %d bytes", maxMultipartParts, state.PartSize))
+			break
+		}
+
+		select {
+		case jobs <- multipartJob{partNumber: partNumber, data: buf[:n]}:
+			numParts = partNumber
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil || rErr != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	parts := make([]MultipartPart, 0, numParts)
+	for partNumber := int32(1); partNumber <= numParts; partNumber++ {
+		parts = append(parts, uploaded[partNumber])
+	}
+	return parts, nil
+}
+
+// uploadMultipartPart uploads the given data as a part unless the state
+// already contains a part with the same number and checksum. The state is
+// only accessed with mu held.
+func (a *AWS) uploadMultipartPart(ctx context.Context, state *MultipartUploadState, mu *sync.Mutex, partNumber int32, data []byte) (*MultipartPart, error) {
+	md5sum := md5.Sum(data) // #nosec G401
+	sha256sum := sha256.Sum256(data)
+	part := MultipartPart{
+		PartNumber: partNumber,
+		Size:       int64(len(data)),
+		SHA256:     base64.StdEncoding.EncodeToString(sha256sum[:]),
+		MD5:        hex.EncodeToString(md5sum[:]),
+	}
+
+	mu.Lock()
+	existing := state.part(partNumber)
+	if existing != nil && existing.Size == part.Size && existing.SHA256 == part.SHA256 {
+		unchanged := *existing
+		mu.Unlock()
+		return &unchanged, nil
+	}
+	mu.Unlock()
+	if existing != nil {
+		olog.Printf("[AWS] Part %d changed since the last attempt, uploading it again", partNumber)
+	}
+
+	out, err := a.s3.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:            aws.String(state.Bucket),
+		Key:               aws.String(state.Key),
+		UploadId:          aws.String(state.UploadID),
+		PartNumber:        aws.Int32(partNumber),
+		Body:              bytes.NewReader(data),
+		ContentLength:     aws.Int64(part.Size),
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    aws.String(part.SHA256),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload part %d: %w", partNumber, err)
+	}
+	if sum := aws.ToString(out.ChecksumSHA256); sum != "" && sum != part.SHA256 {
+		return nil, fmt.Errorf("checksum mismatch for part %d: expected %s, got %s", partNumber, part.SHA256, sum)
+	}
+	part.ETag = aws.ToString(out.ETag)
+	mu.Lock()
+	state.setPart(part)
+	mu.Unlock()
+
+	return &part, nil
+}
+
+// syncMultipartParts drops the parts from the state that S3 does not know
+// about (anymore) or that S3 reports with a different ETag or checksum.
+func (a *AWS) syncMultipartParts(ctx context.Context, state *MultipartUploadState) error {
+	remote := map[int32]s3types.Part{}
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(state.Bucket),
+		Key:      aws.String(state.Key),
+		UploadId: aws.String(state.UploadID),
+	}
+	for {
+		out, err := a.s3.ListParts(ctx, input)
+		if err != nil {
+			return fmt.Errorf("cannot list parts of multipart upload %s: %w", state.UploadID, err)
+		}
+		for _, p := range out.Parts {
+			remote[aws.ToInt32(p.PartNumber)] = p
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		input.PartNumberMarker = out.NextPartNumberMarker
+	}
+
+	var parts []MultipartPart
+	for _, p := range state.Parts {
+		r, ok := remote[p.PartNumber]
+		if !ok || aws.ToString(r.ETag) != p.ETag || aws.ToInt64(r.Size) != p.Size {
+			continue
+		}
+		if sum := aws.ToString(r.ChecksumSHA256); sum != "" && sum != p.SHA256 {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	state.Parts = parts
+	return nil
+}
+
+// VerifyObject checks that the object in S3 matches the expected size and
+// checksums of a completed multipart upload.
+// The ETag is only verified for objects that are not encrypted with
+// SSE-KMS as their ETag is not derived from the MD5 of the data.
+func (a *AWS) VerifyObject(bucket, key string, expected *MultipartUploadOutput) error {
+	head, err := a.s3.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot get object %s/%s: %w", bucket, key, err)
+	}
+
+	if size := aws.ToInt64(head.ContentLength); size != expected.Size {
+		return fmt.Errorf("size mismatch for %s/%s: expected %d, got %d", bucket, key, expected.Size, size)
+	}
+	if sum := aws.ToString(head.ChecksumSHA256); sum != expected.ChecksumSHA256 {
+		return fmt.Errorf("SHA256 checksum mismatch for %s/%s: expected %s, got %s", bucket, key, expected.ChecksumSHA256, sum)
+	}
+	switch head.ServerSideEncryption {
+	case s3types.ServerSideEncryptionAwsKms, s3types.ServerSideEncryptionAwsKmsDsse:
+	default:
+		if etag := strings.Trim(aws.ToString(head.ETag), `"`); etag != expected.ETag {
+			return fmt.Errorf("ETag mismatch for %s/%s: expected %s, got %s", bucket, key, expected.ETag, etag)
+		}
+	}
+
+	return nil
+}
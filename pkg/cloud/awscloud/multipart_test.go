@@ -0,0 +1,309 @@
+package awscloud_test
+
+import (
+	"bytes"
+	// #nosec G501
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud/awscloud"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+const testPartSize = 5 * datasizes.MiB
+
+// testImage returns an image of 2.5 parts, every part has different content
+func testImage() []byte {
+	var img []byte
+	for i := 0; i < 2; i++ {
+		img = append(img, bytes.Repeat([]byte{byte(i + 1)}, int(testPartSize))...)
+	}
+	return append(img, bytes.Repeat([]byte{3}, int(testPartSize/2))...)
+}
+
+// expectedMultipartOutput computes the ETag and checksum S3 would report
+// for the testImage()
+func expectedMultipartOutput(img []byte) *awscloud.MultipartUploadOutput {
+	// #nosec G401
+	etags := md5.New()
+	checksums := sha256.New()
+	parts := 0
+	for off := 0; off < len(img); off += int(testPartSize) {
+		part := img[off:min(off+int(testPartSize), len(img))]
+		// #nosec G401
+		m := md5.Sum(part)
+		s := sha256.Sum256(part)
+		etags.Write(m[:])
+		checksums.Write(s[:])
+		parts++
+	}
+	return &awscloud.MultipartUploadOutput{
+		Location:       "https://bucket.s3.amazonaws.com/key",
+		Size:           int64(len(img)),
+		ETag:           fmt.Sprintf("%x-%d", etags.Sum(nil), parts),
+		ChecksumSHA256: fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(checksums.Sum(nil)), parts),
+	}
+}
+
+func TestUploadMultipartHappy(t *testing.T) {
+	fs := &fakeS3Client{}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+	img := testImage()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	res, err := a.UploadMultipart(bytes.NewReader(img), "bucket", "key", &awscloud.MultipartUploadOptions{
+		StateFile: stateFile,
+		PartSize:  testPartSize,
+	})
+	require.NoError(t, err)
+	require.Equal(t, expectedMultipartOutput(img), res)
+
+	require.Len(t, fs.createMultipartUploadCalls, 1)
+	require.Equal(t, s3types.ChecksumAlgorithmSha256, fs.createMultipartUploadCalls[0].ChecksumAlgorithm)
+	require.Len(t, fs.uploadPartCalls, 3)
+	require.Len(t, fs.listPartsCalls, 0)
+	require.Len(t, fs.completeMultipartUploadCalls, 1)
+	require.Len(t, fs.completeMultipartUploadCalls[0].MultipartUpload.Parts, 3)
+	require.Len(t, fs.abortMultipartUploadCalls, 0)
+	require.NoFileExists(t, stateFile)
+}
+
+func TestUploadMultipartConcurrent(t *testing.T) {
+	fs := &fakeS3Client{
+		uploadPartDelay: 50 * time.Millisecond,
+	}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+	img := testImage()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	res, err := a.UploadMultipart(bytes.NewReader(img), "bucket", "key", &awscloud.MultipartUploadOptions{
+		StateFile:   stateFile,
+		PartSize:    testPartSize,
+		Concurrency: 2,
+	})
+	require.NoError(t, err)
+	// the same result as a sequential upload, with the parts in order
+	require.Equal(t, expectedMultipartOutput(img), res)
+	require.Len(t, fs.uploadPartCalls, 3)
+	require.Equal(t, 2, fs.uploadPartMaxInFlight)
+	completed := fs.completeMultipartUploadCalls[0].MultipartUpload.Parts
+	require.Len(t, completed, 3)
+	for i, part := range completed {
+		require.Equal(t, int32(i+1), *part.PartNumber)
+	}
+	require.NoFileExists(t, stateFile)
+}
+
+func TestUploadMultipartConcurrentError(t *testing.T) {
+	fs := &fakeS3Client{
+		uploadPartErr:       fmt.Errorf("connection reset"),
+		uploadPartFailAfter: 1,
+	}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	_, err := a.UploadMultipart(bytes.NewReader(testImage()), "bucket", "key", &awscloud.MultipartUploadOptions{
+		StateFile: stateFile,
+		PartSize:  testPartSize,
+	})
+	require.ErrorContains(t, err, "connection reset")
+
+	// only the uploaded part is in the state
+	state, err := awscloud.LoadMultipartUploadState(stateFile)
+	require.NoError(t, err)
+	require.Len(t, state.Parts, 1)
+	require.Equal(t, *fs.uploadPartCalls[0].PartNumber, state.Parts[0].PartNumber)
+}
+
+func TestUploadMultipartEmpty(t *testing.T) {
+	fs := &fakeS3Client{}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+
+	res, err := a.UploadMultipart(bytes.NewReader(nil), "bucket", "key", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), res.Size)
+	require.Len(t, fs.uploadPartCalls, 1)
+}
+
+func TestUploadMultipartPartSizeTooSmall(t *testing.T) {
+	fs := &fakeS3Client{}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+
+	_, err := a.UploadMultipart(bytes.NewReader(nil), "bucket", "key", &awscloud.MultipartUploadOptions{
+		PartSize: datasizes.MiB,
+	})
+	require.EqualError(t, err, "multipart part size 1048576 is smaller than the minimum of 5242880")
+	require.Len(t, fs.createMultipartUploadCalls, 0)
+}
+
+func TestUploadMultipartResume(t *testing.T) {
+	fs := &fakeS3Client{
+		uploadPartErr:       fmt.Errorf("connection reset"),
+		uploadPartFailAfter: 1,
+	}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+	img := testImage()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	// upload the parts one by one, so that the failing part is known
+	opts := &awscloud.MultipartUploadOptions{
+		StateFile:   stateFile,
+		PartSize:    testPartSize,
+		Concurrency: 1,
+	}
+	_, err := a.UploadMultipart(bytes.NewReader(img), "bucket", "key", opts)
+	require.EqualError(t, err, "cannot upload part 2: connection reset")
+	require.Len(t, fs.uploadPartCalls, 1)
+	// resumable uploads are not aborted
+	require.Len(t, fs.abortMultipartUploadCalls, 0)
+
+	state, err := awscloud.LoadMultipartUploadState(stateFile)
+	require.NoError(t, err)
+	require.Equal(t, "upload-id", state.UploadID)
+	require.Len(t, state.Parts, 1)
+
+	fs.uploadPartErr = nil
+	res, err := a.UploadMultipart(bytes.NewReader(img), "bucket", "key", opts)
+	require.NoError(t, err)
+	require.Equal(t, expectedMultipartOutput(img), res)
+	// the upload was not started again and only the missing parts were uploaded
+	require.Len(t, fs.createMultipartUploadCalls, 1)
+	require.Len(t, fs.listPartsCalls, 1)
+	require.Len(t, fs.uploadPartCalls, 3)
+	require.Equal(t, int32(2), *fs.uploadPartCalls[1].PartNumber)
+	require.Equal(t, int32(3), *fs.uploadPartCalls[2].PartNumber)
+	require.NoFileExists(t, stateFile)
+}
+
+func TestUploadMultipartResumeChangedPart(t *testing.T) {
+	fs := &fakeS3Client{
+		uploadPartErr:       fmt.Errorf("connection reset"),
+		uploadPartFailAfter: 1,
+	}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+	img := testImage()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	// upload the parts one by one, so that the failing part is known
+	opts := &awscloud.MultipartUploadOptions{
+		StateFile:   stateFile,
+		PartSize:    testPartSize,
+		Concurrency: 1,
+	}
+	_, err := a.UploadMultipart(bytes.NewReader(img), "bucket", "key", opts)
+	require.Error(t, err)
+
+	// the first part differs from what was uploaded before
+	img[0] = 0xff
+	fs.uploadPartErr = nil
+	res, err := a.UploadMultipart(bytes.NewReader(img), "bucket", "key", opts)
+	require.NoError(t, err)
+	require.Equal(t, expectedMultipartOutput(img), res)
+	require.Len(t, fs.uploadPartCalls, 4)
+	require.Equal(t, int32(1), *fs.uploadPartCalls[1].PartNumber)
+}
+
+func TestUploadMultipartResumeWrongKey(t *testing.T) {
+	fs := &fakeS3Client{}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	err := os.WriteFile(stateFile, []byte(`{"bucket":"bucket","key":"other-key","upload_id":"upload-id","part_size":5242880}`), 0600)
+	require.NoError(t, err)
+
+	_, err = a.UploadMultipart(bytes.NewReader(nil), "bucket", "key", &awscloud.MultipartUploadOptions{
+		StateFile: stateFile,
+	})
+	require.EqualError(t, err, fmt.Sprintf("multipart upload state %q is for bucket/other-key, not bucket/key", stateFile))
+}
+
+func TestUploadMultipartAbortedWithoutStateFile(t *testing.T) {
+	fs := &fakeS3Client{
+		uploadPartErr: fmt.Errorf("connection reset"),
+	}
+	a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+
+	_, err := a.UploadMultipart(bytes.NewReader(testImage()), "bucket", "key", &awscloud.MultipartUploadOptions{
+		Concurrency: 1,
+	})
+	require.EqualError(t, err, "cannot upload part 1: connection reset")
+	require.Len(t, fs.abortMultipartUploadCalls, 1)
+	require.Equal(t, "upload-id", *fs.abortMultipartUploadCalls[0].UploadId)
+}
+
+func TestVerifyObject(t *testing.T) {
+	expected := expectedMultipartOutput(testImage())
+
+	testCases := []struct {
+		name string
+		head *s3.HeadObjectOutput
+		err  string
+	}{
+		{
+			name: "happy",
+			head: &s3.HeadObjectOutput{
+				ContentLength:  aws.Int64(expected.Size),
+				ETag:           aws.String(`"` + expected.ETag + `"`),
+				ChecksumSHA256: aws.String(expected.ChecksumSHA256),
+			},
+		},
+		{
+			name: "kms-etag-ignored",
+			head: &s3.HeadObjectOutput{
+				ContentLength:        aws.Int64(expected.Size),
+				ETag:                 aws.String(`"random"`),
+				ChecksumSHA256:       aws.String(expected.ChecksumSHA256),
+				ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+			},
+		},
+		{
+			name: "size-mismatch",
+			head: &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(1),
+			},
+			err: fmt.Sprintf("size mismatch for bucket/key: expected %d, got 1", expected.Size),
+		},
+		{
+			name: "checksum-mismatch",
+			head: &s3.HeadObjectOutput{
+				ContentLength:  aws.Int64(expected.Size),
+				ChecksumSHA256: aws.String("wrong-3"),
+			},
+			err: fmt.Sprintf("SHA256 checksum mismatch for bucket/key: expected %s, got wrong-3", expected.ChecksumSHA256),
+		},
+		{
+			name: "etag-mismatch",
+			head: &s3.HeadObjectOutput{
+				ContentLength:  aws.Int64(expected.Size),
+				ETag:           aws.String(`"wrong-3"`),
+				ChecksumSHA256: aws.String(expected.ChecksumSHA256),
+			},
+			err: fmt.Sprintf("ETag mismatch for bucket/key: expected %s, got wrong-3", expected.ETag),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := &fakeS3Client{headObject: tc.head}
+			a := awscloud.NewAWSForTest(nil, fs, nil, nil)
+			err := a.VerifyObject("bucket", "key", expected)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Len(t, fs.headObjectCalls, 1)
+			require.Equal(t, s3types.ChecksumModeEnabled, fs.headObjectCalls[0].ChecksumMode)
+		})
+	}
+}
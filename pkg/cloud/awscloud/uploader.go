@@ -26,6 +26,12 @@ type awsUploader struct {
 	tags       []AWSTag
 	targetArch arch.Arch
 	bootMode   *platform.BootMode
+
+	resumeStateFile string
+	partSize        uint64
+	verifyUpload    bool
+
+	ebsDirect bool
 }
 
 type UploaderOptions struct {
@@ -34,6 +40,22 @@ type UploaderOptions struct {
 	BootMode *platform.BootMode
 	Profile  string
 	Tags     []AWSTag
+
+	// ResumeStateFile makes the upload resumable: the state of the
+	// multipart upload is persisted in this file and an upload that
+	// failed is resumed when the same file is passed again.
+	ResumeStateFile string
+	// PartSize of the multipart upload, see MultipartUploadOptions.
+	PartSize uint64
+	// VerifyUpload checks the size, ETag and SHA256 checksum of the
+	// uploaded object before the AMI is registered.
+	VerifyUpload bool
+
+	// EBSDirect writes the image straight into an EBS snapshot using
+	// the EBS direct APIs instead of staging it in an S3 bucket and
+	// importing it. No bucket is needed in this mode but the size of the
+	// image must be passed to UploadAndRegister.
+	EBSDirect bool
 }
 
 type AWSTag struct {
@@ -47,8 +69,13 @@ type awsClient interface {
 	Buckets() ([]string, error)
 	CheckBucketPermission(string, s3types.Permission) (bool, error)
 	UploadFromReader(io.Reader, string, string) (*transfermanager.UploadObjectOutput, error)
+	UploadMultipart(io.Reader, string, string, *MultipartUploadOptions) (*MultipartUploadOutput, error)
+	VerifyObject(string, string, *MultipartUploadOutput) error
 	Register(name, bucket, key string, tags []AWSTag, shareWith []string, architecture arch.Arch, bootMode *platform.BootMode, importRole *string) (string, string, error)
 	DeleteObject(string, string) error
+	WriteSnapshotEBSDirect(r io.Reader, size uint64, name string, tags []AWSTag) (string, error)
+	RegisterSnapshot(name, snapshotID string, tags []AWSTag, shareWith []string, architecture arch.Arch, bootMode *platform.BootMode) (string, error)
+	DeleteSnapshot(string) error
 }
 
 var newAwsClient = func(region string, profile string) (awsClient, error) {
@@ -74,6 +101,12 @@ func NewUploader(region, bucketName, imageName string, opts *UploaderOptions) (c
 		tags:       opts.Tags,
 		targetArch: opts.TargetArch,
 		bootMode:   opts.BootMode,
+
+		resumeStateFile: opts.ResumeStateFile,
+		partSize:        opts.PartSize,
+		verifyUpload:    opts.VerifyUpload,
+
+		ebsDirect: opts.EBSDirect,
 	}, nil
 }
 
@@ -90,6 +123,11 @@ func (au *awsUploader) Check(status io.Writer) error {
 		return fmt.Errorf("given AWS region '%s' not found", au.region)
 	}
 
+	if au.ebsDirect {
+		fmt.Fprintf(status, "Upload conditions met.\n")
+		return nil
+	}
+
 	fmt.Fprintf(status, "Checking AWS bucket...\n")
 	buckets, err := au.client.Buckets()
 	if err != nil {
@@ -111,14 +149,50 @@ func (au *awsUploader) Check(status io.Writer) error {
 	return nil
 }
 
-func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer) (err error) {
-	keyName := fmt.Sprintf("%s-%s", uuid.New().String(), au.imageName)
-	fmt.Fprintf(status, "Uploading %s to %s:%s\n", au.imageName, au.bucketName, keyName)
+// keyName returns the S3 key to upload to, an upload that is resumed must
+// keep the key of the previous attempt.
+func (au *awsUploader) keyName() (string, error) {
+	if au.resumeStateFile != "" {
+		state, err := LoadMultipartUploadState(au.resumeStateFile)
+		if err != nil {
+			return "", err
+		}
+		if state != nil && state.Bucket == au.bucketName {
+			return state.Key, nil
+		}
+	}
+	return fmt.Sprintf("%s-%s", uuid.New().String(), au.imageName), nil
+}
+
+func (au *awsUploader) UploadAndRegister(r io.Reader, uploadSize uint64, status io.Writer) (err error) {
+	if au.ebsDirect {
+		return au.writeSnapshotAndRegister(r, uploadSize, status)
+	}
 
-	res, err := au.client.UploadFromReader(r, au.bucketName, keyName)
+	keyName, err := au.keyName()
 	if err != nil {
 		return err
 	}
+	fmt.Fprintf(status, "Uploading %s to %s:%s\n", au.imageName, au.bucketName, keyName)
+
+	var location string
+	var multipartRes *MultipartUploadOutput
+	if au.resumeStateFile != "" || au.verifyUpload {
+		multipartRes, err = au.client.UploadMultipart(r, au.bucketName, keyName, &MultipartUploadOptions{
+			StateFile: au.resumeStateFile,
+			PartSize:  au.partSize,
+		})
+		if err != nil {
+			return err
+		}
+		location = multipartRes.Location
+	} else {
+		res, err := au.client.UploadFromReader(r, au.bucketName, keyName)
+		if err != nil {
+			return err
+		}
+		location = aws.ToString(res.Location)
+	}
 	defer func() {
 		if err != nil {
 			aErr := au.client.DeleteObject(au.bucketName, keyName)
@@ -126,7 +200,14 @@ func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer
 			err = errors.Join(err, aErr)
 		}
 	}()
-	fmt.Fprintf(status, "File uploaded to %s\n", aws.ToString(res.Location))
+	fmt.Fprintf(status, "File uploaded to %s\n", location)
+
+	if au.verifyUpload {
+		fmt.Fprintf(status, "Verifying S3 object %s:%s\n", au.bucketName, keyName)
+		if err := au.client.VerifyObject(au.bucketName, keyName, multipartRes); err != nil {
+			return err
+		}
+	}
 	if au.targetArch == arch.ARCH_UNSET {
 		au.targetArch = arch.Current()
 	}
@@ -148,3 +229,30 @@ func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer
 
 	return nil
 }
+
+func (au *awsUploader) writeSnapshotAndRegister(r io.Reader, uploadSize uint64, status io.Writer) (err error) {
+	fmt.Fprintf(status, "Writing %s to an EBS snapshot\n", au.imageName)
+	snapshot, err := au.client.WriteSnapshotEBSDirect(r, uploadSize, au.imageName, au.tags)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			aErr := au.client.DeleteSnapshot(snapshot)
+			fmt.Fprintf(status, "Deleted snapshot %s\n", snapshot)
+			err = errors.Join(err, aErr)
+		}
+	}()
+	if au.targetArch == arch.ARCH_UNSET {
+		au.targetArch = arch.Current()
+	}
+
+	fmt.Fprintf(status, "Registering AMI %s\n", au.imageName)
+	ami, err := au.client.RegisterSnapshot(au.imageName, snapshot, au.tags, nil, au.targetArch, au.bootMode)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "AMI registered: %s\nSnapshot ID: %s\n", ami, snapshot)
+
+	return nil
+}
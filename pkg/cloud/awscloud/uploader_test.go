@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -44,6 +46,25 @@ type fakeAWSClient struct {
 
 	deleteObjectErr   error
 	deleteObjectCalls int
+
+	uploadMultipartErr   error
+	uploadMultipartOpts  *awscloud.MultipartUploadOptions
+	uploadMultipartKey   string
+	uploadMultipartCalls int
+
+	verifyObjectErr   error
+	verifyObjectCalls int
+
+	writeSnapshotErr   error
+	writeSnapshotSize  uint64
+	writeSnapshotCalls int
+
+	registerSnapshotErr   error
+	registerSnapshotArch  arch.Arch
+	registerSnapshotCalls int
+
+	deleteSnapshotErr   error
+	deleteSnapshotCalls int
 }
 
 func (fa *fakeAWSClient) Regions() ([]string, error) {
@@ -66,6 +87,23 @@ func (fa *fakeAWSClient) UploadFromReader(io.Reader, string, string) (*transferm
 	return fa.uploadFromReader, fa.uploadFromReaderErr
 }
 
+func (fa *fakeAWSClient) UploadMultipart(r io.Reader, bucket, key string, opts *awscloud.MultipartUploadOptions) (*awscloud.MultipartUploadOutput, error) {
+	fa.uploadMultipartCalls++
+	fa.uploadMultipartKey = key
+	fa.uploadMultipartOpts = opts
+	if fa.uploadMultipartErr != nil {
+		return nil, fa.uploadMultipartErr
+	}
+	return &awscloud.MultipartUploadOutput{
+		Location: "multipart-location",
+	}, nil
+}
+
+func (fa *fakeAWSClient) VerifyObject(bucket, key string, expected *awscloud.MultipartUploadOutput) error {
+	fa.verifyObjectCalls++
+	return fa.verifyObjectErr
+}
+
 func (fa *fakeAWSClient) Register(name, bucket, key string, tags []awscloud.AWSTag, shareWith []string, architecture arch.Arch, bootMode *platform.BootMode, importRole *string) (string, string, error) {
 	fa.registerCalls++
 	fa.registerBootMode = bootMode
@@ -77,6 +115,26 @@ func (fa *fakeAWSClient) DeleteObject(string, string) error {
 	return fa.deleteObjectErr
 }
 
+func (fa *fakeAWSClient) WriteSnapshotEBSDirect(r io.Reader, size uint64, name string, tags []awscloud.AWSTag) (string, error) {
+	fa.writeSnapshotCalls++
+	fa.writeSnapshotSize = size
+	if fa.writeSnapshotErr != nil {
+		return "", fa.writeSnapshotErr
+	}
+	return fa.registerSnapshotId, nil
+}
+
+func (fa *fakeAWSClient) RegisterSnapshot(name, snapshotID string, tags []awscloud.AWSTag, shareWith []string, architecture arch.Arch, bootMode *platform.BootMode) (string, error) {
+	fa.registerSnapshotCalls++
+	fa.registerSnapshotArch = architecture
+	return fa.registerImageId, fa.registerSnapshotErr
+}
+
+func (fa *fakeAWSClient) DeleteSnapshot(string) error {
+	fa.deleteSnapshotCalls++
+	return fa.deleteSnapshotErr
+}
+
 func TestUploaderCheckHappy(t *testing.T) {
 	fa := &fakeAWSClient{
 		regions:               []string{"region"},
@@ -228,3 +286,155 @@ func TestUploaderUploadButRegisterErrorAndDeleteError(t *testing.T) {
 	// XXX: this should probably have a context
 	assert.EqualError(t, err, "fake-register-err\nfake-delete-object-err")
 }
+
+func TestUploaderUploadResumableAndVerify(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+
+	fa := &fakeAWSClient{
+		registerImageId:    "image-id",
+		registerSnapshotId: "snapshot-id",
+	}
+	restore := awscloud.MockNewAwsClient(func(string, string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	uploader, err := awscloud.NewUploader("region", "bucket", "ami", &awscloud.UploaderOptions{
+		ResumeStateFile: stateFile,
+		VerifyUpload:    true,
+	})
+	assert.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-aws-image"), 0, &uploadLog)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, fa.uploadFromReaderCalls)
+	assert.Equal(t, 1, fa.uploadMultipartCalls)
+	assert.Equal(t, stateFile, fa.uploadMultipartOpts.StateFile)
+	assert.Equal(t, 1, fa.verifyObjectCalls)
+	assert.Equal(t, 1, fa.registerCalls)
+	expectedUploadLog := `Uploading ami to bucket:01010101-0101-4101-8101-010101010101-ami
+File uploaded to multipart-location
+Verifying S3 object bucket:01010101-0101-4101-8101-010101010101-ami
+Registering AMI ami
+Deleted S3 object bucket:01010101-0101-4101-8101-010101010101-ami
+AMI registered: image-id
+Snapshot ID: snapshot-id
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestUploaderUploadResumesWithKeyFromState(t *testing.T) {
+	fa := &fakeAWSClient{}
+	restore := awscloud.MockNewAwsClient(func(string, string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	err := os.WriteFile(stateFile, []byte(`{"bucket":"bucket","key":"previous-key","upload_id":"upload-id","part_size":5242880}`), 0600)
+	assert.NoError(t, err)
+
+	uploader, err := awscloud.NewUploader("region", "bucket", "ami", &awscloud.UploaderOptions{
+		ResumeStateFile: stateFile,
+	})
+	assert.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-aws-image"), 0, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, "previous-key", fa.uploadMultipartKey)
+	assert.Equal(t, 0, fa.verifyObjectCalls)
+}
+
+func TestUploaderUploadVerifyError(t *testing.T) {
+	fa := &fakeAWSClient{
+		verifyObjectErr: fmt.Errorf("fake-verify-err"),
+	}
+	restore := awscloud.MockNewAwsClient(func(string, string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	uploader, err := awscloud.NewUploader("region", "bucket", "ami", &awscloud.UploaderOptions{
+		VerifyUpload: true,
+	})
+	assert.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-aws-image"), 0, io.Discard)
+	assert.EqualError(t, err, "fake-verify-err")
+	assert.Equal(t, "", fa.uploadMultipartOpts.StateFile)
+	assert.Equal(t, 0, fa.registerCalls)
+	assert.Equal(t, 1, fa.deleteObjectCalls)
+}
+
+func TestUploaderEBSDirectCheckSkipsBuckets(t *testing.T) {
+	fa := &fakeAWSClient{
+		regions: []string{"region"},
+	}
+	restore := awscloud.MockNewAwsClient(func(string, string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	uploader, err := awscloud.NewUploader("region", "", "ami", &awscloud.UploaderOptions{
+		EBSDirect: true,
+	})
+	assert.NoError(t, err)
+	var statusLog bytes.Buffer
+	err = uploader.Check(&statusLog)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fa.regionsCalls)
+	assert.Equal(t, 0, fa.bucketsCalls)
+	assert.Equal(t, 0, fa.checkBucketPermissionCalls)
+}
+
+func TestUploaderEBSDirectHappy(t *testing.T) {
+	fa := &fakeAWSClient{
+		registerImageId:    "image-id",
+		registerSnapshotId: "snapshot-id",
+	}
+	restore := awscloud.MockNewAwsClient(func(string, string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	uploader, err := awscloud.NewUploader("region", "", "ami", &awscloud.UploaderOptions{
+		TargetArch: arch.ARCH_AARCH64,
+		EBSDirect:  true,
+	})
+	assert.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-aws-image"), 1234, &uploadLog)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fa.writeSnapshotCalls)
+	assert.Equal(t, uint64(1234), fa.writeSnapshotSize)
+	assert.Equal(t, 1, fa.registerSnapshotCalls)
+	assert.Equal(t, arch.ARCH_AARCH64, fa.registerSnapshotArch)
+	assert.Equal(t, 0, fa.uploadFromReaderCalls)
+	assert.Equal(t, 0, fa.registerCalls)
+	assert.Equal(t, 0, fa.deleteSnapshotCalls)
+	expectedUploadLog := `Writing ami to an EBS snapshot
+Registering AMI ami
+AMI registered: image-id
+Snapshot ID: snapshot-id
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestUploaderEBSDirectRegisterErrorDeletesSnapshot(t *testing.T) {
+	fa := &fakeAWSClient{
+		registerSnapshotId:  "snapshot-id",
+		registerSnapshotErr: fmt.Errorf("fake-register-err"),
+		deleteSnapshotErr:   fmt.Errorf("fake-delete-err"),
+	}
+	restore := awscloud.MockNewAwsClient(func(string, string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	uploader, err := awscloud.NewUploader("region", "", "ami", &awscloud.UploaderOptions{
+		EBSDirect: true,
+	})
+	assert.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-aws-image"), 1234, io.Discard)
+	assert.EqualError(t, err, "fake-register-err\nfake-delete-err")
+	assert.Equal(t, 1, fa.deleteSnapshotCalls)
+}
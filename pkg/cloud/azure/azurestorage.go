@@ -119,24 +119,75 @@ func (c StorageClient) UploadPageBlob(metadata BlobMetadata, fileName string, th
 		return fmt.Errorf("cannot create a new page blob: %w", err)
 	}
 
+	return uploadPages(ctx, client, imageFile, threads)
+}
+
+// UploadPageBlobFromReader works like UploadPageBlob but reads the image
+// from the given reader. As the page blob needs to be created upfront, the
+// size of the image has to be known. The MD5 sum of the image is computed
+// while uploading and set on the blob once all pages are uploaded.
+func (c StorageClient) UploadPageBlobFromReader(metadata BlobMetadata, r io.Reader, size int64, threads int) error {
+	URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", metadata.StorageAccount, metadata.ContainerName, metadata.BlobName))
+	client, err := pageblob.NewClientWithSharedKeyCredential(URL.String(), c.credential, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create a pageblob client: %w", err)
+	}
+
+	ctx := context.Background()
+
+	if size <= 0 {
+		return errors.New("size for azure image must be known upfront")
+	}
+	if size%512 != 0 {
+		return errors.New("size for azure image must be aligned to 512 bytes")
+	}
+
+	_, err = client.Create(ctx, size, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create a new page blob: %w", err)
+	}
+
+	// azure uses MD5 hashes
+	/* #nosec G401 */
+	imageHash := md5.New()
+	if err := uploadPages(ctx, client, io.TeeReader(r, imageHash), threads); err != nil {
+		return err
+	}
+
+	_, err = client.SetHTTPHeaders(ctx, blob.HTTPHeaders{
+		BlobContentMD5: imageHash.Sum(nil),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("cannot set the blob MD5: %w", err)
+	}
+
+	return nil
+}
+
+// uploadPages uploads the content of the reader to the page blob. Pages
+// containing only zeros are skipped.
+func uploadPages(ctx context.Context, client *pageblob.Client, r io.Reader, threads int) error {
 	// Create control variables
 	// This channel simulates behavior of a semaphore and bounds the number of parallel threads
 	var semaphore = make(chan int, threads)
 	// Forward error from goroutine to the caller
 	var errorInGoroutine = make(chan error, 1)
-	var counter int64 = 0
+	// Offset of the next chunk in the blob. The chunks are read with
+	// io.ReadFull so that every chunk but the last one is complete and
+	// the pages end up at the offsets they were read from.
+	var offset int64 = 0
 
 	// Create buffered reader to speed up the upload
-	reader := bufio.NewReader(imageFile)
+	reader := bufio.NewReader(r)
 	// Run the upload
 	run := true
 	var wg sync.WaitGroup
 	zeros := make([]byte, PageBlobMaxUploadPagesBytes)
 	for run {
 		buffer := make([]byte, PageBlobMaxUploadPagesBytes)
-		n, err := reader.Read(buffer)
+		n, err := io.ReadFull(reader, buffer)
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				run = false
 			} else {
 				return fmt.Errorf("reading the image failed: %w", err)
@@ -152,16 +203,16 @@ func (c StorageClient) UploadPageBlob(metadata BlobMetadata, fileName string, th
 		// Using bytes.Equal with a preallocated buffer can be significantly faster on
 		// certain hardware than just iterating over the entire slice.
 		if bytes.Equal(zeros[:n], buffer[:n]) {
-			counter++
+			offset += int64(n)
 			continue
 		}
 
 		wg.Add(1)
 		semaphore <- 1
-		go func(counter int64, buffer []byte, n int) {
+		go func(offset int64, buffer []byte, n int) {
 			defer wg.Done()
 			uploadRange := blob.HTTPRange{
-				Offset: counter * PageBlobMaxUploadPagesBytes,
+				Offset: offset,
 				Count:  int64(n),
 			}
 			_, err := client.UploadPages(ctx, common.NopSeekCloser(bytes.NewReader(buffer[:n])), uploadRange, nil)
@@ -174,8 +225,8 @@ func (c StorageClient) UploadPageBlob(metadata BlobMetadata, fileName string, th
 				}
 			}
 			<-semaphore
-		}(counter, buffer, n)
-		counter++
+		}(offset, buffer, n)
+		offset += int64(n)
 	}
 	// Wait for all goroutines to finish
 	wg.Wait()
@@ -1,9 +1,17 @@
 package azure
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"sync"
 	"testing"
+	"testing/iotest"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/pageblob"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,3 +39,29 @@ func TestEnsureVHDExtension(t *testing.T) {
 		})
 	}
 }
+
+func TestUploadPagesShortReads(t *testing.T) {
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("x-ms-range"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client, err := pageblob.NewClientWithNoCredential(srv.URL+"/container/image.vhd", nil)
+	require.NoError(t, err)
+
+	// the first page is all zeros and skipped, the reader returns a single
+	// byte on every read
+	image := append(make([]byte, PageBlobMaxUploadPagesBytes), bytes.Repeat([]byte{1}, PageBlobMaxUploadPagesBytes+512)...)
+	err = uploadPages(context.Background(), client, iotest.OneByteReader(bytes.NewReader(image)), 4)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		fmt.Sprintf("bytes=%d-%d", PageBlobMaxUploadPagesBytes, 2*PageBlobMaxUploadPagesBytes-1),
+		fmt.Sprintf("bytes=%d-%d", 2*PageBlobMaxUploadPagesBytes, 2*PageBlobMaxUploadPagesBytes+511),
+	}, ranges)
+}
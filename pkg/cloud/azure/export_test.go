@@ -1,3 +1,21 @@
 package azure
 
 var NewTestclient = newTestClient
+
+type StorageClientInterface = storageClient
+
+func MockNewAzureClient(f func(Credentials, string, string) (*Client, error)) (restore func()) {
+	saved := newAzureClient
+	newAzureClient = f
+	return func() {
+		newAzureClient = saved
+	}
+}
+
+func MockNewStorageClient(f func(string, string) (storageClient, error)) (restore func()) {
+	saved := newStorageClient
+	newStorageClient = f
+	return func() {
+		newStorageClient = saved
+	}
+}
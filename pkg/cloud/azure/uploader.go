@@ -0,0 +1,251 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+// ImageType selects how the uploaded VHD is registered in Azure.
+type ImageType string
+
+const (
+	// ImageTypeManaged registers the blob as a managed image.
+	ImageTypeManaged ImageType = "managed"
+	// ImageTypeGallery registers the blob as an image version in a
+	// Shared Image Gallery.
+	ImageTypeGallery ImageType = "gallery"
+)
+
+// DefaultStorageContainer is the container used for the uploaded blobs if
+// none is given in the UploaderOptions.
+const DefaultStorageContainer = "imagebuilder"
+
+// storageAccountTagName is used to find a storage account created by a
+// previous upload in the same resource group and location.
+const storageAccountTagName = "imagesStorageAccount"
+
+type azureUploader struct {
+	client *Client
+
+	resourceGroup    string
+	imageName        string
+	location         string
+	storageAccount   string
+	storageContainer string
+	imageType        ImageType
+	targetArch       arch.Arch
+	hyperVGen        HyperVGenerationType
+	tags             map[string]string
+}
+
+type UploaderOptions struct {
+	// Location of the uploaded image. If empty, the location of the
+	// resource group is used.
+	Location string
+	// StorageAccount to upload the blob to. If empty, a storage account
+	// tagged by a previous upload is reused or a new one is created.
+	StorageAccount string
+	// StorageContainer to upload the blob to, defaults to
+	// DefaultStorageContainer.
+	StorageContainer string
+	// ImageType defaults to ImageTypeManaged.
+	ImageType  ImageType
+	TargetArch arch.Arch
+	// BootMode of the image, used to select the HyperV generation. If
+	// nil, V2 is used.
+	BootMode *platform.BootMode
+	// Tags set on the uploaded blob.
+	Tags map[string]string
+}
+
+// testing support
+type storageClient interface {
+	CreateStorageContainerIfNotExist(ctx context.Context, storageAccount, name string) error
+	UploadPageBlobFromReader(metadata BlobMetadata, r io.Reader, size int64, threads int) error
+	TagBlob(ctx context.Context, metadata BlobMetadata, tags map[string]string) error
+	DeleteBlob(ctx context.Context, metadata BlobMetadata) error
+}
+
+var newAzureClient = func(credentials Credentials, tenantID, subscriptionID string) (*Client, error) {
+	return NewClient(credentials, tenantID, subscriptionID)
+}
+
+var newStorageClient = func(storageAccount, storageAccessKey string) (storageClient, error) {
+	return NewStorageClient(storageAccount, storageAccessKey)
+}
+
+// HyperVGenerationFromBootMode returns the HyperV generation to use for an
+// image with the given boot mode. Only legacy BIOS images need V1.
+func HyperVGenerationFromBootMode(bootMode *platform.BootMode) HyperVGenerationType {
+	if bootMode != nil && *bootMode == platform.BOOT_LEGACY {
+		return HyperVGenV1
+	}
+	return HyperVGenV2
+}
+
+// NewUploader returns a cloud.Uploader that uploads a VHD image as a page
+// blob into a storage account in the given resource group and registers
+// it as imageName.
+func NewUploader(credentials Credentials, tenantID, subscriptionID, resourceGroup, imageName string, opts *UploaderOptions) (cloud.Uploader, error) {
+	if opts == nil {
+		opts = &UploaderOptions{}
+	}
+
+	imageType := opts.ImageType
+	switch imageType {
+	case "":
+		imageType = ImageTypeManaged
+	case ImageTypeManaged, ImageTypeGallery:
+	default:
+		return nil, fmt.Errorf("unknown azure image type %q", imageType)
+	}
+
+	storageContainer := opts.StorageContainer
+	if storageContainer == "" {
+		storageContainer = DefaultStorageContainer
+	}
+
+	client, err := newAzureClient(credentials, tenantID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azureUploader{
+		client:           client,
+		resourceGroup:    resourceGroup,
+		imageName:        imageName,
+		location:         opts.Location,
+		storageAccount:   opts.StorageAccount,
+		storageContainer: storageContainer,
+		imageType:        imageType,
+		targetArch:       opts.TargetArch,
+		hyperVGen:        HyperVGenerationFromBootMode(opts.BootMode),
+		tags:             opts.Tags,
+	}, nil
+}
+
+var _ cloud.Uploader = &azureUploader{}
+
+func (au *azureUploader) Check(status io.Writer) error {
+	fmt.Fprintf(status, "Checking Azure resource group...\n")
+	location, err := au.client.GetResourceGroupLocation(context.Background(), au.resourceGroup)
+	if err != nil {
+		return fmt.Errorf("retrieving Azure resource group '%s' failed: %w", au.resourceGroup, err)
+	}
+	if au.location == "" {
+		au.location = location
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+// ensureStorageAccount returns the storage account to upload to, creating
+// one if needed.
+func (au *azureUploader) ensureStorageAccount(ctx context.Context, status io.Writer) (string, error) {
+	if au.storageAccount != "" {
+		return au.storageAccount, nil
+	}
+
+	tag := Tag{
+		Name:  storageAccountTagName,
+		Value: fmt.Sprintf("location=%s", au.location),
+	}
+	storageAccount, err := au.client.GetResourceNameByTag(ctx, au.resourceGroup, tag)
+	if err != nil {
+		return "", err
+	}
+	if storageAccount == "" {
+		storageAccount = RandomStorageAccountName("images")
+		fmt.Fprintf(status, "Creating storage account %s\n", storageAccount)
+		if err := au.client.CreateStorageAccount(ctx, au.resourceGroup, storageAccount, au.location, tag); err != nil {
+			return "", err
+		}
+	}
+	return storageAccount, nil
+}
+
+func (au *azureUploader) UploadAndRegister(r io.Reader, uploadSize uint64, status io.Writer) (err error) {
+	ctx := context.Background()
+
+	if au.location == "" {
+		au.location, err = au.client.GetResourceGroupLocation(ctx, au.resourceGroup)
+		if err != nil {
+			return fmt.Errorf("retrieving resource group location failed: %w", err)
+		}
+	}
+
+	storageAccount, err := au.ensureStorageAccount(ctx, status)
+	if err != nil {
+		return err
+	}
+	storageKey, err := au.client.GetStorageAccountKey(ctx, au.resourceGroup, storageAccount)
+	if err != nil {
+		return err
+	}
+	storeClient, err := newStorageClient(storageAccount, storageKey)
+	if err != nil {
+		return err
+	}
+	if err := storeClient.CreateStorageContainerIfNotExist(ctx, storageAccount, au.storageContainer); err != nil {
+		return err
+	}
+
+	blob := BlobMetadata{
+		StorageAccount: storageAccount,
+		ContainerName:  au.storageContainer,
+		BlobName:       EnsureVHDExtension(au.imageName),
+	}
+	// the page blob is created before its content is uploaded, so a
+	// failed upload leaves a blob behind as well, unless it never got
+	// created in the first place
+	defer func() {
+		if err != nil {
+			fmt.Fprintf(status, "Deleting blob %s/%s\n", storageAccount, blob.BlobName)
+			if deleteErr := storeClient.DeleteBlob(ctx, blob); !bloberror.HasCode(deleteErr, bloberror.BlobNotFound) {
+				err = errors.Join(err, deleteErr)
+			}
+		}
+	}()
+	fmt.Fprintf(status, "Uploading %s to %s/%s\n", au.imageName, storageAccount, blob.BlobName)
+	// #nosec G115
+	if err := storeClient.UploadPageBlobFromReader(blob, r, int64(uploadSize), DefaultUploadThreads); err != nil {
+		return err
+	}
+
+	if len(au.tags) > 0 {
+		if err := storeClient.TagBlob(ctx, blob, au.tags); err != nil {
+			return err
+		}
+	}
+
+	switch au.imageType {
+	case ImageTypeManaged:
+		fmt.Fprintf(status, "Registering image %s\n", au.imageName)
+		err = au.client.RegisterImage(ctx, au.resourceGroup, storageAccount, au.storageContainer, blob.BlobName, au.imageName, au.location, au.hyperVGen)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(status, "Image registered: /subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/images/%s\n", au.client.subscription, au.resourceGroup, au.imageName)
+	case ImageTypeGallery:
+		if au.targetArch == arch.ARCH_UNSET {
+			au.targetArch = arch.Current()
+		}
+		fmt.Fprintf(status, "Registering gallery image %s\n", au.imageName)
+		var gi *GalleryImage
+		gi, err = au.client.RegisterGalleryImage(ctx, au.resourceGroup, storageAccount, au.storageContainer, blob.BlobName, au.imageName, au.location, au.hyperVGen, au.targetArch)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(status, "Image registered: %s\n", gi.ImageRef)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package azure_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/cloud/azure"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+type fakeStorageClient struct {
+	account string
+	key     string
+
+	containers []string
+
+	uploadErr      error
+	uploadBlob     azure.BlobMetadata
+	uploadData     []byte
+	uploadSize     int64
+	uploadCalls    int
+	tags           map[string]string
+	deleteBlobCall int
+	deleteBlobErr  error
+}
+
+func (fs *fakeStorageClient) CreateStorageContainerIfNotExist(ctx context.Context, storageAccount, name string) error {
+	fs.containers = append(fs.containers, name)
+	return nil
+}
+
+func (fs *fakeStorageClient) UploadPageBlobFromReader(metadata azure.BlobMetadata, r io.Reader, size int64, threads int) error {
+	fs.uploadCalls++
+	fs.uploadBlob = metadata
+	fs.uploadSize = size
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	fs.uploadData = data
+	return fs.uploadErr
+}
+
+func (fs *fakeStorageClient) TagBlob(ctx context.Context, metadata azure.BlobMetadata, tags map[string]string) error {
+	fs.tags = tags
+	return nil
+}
+
+func (fs *fakeStorageClient) DeleteBlob(ctx context.Context, metadata azure.BlobMetadata) error {
+	fs.deleteBlobCall++
+	return fs.deleteBlobErr
+}
+
+func mockUploaderClients(t *testing.T) (azm, *fakeStorageClient) {
+	azm := newAZ()
+	fs := &fakeStorageClient{}
+
+	t.Cleanup(azure.MockNewAzureClient(func(azure.Credentials, string, string) (*azure.Client, error) {
+		return azm.az, nil
+	}))
+	t.Cleanup(azure.MockNewStorageClient(func(account, key string) (azure.StorageClientInterface, error) {
+		fs.account = account
+		fs.key = key
+		return fs, nil
+	}))
+	return azm, fs
+}
+
+func TestUploaderCheck(t *testing.T) {
+	azm, _ := mockUploaderClients(t)
+
+	uploader, err := azure.NewUploader(azure.Credentials{}, "tenant", "subscription", "rg", "image", nil)
+	require.NoError(t, err)
+	var statusLog bytes.Buffer
+	require.NoError(t, uploader.Check(&statusLog))
+	assert.Len(t, azm.rgm.get, 1)
+	assert.Equal(t, "Checking Azure resource group...\nUpload conditions met.\n", statusLog.String())
+}
+
+func TestUploaderUnknownImageType(t *testing.T) {
+	mockUploaderClients(t)
+
+	_, err := azure.NewUploader(azure.Credentials{}, "tenant", "subscription", "rg", "image", &azure.UploaderOptions{
+		ImageType: "foo",
+	})
+	assert.EqualError(t, err, `unknown azure image type "foo"`)
+}
+
+func TestUploaderUploadManagedImage(t *testing.T) {
+	azm, fs := mockUploaderClients(t)
+
+	uploader, err := azure.NewUploader(azure.Credentials{}, "tenant", "subscription", "rg", "image", &azure.UploaderOptions{
+		BootMode: common.ToPtr(platform.BOOT_LEGACY),
+		Tags:     map[string]string{"key": "value"},
+	})
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-vhd"), 512, &uploadLog)
+	require.NoError(t, err)
+
+	// storage account found by tag
+	assert.Len(t, azm.acm.beginCreate, 0)
+	assert.Equal(t, "storage-account", fs.account)
+	assert.Equal(t, "real key", fs.key)
+	assert.Equal(t, []string{azure.DefaultStorageContainer}, fs.containers)
+
+	assert.Equal(t, 1, fs.uploadCalls)
+	assert.Equal(t, azure.BlobMetadata{
+		StorageAccount: "storage-account",
+		ContainerName:  azure.DefaultStorageContainer,
+		BlobName:       "image.vhd",
+	}, fs.uploadBlob)
+	assert.Equal(t, int64(512), fs.uploadSize)
+	assert.Equal(t, []byte("fake-vhd"), fs.uploadData)
+	assert.Equal(t, map[string]string{"key": "value"}, fs.tags)
+	assert.Equal(t, 0, fs.deleteBlobCall)
+
+	require.Len(t, azm.im.createOrUpdate, 1)
+	assert.Equal(t, "image", azm.im.createOrUpdate[0].name)
+	assert.Equal(t, common.ToPtr(armcompute.HyperVGenerationTypesV1), azm.im.createOrUpdate[0].img.Properties.HyperVGeneration)
+	assert.Equal(t, common.ToPtr("https://storage-account.blob.core.windows.net/imagebuilder/image.vhd"), azm.im.createOrUpdate[0].img.Properties.StorageProfile.OSDisk.BlobURI)
+	assert.Len(t, azm.gm.createOrUpdate, 0)
+
+	assert.Equal(t, `Uploading image to storage-account/image.vhd
+Registering image image
+Image registered: /subscriptions/test-subscription/resourceGroups/rg/providers/Microsoft.Compute/images/image
+`, uploadLog.String())
+}
+
+func TestUploaderUploadGalleryImage(t *testing.T) {
+	azm, fs := mockUploaderClients(t)
+
+	uploader, err := azure.NewUploader(azure.Credentials{}, "tenant", "subscription", "rg", "image", &azure.UploaderOptions{
+		ImageType:  azure.ImageTypeGallery,
+		TargetArch: arch.ARCH_AARCH64,
+	})
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-vhd"), 512, &uploadLog)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, fs.uploadCalls)
+	assert.Nil(t, fs.tags)
+
+	require.Len(t, azm.gim.createOrUpdate, 1)
+	assert.Equal(t, common.ToPtr(armcompute.ArchitectureArm64), azm.gim.createOrUpdate[0].image.Properties.Architecture)
+	assert.Equal(t, common.ToPtr(armcompute.HyperVGenerationV2), azm.gim.createOrUpdate[0].image.Properties.HyperVGeneration)
+	require.Len(t, azm.givm.createOrUpdate, 1)
+
+	assert.Equal(t, `Uploading image to storage-account/image.vhd
+Registering gallery image image
+Image registered: /subscriptions/test-subscription/resourceGroups/rg/providers/Microsoft.Compute/galleries/image_gallery/images/image-img/versions/1.0.0
+`, uploadLog.String())
+}
+
+func TestUploaderUploadError(t *testing.T) {
+	_, fs := mockUploaderClients(t)
+	fs.uploadErr = fmt.Errorf("fake-upload-err")
+
+	uploader, err := azure.NewUploader(azure.Credentials{}, "tenant", "subscription", "rg", "image", nil)
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-vhd"), 512, &uploadLog)
+	assert.EqualError(t, err, "fake-upload-err")
+	// the page blob may have been created before the upload failed
+	assert.Equal(t, 1, fs.deleteBlobCall)
+	assert.Equal(t, `Uploading image to storage-account/image.vhd
+Deleting blob storage-account/image.vhd
+`, uploadLog.String())
+}
+
+func TestUploaderUploadErrorDeleteErrors(t *testing.T) {
+	for _, tc := range []struct {
+		deleteErr   error
+		expectedErr string
+	}{
+		// the page blob was never created
+		{&azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)}, "fake-upload-err"},
+		{fmt.Errorf("fake-delete-err"), "fake-upload-err\nfake-delete-err"},
+	} {
+		t.Run(tc.expectedErr, func(t *testing.T) {
+			_, fs := mockUploaderClients(t)
+			fs.uploadErr = fmt.Errorf("fake-upload-err")
+			fs.deleteBlobErr = tc.deleteErr
+
+			uploader, err := azure.NewUploader(azure.Credentials{}, "tenant", "subscription", "rg", "image", nil)
+			require.NoError(t, err)
+			err = uploader.UploadAndRegister(bytes.NewBufferString("fake-vhd"), 512, io.Discard)
+			assert.EqualError(t, err, tc.expectedErr)
+			assert.Equal(t, 1, fs.deleteBlobCall)
+		})
+	}
+}
+
+func TestHyperVGenerationFromBootMode(t *testing.T) {
+	assert.Equal(t, azure.HyperVGenV2, azure.HyperVGenerationFromBootMode(nil))
+	assert.Equal(t, azure.HyperVGenV1, azure.HyperVGenerationFromBootMode(common.ToPtr(platform.BOOT_LEGACY)))
+	assert.Equal(t, azure.HyperVGenV2, azure.HyperVGenerationFromBootMode(common.ToPtr(platform.BOOT_UEFI)))
+	assert.Equal(t, azure.HyperVGenV2, azure.HyperVGenerationFromBootMode(common.ToPtr(platform.BOOT_HYBRID)))
+}
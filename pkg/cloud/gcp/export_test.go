@@ -0,0 +1,11 @@
+package gcp
+
+type GcpClient = gcpClient
+
+func MockNewGcpClient(f func([]byte) (gcpClient, error)) (restore func()) {
+	saved := newGcpClient
+	newGcpClient = f
+	return func() {
+		newGcpClient = saved
+	}
+}
@@ -1,10 +1,12 @@
 package gcp
 
 import (
+	"bytes"
 	"context"
 	// gcp uses MD5 hashes
 	/* #nosec G501 */
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -79,6 +81,74 @@ func (g *GCP) StorageObjectUpload(ctx context.Context, filename, bucket, object
 	return wc.Attrs(), nil
 }
 
+// StorageObjectUploadFromReader uploads an OS image read from the given
+// reader to the specified Cloud Storage bucket and object. The bucket must
+// exist. Since the MD5 sum cannot be known before the upload, it is computed
+// while streaming and compared with the one reported for the created object.
+//
+// The ObjectAttrs is returned if the object has been created.
+//
+// Uses:
+//   - Storage API
+func (g *GCP) StorageObjectUploadFromReader(ctx context.Context, r io.Reader, bucket, object string, metadata map[string]string) (*storage.ObjectAttrs, error) {
+	storageClient, err := storage.NewClient(ctx, option.WithCredentials(g.creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	obj := storageClient.Bucket(bucket).Object(object)
+	wc := obj.NewWriter(ctx)
+	if metadata != nil {
+		wc.ObjectAttrs.Metadata = metadata
+	}
+
+	// gcp uses MD5 hashes
+	/* #nosec G401 */
+	imageHash := md5.New()
+	if _, err = io.Copy(io.MultiWriter(wc, imageHash), r); err != nil {
+		return nil, fmt.Errorf("uploading the image failed: %v", err)
+	}
+
+	// The object will not be available until Close has been called.
+	if err := wc.Close(); err != nil {
+		return nil, fmt.Errorf("Writer.Close: %v", err)
+	}
+
+	attrs := wc.Attrs()
+	if !bytes.Equal(attrs.MD5, imageHash.Sum(nil)) {
+		if err := obj.Delete(ctx); err != nil {
+			return nil, fmt.Errorf("uploaded object MD5 does not match the image and it cannot be deleted: %v", err)
+		}
+		return nil, fmt.Errorf("uploaded object MD5 does not match the image")
+	}
+
+	return attrs, nil
+}
+
+// StorageBucketExists checks if the given bucket exists and is accessible
+// with the used credentials.
+//
+// Uses:
+//   - Storage API
+func (g *GCP) StorageBucketExists(ctx context.Context, bucket string) (bool, error) {
+	storageClient, err := storage.NewClient(ctx, option.WithCredentials(g.creds))
+	if err != nil {
+		return false, fmt.Errorf("failed to get Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	_, err = storageClient.Bucket(bucket).Attrs(ctx)
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get bucket attributes: %v", err)
+	}
+
+	return true, nil
+}
+
 // StorageObjectDelete deletes the given object from a bucket.
 //
 // Uses:
@@ -0,0 +1,127 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/pkg/cloud"
+)
+
+type gcpUploader struct {
+	client gcpClient
+
+	bucketName      string
+	imageName       string
+	regions         []string
+	shareWith       []string
+	guestOsFeatures []*computepb.GuestOsFeature
+}
+
+type UploaderOptions struct {
+	// Credentials is the content of a service account credentials file.
+	// If nil, the default credentials are used.
+	Credentials []byte
+	// Regions where the imported image should be stored. If empty, the
+	// region of the bucket is used.
+	Regions []string
+	// ShareWith is a list of accounts to share the imported image with,
+	// see ComputeImageShare() for the accepted format.
+	ShareWith []string
+	// DistroName is used to determine the Guest OS Features of the
+	// imported image, see GuestOsFeaturesByDistro().
+	DistroName string
+}
+
+// testing support
+type gcpClient interface {
+	StorageBucketExists(ctx context.Context, bucket string) (bool, error)
+	StorageObjectUploadFromReader(ctx context.Context, r io.Reader, bucket, object string, metadata map[string]string) (*storage.ObjectAttrs, error)
+	StorageObjectDelete(ctx context.Context, bucket, object string) error
+	ComputeImageInsert(ctx context.Context, bucket, object, imageName string, regions []string, guestOsFeatures []*computepb.GuestOsFeature) (*computepb.Image, error)
+	ComputeImageShare(ctx context.Context, imageName string, shareWith []string) error
+	ComputeImageURL(imageName string) string
+}
+
+var newGcpClient = func(credentials []byte) (gcpClient, error) {
+	return New(credentials)
+}
+
+// NewUploader returns a cloud.Uploader that uploads a GCE image archive
+// (a gzip-ed tarball with a 'disk.raw' inside) to the given bucket and
+// imports it into Compute Engine as imageName.
+func NewUploader(bucketName, imageName string, opts *UploaderOptions) (cloud.Uploader, error) {
+	if opts == nil {
+		opts = &UploaderOptions{}
+	}
+
+	client, err := newGcpClient(opts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcpUploader{
+		client:          client,
+		bucketName:      bucketName,
+		imageName:       imageName,
+		regions:         opts.Regions,
+		shareWith:       opts.ShareWith,
+		guestOsFeatures: GuestOsFeaturesByDistro(opts.DistroName),
+	}, nil
+}
+
+var _ cloud.Uploader = &gcpUploader{}
+
+func (gu *gcpUploader) Check(status io.Writer) error {
+	fmt.Fprintf(status, "Checking GCP bucket...\n")
+	exists, err := gu.client.StorageBucketExists(context.Background(), gu.bucketName)
+	if err != nil {
+		return fmt.Errorf("retrieving GCP bucket '%s' failed: %w", gu.bucketName, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket '%s' not found in the given GCP project", gu.bucketName)
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+func (gu *gcpUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer) (err error) {
+	ctx := context.Background()
+
+	objectName := fmt.Sprintf("%s-%s.tar.gz", uuid.New().String(), gu.imageName)
+	fmt.Fprintf(status, "Uploading %s to %s/%s\n", gu.imageName, gu.bucketName, objectName)
+
+	_, err = gu.client.StorageObjectUploadFromReader(ctx, r, gu.bucketName, objectName,
+		map[string]string{MetadataKeyImageName: gu.imageName})
+	if err != nil {
+		return err
+	}
+	// The object is only needed for the import, always clean it up
+	defer func() {
+		fmt.Fprintf(status, "Deleting storage object %s/%s\n", gu.bucketName, objectName)
+		if dErr := gu.client.StorageObjectDelete(ctx, gu.bucketName, objectName); dErr != nil {
+			err = errors.Join(err, dErr)
+		}
+	}()
+
+	fmt.Fprintf(status, "Importing image %s\n", gu.imageName)
+	_, err = gu.client.ComputeImageInsert(ctx, gu.bucketName, objectName, gu.imageName, gu.regions, gu.guestOsFeatures)
+	if err != nil {
+		return err
+	}
+
+	if len(gu.shareWith) > 0 {
+		fmt.Fprintf(status, "Sharing image %s with %v\n", gu.imageName, gu.shareWith)
+		if err := gu.client.ComputeImageShare(ctx, gu.imageName, gu.shareWith); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(status, "Image URL: %s\n", gu.client.ComputeImageURL(gu.imageName))
+	return nil
+}
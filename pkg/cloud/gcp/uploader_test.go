@@ -0,0 +1,202 @@
+package gcp_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud/gcp"
+)
+
+type fakeGCPClient struct {
+	bucketExists      bool
+	bucketExistsErr   error
+	bucketExistsCalls int
+
+	uploadErr      error
+	uploadCalls    int
+	uploadData     []byte
+	uploadMetadata map[string]string
+
+	deleteErr   error
+	deleteCalls int
+
+	insertErr             error
+	insertCalls           int
+	insertRegions         []string
+	insertGuestOsFeatures []*computepb.GuestOsFeature
+
+	shareErr   error
+	shareCalls int
+	shareWith  []string
+}
+
+func (fg *fakeGCPClient) StorageBucketExists(ctx context.Context, bucket string) (bool, error) {
+	fg.bucketExistsCalls++
+	return fg.bucketExists, fg.bucketExistsErr
+}
+
+func (fg *fakeGCPClient) StorageObjectUploadFromReader(ctx context.Context, r io.Reader, bucket, object string, metadata map[string]string) (*storage.ObjectAttrs, error) {
+	fg.uploadCalls++
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fg.uploadData = data
+	fg.uploadMetadata = metadata
+	return &storage.ObjectAttrs{Bucket: bucket, Name: object}, fg.uploadErr
+}
+
+func (fg *fakeGCPClient) StorageObjectDelete(ctx context.Context, bucket, object string) error {
+	fg.deleteCalls++
+	return fg.deleteErr
+}
+
+func (fg *fakeGCPClient) ComputeImageInsert(ctx context.Context, bucket, object, imageName string, regions []string, guestOsFeatures []*computepb.GuestOsFeature) (*computepb.Image, error) {
+	fg.insertCalls++
+	fg.insertRegions = regions
+	fg.insertGuestOsFeatures = guestOsFeatures
+	return &computepb.Image{Name: &imageName}, fg.insertErr
+}
+
+func (fg *fakeGCPClient) ComputeImageShare(ctx context.Context, imageName string, shareWith []string) error {
+	fg.shareCalls++
+	fg.shareWith = shareWith
+	return fg.shareErr
+}
+
+func (fg *fakeGCPClient) ComputeImageURL(imageName string) string {
+	return "https://example.com/" + imageName
+}
+
+type repeatReader struct{}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0x1
+	}
+	return len(p), nil
+}
+
+func mockClient(t *testing.T, fg *fakeGCPClient) {
+	restore := gcp.MockNewGcpClient(func([]byte) (gcp.GcpClient, error) {
+		return fg, nil
+	})
+	t.Cleanup(restore)
+}
+
+func TestUploaderCheckHappy(t *testing.T) {
+	fg := &fakeGCPClient{bucketExists: true}
+	mockClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	var statusLog bytes.Buffer
+	err = uploader.Check(&statusLog)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fg.bucketExistsCalls)
+	assert.Equal(t, "Checking GCP bucket...\nUpload conditions met.\n", statusLog.String())
+}
+
+func TestUploaderCheckNoBucket(t *testing.T) {
+	fg := &fakeGCPClient{bucketExists: false}
+	mockClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.EqualError(t, err, "bucket 'bucket' not found in the given GCP project")
+}
+
+func TestUploaderUploadHappy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     *gcp.UploaderOptions
+		check_fn func(*testing.T, *fakeGCPClient, string)
+	}{
+		{
+			name: "default",
+			opts: nil,
+			check_fn: func(t *testing.T, fg *fakeGCPClient, log string) {
+				assert.Nil(t, fg.insertGuestOsFeatures)
+				assert.Equal(t, 0, fg.shareCalls)
+				assert.Equal(t, `Uploading image to bucket/01010101-0101-4101-8101-010101010101-image.tar.gz
+Importing image image
+Image URL: https://example.com/image
+Deleting storage object bucket/01010101-0101-4101-8101-010101010101-image.tar.gz
+`, log)
+			},
+		},
+		{
+			name: "rhel-9-shared",
+			opts: &gcp.UploaderOptions{
+				Regions:    []string{"us-east1"},
+				ShareWith:  []string{"user:alice@example.com"},
+				DistroName: "rhel-9.6",
+			},
+			check_fn: func(t *testing.T, fg *fakeGCPClient, log string) {
+				assert.Equal(t, gcp.GuestOsFeaturesRHEL9, fg.insertGuestOsFeatures)
+				assert.Equal(t, []string{"us-east1"}, fg.insertRegions)
+				assert.Equal(t, 1, fg.shareCalls)
+				assert.Equal(t, []string{"user:alice@example.com"}, fg.shareWith)
+				assert.Contains(t, log, "Sharing image image with [user:alice@example.com]\n")
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uuid.SetRand(&repeatReader{})
+			defer uuid.SetRand(nil)
+
+			fg := &fakeGCPClient{}
+			mockClient(t, fg)
+
+			uploader, err := gcp.NewUploader("bucket", "image", tc.opts)
+			require.NoError(t, err)
+			var uploadLog bytes.Buffer
+			err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), 0, &uploadLog)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, fg.uploadCalls)
+			assert.Equal(t, []byte("fake-gcp-image"), fg.uploadData)
+			assert.Equal(t, map[string]string{gcp.MetadataKeyImageName: "image"}, fg.uploadMetadata)
+			assert.Equal(t, 1, fg.insertCalls)
+			assert.Equal(t, 1, fg.deleteCalls)
+			tc.check_fn(t, fg, uploadLog.String())
+		})
+	}
+}
+
+func TestUploaderUploadError(t *testing.T) {
+	fg := &fakeGCPClient{uploadErr: fmt.Errorf("fake-upload-err")}
+	mockClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), 0, io.Discard)
+	assert.EqualError(t, err, "fake-upload-err")
+	assert.Equal(t, 0, fg.insertCalls)
+	assert.Equal(t, 0, fg.deleteCalls)
+}
+
+func TestUploaderImportErrorAndDeleteError(t *testing.T) {
+	fg := &fakeGCPClient{
+		insertErr: fmt.Errorf("fake-insert-err"),
+		deleteErr: fmt.Errorf("fake-delete-err"),
+	}
+	mockClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{ShareWith: []string{"user:alice@example.com"}})
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), 0, io.Discard)
+	assert.EqualError(t, err, "fake-insert-err\nfake-delete-err")
+	assert.Equal(t, 1, fg.deleteCalls)
+	assert.Equal(t, 0, fg.shareCalls)
+}
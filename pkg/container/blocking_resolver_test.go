@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"strings"
 	"testing"
 	"time"
 
@@ -243,3 +244,26 @@ func TestBlockingResolverLocalManifest(t *testing.T) {
 	assert.Equal(t, specs[0].LocalName, "localhost/multi-arch:latest")
 	assert.Equal(t, specs[0].Arch.String(), arch.ARCH_AARCH64.String())
 }
+
+func TestVerify(t *testing.T) {
+	registry := testregistry.New()
+	defer registry.Close()
+	repo := registry.AddRepo("library/osbuild")
+	checksum := repo.AddImage(
+		[]testregistry.Blob{testregistry.NewDataBlobFromBase64(testregistry.RootLayer)},
+		[]string{"amd64", "ppc64le"},
+		"image",
+		time.Time{})
+	repo.AddTag(checksum, "latest")
+
+	spec, err := container.NewBlockingResolver("amd64").Resolve(container.SourceSpec{
+		Source:    registry.GetRef("library/osbuild"),
+		TLSVerify: common.ToPtr(false),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, container.Verify(spec))
+
+	spec.Digest = "sha256:" + strings.Repeat("0", 64)
+	err = container.Verify(spec)
+	assert.ErrorContains(t, err, spec.Source+"@"+spec.Digest)
+}
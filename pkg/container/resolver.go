@@ -7,6 +7,10 @@ import (
 	"slices"
 	"strings"
 	"time"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/osbuild/images/pkg/arch"
 )
 
 type resolveResult struct {
@@ -218,3 +222,23 @@ func (r *blockingResolver) ResolveAll(sources map[string][]SourceSpec) (map[stri
 
 	return containers, nil
 }
+
+// Verify checks that the image of the spec can still be fetched by its
+// digest, from the registry or from the local storage.
+func Verify(spec Spec) error {
+	client, err := NewClient(spec.Source)
+	if err != nil {
+		return err
+	}
+	client.SetTLSVerify(spec.TLSVerify)
+	if spec.Arch != arch.ARCH_UNSET {
+		client.SetArchitectureChoice(spec.Arch.String())
+	}
+
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancelTimeout()
+	if _, err := client.GetManifest(ctx, digest.Digest(spec.Digest), spec.LocalStorage); err != nil {
+		return fmt.Errorf("'%s@%s': %w", spec.Source, spec.Digest, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package secureboot defines the image options to sign the EFI binaries of
+// an image for Secure Boot with user-provided keys.
+package secureboot
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Target is an EFI binary of an image that can be signed.
+type Target string
+
+const (
+	// TargetUKI is the unified kernel image in the ESP
+	TargetUKI Target = "uki"
+	// TargetShim is the shim first stage bootloader in the ESP,
+	// including the fallback copy in EFI/BOOT
+	TargetShim Target = "shim"
+	// TargetGrub is the grub2 EFI binary in the ESP
+	TargetGrub Target = "grub"
+	// TargetKernel is the kernel in /boot
+	TargetKernel Target = "kernel"
+)
+
+var targets = []Target{TargetUKI, TargetShim, TargetGrub, TargetKernel}
+
+// ImageOptions specify the key to sign the EFI binaries of an image with
+// and how the certificate of the key is enrolled.
+//
+// The private key is never part of the osbuild manifest: it is in a PKCS#11
+// token on the build host.
+type ImageOptions struct {
+	// PKCS11URI is the URI of the private key in a PKCS#11 token
+	// (RFC 7512)
+	PKCS11URI string `json:"pkcs11_uri"`
+	// Cert is the PEM encoded certificate of the key
+	Cert string `json:"cert"`
+
+	// Sign are the EFI binaries to sign, defaults to the UKI for images
+	// that boot a UKI and to grub and the kernel otherwise, shim is
+	// usually signed by the distribution vendor already
+	Sign []Target `json:"sign,omitempty"`
+
+	// MOKPasswordHash, if set, requests the enrollment of the certificate
+	// as a machine owner key on the first boot of the image. It is the
+	// crypt(3) hash of the password that confirms the enrollment in
+	// MokManager, as printed by "mokutil --generate-hash".
+	MOKPasswordHash string `json:"mok_password_hash,omitempty"`
+	// ESPCert ships the DER encoded certificate in the ESP, e.g. to
+	// enroll it in the firmware db
+	ESPCert bool `json:"esp_cert,omitempty"`
+}
+
+// Validate checks that the PKCS#11 URI is set, that the certificate is PEM
+// encoded, that the MOK password is hashed and that the targets are known.
+func (o *ImageOptions) Validate() error {
+	if o.PKCS11URI == "" {
+		return fmt.Errorf("secure boot: pkcs11_uri is required")
+	}
+	if !strings.HasPrefix(o.PKCS11URI, "pkcs11:") {
+		return fmt.Errorf("secure boot: pkcs11_uri %q is not a PKCS#11 URI", o.PKCS11URI)
+	}
+	if _, err := o.CertDER(); err != nil {
+		return err
+	}
+	if o.MOKPasswordHash != "" && !strings.HasPrefix(o.MOKPasswordHash, "$") {
+		return fmt.Errorf("secure boot: mok_password_hash is not a crypt(3) hash")
+	}
+	for _, target := range o.Sign {
+		if !slices.Contains(targets, target) {
+			return fmt.Errorf("secure boot: unknown sign target %q, must be one of %v", target, targets)
+		}
+	}
+	return nil
+}
+
+// CertDER returns the DER encoded certificate, as used by mokutil and the
+// firmware.
+func (o *ImageOptions) CertDER() ([]byte, error) {
+	block, _ := pem.Decode([]byte(o.Cert))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("secure boot: cert is not a PEM encoded certificate")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, fmt.Errorf("secure boot: cannot parse cert: %w", err)
+	}
+	return block.Bytes, nil
+}
+
+// Targets returns the EFI binaries to sign, uki is true if the image boots
+// a UKI.
+func (o *ImageOptions) Targets(uki bool) []Target {
+	if len(o.Sign) > 0 {
+		return o.Sign
+	}
+	if uki {
+		return []Target{TargetUKI}
+	}
+	return []Target{TargetGrub, TargetKernel}
+}
@@ -0,0 +1,107 @@
+package secureboot_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/customizations/secureboot"
+)
+
+// makeCert returns a PEM encoded self-signed certificate and the DER encoded
+// certificate
+func makeCert(t *testing.T) (string, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fleet db key"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return string(certPEM), der
+}
+
+func TestImageOptionsValidate(t *testing.T) {
+	cert, _ := makeCert(t)
+	uri := "pkcs11:token=fleet;object=db"
+
+	testCases := map[string]struct {
+		options secureboot.ImageOptions
+		expErr  string
+	}{
+		"pkcs11-default-targets": {
+			options: secureboot.ImageOptions{PKCS11URI: uri, Cert: cert},
+		},
+		"pkcs11": {
+			options: secureboot.ImageOptions{PKCS11URI: "pkcs11:token=fleet;object=db", Cert: cert, Sign: []secureboot.Target{secureboot.TargetShim}},
+		},
+		"mok": {
+			options: secureboot.ImageOptions{PKCS11URI: uri, Cert: cert, MOKPasswordHash: "$6$salt$hash"},
+		},
+		"no-key": {
+			options: secureboot.ImageOptions{Cert: cert},
+			expErr:  "secure boot: pkcs11_uri is required",
+		},
+		"bad-uri": {
+			options: secureboot.ImageOptions{PKCS11URI: "token=fleet", Cert: cert},
+			expErr:  `secure boot: pkcs11_uri "token=fleet" is not a PKCS#11 URI`,
+		},
+		"no-cert": {
+			options: secureboot.ImageOptions{PKCS11URI: uri},
+			expErr:  "secure boot: cert is not a PEM encoded certificate",
+		},
+		"bad-cert": {
+			options: secureboot.ImageOptions{PKCS11URI: uri, Cert: "-----BEGIN CERTIFICATE-----\naGVsbG8=\n-----END CERTIFICATE-----\n"},
+			expErr:  "secure boot: cannot parse cert: ",
+		},
+		"plain-mok-password": {
+			options: secureboot.ImageOptions{PKCS11URI: uri, Cert: cert, MOKPasswordHash: "enroll-me"},
+			expErr:  "secure boot: mok_password_hash is not a crypt(3) hash",
+		},
+		"bad-target": {
+			options: secureboot.ImageOptions{PKCS11URI: uri, Cert: cert, Sign: []secureboot.Target{"initrd"}},
+			expErr:  `secure boot: unknown sign target "initrd", must be one of [uki shim grub kernel]`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.options.Validate()
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expErr)
+			}
+		})
+	}
+}
+
+func TestImageOptionsCertDER(t *testing.T) {
+	cert, der := makeCert(t)
+	options := secureboot.ImageOptions{PKCS11URI: "pkcs11:token=fleet;object=db", Cert: cert}
+	certDER, err := options.CertDER()
+	require.NoError(t, err)
+	assert.Equal(t, der, certDER)
+}
+
+func TestImageOptionsTargets(t *testing.T) {
+	options := secureboot.ImageOptions{}
+	assert.Equal(t, []secureboot.Target{secureboot.TargetUKI}, options.Targets(true))
+	assert.Equal(t, []secureboot.Target{secureboot.TargetGrub, secureboot.TargetKernel}, options.Targets(false))
+
+	options.Sign = []secureboot.Target{secureboot.TargetShim, secureboot.TargetGrub}
+	assert.Equal(t, options.Sign, options.Targets(true))
+}
@@ -4,6 +4,8 @@
 // distribution-specific values (platform ID, architecture, and version
 // information) and provides methods for dependency resolution (Depsolve) and
 // retrieving a full list of repository package metadata (FetchMetadata).
+// Metadata queries can read the repositories with the repodata package
+// instead, see Solver.SetNativeMetadataReader().
 //
 // Alternatively, a BaseSolver can be created which represents an un-configured
 // Solver. This type can't be used for depsolving, but can be used to create
@@ -28,6 +30,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/osbuild/images/pkg/repodata"
 	"github.com/osbuild/images/pkg/rhsm"
 	"github.com/osbuild/images/pkg/rpmmd"
 	"github.com/osbuild/images/pkg/sbom"
@@ -45,6 +48,9 @@ type BaseSolver struct {
 	depsolveDNFCmd []string
 
 	resultCache *dnfCache
+
+	// persistentResultCache enables the on-disk cache of depsolve results
+	persistentResultCache bool
 }
 
 // Find the osbuild-depsolve-dnf script. This checks the default location in
@@ -87,6 +93,16 @@ func (s *BaseSolver) SetMaxCacheSize(size uint64) {
 	s.cache.maxSize = size
 }
 
+// SetPersistentResultCache enables or disables the persistent cache for the
+// results of Depsolve(). The results are stored in the cache directory and
+// reused by later solvers, also in other processes, as long as the metadata
+// of the repositories does not change. Depsolves with repositories whose
+// metadata revision cannot be determined, e.g. RHSM repositories, are not
+// cached.
+func (s *BaseSolver) SetPersistentResultCache(enabled bool) {
+	s.persistentResultCache = enabled
+}
+
 // SetDepsolveDNFPath sets the path to the osbuild-depsolve-dnf binary and optionally any command line arguments.
 func (s *BaseSolver) SetDepsolveDNFPath(cmd string, args ...string) {
 	s.depsolveDNFCmd = append([]string{cmd}, args...)
@@ -103,6 +119,12 @@ func (bs *BaseSolver) NewWithConfig(modulePlatformID, releaseVer, arch, distro s
 	s.releaseVer = releaseVer
 	s.distro = distro
 	s.subscriptions, s.subscriptionsErr = rhsm.LoadSystemSubscriptions()
+	// like the depsolver the reader returns the packages of all
+	// architectures of the repositories, e.g. the i686 multilib packages of
+	// x86_64 repositories. The directory name is shorter than a repository
+	// hash so it is not managed by the rpm cache, the reader removes stale
+	// metadata itself.
+	s.metadataReader = repodata.NewReader("", filepath.Join(s.GetCacheDir(), "repodata"))
 	return s
 }
 
@@ -158,6 +180,12 @@ type Solver struct {
 
 	sbomType sbom.StandardType
 
+	// metadataReader reads the repository metadata for FetchMetadata() and
+	// SearchMetadata() without running osbuild-depsolve-dnf if
+	// nativeMetadata is set, see nativeMetadataReader()
+	metadataReader *repodata.Reader
+	nativeMetadata bool
+
 	// Stderr is the stderr output from osbuild-depsolve-dnf, if unset os.Stderr
 	// will be used.
 	//
@@ -208,6 +236,15 @@ func (s *Solver) SetRootDir(path string) {
 	s.rootDir = path
 }
 
+// SetNativeMetadataReader sets whether FetchMetadata() and SearchMetadata()
+// read the metadata of the repositories with the repodata package instead
+// of running osbuild-depsolve-dnf. It is disabled by default. Even when it
+// is enabled, the depsolver is used for repositories that the reader does
+// not handle like dnf, see nativeMetadataReader().
+func (s *Solver) SetNativeMetadataReader(enabled bool) {
+	s.nativeMetadata = enabled
+}
+
 // GetCacheDir returns a distro specific rpm cache directory
 // It ensures that the distro name is below the root cache directory, and if there is
 // a problem it returns the root cache instead of an error.
@@ -269,6 +306,11 @@ func (s *Solver) SetSBOMType(sbomType sbom.StandardType) {
 	s.sbomType = sbomType
 }
 
+// SBOMType returns the SBOM type generated with the depsolve.
+func (s *Solver) SBOMType() sbom.StandardType {
+	return s.sbomType
+}
+
 // Depsolve the list of required package sets with explicit excludes using
 // their associated repositories.  Each package set is depsolved as a separate
 // transactions in a chain.  It returns a list of all packages (with solved
@@ -283,8 +325,15 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 		return nil, err
 	}
 
+	// The depsolver only generates SPDX documents, CycloneDX documents are
+	// generated from the depsolved packages instead.
+	reqSBOMType := sbomType
+	if sbomType == sbom.StandardTypeCycloneDX {
+		reqSBOMType = sbom.StandardTypeNone
+	}
+
 	cfg := s.solverCfg()
-	reqData, err := activeHandler.makeDepsolveRequest(cfg, pkgSets, sbomType)
+	reqData, err := activeHandler.makeDepsolveRequest(cfg, pkgSets, reqSBOMType)
 	if err != nil {
 		return nil, fmt.Errorf("makeDepsolveRequest failed: %w", err)
 	}
@@ -296,9 +345,23 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 	s.cache.locker.RLock()
 	defer s.cache.locker.RUnlock()
 
-	output, err := run(s.depsolveDNFCmd, reqData, s.Stderr)
-	if err != nil {
-		return nil, parseError(output, allRepos, err)
+	var cacheEntry *resultCacheEntry
+	var output []byte
+	if s.persistentResultCache {
+		// results are not cached if the metadata revisions are unknown
+		if key, err := resultCacheKey(reqData, allRepos); err == nil {
+			if cacheEntry, err = lockResultCacheEntry(s.GetCacheDir(), key); err == nil {
+				defer cacheEntry.Unlock()
+				output = cacheEntry.Load()
+			}
+		}
+	}
+	cached := output != nil
+	if !cached {
+		output, err = run(s.depsolveDNFCmd, reqData, s.Stderr)
+		if err != nil {
+			return nil, parseError(output, allRepos, err)
+		}
 	}
 
 	// touch repos to now
@@ -313,6 +376,10 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 	if err != nil {
 		return nil, err
 	}
+	if cacheEntry != nil && !cached {
+		// a failure only means the next depsolve is not cached
+		_ = cacheEntry.Store(output)
+	}
 
 	// Apply RHSM secrets to packages in each transaction as well.
 	for _, transaction := range resultRaw.Transactions {
@@ -320,11 +387,15 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 	}
 
 	var sbomDoc *sbom.Document
-	if sbomType != sbom.StandardTypeNone {
+	switch sbomType {
+	case sbom.StandardTypeNone:
+	case sbom.StandardTypeCycloneDX:
+		sbomDoc, err = sbom.NewCycloneDXDocument(resultRaw.Transactions.AllPackages(), s.distro)
+	default:
 		sbomDoc, err = sbom.NewDocument(sbomType, resultRaw.SBOMRaw)
-		if err != nil {
-			return nil, fmt.Errorf("creating SBOM document failed: %w", err)
-		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating SBOM document failed: %w", err)
 	}
 
 	return &DepsolveResult{
@@ -353,6 +424,10 @@ func (s *Solver) DepsolveAll(pkgSetsMap map[string][]rpmmd.PackageSet) (map[stri
 // FetchMetadata returns the list of all the available packages in repos and
 // their info.
 func (s *Solver) FetchMetadata(repos []rpmmd.RepoConfig) (rpmmd.PackageList, error) {
+	if reader := s.nativeMetadataReader(repos); reader != nil {
+		return reader.FetchMetadata(repos)
+	}
+
 	cfg := s.solverCfg()
 	reqData, err := activeHandler.makeDumpRequest(cfg, repos)
 	if err != nil {
@@ -401,6 +476,10 @@ func (s *Solver) FetchMetadata(repos []rpmmd.RepoConfig) (rpmmd.PackageList, err
 
 // SearchMetadata searches for packages and returns a list of the info for matches.
 func (s *Solver) SearchMetadata(repos []rpmmd.RepoConfig, packages []string) (rpmmd.PackageList, error) {
+	if reader := s.nativeMetadataReader(repos); reader != nil {
+		return reader.SearchMetadata(repos, packages)
+	}
+
 	cfg := s.solverCfg()
 	reqData, err := activeHandler.makeSearchRequest(cfg, repos, packages)
 	if err != nil {
@@ -447,6 +526,33 @@ func (s *Solver) SearchMetadata(repos []rpmmd.RepoConfig, packages []string) (rp
 	return pkgs, nil
 }
 
+// nativeMetadataReader returns the reader for FetchMetadata() and
+// SearchMetadata() if it is enabled and the metadata of the repositories can
+// be read without osbuild-depsolve-dnf, nil otherwise. The depsolver is
+// still needed for RHSM repositories, for URLs with dnf variables, for
+// metalinks, for repositories that are disabled, that need the signature of
+// the metadata checked or that have module hotfixes, and when a proxy or a
+// root dir with additional configuration is set.
+func (s *Solver) nativeMetadataReader(repos []rpmmd.RepoConfig) *repodata.Reader {
+	if !s.nativeMetadata || s.metadataReader == nil || s.rootDir != "" || s.proxy != "" {
+		return nil
+	}
+	isTrue := func(b *bool) bool { return b != nil && *b }
+	for _, repo := range repos {
+		if repo.RHSM || repo.Metalink != "" || isTrue(repo.CheckRepoGPG) || isTrue(repo.ModuleHotfixes) {
+			return nil
+		}
+		if repo.Enabled != nil && !*repo.Enabled {
+			return nil
+		}
+		urls := append([]string{repo.MirrorList}, repo.BaseURLs...)
+		if slices.ContainsFunc(urls, func(u string) bool { return strings.Contains(u, "$") }) {
+			return nil
+		}
+	}
+	return s.metadataReader
+}
+
 // applyRHSMSecrets overrides the Secrets field on packages from RHSM repos.
 // The activeHandler sets "org.osbuild.mtls" for repos with SSLClientKey,
 // but RHSM repos need "org.osbuild.rhsm" instead.
@@ -221,6 +221,12 @@ func TestSolverDepsolve(t *testing.T) {
 			sbomType: sbom.StandardTypeSpdx,
 			err:      false,
 		},
+		"chain-with-cyclonedx-sbom": {
+			packages: [][]string{{"kernel"}, {"vim-minimal", "tmux", "zsh"}},
+			repos:    []rpmmd.RepoConfig{s.RepoConfig},
+			sbomType: sbom.StandardTypeCycloneDX,
+			err:      false,
+		},
 	}
 
 	for _, h := range getTestHandlers() {
@@ -253,7 +259,7 @@ func TestSolverDepsolve(t *testing.T) {
 					// NOTE: The SBOM document is not stable due to UUIDs, so we need to take it from the result
 					if tc.sbomType != sbom.StandardTypeNone {
 						require.NotNil(t, actualResult.SBOM)
-						assert.Equal(sbom.StandardTypeSpdx, actualResult.SBOM.DocType)
+						assert.Equal(tc.sbomType, actualResult.SBOM.DocType)
 						assert.NotEmpty(actualResult.SBOM.Document)
 					} else {
 						assert.Nil(actualResult.SBOM)
@@ -558,6 +564,172 @@ func TestSolverSearchMetadata(t *testing.T) {
 	}
 }
 
+func TestSolverMetadataNativeReader(t *testing.T) {
+	repoServer := rpmrepo.NewTestServer()
+	defer repoServer.Close()
+
+	solver := newTestSolver(t)
+	solver.SetNativeMetadataReader(true)
+	// the depsolver must not be needed
+	solver.depsolveDNFCmd = []string{"/bin/false"}
+
+	res, err := solver.FetchMetadata([]rpmmd.RepoConfig{repoServer.RepoConfig})
+	require.NoError(t, err)
+	require.Equal(t, 1125, len(res))
+	require.Truef(t, sort.SliceIsSorted(res, func(i, j int) bool {
+		return res[i].NVR() < res[j].NVR()
+	}), "packages are not sorted by NVR")
+
+	res, err = solver.SearchMetadata([]rpmmd.RepoConfig{repoServer.RepoConfig}, []string{"zsh*", "bash*"})
+	require.NoError(t, err)
+	var nvrs []string
+	for _, pkg := range res {
+		nvrs = append(nvrs, pkg.NVR())
+	}
+	assert.Equal(t, []string{"bash-5.1.8-2.el9", "bash-completion-2.11-4.el9", "zsh-5.8-7.el9"}, nvrs)
+}
+
+func TestSolverNativeMetadataReaderMatchesDNF(t *testing.T) {
+	requireDNF(t)
+	repoServer := rpmrepo.NewTestServer()
+	defer repoServer.Close()
+	repos := []rpmmd.RepoConfig{repoServer.RepoConfig}
+
+	dnfSolver := newTestSolver(t)
+	nativeSolver := newTestSolver(t)
+	nativeSolver.SetNativeMetadataReader(true)
+	require.NotNil(t, nativeSolver.nativeMetadataReader(repos))
+
+	// the fields of the packages that both read from the primary metadata
+	type pkgInfo struct {
+		Name, Version, Release, Arch string
+		Epoch                        uint
+		Checksum                     rpmmd.Checksum
+		Location                     string
+		DownloadSize, InstallSize    uint64
+		License, SourceRpm, Summary  string
+	}
+	infos := func(pkgs rpmmd.PackageList) []pkgInfo {
+		var res []pkgInfo
+		for _, p := range pkgs {
+			res = append(res, pkgInfo{
+				Name:         p.Name,
+				Version:      p.Version,
+				Release:      p.Release,
+				Arch:         p.Arch,
+				Epoch:        p.Epoch,
+				Checksum:     p.Checksum,
+				Location:     p.Location,
+				DownloadSize: p.DownloadSize,
+				InstallSize:  p.InstallSize,
+				License:      p.License,
+				SourceRpm:    p.SourceRpm,
+				Summary:      p.Summary,
+			})
+		}
+		sort.Slice(res, func(i, j int) bool {
+			return fmt.Sprintf("%+v", res[i]) < fmt.Sprintf("%+v", res[j])
+		})
+		return res
+	}
+
+	dnfPkgs, err := dnfSolver.FetchMetadata(repos)
+	require.NoError(t, err)
+	nativePkgs, err := nativeSolver.FetchMetadata(repos)
+	require.NoError(t, err)
+	assert.Equal(t, infos(dnfPkgs), infos(nativePkgs))
+
+	for _, packages := range [][]string{{"zsh"}, {"zsh*", "bash*"}, {"does-not-exist"}} {
+		dnfPkgs, err := dnfSolver.SearchMetadata(repos, packages)
+		require.NoError(t, err)
+		nativePkgs, err := nativeSolver.SearchMetadata(repos, packages)
+		require.NoError(t, err)
+		assert.Equal(t, infos(dnfPkgs), infos(nativePkgs), packages)
+	}
+}
+
+func TestSolverNativeMetadataReader(t *testing.T) {
+	repo := rpmmd.RepoConfig{Id: "baseos", BaseURLs: []string{"https://example.org/baseos"}}
+
+	testCases := []struct {
+		name   string
+		modify func(*Solver, *rpmmd.RepoConfig)
+		native bool
+	}{
+		{
+			name:   "plain",
+			modify: func(*Solver, *rpmmd.RepoConfig) {},
+			native: true,
+		},
+		{
+			name:   "disabled-reader",
+			modify: func(s *Solver, _ *rpmmd.RepoConfig) { s.SetNativeMetadataReader(false) },
+		},
+		{
+			name:   "rhsm",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.RHSM = true },
+		},
+		{
+			name:   "check-repo-gpg",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.CheckRepoGPG = common.ToPtr(true) },
+		},
+		{
+			name:   "no-check-repo-gpg",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.CheckRepoGPG = common.ToPtr(false) },
+			native: true,
+		},
+		{
+			name:   "metalink",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.BaseURLs, r.Metalink = nil, "https://example.org/metalink" },
+		},
+		{
+			name:   "disabled-repo",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.Enabled = common.ToPtr(false) },
+		},
+		{
+			name:   "enabled-repo",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.Enabled = common.ToPtr(true) },
+			native: true,
+		},
+		{
+			name:   "module-hotfixes",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.ModuleHotfixes = common.ToPtr(true) },
+		},
+		{
+			name:   "dnf-vars",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) { r.BaseURLs = []string{"https://example.org/$basearch/baseos"} },
+		},
+		{
+			name: "metalink-vars",
+			modify: func(_ *Solver, r *rpmmd.RepoConfig) {
+				r.BaseURLs, r.Metalink = nil, "https://example.org/metalink?arch=$basearch"
+			},
+		},
+		{
+			name:   "proxy",
+			modify: func(s *Solver, _ *rpmmd.RepoConfig) { require.NoError(t, s.SetProxy("http://proxy.example.org:3128")) },
+		},
+		{
+			name:   "root-dir",
+			modify: func(s *Solver, _ *rpmmd.RepoConfig) { s.SetRootDir("/some/root") },
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			solver := newTestSolver(t)
+			solver.SetNativeMetadataReader(true)
+			r := repo
+			tc.modify(solver, &r)
+			reader := solver.nativeMetadataReader([]rpmmd.RepoConfig{r})
+			if tc.native {
+				assert.NotNil(t, reader)
+			} else {
+				assert.Nil(t, reader)
+			}
+		})
+	}
+}
+
 func TestValidatePackageSetRepoChain(t *testing.T) {
 	baseOS := rpmmd.RepoConfig{
 		Name:     "baseos",
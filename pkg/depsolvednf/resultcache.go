@@ -0,0 +1,103 @@
+package depsolvednf
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/osbuild/images/pkg/repodata"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// The persistent result cache stores the output of osbuild-depsolve-dnf for
+// depsolve requests in the distro specific cache directory of the solver.
+// Entries are keyed by the hash of the request and the checksums of the
+// current repomd.xml of all repositories, so they are not used anymore when
+// the metadata of a repository changes.
+//
+// The entry names start with the 64 characters of the key, like the
+// repository caches, so they are managed by CleanCache() in the same way.
+// Concurrent processes lock the entry while depsolving, a process waiting
+// for the lock uses the result of the first one.
+
+const (
+	resultCacheSuffix = ".depsolve.json"
+	resultLockSuffix  = ".depsolve.lock"
+)
+
+// resultCacheKey returns the key of the result of a request, it fails if the
+// revision of one of the repositories cannot be determined.
+func resultCacheKey(reqData []byte, repos []rpmmd.RepoConfig) (string, error) {
+	h := sha256.New()
+	h.Write(reqData)
+	for _, repo := range repos {
+		revision, err := repodata.Revision(repo)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "\n%s %s", repo.Hash(), revision)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// resultCacheEntry is a locked entry of the persistent result cache.
+type resultCacheEntry struct {
+	path string
+	lock *os.File
+}
+
+// lockResultCacheEntry locks the entry of the given key, it blocks until
+// other processes are done with it.
+func lockResultCacheEntry(dir, key string) (*resultCacheEntry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, key+resultLockSuffix), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return &resultCacheEntry{path: filepath.Join(dir, key+resultCacheSuffix), lock: lock}, nil
+}
+
+// Load returns the cached depsolver output or nil.
+func (e *resultCacheEntry) Load() []byte {
+	data, err := os.ReadFile(e.path)
+	if err != nil || !json.Valid(data) {
+		return nil
+	}
+	now := time.Now().Local()
+	_ = os.Chtimes(e.path, now, now)
+	return data
+}
+
+// Store writes the depsolver output to the entry.
+func (e *resultCacheEntry) Store(output []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(e.path), ".depsolve-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(output); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), e.path)
+}
+
+// Unlock releases the entry for other processes.
+func (e *resultCacheEntry) Unlock() {
+	_ = unix.Flock(int(e.lock.Fd()), unix.LOCK_UN)
+	e.lock.Close()
+}
@@ -0,0 +1,94 @@
+package depsolvednf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
+)
+
+// writeRepomd writes repodata/repomd.xml in dir
+func writeRepomd(t *testing.T, dir, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "repodata"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "repodata", "repomd.xml"), []byte(content), 0o644))
+}
+
+// countingSolver returns a fake osbuild-depsolve-dnf that counts its runs
+// in the returned file.
+func countingSolver(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "runs")
+	script := fmt.Sprintf(`#!/bin/sh -e
+cat - > /dev/null
+echo run >> %q
+echo '{"solver": "dnf5"}'
+`, counter)
+	solverPath := filepath.Join(dir, "osbuild-depsolve-dnf")
+	require.NoError(t, os.WriteFile(solverPath, []byte(script), 0o755)) //nolint:gosec
+	return solverPath, counter
+}
+
+func countRuns(t *testing.T, counter string) int {
+	t.Helper()
+	data, err := os.ReadFile(counter)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return strings.Count(string(data), "run\n")
+}
+
+func TestSolverPersistentResultCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoDir := t.TempDir()
+	writeRepomd(t, repoDir, "<repomd><revision>1</revision></repomd>")
+	solverPath, counter := countingSolver(t)
+
+	pkgSets := []rpmmd.PackageSet{{
+		Include:      []string{"bash"},
+		Repositories: []rpmmd.RepoConfig{{Id: "test", BaseURLs: []string{"file://" + repoDir}}},
+	}}
+	depsolve := func(persistent bool) {
+		solver := NewSolver("platform:f42", "42", "x86_64", "fedora-42", cacheDir)
+		solver.depsolveDNFCmd = []string{solverPath}
+		solver.SetPersistentResultCache(persistent)
+		res, err := solver.Depsolve(pkgSets, sbom.StandardTypeNone)
+		require.NoError(t, err)
+		assert.Equal(t, "dnf5", res.Solver)
+	}
+
+	// without the persistent cache every depsolve runs the solver
+	depsolve(false)
+	depsolve(false)
+	assert.Equal(t, 2, countRuns(t, counter))
+
+	depsolve(true)
+	assert.Equal(t, 3, countRuns(t, counter))
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*", "*"+resultCacheSuffix))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	depsolve(true)
+	assert.Equal(t, 3, countRuns(t, counter))
+
+	// new metadata invalidates the result
+	writeRepomd(t, repoDir, "<repomd><revision>2</revision></repomd>")
+	depsolve(true)
+	assert.Equal(t, 4, countRuns(t, counter))
+	depsolve(true)
+	assert.Equal(t, 4, countRuns(t, counter))
+
+	// results are not cached when the metadata revision is unknown
+	require.NoError(t, os.RemoveAll(filepath.Join(repoDir, "repodata")))
+	depsolve(true)
+	depsolve(true)
+	assert.Equal(t, 6, countRuns(t, counter))
+}
@@ -53,6 +53,7 @@ const (
 	FilesystemDataGUID     = "0FC63DAF-8483-4772-8E79-3D69D8477DE4" // SD_GPT_LINUX_GENERIC
 	EFISystemPartitionGUID = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B" // SD_GPT_ESP
 	LVMPartitionGUID       = "E6D6D379-F507-44C2-A23C-238F2A3DF928"
+	RAIDPartitionGUID      = "A19D880F-05FC-4D3B-A006-743F0F84911E"
 	PRePartitionGUID       = "9E1A2D38-C612-4316-AA26-8B49521E5A8B"
 	SwapPartitionGUID      = "0657FD6D-A4AB-43C4-84E5-0933C84B4F4F" // SD_GPT_SWAP
 	XBootLDRPartitionGUID  = "BC13C2FF-59E6-4262-A352-B275FD6F7172" // SD_GPT_XBOOTLDR
@@ -61,11 +62,25 @@ const (
 	RootPartitionAarch64GUID = "B921B045-1DF0-41C3-AF44-4C6F280D3FAE" // SD_GPT_ROOT_ARM64
 	RootPartitionPpc64leGUID = "C31C45E6-3F39-412E-80FB-4809C4980599" // SD_GPT_ROOT_PPC64_LE
 	RootPartitionS390xGUID   = "5EEAD9A9-FE09-4A1E-A1D7-520D00531306" // SD_GPT_ROOT_S390X
+	RootPartitionRiscv64GUID = "72EC70A6-CF74-40E6-BD49-4BDA08E8F224" // SD_GPT_ROOT_RISCV64
 
 	UsrPartitionX86_64GUID  = "8484680C-9521-48C6-9C11-B0720656F69E" // SD_GPT_USR_X86_64
 	UsrPartitionAarch64GUID = "B0E01050-EE5F-4390-949A-9101B17104E9" // SD_GPT_USR_ARM64
 	UsrPartitionPpc64leGUID = "15BB03AF-77E7-4D4A-B12B-C0D084F7491C" // SD_GPT_USR_PPC64_LE
 	UsrPartitionS390xGUID   = "8A4F5770-50AA-4ED3-874A-99B710DB6FEA" // SD_GPT_USR_S390X
+	UsrPartitionRiscv64GUID = "BEAEC34B-8442-439B-A40B-984381ED097D" // SD_GPT_USR_RISCV64
+
+	RootVerityPartitionX86_64GUID  = "2C7357ED-EBD2-46D9-AEC1-23D437EC2BF5" // SD_GPT_ROOT_X86_64_VERITY
+	RootVerityPartitionAarch64GUID = "DF3300CE-D69F-4C92-978C-9BFB0F38D820" // SD_GPT_ROOT_ARM64_VERITY
+	RootVerityPartitionPpc64leGUID = "906BD944-4589-4AAE-A4E4-DD983917446A" // SD_GPT_ROOT_PPC64_LE_VERITY
+	RootVerityPartitionS390xGUID   = "B325BFBE-C7BE-4AB8-8357-139E652D2F6B" // SD_GPT_ROOT_S390X_VERITY
+	RootVerityPartitionRiscv64GUID = "B6ED5582-440B-4209-B8DA-5FF7C419EA3D" // SD_GPT_ROOT_RISCV64_VERITY
+
+	UsrVerityPartitionX86_64GUID  = "77FF5F63-E7B6-4633-ACF4-1565B864C0E6" // SD_GPT_USR_X86_64_VERITY
+	UsrVerityPartitionAarch64GUID = "6E11A4E7-FBCA-4DED-B9E9-E1A512BB664E" // SD_GPT_USR_ARM64_VERITY
+	UsrVerityPartitionPpc64leGUID = "EE2B9983-21E8-4153-86D9-B6901A54D1CE" // SD_GPT_USR_PPC64_LE_VERITY
+	UsrVerityPartitionS390xGUID   = "31741CC4-1A2A-4111-A581-E00B447D2D06" // SD_GPT_USR_S390X_VERITY
+	UsrVerityPartitionRiscv64GUID = "8F1056BE-9B05-47C4-81D6-BE53128E5B54" // SD_GPT_USR_RISCV64_VERITY
 
 	// Partition type IDs for DOS disks
 
@@ -84,6 +99,9 @@ const (
 	// Partition type ID for LVM on dos
 	LVMPartitionDOSID = "8e"
 
+	// Partition type ID for Linux RAID autodetect on dos
+	RAIDPartitionDOSID = "fd"
+
 	// Partition type ID for ESP on dos
 	EFISystemPartitionDOSID = "ef"
 
@@ -124,6 +142,8 @@ func getPartitionTypeIDfor(ptType PartitionTableType, partTypeName string, archi
 			return EFISystemPartitionDOSID, nil
 		case "lvm":
 			return LVMPartitionDOSID, nil
+		case "raid":
+			return RAIDPartitionDOSID, nil
 		case "ppc_prep":
 			return PRepPartitionDOSID, nil
 		case "swap":
@@ -143,6 +163,8 @@ func getPartitionTypeIDfor(ptType PartitionTableType, partTypeName string, archi
 			return EFISystemPartitionGUID, nil
 		case "lvm":
 			return LVMPartitionGUID, nil
+		case "raid":
+			return RAIDPartitionGUID, nil
 		case "ppc_prep":
 			return PRePartitionGUID, nil
 		case "swap":
@@ -157,6 +179,8 @@ func getPartitionTypeIDfor(ptType PartitionTableType, partTypeName string, archi
 				return RootPartitionPpc64leGUID, nil
 			case arch.ARCH_S390X:
 				return RootPartitionS390xGUID, nil
+			case arch.ARCH_RISCV64:
+				return RootPartitionRiscv64GUID, nil
 			case arch.ARCH_UNSET:
 				return "", fmt.Errorf("architecture must be specified for selecting GUID for %q partition", partTypeName)
 			default:
@@ -172,6 +196,42 @@ func getPartitionTypeIDfor(ptType PartitionTableType, partTypeName string, archi
 				return UsrPartitionPpc64leGUID, nil
 			case arch.ARCH_S390X:
 				return UsrPartitionS390xGUID, nil
+			case arch.ARCH_RISCV64:
+				return UsrPartitionRiscv64GUID, nil
+			case arch.ARCH_UNSET:
+				return "", fmt.Errorf("architecture must be specified for selecting GUID for %q partition", partTypeName)
+			default:
+				return "", fmt.Errorf("unknown or unsupported architecture enum value: %d", architecture)
+			}
+		case "root-verity":
+			switch architecture {
+			case arch.ARCH_X86_64:
+				return RootVerityPartitionX86_64GUID, nil
+			case arch.ARCH_AARCH64:
+				return RootVerityPartitionAarch64GUID, nil
+			case arch.ARCH_PPC64LE:
+				return RootVerityPartitionPpc64leGUID, nil
+			case arch.ARCH_S390X:
+				return RootVerityPartitionS390xGUID, nil
+			case arch.ARCH_RISCV64:
+				return RootVerityPartitionRiscv64GUID, nil
+			case arch.ARCH_UNSET:
+				return "", fmt.Errorf("architecture must be specified for selecting GUID for %q partition", partTypeName)
+			default:
+				return "", fmt.Errorf("unknown or unsupported architecture enum value: %d", architecture)
+			}
+		case "usr-verity":
+			switch architecture {
+			case arch.ARCH_X86_64:
+				return UsrVerityPartitionX86_64GUID, nil
+			case arch.ARCH_AARCH64:
+				return UsrVerityPartitionAarch64GUID, nil
+			case arch.ARCH_PPC64LE:
+				return UsrVerityPartitionPpc64leGUID, nil
+			case arch.ARCH_S390X:
+				return UsrVerityPartitionS390xGUID, nil
+			case arch.ARCH_RISCV64:
+				return UsrVerityPartitionRiscv64GUID, nil
 			case arch.ARCH_UNSET:
 				return "", fmt.Errorf("architecture must be specified for selecting GUID for %q partition", partTypeName)
 			default:
@@ -197,6 +257,11 @@ const (
 	FS_EXT4
 	FS_XFS
 	FS_BTRFS
+	FS_EXT2
+	FS_EXT3
+	FS_F2FS
+	FS_EROFS
+	FS_SQUASHFS
 )
 
 func (f FSType) String() string {
@@ -211,11 +276,33 @@ func (f FSType) String() string {
 		return "xfs"
 	case FS_BTRFS:
 		return "btrfs"
+	case FS_EXT2:
+		return "ext2"
+	case FS_EXT3:
+		return "ext3"
+	case FS_F2FS:
+		return "f2fs"
+	case FS_EROFS:
+		return "erofs"
+	case FS_SQUASHFS:
+		return "squashfs"
 	default:
 		panic(fmt.Sprintf("unknown or unsupported filesystem type with enum value %d", f))
 	}
 }
 
+// ReadOnly returns true for filesystem types that cannot be modified after
+// they are created. Filesystems of these types are not created empty but
+// generated from the content of the tree under their mountpoint.
+func (f FSType) ReadOnly() bool {
+	switch f {
+	case FS_EROFS, FS_SQUASHFS:
+		return true
+	default:
+		return false
+	}
+}
+
 func (f *FSType) UnmarshalJSON(data []byte) error {
 	var s string
 	if err := json.Unmarshal(data, &s); err != nil {
@@ -246,6 +333,16 @@ func NewFSType(s string) (FSType, error) {
 		return FS_XFS, nil
 	case "btrfs":
 		return FS_BTRFS, nil
+	case "ext2":
+		return FS_EXT2, nil
+	case "ext3":
+		return FS_EXT3, nil
+	case "f2fs":
+		return FS_F2FS, nil
+	case "erofs":
+		return FS_EROFS, nil
+	case "squashfs":
+		return FS_SQUASHFS, nil
 	default:
 		return FS_NONE, fmt.Errorf("unknown or unsupported filesystem type name: %s", s)
 	}
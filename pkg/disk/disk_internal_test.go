@@ -5,6 +5,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
 )
 
 func TestGenUniqueString(t *testing.T) {
@@ -106,3 +109,21 @@ func TestGenUniqueStringManyCollisions(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPartitionTypeIDforRISCV64(t *testing.T) {
+	for partTypeName, expected := range map[string]string{
+		"root":        RootPartitionRiscv64GUID,
+		"usr":         UsrPartitionRiscv64GUID,
+		"root-verity": RootVerityPartitionRiscv64GUID,
+		"usr-verity":  UsrVerityPartitionRiscv64GUID,
+		"esp":         EFISystemPartitionGUID,
+	} {
+		typeID, err := getPartitionTypeIDfor(PT_GPT, partTypeName, arch.ARCH_RISCV64)
+		require.NoError(t, err)
+		assert.Equal(t, expected, typeID, partTypeName)
+	}
+
+	typeID, err := getPartitionTypeIDfor(PT_DOS, "root", arch.ARCH_RISCV64)
+	require.NoError(t, err)
+	assert.Equal(t, FilesystemLinuxDOSID, typeID)
+}
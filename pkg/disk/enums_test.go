@@ -80,11 +80,16 @@ func TestEnumPartitionTableTypeYAML(t *testing.T) {
 
 func TestEnumFSType(t *testing.T) {
 	enumMap := map[string]disk.FSType{
-		"":      disk.FS_NONE,
-		"vfat":  disk.FS_VFAT,
-		"ext4":  disk.FS_EXT4,
-		"xfs":   disk.FS_XFS,
-		"btrfs": disk.FS_BTRFS,
+		"":         disk.FS_NONE,
+		"vfat":     disk.FS_VFAT,
+		"ext4":     disk.FS_EXT4,
+		"xfs":      disk.FS_XFS,
+		"btrfs":    disk.FS_BTRFS,
+		"ext2":     disk.FS_EXT2,
+		"ext3":     disk.FS_EXT3,
+		"f2fs":     disk.FS_F2FS,
+		"erofs":    disk.FS_EROFS,
+		"squashfs": disk.FS_SQUASHFS,
 	}
 
 	assert := assert.New(t)
@@ -99,10 +104,28 @@ func TestEnumFSType(t *testing.T) {
 	}
 
 	// error test: bad value
-	badFst := disk.FSType(5)
-	assert.PanicsWithValue("unknown or unsupported filesystem type with enum value 5", func() { _ = badFst.String() })
+	badFst := disk.FSType(10)
+	assert.PanicsWithValue("unknown or unsupported filesystem type with enum value 10", func() { _ = badFst.String() })
 
 	// error test: bad name
 	_, err := disk.NewFSType("not-a-type")
 	assert.EqualError(err, "unknown or unsupported filesystem type name: not-a-type")
 }
+
+func TestFSTypeReadOnly(t *testing.T) {
+	readOnly := map[disk.FSType]bool{
+		disk.FS_NONE:     false,
+		disk.FS_VFAT:     false,
+		disk.FS_EXT4:     false,
+		disk.FS_XFS:      false,
+		disk.FS_BTRFS:    false,
+		disk.FS_EXT2:     false,
+		disk.FS_EXT3:     false,
+		disk.FS_F2FS:     false,
+		disk.FS_EROFS:    true,
+		disk.FS_SQUASHFS: true,
+	}
+	for fst, expected := range readOnly {
+		assert.Equal(t, expected, fst.ReadOnly(), fst.String())
+	}
+}
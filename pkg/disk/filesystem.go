@@ -1,8 +1,11 @@
 package disk
 
 import (
+	"fmt"
 	"math/rand"
 	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -104,14 +107,40 @@ func (fs *Filesystem) GetFSTabOptions() (FSTabOptions, error) {
 	if fs == nil {
 		return FSTabOptions{}, nil
 	}
-	return FSTabOptions{
+	options := FSTabOptions{
 		MntOps: fs.FSTabOptions,
 		Freq:   fs.FSTabFreq,
 		PassNo: fs.FSTabPassNo,
-	}, nil
+	}
+	if fs.ReadOnly() && !options.ReadOnly() {
+		// read-only filesystems must always be mounted with "ro"
+		switch {
+		case options.MntOps == "":
+			options.MntOps = "ro"
+		case slices.Contains(strings.Split(options.MntOps, ","), "rw"):
+			return FSTabOptions{}, fmt.Errorf("%s filesystem on %q cannot be mounted read-write", fs.Type, fs.Mountpoint)
+		default:
+			options.MntOps += ",ro"
+		}
+	}
+	return options, nil
+}
+
+// ReadOnly returns true if the filesystem type is read-only, see
+// [FSType.ReadOnly].
+func (fs *Filesystem) ReadOnly() bool {
+	if fs == nil {
+		return false
+	}
+	fsType, err := NewFSType(fs.Type)
+	return err == nil && fsType.ReadOnly()
 }
 
 func (fs *Filesystem) GenUUID(rng *rand.Rand) {
+	if fs.Type == "squashfs" {
+		// squashfs has neither uuids nor labels
+		return
+	}
 	if fs.Type == "vfat" && fs.UUID == "" {
 		// vfat has no uuids, it has "serial numbers" (volume IDs)
 		fs.UUID = NewVolIDFromRand(rng)
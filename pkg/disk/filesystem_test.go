@@ -1,6 +1,7 @@
 package disk_test
 
 import (
+	"math/rand"
 	"reflect"
 	"testing"
 
@@ -29,3 +30,42 @@ func TestMkfsOptionsClone(t *testing.T) {
 	assert.False(t, reflect.ValueOf(orig.Geometry).Pointer() == reflect.ValueOf(clone.Geometry).Pointer())
 
 }
+
+func TestFilesystemReadOnlyFSTabOptions(t *testing.T) {
+	testCases := []struct {
+		fs       disk.Filesystem
+		expected string
+		err      string
+	}{
+		{disk.Filesystem{Type: "ext4", FSTabOptions: "defaults"}, "defaults", ""},
+		{disk.Filesystem{Type: "erofs", FSTabOptions: "defaults"}, "defaults,ro", ""},
+		{disk.Filesystem{Type: "erofs"}, "ro", ""},
+		{disk.Filesystem{Type: "squashfs", FSTabOptions: "ro,noatime"}, "ro,noatime", ""},
+		{disk.Filesystem{Type: "erofs", Mountpoint: "/usr", FSTabOptions: "rw"}, "", `erofs filesystem on "/usr" cannot be mounted read-write`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fs.Type+"/"+tc.fs.FSTabOptions, func(t *testing.T) {
+			opts, err := tc.fs.GetFSTabOptions()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, opts.MntOps)
+		})
+	}
+}
+
+func TestFilesystemGenUUIDSquashfs(t *testing.T) {
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+
+	fs := disk.Filesystem{Type: "squashfs"}
+	fs.GenUUID(rng)
+	assert.Equal(t, "", fs.UUID)
+
+	fs = disk.Filesystem{Type: "erofs"}
+	fs.GenUUID(rng)
+	assert.NotEqual(t, "", fs.UUID)
+}
@@ -0,0 +1,365 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// LayoutEntry describes one entity of a partition table in the flattened
+// layout returned by [PartitionTable.Layout].
+type LayoutEntry struct {
+	// ID identifies the entity by what it holds rather than by its
+	// position, e.g. "mnt:boot-efi" for the ESP or
+	// "vg:rootvg/luks/vg:rootvg/lv:rootlv" for a logical volume on an
+	// encrypted partition, so that IDs stay stable when partitions are
+	// added or removed. IDs are used to match entities when diffing
+	// layouts.
+	ID string `json:"id"`
+
+	// Depth is the nesting level of the entity, 0 for the partition table
+	// itself and 1 for partitions.
+	Depth int `json:"depth"`
+
+	// Start and End are the offsets in bytes, only set for partitions.
+	Start uint64 `json:"start,omitempty"`
+	End   uint64 `json:"end,omitempty"`
+
+	Size datasizes.Size `json:"size,omitempty"`
+
+	// Type is the partition table type, the partition type (a GUID or a
+	// DOS ID) or the kind of volume, e.g. "luks" or "lvm-lv".
+	Type string `json:"type,omitempty"`
+
+	// FSType is the filesystem type (or "swap") of the payload.
+	FSType string `json:"fs_type,omitempty"`
+
+	Mountpoint string `json:"mountpoint,omitempty"`
+}
+
+// Layout flattens the partition table into a list of entries, one for the
+// table itself, one for each partition and one for each volume nested in
+// the partitions (LUKS, LVM, btrfs subvolumes, ...) in depth-first order.
+// Filesystems and swap areas are not separate entries, they are merged into
+// the entry of the volume that holds them.
+func (pt *PartitionTable) Layout() []LayoutEntry {
+	entries := []LayoutEntry{
+		{
+			ID:   "pt",
+			Size: pt.Size,
+			Type: pt.Type.String(),
+		},
+	}
+	seen := make(map[string]int, len(pt.Partitions))
+	for _, part := range pt.Partitions {
+		id := partitionLayoutID(&part)
+		seen[id]++
+		if n := seen[id]; n > 1 {
+			id = fmt.Sprintf("%s#%d", id, n)
+		}
+		entry := LayoutEntry{
+			ID:    id,
+			Depth: 1,
+			Start: part.Start,
+			End:   part.Start + part.Size.Uint64(),
+			Size:  part.Size,
+			Type:  part.Type,
+		}
+		entries = appendLayoutEntries(entries, entry, part.Payload)
+	}
+	return entries
+}
+
+// partitionLayoutID returns the ID of the partition in the layout. It is
+// derived from the partition label or, if there is none, from the payload:
+// the mountpoint of a filesystem, the name of a volume group, md raid array
+// or verity device, ... Partitions without a payload, like the BIOS boot
+// partition, are identified by their type.
+func partitionLayoutID(part *Partition) string {
+	if part.Label != "" {
+		return "label:" + part.Label
+	}
+	return payloadLayoutID(part.Payload, part.Type)
+}
+
+func payloadLayoutID(payload Entity, partType string) string {
+	switch payload := payload.(type) {
+	case *Filesystem:
+		return "mnt:" + layoutMountpointName(payload.Mountpoint)
+	case *Btrfs:
+		if payload.Mountpoint != "" {
+			return "mnt:" + layoutMountpointName(payload.Mountpoint)
+		}
+		if payload.Label != "" {
+			return "btrfs:" + payload.Label
+		}
+		for _, subvol := range payload.Subvolumes {
+			if subvol.Mountpoint != "" {
+				return "mnt:" + layoutMountpointName(subvol.Mountpoint)
+			}
+		}
+		return "btrfs"
+	case *Swap:
+		if payload.Label != "" {
+			return "swap:" + payload.Label
+		}
+		return "swap"
+	case *LUKSContainer:
+		return payloadLayoutID(payload.Payload, partType)
+	case *Verity:
+		return "verity:" + payload.Name
+	case *VerityHash:
+		return "verity-hash:" + payload.Name
+	case *MDRaid:
+		return "md:" + payload.Name
+	case *MDRaidMember:
+		return fmt.Sprintf("md:%s-member%d", payload.Name, payload.Member)
+	case *LVMVolumeGroup:
+		return "vg:" + payload.Name
+	case *Raw:
+		return "raw:" + layoutMountpointName(payload.SourcePath)
+	default:
+		return "type:" + strings.ToLower(partType)
+	}
+}
+
+// layoutMountpointName turns a path into a single ID component, e.g.
+// "boot-efi" for "/boot/efi", as "/" separates the components of IDs.
+func layoutMountpointName(mountpoint string) string {
+	name := strings.ReplaceAll(strings.Trim(mountpoint, "/"), "/", "-")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
+
+// appendLayoutEntries appends the entry of the volume holding the payload
+// and the entries of all volumes nested in the payload.
+func appendLayoutEntries(entries []LayoutEntry, entry LayoutEntry, payload Entity) []LayoutEntry {
+	child := func(id, typ string) LayoutEntry {
+		return LayoutEntry{
+			ID:    entry.ID + "/" + id,
+			Depth: entry.Depth + 1,
+			Type:  typ,
+		}
+	}
+
+	switch payload := payload.(type) {
+	case nil:
+		return append(entries, entry)
+	case *Filesystem:
+		entry.FSType = payload.Type
+		entry.Mountpoint = payload.Mountpoint
+		return append(entries, entry)
+	case *Swap:
+		entry.FSType = "swap"
+		return append(entries, entry)
+	case *Btrfs:
+		entry.FSType = "btrfs"
+		entry.Mountpoint = payload.Mountpoint
+		entries = append(entries, entry)
+		for _, subvol := range payload.Subvolumes {
+			svEntry := child("subvol:"+subvol.Name, "btrfs-subvolume")
+			svEntry.Size = subvol.Size
+			svEntry.Mountpoint = subvol.Mountpoint
+			entries = append(entries, svEntry)
+		}
+		return entries
+	case *LUKSContainer:
+		entries = append(entries, entry)
+		return appendLayoutEntries(entries, child("luks", "luks"), payload.Payload)
+	case *Verity:
+		entries = append(entries, entry)
+		return appendLayoutEntries(entries, child("verity:"+payload.Name, "verity"), payload.Payload)
+	case *MDRaid:
+		entries = append(entries, entry)
+		return appendLayoutEntries(entries, child("md:"+payload.Name, payload.GetLevel()), payload.Payload)
+	case *LVMVolumeGroup:
+		entries = append(entries, entry)
+		vgEntry := child("vg:"+payload.Name, "lvm-vg")
+		entries = append(entries, vgEntry)
+		for _, lv := range payload.LogicalVolumes {
+			lvEntry := LayoutEntry{
+				ID:    vgEntry.ID + "/lv:" + lv.Name,
+				Depth: vgEntry.Depth + 1,
+				Size:  lv.Size,
+				Type:  "lvm-lv",
+			}
+			entries = appendLayoutEntries(entries, lvEntry, lv.Payload)
+		}
+		return entries
+	default:
+		// raw payloads, verity hash trees, ...
+		if pe, ok := payload.(PayloadEntity); ok {
+			entry.FSType = pe.EntityName()
+		}
+		return append(entries, entry)
+	}
+}
+
+// RenderLayout writes the layout of the partition table as a table with one
+// line per entry, nested entries are indented.
+func (pt *PartitionTable) RenderLayout(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTART\tEND\tSIZE\tTYPE\tFS\tMOUNTPOINT")
+	for _, entry := range pt.Layout() {
+		fmt.Fprintf(tw, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			strings.Repeat("  ", entry.Depth),
+			entry.ID[strings.LastIndex(entry.ID, "/")+1:],
+			formatLayoutOffset(entry, entry.Start),
+			formatLayoutOffset(entry, entry.End),
+			formatLayoutSize(entry.Size),
+			entry.Type,
+			entry.FSType,
+			entry.Mountpoint,
+		)
+	}
+	return tw.Flush()
+}
+
+// formatLayoutOffset returns the offset as a string, offsets are only
+// meaningful for partitions.
+func formatLayoutOffset(entry LayoutEntry, offset uint64) string {
+	if entry.Depth != 1 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", offset)
+}
+
+// formatLayoutSize returns the size in the largest binary unit that divides
+// it, as that is how sizes are given in the partition table definitions.
+func formatLayoutSize(size datasizes.Size) string {
+	if size == 0 {
+		return "-"
+	}
+	for _, unit := range []struct {
+		size datasizes.Size
+		name string
+	}{
+		{datasizes.GiB, "GiB"},
+		{datasizes.MiB, "MiB"},
+		{datasizes.KiB, "KiB"},
+	} {
+		if size%unit.size == 0 {
+			return fmt.Sprintf("%d %s", size/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// LayoutChange is a difference between two partition table layouts, see
+// [DiffLayout].
+type LayoutChange struct {
+	ID string `json:"id"`
+
+	// Old is nil if the entry was added.
+	Old *LayoutEntry `json:"old,omitempty"`
+	// New is nil if the entry was removed.
+	New *LayoutEntry `json:"new,omitempty"`
+
+	// Fields are the names of the changed fields of entries that exist in
+	// both layouts.
+	Fields []string `json:"fields,omitempty"`
+}
+
+func (c LayoutChange) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("+ %s: %s", c.ID, formatLayoutEntry(c.New))
+	case c.New == nil:
+		return fmt.Sprintf("- %s: %s", c.ID, formatLayoutEntry(c.Old))
+	}
+
+	oldFields, newFields := layoutFields(c.Old), layoutFields(c.New)
+	var changes []string
+	for _, field := range c.Fields {
+		changes = append(changes, fmt.Sprintf("%s %s -> %s", field, oldFields[field], newFields[field]))
+	}
+	return fmt.Sprintf("~ %s: %s", c.ID, strings.Join(changes, ", "))
+}
+
+// layoutFieldNames are the names of the fields compared by DiffLayout, in
+// the order they are reported.
+var layoutFieldNames = []string{"start", "end", "size", "type", "fs", "mountpoint"}
+
+func layoutFields(entry *LayoutEntry) map[string]string {
+	return map[string]string{
+		"start":      formatLayoutOffset(*entry, entry.Start),
+		"end":        formatLayoutOffset(*entry, entry.End),
+		"size":       formatLayoutSize(entry.Size),
+		"type":       entry.Type,
+		"fs":         entry.FSType,
+		"mountpoint": entry.Mountpoint,
+	}
+}
+
+func formatLayoutEntry(entry *LayoutEntry) string {
+	fields := layoutFields(entry)
+	var parts []string
+	for _, field := range layoutFieldNames {
+		if value := fields[field]; value != "" && value != "-" {
+			parts = append(parts, fmt.Sprintf("%s %s", field, value))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DiffLayout computes the structural differences between two partition table
+// layouts, see [PartitionTable.Layout]. Entries are matched by their ID, which
+// is derived from the contents of the entities, so inserting a partition only
+// reports the new partition and the moved offsets. The changes are ordered like the
+// entries of the new layout, with removed entries at the position they had
+// in the old layout.
+func DiffLayout(oldEntries, newEntries []LayoutEntry) []LayoutChange {
+
+	oldByID := make(map[string]*LayoutEntry, len(oldEntries))
+	for idx := range oldEntries {
+		oldByID[oldEntries[idx].ID] = &oldEntries[idx]
+	}
+	newByID := make(map[string]*LayoutEntry, len(newEntries))
+	for idx := range newEntries {
+		newByID[newEntries[idx].ID] = &newEntries[idx]
+	}
+
+	var changes []LayoutChange
+	oldIdx := 0
+	// removed entries are reported before the first common entry that
+	// follows them in the old layout
+	flushRemoved := func(untilID string) {
+		for ; oldIdx < len(oldEntries) && oldEntries[oldIdx].ID != untilID; oldIdx++ {
+			if _, ok := newByID[oldEntries[oldIdx].ID]; !ok {
+				changes = append(changes, LayoutChange{ID: oldEntries[oldIdx].ID, Old: &oldEntries[oldIdx]})
+			}
+		}
+	}
+
+	for idx := range newEntries {
+		newEntry := &newEntries[idx]
+		oldEntry, ok := oldByID[newEntry.ID]
+		if !ok {
+			changes = append(changes, LayoutChange{ID: newEntry.ID, New: newEntry})
+			continue
+		}
+		flushRemoved(newEntry.ID)
+		if oldIdx < len(oldEntries) {
+			oldIdx++
+		}
+
+		oldFields, newFields := layoutFields(oldEntry), layoutFields(newEntry)
+		var fields []string
+		for _, field := range layoutFieldNames {
+			if oldFields[field] != newFields[field] {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			changes = append(changes, LayoutChange{ID: newEntry.ID, Old: oldEntry, New: newEntry, Fields: fields})
+		}
+	}
+	flushRemoved("")
+
+	return changes
+}
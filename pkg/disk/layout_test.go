@@ -0,0 +1,146 @@
+package disk_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func layoutTestPartitionTable() *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Size: 10 * datasizes.GiB,
+		Partitions: []disk.Partition{
+			{
+				Start: 1 * datasizes.MiB,
+				Size:  1 * datasizes.MiB,
+				Type:  disk.BIOSBootPartitionGUID,
+			},
+			{
+				Start: 2 * datasizes.MiB,
+				Size:  200 * datasizes.MiB,
+				Type:  disk.EFISystemPartitionGUID,
+				Payload: &disk.Filesystem{
+					Type:       "vfat",
+					Mountpoint: "/boot/efi",
+				},
+			},
+			{
+				Start: 202 * datasizes.MiB,
+				Size:  5 * datasizes.GiB,
+				Type:  disk.LVMPartitionGUID,
+				Payload: &disk.LUKSContainer{
+					Payload: &disk.LVMVolumeGroup{
+						Name: "rootvg",
+						LogicalVolumes: []disk.LVMLogicalVolume{
+							{
+								Name: "rootlv",
+								Size: 2 * datasizes.GiB,
+								Payload: &disk.Filesystem{
+									Type:       "xfs",
+									Mountpoint: "/",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestPartitionTableLayout(t *testing.T) {
+	pt := layoutTestPartitionTable()
+	assert.Equal(t, []disk.LayoutEntry{
+		{ID: "pt", Depth: 0, Size: 10 * datasizes.GiB, Type: "gpt"},
+		{ID: "type:" + strings.ToLower(disk.BIOSBootPartitionGUID), Depth: 1, Start: 1 * datasizes.MiB, End: 2 * datasizes.MiB, Size: 1 * datasizes.MiB, Type: disk.BIOSBootPartitionGUID},
+		{ID: "mnt:boot-efi", Depth: 1, Start: 2 * datasizes.MiB, End: 202 * datasizes.MiB, Size: 200 * datasizes.MiB, Type: disk.EFISystemPartitionGUID, FSType: "vfat", Mountpoint: "/boot/efi"},
+		{ID: "vg:rootvg", Depth: 1, Start: 202 * datasizes.MiB, End: 202*datasizes.MiB + 5*datasizes.GiB, Size: 5 * datasizes.GiB, Type: disk.LVMPartitionGUID},
+		{ID: "vg:rootvg/luks", Depth: 2, Type: "luks"},
+		{ID: "vg:rootvg/luks/vg:rootvg", Depth: 3, Type: "lvm-vg"},
+		{ID: "vg:rootvg/luks/vg:rootvg/lv:rootlv", Depth: 4, Size: 2 * datasizes.GiB, Type: "lvm-lv", FSType: "xfs", Mountpoint: "/"},
+	}, pt.Layout())
+}
+
+func TestPartitionTableRenderLayout(t *testing.T) {
+	pt := layoutTestPartitionTable()
+
+	var buf bytes.Buffer
+	require.NoError(t, pt.RenderLayout(&buf))
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+	assert.Equal(t, [][]string{
+		{"ID", "START", "END", "SIZE", "TYPE", "FS", "MOUNTPOINT"},
+		{"pt", "-", "-", "10", "GiB", "gpt"},
+		{"type:" + strings.ToLower(disk.BIOSBootPartitionGUID), "1048576", "2097152", "1", "MiB", disk.BIOSBootPartitionGUID},
+		{"mnt:boot-efi", "2097152", "211812352", "200", "MiB", disk.EFISystemPartitionGUID, "vfat", "/boot/efi"},
+		{"vg:rootvg", "211812352", "5580521472", "5", "GiB", disk.LVMPartitionGUID},
+		{"luks", "-", "-", "-", "luks"},
+		{"vg:rootvg", "-", "-", "-", "lvm-vg"},
+		{"lv:rootlv", "-", "-", "2", "GiB", "lvm-lv", "xfs", "/"},
+	}, rows)
+	// nested entries are indented
+	assert.Contains(t, buf.String(), "\n        lv:rootlv ")
+}
+
+func TestDiffLayout(t *testing.T) {
+	oldPT := layoutTestPartitionTable()
+	newPT := layoutTestPartitionTable()
+	newPT.Partitions[1].Size = 500 * datasizes.MiB
+	root := newPT.Partitions[2]
+	root.Start = 1526 * datasizes.MiB
+	newPT.Partitions = append(newPT.Partitions[:2], disk.Partition{
+		Start:   502 * datasizes.MiB,
+		Size:    1 * datasizes.GiB,
+		Type:    disk.SwapPartitionGUID,
+		Payload: &disk.Swap{},
+	}, root)
+
+	oldLayout := oldPT.Layout()
+	newLayout := newPT.Layout()
+
+	// inserting a partition does not change the IDs of the partitions
+	// that follow it
+	changes := disk.DiffLayout(oldLayout, newLayout)
+	assert.Equal(t, []disk.LayoutChange{
+		{ID: "mnt:boot-efi", Old: &oldLayout[2], New: &newLayout[2], Fields: []string{"end", "size"}},
+		{ID: "swap", New: &newLayout[3]},
+		{ID: "vg:rootvg", Old: &oldLayout[3], New: &newLayout[4], Fields: []string{"start", "end"}},
+	}, changes)
+
+	assert.Equal(t, "~ mnt:boot-efi: end 211812352 -> 526385152, size 200 MiB -> 500 MiB", changes[0].String())
+	assert.Equal(t, "+ swap: start 526385152, end 1600126976, size 1 GiB, type "+disk.SwapPartitionGUID+", fs swap", changes[1].String())
+	assert.Equal(t, "~ vg:rootvg: start 211812352 -> 1600126976, end 5580521472 -> 6968836096", changes[2].String())
+
+	// and the other way around
+	changes = disk.DiffLayout(newLayout, oldLayout)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "- swap: start 526385152, end 1600126976, size 1 GiB, type "+disk.SwapPartitionGUID+", fs swap", changes[1].String())
+
+	assert.Empty(t, disk.DiffLayout(oldLayout, layoutTestPartitionTable().Layout()))
+}
+
+func TestPartitionTableLayoutDuplicateIDs(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{Type: disk.SwapPartitionGUID, Payload: &disk.Swap{}},
+			{Type: disk.SwapPartitionGUID, Payload: &disk.Swap{}},
+			{Type: disk.FilesystemDataGUID, Label: "data", Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/data"}},
+		},
+	}
+	var ids []string
+	for _, entry := range pt.Layout() {
+		ids = append(ids, entry.ID)
+	}
+	assert.Equal(t, []string{"pt", "swap", "swap#2", "label:data"}, ids)
+}
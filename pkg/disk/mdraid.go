@@ -0,0 +1,438 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+const (
+	// DefaultMDRaidLevel is the RAID level of arrays that do not specify
+	// one.
+	DefaultMDRaidLevel = "raid1"
+
+	// DefaultMDRaidDevices is the number of member devices of arrays that
+	// do not specify one.
+	DefaultMDRaidDevices = 2
+
+	// DefaultMDRaidMetadata is the superblock format of arrays that do not
+	// specify one.
+	DefaultMDRaidMetadata = "1.2"
+
+	// MDRaidMetadataSize is the space reserved on each member device for the
+	// superblock and the internal write-intent bitmap. For metadata 1.2 the
+	// data offset is set to this size explicitly, since mdadm(8) otherwise
+	// picks an offset based on the device size.
+	MDRaidMetadataSize = 8 * datasizes.MiB
+)
+
+// MDRaid represents a Linux software RAID (md) array. The partition holding
+// the MDRaid is the first member device of the array, the other members are
+// the partitions with an [MDRaidMember] payload of the same name on the
+// member disks of the partition table. The array is assembled from all
+// members during the build, so the payload is written to every member.
+type MDRaid struct {
+	// Name of the array, the array is available as /dev/md/<name>.
+	Name string `json:"name" yaml:"name"`
+
+	UUID string `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+
+	// Level of the array, defaults to DefaultMDRaidLevel. One of "raid0",
+	// "raid1", "raid5", "raid6" or "raid10".
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+
+	// Devices is the number of member devices of the array, including the
+	// partition holding the MDRaid, defaults to DefaultMDRaidDevices.
+	Devices uint `json:"devices,omitempty" yaml:"devices,omitempty"`
+
+	// Metadata is the superblock format, defaults to DefaultMDRaidMetadata.
+	// Metadata "1.0" stores the superblock at the end of the device, which
+	// is needed for filesystems that are read by the firmware or the
+	// bootloader without assembling the array (e.g. the ESP).
+	Metadata string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	Payload Entity `json:"payload,omitempty" yaml:"payload,omitempty"`
+}
+
+func init() {
+	payloadEntityMap["mdraid"] = reflect.TypeOf(MDRaid{})
+	payloadEntityMap["mdraid_member"] = reflect.TypeOf(MDRaidMember{})
+}
+
+func (md *MDRaid) EntityName() string {
+	return "mdraid"
+}
+
+func (md *MDRaid) GetItemCount() uint {
+	if md.Payload == nil {
+		return 0
+	}
+	return 1
+}
+
+func (md *MDRaid) GetChild(n uint) Entity {
+	if n != 0 {
+		panic(fmt.Sprintf("invalid child index for MDRaid: %d != 0", n))
+	}
+	return md.Payload
+}
+
+func (md *MDRaid) Clone() Entity {
+	if md == nil {
+		return nil
+	}
+	cmd := &MDRaid{
+		Name:     md.Name,
+		UUID:     md.UUID,
+		Level:    md.Level,
+		Devices:  md.Devices,
+		Metadata: md.Metadata,
+	}
+	if md.Payload != nil {
+		cmd.Payload = md.Payload.Clone()
+	}
+	return cmd
+}
+
+func (md *MDRaid) GenUUID(rng *rand.Rand) {
+	if md == nil {
+		return
+	}
+
+	if md.UUID == "" {
+		md.UUID = uuid.Must(newRandomUUIDFromReader(rng)).String()
+	}
+}
+
+// GetLevel returns the RAID level of the array.
+func (md *MDRaid) GetLevel() string {
+	if md.Level == "" {
+		return DefaultMDRaidLevel
+	}
+	return md.Level
+}
+
+// GetDevices returns the number of member devices of the array.
+func (md *MDRaid) GetDevices() uint {
+	if md.Devices == 0 {
+		return DefaultMDRaidDevices
+	}
+	return md.Devices
+}
+
+// GetMetadata returns the superblock format of the array.
+func (md *MDRaid) GetMetadata() string {
+	if md.Metadata == "" {
+		return DefaultMDRaidMetadata
+	}
+	return md.Metadata
+}
+
+// MDAdmUUID returns the UUID of the array in the format used by mdadm(8),
+// i.e. four colon separated groups of eight hex digits.
+func (md *MDRaid) MDAdmUUID() string {
+	hex := strings.ReplaceAll(md.UUID, "-", "")
+	if len(hex) != 32 {
+		// not a valid UUID, let mdadm complain about it
+		return md.UUID
+	}
+	return strings.Join([]string{hex[0:8], hex[8:16], hex[16:24], hex[24:32]}, ":")
+}
+
+func (md *MDRaid) MetadataSize() datasizes.Size {
+	if md == nil {
+		return 0
+	}
+
+	return MDRaidMetadataSize
+}
+
+func (md *MDRaid) minSize(size datasizes.Size) datasizes.Size {
+	// like LUKS, only payloads with a size or with sized children matter
+	var payloadSize datasizes.Size
+	switch payload := md.Payload.(type) {
+	case VolumeContainer:
+		payloadSize = payload.minSize(size)
+	case Sizeable:
+		payloadSize = payload.GetSize()
+	}
+	dataDevices, err := mdRaidDataDevices(md.GetLevel(), md.GetDevices())
+	if err != nil {
+		// AddMDRaid() rejects invalid arrays
+		panic(fmt.Sprintf("invalid md raid array %q: %s; this is a programming error", md.Name, err))
+	}
+	return md.MetadataSize() + mdRaidMemberDataSize(payloadSize, dataDevices)
+}
+
+// mdRaidDataDevices returns the number of member devices worth of data an
+// array with the given level and number of devices holds.
+func mdRaidDataDevices(level string, devices uint) (uint, error) {
+	var minDevices, dataDevices uint
+	switch level {
+	case "raid0":
+		minDevices, dataDevices = 2, devices
+	case "raid1":
+		minDevices, dataDevices = 2, 1
+	case "raid5":
+		minDevices, dataDevices = 3, devices-1
+	case "raid6":
+		minDevices, dataDevices = 4, devices-2
+	case "raid10":
+		// the default "near" layout with two copies of each chunk
+		minDevices, dataDevices = 2, devices/2
+	default:
+		return 0, fmt.Errorf("unsupported md raid level %q", level)
+	}
+	if devices < minDevices {
+		return 0, fmt.Errorf("md raid level %s requires at least %d devices, got %d", level, minDevices, devices)
+	}
+	return dataDevices, nil
+}
+
+// mdRaidMemberDataSize returns the data size each member device needs for
+// an array with the given data size.
+func mdRaidMemberDataSize(size datasizes.Size, dataDevices uint) datasizes.Size {
+	n := datasizes.Size(dataDevices)
+	return (size + n - 1) / n
+}
+
+func (md *MDRaid) UnmarshalJSON(data []byte) (err error) {
+	// keep in sync with lvm.go,partition.go,luks.go
+	type alias MDRaid
+	var withoutPayload struct {
+		alias
+		Payload     json.RawMessage `json:"payload" yaml:"payload"`
+		PayloadType string          `json:"payload_type" yaml:"payload_type"`
+	}
+	if err := jsonUnmarshalStrict(data, &withoutPayload); err != nil {
+		return fmt.Errorf("cannot unmarshal %q: %w", data, err)
+	}
+	*md = MDRaid(withoutPayload.alias)
+
+	md.Payload, err = unmarshalJSONPayload(data)
+	return err
+}
+
+func (md *MDRaid) UnmarshalYAML(unmarshal func(any) error) error {
+	return common.UnmarshalYAMLviaJSON(md, unmarshal)
+}
+
+// MDRaidMember is the payload of the partitions of the member disks that
+// are member devices of the [MDRaid] array with the same name, other than
+// the partition holding the MDRaid itself.
+type MDRaidMember struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Member is the index of the member device in the array, the partition
+	// holding the MDRaid is member 0.
+	Member uint `json:"member" yaml:"member"`
+}
+
+func (mm *MDRaidMember) EntityName() string {
+	return "mdraid_member"
+}
+
+func (mm *MDRaidMember) Clone() Entity {
+	if mm == nil {
+		return nil
+	}
+	return &MDRaidMember{
+		Name:   mm.Name,
+		Member: mm.Member,
+	}
+}
+
+// MDRaidOptions describes an md RAID array for AddMDRaid().
+type MDRaidOptions struct {
+	// Mountpoint of the filesystem that is put on the array.
+	Mountpoint string `json:"mountpoint"`
+
+	// Name of the array, defaults to MDRaidNameForMountpoint(Mountpoint).
+	Name string `json:"name,omitempty"`
+
+	// Level of the array, defaults to DefaultMDRaidLevel.
+	Level string `json:"level,omitempty"`
+
+	// Devices is the number of member devices of the array, defaults to
+	// DefaultMDRaidDevices.
+	Devices uint `json:"devices,omitempty"`
+}
+
+// AddMDRaid puts the filesystem mounted at options.Mountpoint on an md RAID
+// array. The filesystem must be on a plain partition, which becomes the
+// first member device of the array. The other member devices are put on
+// separate disks, see PartitionTable.MDRaidMemberDisks, since an array with
+// all its members on one disk does not survive the failure of that disk.
+// The array uses metadata 1.0 for filesystems below /boot so that the
+// bootloader and the firmware can read them from a single member without
+// assembling the array, which requires mirroring (raid1).
+func (pt *PartitionTable) AddMDRaid(options MDRaidOptions) error {
+	mountpoint := options.Mountpoint
+	name := options.Name
+	if name == "" {
+		name = MDRaidNameForMountpoint(mountpoint)
+	}
+
+	var part *Partition
+	for idx := range pt.Partitions {
+		if mnt, ok := pt.Partitions[idx].Payload.(Mountable); ok && mnt.GetMountpoint() == mountpoint {
+			part = &pt.Partitions[idx]
+			break
+		}
+	}
+	if part == nil {
+		return fmt.Errorf("cannot find a filesystem on a plain partition for mountpoint %q", mountpoint)
+	}
+
+	if err := pt.ForEachEntity(func(e Entity, path []Entity) error {
+		if md, ok := e.(*MDRaid); ok && md.Name == name {
+			return fmt.Errorf("md raid array %q already exists", name)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	partType, err := getPartitionTypeIDfor(pt.Type, "raid", arch.ARCH_UNSET)
+	if err != nil {
+		return fmt.Errorf("error getting raid partition type ID for %q: %w", mountpoint, err)
+	}
+
+	md := &MDRaid{
+		Name:    name,
+		Level:   options.Level,
+		Devices: options.Devices,
+		Payload: part.Payload,
+	}
+	dataDevices, err := mdRaidDataDevices(md.GetLevel(), md.GetDevices())
+	if err != nil {
+		return fmt.Errorf("cannot create md raid array %q for %q: %w", name, mountpoint, err)
+	}
+	if mountpoint == "/boot" || strings.HasPrefix(mountpoint, "/boot/") {
+		if md.GetLevel() != "raid1" {
+			return fmt.Errorf("md raid array %q for %q must be raid1 to be readable by the bootloader, got %s", name, mountpoint, md.GetLevel())
+		}
+		md.Metadata = "1.0"
+	}
+
+	memberSize := md.MetadataSize() + mdRaidMemberDataSize(part.Size, dataDevices)
+	part.Type = partType
+	part.Payload = md
+	part.Size = memberSize
+	return nil
+}
+
+// MDRaidMembers returns the member partitions of the array with the given
+// name, ordered by their index in the array, starting with the partition
+// holding the MDRaid. Member n, for n > 0, is a partition of
+// pt.MDRaidMemberDisks[n-1].
+func (pt *PartitionTable) MDRaidMembers(name string) []*Partition {
+	var members []*Partition
+	for idx := range pt.Partitions {
+		if md, ok := pt.Partitions[idx].Payload.(*MDRaid); ok && md.Name == name {
+			members = append(members, &pt.Partitions[idx])
+			break
+		}
+	}
+	if members == nil {
+		return nil
+	}
+	for _, memberDisk := range pt.MDRaidMemberDisks {
+		part := memberDisk.findMDRaidMember(name)
+		if part == nil {
+			break
+		}
+		members = append(members, part)
+	}
+	return members
+}
+
+// findMDRaidMember returns the partition of the member device of the array
+// with the given name, or nil if there is none.
+func (pt *PartitionTable) findMDRaidMember(name string) *Partition {
+	for idx := range pt.Partitions {
+		if mm, ok := pt.Partitions[idx].Payload.(*MDRaidMember); ok && mm.Name == name {
+			return &pt.Partitions[idx]
+		}
+	}
+	return nil
+}
+
+// ensureMDRaidSizes grows the partitions holding an MDRaid to the size the
+// payload of the array needs on each member device.
+func (pt *PartitionTable) ensureMDRaidSizes() {
+	for idx := range pt.Partitions {
+		part := &pt.Partitions[idx]
+		if md, ok := part.Payload.(*MDRaid); ok {
+			part.EnsureSize(md.minSize(part.Size))
+		}
+	}
+}
+
+// relayoutMDRaidMemberDisks lays out the disks holding the member devices
+// of the md RAID arrays, other than the partitions holding the MDRaid, in
+// pt.MDRaidMemberDisks. Disk n holds member n+1 of every array with enough
+// devices, in the order of the arrays on the partition table, and each
+// member partition is at least as large as the partition holding the
+// MDRaid, as the array is limited by its smallest member. The UUIDs of the member
+// partitions of a previous layout are kept.
+func (pt *PartitionTable) relayoutMDRaidMemberDisks() {
+	var holders []*Partition
+	var memberDisks uint
+	for idx := range pt.Partitions {
+		if md, ok := pt.Partitions[idx].Payload.(*MDRaid); ok {
+			holders = append(holders, &pt.Partitions[idx])
+			memberDisks = max(memberDisks, md.GetDevices()-1)
+		}
+	}
+
+	var layout []*PartitionTable
+	for n := uint(0); n < memberDisks; n++ {
+		memberDisk := &PartitionTable{
+			Type:        pt.Type,
+			SectorSize:  pt.SectorSize,
+			StartOffset: pt.StartOffset,
+		}
+		for _, holder := range holders {
+			md := holder.Payload.(*MDRaid)
+			if md.GetDevices() <= n+1 {
+				continue
+			}
+			member := Partition{
+				Type: holder.Type,
+				Size: holder.Size,
+				Payload: &MDRaidMember{
+					Name:   md.Name,
+					Member: n + 1,
+				},
+			}
+			if n < uint(len(pt.MDRaidMemberDisks)) {
+				if prev := pt.MDRaidMemberDisks[n].findMDRaidMember(md.Name); prev != nil {
+					member.UUID = prev.UUID
+				}
+			}
+			memberDisk.Partitions = append(memberDisk.Partitions, member)
+		}
+		memberDisk.relayout(0)
+		layout = append(layout, memberDisk)
+	}
+	pt.MDRaidMemberDisks = layout
+}
+
+// MDRaidNameForMountpoint returns the name of the array for the given
+// mountpoint, e.g. "root" for "/" and "var-log" for "/var/log".
+func MDRaidNameForMountpoint(mountpoint string) string {
+	name := strings.ReplaceAll(strings.Trim(mountpoint, "/"), "/", "-")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
@@ -0,0 +1,246 @@
+package disk_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+func TestImplementsInterfacesCompileTimeCheckMDRaid(t *testing.T) {
+	var _ = disk.Container(&disk.MDRaid{})
+	var _ = disk.UniqueEntity(&disk.MDRaid{})
+	var _ = disk.VolumeContainer(&disk.MDRaid{})
+}
+
+func TestMDRaidDefaults(t *testing.T) {
+	md := &disk.MDRaid{}
+	assert.Equal(t, "raid1", md.GetLevel())
+	assert.Equal(t, uint(2), md.GetDevices())
+	assert.Equal(t, "1.2", md.GetMetadata())
+
+	md = &disk.MDRaid{Level: "raid1", Devices: 3, Metadata: "1.0"}
+	assert.Equal(t, "raid1", md.GetLevel())
+	assert.Equal(t, uint(3), md.GetDevices())
+	assert.Equal(t, "1.0", md.GetMetadata())
+}
+
+func TestMDRaidMDAdmUUID(t *testing.T) {
+	md := &disk.MDRaid{UUID: "fb180daf-48a7-4ee0-b10d-394651850fd4"}
+	assert.Equal(t, "fb180daf:48a74ee0:b10d3946:51850fd4", md.MDAdmUUID())
+}
+
+func TestMDRaidNameForMountpoint(t *testing.T) {
+	assert.Equal(t, "root", disk.MDRaidNameForMountpoint("/"))
+	assert.Equal(t, "boot", disk.MDRaidNameForMountpoint("/boot"))
+	assert.Equal(t, "var-log", disk.MDRaidNameForMountpoint("/var/log/"))
+}
+
+func TestMDRaidUnmarshalJSON(t *testing.T) {
+	input := `{
+		"payload_type": "mdraid",
+		"payload": {
+			"name": "root",
+			"metadata": "1.0",
+			"payload_type": "filesystem",
+			"payload": {"type": "xfs", "mountpoint": "/"}
+		}
+	}`
+
+	var part disk.Partition
+	err := json.Unmarshal([]byte(input), &part)
+	require.NoError(t, err)
+	assert.Equal(t, &disk.MDRaid{
+		Name:     "root",
+		Metadata: "1.0",
+		Payload: &disk.Filesystem{
+			Type:       "xfs",
+			Mountpoint: "/",
+		},
+	}, part.Payload)
+}
+
+func TestAddMDRaid(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Size:    1 * datasizes.GiB,
+				Type:    disk.XBootLDRPartitionGUID,
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/boot"},
+			},
+			{
+				Size:    2 * datasizes.GiB,
+				Type:    disk.RootPartitionX86_64GUID,
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"},
+			},
+		},
+	}
+
+	require.NoError(t, pt.AddMDRaid(disk.MDRaidOptions{Mountpoint: "/boot"}))
+	require.NoError(t, pt.AddMDRaid(disk.MDRaidOptions{Mountpoint: "/", Level: "raid5", Devices: 3}))
+	// the other members are put on the member disks when laying out the
+	// partition table
+	require.Len(t, pt.Partitions, 2)
+	assert.Empty(t, pt.MDRaidMemberDisks)
+
+	assert.Equal(t, disk.RAIDPartitionGUID, pt.Partitions[0].Type)
+	assert.Equal(t, 1*datasizes.GiB+disk.MDRaidMetadataSize, pt.Partitions[0].Size)
+	assert.Equal(t, &disk.MDRaid{
+		Name:     "boot",
+		Metadata: "1.0",
+		Payload:  &disk.Filesystem{Type: "xfs", Mountpoint: "/boot"},
+	}, pt.Partitions[0].Payload)
+
+	// raid5 with 3 devices holds 2 devices worth of data
+	assert.Equal(t, disk.RAIDPartitionGUID, pt.Partitions[1].Type)
+	assert.Equal(t, 1*datasizes.GiB+disk.MDRaidMetadataSize, pt.Partitions[1].Size)
+	assert.Equal(t, &disk.MDRaid{
+		Name:    "root",
+		Level:   "raid5",
+		Devices: 3,
+		Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"},
+	}, pt.Partitions[1].Payload)
+
+	assert.Equal(t, []*disk.Partition{&pt.Partitions[1]}, pt.MDRaidMembers("root"))
+	assert.Nil(t, pt.MDRaidMembers("home"))
+
+	assert.Equal(t, []string{"xfsprogs", "mdadm"}, pt.GetBuildPackages())
+
+	assert.EqualError(t, pt.AddMDRaid(disk.MDRaidOptions{Mountpoint: "/home"}), `cannot find a filesystem on a plain partition for mountpoint "/home"`)
+
+	pt.Partitions = append(pt.Partitions, disk.Partition{
+		Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/home"},
+	})
+	assert.EqualError(t, pt.AddMDRaid(disk.MDRaidOptions{Mountpoint: "/home", Name: "root"}), `md raid array "root" already exists`)
+	assert.EqualError(t, pt.AddMDRaid(disk.MDRaidOptions{Mountpoint: "/home", Level: "raid6", Devices: 3}), `cannot create md raid array "home" for "/home": md raid level raid6 requires at least 4 devices, got 3`)
+	assert.EqualError(t, pt.AddMDRaid(disk.MDRaidOptions{Mountpoint: "/home", Level: "linear"}), `cannot create md raid array "home" for "/home": unsupported md raid level "linear"`)
+}
+
+func TestAddMDRaidBootLevel(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Size:    1 * datasizes.GiB,
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/boot"},
+			},
+		},
+	}
+	assert.EqualError(t, pt.AddMDRaid(disk.MDRaidOptions{Mountpoint: "/boot", Level: "raid0"}), `md raid array "boot" for "/boot" must be raid1 to be readable by the bootloader, got raid0`)
+}
+
+func TestNewCustomPartitionTableMDRaid(t *testing.T) {
+	// math/rand is good enough in this case
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				MinSize: 1 * datasizes.GiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/boot",
+					FSType:     "xfs",
+				},
+			},
+			{
+				MinSize: 20 * datasizes.GiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/",
+					FSType:     "xfs",
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_XFS,
+		BootMode:      platform.BOOT_UEFI,
+		Architecture:  arch.ARCH_X86_64,
+		MDRaid: []disk.MDRaidOptions{
+			{Mountpoint: "/boot"},
+			{Mountpoint: "/", Level: "raid5", Devices: 3},
+		},
+	}
+	pt, err := disk.NewCustomPartitionTable(customizations, options, nil, rng)
+	require.NoError(t, err)
+
+	arrays := map[string]*disk.MDRaid{}
+	_ = pt.ForEachEntity(func(e disk.Entity, path []disk.Entity) error {
+		if md, ok := e.(*disk.MDRaid); ok {
+			arrays[md.Payload.(disk.Mountable).GetMountpoint()] = md
+			assert.Equal(t, disk.RAIDPartitionGUID, path[len(path)-2].(*disk.Partition).Type)
+		}
+		return nil
+	})
+	require.Len(t, arrays, 2)
+	assert.Equal(t, "boot", arrays["/boot"].Name)
+	assert.Equal(t, "1.0", arrays["/boot"].Metadata)
+	assert.NotEmpty(t, arrays["/boot"].UUID)
+	assert.Equal(t, "root", arrays["/"].Name)
+	assert.Equal(t, "raid5", arrays["/"].Level)
+	assert.Equal(t, "", arrays["/"].Metadata)
+	assert.NotEmpty(t, arrays["/"].UUID)
+
+	// the metadata is accounted for in the size of the root partition, which
+	// holds half of the data of the raid5 array
+	rootSize, err := pt.GetMountpointSize("/")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, rootSize, 10*datasizes.GiB+disk.MDRaidMetadataSize)
+
+	// the other members are on separate disks, member n on disk n-1, and at
+	// least as large as the partition holding the array
+	require.Len(t, pt.MDRaidMemberDisks, 2)
+	memberDisk0 := pt.MDRaidMemberDisks[0]
+	require.Len(t, memberDisk0.Partitions, 2)
+	memberDisk1 := pt.MDRaidMemberDisks[1]
+	require.Len(t, memberDisk1.Partitions, 1)
+	for _, memberDisk := range pt.MDRaidMemberDisks {
+		assert.Equal(t, disk.PT_GPT, memberDisk.Type)
+		assert.Nil(t, memberDisk.FindMountable("/"))
+		for _, part := range memberDisk.Partitions {
+			assert.Equal(t, disk.RAIDPartitionGUID, part.Type)
+			assert.NotEmpty(t, part.UUID)
+			assert.LessOrEqual(t, part.Start+part.Size.Uint64(), memberDisk.Size.Uint64())
+		}
+	}
+
+	bootMembers := pt.MDRaidMembers("boot")
+	require.Len(t, bootMembers, 2)
+	assert.Equal(t, &memberDisk0.Partitions[0], bootMembers[1])
+	assert.Equal(t, &disk.MDRaidMember{Name: "boot", Member: 1}, bootMembers[1].Payload)
+	assert.GreaterOrEqual(t, bootMembers[1].Size, bootMembers[0].Size)
+
+	rootMembers := pt.MDRaidMembers("root")
+	require.Len(t, rootMembers, 3)
+	assert.Equal(t, &memberDisk0.Partitions[1], rootMembers[1])
+	assert.Equal(t, &disk.MDRaidMember{Name: "root", Member: 1}, rootMembers[1].Payload)
+	assert.Equal(t, &memberDisk1.Partitions[0], rootMembers[2])
+	assert.Equal(t, &disk.MDRaidMember{Name: "root", Member: 2}, rootMembers[2].Payload)
+	for _, member := range rootMembers[1:] {
+		assert.GreaterOrEqual(t, member.Size, rootMembers[0].Size)
+		// raid5 with 3 devices holds 2 devices worth of data
+		assert.GreaterOrEqual(t, member.Size, 10*datasizes.GiB+disk.MDRaidMetadataSize)
+	}
+
+	// the member disks are cloned with the partition table
+	clone := pt.Clone().(*disk.PartitionTable)
+	assert.Equal(t, pt.MDRaidMemberDisks, clone.MDRaidMemberDisks)
+	assert.NotSame(t, pt.MDRaidMemberDisks[0], clone.MDRaidMemberDisks[0])
+
+	// the ESP is not on an array
+	esp := pt.FindMountable("/boot/efi")
+	require.NotNil(t, esp)
+
+	options.MDRaid = []disk.MDRaidOptions{{Mountpoint: "/data"}}
+	_, err = disk.NewCustomPartitionTable(customizations, options, nil, rng)
+	assert.EqualError(t, err, `error generating partition table: cannot find a filesystem on a plain partition for mountpoint "/data"`)
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/google/uuid"
 
@@ -36,6 +37,11 @@ type PartitionTable struct {
 	// Dictates if certain bits and bobs are required or not; uses the default
 	// policy if not set.
 	Policy *PartitionTablePolicy `json:"policy,omitempty" yaml:"policy,omitempty"`
+
+	// MDRaidMemberDisks are the disks holding the member devices of the md
+	// RAID arrays other than the partitions holding the MDRaid, member n of
+	// an array is on disk n-1. They are laid out with the partition table.
+	MDRaidMemberDisks []*PartitionTable `json:"mdraid_member_disks,omitempty" yaml:"mdraid_member_disks,omitempty"`
 }
 
 type PartitionTablePolicy struct {
@@ -195,6 +201,30 @@ func NewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.Filesyste
 	return newPT, nil
 }
 
+// NewDataPartitionTable creates a partition table for a data disk, i.e. an
+// additional disk without the root filesystem, from the base partition
+// table. The partitions are laid out in order and the last one is grown to
+// fill the size of the base partition table.
+func NewDataPartitionTable(basePT *PartitionTable, rng *rand.Rand) (*PartitionTable, error) {
+	if len(basePT.Partitions) == 0 {
+		return nil, fmt.Errorf("the partition table of a data disk has no partitions")
+	}
+	if entityPath(basePT, "/") != nil {
+		return nil, fmt.Errorf("the partition table of a data disk cannot contain the root filesystem")
+	}
+
+	newPT := basePT.Clone().(*PartitionTable)
+	newPT.relayout(0)
+	for idx, part := range newPT.Partitions {
+		if part.Size == 0 {
+			return nil, fmt.Errorf("partition %d of the data disk has no size, set the size of the partition or of the disk", idx)
+		}
+	}
+	newPT.GenerateUUIDs(rng)
+
+	return newPT, nil
+}
+
 func (pt *PartitionTable) UnmarshalJSON(data []byte) (err error) {
 	type aliasStruct PartitionTable
 	var alias aliasStruct
@@ -240,6 +270,10 @@ func (pt *PartitionTable) Clone() Entity {
 
 		clone.Partitions[idx] = *part
 	}
+
+	for _, memberDisk := range pt.MDRaidMemberDisks {
+		clone.MDRaidMemberDisks = append(clone.MDRaidMemberDisks, memberDisk.Clone().(*PartitionTable))
+	}
 	return clone
 }
 
@@ -302,6 +336,10 @@ func (pt *PartitionTable) GenerateUUIDs(rng *rand.Rand) {
 			pt.Partitions[idx].UUID = uuid.Must(newRandomUUIDFromReader(rng)).String()
 		}
 	}
+
+	for _, memberDisk := range pt.MDRaidMemberDisks {
+		memberDisk.GenerateUUIDs(rng)
+	}
 }
 
 func (pt *PartitionTable) GetItemCount() uint {
@@ -410,6 +448,29 @@ func (pt *PartitionTable) CreateMountpoint(mountpoint, defaultFs string, size da
 	return &pt.Partitions[len(pt.Partitions)-1], nil
 }
 
+// ValidateXBOOTLDR checks that a separate /boot can be used by a bootloader
+// that reads the boot entries from the XBOOTLDR partition of the Boot Loader
+// Specification, like systemd-boot. Such a bootloader only finds /boot if it
+// is a GPT partition with the XBOOTLDR partition type and can only read it
+// if it is vfat. A partition table without a separate /boot is valid, the
+// boot entries are written to the ESP then.
+func (pt *PartitionTable) ValidateXBOOTLDR() error {
+	bootPath := entityPath(pt, "/boot")
+	if bootPath == nil {
+		return nil
+	}
+
+	// NB: entityPath has reversed order
+	part, ok := bootPath[1].(*Partition)
+	if !ok || pt.Type != PT_GPT || !strings.EqualFold(part.Type, XBootLDRPartitionGUID) {
+		return fmt.Errorf("/boot must be a GPT partition with the XBOOTLDR partition type %s", XBootLDRPartitionGUID)
+	}
+	if fsType := bootPath[0].(Mountable).GetFSType(); fsType != "vfat" {
+		return fmt.Errorf("the XBOOTLDR partition /boot must be vfat, not %s", fsType)
+	}
+	return nil
+}
+
 type EntityCallback func(e Entity, path []Entity) error
 
 func forEachEntity(e Entity, path []Entity, cb EntityCallback) error {
@@ -512,25 +573,38 @@ func (pt *PartitionTable) relayout(size datasizes.Size) uint64 {
 
 	size = pt.AlignUp(size)
 
+	pt.ensureVerityHashSizes(size)
+	pt.ensureMDRaidSizes()
+
 	var rootIdx = -1
 	for idx := range pt.Partitions {
-		partition := &pt.Partitions[idx]
-		if len(entityPath(partition, "/")) != 0 {
-			// keep the root partition index to handle after all the other
-			// partitions have been moved and resized
+		if len(entityPath(&pt.Partitions[idx], "/")) != 0 {
 			rootIdx = idx
+			break
+		}
+	}
+	if rootIdx < 0 {
+		// data disks have no root filesystem, their last partition is
+		// grown instead
+		if len(pt.Partitions) == 0 {
+			panic("no root filesystem or partitions found; this is a programming error")
+		}
+		rootIdx = len(pt.Partitions) - 1
+	}
+
+	for idx := range pt.Partitions {
+		if idx == rootIdx {
+			// handle the root partition after all the other partitions
+			// have been moved and resized
 			continue
 		}
+		partition := &pt.Partitions[idx]
 		partition.Start = start
 		partition.fitTo(partition.Size)
 		partition.Size = pt.AlignUp(partition.Size)
 		start += partition.Size.Uint64()
 	}
 
-	if rootIdx < 0 {
-		panic("no root filesystem found; this is a programming error")
-	}
-
 	root := &pt.Partitions[rootIdx]
 	root.Start = start
 	root.fitTo(root.Size)
@@ -558,6 +632,8 @@ func (pt *PartitionTable) relayout(size datasizes.Size) uint64 {
 
 	// Sort partitions by start sector
 	pt.sortPartitions()
+
+	pt.relayoutMDRaidMemberDisks()
 	return start
 }
 
@@ -917,10 +993,16 @@ type partitionTableFeatures struct {
 	Btrfs bool
 	XFS   bool
 	FAT   bool
-	EXT4  bool
-	LUKS  bool
-	Swap  bool
-	Raw   bool
+	// EXT is set for ext2, ext3 and ext4 filesystems
+	EXT      bool
+	F2FS     bool
+	EROFS    bool
+	SquashFS bool
+	LUKS     bool
+	MDRaid   bool
+	Verity   bool
+	Swap     bool
+	Raw      bool
 }
 
 // features examines all of the PartitionTable entities and returns a struct
@@ -946,8 +1028,14 @@ func (pt *PartitionTable) features() partitionTableFeatures {
 				ptFeatures.Btrfs = true
 			case "xfs":
 				ptFeatures.XFS = true
-			case "ext4":
-				ptFeatures.EXT4 = true
+			case "ext2", "ext3", "ext4":
+				ptFeatures.EXT = true
+			case "f2fs":
+				ptFeatures.F2FS = true
+			case "erofs":
+				ptFeatures.EROFS = true
+			case "squashfs":
+				ptFeatures.SquashFS = true
 			}
 		case *Raw:
 			ptFeatures.Raw = true
@@ -955,6 +1043,10 @@ func (pt *PartitionTable) features() partitionTableFeatures {
 			ptFeatures.Swap = true
 		case *LUKSContainer:
 			ptFeatures.LUKS = true
+		case *MDRaid, *MDRaidMember:
+			ptFeatures.MDRaid = true
+		case *Verity, *VerityHash:
+			ptFeatures.Verity = true
 		case *PartitionTable, *Partition:
 			// nothing to do
 		default:
@@ -985,9 +1077,18 @@ func (pt *PartitionTable) GetBuildPackages() []string {
 	if features.FAT {
 		packages = append(packages, "dosfstools")
 	}
-	if features.EXT4 {
+	if features.EXT {
 		packages = append(packages, "e2fsprogs")
 	}
+	if features.F2FS {
+		packages = append(packages, "f2fs-tools")
+	}
+	if features.EROFS {
+		packages = append(packages, "erofs-utils")
+	}
+	if features.SquashFS {
+		packages = append(packages, "squashfs-tools")
+	}
 	if features.LUKS {
 		packages = append(packages,
 			"clevis",
@@ -995,6 +1096,13 @@ func (pt *PartitionTable) GetBuildPackages() []string {
 			"cryptsetup",
 		)
 	}
+	if features.MDRaid {
+		packages = append(packages, "mdadm")
+	}
+	if features.Verity && !features.LUKS {
+		// veritysetup is part of cryptsetup
+		packages = append(packages, "cryptsetup")
+	}
 
 	return packages
 }
@@ -1326,6 +1434,14 @@ type CustomPartitionTableOptions struct {
 	// enable automatic discovery. It has no effect and is not required when
 	// the PartitionTableType is PT_DOS.
 	Architecture arch.Arch
+
+	// MDRaid lists the md RAID arrays that filesystems on plain partitions
+	// are put on (see PartitionTable.AddMDRaid).
+	MDRaid []MDRaidOptions
+
+	// VerityMountpoints lists the mountpoints of the filesystems that are
+	// protected with dm-verity (see PartitionTable.AddVerity).
+	VerityMountpoints []string
 }
 
 // Returns the default filesystem type if the fstype is empty. If both are
@@ -1466,6 +1582,18 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 		pt.EnsureDirectorySizes(options.RequiredMinSizes)
 	}
 
+	for _, mdOptions := range options.MDRaid {
+		if err := pt.AddMDRaid(mdOptions); err != nil {
+			return nil, fmt.Errorf("%s %w", errPrefix, err)
+		}
+	}
+
+	for _, mountpoint := range options.VerityMountpoints {
+		if err := pt.AddVerity(mountpoint, options.Architecture); err != nil {
+			return nil, fmt.Errorf("%s %w", errPrefix, err)
+		}
+	}
+
 	if customizations.StartOffset > 0 {
 		pt.StartOffset = Offset(customizations.StartOffset)
 	}
@@ -3388,6 +3388,31 @@ func TestPartitionTableFeatures(t *testing.T) {
 	}
 }
 
+func TestGetBuildPackagesFilesystems(t *testing.T) {
+	for fsType, expected := range map[string][]string{
+		"ext2":     {"e2fsprogs"},
+		"ext3":     {"e2fsprogs"},
+		"ext4":     {"e2fsprogs"},
+		"f2fs":     {"f2fs-tools"},
+		"erofs":    {"erofs-utils"},
+		"squashfs": {"squashfs-tools"},
+	} {
+		t.Run(fsType, func(t *testing.T) {
+			pt := &disk.PartitionTable{
+				Partitions: []disk.Partition{
+					{
+						Payload: &disk.Filesystem{
+							Type:       fsType,
+							Mountpoint: "/data",
+						},
+					},
+				},
+			}
+			assert.Equal(t, expected, pt.GetBuildPackages())
+		})
+	}
+}
+
 func TestUnmarshalSizeUnitStringPartitionTable(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -3517,3 +3542,110 @@ func TestNewCustomPartitionTablePolicyNoXBOOTLDR(t *testing.T) {
 		assert.Equal(t, noBootPolicy, pt.Policy)
 	})
 }
+
+func TestPartitionTableValidateXBOOTLDR(t *testing.T) {
+	bootPartitionTable := func(ptType disk.PartitionTableType, partType, fsType string) *disk.PartitionTable {
+		return &disk.PartitionTable{
+			Type: ptType,
+			Partitions: []disk.Partition{
+				{
+					Type: disk.EFISystemPartitionGUID,
+					Payload: &disk.Filesystem{
+						Type:       "vfat",
+						Mountpoint: "/boot/efi",
+					},
+				},
+				{
+					Type: partType,
+					Payload: &disk.Filesystem{
+						Type:       fsType,
+						Mountpoint: "/boot",
+					},
+				},
+				{
+					Type: disk.FilesystemDataGUID,
+					Payload: &disk.Filesystem{
+						Type:       "xfs",
+						Mountpoint: "/",
+					},
+				},
+			},
+		}
+	}
+
+	testCases := map[string]struct {
+		pt          *disk.PartitionTable
+		expectedErr string
+	}{
+		"xbootldr": {
+			pt: bootPartitionTable(disk.PT_GPT, disk.XBootLDRPartitionGUID, "vfat"),
+		},
+		"xbootldr-lowercase-guid": {
+			pt: bootPartitionTable(disk.PT_GPT, "bc13c2ff-59e6-4262-a352-b275fd6f7172", "vfat"),
+		},
+		"no-boot": {
+			pt: testdisk.MakeFakePartitionTable("/", "/boot/efi"),
+		},
+		"xbootldr-not-vfat": {
+			pt:          bootPartitionTable(disk.PT_GPT, disk.XBootLDRPartitionGUID, "xfs"),
+			expectedErr: "the XBOOTLDR partition /boot must be vfat, not xfs",
+		},
+		"vfat-linux-data": {
+			pt:          bootPartitionTable(disk.PT_GPT, disk.FilesystemDataGUID, "vfat"),
+			expectedErr: "/boot must be a GPT partition with the XBOOTLDR partition type BC13C2FF-59E6-4262-A352-B275FD6F7172",
+		},
+		"vfat-dos": {
+			pt:          bootPartitionTable(disk.PT_DOS, disk.FAT16BDOSID, "vfat"),
+			expectedErr: "/boot must be a GPT partition with the XBOOTLDR partition type BC13C2FF-59E6-4262-A352-B275FD6F7172",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.pt.ValidateXBOOTLDR()
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewDataPartitionTable(t *testing.T) {
+	basePT := &disk.PartitionTable{
+		Size: 10 * datasizes.GiB,
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Size:    1 * datasizes.GiB,
+				Payload: &disk.Filesystem{Type: "ext4", Mountpoint: "/srv"},
+			},
+			{
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/data"},
+			},
+		},
+	}
+
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+	pt, err := disk.NewDataPartitionTable(basePT, rng)
+	require.NoError(t, err)
+	assert.Equal(t, 10*datasizes.GiB, pt.Size)
+	assert.NotEmpty(t, pt.UUID)
+	require.Len(t, pt.Partitions, 2)
+	assert.Equal(t, 1*datasizes.GiB, pt.Partitions[0].Size)
+	assert.Equal(t, pt.Partitions[0].Start+pt.Partitions[0].Size.Uint64(), pt.Partitions[1].Start)
+	// the last partition fills the disk up to the secondary GPT header
+	assert.Equal(t, pt.Size-pt.HeaderSize(), datasizes.Size(pt.Partitions[1].Start)+pt.Partitions[1].Size)
+	// the base partition table is not changed
+	assert.Equal(t, datasizes.Size(0), basePT.Partitions[1].Size)
+
+	basePT.Size = 0
+	_, err = disk.NewDataPartitionTable(basePT, rng)
+	assert.EqualError(t, err, "partition 1 of the data disk has no size, set the size of the partition or of the disk")
+
+	basePT.Partitions[1].Payload = &disk.Filesystem{Type: "xfs", Mountpoint: "/"}
+	_, err = disk.NewDataPartitionTable(basePT, rng)
+	assert.EqualError(t, err, "the partition table of a data disk cannot contain the root filesystem")
+}
@@ -0,0 +1,240 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+const (
+	// Block size of the data and hash devices of dm-verity volumes, the
+	// default of veritysetup(8).
+	VerityBlockSize = datasizes.Size(4 * datasizes.KiB)
+
+	// Size of the digests in the hash tree (sha256, the default of
+	// veritysetup(8)).
+	verityDigestSize = 32
+)
+
+// Verity represents a dm-verity protected volume. The payload is stored on
+// the partition that holds the Verity container and the hash tree is stored
+// on a separate partition with a [VerityHash] payload of the same name.
+//
+// The payload is written like an unprotected volume during the build and
+// the hash tree is generated at the end of the build, when the content does
+// not change anymore.
+type Verity struct {
+	// Name of the device-mapper device of the volume, e.g. "root" or "usr",
+	// also used to find the partition holding the hash tree.
+	Name string `json:"name" yaml:"name"`
+
+	Payload Entity `json:"payload,omitempty" yaml:"payload,omitempty"`
+}
+
+func init() {
+	payloadEntityMap["verity"] = reflect.TypeOf(Verity{})
+	payloadEntityMap["verity_hash"] = reflect.TypeOf(VerityHash{})
+}
+
+func (v *Verity) EntityName() string {
+	return "verity"
+}
+
+func (v *Verity) GetItemCount() uint {
+	if v.Payload == nil {
+		return 0
+	}
+	return 1
+}
+
+func (v *Verity) GetChild(n uint) Entity {
+	if n != 0 {
+		panic(fmt.Sprintf("invalid child index for Verity: %d != 0", n))
+	}
+	return v.Payload
+}
+
+func (v *Verity) Clone() Entity {
+	if v == nil {
+		return nil
+	}
+	cv := &Verity{
+		Name: v.Name,
+	}
+	if v.Payload != nil {
+		cv.Payload = v.Payload.Clone()
+	}
+	return cv
+}
+
+func (v *Verity) MetadataSize() datasizes.Size {
+	// the hash tree and superblock are on the hash partition
+	return 0
+}
+
+func (v *Verity) minSize(size datasizes.Size) datasizes.Size {
+	var minSize datasizes.Size
+	switch payload := v.Payload.(type) {
+	case VolumeContainer:
+		minSize = payload.minSize(size)
+	case Sizeable:
+		minSize = payload.GetSize()
+	}
+	return minSize
+}
+
+func (v *Verity) UnmarshalJSON(data []byte) (err error) {
+	// keep in sync with lvm.go,partition.go,luks.go
+	type alias Verity
+	var withoutPayload struct {
+		alias
+		Payload     json.RawMessage `json:"payload" yaml:"payload"`
+		PayloadType string          `json:"payload_type" yaml:"payload_type"`
+	}
+	if err := jsonUnmarshalStrict(data, &withoutPayload); err != nil {
+		return fmt.Errorf("cannot unmarshal %q: %w", data, err)
+	}
+	*v = Verity(withoutPayload.alias)
+
+	v.Payload, err = unmarshalJSONPayload(data)
+	return err
+}
+
+func (v *Verity) UnmarshalYAML(unmarshal func(any) error) error {
+	return common.UnmarshalYAMLviaJSON(v, unmarshal)
+}
+
+// VerityHash is the payload of the partition that holds the hash tree of the
+// [Verity] volume with the same name.
+type VerityHash struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+func (vh *VerityHash) EntityName() string {
+	return "verity_hash"
+}
+
+func (vh *VerityHash) Clone() Entity {
+	if vh == nil {
+		return nil
+	}
+	return &VerityHash{
+		Name: vh.Name,
+	}
+}
+
+// VerityHashSize returns the size needed for the hash tree (including the
+// superblock) of a dm-verity volume with the given data size, see
+// https://docs.kernel.org/admin-guide/device-mapper/verity.html
+func VerityHashSize(dataSize datasizes.Size) datasizes.Size {
+	hashesPerBlock := uint64(VerityBlockSize / verityDigestSize)
+
+	blocks := (dataSize.Uint64() + VerityBlockSize.Uint64() - 1) / VerityBlockSize.Uint64()
+	// the superblock
+	hashBlocks := uint64(1)
+	for {
+		blocks = (blocks + hashesPerBlock - 1) / hashesPerBlock
+		hashBlocks += blocks
+		if blocks <= 1 {
+			break
+		}
+	}
+	return datasizes.Size(hashBlocks) * VerityBlockSize
+}
+
+// AddVerity protects the filesystem mounted at mountpoint with dm-verity.
+// Only the root and /usr filesystems are supported, as those are the only
+// ones with Discoverable Partitions verity partition types. The filesystem
+// must be on a plain partition of a GPT partition table. The payload of the
+// partition is wrapped in a [Verity] container and a partition for the hash
+// tree is appended to the partition table. The filesystem is mounted
+// read-only as the dm-verity device cannot be written to.
+func (pt *PartitionTable) AddVerity(mountpoint string, architecture arch.Arch) error {
+	if pt.Type != PT_GPT {
+		return fmt.Errorf("dm-verity requires a %s partition table, got %s", PT_GPT, pt.Type)
+	}
+
+	var name, typeName string
+	switch mountpoint {
+	case "/":
+		name, typeName = "root", "root-verity"
+	case "/usr":
+		name, typeName = "usr", "usr-verity"
+	default:
+		return fmt.Errorf("dm-verity is only supported for / and /usr, not %q", mountpoint)
+	}
+
+	partType, err := getPartitionTypeIDfor(pt.Type, typeName, architecture)
+	if err != nil {
+		return fmt.Errorf("error getting verity partition type ID for %q: %w", mountpoint, err)
+	}
+
+	var dataPart *Partition
+	for idx := range pt.Partitions {
+		if fs, ok := pt.Partitions[idx].Payload.(*Filesystem); ok && fs.Mountpoint == mountpoint {
+			dataPart = &pt.Partitions[idx]
+			break
+		}
+	}
+	if dataPart == nil {
+		return fmt.Errorf("cannot find a filesystem on a plain partition for mountpoint %q", mountpoint)
+	}
+
+	fs := dataPart.Payload.(*Filesystem)
+	mntOps := strings.Split(fs.FSTabOptions, ",")
+	switch {
+	case slices.Contains(mntOps, "rw"):
+		return fmt.Errorf("dm-verity protected filesystem on %q cannot be mounted read-write", mountpoint)
+	case fs.FSTabOptions == "" || fs.FSTabOptions == "defaults":
+		fs.FSTabOptions = "ro"
+	case !slices.Contains(mntOps, "ro"):
+		fs.FSTabOptions += ",ro"
+	}
+
+	dataPart.Payload = &Verity{
+		Name:    name,
+		Payload: fs,
+	}
+	pt.Partitions = append(pt.Partitions, Partition{
+		Type: partType,
+		// Set the size to the minimum and it will be adjusted by relayout()
+		Size: VerityHashSize(dataPart.Size),
+		Payload: &VerityHash{
+			Name: name,
+		},
+	})
+	return nil
+}
+
+// ensureVerityHashSizes grows the partitions holding the hash trees to fit
+// the hash tree of their data partitions. The partition of the root
+// filesystem is grown to fill the disk later on, so its hash tree is sized
+// for the whole disk.
+func (pt *PartitionTable) ensureVerityHashSizes(size datasizes.Size) {
+	dataSizes := make(map[string]datasizes.Size)
+	for idx := range pt.Partitions {
+		part := &pt.Partitions[idx]
+		verity, ok := part.Payload.(*Verity)
+		if !ok {
+			continue
+		}
+		dataSize := max(part.Size, verity.minSize(part.Size))
+		if len(entityPath(part, "/")) != 0 {
+			dataSize = max(dataSize, size, pt.Size)
+		}
+		dataSizes[verity.Name] = dataSize
+	}
+
+	for idx := range pt.Partitions {
+		part := &pt.Partitions[idx]
+		if hash, ok := part.Payload.(*VerityHash); ok {
+			part.EnsureSize(VerityHashSize(dataSizes[hash.Name]))
+		}
+	}
+}
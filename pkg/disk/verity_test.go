@@ -0,0 +1,236 @@
+package disk_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/disk/partition"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+func TestImplementsInterfacesCompileTimeCheckVerity(t *testing.T) {
+	var _ = disk.Container(&disk.Verity{})
+	var _ = disk.PayloadEntity(&disk.VerityHash{})
+}
+
+func TestVerityHashSize(t *testing.T) {
+	testCases := []struct {
+		dataSize datasizes.Size
+		expected datasizes.Size
+	}{
+		// superblock + one level
+		{0, 2 * disk.VerityBlockSize},
+		{1, 2 * disk.VerityBlockSize},
+		{128 * disk.VerityBlockSize, 2 * disk.VerityBlockSize},
+		// superblock + two levels
+		{129 * disk.VerityBlockSize, 4 * disk.VerityBlockSize},
+		// superblock + 2048 + 16 + 1 hash blocks
+		{1 * datasizes.GiB, 2066 * disk.VerityBlockSize},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, disk.VerityHashSize(tc.dataSize), "data size %d", tc.dataSize)
+	}
+}
+
+func TestVerityUnmarshalJSON(t *testing.T) {
+	input := `{
+		"type": "gpt",
+		"partitions": [
+			{
+				"payload_type": "verity",
+				"payload": {
+					"name": "root",
+					"payload_type": "filesystem",
+					"payload": {"type": "erofs", "mountpoint": "/"}
+				}
+			},
+			{
+				"payload_type": "verity_hash",
+				"payload": {"name": "root"}
+			}
+		]
+	}`
+
+	var pt disk.PartitionTable
+	err := json.Unmarshal([]byte(input), &pt)
+	require.NoError(t, err)
+	assert.Equal(t, &disk.Verity{
+		Name: "root",
+		Payload: &disk.Filesystem{
+			Type:       "erofs",
+			Mountpoint: "/",
+		},
+	}, pt.Partitions[0].Payload)
+	assert.Equal(t, &disk.VerityHash{Name: "root"}, pt.Partitions[1].Payload)
+	assert.Equal(t, []string{"erofs-utils", "cryptsetup"}, pt.GetBuildPackages())
+}
+
+func verityTestPartitionTable() *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Size: 100 * datasizes.MiB,
+				Type: disk.EFISystemPartitionGUID,
+				Payload: &disk.Filesystem{
+					Type:         "vfat",
+					Mountpoint:   "/boot/efi",
+					FSTabOptions: "umask=0077,shortname=winnt",
+				},
+			},
+			{
+				Size: 2 * datasizes.GiB,
+				Type: disk.UsrPartitionX86_64GUID,
+				Payload: &disk.Filesystem{
+					Type:         "ext4",
+					Mountpoint:   "/usr",
+					FSTabOptions: "defaults",
+				},
+			},
+			{
+				Size: 1 * datasizes.GiB,
+				Type: disk.RootPartitionX86_64GUID,
+				Payload: &disk.Filesystem{
+					Type:         "ext4",
+					Mountpoint:   "/",
+					FSTabOptions: "noatime",
+				},
+			},
+		},
+	}
+}
+
+func TestAddVerity(t *testing.T) {
+	pt := verityTestPartitionTable()
+
+	require.NoError(t, pt.AddVerity("/usr", arch.ARCH_X86_64))
+	require.NoError(t, pt.AddVerity("/", arch.ARCH_X86_64))
+
+	require.Len(t, pt.Partitions, 5)
+	assert.Equal(t, &disk.Verity{
+		Name: "usr",
+		Payload: &disk.Filesystem{
+			Type:         "ext4",
+			Mountpoint:   "/usr",
+			FSTabOptions: "ro",
+		},
+	}, pt.Partitions[1].Payload)
+	assert.Equal(t, &disk.Verity{
+		Name: "root",
+		Payload: &disk.Filesystem{
+			Type:         "ext4",
+			Mountpoint:   "/",
+			FSTabOptions: "noatime,ro",
+		},
+	}, pt.Partitions[2].Payload)
+
+	assert.Equal(t, disk.UsrVerityPartitionX86_64GUID, pt.Partitions[3].Type)
+	assert.Equal(t, &disk.VerityHash{Name: "usr"}, pt.Partitions[3].Payload)
+	assert.Equal(t, disk.VerityHashSize(2*datasizes.GiB), pt.Partitions[3].Size)
+	assert.Equal(t, disk.RootVerityPartitionX86_64GUID, pt.Partitions[4].Type)
+	assert.Equal(t, &disk.VerityHash{Name: "root"}, pt.Partitions[4].Payload)
+	assert.Equal(t, disk.VerityHashSize(1*datasizes.GiB), pt.Partitions[4].Size)
+}
+
+func TestAddVerityErrors(t *testing.T) {
+	pt := verityTestPartitionTable()
+	pt.Type = disk.PT_DOS
+	assert.EqualError(t, pt.AddVerity("/", arch.ARCH_X86_64), "dm-verity requires a gpt partition table, got dos")
+
+	pt = verityTestPartitionTable()
+	assert.EqualError(t, pt.AddVerity("/boot/efi", arch.ARCH_X86_64), `dm-verity is only supported for / and /usr, not "/boot/efi"`)
+	assert.EqualError(t, pt.AddVerity("/", arch.ARCH_UNSET), `error getting verity partition type ID for "/": architecture must be specified for selecting GUID for "root-verity" partition`)
+
+	pt.Partitions = pt.Partitions[:2]
+	assert.EqualError(t, pt.AddVerity("/", arch.ARCH_X86_64), `cannot find a filesystem on a plain partition for mountpoint "/"`)
+
+	pt = verityTestPartitionTable()
+	pt.Partitions[2].Payload.(*disk.Filesystem).FSTabOptions = "rw,noatime"
+	assert.EqualError(t, pt.AddVerity("/", arch.ARCH_X86_64), `dm-verity protected filesystem on "/" cannot be mounted read-write`)
+}
+
+func TestNewPartitionTableVerityHashSize(t *testing.T) {
+	// math/rand is good enough in this case
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+
+	basePT := verityTestPartitionTable()
+	require.NoError(t, basePT.AddVerity("/", arch.ARCH_X86_64))
+
+	pt, err := disk.NewPartitionTable(basePT, []blueprint.FilesystemCustomization{}, 10*datasizes.GiB, partition.RawPartitioningMode, arch.ARCH_X86_64, nil, "", rng)
+	require.NoError(t, err)
+
+	// the root partition grows to fill the disk, so the hash partition is
+	// sized for the whole disk
+	hashPart := pt.Partitions[3]
+	require.Equal(t, &disk.VerityHash{Name: "root"}, hashPart.Payload)
+	assert.GreaterOrEqual(t, hashPart.Size, disk.VerityHashSize(10*datasizes.GiB))
+	assert.GreaterOrEqual(t, hashPart.Size, disk.VerityHashSize(pt.Partitions[2].Size))
+}
+
+func TestNewCustomPartitionTableVerity(t *testing.T) {
+	// math/rand is good enough in this case
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				MinSize: 1 * datasizes.GiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/boot",
+					FSType:     "xfs",
+				},
+			},
+			{
+				MinSize: 10 * datasizes.GiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/",
+					FSType:     "xfs",
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType:     disk.FS_XFS,
+		BootMode:          platform.BOOT_UEFI,
+		Architecture:      arch.ARCH_X86_64,
+		VerityMountpoints: []string{"/"},
+	}
+	pt, err := disk.NewCustomPartitionTable(customizations, options, nil, rng)
+	require.NoError(t, err)
+
+	var verity *disk.Verity
+	var hashPart *disk.Partition
+	for idx := range pt.Partitions {
+		switch payload := pt.Partitions[idx].Payload.(type) {
+		case *disk.Verity:
+			verity = payload
+		case *disk.VerityHash:
+			hashPart = &pt.Partitions[idx]
+		}
+	}
+	require.NotNil(t, verity)
+	assert.Equal(t, "root", verity.Name)
+	assert.Equal(t, "ro", verity.Payload.(*disk.Filesystem).FSTabOptions)
+	require.NotNil(t, hashPart)
+	assert.Equal(t, disk.RootVerityPartitionX86_64GUID, hashPart.Type)
+	assert.GreaterOrEqual(t, hashPart.Size, disk.VerityHashSize(10*datasizes.GiB))
+
+	// the ESP and /boot are not protected
+	assert.NotNil(t, pt.FindMountable("/boot/efi"))
+	assert.NotNil(t, pt.FindMountable("/boot"))
+
+	options.VerityMountpoints = []string{"/boot"}
+	_, err = disk.NewCustomPartitionTable(customizations, options, nil, rng)
+	assert.EqualError(t, err, `error generating partition table: dm-verity is only supported for / and /usr, not "/boot"`)
+}
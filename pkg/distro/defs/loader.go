@@ -381,6 +381,12 @@ func mergeImageTypeConfigs(d *DistroYAML, configs []imageTypesYAML) error {
 			if err := v.setupDefaultFS(d.DefaultFSType.String()); err != nil {
 				return err
 			}
+			if err := v.validateXBOOTLDR(); err != nil {
+				return err
+			}
+			if err := v.validateDataPartitionTables(); err != nil {
+				return err
+			}
 
 			imageTypes[name] = v
 		}
@@ -486,6 +492,9 @@ type ImageTypeYAML struct {
 	PartitionTables map[string]*disk.PartitionTable `yaml:"partition_table"`
 	// override specific aspects of the partition table
 	PartitionTablesOverrides *partitionTablesOverrides `yaml:"partition_tables_override"`
+	// archStr->partitionTables of additional data disks, only
+	// supported by the "disk" image func
+	DataPartitionTables map[string][]*disk.PartitionTable `yaml:"data_partition_tables"`
 
 	ImageConfigYAML     imageConfig     `yaml:"image_config,omitempty"`
 	InstallerConfigYAML installerConfig `yaml:"installer_config,omitempty"`
@@ -519,6 +528,9 @@ type ImageTypeYAML struct {
 	Image                  string                    `yaml:"image_func"`
 	Exports                []string                  `yaml:"exports"`
 	RequiredPartitionSizes map[string]datasizes.Size `yaml:"required_partition_sizes"`
+	// VerityMountpoints are the filesystems that are protected with
+	// dm-verity, the root hashes are added to the kernel command line
+	VerityMountpoints []string `yaml:"verity_mountpoints"`
 
 	InternalPlatforms []platform.Data    `yaml:"platforms"`
 	PlatformsOverride *platformsOverride `yaml:"platforms_override"`
@@ -653,7 +665,78 @@ func (it *ImageTypeYAML) setupDefaultFS(distroDefaultFS string) error {
 			}
 		}
 	}
+	for archName, pts := range it.DataPartitionTables {
+		for _, pt := range pts {
+			if err := subs(map[string]*disk.PartitionTable{archName: pt}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateXBOOTLDR checks the partition tables of the architectures that
+// boot with systemd-boot, it only finds the boot entries on a separate /boot
+// if that is a vfat XBOOTLDR partition.
+func (it *ImageTypeYAML) validateXBOOTLDR() error {
+	platforms := slices.Clone(it.InternalPlatforms)
+	if it.PlatformsOverride != nil {
+		for _, cond := range it.PlatformsOverride.Conditions {
+			platforms = append(platforms, cond.Override...)
+		}
+	}
 
+	for _, pl := range platforms {
+		if pl.GetBootloader() != platform.BOOTLOADER_SYSTEMD_BOOT {
+			continue
+		}
+		archName := pl.Arch.String()
+		pts := []*disk.PartitionTable{it.PartitionTables[archName]}
+		if it.PartitionTablesOverrides != nil {
+			for _, cond := range it.PartitionTablesOverrides.Conditions {
+				pts = append(pts, cond.Override[archName])
+			}
+		}
+		for _, pt := range pts {
+			if pt == nil {
+				continue
+			}
+			if err := pt.ValidateXBOOTLDR(); err != nil {
+				return fmt.Errorf("image type %q cannot boot with systemd-boot on %s: %w", it.name, archName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDataPartitionTables checks that the data disks of the image type
+// can be exported, they are only supported for the raw and qcow2 image
+// formats without compression.
+func (it *ImageTypeYAML) validateDataPartitionTables() error {
+	if len(it.DataPartitionTables) == 0 {
+		return nil
+	}
+	if it.Compression != "" {
+		return fmt.Errorf("image type %q cannot have data disks with compression %q", it.name, it.Compression)
+	}
+
+	platforms := slices.Clone(it.InternalPlatforms)
+	if it.PlatformsOverride != nil {
+		for _, cond := range it.PlatformsOverride.Conditions {
+			platforms = append(platforms, cond.Override...)
+		}
+	}
+	for _, pl := range platforms {
+		if len(it.DataPartitionTables[pl.Arch.String()]) == 0 {
+			continue
+		}
+		switch pl.GetImageFormat() {
+		case platform.FORMAT_RAW, platform.FORMAT_QCOW2:
+		default:
+			return fmt.Errorf("image type %q cannot have data disks in the %s image format, only raw and qcow2 are supported", it.name, pl.GetImageFormat())
+		}
+	}
 	return nil
 }
 
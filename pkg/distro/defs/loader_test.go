@@ -361,6 +361,57 @@ image_types:
 	}, partTable)
 }
 
+func TestDefsDataPartitionTables(t *testing.T) {
+	fakeDistroYaml := `
+image_types:
+  test_type:
+    data_partition_tables:
+      test_arch:
+        - size: 10_737_418_240
+          type: "gpt"
+          partitions:
+            - payload_type: filesystem
+              payload:
+                type: xfs
+                mountpoint: "/data"
+        - type: "gpt"
+          partitions:
+            - payload_type: filesystem
+              payload:
+                type: ext4
+                mountpoint: "/srv"
+`
+	it := makeTestImageType(t, fakeDistroYaml)
+
+	assert.Equal(t, map[string][]*disk.PartitionTable{
+		"test_arch": {
+			{
+				Size: 10_737_418_240,
+				Type: disk.PT_GPT,
+				Partitions: []disk.Partition{
+					{
+						Payload: &disk.Filesystem{
+							Type:       "xfs",
+							Mountpoint: "/data",
+						},
+					},
+				},
+			},
+			{
+				Type: disk.PT_GPT,
+				Partitions: []disk.Partition{
+					{
+						Payload: &disk.Filesystem{
+							Type:       "ext4",
+							Mountpoint: "/srv",
+						},
+					},
+				},
+			},
+		},
+	}, it.DataPartitionTables)
+}
+
 func TestDefsPartitionTableFilesystemDistroDefault(t *testing.T) {
 	fakeDistrosYaml := `
 distros:
@@ -867,6 +918,106 @@ image_types:
 	require.ErrorContains(t, err, `cannot execute template for "vendor" field (is it set?)`)
 }
 
+func TestImageTypesSystemdBootXBOOTLDR(t *testing.T) {
+	fakeImageTypesYaml := `
+image_types:
+  test_type:
+    filename: disk.img
+    platforms:
+      - arch: x86_64
+        bootloader: systemd-boot
+    partition_table:
+      x86_64:
+        type: gpt
+        partitions:
+          - size: "200 MiB"
+            type: C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+            payload_type: filesystem
+            payload:
+              type: vfat
+              mountpoint: "/boot/efi"
+          - size: "1 GiB"
+            type: %s
+            payload_type: filesystem
+            payload:
+              type: %s
+              mountpoint: "/boot"
+          - size: "2 GiB"
+            type: 0FC63DAF-8483-4772-8E79-3D69D8477DE4
+            payload_type: filesystem
+            payload:
+              type: xfs
+              mountpoint: "/"
+`
+
+	for _, tc := range []struct {
+		partType    string
+		fsType      string
+		expectedErr string
+	}{
+		{disk.XBootLDRPartitionGUID, "vfat", ""},
+		{disk.XBootLDRPartitionGUID, "ext4", `image type "test_type" cannot boot with systemd-boot on x86_64: the XBOOTLDR partition /boot must be vfat, not ext4`},
+		{disk.FilesystemDataGUID, "vfat", `image type "test_type" cannot boot with systemd-boot on x86_64: /boot must be a GPT partition with the XBOOTLDR partition type BC13C2FF-59E6-4262-A352-B275FD6F7172`},
+	} {
+		t.Run(tc.partType+"-"+tc.fsType, func(t *testing.T) {
+			baseDir := makeFakeDistrosYAML(t, "", fmt.Sprintf(fakeImageTypesYaml, tc.partType, tc.fsType))
+			restore := defs.MockDataFS(baseDir)
+			defer restore()
+
+			_, err := defs.NewDistroYAML("test-distro-1")
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestImageTypesDataPartitionTablesUnsupported(t *testing.T) {
+	fakeImageTypesYaml := `
+image_types:
+  test_type:
+    filename: disk.img
+    compression: %q
+    platforms:
+      - arch: x86_64
+        image_format: %s
+    data_partition_tables:
+      x86_64:
+        - type: gpt
+          size: "10 GiB"
+          partitions:
+            - payload_type: filesystem
+              payload:
+                type: xfs
+                mountpoint: "/data"
+`
+
+	for _, tc := range []struct {
+		compression string
+		imageFormat string
+		expectedErr string
+	}{
+		{"", "qcow2", ""},
+		{"", "vmdk", `image type "test_type" cannot have data disks in the vmdk image format, only raw and qcow2 are supported`},
+		{"xz", "raw", `image type "test_type" cannot have data disks with compression "xz"`},
+	} {
+		t.Run(tc.imageFormat+tc.compression, func(t *testing.T) {
+			baseDir := makeFakeDistrosYAML(t, "", fmt.Sprintf(fakeImageTypesYaml, tc.compression, tc.imageFormat))
+			restore := defs.MockDataFS(baseDir)
+			defer restore()
+
+			_, err := defs.NewDistroYAML("test-distro-1")
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
 var fakeDistroYamlISOConf = `
 image_types:
   test_type:
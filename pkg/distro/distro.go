@@ -5,6 +5,7 @@ import (
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/customizations/secureboot"
 	"github.com/osbuild/images/pkg/customizations/subscription"
 	"github.com/osbuild/images/pkg/depsolvednf"
 	"github.com/osbuild/images/pkg/disk"
@@ -160,6 +161,27 @@ type ImageType interface {
 	Manifest(bp *blueprint.Blueprint, options ImageOptions, repos []rpmmd.RepoConfig, seed *int64) (*manifest.Manifest, []string, error)
 }
 
+// ImageConfigImageType is an ImageType with a default image configuration,
+// which is applied to all its images.
+type ImageConfigImageType interface {
+	ImageType
+
+	// DefaultImageConfig returns the image configuration of the image
+	// type, including the defaults of the distribution.
+	DefaultImageConfig() *ImageConfig
+}
+
+// PartitionTableImageType is an ImageType that can generate the partition
+// table of its images without generating a manifest.
+type PartitionTableImageType interface {
+	ImageType
+
+	// GenPartitionTable returns the partition table of an image with the
+	// given customizations and options, laid out like the one in the
+	// manifest of the image.
+	GenPartitionTable(customizations *blueprint.Customizations, options ImageOptions, rng *rand.Rand) (*disk.PartitionTable, error)
+}
+
 type BootcImageOptions struct {
 	InstallerPayloadRef string `json:"installer_payload_ref,omitempty"`
 
@@ -195,6 +217,32 @@ type ImageOptions struct {
 	// empty (nil) the default from the distro is used. When set it overrides
 	// the default.
 	Preview *bool `json:"preview,omitempty"`
+
+	// SourceDateEpoch, in seconds since the Unix epoch, is set as the
+	// source epoch of all pipelines, which osbuild exports as
+	// SOURCE_DATE_EPOCH to their stages. Only the stages and the tools
+	// that honour SOURCE_DATE_EPOCH use it instead of the current time,
+	// so it reduces the differences between builds but does not make the
+	// artifacts bit-identical by itself; other sources of randomness, e.g.
+	// the UUIDs (see the seed of ImageType.Manifest()), remain. It also
+	// resets /etc/machine-id to "uninitialized" as the one generated
+	// during the build is random.
+	SourceDateEpoch *int64 `json:"source_date_epoch,omitempty"`
+
+	// SecureBoot signs the EFI binaries of the image with a user-provided
+	// key, see secureboot.ImageOptions.
+	SecureBoot *secureboot.ImageOptions `json:"secure_boot,omitempty"`
+
+	// MDRaid puts filesystems of the partition table on md RAID arrays,
+	// with the member partitions sized for the filesystem and the level.
+	// The first member of each array is on the boot disk, the others are
+	// on member disks that are written next to it as "<image>.member<n>"
+	// (see disk.PartitionTable.MDRaidMemberDisks), so it is only supported
+	// for uncompressed raw disk images. It is an image option and not a
+	// blueprint customization since the disk customizations of the
+	// blueprint cannot describe arrays; callers set it directly, it is
+	// applied to the base and to the custom partition tables alike.
+	MDRaid []disk.MDRaidOptions `json:"md_raid,omitempty"`
 }
 
 type BasePartitionTableMap map[string]disk.PartitionTable
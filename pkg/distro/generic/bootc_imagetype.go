@@ -156,8 +156,15 @@ func (t *bootcImageType) checkOptions(bp *blueprint.Blueprint) []string {
 
 func (t *bootcImageType) Manifest(bp *blueprint.Blueprint, options distro.ImageOptions, repos []rpmmd.RepoConfig, seedp *int64) (*manifest.Manifest, []string, error) {
 	validationWarnings := t.checkOptions(bp)
+	if options.SecureBoot != nil {
+		// the EFI binaries come signed from the bootc container
+		return nil, validationWarnings, fmt.Errorf("secure boot signing is not supported for %q", t.Name())
+	}
 
 	mani, manifestWarnings, err := t.manifestWithoutValidation(bp, options)
+	if mani != nil {
+		mani.SourceDateEpoch = options.SourceDateEpoch
+	}
 	return mani, append(validationWarnings, manifestWarnings...), err
 }
 
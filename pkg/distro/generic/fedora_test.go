@@ -2,17 +2,21 @@ package generic_test
 
 import (
 	"fmt"
+	"math/rand"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/pkg/datasizes"
 	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distro/distro_test_common"
 	"github.com/osbuild/images/pkg/distro/generic"
+	"github.com/osbuild/images/pkg/platform"
 )
 
 var fedoraFamilyDistros = []distro.Distro{
@@ -340,11 +344,15 @@ func TestFedoraImageType_Name(t *testing.T) {
 				"workstation-live-installer",
 				"minimal-raw-xz",
 				"minimal-raw-zst",
+				"minimal-raw-systemd-boot-xz",
 				"generic-oci",
 				"generic-openstack",
 				"generic-ova",
 				"generic-qcow2",
 				"generic-vhd",
+				"generic-vhdx",
+				"generic-hyperv",
+				"generic-vdi",
 				"generic-vmdk",
 				"generic-vagrant-libvirt",
 				"generic-vagrant-virtualbox",
@@ -383,9 +391,13 @@ func TestFedoraImageType_Name(t *testing.T) {
 				"iot-raw-xz",
 				"minimal-raw-xz",
 				"minimal-raw-zst",
+				"minimal-raw-uboot-xz",
+				"minimal-raw-systemd-boot-xz",
 				"generic-oci",
 				"generic-openstack",
 				"generic-qcow2",
+				"generic-vhdx",
+				"generic-hyperv",
 				"generic-vagrant-libvirt",
 				"server-qcow2",
 				"kinoite-installer",
@@ -523,11 +535,15 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 				"workstation-live-installer",
 				"minimal-raw-xz",
 				"minimal-raw-zst",
+				"minimal-raw-systemd-boot-xz",
 				"generic-oci",
 				"generic-openstack",
 				"generic-ova",
 				"generic-qcow2",
 				"generic-vhd",
+				"generic-vhdx",
+				"generic-hyperv",
+				"generic-vdi",
 				"generic-vmdk",
 				"generic-vagrant-libvirt",
 				"generic-vagrant-virtualbox",
@@ -567,9 +583,13 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 				"workstation-live-installer",
 				"minimal-raw-xz",
 				"minimal-raw-zst",
+				"minimal-raw-uboot-xz",
+				"minimal-raw-systemd-boot-xz",
 				"generic-oci",
 				"generic-openstack",
 				"generic-qcow2",
+				"generic-vhdx",
+				"generic-hyperv",
 				"generic-vagrant-libvirt",
 				"server-qcow2",
 				"cloud-azure",
@@ -620,8 +640,10 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 			arch: "riscv64",
 			imgNames: []string{
 				"generic-container",
+				"generic-qcow2",
 				"minimal-raw-xz",
 				"minimal-raw-zst",
+				"minimal-raw-systemd-boot-xz",
 			},
 		},
 	}
@@ -754,6 +776,124 @@ func TestFedoraESP(t *testing.T) {
 	})
 }
 
+func TestFedoraGenPartitionTable(t *testing.T) {
+	for _, fedoraDistro := range fedoraFamilyDistros {
+		t.Run(fedoraDistro.Name(), func(t *testing.T) {
+			distroArch, err := fedoraDistro.GetArch("x86_64")
+			require.NoError(t, err)
+			imgType, err := distroArch.GetImageType("generic-qcow2")
+			require.NoError(t, err)
+			ptImgType, ok := imgType.(distro.PartitionTableImageType)
+			require.True(t, ok)
+
+			// the same partition table as for the manifest of the image
+			/* #nosec G404 */
+			pt, err := ptImgType.GenPartitionTable(&blueprint.Customizations{}, distro.ImageOptions{}, rand.New(rand.NewSource(0)))
+			require.NoError(t, err)
+			expected, err := generic.GetPartitionTable(imgType)
+			require.NoError(t, err)
+			assert.Equal(t, expected.Layout(), pt.Layout())
+			assert.Equal(t, datasizes.Size(imgType.Size(0)), pt.Size)
+		})
+	}
+}
+
+func TestFedoraRISCV64GenericQcow2(t *testing.T) {
+	for _, fedoraDistro := range fedoraFamilyDistros {
+		t.Run(fedoraDistro.Name(), func(t *testing.T) {
+			distroArch, err := fedoraDistro.GetArch("riscv64")
+			require.NoError(t, err)
+			imgType, err := distroArch.GetImageType("generic-qcow2")
+			require.NoError(t, err)
+			assert.Equal(t, platform.BOOT_UEFI, imgType.BootMode())
+
+			pt, err := generic.GetPartitionTable(imgType)
+			require.NoError(t, err)
+			var rootType string
+			_ = pt.ForEachMountable(func(mnt disk.Mountable, path []disk.Entity) error {
+				if part, ok := path[1].(*disk.Partition); ok && mnt.GetMountpoint() == "/" {
+					rootType = part.Type
+				}
+				return nil
+			})
+			assert.Equal(t, strings.ToLower(disk.RootPartitionRiscv64GUID), strings.ToLower(rootType))
+
+			m, _, err := imgType.Manifest(&blueprint.Blueprint{}, distro.ImageOptions{}, nil, nil)
+			require.NoError(t, err)
+			pkgSetChains, err := m.GetPackageSetChains()
+			require.NoError(t, err)
+			var osPkgs []string
+			for _, ps := range pkgSetChains["os"] {
+				osPkgs = append(osPkgs, ps.Include...)
+			}
+			assert.Subset(t, osPkgs, []string{"grub2-efi-riscv64", "shim-unsigned-riscv64", "linux-firmware"})
+		})
+	}
+}
+
+func TestFedoraMinimalRawUBoot(t *testing.T) {
+	for _, fedoraDistro := range fedoraFamilyDistros {
+		t.Run(fedoraDistro.Name(), func(t *testing.T) {
+			distroArch, err := fedoraDistro.GetArch("aarch64")
+			require.NoError(t, err)
+			imgType, err := distroArch.GetImageType("minimal-raw-uboot")
+			require.NoError(t, err)
+			assert.Equal(t, "minimal-raw-uboot-xz", imgType.Name())
+			assert.Equal(t, platform.BOOT_NONE, imgType.BootMode())
+
+			pt, err := generic.GetPartitionTable(imgType)
+			require.NoError(t, err)
+			firmware := pt.FindMountable("/boot/firmware")
+			require.NotNil(t, firmware)
+			assert.Equal(t, "vfat", firmware.GetFSType())
+
+			m, _, err := imgType.Manifest(&blueprint.Blueprint{}, distro.ImageOptions{}, nil, nil)
+			require.NoError(t, err)
+			pkgSetChains, err := m.GetPackageSetChains()
+			require.NoError(t, err)
+			var osPkgs []string
+			for _, ps := range pkgSetChains["os"] {
+				osPkgs = append(osPkgs, ps.Include...)
+			}
+			assert.Subset(t, osPkgs, []string{"uboot-images-armv8", "bcm2711-firmware"})
+			assert.NotContains(t, osPkgs, "grub2-efi-aa64")
+		})
+	}
+}
+
+func TestFedoraMinimalRawSystemdBoot(t *testing.T) {
+	for _, fedoraDistro := range fedoraFamilyDistros {
+		for _, archName := range []string{"x86_64", "aarch64", "riscv64"} {
+			t.Run(fedoraDistro.Name()+"/"+archName, func(t *testing.T) {
+				distroArch, err := fedoraDistro.GetArch(archName)
+				require.NoError(t, err)
+				imgType, err := distroArch.GetImageType("minimal-raw-systemd-boot")
+				require.NoError(t, err)
+				assert.Equal(t, "minimal-raw-systemd-boot-xz", imgType.Name())
+				assert.Equal(t, platform.BOOT_UEFI, imgType.BootMode())
+
+				pt, err := generic.GetPartitionTable(imgType)
+				require.NoError(t, err)
+				assert.NoError(t, pt.ValidateXBOOTLDR())
+				boot := pt.FindMountable("/boot")
+				require.NotNil(t, boot)
+				assert.Equal(t, "vfat", boot.GetFSType())
+
+				m, _, err := imgType.Manifest(&blueprint.Blueprint{}, distro.ImageOptions{}, nil, nil)
+				require.NoError(t, err)
+				pkgSetChains, err := m.GetPackageSetChains()
+				require.NoError(t, err)
+				var osPkgs []string
+				for _, ps := range pkgSetChains["os"] {
+					osPkgs = append(osPkgs, ps.Include...)
+				}
+				assert.Contains(t, osPkgs, "systemd-boot-unsigned")
+				assert.NotContains(t, osPkgs, "grub2-tools")
+			})
+		}
+	}
+}
+
 func TestFedoraDistroBootstrapRef(t *testing.T) {
 	for _, fedoraDistro := range fedoraFamilyDistros {
 		for _, archName := range fedoraDistro.ListArches() {
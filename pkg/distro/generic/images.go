@@ -323,6 +323,7 @@ func osCustomizations(t *imageType, osPackageSet rpmmd.PackageSet, options distr
 	osc.AuthConfig = imageConfig.Authconfig
 	osc.PwQuality = imageConfig.PwQuality
 	osc.Subscription = options.Subscription
+	osc.SecureBoot = options.SecureBoot
 	osc.WAAgentConfig = imageConfig.WAAgentConfig
 	osc.UdevRules = imageConfig.UdevRules
 	osc.GCPGuestAgentConfig = imageConfig.GCPGuestAgentConfig
@@ -355,6 +356,11 @@ func osCustomizations(t *imageType, osPackageSet rpmmd.PackageSet, options distr
 	if imageConfig.MachineIdUninitialized != nil {
 		osc.MachineIdUninitialized = *imageConfig.MachineIdUninitialized
 	}
+	// the machine-id written by the package scriptlets is random, so
+	// reproducible builds always reset it
+	if options.SourceDateEpoch != nil {
+		osc.MachineIdUninitialized = true
+	}
 
 	osc.VersionlockPackages = imageConfig.VersionlockPackages
 
@@ -777,6 +783,11 @@ func diskImage(t *imageType,
 	}
 	img.PartitionTable = pt
 
+	img.DataPartitionTables, err = t.getDataPartitionTables(rng)
+	if err != nil {
+		return nil, err
+	}
+
 	img.VPCForceSize = t.ImageTypeYAML.DiskImageVPCForceSize
 
 	if img.OSCustomizations.NoBLS {
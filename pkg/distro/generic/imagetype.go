@@ -142,10 +142,15 @@ func (t *imageType) PayloadPackageSets() []string {
 }
 
 func (t *imageType) Exports() []string {
+	exports := []string{"assembler"}
 	if len(t.ImageTypeYAML.Exports) > 0 {
-		return t.ImageTypeYAML.Exports
+		exports = slices.Clone(t.ImageTypeYAML.Exports)
 	}
-	return []string{"assembler"}
+	// the data disks are exported next to the boot disk
+	for idx := range t.ImageTypeYAML.DataPartitionTables[t.arch.arch.String()] {
+		exports = append(exports, image.DataDiskExport(idx, t.platform.GetImageFormat()))
+	}
+	return exports
 }
 
 func (t *imageType) BootMode() platform.BootMode {
@@ -164,6 +169,11 @@ func (t *imageType) BasePartitionTable() (*disk.PartitionTable, error) {
 	return t.ImageTypeYAML.PartitionTable(d.ID(), t.arch.arch.String())
 }
 
+// GenPartitionTable implements distro.PartitionTableImageType.
+func (t *imageType) GenPartitionTable(customizations *blueprint.Customizations, options distro.ImageOptions, rng *rand.Rand) (*disk.PartitionTable, error) {
+	return t.getPartitionTable(customizations, options, rng)
+}
+
 func (t *imageType) getPartitionTable(customizations *blueprint.Customizations, options distro.ImageOptions, rng *rand.Rand) (*disk.PartitionTable, error) {
 	basePartitionTable, err := t.BasePartitionTable()
 	if err != nil {
@@ -196,14 +206,50 @@ func (t *imageType) getPartitionTable(customizations *blueprint.Customizations,
 			DefaultFSType:      defaultFsType,
 			RequiredMinSizes:   t.ImageTypeYAML.RequiredPartitionSizes,
 			Architecture:       t.platform.GetArch(),
+			MDRaid:             options.MDRaid,
+			VerityMountpoints:  t.ImageTypeYAML.VerityMountpoints,
 		}
 		return disk.NewCustomPartitionTable(partitioning, partOptions, nil, rng)
 	}
 
+	if len(options.MDRaid) > 0 || len(t.ImageTypeYAML.VerityMountpoints) > 0 {
+		// the base partition table is shared, change a copy
+		basePartitionTable = basePartitionTable.Clone().(*disk.PartitionTable)
+		for _, mdOptions := range options.MDRaid {
+			if err := basePartitionTable.AddMDRaid(mdOptions); err != nil {
+				return nil, err
+			}
+		}
+		for _, mountpoint := range t.ImageTypeYAML.VerityMountpoints {
+			if err := basePartitionTable.AddVerity(mountpoint, t.platform.GetArch()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	mountpoints := customizations.GetFilesystems()
 	return disk.NewPartitionTable(basePartitionTable, mountpoints, datasizes.Size(imageSize), options.PartitioningMode, t.platform.GetArch(), t.ImageTypeYAML.RequiredPartitionSizes, defaultFsType.String(), rng)
 }
 
+// getDataPartitionTables returns the partition tables of the additional data
+// disks of the image type. They are not customizable.
+func (t *imageType) getDataPartitionTables(rng *rand.Rand) ([]*disk.PartitionTable, error) {
+	var pts []*disk.PartitionTable
+	for _, basePT := range t.ImageTypeYAML.DataPartitionTables[t.arch.arch.String()] {
+		pt, err := disk.NewDataPartitionTable(basePT, rng)
+		if err != nil {
+			return nil, err
+		}
+		pts = append(pts, pt)
+	}
+	return pts, nil
+}
+
+// DefaultImageConfig implements distro.ImageConfigImageType.
+func (t *imageType) DefaultImageConfig() *distro.ImageConfig {
+	return t.getDefaultImageConfig()
+}
+
 func (t *imageType) getDefaultImageConfig() *distro.ImageConfig {
 	d := t.Arch().Distro()
 	imageConfig := t.ImageConfig(d.ID(), t.arch.arch.String())
@@ -321,6 +367,7 @@ func (t *imageType) Manifest(bp *blueprint.Blueprint,
 		}
 		mf.DistroBootstrapRef = bootstrapContainerRef
 	}
+	mf.SourceDateEpoch = options.SourceDateEpoch
 	runner := d.Runner()
 	_, err = img.InstantiateManifest(&mf, repos, &runner, rng)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/customizations/oscap"
 	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/platform"
 	"github.com/osbuild/images/pkg/policies"
 )
 
@@ -40,6 +41,29 @@ func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.Im
 		}
 	}
 
+	if options.SecureBoot != nil {
+		// the EFI binaries are only signed in the OS pipeline of disk
+		// images that boot with grub2 or a UKI
+		if !t.Bootable || t.IsOSTreeBasedImageType() || t.platform.GetBootloader() == platform.BOOTLOADER_SYSTEMD_BOOT {
+			return warnings, fmt.Errorf("secure boot signing is not supported for %q", t.Name())
+		}
+		if bootMode := t.BootMode(); bootMode != platform.BOOT_UEFI && bootMode != platform.BOOT_HYBRID {
+			return warnings, fmt.Errorf("secure boot signing requires UEFI, which %q does not support", t.Name())
+		}
+		if err := options.SecureBoot.Validate(); err != nil {
+			return warnings, err
+		}
+	}
+
+	if len(options.MDRaid) > 0 {
+		// the member disks of the arrays are written next to the boot
+		// disk, which is only exported as a file for uncompressed raw
+		// disk images
+		if t.ImageTypeYAML.Image != "disk" || t.platform.GetImageFormat() != platform.FORMAT_RAW || t.ImageTypeYAML.Compression != "" {
+			return warnings, fmt.Errorf("md raid arrays are not supported for %q, only uncompressed raw disk images are supported", t.Name())
+		}
+	}
+
 	if (t.BootISO || t.Bootable) && t.IsOSTreeBasedImageType() {
 		// ostree-based ISOs require a URL from which to pull a payload commit, this can either be a default URL or one
 		// supplied through options
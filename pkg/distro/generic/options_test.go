@@ -7,6 +7,7 @@ import (
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/disk/partition"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distro/generic"
@@ -53,6 +54,29 @@ func TestCheckOptions(t *testing.T) {
 			},
 			expErr: "OSTree is not supported for \"generic-ami\"",
 		},
+		"f42/ami-mdraid-ok": {
+			distro: "fedora-42",
+			it:     "generic-ami",
+			options: distro.ImageOptions{
+				MDRaid: []disk.MDRaidOptions{{Mountpoint: "/boot"}},
+			},
+		},
+		"f42/qcow2-mdraid-error": {
+			distro: "fedora-42",
+			it:     "generic-qcow2",
+			options: distro.ImageOptions{
+				MDRaid: []disk.MDRaidOptions{{Mountpoint: "/boot"}},
+			},
+			expErr: "md raid arrays are not supported for \"generic-qcow2\", only uncompressed raw disk images are supported",
+		},
+		"f42/raw-xz-mdraid-error": {
+			distro: "fedora-42",
+			it:     "minimal-raw-xz",
+			options: distro.ImageOptions{
+				MDRaid: []disk.MDRaidOptions{{Mountpoint: "/boot"}},
+			},
+			expErr: "md raid arrays are not supported for \"minimal-raw-xz\", only uncompressed raw disk images are supported",
+		},
 		"f42/ostree-disk-supported": {
 			distro: "fedora-42",
 			it:     "iot-qcow2",
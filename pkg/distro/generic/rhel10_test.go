@@ -88,6 +88,30 @@ func TestRH10FilenameFromType(t *testing.T) {
 				mimeType: "application/x-tar",
 			},
 		},
+		{
+			name: "vhdx",
+			args: args{"vhdx"},
+			want: wantResult{
+				filename: "disk.vhdx",
+				mimeType: "application/x-vhdx",
+			},
+		},
+		{
+			name: "hyperv",
+			args: args{"hyperv"},
+			want: wantResult{
+				filename: "image.tar",
+				mimeType: "application/x-tar",
+			},
+		},
+		{
+			name: "vdi",
+			args: args{"vdi"},
+			want: wantResult{
+				filename: "disk.vdi",
+				mimeType: "application/x-virtualbox-vdi",
+			},
+		},
 		{
 			name: "invalid-output-type",
 			args: args{"foobar"},
@@ -249,6 +273,9 @@ func TestRH10Architecture_ListImageTypes(t *testing.T) {
 				"qcow2",
 				"oci",
 				"vhd",
+				"vhdx",
+				"hyperv",
+				"vdi",
 				"vmdk",
 				"ova",
 				"ami",
@@ -283,6 +310,8 @@ func TestRH10Architecture_ListImageTypes(t *testing.T) {
 				"tar",
 				"vagrant-libvirt",
 				"vhd",
+				"vhdx",
+				"hyperv",
 				"wsl",
 			},
 		},
@@ -206,6 +206,30 @@ func TestRhel9_FilenameFromType(t *testing.T) {
 				mimeType: "application/x-vmdk",
 			},
 		},
+		{
+			name: "vhdx",
+			args: args{"vhdx"},
+			want: wantResult{
+				filename: "disk.vhdx",
+				mimeType: "application/x-vhdx",
+			},
+		},
+		{
+			name: "hyperv",
+			args: args{"hyperv"},
+			want: wantResult{
+				filename: "image.tar",
+				mimeType: "application/x-tar",
+			},
+		},
+		{
+			name: "vdi",
+			args: args{"vdi"},
+			want: wantResult{
+				filename: "disk.vdi",
+				mimeType: "application/x-virtualbox-vdi",
+			},
+		},
 		{
 			name: "invalid-output-type",
 			args: args{"foobar"},
@@ -476,6 +500,9 @@ func TestRhel9_Architecture_ListImageTypes(t *testing.T) {
 				"qcow2",
 				"openstack",
 				"vhd",
+				"vhdx",
+				"hyperv",
+				"vdi",
 				"azure-rhui",
 				"azure-sap-rhui",
 				"azure-sapapps-rhui",
@@ -526,6 +553,8 @@ func TestRhel9_Architecture_ListImageTypes(t *testing.T) {
 				"tar",
 				"image-installer",
 				"vhd",
+				"vhdx",
+				"hyperv",
 				"azure-rhui",
 				"vagrant-libvirt",
 				"wsl",
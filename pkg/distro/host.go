@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"strconv"
@@ -95,13 +96,27 @@ func readOSRelease(r io.Reader) (map[string]string, error) {
 // According to os-release(5), the os-release file should be located in either /etc/os-release or /usr/lib/os-release,
 // so both locations are tried, with the former taking precedence.
 func ReadOSReleaseFromTree(root string) (map[string]string, error) {
+	return readOSReleaseFrom(func(location string) (io.ReadCloser, error) {
+		return os.Open(path.Join(root, location))
+	})
+}
+
+// ReadOSReleaseFromFS is like ReadOSReleaseFromTree but reads the
+// os-release file from a filesystem, e.g. the tree of an image.
+func ReadOSReleaseFromFS(fsys fs.FS) (map[string]string, error) {
+	return readOSReleaseFrom(func(location string) (io.ReadCloser, error) {
+		return fsys.Open(location)
+	})
+}
+
+func readOSReleaseFrom(open func(location string) (io.ReadCloser, error)) (map[string]string, error) {
 	locations := []string{
 		"etc/os-release",
 		"usr/lib/os-release",
 	}
 	var errs []string
 	for _, location := range locations {
-		f, err := os.Open(path.Join(root, location))
+		f, err := open(location)
 		if err == nil {
 			defer f.Close()
 			return readOSRelease(f)
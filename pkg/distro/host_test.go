@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/require"
 )
@@ -154,6 +155,23 @@ func TestReadOSReleaseFromTree(t *testing.T) {
 	require.Equal(t, "kingfisher", osRelease["ID"])
 }
 
+func TestReadOSReleaseFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"usr/lib/os-release": &fstest.MapFile{Data: []byte("ID=toucan\n")},
+	}
+	osRelease, err := ReadOSReleaseFromFS(fsys)
+	require.NoError(t, err)
+	require.Equal(t, "toucan", osRelease["ID"])
+
+	fsys["etc/os-release"] = &fstest.MapFile{Data: []byte("ID=kingfisher\n")}
+	osRelease, err = ReadOSReleaseFromFS(fsys)
+	require.NoError(t, err)
+	require.Equal(t, "kingfisher", osRelease["ID"])
+
+	_, err = ReadOSReleaseFromFS(fstest.MapFS{})
+	require.ErrorContains(t, err, "failed to read os-release")
+}
+
 func TestReadOSReleaseFromTreeUnhappy(t *testing.T) {
 	tree := t.TempDir()
 
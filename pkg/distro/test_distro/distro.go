@@ -300,7 +300,7 @@ func (t *TestImageType) Manifest(b *blueprint.Blueprint, options distro.ImageOpt
 		},
 	}
 
-	m := &manifest.Manifest{}
+	m := &manifest.Manifest{SourceDateEpoch: options.SourceDateEpoch}
 
 	build := manifest.NewContentTestBuild(m, buildPackages, nil, nil)
 	manifest.NewContentTest(osPkgsKey, build, osPackages, nil, ostreeSources)
@@ -25,6 +25,12 @@ type DiskImage struct {
 	Environment        environment.Environment
 	Compression        string
 
+	// DataPartitionTables are the partition tables of additional data
+	// disks, each one is exported as a separate image in the format of
+	// the boot disk, named "data<n>". Only the raw and qcow2 formats
+	// without compression are supported.
+	DataPartitionTables []*disk.PartitionTable
+
 	// Control the VPC subformat use of force_size
 	VPCForceSize *bool
 	PartTool     osbuild.PartTool
@@ -35,6 +41,16 @@ type DiskImage struct {
 	OSNick    string
 }
 
+// DataDiskExport returns the name of the exported pipeline of the data disk
+// with the given index, "data<n>" for raw images and "data<n>-qcow2" for
+// qcow2 images.
+func DataDiskExport(idx int, format platform.ImageFormat) string {
+	if format == platform.FORMAT_QCOW2 {
+		return fmt.Sprintf("data%d-qcow2", idx)
+	}
+	return fmt.Sprintf("data%d", idx)
+}
+
 func NewDiskImage(platform platform.Platform, filename string) *DiskImage {
 	return &DiskImage{
 		Base:     NewBase("disk", platform, filename),
@@ -52,6 +68,7 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 
 	osPipeline := manifest.NewOS(buildPipeline, img.platform, repos)
 	osPipeline.PartitionTable = img.PartitionTable
+	osPipeline.DataPartitionTables = img.DataPartitionTables
 	osPipeline.OSCustomizations = img.OSCustomizations
 	osPipeline.DiskCustomizations = img.DiskCustomizations
 	osPipeline.Environment = img.Environment
@@ -61,6 +78,30 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 
 	rawImagePipeline := manifest.NewRawImage(buildPipeline, osPipeline, img.DiskCustomizations)
 
+	// the member disks of md RAID arrays are written next to the boot disk
+	// in the raw image pipeline and exported with it
+	if len(img.PartitionTable.MDRaidMemberDisks) > 0 && (img.platform.GetImageFormat() != platform.FORMAT_RAW || img.Compression != "") {
+		return nil, fmt.Errorf("md raid arrays are only supported for uncompressed raw images")
+	}
+	if len(img.DataPartitionTables) > 0 && img.Compression != "" {
+		return nil, fmt.Errorf("data disks are not supported with compression (%s)", img.Compression)
+	}
+	for idx, pt := range img.DataPartitionTables {
+		name := fmt.Sprintf("data%d", idx)
+		rawDataPipeline := manifest.NewRawDataImage(buildPipeline, osPipeline, pt, name, img.DiskCustomizations)
+		switch img.platform.GetImageFormat() {
+		case platform.FORMAT_RAW:
+			rawDataPipeline.Export()
+		case platform.FORMAT_QCOW2:
+			qcow2Pipeline := manifest.NewNamedQCOW2(buildPipeline, rawDataPipeline, DataDiskExport(idx, platform.FORMAT_QCOW2))
+			qcow2Pipeline.Compat = img.platform.GetQCOW2Compat()
+			qcow2Pipeline.SetFilename(name + ".qcow2")
+			qcow2Pipeline.Export()
+		default:
+			return nil, fmt.Errorf("data disks are not supported for image format %s", img.platform.GetImageFormat())
+		}
+	}
+
 	var imagePipeline manifest.FilePipeline
 	switch img.platform.GetImageFormat() {
 	case platform.FORMAT_RAW:
@@ -96,6 +137,22 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 		imagePipeline = vpcPipeline
 	case platform.FORMAT_VMDK:
 		imagePipeline = manifest.NewVMDK(buildPipeline, rawImagePipeline)
+	case platform.FORMAT_VHDX:
+		imagePipeline = manifest.NewVHDX(buildPipeline, rawImagePipeline)
+	case platform.FORMAT_VDI:
+		imagePipeline = manifest.NewVDI(buildPipeline, rawImagePipeline)
+	case platform.FORMAT_HYPERV:
+		extLess := strings.TrimSuffix(img.filename, filepath.Ext(img.filename))
+		vhdxPipeline := manifest.NewVHDX(buildPipeline, rawImagePipeline)
+		vhdxPipeline.SetFilename(fmt.Sprintf("%s.vhdx", extLess))
+		hypervPipeline := manifest.NewHyperV(buildPipeline, vhdxPipeline)
+		tarPipeline := manifest.NewTar(buildPipeline, hypervPipeline, "archive")
+		tarPipeline.SetFilename(img.filename)
+		tarPipeline.Paths = []string{
+			hypervPipeline.ScriptFilename(),
+			vhdxPipeline.Filename(),
+		}
+		imagePipeline = tarPipeline
 	case platform.FORMAT_OVA:
 		vmdkPipeline := manifest.NewVMDK(buildPipeline, rawImagePipeline)
 		ovfPipeline := manifest.NewOVF(buildPipeline, vmdkPipeline)
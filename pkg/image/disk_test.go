@@ -0,0 +1,78 @@
+package image_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/image"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func TestDiskImageDataDisks(t *testing.T) {
+	for _, tc := range []struct {
+		format          platform.ImageFormat
+		expectedExports []string
+	}{
+		{platform.FORMAT_RAW, []string{"data0", "data1"}},
+		{platform.FORMAT_QCOW2, []string{"data0-qcow2", "data1-qcow2"}},
+	} {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			img := image.NewDiskImage(&platform.Data{
+				Arch:        arch.ARCH_X86_64,
+				ImageFormat: tc.format,
+			}, "disk.img")
+			img.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot/efi")
+			img.DataPartitionTables = []*disk.PartitionTable{
+				testdisk.MakeFakePartitionTable("/data"),
+				testdisk.MakeFakePartitionTable("/srv"),
+			}
+
+			m := &manifest.Manifest{}
+			/* #nosec G404 */
+			rng := rand.New(rand.NewSource(0))
+			_, err := img.InstantiateManifest(m, nil, &runner.Fedora{Version: 42}, rng)
+			require.NoError(t, err)
+
+			exports := m.GetExports()
+			for idx, name := range tc.expectedExports {
+				assert.Equal(t, name, image.DataDiskExport(idx, tc.format))
+				assert.Contains(t, exports, name)
+			}
+		})
+	}
+}
+
+func TestDiskImageDataDisksUnsupported(t *testing.T) {
+	for _, tc := range []struct {
+		format      platform.ImageFormat
+		compression string
+		expectedErr string
+	}{
+		{platform.FORMAT_VMDK, "", "data disks are not supported for image format vmdk"},
+		{platform.FORMAT_RAW, "xz", "data disks are not supported with compression (xz)"},
+	} {
+		t.Run(tc.format.String()+tc.compression, func(t *testing.T) {
+			img := image.NewDiskImage(&platform.Data{
+				Arch:        arch.ARCH_X86_64,
+				ImageFormat: tc.format,
+			}, "disk.img")
+			img.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot/efi")
+			img.DataPartitionTables = []*disk.PartitionTable{testdisk.MakeFakePartitionTable("/data")}
+			img.Compression = tc.compression
+
+			m := &manifest.Manifest{}
+			/* #nosec G404 */
+			rng := rand.New(rand.NewSource(0))
+			_, err := img.InstantiateManifest(m, nil, &runner.Fedora{Version: 42}, rng)
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
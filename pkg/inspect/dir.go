@@ -0,0 +1,64 @@
+package inspect
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// dirNode is a file of a directory tree on the host, e.g. an unpacked
+// container image or an ostree repository.
+type dirNode struct {
+	path string
+	fi   *fileInfo
+}
+
+func newDirNode(p, name string) (*dirNode, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	fi := &fileInfo{
+		name:    name,
+		size:    info.Size(),
+		mode:    info.Mode(),
+		modTime: info.ModTime(),
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		fi.owner = Owner{UID: st.Uid, GID: st.Gid}
+	}
+	return &dirNode{path: p, fi: fi}, nil
+}
+
+func (n *dirNode) info() *fileInfo {
+	return n.fi
+}
+
+func (n *dirNode) lookup(name string) (node, error) {
+	return newDirNode(filepath.Join(n.path, name), name)
+}
+
+func (n *dirNode) readDir() ([]node, error) {
+	entries, err := os.ReadDir(n.path)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]node, 0, len(entries))
+	for _, entry := range entries {
+		child, err := newDirNode(filepath.Join(n.path, entry.Name()), entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, child)
+	}
+	return nodes, nil
+}
+
+func (n *dirNode) readLink() (string, error) {
+	return os.Readlink(n.path)
+}
+
+func (n *dirNode) open() (io.Reader, error) {
+	return os.Open(n.path)
+}
@@ -0,0 +1,470 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ext4 (and ext2/ext3) on-disk format, see
+// https://www.kernel.org/doc/html/latest/filesystems/ext4/
+
+const (
+	ext4SuperblockOffset = 1024
+	ext4Magic            = 0xef53
+	ext4RootInode        = 2
+
+	ext4CompatJournal = 0x4
+
+	ext4IncompatFiletype   = 0x2
+	ext4IncompatExtents    = 0x40
+	ext4Incompat64Bit      = 0x80
+	ext4IncompatInlineData = 0x8000
+
+	ext4InodeFlagExtents    = 0x80000
+	ext4InodeFlagInlineData = 0x10000000
+
+	ext4ExtentMagic = 0xf30a
+)
+
+// ext4SupportedIncompat are the incompatible features the reader
+// understands, filesystems with other incompatible features (e.g.
+// compression, meta_bg or encryption) are rejected.
+const ext4SupportedIncompat = ext4IncompatFiletype | ext4IncompatExtents | ext4Incompat64Bit | ext4IncompatInlineData |
+	0x4 | // recover, the journal is ignored
+	0x100 | // mmp
+	0x200 | // flex_bg
+	0x400 | // ea_inode
+	0x2000 | // csum_seed
+	0x4000 // largedir
+
+type ext4FS struct {
+	dev io.ReaderAt
+
+	blockSize      int64
+	inodeSize      int64
+	inodesPerGroup uint32
+	descSize       int64
+	descTable      int64
+	incompat       uint32
+
+	fsType string
+	uuid   string
+	label  string
+}
+
+// probeExt4 returns whether the device contains an ext2/3/4 filesystem.
+func probeExt4(dev io.ReaderAt) bool {
+	b := make([]byte, 2)
+	if err := readFull(dev, b, ext4SuperblockOffset+0x38); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint16(b) == ext4Magic
+}
+
+func openExt4(dev io.ReaderAt) (*ext4FS, error) {
+	sb, err := readBytes(dev, ext4SuperblockOffset, 1024)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ext4 superblock: %w", err)
+	}
+	le := binary.LittleEndian
+	if le.Uint16(sb[0x38:]) != ext4Magic {
+		return nil, fmt.Errorf("no ext4 superblock found")
+	}
+
+	e := &ext4FS{
+		dev:            dev,
+		blockSize:      1024 << le.Uint32(sb[0x18:]),
+		inodeSize:      128,
+		inodesPerGroup: le.Uint32(sb[0x28:]),
+		descSize:       32,
+		incompat:       le.Uint32(sb[0x60:]),
+		label:          string(bytes.TrimRight(sb[0x78:0x88], "\x00")),
+	}
+	if le.Uint32(sb[0x4c:]) >= 1 {
+		e.inodeSize = int64(le.Uint16(sb[0x58:]))
+	}
+	if e.incompat&ext4Incompat64Bit != 0 {
+		e.descSize = int64(le.Uint16(sb[0xfe:]))
+	}
+	if unsupported := e.incompat &^ ext4SupportedIncompat; unsupported != 0 {
+		return nil, fmt.Errorf("unsupported ext4 features: %#x", unsupported)
+	}
+	if e.inodesPerGroup == 0 || e.inodeSize < 128 || e.descSize < 32 {
+		return nil, fmt.Errorf("invalid ext4 superblock")
+	}
+	id, err := uuid.FromBytes(sb[0x68:0x78])
+	if err != nil {
+		return nil, err
+	}
+	e.uuid = id.String()
+
+	// the same distinction as blkid makes
+	switch {
+	case e.incompat&^(ext4IncompatFiletype|0x4) != 0:
+		e.fsType = "ext4"
+	case le.Uint32(sb[0x5c:])&ext4CompatJournal != 0:
+		e.fsType = "ext3"
+	default:
+		e.fsType = "ext2"
+	}
+
+	// the group descriptors follow the block of the superblock
+	e.descTable = (int64(le.Uint32(sb[0x14:])) + 1) * e.blockSize
+	return e, nil
+}
+
+func (e *ext4FS) root() (node, error) {
+	return e.node(ext4RootInode, ".")
+}
+
+type ext4Inode struct {
+	mode  uint16
+	uid   uint32
+	gid   uint32
+	size  int64
+	mtime time.Time
+	flags uint32
+	block []byte
+	raw   []byte
+}
+
+func (e *ext4FS) readInode(ino uint32) (*ext4Inode, error) {
+	if ino == 0 {
+		return nil, fmt.Errorf("invalid inode number 0")
+	}
+	group := int64((ino - 1) / e.inodesPerGroup)
+	index := int64((ino - 1) % e.inodesPerGroup)
+
+	le := binary.LittleEndian
+	desc, err := readBytes(e.dev, e.descTable+group*e.descSize, int(e.descSize))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read group descriptor %d: %w", group, err)
+	}
+	table := int64(le.Uint32(desc[0x8:]))
+	if e.incompat&ext4Incompat64Bit != 0 && e.descSize >= 64 {
+		table |= int64(le.Uint32(desc[0x28:])) << 32
+	}
+
+	raw, err := readBytes(e.dev, table*e.blockSize+index*e.inodeSize, int(e.inodeSize))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read inode %d: %w", ino, err)
+	}
+	return &ext4Inode{
+		mode:  le.Uint16(raw[0x0:]),
+		uid:   uint32(le.Uint16(raw[0x2:])) | uint32(le.Uint16(raw[0x78:]))<<16,
+		gid:   uint32(le.Uint16(raw[0x18:])) | uint32(le.Uint16(raw[0x7a:]))<<16,
+		size:  int64(le.Uint32(raw[0x4:])) | int64(le.Uint32(raw[0x6c:]))<<32,
+		mtime: time.Unix(int64(int32(le.Uint32(raw[0x10:]))), 0),
+		flags: le.Uint32(raw[0x20:]),
+		block: raw[0x28:0x64],
+		raw:   raw,
+	}, nil
+}
+
+func (e *ext4FS) node(ino uint32, name string) (*ext4Node, error) {
+	inode, err := e.readInode(ino)
+	if err != nil {
+		return nil, err
+	}
+	return &ext4Node{
+		fs:    e,
+		inode: inode,
+		fi: &fileInfo{
+			name:    name,
+			size:    inode.size,
+			mode:    unixMode(uint32(inode.mode)),
+			modTime: inode.mtime,
+			owner:   Owner{UID: inode.uid, GID: inode.gid},
+		},
+	}, nil
+}
+
+// extents returns the extents of the content of an inode.
+func (e *ext4FS) extents(inode *ext4Inode) ([]extent, error) {
+	if inode.flags&ext4InodeFlagExtents != 0 {
+		return e.extentTree(inode.block, 0)
+	}
+	return e.blockMap(inode)
+}
+
+// extentTree collects the extents of an extent tree node.
+func (e *ext4FS) extentTree(data []byte, depth int) ([]extent, error) {
+	le := binary.LittleEndian
+	if len(data) < 12 || le.Uint16(data[0:]) != ext4ExtentMagic {
+		return nil, fmt.Errorf("invalid ext4 extent header")
+	}
+	if depth > 5 {
+		return nil, fmt.Errorf("ext4 extent tree too deep")
+	}
+	entries := int(le.Uint16(data[2:]))
+	level := le.Uint16(data[6:])
+	if 12+entries*12 > len(data) {
+		return nil, fmt.Errorf("invalid ext4 extent header")
+	}
+
+	var extents []extent
+	for idx := 0; idx < entries; idx++ {
+		entry := data[12+idx*12:]
+		if level == 0 {
+			length := int64(le.Uint16(entry[4:]))
+			physical := (int64(le.Uint16(entry[6:]))<<32 | int64(le.Uint32(entry[8:]))) * e.blockSize
+			if length > 32768 {
+				// uninitialized extent
+				length -= 32768
+				physical = -1
+			}
+			extents = append(extents, extent{
+				logical:  int64(le.Uint32(entry[0:])) * e.blockSize,
+				physical: physical,
+				length:   length * e.blockSize,
+			})
+			continue
+		}
+		leaf := int64(le.Uint16(entry[8:]))<<32 | int64(le.Uint32(entry[4:]))
+		child, err := readBytes(e.dev, leaf*e.blockSize, int(e.blockSize))
+		if err != nil {
+			return nil, err
+		}
+		childExtents, err := e.extentTree(child, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, childExtents...)
+	}
+	return extents, nil
+}
+
+// blockMap collects the blocks of an inode that uses the direct and
+// indirect block maps of ext2 and ext3.
+func (e *ext4FS) blockMap(inode *ext4Inode) ([]extent, error) {
+	le := binary.LittleEndian
+	nblocks := (inode.size + e.blockSize - 1) / e.blockSize
+	var extents []extent
+	var logical int64
+	add := func(block uint32) {
+		if block != 0 {
+			physical := int64(block) * e.blockSize
+			if n := len(extents); n > 0 && extents[n-1].logical+extents[n-1].length == logical*e.blockSize &&
+				extents[n-1].physical+extents[n-1].length == physical {
+				extents[n-1].length += e.blockSize
+			} else {
+				extents = append(extents, extent{logical: logical * e.blockSize, physical: physical, length: e.blockSize})
+			}
+		}
+		logical++
+	}
+
+	var walk func(block uint32, level int) error
+	walk = func(block uint32, level int) error {
+		perBlock := e.blockSize / 4
+		if block == 0 {
+			span := int64(1)
+			for i := 0; i < level; i++ {
+				span *= perBlock
+			}
+			logical += span
+			return nil
+		}
+		data, err := readBytes(e.dev, int64(block)*e.blockSize, int(e.blockSize))
+		if err != nil {
+			return err
+		}
+		for idx := int64(0); idx < perBlock && logical < nblocks; idx++ {
+			ptr := le.Uint32(data[idx*4:])
+			if level == 1 {
+				add(ptr)
+			} else if err := walk(ptr, level-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for idx := 0; idx < 15 && logical < nblocks; idx++ {
+		ptr := le.Uint32(inode.block[idx*4:])
+		if idx < 12 {
+			add(ptr)
+			continue
+		}
+		if err := walk(ptr, idx-11); err != nil {
+			return nil, err
+		}
+	}
+	return extents, nil
+}
+
+// inlineData returns the content of an inode with inline data, which is
+// stored in the block map and the "system.data" extended attribute.
+func (e *ext4FS) inlineData(inode *ext4Inode) ([]byte, error) {
+	data := append([]byte(nil), inode.block...)
+	if inode.size <= int64(len(data)) {
+		return data[:inode.size], nil
+	}
+
+	le := binary.LittleEndian
+	if len(inode.raw) < 0x84 {
+		return nil, fmt.Errorf("invalid ext4 inline data")
+	}
+	// the in-inode extended attributes follow the extra inode fields
+	xattrs := inode.raw[0x80+int(le.Uint16(inode.raw[0x80:])):]
+	if len(xattrs) < 4 || le.Uint32(xattrs) != 0xea020000 {
+		return nil, fmt.Errorf("invalid ext4 inline data")
+	}
+	entries := xattrs[4:]
+	for pos := 0; pos+16 <= len(entries) && le.Uint32(entries[pos:]) != 0; {
+		nameLen := int(entries[pos])
+		index := entries[pos+1]
+		valueOffset := int(le.Uint16(entries[pos+2:]))
+		valueSize := int(le.Uint32(entries[pos+8:]))
+		if pos+16+nameLen > len(entries) {
+			break
+		}
+		name := string(entries[pos+16 : pos+16+nameLen])
+		// name index 7 is the "system." prefix
+		if index == 7 && name == "data" {
+			if valueOffset+valueSize > len(entries) {
+				return nil, fmt.Errorf("invalid ext4 inline data")
+			}
+			data = append(data, entries[valueOffset:valueOffset+valueSize]...)
+			if int64(len(data)) < inode.size {
+				return nil, fmt.Errorf("truncated ext4 inline data")
+			}
+			return data[:inode.size], nil
+		}
+		pos += (16 + nameLen + 3) &^ 3
+	}
+	return nil, fmt.Errorf("ext4 inline data attribute not found")
+}
+
+func (e *ext4FS) content(inode *ext4Inode) (io.Reader, error) {
+	if inode.flags&ext4InodeFlagInlineData != 0 {
+		data, err := e.inlineData(inode)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+	extents, err := e.extents(inode)
+	if err != nil {
+		return nil, err
+	}
+	return newExtentReader(e.dev, extents, inode.size), nil
+}
+
+type ext4Node struct {
+	fs    *ext4FS
+	inode *ext4Inode
+	fi    *fileInfo
+}
+
+func (n *ext4Node) info() *fileInfo {
+	return n.fi
+}
+
+type ext4DirEntry struct {
+	ino  uint32
+	name string
+}
+
+func (n *ext4Node) entries() ([]ext4DirEntry, error) {
+	var data []byte
+	var blockSize int
+	if n.inode.flags&ext4InodeFlagInlineData != 0 {
+		inline, err := n.fs.inlineData(n.inode)
+		if err != nil {
+			return nil, err
+		}
+		// inline directories start with the inode number of the parent
+		// instead of "." and ".." entries
+		if len(inline) < 4 {
+			return nil, fmt.Errorf("invalid ext4 inline directory")
+		}
+		data = inline[4:]
+		blockSize = len(data)
+	} else {
+		r, err := n.fs.content(n.inode)
+		if err != nil {
+			return nil, err
+		}
+		data, err = io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		blockSize = int(n.fs.blockSize)
+	}
+
+	le := binary.LittleEndian
+	var entries []ext4DirEntry
+	for block := 0; block < len(data); block += blockSize {
+		end := min(block+blockSize, len(data))
+		for pos := block; pos+8 <= end; {
+			ino := le.Uint32(data[pos:])
+			recLen := int(le.Uint16(data[pos+4:]))
+			nameLen := int(data[pos+6])
+			if recLen < 8 || pos+recLen > end || 8+nameLen > recLen {
+				return nil, fmt.Errorf("invalid ext4 directory entry")
+			}
+			// unused entries, htree nodes and checksum tails have inode 0
+			if ino != 0 {
+				name := string(data[pos+8 : pos+8+nameLen])
+				if name != "." && name != ".." {
+					entries = append(entries, ext4DirEntry{ino: ino, name: name})
+				}
+			}
+			pos += recLen
+		}
+	}
+	return entries, nil
+}
+
+func (n *ext4Node) lookup(name string) (node, error) {
+	entries, err := n.entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.name == name {
+			return n.fs.node(entry.ino, entry.name)
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (n *ext4Node) readDir() ([]node, error) {
+	entries, err := n.entries()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]node, 0, len(entries))
+	for _, entry := range entries {
+		child, err := n.fs.node(entry.ino, entry.name)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, child)
+	}
+	return nodes, nil
+}
+
+func (n *ext4Node) readLink() (string, error) {
+	// fast symlinks are stored in the block map
+	if n.inode.flags&(ext4InodeFlagExtents|ext4InodeFlagInlineData) == 0 && n.inode.size < int64(len(n.inode.block)) {
+		return string(n.inode.block[:n.inode.size]), nil
+	}
+	r, err := n.fs.content(n.inode)
+	if err != nil {
+		return "", err
+	}
+	target, err := io.ReadAll(r)
+	return string(target), err
+}
+
+func (n *ext4Node) open() (io.Reader, error) {
+	return n.fs.content(n.inode)
+}
@@ -0,0 +1,100 @@
+package inspect
+
+import (
+	"io"
+	"sort"
+)
+
+// extent maps a contiguous range of a file to a range of the device the
+// file is stored on.
+type extent struct {
+	// logical is the offset in the file
+	logical int64
+	// physical is the offset on the device, negative for unwritten
+	// (preallocated) extents that read as zeros
+	physical int64
+	length   int64
+}
+
+// extentReader implements io.ReaderAt for the content of a file that is
+// stored in extents. Ranges that are not covered by any extent are holes
+// and read as zeros.
+type extentReader struct {
+	dev     io.ReaderAt
+	extents []extent
+	size    int64
+}
+
+// newExtentReader returns a reader for a file of the given size stored in
+// the given extents on the device.
+func newExtentReader(dev io.ReaderAt, extents []extent, size int64) *io.SectionReader {
+	sorted := append([]extent(nil), extents...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].logical < sorted[j].logical
+	})
+	return io.NewSectionReader(&extentReader{dev: dev, extents: sorted, size: size}, 0, size)
+}
+
+func (r *extentReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if int64(want) > r.size-off {
+		p = p[:r.size-off]
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		// first extent that ends after pos
+		idx := sort.Search(len(r.extents), func(i int) bool {
+			return r.extents[i].logical+r.extents[i].length > pos
+		})
+
+		var chunk int64
+		if idx == len(r.extents) || r.extents[idx].logical > pos {
+			// hole up to the next extent
+			chunk = int64(len(p) - n)
+			if idx < len(r.extents) {
+				chunk = min(chunk, r.extents[idx].logical-pos)
+			}
+			clear(p[n : n+int(chunk)])
+		} else {
+			e := r.extents[idx]
+			chunk = min(int64(len(p)-n), e.logical+e.length-pos)
+			if e.physical < 0 {
+				clear(p[n : n+int(chunk)])
+			} else if _, err := r.dev.ReadAt(p[n:n+int(chunk)], e.physical+pos-e.logical); err != nil {
+				return n, err
+			}
+		}
+		n += int(chunk)
+	}
+
+	if n < want {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readFull reads exactly len(b) bytes at the offset of the reader.
+func readFull(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readBytes reads size bytes at the offset of the reader.
+func readBytes(r io.ReaderAt, off int64, size int) ([]byte, error) {
+	b := make([]byte, size)
+	if err := readFull(r, b, off); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,124 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// FstabEntry is an entry of the /etc/fstab of a tree.
+type FstabEntry struct {
+	Spec       string
+	Mountpoint string
+	FSType     string
+	Options    string
+}
+
+// unescapeFstab decodes the octal escapes of fstab fields, e.g. "\040" for
+// a space.
+func unescapeFstab(field string) string {
+	var sb strings.Builder
+	for idx := 0; idx < len(field); idx++ {
+		if field[idx] == '\\' && idx+4 <= len(field) {
+			if c, err := strconv.ParseUint(field[idx+1:idx+4], 8, 8); err == nil {
+				sb.WriteByte(byte(c))
+				idx += 3
+				continue
+			}
+		}
+		sb.WriteByte(field[idx])
+	}
+	return sb.String()
+}
+
+// Fstab returns the entries of the /etc/fstab of the tree, nil if the tree
+// has no fstab.
+func (t *Tree) Fstab() ([]FstabEntry, error) {
+	data, err := t.ReadFile("etc/fstab")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []FstabEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid fstab line %q", line)
+		}
+		entry := FstabEntry{
+			Spec:       unescapeFstab(fields[0]),
+			Mountpoint: unescapeFstab(fields[1]),
+		}
+		if len(fields) > 2 {
+			entry.FSType = fields[2]
+		}
+		if len(fields) > 3 {
+			entry.Options = fields[3]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// matches returns whether the fstab spec refers to the volume.
+func (vol *Volume) matches(spec string) bool {
+	for _, tag := range []struct {
+		key, byPath string
+		value       string
+	}{
+		{"UUID=", "/dev/disk/by-uuid/", vol.UUID},
+		{"LABEL=", "/dev/disk/by-label/", vol.Label},
+		{"PARTUUID=", "/dev/disk/by-partuuid/", vol.PartUUID},
+		{"PARTLABEL=", "/dev/disk/by-partlabel/", vol.PartLabel},
+	} {
+		if tag.value == "" {
+			continue
+		}
+		value, ok := strings.CutPrefix(spec, tag.key)
+		if !ok {
+			value, ok = strings.CutPrefix(spec, tag.byPath)
+		}
+		if ok && strings.EqualFold(strings.Trim(value, `"`), tag.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountFstab mounts the volumes at the mountpoints of the fstab of the
+// tree. Entries of filesystems that are not in the image, e.g. network
+// filesystems, are ignored.
+func (t *Tree) mountFstab() error {
+	entries, err := t.Fstab()
+	if err != nil {
+		return fmt.Errorf("cannot read fstab: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Mountpoint == "/" || !strings.HasPrefix(entry.Mountpoint, "/") {
+			// the root is already mounted and swap has no mountpoint
+			continue
+		}
+		for idx := range t.Volumes {
+			vol := &t.Volumes[idx]
+			if vol.root == nil || !vol.matches(entry.Spec) {
+				continue
+			}
+			vol.Mountpoint = entry.Mountpoint
+			t.mountAt(entry.Mountpoint, vol.root)
+			break
+		}
+	}
+	return nil
+}
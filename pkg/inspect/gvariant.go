@@ -0,0 +1,224 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// A minimal decoder for the GVariant serialization format that is used for
+// the metadata objects of ostree repositories, see
+// https://people.gnome.org/~desrt/gvariant-serialisation.pdf
+//
+// Only the types used by ostree are supported: basic types, strings,
+// variants, arrays, tuples and dictionary entries.
+
+type gvType struct {
+	kind byte
+	// elem is the element type of arrays
+	elem *gvType
+	// fields are the member types of tuples and dictionary entries
+	fields []*gvType
+	// size is the size of fixed-size types, 0 for variable-size types
+	size  int
+	align int
+}
+
+var gvBasicSizes = map[byte]int{
+	'b': 1, 'y': 1, 'n': 2, 'q': 2, 'i': 4, 'u': 4, 'h': 4, 'x': 8, 't': 8, 'd': 8,
+}
+
+// parseGVType parses a GVariant type string.
+func parseGVType(sig string) (*gvType, error) {
+	t, rest, err := parseGVTypePrefix(sig)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid GVariant type %q", sig)
+	}
+	return t, nil
+}
+
+func mustParseGVType(sig string) *gvType {
+	t, err := parseGVType(sig)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parseGVTypePrefix(sig string) (*gvType, string, error) {
+	if sig == "" {
+		return nil, "", fmt.Errorf("empty GVariant type")
+	}
+	kind := sig[0]
+	switch {
+	case gvBasicSizes[kind] != 0:
+		size := gvBasicSizes[kind]
+		return &gvType{kind: kind, size: size, align: size}, sig[1:], nil
+	case kind == 's' || kind == 'o' || kind == 'g':
+		return &gvType{kind: kind, align: 1}, sig[1:], nil
+	case kind == 'v':
+		return &gvType{kind: kind, align: 8}, sig[1:], nil
+	case kind == 'a':
+		elem, rest, err := parseGVTypePrefix(sig[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		return &gvType{kind: kind, elem: elem, align: elem.align}, rest, nil
+	case kind == '(' || kind == '{':
+		end := byte(')')
+		if kind == '{' {
+			end = '}'
+		}
+		t := &gvType{kind: kind, align: 1}
+		rest := sig[1:]
+		fixed := true
+		offset := 0
+		for rest != "" && rest[0] != end {
+			field, r, err := parseGVTypePrefix(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			rest = r
+			t.fields = append(t.fields, field)
+			t.align = max(t.align, field.align)
+			if field.size == 0 {
+				fixed = false
+			}
+			offset = alignTo(offset, field.align) + field.size
+		}
+		if rest == "" {
+			return nil, "", fmt.Errorf("unterminated GVariant type %q", sig)
+		}
+		if fixed {
+			// the unit type has a size of 1
+			t.size = max(alignTo(offset, t.align), 1)
+		}
+		return t, rest[1:], nil
+	}
+	return nil, "", fmt.Errorf("unsupported GVariant type %q", sig)
+}
+
+func alignTo(offset, align int) int {
+	return (offset + align - 1) &^ (align - 1)
+}
+
+// gvOffsetSize returns the size of the framing offsets of a container of
+// the given size.
+func gvOffsetSize(size int) int {
+	switch {
+	case size == 0:
+		return 0
+	case size <= 0xff:
+		return 1
+	case size <= 0xffff:
+		return 2
+	case size <= 0xffffffff:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func gvReadOffset(data []byte, size int) int {
+	switch size {
+	case 1:
+		return int(data[0])
+	case 2:
+		return int(binary.LittleEndian.Uint16(data))
+	case 4:
+		return int(binary.LittleEndian.Uint32(data))
+	default:
+		return int(binary.LittleEndian.Uint64(data))
+	}
+}
+
+// members returns the serialized members of a tuple or dictionary entry.
+func (t *gvType) members(data []byte) ([][]byte, error) {
+	offsetSize := gvOffsetSize(len(data))
+	// framing offsets of the variable-size members, except the last
+	// member, are stored in reverse order at the end
+	offsetsEnd := len(data)
+	nextOffset := func() (int, error) {
+		if offsetsEnd-offsetSize < 0 {
+			return 0, fmt.Errorf("invalid GVariant framing offsets")
+		}
+		offsetsEnd -= offsetSize
+		return gvReadOffset(data[offsetsEnd:], offsetSize), nil
+	}
+
+	members := make([][]byte, len(t.fields))
+	pos := 0
+	for idx, field := range t.fields {
+		start := alignTo(pos, field.align)
+		var end int
+		switch {
+		case field.size != 0:
+			end = start + field.size
+		case idx == len(t.fields)-1:
+			end = offsetsEnd
+		default:
+			var err error
+			if end, err = nextOffset(); err != nil {
+				return nil, err
+			}
+		}
+		if start > end || end > offsetsEnd {
+			return nil, fmt.Errorf("invalid GVariant tuple")
+		}
+		members[idx] = data[start:end]
+		pos = end
+	}
+	return members, nil
+}
+
+// elements returns the serialized elements of an array.
+func (t *gvType) elements(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	elem := t.elem
+	if elem.size != 0 {
+		if len(data)%elem.size != 0 {
+			return nil, fmt.Errorf("invalid GVariant array")
+		}
+		elements := make([][]byte, 0, len(data)/elem.size)
+		for pos := 0; pos < len(data); pos += elem.size {
+			elements = append(elements, data[pos:pos+elem.size])
+		}
+		return elements, nil
+	}
+
+	offsetSize := gvOffsetSize(len(data))
+	offsetsStart := gvReadOffset(data[len(data)-offsetSize:], offsetSize)
+	if offsetsStart > len(data) || (len(data)-offsetsStart)%offsetSize != 0 {
+		return nil, fmt.Errorf("invalid GVariant array")
+	}
+	count := (len(data) - offsetsStart) / offsetSize
+	elements := make([][]byte, 0, count)
+	pos := 0
+	for idx := 0; idx < count; idx++ {
+		start := alignTo(pos, elem.align)
+		end := gvReadOffset(data[offsetsStart+idx*offsetSize:], offsetSize)
+		if start > end || end > offsetsStart {
+			return nil, fmt.Errorf("invalid GVariant array")
+		}
+		elements = append(elements, data[start:end])
+		pos = end
+	}
+	return elements, nil
+}
+
+// gvString decodes a serialized string.
+func gvString(data []byte) (string, error) {
+	if len(data) == 0 || data[len(data)-1] != 0 {
+		return "", fmt.Errorf("invalid GVariant string")
+	}
+	s := data[:len(data)-1]
+	if bytes.IndexByte(s, 0) >= 0 {
+		return "", fmt.Errorf("invalid GVariant string")
+	}
+	return string(s), nil
+}
@@ -0,0 +1,493 @@
+// Package inspect reads the content of built image artifacts without
+// booting or mounting them, so that they can be verified right after the
+// build, e.g. in CI.
+//
+// Disk images (raw or qcow2) are read by parsing the GPT or MBR partition
+// table and the ext4, xfs and vfat filesystems on the partitions. The
+// filesystem with the root tree is found by its content and the other
+// filesystems are mounted according to its /etc/fstab. For ostree based
+// disk images the tree of the deployment is used. Archives (tar, OCI image
+// layouts and ostree repositories in archive mode, as plain directories or
+// tar archives) are read by indexing their content.
+//
+// The result is a Tree, a read-only fs.FS of the root filesystem.
+package inspect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Format is the format of an inspected artifact.
+type Format string
+
+const (
+	FormatRaw       Format = "raw"
+	FormatQCOW2     Format = "qcow2"
+	FormatTar       Format = "tar"
+	FormatOCI       Format = "oci"
+	FormatOSTree    Format = "ostree"
+	FormatDirectory Format = "directory"
+)
+
+// Options are the options of Open.
+type Options struct {
+	// Ref is the ref or commit checksum to inspect in ostree
+	// repositories, it can be empty if the repository has a single ref.
+	Ref string
+}
+
+// Volume describes a partition or filesystem of an inspected disk image.
+type Volume struct {
+	// Partition is the number of the partition, 0 if the image is not
+	// partitioned.
+	Partition int
+	// Start and Size are the offset and size of the partition in bytes.
+	Start int64
+	Size  int64
+
+	// PartType is the partition type GUID (GPT) or the hexadecimal
+	// partition type ID (MBR).
+	PartType  string
+	PartUUID  string
+	PartLabel string
+
+	// FSType is the type of the filesystem or other content of the
+	// partition, using the names of blkid. Only "ext2", "ext3", "ext4",
+	// "xfs" and "vfat" filesystems can be read.
+	FSType string
+	UUID   string
+	Label  string
+
+	// Mountpoint is where the filesystem is mounted in the tree, empty if
+	// it is not mounted.
+	Mountpoint string
+
+	root node
+}
+
+// Open opens the artifact at the given path for inspection. The format of
+// the artifact is detected from its content. The returned tree must be
+// closed after use.
+func Open(name string, opts *Options) (tree *Tree, err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	t := &Tree{}
+	defer func() {
+		if err != nil {
+			t.Close()
+		}
+	}()
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		root, err := newDirNode(name, ".")
+		if err != nil {
+			return nil, err
+		}
+		if err := t.openArchive(FormatDirectory, root, opts); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	t.closers = append(t.closers, f)
+	if err := t.openFile(f, info.Size(), opts); err != nil {
+		return nil, fmt.Errorf("cannot inspect %s: %w", name, err)
+	}
+	return t, nil
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte("\xfd7zXZ\x00")
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// isTar returns whether the file starts with a tar header.
+func isTar(r io.ReaderAt) bool {
+	magic := make([]byte, 5)
+	if err := readFull(r, magic, 257); err != nil {
+		return false
+	}
+	return string(magic) == "ustar"
+}
+
+func (t *Tree) openFile(f io.ReaderAt, size int64, opts *Options) error {
+	switch {
+	case probeQCOW2(f):
+		img, err := openQCOW2(f)
+		if err != nil {
+			return err
+		}
+		t.Format = FormatQCOW2
+		return t.openDisk(img, img.Size())
+	case isTar(f):
+		return t.openTar(f, size, opts)
+	}
+
+	archive, archiveSize, err := t.decompress(f, size)
+	if err != nil {
+		return err
+	}
+	if archive != f {
+		if !isTar(archive) {
+			return fmt.Errorf("compressed file is not a tar archive")
+		}
+		return t.openTar(archive, archiveSize, opts)
+	}
+
+	t.Format = FormatRaw
+	return t.openDisk(f, size)
+}
+
+func (t *Tree) openTar(archive io.ReaderAt, size int64, opts *Options) error {
+	tfs := newTarFS()
+	if err := tfs.readTar(archive, size, false); err != nil {
+		return err
+	}
+	return t.openArchive(FormatTar, tfs.root(), opts)
+}
+
+// openArchive sets the root of the tree to the content of an archive,
+// which can be the plain tree, an OCI image layout or an ostree repository.
+func (t *Tree) openArchive(format Format, root node, opts *Options) error {
+	if isOCILayout(root) {
+		rootfs, err := t.openOCILayout(root)
+		if err != nil {
+			return err
+		}
+		t.Format = FormatOCI
+		t.mountAt(".", rootfs)
+		return nil
+	}
+
+	// ostree commits are archived with the repository in a "repo"
+	// directory
+	repoRoot := root
+	if sub, err := root.lookup("repo"); err == nil && sub.info().IsDir() && isOSTreeRepo(sub) {
+		repoRoot = sub
+	}
+	if isOSTreeRepo(repoRoot) {
+		repo := &ostreeRepo{root: repoRoot}
+		if err := repo.checkMode(); err != nil {
+			return err
+		}
+		checksum, err := repo.resolveRef(opts.Ref)
+		if err != nil {
+			return err
+		}
+		rootfs, err := repo.commitTree(checksum)
+		if err != nil {
+			return err
+		}
+		t.Format = FormatOSTree
+		t.mountAt(".", rootfs)
+		return nil
+	}
+
+	t.Format = format
+	t.mountAt(".", root)
+	return nil
+}
+
+// spool copies the content of the reader to an anonymous temporary file
+// that is removed when the tree is closed.
+func (t *Tree) spool(r io.Reader) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "inspect-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	// the file is removed right away, it exists until it is closed
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	t.closers = append(t.closers, f)
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+// decompress returns the decompressed content of gzip compressed data,
+// uncompressed data is returned as is.
+func (t *Tree) decompress(r io.ReaderAt, size int64) (io.ReaderAt, int64, error) {
+	magic := make([]byte, 6)
+	if err := readFull(r, magic, 0); err != nil {
+		return r, size, nil
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, 0, err
+		}
+		defer zr.Close()
+		return t.spool(zr)
+	case bytes.HasPrefix(magic, xzMagic):
+		return nil, 0, fmt.Errorf("xz compression is not supported")
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, 0, fmt.Errorf("zstd compression is not supported")
+	}
+	return r, size, nil
+}
+
+// readerAt returns random access to the content of a regular file node.
+// Content that only supports sequential reads is copied to a temporary
+// file.
+func (t *Tree) readerAt(n node) (io.ReaderAt, int64, error) {
+	rd, err := n.open()
+	if err != nil {
+		return nil, 0, err
+	}
+	if c, ok := rd.(io.Closer); ok {
+		t.closers = append(t.closers, c)
+	}
+	if ra, ok := rd.(io.ReaderAt); ok {
+		return ra, n.info().Size(), nil
+	}
+	return t.spool(rd)
+}
+
+// lookupPath returns the node at the relative path below the given node,
+// without resolving symlinks.
+func lookupPath(n node, p string) (node, error) {
+	for _, elem := range strings.Split(path.Clean(p), "/") {
+		if elem == "." {
+			continue
+		}
+		var err error
+		if n, err = n.lookup(elem); err != nil {
+			return nil, fmt.Errorf("cannot find %s: %w", p, err)
+		}
+	}
+	return n, nil
+}
+
+// readNodeFile returns the content of the regular file at the relative path
+// below the given node.
+func readNodeFile(n node, p string) ([]byte, error) {
+	n, err := lookupPath(n, p)
+	if err != nil {
+		return nil, err
+	}
+	if !n.info().Mode().IsRegular() {
+		return nil, fmt.Errorf("cannot read %s: not a regular file", p)
+	}
+	rd, err := n.open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader(rd)
+	return io.ReadAll(rd)
+}
+
+func closeReader(rd io.Reader) {
+	if c, ok := rd.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// openVolume detects the content of a partition and opens the supported
+// filesystems.
+func openVolume(dev io.ReaderAt, vol *Volume) error {
+	switch {
+	case probeXFS(dev):
+		x, err := openXFS(dev)
+		if err != nil {
+			return err
+		}
+		vol.FSType, vol.UUID, vol.Label = "xfs", x.uuid, x.label
+		vol.root, err = x.root()
+		return err
+	case probeExt4(dev):
+		e, err := openExt4(dev)
+		if err != nil {
+			return err
+		}
+		vol.FSType, vol.UUID, vol.Label = e.fsType, e.uuid, e.label
+		vol.root, err = e.root()
+		return err
+	case probeVFAT(dev):
+		v, err := openVFAT(dev)
+		if err != nil {
+			return err
+		}
+		vol.FSType, vol.UUID, vol.Label = "vfat", v.uuid, v.label
+		vol.root, err = v.root()
+		return err
+	}
+
+	// content that cannot be read, but is useful to report
+	for _, sig := range []struct {
+		offset int64
+		magic  string
+		fsType string
+	}{
+		{0, "LUKS\xba\xbe", "crypto_LUKS"},
+		{512, "LABELONE", "LVM2_member"},
+		{0x10040, "_BHRfS_M", "btrfs"},
+		{4086, "SWAPSPACE2", "swap"},
+		{0x1000, "\xfc\x4e\x2b\xa9", "linux_raid_member"},
+		{0, "hsqs", "squashfs"},
+		{1024, "\xe2\xe1\xf5\xe0", "erofs"},
+	} {
+		magic := make([]byte, len(sig.magic))
+		if err := readFull(dev, magic, sig.offset); err == nil && string(magic) == sig.magic {
+			vol.FSType = sig.fsType
+			return nil
+		}
+	}
+	return nil
+}
+
+// openDisk reads the partitions of a disk image and mounts their
+// filesystems in the tree.
+func (t *Tree) openDisk(dev io.ReaderAt, size int64) error {
+	parts, err := readPartitions(dev)
+	if err != nil {
+		return err
+	}
+	if parts == nil {
+		parts = []partition{{size: size}}
+	}
+
+	for _, part := range parts {
+		vol := Volume{
+			Partition: part.number,
+			Start:     part.start,
+			Size:      part.size,
+			PartType:  part.partType,
+			PartUUID:  part.partUUID,
+			PartLabel: part.partLabel,
+		}
+		if err := openVolume(io.NewSectionReader(dev, part.start, part.size), &vol); err != nil {
+			return fmt.Errorf("cannot open partition %d: %w", part.number, err)
+		}
+		t.Volumes = append(t.Volumes, vol)
+	}
+
+	rootVol, err := t.findRootVolume()
+	if err != nil {
+		return err
+	}
+
+	sysroot := rootVol.root
+	if deployment, stateroot, err := ostreeDeployment(sysroot); err != nil {
+		return err
+	} else if deployment != nil {
+		rootVol.Mountpoint = "/sysroot"
+		t.mountAt(".", deployment)
+		t.mountAt("sysroot", sysroot)
+		t.mountAt("var", stateroot)
+		// without a separate boot partition the boot loader entries are
+		// in the physical root
+		if boot, err := sysroot.lookup("boot"); err == nil {
+			t.mountAt("boot", boot)
+		}
+	} else {
+		rootVol.Mountpoint = "/"
+		t.mountAt(".", sysroot)
+	}
+
+	return t.mountFstab()
+}
+
+// findRootVolume returns the volume with the root filesystem, which is the
+// only one with an /etc (or an ostree deployment).
+func (t *Tree) findRootVolume() (*Volume, error) {
+	var candidates []*Volume
+	var unsupported []string
+	for idx := range t.Volumes {
+		vol := &t.Volumes[idx]
+		if vol.root == nil {
+			if vol.FSType != "" {
+				unsupported = append(unsupported, fmt.Sprintf("partition %d (%s)", vol.Partition, vol.FSType))
+			}
+			continue
+		}
+		for _, marker := range []string{"etc", "ostree"} {
+			if n, err := vol.root.lookup(marker); err == nil && n.info().IsDir() {
+				candidates = append(candidates, vol)
+				break
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 1:
+		return candidates[0], nil
+	case 0:
+		msg := "cannot find the root filesystem"
+		if len(unsupported) > 0 {
+			msg += ", unsupported volumes: " + strings.Join(unsupported, ", ")
+		}
+		return nil, errors.New(msg)
+	default:
+		return nil, fmt.Errorf("found %d root filesystem candidates", len(candidates))
+	}
+}
+
+// ostreeDeployment returns the root of the deployment and the /var of its
+// stateroot if the physical root contains an ostree deployment. With
+// multiple deployments, the first one in the sort order is used.
+func ostreeDeployment(sysroot node) (node, node, error) {
+	deploy, err := lookupPath(sysroot, "ostree/deploy")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	stateroots, err := deploy.readDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(stateroots, func(i, j int) bool {
+		return stateroots[i].info().Name() < stateroots[j].info().Name()
+	})
+	for _, stateroot := range stateroots {
+		deployments, err := lookupPath(stateroot, "deploy")
+		if err != nil {
+			continue
+		}
+		children, err := deployments.readDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].info().Name() < children[j].info().Name()
+		})
+		for _, child := range children {
+			if !child.info().IsDir() {
+				// .origin files
+				continue
+			}
+			varDir, err := stateroot.lookup("var")
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot find /var of the ostree stateroot %s: %w", stateroot.info().Name(), err)
+			}
+			return child, varDir, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no ostree deployment found")
+}
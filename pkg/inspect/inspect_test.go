@@ -0,0 +1,492 @@
+package inspect_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/inspect"
+)
+
+const (
+	rootUUID = "6e4ff95f-f662-45ee-a82a-bdf44a2d0b75"
+	bootUUID = "0194fdc2-fa2f-4cc0-81d3-ff12045b73c8"
+
+	linuxFSGUID = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+)
+
+// writeTree creates the files in dir, values starting with "->" are
+// symlink targets and values ending with "/" are directories.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		switch {
+		case len(content) > 2 && content[:2] == "->":
+			require.NoError(t, os.Symlink(content[2:], p))
+		case len(content) > 0 && content[len(content)-1] == '/':
+			require.NoError(t, os.MkdirAll(p, 0755))
+		default:
+			require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+		}
+	}
+}
+
+// makeExt4 returns an ext4 filesystem with the given files.
+func makeExt4(t *testing.T, files map[string]string, fsUUID, label string) []byte {
+	t.Helper()
+	mkfs, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		t.Skip("mkfs.ext4 is not available")
+	}
+	src := t.TempDir()
+	writeTree(t, src, files)
+	img := filepath.Join(t.TempDir(), "fs.img")
+	out, err := exec.Command(mkfs, "-q", "-F", "-d", src, "-U", fsUUID, "-L", label, img, "16M").CombinedOutput()
+	require.NoError(t, err, string(out))
+	data, err := os.ReadFile(img)
+	require.NoError(t, err)
+	return data
+}
+
+// putGUID writes a GUID in the mixed-endian encoding of GPT.
+func putGUID(b []byte, s string) {
+	id := uuid.MustParse(s)
+	binary.LittleEndian.PutUint32(b[0:], binary.BigEndian.Uint32(id[0:]))
+	binary.LittleEndian.PutUint16(b[4:], binary.BigEndian.Uint16(id[4:]))
+	binary.LittleEndian.PutUint16(b[6:], binary.BigEndian.Uint16(id[6:]))
+	copy(b[8:], id[8:])
+}
+
+// makeGPTDisk returns a disk image with a GPT and a partition for each of
+// the filesystems. Checksums are not written as they are not verified.
+func makeGPTDisk(filesystems ...[]byte) []byte {
+	const sector = 512
+	start := int64(2048)
+	var disk []byte
+	entries := make([]byte, 128*128)
+	offsets := make([]int64, len(filesystems))
+	for idx, data := range filesystems {
+		sectors := (int64(len(data)) + sector - 1) / sector
+		entry := entries[idx*128:]
+		putGUID(entry[0:], linuxFSGUID)
+		putGUID(entry[16:], fmt.Sprintf("00000000-0000-0000-0000-%012d", idx+1))
+		binary.LittleEndian.PutUint64(entry[32:], uint64(start))
+		binary.LittleEndian.PutUint64(entry[40:], uint64(start+sectors-1))
+		for i, c := range fmt.Sprintf("part%d", idx+1) {
+			binary.LittleEndian.PutUint16(entry[56+i*2:], uint16(c))
+		}
+		offsets[idx] = start * sector
+		start += sectors
+	}
+	disk = make([]byte, (start+34)*sector)
+	disk[510], disk[511] = 0x55, 0xaa
+	hdr := disk[sector:]
+	copy(hdr, "EFI PART")
+	binary.LittleEndian.PutUint64(hdr[72:], 2)
+	binary.LittleEndian.PutUint32(hdr[80:], 128)
+	binary.LittleEndian.PutUint32(hdr[84:], 128)
+	copy(disk[2*sector:], entries)
+	for idx, data := range filesystems {
+		copy(disk[offsets[idx]:], data)
+	}
+	return disk
+}
+
+// makeQCOW2 returns a qcow2 (version 3) image of the disk, with 64 KiB
+// clusters and without compression.
+func makeQCOW2(disk []byte) []byte {
+	const clusterBits = 16
+	const clusterSize = 1 << clusterBits
+	clusters := (len(disk) + clusterSize - 1) / clusterSize
+	l2Entries := clusterSize / 8
+	l1Size := (clusters + l2Entries - 1) / l2Entries
+
+	// header, L1 table, L2 tables, data
+	l1Off := clusterSize
+	l2Off := 2 * clusterSize
+	dataOff := l2Off + l1Size*clusterSize
+	img := make([]byte, dataOff)
+	be := binary.BigEndian
+	copy(img, "QFI\xfb")
+	be.PutUint32(img[4:], 3)
+	be.PutUint32(img[20:], clusterBits)
+	be.PutUint64(img[24:], uint64(len(disk)))
+	be.PutUint32(img[36:], uint32(l1Size))
+	be.PutUint64(img[40:], uint64(l1Off))
+	be.PutUint32(img[100:], 104)
+
+	for idx := 0; idx < l1Size; idx++ {
+		be.PutUint64(img[l1Off+idx*8:], uint64(l2Off+idx*clusterSize))
+	}
+	for idx := 0; idx < clusters; idx++ {
+		chunk := disk[idx*clusterSize : min((idx+1)*clusterSize, len(disk))]
+		if bytes.Count(chunk, []byte{0}) == len(chunk) {
+			// unallocated clusters read as zeros
+			continue
+		}
+		be.PutUint64(img[l2Off+idx*8:], uint64(len(img)))
+		cluster := make([]byte, clusterSize)
+		copy(cluster, chunk)
+		img = append(img, cluster...)
+	}
+	return img
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "image")
+	require.NoError(t, os.WriteFile(p, data, 0644))
+	return p
+}
+
+func makeTestDisk(t *testing.T) []byte {
+	root := makeExt4(t, map[string]string{
+		"etc/hostname":           "offline\n",
+		"etc/fstab":              "UUID=" + rootUUID + " / ext4 defaults 0 1\nUUID=" + bootUUID + " /boot ext4 defaults 0 2\n# comment\n/dev/sdb1 /mnt/data xfs defaults 0 0\n",
+		"etc/localtime":          "->../usr/share/zoneinfo/UTC",
+		"usr/share/zoneinfo/":    "/",
+		"usr/share/zoneinfo/UTC": "TZif",
+		"boot/":                  "/",
+		"bin":                    "->usr/bin",
+		"usr/bin/true":           "#!/bin/sh\n",
+	}, rootUUID, "root")
+	boot := makeExt4(t, map[string]string{
+		"loader/entries/test.conf": "title Test\noptions root=UUID=" + rootUUID + " ro\n",
+	}, bootUUID, "boot")
+	return makeGPTDisk(boot, root)
+}
+
+func checkTestDisk(t *testing.T, tree *inspect.Tree) {
+	t.Helper()
+	require.Len(t, tree.Volumes, 2)
+	assert.Equal(t, inspect.Volume{
+		Partition:  1,
+		Start:      2048 * 512,
+		Size:       16 * 1024 * 1024,
+		PartType:   linuxFSGUID,
+		PartUUID:   "00000000-0000-0000-0000-000000000001",
+		PartLabel:  "part1",
+		FSType:     "ext4",
+		UUID:       bootUUID,
+		Label:      "boot",
+		Mountpoint: "/boot",
+	}, withoutRoot(tree.Volumes[0]))
+	assert.Equal(t, "/", tree.Volumes[1].Mountpoint)
+	assert.Equal(t, rootUUID, tree.Volumes[1].UUID)
+
+	hostname, err := fs.ReadFile(tree, "etc/hostname")
+	require.NoError(t, err)
+	assert.Equal(t, "offline\n", string(hostname))
+
+	target, err := tree.ReadLink("etc/localtime")
+	require.NoError(t, err)
+	assert.Equal(t, "../usr/share/zoneinfo/UTC", target)
+	tz, err := fs.ReadFile(tree, "etc/localtime")
+	require.NoError(t, err)
+	assert.Equal(t, "TZif", string(tz))
+
+	// absolute and relative symlinks in the path
+	info, err := fs.Stat(tree, "bin/true")
+	require.NoError(t, err)
+	assert.Equal(t, "true", info.Name())
+	assert.True(t, info.Mode().IsRegular())
+	assert.Equal(t, &inspect.Owner{UID: 0, GID: 0}, info.Sys())
+
+	entry, err := fs.ReadFile(tree, "boot/loader/entries/test.conf")
+	require.NoError(t, err)
+	assert.Contains(t, string(entry), "root=UUID="+rootUUID)
+
+	_, err = fs.Stat(tree, "etc/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	fstab, err := tree.Fstab()
+	require.NoError(t, err)
+	require.Len(t, fstab, 3)
+	assert.Equal(t, inspect.FstabEntry{
+		Spec:       "UUID=" + bootUUID,
+		Mountpoint: "/boot",
+		FSType:     "ext4",
+		Options:    "defaults",
+	}, fstab[1])
+
+	assert.NoError(t, fstest.TestFS(tree, "etc/hostname", "boot/loader/entries/test.conf", "usr/bin/true"))
+}
+
+// withoutRoot returns the exported fields of the volume.
+func withoutRoot(vol inspect.Volume) inspect.Volume {
+	return inspect.Volume{
+		Partition:  vol.Partition,
+		Start:      vol.Start,
+		Size:       vol.Size,
+		PartType:   vol.PartType,
+		PartUUID:   vol.PartUUID,
+		PartLabel:  vol.PartLabel,
+		FSType:     vol.FSType,
+		UUID:       vol.UUID,
+		Label:      vol.Label,
+		Mountpoint: vol.Mountpoint,
+	}
+}
+
+func TestOpenRaw(t *testing.T) {
+	tree, err := inspect.Open(writeFile(t, makeTestDisk(t)), nil)
+	require.NoError(t, err)
+	defer tree.Close()
+	assert.Equal(t, inspect.FormatRaw, tree.Format)
+	checkTestDisk(t, tree)
+}
+
+func TestOpenQCOW2(t *testing.T) {
+	tree, err := inspect.Open(writeFile(t, makeQCOW2(makeTestDisk(t))), nil)
+	require.NoError(t, err)
+	defer tree.Close()
+	assert.Equal(t, inspect.FormatQCOW2, tree.Format)
+	checkTestDisk(t, tree)
+}
+
+func TestOpenUnpartitioned(t *testing.T) {
+	// large directories are indexed (htree) and large files need more
+	// than the extents in the inode
+	files := map[string]string{
+		"etc/hostname": "single\n",
+		"usr/large":    strings.Repeat("0123456789abcdef", 128*1024),
+	}
+	for idx := 0; idx < 500; idx++ {
+		files[fmt.Sprintf("usr/share/many/file-%03d", idx)] = fmt.Sprint(idx)
+	}
+	root := makeExt4(t, files, rootUUID, "root")
+	tree, err := inspect.Open(writeFile(t, root), nil)
+	require.NoError(t, err)
+	defer tree.Close()
+	require.Len(t, tree.Volumes, 1)
+	assert.Equal(t, 0, tree.Volumes[0].Partition)
+	hostname, err := tree.ReadFile("etc/hostname")
+	require.NoError(t, err)
+	assert.Equal(t, "single\n", string(hostname))
+
+	large, err := tree.ReadFile("usr/large")
+	require.NoError(t, err)
+	assert.Equal(t, files["usr/large"], string(large))
+	entries, err := tree.ReadDir("usr/share/many")
+	require.NoError(t, err)
+	assert.Len(t, entries, 500)
+	content, err := tree.ReadFile("usr/share/many/file-499")
+	require.NoError(t, err)
+	assert.Equal(t, "499", string(content))
+}
+
+func TestOpenNoRoot(t *testing.T) {
+	data := makeExt4(t, map[string]string{"loader/entries/test.conf": ""}, bootUUID, "boot")
+	_, err := inspect.Open(writeFile(t, makeGPTDisk(data)), nil)
+	assert.ErrorContains(t, err, "cannot find the root filesystem")
+}
+
+type tarFile struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func makeTar(t *testing.T, files []tarFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     f.name,
+			Typeflag: f.typeflag,
+			Linkname: f.linkname,
+			Mode:     0644,
+			Uid:      1000,
+			Gid:      1000,
+			Size:     int64(len(f.content)),
+		}
+		if f.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if f.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(f.content)[:hdr.Size])
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+var testTarFiles = []tarFile{
+	{name: "./etc/", typeflag: tar.TypeDir},
+	{name: "./etc/hostname", typeflag: tar.TypeReg, content: "container\n"},
+	{name: "./etc/name", typeflag: tar.TypeLink, linkname: "./etc/hostname"},
+	{name: "./etc/link", typeflag: tar.TypeSymlink, linkname: "/etc/hostname"},
+	// parent directories can be implicit
+	{name: "usr/lib/os-release", typeflag: tar.TypeReg, content: "ID=test\n"},
+}
+
+func TestOpenTar(t *testing.T) {
+	archive := makeTar(t, testTarFiles)
+	for name, data := range map[string][]byte{
+		"plain": archive,
+		"gzip":  gzipData(t, archive),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tree, err := inspect.Open(writeFile(t, data), nil)
+			require.NoError(t, err)
+			defer tree.Close()
+			assert.Equal(t, inspect.FormatTar, tree.Format)
+			assert.Empty(t, tree.Volumes)
+
+			for _, p := range []string{"etc/hostname", "etc/name", "etc/link"} {
+				content, err := tree.ReadFile(p)
+				require.NoError(t, err, p)
+				assert.Equal(t, "container\n", string(content), p)
+			}
+			info, err := tree.Stat("etc/name")
+			require.NoError(t, err)
+			assert.Equal(t, &inspect.Owner{UID: 1000, GID: 1000}, info.Sys())
+			assert.Equal(t, fs.FileMode(0644), info.Mode())
+
+			assert.NoError(t, fstest.TestFS(tree, "etc/hostname", "etc/name", "usr/lib/os-release"))
+		})
+	}
+}
+
+func TestOpenDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"etc/hostname":  "directory\n",
+		"etc/localtime": "->/usr/share/zoneinfo/UTC",
+		// the symlink must not escape to the host
+		"usr/share/zoneinfo/UTC": "TZif",
+	})
+	tree, err := inspect.Open(dir, nil)
+	require.NoError(t, err)
+	defer tree.Close()
+	assert.Equal(t, inspect.FormatDirectory, tree.Format)
+	content, err := tree.ReadFile("etc/localtime")
+	require.NoError(t, err)
+	assert.Equal(t, "TZif", string(content))
+}
+
+// writeBlob writes the blob to the OCI layout and returns its descriptor.
+func writeBlob(t *testing.T, layout, mediaType string, data []byte) map[string]any {
+	t.Helper()
+	digest := fmt.Sprintf("%x", sha256.Sum256(data))
+	p := filepath.Join(layout, "blobs", "sha256", digest)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, data, 0644))
+	return map[string]any{
+		"mediaType": mediaType,
+		"digest":    "sha256:" + digest,
+		"size":      len(data),
+	}
+}
+
+func writeJSONBlob(t *testing.T, layout, mediaType string, v any) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return writeBlob(t, layout, mediaType, data)
+}
+
+func TestOpenOCILayout(t *testing.T) {
+	layout := t.TempDir()
+	base := makeTar(t, []tarFile{
+		{name: "etc/hostname", typeflag: tar.TypeReg, content: "base\n"},
+		{name: "etc/motd", typeflag: tar.TypeReg, content: "removed\n"},
+		{name: "var/cache/dnf/cache", typeflag: tar.TypeReg, content: "removed\n"},
+	})
+	top := makeTar(t, []tarFile{
+		{name: "etc/hostname", typeflag: tar.TypeReg, content: "top\n"},
+		{name: "etc/.wh.motd", typeflag: tar.TypeReg},
+		{name: "var/cache/dnf/.wh..wh..opq", typeflag: tar.TypeReg},
+		{name: "var/cache/dnf/new", typeflag: tar.TypeReg, content: "added\n"},
+	})
+	manifest := writeJSONBlob(t, layout, "application/vnd.oci.image.manifest.v1+json", map[string]any{
+		"schemaVersion": 2,
+		"config":        writeJSONBlob(t, layout, "application/vnd.oci.image.config.v1+json", map[string]any{}),
+		"layers": []any{
+			writeBlob(t, layout, "application/vnd.oci.image.layer.v1.tar+gzip", gzipData(t, base)),
+			writeBlob(t, layout, "application/vnd.oci.image.layer.v1.tar", top),
+		},
+	})
+	writeTree(t, layout, map[string]string{
+		"oci-layout": `{"imageLayoutVersion": "1.0.0"}`,
+	})
+	index, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"manifests":     []any{manifest},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(layout, "index.json"), index, 0644))
+
+	tree, err := inspect.Open(layout, nil)
+	require.NoError(t, err)
+	defer tree.Close()
+	assert.Equal(t, inspect.FormatOCI, tree.Format)
+
+	hostname, err := tree.ReadFile("etc/hostname")
+	require.NoError(t, err)
+	assert.Equal(t, "top\n", string(hostname))
+	_, err = tree.Stat("etc/motd")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	entries, err := tree.ReadDir("var/cache/dnf")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "new", entries[0].Name())
+}
+
+func TestOpenOSTreeDeployment(t *testing.T) {
+	deployment := "ostree/deploy/fedora-iot/deploy/0123456789abcdef.0/"
+	root := makeExt4(t, map[string]string{
+		"ostree/deploy/fedora-iot/deploy/0123456789abcdef.0.origin": "[origin]\n",
+		deployment + "etc/hostname":                                 "iot\n",
+		deployment + "usr/lib/os-release":                           "ID=fedora\n",
+		"ostree/deploy/fedora-iot/var/lib/state":                    "state\n",
+		"boot/loader/entries/ostree-1.conf":                         "options ostree=/ostree/boot.1/fedora-iot/0/0\n",
+	}, rootUUID, "root")
+	tree, err := inspect.Open(writeFile(t, makeGPTDisk(root)), nil)
+	require.NoError(t, err)
+	defer tree.Close()
+
+	assert.Equal(t, "/sysroot", tree.Volumes[0].Mountpoint)
+	for p, content := range map[string]string{
+		"etc/hostname":                                   "iot\n",
+		"var/lib/state":                                  "state\n",
+		"boot/loader/entries/ostree-1.conf":              "options ostree=/ostree/boot.1/fedora-iot/0/0\n",
+		"sysroot/ostree/deploy/fedora-iot/var/lib/state": "state\n",
+	} {
+		data, err := tree.ReadFile(p)
+		require.NoError(t, err, p)
+		assert.Equal(t, content, string(data), p)
+	}
+}
@@ -0,0 +1,150 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// Reading the root filesystem of a container image in the OCI image layout,
+// see https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+
+const (
+	ociIndexMediaType           = "application/vnd.oci.image.index.v1+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	ociLayoutFile = "oci-layout"
+	ociIndexFile  = "index.json"
+
+	ociMaxIndexDepth = 4
+)
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform,omitempty"`
+}
+
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// isOCILayout returns whether the node is the directory of an OCI image
+// layout.
+func isOCILayout(n node) bool {
+	for _, name := range []string{ociLayoutFile, ociIndexFile} {
+		if _, err := n.lookup(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// selectManifest returns the manifest of the image in the index. Indexes
+// with multiple manifests (multi-arch images) are resolved to the manifest
+// of the host architecture, as OCI uses the same architecture names as Go.
+func selectManifest(layout node, data []byte, depth int) (*ociManifest, error) {
+	var index ociIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("cannot parse OCI index: %w", err)
+	}
+
+	var desc *ociDescriptor
+	switch len(index.Manifests) {
+	case 0:
+		return nil, fmt.Errorf("OCI index has no manifests")
+	case 1:
+		desc = &index.Manifests[0]
+	default:
+		for idx := range index.Manifests {
+			m := &index.Manifests[idx]
+			if m.Platform != nil && m.Platform.Architecture == runtime.GOARCH {
+				desc = m
+				break
+			}
+		}
+		if desc == nil {
+			return nil, fmt.Errorf("OCI index has %d manifests and none for %s", len(index.Manifests), runtime.GOARCH)
+		}
+	}
+
+	blob, err := readBlob(layout, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if desc.MediaType == ociIndexMediaType || desc.MediaType == dockerManifestListMediaType {
+		if depth >= ociMaxIndexDepth {
+			return nil, fmt.Errorf("too many nested OCI indexes")
+		}
+		return selectManifest(layout, blob, depth+1)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(blob, &manifest); err != nil {
+		return nil, fmt.Errorf("cannot parse OCI manifest %s: %w", desc.Digest, err)
+	}
+	return &manifest, nil
+}
+
+// blobPath returns the path of a blob in the layout.
+func blobPath(digest string) (string, error) {
+	alg, encoded, ok := strings.Cut(digest, ":")
+	if !ok || alg == "" || encoded == "" || strings.ContainsAny(digest, "/.") {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return path.Join("blobs", alg, encoded), nil
+}
+
+func readBlob(layout node, digest string) ([]byte, error) {
+	p, err := blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return readNodeFile(layout, p)
+}
+
+// openOCILayout returns the root filesystem of the image in the layout, the
+// layers are applied in order.
+func (t *Tree) openOCILayout(layout node) (node, error) {
+	index, err := readNodeFile(layout, ociIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := selectManifest(layout, index, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rootfs := newTarFS()
+	for _, layer := range manifest.Layers {
+		p, err := blobPath(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := lookupPath(layout, p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open layer %s: %w", layer.Digest, err)
+		}
+		archive, size, err := t.readerAt(blob)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open layer %s: %w", layer.Digest, err)
+		}
+		archive, size, err = t.decompress(archive, size)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open layer %s: %w", layer.Digest, err)
+		}
+		if err := rootfs.readTar(archive, size, true); err != nil {
+			return nil, fmt.Errorf("cannot read layer %s: %w", layer.Digest, err)
+		}
+	}
+	return rootfs.root(), nil
+}
@@ -0,0 +1,412 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reading commits of ostree repositories in the "archive" mode, see
+// https://ostreedev.github.io/ostree/repo/ and the GVariant types in
+// src/libostree/ostree-core.h of ostree.
+
+var (
+	ostreeCommitType     = mustParseGVType("(a{sv}aya(say)sstayay)")
+	ostreeDirTreeType    = mustParseGVType("(a(say)a(sayay))")
+	ostreeDirMetaType    = mustParseGVType("(uuua(ayay))")
+	ostreeFileHeaderType = mustParseGVType("(tuuuusa(ayay))")
+
+	ostreeChecksumRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
+)
+
+type ostreeRepo struct {
+	root node
+}
+
+// isOSTreeRepo returns whether the node is the directory of an ostree
+// repository.
+func isOSTreeRepo(n node) bool {
+	for _, name := range []string{"config", "objects", "refs"} {
+		if _, err := n.lookup(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// readNode returns the content of a file in the repository.
+func (r *ostreeRepo) readNode(p string) ([]byte, error) {
+	return readNodeFile(r.root, p)
+}
+
+// checkMode returns an error if the repository is not an archive mode
+// repository, the only mode that can be read without the extended
+// attributes of the files.
+func (r *ostreeRepo) checkMode() error {
+	config, err := r.readNode("config")
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(config))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || strings.TrimSpace(key) != "mode" {
+			continue
+		}
+		switch mode := strings.TrimSpace(value); mode {
+		case "archive", "archive-z2":
+			return nil
+		default:
+			return fmt.Errorf("unsupported ostree repository mode %q, only archive repositories are supported", mode)
+		}
+	}
+	// bare is the default mode
+	return fmt.Errorf("unsupported ostree repository mode \"bare\", only archive repositories are supported")
+}
+
+// refs returns the names of all refs in the repository.
+func (r *ostreeRepo) refs() ([]string, error) {
+	var refs []string
+	var walk func(n node, prefix string) error
+	walk = func(n node, prefix string) error {
+		children, err := n.readDir()
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			name := path.Join(prefix, child.info().Name())
+			if child.info().IsDir() {
+				if err := walk(child, name); err != nil {
+					return err
+				}
+			} else {
+				refs = append(refs, name)
+			}
+		}
+		return nil
+	}
+	refsDir, err := r.root.lookup("refs")
+	if err != nil {
+		return nil, err
+	}
+	heads, err := refsDir.lookup("heads")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := walk(heads, ""); err != nil {
+		return nil, err
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// resolveRef returns the commit checksum of the ref. If the ref is empty,
+// the repository needs to have exactly one ref. Commit checksums are
+// accepted as refs.
+func (r *ostreeRepo) resolveRef(ref string) (string, error) {
+	if ostreeChecksumRegexp.MatchString(ref) {
+		return ref, nil
+	}
+	if ref == "" {
+		refs, err := r.refs()
+		if err != nil {
+			return "", err
+		}
+		if len(refs) != 1 {
+			return "", fmt.Errorf("ostree repository has %d refs %v, select one", len(refs), refs)
+		}
+		ref = refs[0]
+	}
+	data, err := r.readNode(path.Join("refs/heads", ref))
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve ref %q: %w", ref, err)
+	}
+	checksum := strings.TrimSpace(string(data))
+	if !ostreeChecksumRegexp.MatchString(checksum) {
+		return "", fmt.Errorf("invalid commit checksum for ref %q", ref)
+	}
+	return checksum, nil
+}
+
+func (r *ostreeRepo) objectPath(checksum, objType string) string {
+	return fmt.Sprintf("objects/%s/%s.%s", checksum[:2], checksum[2:], objType)
+}
+
+// commitTree returns the root directory of a commit.
+func (r *ostreeRepo) commitTree(checksum string) (node, error) {
+	data, err := r.readNode(r.objectPath(checksum, "commit"))
+	if err != nil {
+		return nil, err
+	}
+	members, err := ostreeCommitType.members(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit %s: %w", checksum, err)
+	}
+	return r.dir(".", hex.EncodeToString(members[6]), hex.EncodeToString(members[7]))
+}
+
+func (r *ostreeRepo) dir(name, treeChecksum, metaChecksum string) (*ostreeDir, error) {
+	if !ostreeChecksumRegexp.MatchString(treeChecksum) || !ostreeChecksumRegexp.MatchString(metaChecksum) {
+		return nil, fmt.Errorf("invalid ostree checksum")
+	}
+	data, err := r.readNode(r.objectPath(metaChecksum, "dirmeta"))
+	if err != nil {
+		return nil, err
+	}
+	members, err := ostreeDirMetaType.members(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dirmeta %s: %w", metaChecksum, err)
+	}
+	be := binary.BigEndian
+	return &ostreeDir{
+		repo:         r,
+		treeChecksum: treeChecksum,
+		fi: &fileInfo{
+			name:  name,
+			mode:  unixMode(be.Uint32(members[2])),
+			owner: Owner{UID: be.Uint32(members[0]), GID: be.Uint32(members[1])},
+		},
+	}, nil
+}
+
+// openFileObject returns the header and a reader that is positioned at the
+// compressed content of a file object.
+func (r *ostreeRepo) openFileObject(checksum string) ([][]byte, io.Reader, error) {
+	n, err := lookupPath(r.root, r.objectPath(checksum, "filez"))
+	if err != nil {
+		return nil, nil, err
+	}
+	rd, err := n.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := readFileHeader(rd)
+	if err != nil {
+		closeReader(rd)
+		return nil, nil, fmt.Errorf("invalid file object %s: %w", checksum, err)
+	}
+	return members, rd, nil
+}
+
+func readFileHeader(rd io.Reader) ([][]byte, error) {
+	// the header is prefixed with its size and 4 bytes of padding
+	var prefix [8]byte
+	if _, err := io.ReadFull(rd, prefix[:]); err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, binary.BigEndian.Uint32(prefix[:4]))
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return nil, err
+	}
+	return ostreeFileHeaderType.members(hdr)
+}
+
+func (r *ostreeRepo) file(name, checksum string) (*ostreeFile, error) {
+	if !ostreeChecksumRegexp.MatchString(checksum) {
+		return nil, fmt.Errorf("invalid ostree checksum")
+	}
+	members, rd, err := r.openFileObject(checksum)
+	if err != nil {
+		return nil, err
+	}
+	closeReader(rd)
+	be := binary.BigEndian
+	target, err := gvString(members[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid file object %s: %w", checksum, err)
+	}
+	f := &ostreeFile{
+		repo:     r,
+		checksum: checksum,
+		target:   target,
+		fi: &fileInfo{
+			name:  name,
+			size:  int64(be.Uint64(members[0])),
+			mode:  unixMode(be.Uint32(members[3])),
+			owner: Owner{UID: be.Uint32(members[1]), GID: be.Uint32(members[2])},
+		},
+	}
+	if f.fi.mode&fs.ModeSymlink != 0 {
+		f.fi.size = int64(len(target))
+	}
+	return f, nil
+}
+
+type ostreeDir struct {
+	repo         *ostreeRepo
+	treeChecksum string
+	fi           *fileInfo
+
+	files map[string]string
+	dirs  map[string][2]string
+}
+
+func (d *ostreeDir) info() *fileInfo {
+	return d.fi
+}
+
+// load reads the dirtree object with the checksums of the entries.
+func (d *ostreeDir) load() error {
+	if d.files != nil {
+		return nil
+	}
+	data, err := d.repo.readNode(d.repo.objectPath(d.treeChecksum, "dirtree"))
+	if err != nil {
+		return err
+	}
+	invalid := func(err error) error {
+		return fmt.Errorf("invalid dirtree %s: %w", d.treeChecksum, err)
+	}
+	members, err := ostreeDirTreeType.members(data)
+	if err != nil {
+		return invalid(err)
+	}
+
+	files, err := ostreeDirTreeType.fields[0].elements(members[0])
+	if err != nil {
+		return invalid(err)
+	}
+	d.files = make(map[string]string, len(files))
+	for _, f := range files {
+		fields, err := ostreeDirTreeType.fields[0].elem.members(f)
+		if err != nil {
+			return invalid(err)
+		}
+		name, err := gvString(fields[0])
+		if err != nil {
+			return invalid(err)
+		}
+		d.files[name] = hex.EncodeToString(fields[1])
+	}
+
+	dirs, err := ostreeDirTreeType.fields[1].elements(members[1])
+	if err != nil {
+		return invalid(err)
+	}
+	d.dirs = make(map[string][2]string, len(dirs))
+	for _, dir := range dirs {
+		fields, err := ostreeDirTreeType.fields[1].elem.members(dir)
+		if err != nil {
+			return invalid(err)
+		}
+		name, err := gvString(fields[0])
+		if err != nil {
+			return invalid(err)
+		}
+		d.dirs[name] = [2]string{hex.EncodeToString(fields[1]), hex.EncodeToString(fields[2])}
+	}
+	return nil
+}
+
+func (d *ostreeDir) child(name string) (node, error) {
+	if checksum, ok := d.files[name]; ok {
+		return d.repo.file(name, checksum)
+	}
+	if checksums, ok := d.dirs[name]; ok {
+		return d.repo.dir(name, checksums[0], checksums[1])
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (d *ostreeDir) lookup(name string) (node, error) {
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d.child(name)
+}
+
+func (d *ostreeDir) readDir() ([]node, error) {
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	var nodes []node
+	for name := range d.files {
+		child, err := d.child(name)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, child)
+	}
+	for name := range d.dirs {
+		child, err := d.child(name)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, child)
+	}
+	return nodes, nil
+}
+
+func (d *ostreeDir) readLink() (string, error) {
+	return "", fmt.Errorf("not a symlink")
+}
+
+func (d *ostreeDir) open() (io.Reader, error) {
+	return nil, fmt.Errorf("is a directory")
+}
+
+type ostreeFile struct {
+	repo     *ostreeRepo
+	checksum string
+	target   string
+	fi       *fileInfo
+}
+
+func (f *ostreeFile) info() *fileInfo {
+	return f.fi
+}
+
+func (f *ostreeFile) lookup(name string) (node, error) {
+	return nil, fmt.Errorf("not a directory")
+}
+
+func (f *ostreeFile) readDir() ([]node, error) {
+	return nil, fmt.Errorf("not a directory")
+}
+
+func (f *ostreeFile) readLink() (string, error) {
+	return f.target, nil
+}
+
+// ostreeContent is the decompressed content of a file object.
+type ostreeContent struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (c *ostreeContent) Close() error {
+	var errs []error
+	for _, closer := range c.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (f *ostreeFile) open() (io.Reader, error) {
+	_, rd, err := f.repo.openFileObject(f.checksum)
+	if err != nil {
+		return nil, err
+	}
+	fr := flate.NewReader(rd)
+	content := &ostreeContent{
+		Reader:  io.LimitReader(fr, f.fi.size),
+		closers: []io.Closer{fr},
+	}
+	if c, ok := rd.(io.Closer); ok {
+		content.closers = append(content.closers, c)
+	}
+	return content, nil
+}
@@ -0,0 +1,243 @@
+package inspect
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gvEncode serializes a value of the GVariant type. Strings are passed as
+// string, byte arrays and basic types as their serialized []byte, other
+// arrays and tuples as []any.
+func gvEncode(t *gvType, v any) []byte {
+	switch t.kind {
+	case 's':
+		return append([]byte(v.(string)), 0)
+	case 'a':
+		if t.elem.kind == 'y' {
+			return v.([]byte)
+		}
+		var body []byte
+		var ends []int
+		for _, elem := range v.([]any) {
+			body = append(body, make([]byte, alignTo(len(body), t.elem.align)-len(body))...)
+			body = append(body, gvEncode(t.elem, elem)...)
+			ends = append(ends, len(body))
+		}
+		if t.elem.size != 0 {
+			return body
+		}
+		return gvFrame(body, ends)
+	case '(':
+		var body []byte
+		var ends []int
+		for idx, field := range t.fields {
+			body = append(body, make([]byte, alignTo(len(body), field.align)-len(body))...)
+			body = append(body, gvEncode(field, v.([]any)[idx])...)
+			if field.size == 0 && idx != len(t.fields)-1 {
+				ends = append(ends, len(body))
+			}
+		}
+		if t.size != 0 {
+			return append(body, make([]byte, t.size-len(body))...)
+		}
+		slices.Reverse(ends)
+		return gvFrame(body, ends)
+	}
+	return v.([]byte)
+}
+
+// gvFrame appends the framing offsets to a serialized container.
+func gvFrame(body []byte, offsets []int) []byte {
+	if len(body) == 0 && len(offsets) == 0 {
+		return body
+	}
+	size := 1
+	for gvOffsetSize(len(body)+len(offsets)*size) != size {
+		size *= 2
+	}
+	for _, offset := range offsets {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, uint64(offset))
+		body = append(body, b[:size]...)
+	}
+	return body
+}
+
+func beUint32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func TestGVariantRoundTrip(t *testing.T) {
+	typ := mustParseGVType("(sa(say)ua(sayay))")
+	checksum := bytes.Repeat([]byte{0xab}, 32)
+	data := gvEncode(typ, []any{
+		"first",
+		[]any{[]any{"a", checksum}, []any{"bb", []byte{}}},
+		beUint32(42),
+		[]any{},
+	})
+
+	members, err := typ.members(data)
+	require.NoError(t, err)
+	require.Len(t, members, 4)
+	s, err := gvString(members[0])
+	require.NoError(t, err)
+	assert.Equal(t, "first", s)
+	assert.Equal(t, beUint32(42), members[2])
+
+	elements, err := typ.fields[1].elements(members[1])
+	require.NoError(t, err)
+	require.Len(t, elements, 2)
+	fields, err := typ.fields[1].elem.members(elements[0])
+	require.NoError(t, err)
+	s, err = gvString(fields[0])
+	require.NoError(t, err)
+	assert.Equal(t, "a", s)
+	assert.Equal(t, checksum, fields[1])
+
+	elements, err = typ.fields[3].elements(members[3])
+	require.NoError(t, err)
+	assert.Empty(t, elements)
+
+	_, err = parseGVType("(su")
+	assert.Error(t, err)
+}
+
+// testRepo writes the objects of an archive mode ostree repository.
+type testRepo struct {
+	t    *testing.T
+	path string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	r := &testRepo{t: t, path: t.TempDir()}
+	r.write("config", []byte("[core]\nrepo_version=1\nmode=archive-z2\n"))
+	for _, dir := range []string{"objects", "refs/heads"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(r.path, dir), 0755))
+	}
+	return r
+}
+
+func (r *testRepo) write(name string, data []byte) {
+	p := filepath.Join(r.path, name)
+	require.NoError(r.t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(r.t, os.WriteFile(p, data, 0644))
+}
+
+// object writes an object and returns its checksum, which is not the real
+// ostree checksum as checksums are not verified.
+func (r *testRepo) object(objType string, data []byte) []byte {
+	sum := sha256.Sum256(append([]byte(objType), data...))
+	r.write(fmt.Sprintf("objects/%x/%x.%s", sum[:1], sum[1:], objType), data)
+	return sum[:]
+}
+
+func (r *testRepo) file(content, target string, mode uint32) []byte {
+	hdr := gvEncode(ostreeFileHeaderType, []any{
+		binary.BigEndian.AppendUint64(nil, uint64(len(content))),
+		beUint32(0), beUint32(0), beUint32(mode), beUint32(0),
+		target,
+		[]any{},
+	})
+	var obj bytes.Buffer
+	obj.Write(beUint32(uint32(len(hdr))))
+	obj.Write(make([]byte, 4))
+	obj.Write(hdr)
+	fw, err := flate.NewWriter(&obj, flate.DefaultCompression)
+	require.NoError(r.t, err)
+	_, err = fw.Write([]byte(content))
+	require.NoError(r.t, err)
+	require.NoError(r.t, fw.Close())
+	return r.object("filez", obj.Bytes())
+}
+
+func (r *testRepo) dirMeta() []byte {
+	return r.object("dirmeta", gvEncode(ostreeDirMetaType, []any{
+		beUint32(0), beUint32(0), beUint32(0040755), []any{},
+	}))
+}
+
+// dirTree writes a dirtree with the given files and subdirectories, the
+// entries need to be sorted by name.
+func (r *testRepo) dirTree(files map[string][]byte, dirs map[string][]byte) []byte {
+	var fileEntries, dirEntries []any
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		fileEntries = append(fileEntries, []any{name, files[name]})
+	}
+	for _, name := range slices.Sorted(maps.Keys(dirs)) {
+		dirEntries = append(dirEntries, []any{name, dirs[name], r.dirMeta()})
+	}
+	return r.object("dirtree", gvEncode(ostreeDirTreeType, []any{fileEntries, dirEntries}))
+}
+
+func (r *testRepo) commit(ref string, tree []byte) {
+	checksum := r.object("commit", gvEncode(ostreeCommitType, []any{
+		[]any{},
+		[]byte{},
+		[]any{},
+		"subject",
+		"",
+		make([]byte, 8),
+		tree,
+		r.dirMeta(),
+	}))
+	r.write("refs/heads/"+ref, []byte(fmt.Sprintf("%x\n", checksum)))
+}
+
+func TestOpenOSTreeRepo(t *testing.T) {
+	repo := newTestRepo(t)
+	etc := repo.dirTree(map[string][]byte{
+		"hostname":   repo.file("ostree\n", "", 0100644),
+		"os-release": repo.file("", "../usr/lib/os-release", 0120777),
+	}, nil)
+	usrLib := repo.dirTree(map[string][]byte{
+		"os-release": repo.file("ID=fedora\n", "", 0100644),
+	}, nil)
+	usr := repo.dirTree(nil, map[string][]byte{"lib": usrLib})
+	repo.commit("fedora/x86_64/iot", repo.dirTree(nil, map[string][]byte{"etc": etc, "usr": usr}))
+
+	tree, err := Open(repo.path, nil)
+	require.NoError(t, err)
+	defer tree.Close()
+	assert.Equal(t, FormatOSTree, tree.Format)
+
+	hostname, err := tree.ReadFile("etc/hostname")
+	require.NoError(t, err)
+	assert.Equal(t, "ostree\n", string(hostname))
+	osRelease, err := tree.ReadFile("etc/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "ID=fedora\n", string(osRelease))
+	info, err := tree.Stat("usr/lib")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeDir|0755, info.Mode())
+
+	// the ref needs to be selected with multiple refs
+	repo.commit("fedora/x86_64/other", repo.dirTree(nil, nil))
+	_, err = Open(repo.path, nil)
+	assert.ErrorContains(t, err, "ostree repository has 2 refs")
+	tree, err = Open(repo.path, &Options{Ref: "fedora/x86_64/other"})
+	require.NoError(t, err)
+	defer tree.Close()
+	entries, err := tree.ReadDir(".")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOpenOSTreeRepoBare(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("config", []byte("[core]\nrepo_version=1\nmode=bare\n"))
+	_, err := Open(repo.path, nil)
+	assert.ErrorContains(t, err, `unsupported ostree repository mode "bare"`)
+}
@@ -0,0 +1,164 @@
+package inspect
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+// partition is a partition of a disk image.
+type partition struct {
+	number    int
+	start     int64
+	size      int64
+	partType  string
+	partUUID  string
+	partLabel string
+}
+
+// mbrExtendedTypes are the MBR partition types of extended partitions.
+var mbrExtendedTypes = map[byte]bool{0x05: true, 0x0f: true, 0x85: true}
+
+// readPartitions returns the partitions of the GPT or MBR partition table
+// of a disk image, or nil if the image is not partitioned.
+func readPartitions(dev io.ReaderAt) ([]partition, error) {
+	// GPT headers are in the second logical block, try the common sector
+	// sizes
+	for _, sectorSize := range []int64{512, 4096} {
+		hdr := make([]byte, 92)
+		if err := readFull(dev, hdr, sectorSize); err != nil {
+			continue
+		}
+		if string(hdr[0:8]) == "EFI PART" {
+			return readGPT(dev, hdr, sectorSize)
+		}
+	}
+
+	mbr := make([]byte, 512)
+	if err := readFull(dev, mbr, 0); err != nil {
+		return nil, nil
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return nil, nil
+	}
+	// FAT filesystems also end their first sector with the MBR signature,
+	// partition tables are not bootable code
+	if probeVFAT(dev) {
+		return nil, nil
+	}
+	return readMBR(dev, mbr)
+}
+
+// gptGUID converts a mixed-endian GUID of a GPT to its string form.
+func gptGUID(b []byte) string {
+	var id uuid.UUID
+	copy(id[:], b[:16])
+	id[0], id[1], id[2], id[3] = b[3], b[2], b[1], b[0]
+	id[4], id[5] = b[5], b[4]
+	id[6], id[7] = b[7], b[6]
+	return strings.ToUpper(id.String())
+}
+
+func readGPT(dev io.ReaderAt, hdr []byte, sectorSize int64) ([]partition, error) {
+	le := binary.LittleEndian
+	entriesLBA := int64(le.Uint64(hdr[72:]))
+	numEntries := int64(le.Uint32(hdr[80:]))
+	entrySize := int64(le.Uint32(hdr[84:]))
+	if entrySize < 128 || numEntries > 1024 {
+		return nil, fmt.Errorf("invalid GPT header")
+	}
+	entries, err := readBytes(dev, entriesLBA*sectorSize, int(numEntries*entrySize))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read GPT entries: %w", err)
+	}
+
+	var parts []partition
+	for idx := int64(0); idx < numEntries; idx++ {
+		entry := entries[idx*entrySize : (idx+1)*entrySize]
+		partType := gptGUID(entry[0:16])
+		if partType == "00000000-0000-0000-0000-000000000000" {
+			continue
+		}
+		first := int64(le.Uint64(entry[32:]))
+		last := int64(le.Uint64(entry[40:]))
+		name := make([]uint16, 36)
+		for i := range name {
+			name[i] = le.Uint16(entry[56+i*2:])
+		}
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		parts = append(parts, partition{
+			number:    int(idx) + 1,
+			start:     first * sectorSize,
+			size:      (last - first + 1) * sectorSize,
+			partType:  partType,
+			partUUID:  strings.ToLower(gptGUID(entry[16:32])),
+			partLabel: string(utf16.Decode(name)),
+		})
+	}
+	return parts, nil
+}
+
+func readMBR(dev io.ReaderAt, mbr []byte) ([]partition, error) {
+	le := binary.LittleEndian
+	diskID := le.Uint32(mbr[440:])
+	partUUID := func(number int) string {
+		return fmt.Sprintf("%08x-%02d", diskID, number)
+	}
+
+	var parts []partition
+	var extended int64
+	for idx := 0; idx < 4; idx++ {
+		entry := mbr[446+idx*16:]
+		partType := entry[4]
+		if partType == 0 {
+			continue
+		}
+		start := int64(le.Uint32(entry[8:])) * 512
+		if mbrExtendedTypes[partType] {
+			extended = start
+			continue
+		}
+		parts = append(parts, partition{
+			number:   idx + 1,
+			start:    start,
+			size:     int64(le.Uint32(entry[12:])) * 512,
+			partType: fmt.Sprintf("%02x", partType),
+			partUUID: partUUID(idx + 1),
+		})
+	}
+
+	// logical partitions are a chain of extended boot records, the offsets
+	// of the following records are relative to the extended partition
+	number := 5
+	for ebr := extended; ebr != 0 && number < 5+128; number++ {
+		record := make([]byte, 512)
+		if err := readFull(dev, record, ebr); err != nil {
+			return nil, fmt.Errorf("cannot read extended boot record: %w", err)
+		}
+		if record[510] != 0x55 || record[511] != 0xaa {
+			return nil, fmt.Errorf("invalid extended boot record")
+		}
+		entry := record[446:]
+		if entry[4] != 0 {
+			parts = append(parts, partition{
+				number:   number,
+				start:    ebr + int64(le.Uint32(entry[8:]))*512,
+				size:     int64(le.Uint32(entry[12:])) * 512,
+				partType: fmt.Sprintf("%02x", entry[4]),
+				partUUID: partUUID(number),
+			})
+		}
+		next := record[446+16:]
+		if next[4] == 0 {
+			break
+		}
+		ebr = extended + int64(le.Uint32(next[8:]))*512
+	}
+	return parts, nil
+}
@@ -0,0 +1,209 @@
+package inspect
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// qcow2 image format, see
+// https://qemu-project.gitlab.io/qemu/interop/qcow2.html
+
+const qcow2Magic = "QFI\xfb"
+
+const (
+	qcow2IncompatExternalData = 0x4
+	qcow2IncompatCompression  = 0x8
+	qcow2IncompatExtendedL2   = 0x10
+
+	qcow2OffsetMask     = 0x00fffffffffffe00
+	qcow2CompressedFlag = 1 << 62
+	qcow2ZeroFlag       = 1
+)
+
+// qcow2Image implements io.ReaderAt for the guest view of a qcow2 image.
+type qcow2Image struct {
+	r           io.ReaderAt
+	size        int64
+	clusterBits uint
+	l1          []uint64
+
+	mu       sync.Mutex
+	l2Cache  map[uint64][]uint64
+	cacheOff int64
+	cache    []byte
+}
+
+// probeQCOW2 returns whether the file is a qcow2 image.
+func probeQCOW2(r io.ReaderAt) bool {
+	b := make([]byte, 4)
+	if err := readFull(r, b, 0); err != nil {
+		return false
+	}
+	return string(b) == qcow2Magic
+}
+
+func openQCOW2(r io.ReaderAt) (*qcow2Image, error) {
+	hdr, err := readBytes(r, 0, 104)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read qcow2 header: %w", err)
+	}
+	if string(hdr[0:4]) != qcow2Magic {
+		return nil, fmt.Errorf("no qcow2 header found")
+	}
+	be := binary.BigEndian
+	version := be.Uint32(hdr[4:])
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported qcow2 version %d", version)
+	}
+	if be.Uint64(hdr[8:]) != 0 {
+		return nil, fmt.Errorf("qcow2 images with a backing file are not supported")
+	}
+	if be.Uint32(hdr[32:]) != 0 {
+		return nil, fmt.Errorf("encrypted qcow2 images are not supported")
+	}
+	if version == 3 {
+		incompat := be.Uint64(hdr[72:])
+		if incompat&(qcow2IncompatExternalData|qcow2IncompatExtendedL2) != 0 {
+			return nil, fmt.Errorf("unsupported qcow2 features: %#x", incompat)
+		}
+		if incompat&qcow2IncompatCompression != 0 {
+			// only zlib (0) is supported
+			compression, err := readBytes(r, 104, 1)
+			if err != nil {
+				return nil, err
+			}
+			if compression[0] != 0 {
+				return nil, fmt.Errorf("unsupported qcow2 compression type %d", compression[0])
+			}
+		}
+	}
+
+	q := &qcow2Image{
+		r:           r,
+		size:        int64(be.Uint64(hdr[24:])),
+		clusterBits: uint(be.Uint32(hdr[20:])),
+		l2Cache:     make(map[uint64][]uint64),
+		cacheOff:    -1,
+	}
+	if q.clusterBits < 9 || q.clusterBits > 21 {
+		return nil, fmt.Errorf("invalid qcow2 cluster size")
+	}
+	l1Size := int(be.Uint32(hdr[36:]))
+	l1, err := readBytes(r, int64(be.Uint64(hdr[40:])), l1Size*8)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read qcow2 L1 table: %w", err)
+	}
+	q.l1 = make([]uint64, l1Size)
+	for idx := range q.l1 {
+		q.l1[idx] = be.Uint64(l1[idx*8:])
+	}
+	return q, nil
+}
+
+// Size returns the virtual size of the image.
+func (q *qcow2Image) Size() int64 {
+	return q.size
+}
+
+func (q *qcow2Image) l2Table(offset uint64) ([]uint64, error) {
+	if table, ok := q.l2Cache[offset]; ok {
+		return table, nil
+	}
+	raw, err := readBytes(q.r, int64(offset), 1<<q.clusterBits)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read qcow2 L2 table: %w", err)
+	}
+	table := make([]uint64, len(raw)/8)
+	for idx := range table {
+		table[idx] = binary.BigEndian.Uint64(raw[idx*8:])
+	}
+	q.l2Cache[offset] = table
+	return table, nil
+}
+
+// readCluster reads the guest cluster that contains the offset into b,
+// which has the size of a cluster.
+func (q *qcow2Image) readCluster(b []byte, off int64) error {
+	l2Bits := q.clusterBits - 3
+	l1Idx := uint64(off) >> (q.clusterBits + l2Bits)
+	l2Idx := (uint64(off) >> q.clusterBits) & (1<<l2Bits - 1)
+
+	if l1Idx >= uint64(len(q.l1)) || q.l1[l1Idx]&qcow2OffsetMask == 0 {
+		clear(b)
+		return nil
+	}
+	table, err := q.l2Table(q.l1[l1Idx] & qcow2OffsetMask)
+	if err != nil {
+		return err
+	}
+	entry := table[l2Idx]
+
+	if entry&qcow2CompressedFlag != 0 {
+		// the host offset is followed by the number of additional 512 byte
+		// sectors of compressed data
+		offsetBits := 62 - (q.clusterBits - 8)
+		hostOff := int64(entry & (1<<offsetBits - 1))
+		sectors := int64((entry&(1<<62-1))>>offsetBits) + 1
+		compressedSize := sectors*512 - hostOff&511
+		compressed := make([]byte, compressedSize)
+		n, err := q.r.ReadAt(compressed, hostOff)
+		// the compressed data of the last cluster can end before the
+		// last sector
+		if err != nil && err != io.EOF {
+			return err
+		}
+		fr := flate.NewReader(bytes.NewReader(compressed[:n]))
+		defer fr.Close()
+		if _, err := io.ReadFull(fr, b); err != nil {
+			return fmt.Errorf("cannot decompress qcow2 cluster: %w", err)
+		}
+		return nil
+	}
+
+	hostOff := int64(entry & qcow2OffsetMask)
+	if hostOff == 0 || entry&qcow2ZeroFlag != 0 {
+		clear(b)
+		return nil
+	}
+	return readFull(q.r, b, hostOff)
+}
+
+func (q *qcow2Image) ReadAt(p []byte, off int64) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if off >= q.size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if int64(want) > q.size-off {
+		p = p[:q.size-off]
+	}
+
+	clusterSize := int64(1) << q.clusterBits
+	if q.cache == nil {
+		q.cache = make([]byte, clusterSize)
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		clusterOff := pos &^ (clusterSize - 1)
+		if q.cacheOff != clusterOff {
+			if err := q.readCluster(q.cache, clusterOff); err != nil {
+				q.cacheOff = -1
+				return n, err
+			}
+			q.cacheOff = clusterOff
+		}
+		n += copy(p[n:], q.cache[pos-clusterOff:])
+	}
+
+	if n < want {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,239 @@
+package inspect
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// tarFS is an index of the entries of one or more (layered) tar archives.
+// The content of the files is read from the archives when a file is opened.
+type tarFS struct {
+	entries map[string]*tarEntry
+}
+
+type tarEntry struct {
+	fs       *tarFS
+	fi       *fileInfo
+	children map[string]*tarEntry
+
+	linkname string
+	// hard links are resolved when the file is opened
+	hardlink string
+
+	archive io.ReaderAt
+	offset  int64
+}
+
+func newTarFS() *tarFS {
+	t := &tarFS{entries: make(map[string]*tarEntry)}
+	t.entries["."] = &tarEntry{
+		fs:       t,
+		fi:       &fileInfo{name: ".", mode: fs.ModeDir | 0755},
+		children: make(map[string]*tarEntry),
+	}
+	return t
+}
+
+// cleanTarPath returns the cleaned relative path of a tar entry.
+func cleanTarPath(name string) string {
+	return path.Clean(strings.TrimLeft(name, "/"))
+}
+
+// dir returns the entry of a directory, missing parent directories are
+// created.
+func (t *tarFS) dir(name string) *tarEntry {
+	if entry, ok := t.entries[name]; ok && entry.children != nil {
+		return entry
+	}
+	parent := t.dir(path.Dir(name))
+	entry := &tarEntry{
+		fs:       t,
+		fi:       &fileInfo{name: path.Base(name), mode: fs.ModeDir | 0755},
+		children: make(map[string]*tarEntry),
+	}
+	t.entries[name] = entry
+	parent.children[entry.fi.name] = entry
+	return entry
+}
+
+// remove removes the entry and all entries below it.
+func (t *tarFS) remove(name string) {
+	entry, ok := t.entries[name]
+	if !ok {
+		return
+	}
+	for childName := range entry.children {
+		t.remove(path.Join(name, childName))
+	}
+	delete(t.entries, name)
+	if parent, ok := t.entries[path.Dir(name)]; ok && name != "." {
+		delete(parent.children, path.Base(name))
+	}
+}
+
+// add adds a tar entry, an existing entry is replaced.
+func (t *tarFS) add(hdr *tar.Header, archive io.ReaderAt, offset int64) error {
+	name := cleanTarPath(hdr.Name)
+	info := hdr.FileInfo()
+	fi := &fileInfo{
+		name:    path.Base(name),
+		size:    hdr.Size,
+		mode:    info.Mode(),
+		modTime: hdr.ModTime,
+		owner:   Owner{UID: uint32(hdr.Uid), GID: uint32(hdr.Gid)}, // #nosec G115
+	}
+
+	if name == "." {
+		root := t.entries["."]
+		root.fi = fi
+		root.fi.name = "."
+		return nil
+	}
+
+	entry := &tarEntry{
+		fs:      t,
+		fi:      fi,
+		archive: archive,
+		offset:  offset,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		// keep the content of existing directories
+		if existing, ok := t.entries[name]; ok && existing.children != nil {
+			existing.fi = fi
+			return nil
+		}
+		entry.children = make(map[string]*tarEntry)
+	case tar.TypeSymlink:
+		entry.linkname = hdr.Linkname
+		fi.size = int64(len(hdr.Linkname))
+	case tar.TypeLink:
+		entry.hardlink = cleanTarPath(hdr.Linkname)
+		target, ok := t.entries[entry.hardlink]
+		if !ok {
+			return fmt.Errorf("hard link %q to missing file %q", hdr.Name, hdr.Linkname)
+		}
+		// hard links share the metadata of their target
+		c := *target.fi
+		c.name = fi.name
+		entry.fi = &c
+	case tar.TypeReg, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+	case tar.TypeGNUSparse:
+		return fmt.Errorf("sparse file %q in tar archive is not supported", hdr.Name)
+	default:
+		return nil
+	}
+
+	t.remove(name)
+	t.entries[name] = entry
+	t.dir(path.Dir(name)).children[fi.name] = entry
+	return nil
+}
+
+// whiteoutPrefix marks deleted files in the layers of container images,
+// see https://github.com/opencontainers/image-spec/blob/main/layer.md
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// readTar adds the entries of a tar archive to the index. If layer is set,
+// the archive is a layer of a container image and whiteout entries remove
+// the files of the previous layers.
+func (t *tarFS) readTar(archive io.ReaderAt, size int64, layer bool) error {
+	sr := io.NewSectionReader(archive, 0, size)
+	tr := tar.NewReader(sr)
+
+	type pending struct {
+		hdr    *tar.Header
+		offset int64
+	}
+	var entries []pending
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read tar archive: %w", err)
+		}
+		// the reader is positioned at the content of the entry
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		if layer {
+			name := cleanTarPath(hdr.Name)
+			base := path.Base(name)
+			if base == whiteoutOpaque {
+				dir := path.Dir(name)
+				if entry, ok := t.entries[dir]; ok {
+					for childName := range entry.children {
+						t.remove(path.Join(dir, childName))
+					}
+				}
+				continue
+			}
+			if strings.HasPrefix(base, whiteoutPrefix) {
+				t.remove(path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)))
+				continue
+			}
+		}
+		entries = append(entries, pending{hdr: hdr, offset: offset})
+	}
+
+	// whiteouts only apply to the previous layers, so the entries of a
+	// layer are added after all whiteouts of the layer were applied
+	for _, e := range entries {
+		if err := t.add(e.hdr, archive, e.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tarFS) root() node {
+	return t.entries["."]
+}
+
+func (e *tarEntry) info() *fileInfo {
+	return e.fi
+}
+
+func (e *tarEntry) lookup(name string) (node, error) {
+	child, ok := e.children[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return child, nil
+}
+
+func (e *tarEntry) readDir() ([]node, error) {
+	nodes := make([]node, 0, len(e.children))
+	for _, child := range e.children {
+		nodes = append(nodes, child)
+	}
+	return nodes, nil
+}
+
+func (e *tarEntry) readLink() (string, error) {
+	return e.linkname, nil
+}
+
+func (e *tarEntry) open() (io.Reader, error) {
+	content := e
+	for hops := 0; content.hardlink != ""; hops++ {
+		target, ok := e.fs.entries[content.hardlink]
+		if !ok || hops > maxSymlinks {
+			return nil, fmt.Errorf("cannot resolve hard link to %q", content.hardlink)
+		}
+		content = target
+	}
+	return io.NewSectionReader(content.archive, content.offset, content.fi.size), nil
+}
@@ -0,0 +1,381 @@
+package inspect
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSymlinks is the maximum number of symlinks followed when resolving a
+// path, like MAXSYMLINKS on Linux.
+const maxSymlinks = 40
+
+// Owner is returned by the Sys method of the fs.FileInfo of the files in a
+// Tree.
+type Owner struct {
+	UID uint32
+	GID uint32
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	owner   Owner
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any           { return &fi.owner }
+
+func (fi *fileInfo) Type() fs.FileMode          { return fi.mode.Type() }
+func (fi *fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+func (fi *fileInfo) String() string             { return fs.FormatFileInfo(fi) }
+
+// withName returns a copy of the file info with a different name, used when
+// a file was reached through a symlink or a mount.
+func (fi *fileInfo) withName(name string) *fileInfo {
+	c := *fi
+	c.name = name
+	return &c
+}
+
+// unixMode converts the mode bits of a Unix inode to a fs.FileMode.
+func unixMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0777)
+	switch mode & 0170000 {
+	case 0040000:
+		m |= fs.ModeDir
+	case 0120000:
+		m |= fs.ModeSymlink
+	case 0020000:
+		m |= fs.ModeDevice | fs.ModeCharDevice
+	case 0060000:
+		m |= fs.ModeDevice
+	case 0010000:
+		m |= fs.ModeNamedPipe
+	case 0140000:
+		m |= fs.ModeSocket
+	}
+	if mode&04000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+// node is a file of a filesystem, archive or repository that can be
+// inspected. Implementations only need to support the operations that make
+// sense for the type of the file, the others are never called.
+type node interface {
+	info() *fileInfo
+
+	// lookup returns the entry of a directory with the given name or an
+	// error wrapping fs.ErrNotExist.
+	lookup(name string) (node, error)
+	// readDir returns all entries of a directory, without "." and "..".
+	readDir() ([]node, error)
+	// readLink returns the target of a symlink.
+	readLink() (string, error)
+	// open returns the content of a regular file.
+	open() (io.Reader, error)
+}
+
+// mount is a node mounted at a path of a tree.
+type mount struct {
+	path string
+	root node
+}
+
+// Tree is a read-only view of the root filesystem of an image, with the
+// other filesystems of the image mounted like on the booted system. Paths
+// are resolved in the tree, i.e. absolute symlinks point into the tree and
+// not to the host.
+//
+// Tree implements fs.FS, fs.StatFS, fs.ReadDirFS and fs.ReadFileFS, with
+// the usual unrooted, slash-separated path names of fs.FS. The Sys method
+// of the returned fs.FileInfo returns an *Owner.
+type Tree struct {
+	// Format is the format of the inspected artifact.
+	Format Format
+
+	// Volumes are the filesystems found in the artifact.
+	Volumes []Volume
+
+	mounts  []mount
+	closers []io.Closer
+}
+
+// mountAt mounts the node at the given path. Mounts are resolved when the
+// path is looked up, so the mountpoint does not need to exist.
+func (t *Tree) mountAt(mountpoint string, root node) {
+	mountpoint = path.Clean(strings.TrimPrefix(mountpoint, "/"))
+	if mountpoint == "" || mountpoint == "/" {
+		mountpoint = "."
+	}
+	t.mounts = slices.DeleteFunc(t.mounts, func(m mount) bool {
+		return m.path == mountpoint
+	})
+	t.mounts = append(t.mounts, mount{path: mountpoint, root: root})
+	sort.Slice(t.mounts, func(i, j int) bool {
+		return t.mounts[i].path < t.mounts[j].path
+	})
+}
+
+func (t *Tree) mounted(p string) node {
+	for _, m := range t.mounts {
+		if m.path == p {
+			return m.root
+		}
+	}
+	return nil
+}
+
+// Close releases the resources of the tree, e.g. open image files and
+// temporary files of decompressed archives.
+func (t *Tree) Close() error {
+	var errs []error
+	for idx := len(t.closers) - 1; idx >= 0; idx-- {
+		errs = append(errs, t.closers[idx].Close())
+	}
+	t.closers = nil
+	return errors.Join(errs...)
+}
+
+// resolve returns the node of the file with the given name. Symlinks in the
+// path are followed, the last element only if follow is set.
+func (t *Tree) resolve(op, name string, follow bool) (node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	root := t.mounted(".")
+	nodes := []node{root}
+	var dirs []string
+	remaining := strings.Split(name, "/")
+	links := 0
+	for len(remaining) > 0 {
+		elem := remaining[0]
+		remaining = remaining[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) > 0 {
+				dirs = dirs[:len(dirs)-1]
+				nodes = nodes[:len(nodes)-1]
+			}
+			continue
+		}
+
+		p := path.Join(append(slices.Clone(dirs), elem)...)
+		child := t.mounted(p)
+		if child == nil {
+			parent := nodes[len(nodes)-1]
+			if !parent.info().IsDir() {
+				return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%s: not a directory", path.Join(dirs...))}
+			}
+			var err error
+			child, err = parent.lookup(elem)
+			if err != nil {
+				return nil, &fs.PathError{Op: op, Path: name, Err: err}
+			}
+		}
+
+		if child.info().Mode()&fs.ModeSymlink != 0 && (len(remaining) > 0 || follow) {
+			links++
+			if links > maxSymlinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			target, err := child.readLink()
+			if err != nil {
+				return nil, &fs.PathError{Op: op, Path: name, Err: err}
+			}
+			if strings.HasPrefix(target, "/") {
+				dirs = nil
+				nodes = nodes[:1]
+			}
+			remaining = append(strings.Split(target, "/"), remaining...)
+			continue
+		}
+
+		dirs = append(dirs, elem)
+		nodes = append(nodes, child)
+	}
+	return nodes[len(nodes)-1], nil
+}
+
+// info returns the file info of the node with the name of the last element
+// of the looked up path.
+func resolvedInfo(name string, n node) *fileInfo {
+	return n.info().withName(path.Base(name))
+}
+
+// Stat returns the file info of the named file, following symlinks.
+func (t *Tree) Stat(name string) (fs.FileInfo, error) {
+	n, err := t.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return resolvedInfo(name, n), nil
+}
+
+// Lstat returns the file info of the named file without following a
+// symlink in the last element of the path.
+func (t *Tree) Lstat(name string) (fs.FileInfo, error) {
+	n, err := t.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return resolvedInfo(name, n), nil
+}
+
+// ReadLink returns the target of the named symlink.
+func (t *Tree) ReadLink(name string) (string, error) {
+	n, err := t.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.info().Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := n.readLink()
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (t *Tree) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := t.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return t.readDir(name, n)
+}
+
+func (t *Tree) readDir(name string, n node) ([]fs.DirEntry, error) {
+	if !n.info().IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	children, err := n.readDir()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		info := child.info()
+		// directories with something mounted on them show the root of the
+		// mounted filesystem
+		if m := t.mounted(path.Join(name, info.Name())); m != nil {
+			info = m.info().withName(info.Name())
+		}
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// ReadFile returns the content of the named file.
+func (t *Tree) ReadFile(name string) ([]byte, error) {
+	f, err := t.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Open opens the named file for reading.
+func (t *Tree) Open(name string) (fs.File, error) {
+	n, err := t.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{tree: t, name: name, node: n, info: resolvedInfo(name, n)}
+	if f.info.Mode().IsRegular() {
+		r, err := n.open()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		f.reader = r
+	}
+	return f, nil
+}
+
+// file implements fs.File and fs.ReadDirFile for the files of a tree.
+type file struct {
+	tree   *Tree
+	name   string
+	node   node
+	info   *fileInfo
+	reader io.Reader
+
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.reader.Read(b)
+}
+
+func (f *file) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !f.listed {
+		entries, err := f.tree.readDir(f.name, f.node)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+		f.listed = true
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(f.entries))
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *file) Close() error {
+	if c, ok := f.reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var (
+	_ fs.StatFS     = (*Tree)(nil)
+	_ fs.ReadDirFS  = (*Tree)(nil)
+	_ fs.ReadFileFS = (*Tree)(nil)
+)
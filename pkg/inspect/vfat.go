@@ -0,0 +1,327 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// FAT12/16/32 on-disk format, see the "Microsoft FAT Specification"
+
+const (
+	vfatAttrDirectory = 0x10
+	vfatAttrVolumeID  = 0x08
+	vfatAttrLongName  = 0x0f
+)
+
+type vfatFS struct {
+	dev io.ReaderAt
+
+	fatBits     int
+	fat         []byte
+	clusterSize int64
+	dataStart   int64
+	clusters    uint32
+
+	// FAT12 and FAT16 have a fixed root directory before the data area
+	rootStart   int64
+	rootSize    int64
+	rootCluster uint32
+
+	uuid  string
+	label string
+}
+
+// probeVFAT returns whether the device contains a FAT filesystem.
+func probeVFAT(dev io.ReaderAt) bool {
+	b, err := readBytes(dev, 0, 512)
+	if err != nil {
+		return false
+	}
+	if b[510] != 0x55 || b[511] != 0xaa {
+		return false
+	}
+	return bytes.HasPrefix(b[0x36:], []byte("FAT1")) || bytes.HasPrefix(b[0x52:], []byte("FAT32"))
+}
+
+func openVFAT(dev io.ReaderAt) (*vfatFS, error) {
+	bpb, err := readBytes(dev, 0, 512)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read FAT boot sector: %w", err)
+	}
+	le := binary.LittleEndian
+	bytesPerSector := int64(le.Uint16(bpb[0x0b:]))
+	sectorsPerCluster := int64(bpb[0x0d])
+	reserved := int64(le.Uint16(bpb[0x0e:]))
+	numFATs := int64(bpb[0x10])
+	rootEntries := int64(le.Uint16(bpb[0x11:]))
+	totalSectors := int64(le.Uint16(bpb[0x13:]))
+	if totalSectors == 0 {
+		totalSectors = int64(le.Uint32(bpb[0x20:]))
+	}
+	fatSize := int64(le.Uint16(bpb[0x16:]))
+	if fatSize == 0 {
+		fatSize = int64(le.Uint32(bpb[0x24:]))
+	}
+	if bytesPerSector == 0 || sectorsPerCluster == 0 || numFATs == 0 || fatSize == 0 {
+		return nil, fmt.Errorf("invalid FAT boot sector")
+	}
+
+	v := &vfatFS{
+		dev:         dev,
+		clusterSize: bytesPerSector * sectorsPerCluster,
+		rootStart:   (reserved + numFATs*fatSize) * bytesPerSector,
+		rootSize:    rootEntries * 32,
+	}
+	rootSectors := (v.rootSize + bytesPerSector - 1) / bytesPerSector
+	v.dataStart = v.rootStart + rootSectors*bytesPerSector
+	dataSectors := totalSectors - reserved - numFATs*fatSize - rootSectors
+	if dataSectors <= 0 {
+		return nil, fmt.Errorf("invalid FAT boot sector")
+	}
+	v.clusters = uint32(dataSectors / sectorsPerCluster)
+
+	var volumeID uint32
+	var label []byte
+	switch {
+	case v.clusters < 4085:
+		v.fatBits = 12
+	case v.clusters < 65525:
+		v.fatBits = 16
+	default:
+		v.fatBits = 32
+	}
+	if v.fatBits == 32 {
+		v.rootCluster = le.Uint32(bpb[0x2c:])
+		volumeID = le.Uint32(bpb[0x43:])
+		label = bpb[0x47:0x52]
+	} else {
+		volumeID = le.Uint32(bpb[0x27:])
+		label = bpb[0x2b:0x36]
+	}
+	// the same format as blkid uses
+	v.uuid = fmt.Sprintf("%04X-%04X", volumeID>>16, volumeID&0xffff)
+	v.label = strings.TrimRight(string(label), " ")
+	if v.label == "NO NAME" {
+		v.label = ""
+	}
+
+	v.fat, err = readBytes(dev, reserved*bytesPerSector, int(fatSize*bytesPerSector))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read FAT: %w", err)
+	}
+	return v, nil
+}
+
+// next returns the next cluster of a cluster chain and whether the chain
+// continues.
+func (v *vfatFS) next(cluster uint32) (uint32, bool) {
+	le := binary.LittleEndian
+	var next, eoc uint32
+	switch v.fatBits {
+	case 12:
+		off := int(cluster) * 3 / 2
+		if off+2 > len(v.fat) {
+			return 0, false
+		}
+		next = uint32(le.Uint16(v.fat[off:]))
+		if cluster%2 == 1 {
+			next >>= 4
+		}
+		next &= 0xfff
+		eoc = 0xff8
+	case 16:
+		off := int(cluster) * 2
+		if off+2 > len(v.fat) {
+			return 0, false
+		}
+		next = uint32(le.Uint16(v.fat[off:]))
+		eoc = 0xfff8
+	default:
+		off := int(cluster) * 4
+		if off+4 > len(v.fat) {
+			return 0, false
+		}
+		next = le.Uint32(v.fat[off:]) & 0x0fffffff
+		eoc = 0x0ffffff8
+	}
+	if next < 2 || next >= eoc || next >= v.clusters+2 {
+		return 0, false
+	}
+	return next, true
+}
+
+// chain returns the extents of the cluster chain that starts with the
+// given cluster.
+func (v *vfatFS) chain(first uint32) []extent {
+	var extents []extent
+	var logical int64
+	for cluster, ok := first, first >= 2; ok; cluster, ok = v.next(cluster) {
+		physical := v.dataStart + int64(cluster-2)*v.clusterSize
+		if n := len(extents); n > 0 && extents[n-1].physical+extents[n-1].length == physical {
+			extents[n-1].length += v.clusterSize
+		} else {
+			extents = append(extents, extent{logical: logical, physical: physical, length: v.clusterSize})
+		}
+		logical += v.clusterSize
+		// protect against loops in a corrupted FAT
+		if logical > int64(v.clusters)*v.clusterSize {
+			break
+		}
+	}
+	return extents
+}
+
+func (v *vfatFS) root() (node, error) {
+	n := &vfatNode{
+		fs: v,
+		fi: &fileInfo{name: ".", mode: fs.ModeDir | 0755},
+	}
+	if v.fatBits == 32 {
+		n.cluster = v.rootCluster
+	} else {
+		n.fixedRoot = true
+	}
+	return n, nil
+}
+
+type vfatNode struct {
+	fs        *vfatFS
+	fi        *fileInfo
+	cluster   uint32
+	fixedRoot bool
+}
+
+func (n *vfatNode) info() *fileInfo {
+	return n.fi
+}
+
+// vfatTime converts a FAT date and time to a time.Time.
+func vfatTime(date, tm uint16) time.Time {
+	return time.Date(1980+int(date>>9), time.Month(date>>5&0xf), int(date&0x1f),
+		int(tm>>11), int(tm>>5&0x3f), int(tm&0x1f)*2, 0, time.UTC)
+}
+
+func (n *vfatNode) readDir() ([]node, error) {
+	var r io.ReaderAt
+	var size int64
+	if n.fixedRoot {
+		r, size = io.NewSectionReader(n.fs.dev, n.fs.rootStart, n.fs.rootSize), n.fs.rootSize
+	} else {
+		extents := n.fs.chain(n.cluster)
+		for _, e := range extents {
+			size += e.length
+		}
+		r = newExtentReader(n.fs.dev, extents, size)
+	}
+	data := make([]byte, size)
+	if err := readFull(r, data, 0); err != nil {
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+	var nodes []node
+	var longName []uint16
+	for pos := 0; pos+32 <= len(data); pos += 32 {
+		entry := data[pos : pos+32]
+		switch {
+		case entry[0] == 0:
+			return nodes, nil
+		case entry[0] == 0xe5:
+			longName = nil
+			continue
+		case entry[11] == vfatAttrLongName:
+			// long names are stored in reverse order before the short
+			// name entry, 13 UTF-16 characters per entry
+			var chars []uint16
+			for _, off := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				chars = append(chars, le.Uint16(entry[off:]))
+			}
+			if entry[0]&0x40 != 0 {
+				longName = nil
+			}
+			longName = append(chars, longName...)
+			continue
+		case entry[11]&vfatAttrVolumeID != 0:
+			longName = nil
+			continue
+		}
+
+		name := vfatShortName(entry)
+		if longName != nil {
+			if end := slices.Index(longName, 0); end >= 0 {
+				longName = longName[:end]
+			}
+			name = string(utf16.Decode(longName))
+			longName = nil
+		}
+		if name == "." || name == ".." {
+			continue
+		}
+
+		child := &vfatNode{
+			fs:      n.fs,
+			cluster: uint32(le.Uint16(entry[20:]))<<16 | uint32(le.Uint16(entry[26:])),
+			fi: &fileInfo{
+				name:    name,
+				size:    int64(le.Uint32(entry[28:])),
+				mode:    0644,
+				modTime: vfatTime(le.Uint16(entry[24:]), le.Uint16(entry[22:])),
+			},
+		}
+		if entry[11]&vfatAttrDirectory != 0 {
+			child.fi.mode = fs.ModeDir | 0755
+			child.fi.size = 0
+		}
+		nodes = append(nodes, child)
+	}
+	return nodes, nil
+}
+
+// vfatShortName returns the 8.3 name of a directory entry, lower case
+// flags of the base name and extension are respected.
+func vfatShortName(entry []byte) string {
+	base := strings.TrimRight(string(entry[0:8]), " ")
+	ext := strings.TrimRight(string(entry[8:11]), " ")
+	if base != "" && base[0] == 0x05 {
+		base = "\xe5" + base[1:]
+	}
+	if entry[12]&0x08 != 0 {
+		base = strings.ToLower(base)
+	}
+	if entry[12]&0x10 != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+func (n *vfatNode) lookup(name string) (node, error) {
+	children, err := n.readDir()
+	if err != nil {
+		return nil, err
+	}
+	// FAT is case-insensitive
+	for _, child := range children {
+		if strings.EqualFold(child.info().Name(), name) {
+			return child, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (n *vfatNode) readLink() (string, error) {
+	return "", fmt.Errorf("FAT does not support symlinks")
+}
+
+func (n *vfatNode) open() (io.Reader, error) {
+	return newExtentReader(n.fs.dev, n.fs.chain(n.cluster), n.fi.size), nil
+}
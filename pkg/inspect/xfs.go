@@ -0,0 +1,513 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// XFS on-disk format, see
+// https://www.kernel.org/pub/linux/utils/fs/xfs/docs/xfs_filesystem_structure.pdf
+
+const (
+	xfsMagic = "XFSB"
+
+	xfsIncompatFtype = 0x1
+	// ftype, spinodes, meta_uuid, bigtime, nrext64, exchrange and parent
+	xfsSupportedIncompat = 0x1 | 0x2 | 0x4 | 0x8 | 0x20 | 0x40 | 0x80
+
+	xfsVersion2Ftype = 0x200
+
+	xfsFormatLocal   = 1
+	xfsFormatExtents = 2
+	xfsFormatBtree   = 3
+
+	xfsDiflagRealtime  = 0x1
+	xfsDiflag2Bigtime  = 0x8
+	xfsDiflag2Nrext64  = 0x10
+	xfsDirLeafOffset   = 32 << 30
+	xfsDirDataFreeTag  = 0xffff
+	xfsBigtimeEpochSec = 1 << 31
+)
+
+type xfsFS struct {
+	dev io.ReaderAt
+
+	blockSize    int64
+	dirBlockSize int64
+	inodeSize    int64
+	agBlocks     int64
+	agBlockLog   uint
+	inoPerBlkLog uint
+	rootIno      uint64
+	v5           bool
+	ftype        bool
+
+	uuid  string
+	label string
+}
+
+// probeXFS returns whether the device contains an XFS filesystem.
+func probeXFS(dev io.ReaderAt) bool {
+	b := make([]byte, 4)
+	if err := readFull(dev, b, 0); err != nil {
+		return false
+	}
+	return string(b) == xfsMagic
+}
+
+func openXFS(dev io.ReaderAt) (*xfsFS, error) {
+	sb, err := readBytes(dev, 0, 512)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read xfs superblock: %w", err)
+	}
+	if string(sb[0:4]) != xfsMagic {
+		return nil, fmt.Errorf("no xfs superblock found")
+	}
+	be := binary.BigEndian
+
+	x := &xfsFS{
+		dev:          dev,
+		blockSize:    int64(be.Uint32(sb[4:])),
+		inodeSize:    int64(be.Uint16(sb[104:])),
+		agBlocks:     int64(be.Uint32(sb[84:])),
+		agBlockLog:   uint(sb[124]),
+		inoPerBlkLog: uint(sb[123]),
+		rootIno:      be.Uint64(sb[56:]),
+		v5:           be.Uint16(sb[100:])&0xf == 5,
+		label:        string(bytes.TrimRight(sb[108:120], "\x00")),
+	}
+	x.dirBlockSize = x.blockSize << sb[192]
+	if x.v5 {
+		incompat := be.Uint32(sb[216:])
+		if unsupported := incompat &^ xfsSupportedIncompat; unsupported != 0 {
+			return nil, fmt.Errorf("unsupported xfs features: %#x", unsupported)
+		}
+		x.ftype = incompat&xfsIncompatFtype != 0
+	} else {
+		x.ftype = be.Uint32(sb[200:])&xfsVersion2Ftype != 0
+	}
+	if x.blockSize < 512 || x.inodeSize < 256 || x.agBlocks == 0 {
+		return nil, fmt.Errorf("invalid xfs superblock")
+	}
+	id, err := uuid.FromBytes(sb[32:48])
+	if err != nil {
+		return nil, err
+	}
+	x.uuid = id.String()
+	return x, nil
+}
+
+func (x *xfsFS) root() (node, error) {
+	return x.node(x.rootIno, ".")
+}
+
+// fsbOffset returns the byte offset of a filesystem block number, which
+// consists of the allocation group number and the block in the group.
+func (x *xfsFS) fsbOffset(fsb uint64) int64 {
+	ag := int64(fsb >> x.agBlockLog)
+	agBlock := int64(fsb & (1<<x.agBlockLog - 1))
+	return (ag*x.agBlocks + agBlock) * x.blockSize
+}
+
+type xfsInode struct {
+	mode     uint16
+	format   uint8
+	uid      uint32
+	gid      uint32
+	size     int64
+	mtime    time.Time
+	nextents uint64
+	flags    uint16
+	fork     []byte
+}
+
+func (x *xfsFS) readInode(ino uint64) (*xfsInode, error) {
+	agInoLog := x.agBlockLog + x.inoPerBlkLog
+	ag := int64(ino >> agInoLog)
+	agIno := ino & (1<<agInoLog - 1)
+	agBlock := int64(agIno >> x.inoPerBlkLog)
+	index := int64(agIno & (1<<x.inoPerBlkLog - 1))
+
+	raw, err := readBytes(x.dev, (ag*x.agBlocks+agBlock)*x.blockSize+index*x.inodeSize, int(x.inodeSize))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read inode %d: %w", ino, err)
+	}
+	be := binary.BigEndian
+	if string(raw[0:2]) != "IN" {
+		return nil, fmt.Errorf("invalid xfs inode %d", ino)
+	}
+
+	inode := &xfsInode{
+		mode:     be.Uint16(raw[2:]),
+		format:   raw[5],
+		uid:      be.Uint32(raw[8:]),
+		gid:      be.Uint32(raw[12:]),
+		size:     int64(be.Uint64(raw[56:])),
+		nextents: uint64(be.Uint32(raw[76:])),
+		flags:    be.Uint16(raw[90:]),
+	}
+
+	coreSize := 100
+	var flags2 uint64
+	if raw[4] >= 3 {
+		coreSize = 176
+		flags2 = be.Uint64(raw[120:])
+	}
+	if flags2&xfsDiflag2Nrext64 != 0 {
+		inode.nextents = be.Uint64(raw[24:])
+	}
+	if flags2&xfsDiflag2Bigtime != 0 {
+		ns := be.Uint64(raw[40:])
+		inode.mtime = time.Unix(int64(ns/1e9)-xfsBigtimeEpochSec, int64(ns%1e9))
+	} else {
+		inode.mtime = time.Unix(int64(int32(be.Uint32(raw[40:]))), int64(be.Uint32(raw[44:])))
+	}
+
+	forkSize := len(raw) - coreSize
+	if forkOff := int(raw[82]) * 8; forkOff != 0 {
+		forkSize = min(forkSize, forkOff)
+	}
+	inode.fork = raw[coreSize : coreSize+forkSize]
+	return inode, nil
+}
+
+func (x *xfsFS) node(ino uint64, name string) (*xfsNode, error) {
+	inode, err := x.readInode(ino)
+	if err != nil {
+		return nil, err
+	}
+	return &xfsNode{
+		fs:    x,
+		inode: inode,
+		fi: &fileInfo{
+			name:    name,
+			size:    inode.size,
+			mode:    unixMode(uint32(inode.mode)),
+			modTime: inode.mtime,
+			owner:   Owner{UID: inode.uid, GID: inode.gid},
+		},
+	}, nil
+}
+
+// decodeXFSExtent decodes a packed 128 bit extent record.
+func decodeXFSExtent(rec []byte) (startOff, startBlock, blockCount uint64, unwritten bool) {
+	l0 := binary.BigEndian.Uint64(rec[0:])
+	l1 := binary.BigEndian.Uint64(rec[8:])
+	unwritten = l0>>63 != 0
+	startOff = (l0 & (1<<63 - 1)) >> 9
+	startBlock = (l0&0x1ff)<<43 | l1>>21
+	blockCount = l1 & (1<<21 - 1)
+	return
+}
+
+func (x *xfsFS) extentList(recs []byte, count uint64) ([]extent, error) {
+	if uint64(len(recs)) < count*16 {
+		return nil, fmt.Errorf("invalid xfs extent list")
+	}
+	extents := make([]extent, 0, count)
+	for idx := uint64(0); idx < count; idx++ {
+		startOff, startBlock, blockCount, unwritten := decodeXFSExtent(recs[idx*16:])
+		e := extent{
+			logical:  int64(startOff) * x.blockSize,
+			physical: x.fsbOffset(startBlock),
+			length:   int64(blockCount) * x.blockSize,
+		}
+		if unwritten {
+			e.physical = -1
+		}
+		extents = append(extents, e)
+	}
+	return extents, nil
+}
+
+// btreeExtents collects the extents of a block map btree, starting with the
+// root in the inode fork.
+func (x *xfsFS) btreeExtents(fork []byte) ([]extent, error) {
+	be := binary.BigEndian
+	if len(fork) < 4 {
+		return nil, fmt.Errorf("invalid xfs btree root")
+	}
+	level := be.Uint16(fork[0:])
+	numRecs := int(be.Uint16(fork[2:]))
+	maxRecs := (len(fork) - 4) / 16
+	if level == 0 || numRecs > maxRecs {
+		return nil, fmt.Errorf("invalid xfs btree root")
+	}
+	var extents []extent
+	for idx := 0; idx < numRecs; idx++ {
+		ptr := be.Uint64(fork[4+maxRecs*8+idx*8:])
+		childExtents, err := x.btreeBlockExtents(ptr, int(level)-1)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, childExtents...)
+	}
+	return extents, nil
+}
+
+func (x *xfsFS) btreeBlockExtents(fsb uint64, level int) ([]extent, error) {
+	block, err := readBytes(x.dev, x.fsbOffset(fsb), int(x.blockSize))
+	if err != nil {
+		return nil, err
+	}
+	be := binary.BigEndian
+	hdrSize := 24
+	magic := "BMAP"
+	if x.v5 {
+		hdrSize = 72
+		magic = "BMA3"
+	}
+	if string(block[0:4]) != magic || int(be.Uint16(block[4:])) != level {
+		return nil, fmt.Errorf("invalid xfs btree block")
+	}
+	numRecs := int(be.Uint16(block[6:]))
+	if level == 0 {
+		return x.extentList(block[hdrSize:], uint64(numRecs))
+	}
+
+	maxRecs := (len(block) - hdrSize) / 16
+	if numRecs > maxRecs {
+		return nil, fmt.Errorf("invalid xfs btree block")
+	}
+	var extents []extent
+	for idx := 0; idx < numRecs; idx++ {
+		ptr := be.Uint64(block[hdrSize+maxRecs*8+idx*8:])
+		childExtents, err := x.btreeBlockExtents(ptr, level-1)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, childExtents...)
+	}
+	return extents, nil
+}
+
+func (x *xfsFS) extents(inode *xfsInode) ([]extent, error) {
+	if inode.flags&xfsDiflagRealtime != 0 {
+		return nil, fmt.Errorf("xfs realtime files are not supported")
+	}
+	switch inode.format {
+	case xfsFormatExtents:
+		return x.extentList(inode.fork, inode.nextents)
+	case xfsFormatBtree:
+		return x.btreeExtents(inode.fork)
+	default:
+		return nil, fmt.Errorf("unsupported xfs data fork format %d", inode.format)
+	}
+}
+
+func (x *xfsFS) content(inode *xfsInode) (io.Reader, error) {
+	if inode.format == xfsFormatLocal {
+		if inode.size > int64(len(inode.fork)) {
+			return nil, fmt.Errorf("invalid xfs inline data")
+		}
+		return bytes.NewReader(inode.fork[:inode.size]), nil
+	}
+	extents, err := x.extents(inode)
+	if err != nil {
+		return nil, err
+	}
+	return newExtentReader(x.dev, extents, inode.size), nil
+}
+
+type xfsNode struct {
+	fs    *xfsFS
+	inode *xfsInode
+	fi    *fileInfo
+}
+
+func (n *xfsNode) info() *fileInfo {
+	return n.fi
+}
+
+type xfsDirEntry struct {
+	ino  uint64
+	name string
+}
+
+// shortformEntries returns the entries of a directory that is stored in
+// the inode fork.
+func (n *xfsNode) shortformEntries() ([]xfsDirEntry, error) {
+	fork := n.inode.fork
+	if len(fork) < 2 {
+		return nil, fmt.Errorf("invalid xfs short form directory")
+	}
+	count := int(fork[0])
+	inoSize := 4
+	if fork[1] != 0 {
+		inoSize = 8
+	}
+	pos := 2 + inoSize
+
+	var entries []xfsDirEntry
+	for idx := 0; idx < count; idx++ {
+		if pos >= len(fork) {
+			return nil, fmt.Errorf("invalid xfs short form directory")
+		}
+		nameLen := int(fork[pos])
+		// name length and offset
+		pos += 3
+		end := pos + nameLen
+		if n.fs.ftype {
+			end++
+		}
+		if end+inoSize > len(fork) {
+			return nil, fmt.Errorf("invalid xfs short form directory")
+		}
+		var ino uint64
+		if inoSize == 8 {
+			ino = binary.BigEndian.Uint64(fork[end:])
+		} else {
+			ino = uint64(binary.BigEndian.Uint32(fork[end:]))
+		}
+		entries = append(entries, xfsDirEntry{ino: ino, name: string(fork[pos : pos+nameLen])})
+		pos = end + inoSize
+	}
+	return entries, nil
+}
+
+// blockEntries returns the entries of a directory that is stored in
+// directory blocks (the block, leaf and node directory formats). Only the
+// data blocks are read, the hash indexes are not needed to list all entries.
+func (n *xfsNode) blockEntries() ([]xfsDirEntry, error) {
+	extents, err := n.fs.extents(n.inode)
+	if err != nil {
+		return nil, err
+	}
+	r := newExtentReader(n.fs.dev, extents, min(n.inode.size, xfsDirLeafOffset))
+
+	be := binary.BigEndian
+	hdrSize := 16
+	if n.fs.v5 {
+		hdrSize = 64
+	}
+	var entries []xfsDirEntry
+	block := make([]byte, n.fs.dirBlockSize)
+	for off := int64(0); off < r.Size(); off += n.fs.dirBlockSize {
+		if _, err := r.ReadAt(block, off); err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		end := len(block)
+		switch string(block[0:4]) {
+		case "XD2B", "XDB3":
+			// single block directories end with the hash index and a
+			// tail with the number of index entries
+			count := int(be.Uint32(block[len(block)-8:]))
+			end = len(block) - 8 - count*8
+		case "XD2D", "XDD3":
+		default:
+			// holes of freed blocks
+			continue
+		}
+
+		for pos := hdrSize; pos+8 <= end; {
+			if be.Uint16(block[pos:]) == xfsDirDataFreeTag {
+				length := int(be.Uint16(block[pos+2:]))
+				if length == 0 {
+					return nil, fmt.Errorf("invalid xfs directory block")
+				}
+				pos += length
+				continue
+			}
+			ino := be.Uint64(block[pos:])
+			nameLen := int(block[pos+8])
+			size := 8 + 1 + nameLen + 2
+			if n.fs.ftype {
+				size++
+			}
+			size = (size + 7) &^ 7
+			if pos+size > end {
+				return nil, fmt.Errorf("invalid xfs directory entry")
+			}
+			name := string(block[pos+9 : pos+9+nameLen])
+			if name != "." && name != ".." {
+				entries = append(entries, xfsDirEntry{ino: ino, name: name})
+			}
+			pos += size
+		}
+	}
+	return entries, nil
+}
+
+func (n *xfsNode) entries() ([]xfsDirEntry, error) {
+	if n.inode.format == xfsFormatLocal {
+		return n.shortformEntries()
+	}
+	return n.blockEntries()
+}
+
+func (n *xfsNode) lookup(name string) (node, error) {
+	entries, err := n.entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.name == name {
+			return n.fs.node(entry.ino, entry.name)
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (n *xfsNode) readDir() ([]node, error) {
+	entries, err := n.entries()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]node, 0, len(entries))
+	for _, entry := range entries {
+		child, err := n.fs.node(entry.ino, entry.name)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, child)
+	}
+	return nodes, nil
+}
+
+func (n *xfsNode) readLink() (string, error) {
+	if n.inode.format == xfsFormatLocal {
+		r, err := n.fs.content(n.inode)
+		if err != nil {
+			return "", err
+		}
+		target, err := io.ReadAll(r)
+		return string(target), err
+	}
+
+	// remote symlinks, on v5 filesystems every block starts with a header
+	extents, err := n.fs.extents(n.inode)
+	if err != nil {
+		return "", err
+	}
+	var target []byte
+	for _, e := range extents {
+		for off := int64(0); off < e.length; off += n.fs.blockSize {
+			block, err := readBytes(n.fs.dev, e.physical+off, int(n.fs.blockSize))
+			if err != nil {
+				return "", err
+			}
+			if n.fs.v5 {
+				if string(block[0:4]) != "XSLM" {
+					return "", fmt.Errorf("invalid xfs symlink block")
+				}
+				block = block[56:]
+			}
+			target = append(target, block...)
+		}
+	}
+	if int64(len(target)) < n.inode.size {
+		return "", fmt.Errorf("truncated xfs symlink")
+	}
+	return string(target[:n.inode.size]), nil
+}
+
+func (n *xfsNode) open() (io.Reader, error) {
+	return n.fs.content(n.inode)
+}
@@ -0,0 +1,362 @@
+// Package lockfile records the depsolved packages of an image, so the image
+// can be rebuilt later with exactly the same RPMs, without depsolving again.
+// The resolved container digests, ostree commits and flatpaks of the image
+// are locked as well.
+//
+// A lockfile is created from the depsolve and resolve results of a manifest
+// generation and used instead of the depsolver and resolvers when generating
+// the manifest again. The package requests and sources of the image must be
+// satisfied by the lockfile, otherwise using the lockfile fails. The locked
+// containers and commits must still be fetchable.
+package lockfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
+)
+
+// Version is the version of the lockfile format
+const Version = 1
+
+// gpgKeysDir is the directory of the only files of the packages that are
+// locked, the manifests import GPG keys from the tree (see
+// osbuild.RPMStageOptions.GPGKeysFromTree).
+const gpgKeysDir = "/etc/pki/rpm-gpg/"
+
+var (
+	// ErrUnsatisfied is returned when the package requests of an image
+	// are not satisfied by the locked packages.
+	ErrUnsatisfied = errors.New("package requests not satisfied by the lockfile")
+
+	// ErrMismatch is returned when a lockfile is used for a different
+	// image than it was created for.
+	ErrMismatch = errors.New("lockfile does not match the image")
+
+	// ErrUnavailable is returned when a locked container or ostree
+	// commit cannot be fetched anymore.
+	ErrUnavailable = errors.New("locked source is not available")
+)
+
+// Lockfile contains the depsolved packages and the resolved containers,
+// ostree commits and flatpaks of the pipelines of an image.
+type Lockfile struct {
+	Version   int                 `json:"version"`
+	Distro    string              `json:"distro"`
+	Arch      string              `json:"arch"`
+	ImageType string              `json:"image-type"`
+	Pipelines map[string]Pipeline `json:"pipelines"`
+
+	Containers map[string][]Container `json:"containers,omitempty"`
+	Commits    map[string][]Commit    `json:"ostree-commits,omitempty"`
+	Flatpaks   map[string][]Flatpak   `json:"flatpaks,omitempty"`
+}
+
+// Pipeline contains the packages of a pipeline, in the transactions that
+// install them, and the package requests they were depsolved for.
+type Pipeline struct {
+	Requests     []Request          `json:"requests"`
+	Transactions [][]Package        `json:"transactions"`
+	Modules      []rpmmd.ModuleSpec `json:"modules,omitempty"`
+	Repos        []rpmmd.RepoConfig `json:"repos"`
+}
+
+// Request is the package request of a transaction.
+type Request struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Package is a locked package with everything needed to download and
+// install it.
+type Package struct {
+	Name    string `json:"name"`
+	Epoch   uint   `json:"epoch,omitempty"`
+	Version string `json:"version"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+
+	Checksum        string   `json:"checksum"`
+	HeaderChecksum  string   `json:"header_checksum,omitempty"`
+	Location        string   `json:"location,omitempty"`
+	RemoteLocations []string `json:"remote_locations"`
+	RepoID          string   `json:"repo_id"`
+
+	Secrets   string `json:"secrets,omitempty"`
+	CheckGPG  bool   `json:"check_gpg,omitempty"`
+	IgnoreSSL bool   `json:"ignore_ssl,omitempty"`
+
+	// Provides are the names of the capabilities of the package, used to
+	// check package requests that are not package names
+	Provides []string `json:"provides,omitempty"`
+	// Files are the GPG keys in the package, the other files are not
+	// locked
+	Files []string `json:"files,omitempty"`
+}
+
+// New returns a lockfile for the depsolve results of the given package set
+// chains.
+func New(distro, arch, imageType string, pkgSetChains map[string][]rpmmd.PackageSet, depsolved map[string]depsolvednf.DepsolveResult) (*Lockfile, error) {
+	lf := &Lockfile{
+		Version:   Version,
+		Distro:    distro,
+		Arch:      arch,
+		ImageType: imageType,
+		Pipelines: make(map[string]Pipeline, len(depsolved)),
+	}
+	for name, res := range depsolved {
+		chain, ok := pkgSetChains[name]
+		if !ok {
+			return nil, fmt.Errorf("no package sets for depsolved pipeline %q", name)
+		}
+		pl := Pipeline{
+			Modules: res.Modules,
+			Repos:   res.Repos,
+		}
+		for _, pkgSet := range chain {
+			pl.Requests = append(pl.Requests, Request{Include: pkgSet.Include, Exclude: pkgSet.Exclude})
+		}
+		for _, tx := range res.Transactions {
+			pkgs := make([]Package, 0, len(tx))
+			for _, pkg := range tx {
+				pkgs = append(pkgs, newPackage(pkg))
+			}
+			pl.Transactions = append(pl.Transactions, pkgs)
+		}
+		lf.Pipelines[name] = pl
+	}
+	return lf, nil
+}
+
+func newPackage(pkg rpmmd.Package) Package {
+	p := Package{
+		Name:            pkg.Name,
+		Epoch:           pkg.Epoch,
+		Version:         pkg.Version,
+		Release:         pkg.Release,
+		Arch:            pkg.Arch,
+		Checksum:        pkg.Checksum.String(),
+		Location:        pkg.Location,
+		RemoteLocations: pkg.RemoteLocations,
+		RepoID:          pkg.RepoID,
+		Secrets:         pkg.Secrets,
+		CheckGPG:        pkg.CheckGPG,
+		IgnoreSSL:       pkg.IgnoreSSL,
+	}
+	if pkg.HeaderChecksum.Value != "" {
+		p.HeaderChecksum = pkg.HeaderChecksum.String()
+	}
+	for _, dep := range pkg.Provides {
+		if !slices.Contains(p.Provides, dep.Name) {
+			p.Provides = append(p.Provides, dep.Name)
+		}
+	}
+	for _, file := range pkg.Files {
+		if strings.HasPrefix(file, gpgKeysDir) {
+			p.Files = append(p.Files, file)
+		}
+	}
+	return p
+}
+
+func parseChecksum(s string) (rpmmd.Checksum, error) {
+	algo, value, ok := strings.Cut(s, ":")
+	if !ok || algo == "" || value == "" {
+		return rpmmd.Checksum{}, fmt.Errorf("invalid checksum %q", s)
+	}
+	return rpmmd.Checksum{Type: algo, Value: value}, nil
+}
+
+func (p Package) toRPMMD(repo *rpmmd.RepoConfig) (rpmmd.Package, error) {
+	checksum, err := parseChecksum(p.Checksum)
+	if err != nil {
+		return rpmmd.Package{}, fmt.Errorf("package %s: %w", p.Name, err)
+	}
+	pkg := rpmmd.Package{
+		Name:            p.Name,
+		Epoch:           p.Epoch,
+		Version:         p.Version,
+		Release:         p.Release,
+		Arch:            p.Arch,
+		Checksum:        checksum,
+		Location:        p.Location,
+		RemoteLocations: p.RemoteLocations,
+		RepoID:          p.RepoID,
+		Repo:            repo,
+		Secrets:         p.Secrets,
+		CheckGPG:        p.CheckGPG,
+		IgnoreSSL:       p.IgnoreSSL,
+		Files:           p.Files,
+	}
+	if p.HeaderChecksum != "" {
+		pkg.HeaderChecksum, err = parseChecksum(p.HeaderChecksum)
+		if err != nil {
+			return rpmmd.Package{}, fmt.Errorf("package %s: %w", p.Name, err)
+		}
+	}
+	for _, name := range p.Provides {
+		pkg.Provides = append(pkg.Provides, rpmmd.RelDep{Name: name})
+	}
+	return pkg, nil
+}
+
+// Parse reads a lockfile.
+func Parse(r io.Reader) (*Lockfile, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var lf Lockfile
+	if err := dec.Decode(&lf); err != nil {
+		return nil, fmt.Errorf("cannot parse lockfile: %w", err)
+	}
+	if lf.Version != Version {
+		return nil, fmt.Errorf("unsupported lockfile version %d, expected %d", lf.Version, Version)
+	}
+	return &lf, nil
+}
+
+// Load reads the lockfile in the given file.
+func Load(filename string) (*Lockfile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lf, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return lf, nil
+}
+
+// Write writes the lockfile as indented JSON.
+func (lf *Lockfile) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lf)
+}
+
+// Check returns an ErrMismatch error if the lockfile was created for
+// another image.
+func (lf *Lockfile) Check(distro, arch, imageType string) error {
+	if lf.Distro != distro || lf.Arch != arch || lf.ImageType != imageType {
+		return fmt.Errorf("%w: locked %s/%s/%s, requested %s/%s/%s", ErrMismatch,
+			lf.Distro, lf.Arch, lf.ImageType, distro, arch, imageType)
+	}
+	return nil
+}
+
+// Resolve returns the locked packages of the given package set chains as
+// depsolve results, or an ErrUnsatisfied error if the lockfile does not
+// satisfy the package requests.
+//
+// A package request is satisfied if it was part of the locked requests of
+// the pipeline, or if it names a locked package of the pipeline or one of
+// its capabilities. The packages are installed in the locked transactions,
+// so requests can move between transactions. Locked packages that are
+// excluded by the request of their transaction are an error as well.
+//
+// The depsolve results only include a SBOM for sbomType
+// sbom.StandardTypeCycloneDX, the SPDX documents are generated by the
+// depsolver.
+func (lf *Lockfile) Resolve(pkgSetChains map[string][]rpmmd.PackageSet, sbomType sbom.StandardType) (map[string]depsolvednf.DepsolveResult, error) {
+	results := make(map[string]depsolvednf.DepsolveResult, len(pkgSetChains))
+	var errs []error
+	for name, chain := range pkgSetChains {
+		pl, ok := lf.Pipelines[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: no packages locked for pipeline %q", ErrUnsatisfied, name))
+			continue
+		}
+		res, err := pl.resolve(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := pl.check(name, chain); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if sbomType == sbom.StandardTypeCycloneDX {
+			res.SBOM, err = sbom.NewCycloneDXDocument(res.Transactions.AllPackages(), lf.Distro)
+			if err != nil {
+				return nil, err
+			}
+		}
+		results[name] = res
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+func (pl Pipeline) resolve(name string) (depsolvednf.DepsolveResult, error) {
+	res := depsolvednf.DepsolveResult{
+		Modules: pl.Modules,
+		Repos:   pl.Repos,
+	}
+	for _, tx := range pl.Transactions {
+		pkgs := make(rpmmd.PackageList, 0, len(tx))
+		for _, p := range tx {
+			repoIdx := slices.IndexFunc(res.Repos, func(r rpmmd.RepoConfig) bool {
+				return r.Id == p.RepoID
+			})
+			if repoIdx < 0 {
+				return res, fmt.Errorf("pipeline %q: unknown repository %q of package %s", name, p.RepoID, p.Name)
+			}
+			pkg, err := p.toRPMMD(&res.Repos[repoIdx])
+			if err != nil {
+				return res, fmt.Errorf("pipeline %q: %w", name, err)
+			}
+			pkgs = append(pkgs, pkg)
+		}
+		res.Transactions = append(res.Transactions, pkgs)
+	}
+	return res, nil
+}
+
+// check returns an ErrUnsatisfied error if the locked pipeline does not
+// satisfy the package set chain.
+func (pl Pipeline) check(name string, chain []rpmmd.PackageSet) error {
+	var missing, excluded []string
+	for idx, pkgSet := range chain {
+		for _, include := range pkgSet.Include {
+			if slices.ContainsFunc(pl.Requests, func(r Request) bool { return slices.Contains(r.Include, include) }) {
+				continue
+			}
+			if !slices.ContainsFunc(pl.Transactions, func(tx []Package) bool {
+				return slices.ContainsFunc(tx, func(p Package) bool { return p.provides(include) })
+			}) && !slices.Contains(missing, include) {
+				missing = append(missing, include)
+			}
+		}
+		if idx >= len(pl.Transactions) {
+			continue
+		}
+		for _, p := range pl.Transactions[idx] {
+			if slices.Contains(pkgSet.Exclude, p.Name) {
+				excluded = append(excluded, p.Name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: pipeline %q: missing %s", ErrUnsatisfied, name, strings.Join(missing, ", "))
+	}
+	if len(excluded) > 0 {
+		return fmt.Errorf("%w: pipeline %q: excluded packages are locked: %s", ErrUnsatisfied, name, strings.Join(excluded, ", "))
+	}
+	return nil
+}
+
+// provides returns whether the package has the given name or capability.
+func (p Package) provides(capability string) bool {
+	return p.Name == capability || slices.Contains(p.Provides, capability)
+}
@@ -0,0 +1,234 @@
+package lockfile_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/lockfile"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
+)
+
+var testRepo = rpmmd.RepoConfig{
+	Id:       "8e8b7c6f",
+	Name:     "baseos",
+	BaseURLs: []string{"https://example.com/baseos"},
+	GPGKeys:  []string{"-----BEGIN PGP PUBLIC KEY BLOCK-----"},
+	CheckGPG: common.ToPtr(true),
+}
+
+func testPackage(name, version string, provides ...string) rpmmd.Package {
+	pkg := rpmmd.Package{
+		Name:            name,
+		Version:         version,
+		Release:         "1.el9",
+		Arch:            "x86_64",
+		Checksum:        rpmmd.Checksum{Type: "sha256", Value: strings.Repeat(name[:1], 64)},
+		Location:        "Packages/" + name + "-" + version + "-1.el9.x86_64.rpm",
+		RepoID:          testRepo.Id,
+		Repo:            &testRepo,
+		CheckGPG:        true,
+		Summary:         "not locked",
+		Files:           []string{"/usr/bin/" + name},
+		RemoteLocations: []string{"https://example.com/baseos/Packages/" + name + "-" + version + "-1.el9.x86_64.rpm"},
+	}
+	for _, p := range provides {
+		pkg.Provides = append(pkg.Provides, rpmmd.RelDep{Name: p, Relationship: "=", Version: version})
+	}
+	return pkg
+}
+
+func testChains() map[string][]rpmmd.PackageSet {
+	return map[string][]rpmmd.PackageSet{
+		"build": {
+			{Include: []string{"rpm"}},
+		},
+		"os": {
+			{Include: []string{"@core", "kernel"}, Exclude: []string{"dracut-config-rescue"}},
+			{Include: []string{"bash"}},
+		},
+	}
+}
+
+func testDepsolved() map[string]depsolvednf.DepsolveResult {
+	release := testPackage("centos-release", "9.0", "system-release")
+	release.Files = []string{"/etc/os-release", "/etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial"}
+	release.Epoch = 1
+	return map[string]depsolvednf.DepsolveResult{
+		"build": {
+			Transactions: depsolvednf.TransactionList{{testPackage("rpm", "4.16")}},
+			Repos:        []rpmmd.RepoConfig{testRepo},
+		},
+		"os": {
+			Transactions: depsolvednf.TransactionList{
+				{release, testPackage("kernel", "5.14", "kernel-core")},
+				{testPackage("bash", "5.1", "/bin/sh")},
+			},
+			Repos: []rpmmd.RepoConfig{testRepo},
+		},
+	}
+}
+
+func roundTrip(t *testing.T, lf *lockfile.Lockfile) *lockfile.Lockfile {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, lf.Write(&buf))
+	res, err := lockfile.Parse(&buf)
+	require.NoError(t, err)
+	return res
+}
+
+func TestLockfileRoundTrip(t *testing.T) {
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+	lf = roundTrip(t, lf)
+	assert.NoError(t, lf.Check("centos-9", "x86_64", "qcow2"))
+
+	res, err := lf.Resolve(testChains(), sbom.StandardTypeSpdx)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Nil(t, res["os"].SBOM)
+	assert.Equal(t, []rpmmd.RepoConfig{testRepo}, res["os"].Repos)
+
+	osTransactions := res["os"].Transactions
+	require.Len(t, osTransactions, 2)
+	release := osTransactions[0][0]
+	assert.Equal(t, "centos-release-1:9.0-1.el9.x86_64", release.FullNEVRA())
+	assert.Equal(t, "sha256:"+strings.Repeat("c", 64), release.Checksum.String())
+	assert.Equal(t, "Packages/centos-release-9.0-1.el9.x86_64.rpm", release.Location)
+	assert.Equal(t, []string{"https://example.com/baseos/Packages/centos-release-9.0-1.el9.x86_64.rpm"}, release.RemoteLocations)
+	assert.Equal(t, testRepo.Id, release.RepoID)
+	assert.Same(t, &res["os"].Repos[0], release.Repo)
+	assert.True(t, release.CheckGPG)
+	assert.Equal(t, rpmmd.RelDepList{{Name: "system-release"}}, release.Provides)
+	// only the GPG keys are locked
+	assert.Equal(t, []string{"/etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial"}, release.Files)
+	assert.Empty(t, release.Summary)
+	assert.Equal(t, "bash", osTransactions[1][0].Name)
+}
+
+func TestLockfileResolveUnsatisfied(t *testing.T) {
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+	lf = roundTrip(t, lf)
+
+	for _, tc := range []struct {
+		name   string
+		modify func(map[string][]rpmmd.PackageSet)
+		expErr string
+	}{
+		{
+			"provides",
+			func(chains map[string][]rpmmd.PackageSet) {
+				chains["os"][1].Include = append(chains["os"][1].Include, "/bin/sh", "kernel-core", "system-release")
+			},
+			"",
+		},
+		{
+			"missing package",
+			func(chains map[string][]rpmmd.PackageSet) {
+				chains["os"][1].Include = append(chains["os"][1].Include, "tmux", "@standard")
+			},
+			`pipeline "os": missing tmux, @standard`,
+		},
+		{
+			"other transaction",
+			func(chains map[string][]rpmmd.PackageSet) {
+				chains["os"][0].Include = append(chains["os"][0].Include, "bash")
+				chains["os"] = append(chains["os"], rpmmd.PackageSet{Include: []string{"kernel"}})
+			},
+			"",
+		},
+		{
+			"excluded",
+			func(chains map[string][]rpmmd.PackageSet) {
+				chains["os"][0].Exclude = append(chains["os"][0].Exclude, "kernel")
+			},
+			`pipeline "os": excluded packages are locked: kernel`,
+		},
+		{
+			"pipeline",
+			func(chains map[string][]rpmmd.PackageSet) {
+				chains["installer"] = []rpmmd.PackageSet{{Include: []string{"anaconda"}}}
+			},
+			`no packages locked for pipeline "installer"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chains := testChains()
+			tc.modify(chains)
+			_, err := lf.Resolve(chains, sbom.StandardTypeSpdx)
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, lockfile.ErrUnsatisfied)
+			assert.ErrorContains(t, err, tc.expErr)
+		})
+	}
+}
+
+func TestLockfileResolveCycloneDX(t *testing.T) {
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+	res, err := lf.Resolve(testChains(), sbom.StandardTypeCycloneDX)
+	require.NoError(t, err)
+	require.NotNil(t, res["os"].SBOM)
+	assert.Equal(t, sbom.StandardTypeCycloneDX, res["os"].SBOM.DocType)
+}
+
+func TestLockfileCheck(t *testing.T) {
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+	err = lf.Check("centos-9", "aarch64", "qcow2")
+	assert.ErrorIs(t, err, lockfile.ErrMismatch)
+	assert.ErrorContains(t, err, "locked centos-9/x86_64/qcow2, requested centos-9/aarch64/qcow2")
+}
+
+func TestLockfileNewErrors(t *testing.T) {
+	chains := testChains()
+	delete(chains, "build")
+	_, err := lockfile.New("centos-9", "x86_64", "qcow2", chains, testDepsolved())
+	assert.EqualError(t, err, `no package sets for depsolved pipeline "build"`)
+}
+
+func TestLockfileLoad(t *testing.T) {
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, lf.Write(&buf))
+	path := filepath.Join(t.TempDir(), "image.lock.json")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+
+	loaded, err := lockfile.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, lf.Pipelines["os"].Requests, loaded.Pipelines["os"].Requests)
+
+	_, err = lockfile.Parse(strings.NewReader(`{"version": 2}`))
+	assert.EqualError(t, err, "unsupported lockfile version 2, expected 1")
+	_, err = lockfile.Parse(strings.NewReader(`{"version": 1, "packages": []}`))
+	assert.ErrorContains(t, err, `unknown field "packages"`)
+}
+
+func TestLockfileBrokenPackages(t *testing.T) {
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+
+	build := lf.Pipelines["build"]
+	build.Transactions[0][0].RepoID = "unknown"
+	_, err = lf.Resolve(testChains(), sbom.StandardTypeSpdx)
+	assert.ErrorContains(t, err, `pipeline "build": unknown repository "unknown" of package rpm`)
+
+	build.Transactions[0][0].RepoID = testRepo.Id
+	build.Transactions[0][0].Checksum = "abc"
+	_, err = lf.Resolve(testChains(), sbom.StandardTypeSpdx)
+	assert.ErrorContains(t, err, `pipeline "build": package rpm: invalid checksum "abc"`)
+}
@@ -0,0 +1,344 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/flatpak"
+	"github.com/osbuild/images/pkg/ostree"
+)
+
+// Container is a locked container image.
+type Container struct {
+	// Ref and Name are the requested source and local name of the
+	// container, they identify the locked container of a request
+	Ref  string `json:"ref,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	Source       string `json:"source"`
+	Digest       string `json:"digest"`
+	ImageID      string `json:"image_id"`
+	TLSVerify    *bool  `json:"tls_verify,omitempty"`
+	LocalName    string `json:"local_name,omitempty"`
+	ListDigest   string `json:"list_digest,omitempty"`
+	LocalStorage bool   `json:"local_storage,omitempty"`
+	Arch         string `json:"arch,omitempty"`
+}
+
+// Commit is a locked ostree commit.
+type Commit struct {
+	// Remote is the requested repository URL of the commit, it
+	// identifies the locked commit of a request together with the Ref
+	Remote string `json:"remote,omitempty"`
+	Ref    string `json:"ref"`
+
+	URL        string `json:"url,omitempty"`
+	ContentURL string `json:"content_url,omitempty"`
+	Secrets    string `json:"secrets,omitempty"`
+	Checksum   string `json:"checksum"`
+}
+
+// Flatpak is a locked flatpak, either a container or an ostree commit
+// depending on the type of the registry.
+type Flatpak struct {
+	Registry  string `json:"registry"`
+	Reference string `json:"reference"`
+
+	Container *Container `json:"container,omitempty"`
+	Commit    *Commit    `json:"commit,omitempty"`
+}
+
+// Verifier checks that the locked containers and ostree commits can still
+// be fetched.
+type Verifier interface {
+	VerifyContainer(spec container.Spec) error
+	VerifyCommit(source ostree.SourceSpec, commit ostree.CommitSpec) error
+}
+
+type remoteVerifier struct{}
+
+func (remoteVerifier) VerifyContainer(spec container.Spec) error {
+	return container.Verify(spec)
+}
+
+func (remoteVerifier) VerifyCommit(source ostree.SourceSpec, commit ostree.CommitSpec) error {
+	return ostree.Verify(source, commit)
+}
+
+// RemoteVerifier checks the locked containers at their registries (or in
+// the local container storage) and the locked commits at their ostree
+// repositories.
+var RemoteVerifier Verifier = remoteVerifier{}
+
+func newContainer(spec container.Spec) *Container {
+	c := &Container{
+		Source:       spec.Source,
+		Digest:       spec.Digest,
+		ImageID:      spec.ImageID,
+		TLSVerify:    spec.TLSVerify,
+		LocalName:    spec.LocalName,
+		ListDigest:   spec.ListDigest,
+		LocalStorage: spec.LocalStorage,
+	}
+	if spec.Arch != arch.ARCH_UNSET {
+		c.Arch = spec.Arch.String()
+	}
+	return c
+}
+
+func (c Container) toSpec() (container.Spec, error) {
+	spec := container.Spec{
+		Source:       c.Source,
+		Digest:       c.Digest,
+		TLSVerify:    c.TLSVerify,
+		ImageID:      c.ImageID,
+		LocalName:    c.LocalName,
+		ListDigest:   c.ListDigest,
+		LocalStorage: c.LocalStorage,
+	}
+	if c.Arch != "" {
+		a, err := arch.FromString(c.Arch)
+		if err != nil {
+			return spec, fmt.Errorf("container %s: %w", c.Source, err)
+		}
+		spec.Arch = a
+	}
+	return spec, nil
+}
+
+// matches returns whether the locked container was resolved for the
+// container source.
+func (c Container) matches(src container.SourceSpec) bool {
+	if src.Digest != nil && *src.Digest != "" && *src.Digest != c.Digest {
+		return false
+	}
+	return c.Ref == src.Source && c.Name == src.Name && c.LocalStorage == src.Local
+}
+
+func newCommit(commit ostree.CommitSpec) *Commit {
+	return &Commit{
+		Ref:        commit.Ref,
+		URL:        commit.URL,
+		ContentURL: commit.ContentURL,
+		Secrets:    commit.Secrets,
+		Checksum:   commit.Checksum,
+	}
+}
+
+func (c Commit) toSpec() ostree.CommitSpec {
+	return ostree.CommitSpec{
+		Ref:        c.Ref,
+		URL:        c.URL,
+		ContentURL: c.ContentURL,
+		Secrets:    c.Secrets,
+		Checksum:   c.Checksum,
+	}
+}
+
+// LockContainers adds the resolved container specs of the container
+// sources to the lockfile. The specs of a pipeline are in the order of its
+// sources.
+func (lf *Lockfile) LockContainers(sources map[string][]container.SourceSpec, specs map[string][]container.Spec) error {
+	for name, srcs := range sources {
+		if len(srcs) != len(specs[name]) {
+			return fmt.Errorf("pipeline %q: %d container sources resolved to %d containers", name, len(srcs), len(specs[name]))
+		}
+		if len(srcs) == 0 {
+			continue
+		}
+		if lf.Containers == nil {
+			lf.Containers = make(map[string][]Container, len(sources))
+		}
+		containers := make([]Container, 0, len(srcs))
+		for idx, src := range srcs {
+			c := newContainer(specs[name][idx])
+			c.Ref = src.Source
+			c.Name = src.Name
+			containers = append(containers, *c)
+		}
+		lf.Containers[name] = containers
+	}
+	return nil
+}
+
+// LockCommits adds the resolved ostree commits of the commit sources to the
+// lockfile. The commits of a pipeline are in the order of its sources.
+func (lf *Lockfile) LockCommits(sources map[string][]ostree.SourceSpec, commits map[string][]ostree.CommitSpec) error {
+	for name, srcs := range sources {
+		if len(srcs) != len(commits[name]) {
+			return fmt.Errorf("pipeline %q: %d ostree sources resolved to %d commits", name, len(srcs), len(commits[name]))
+		}
+		if len(srcs) == 0 {
+			continue
+		}
+		if lf.Commits == nil {
+			lf.Commits = make(map[string][]Commit, len(sources))
+		}
+		locked := make([]Commit, 0, len(srcs))
+		for idx, src := range srcs {
+			c := newCommit(commits[name][idx])
+			c.Remote = src.URL
+			c.Ref = src.Ref
+			locked = append(locked, *c)
+		}
+		lf.Commits[name] = locked
+	}
+	return nil
+}
+
+// LockFlatpaks adds the resolved flatpaks of the flatpak sources to the
+// lockfile. The flatpaks of a pipeline are in the order of its sources.
+func (lf *Lockfile) LockFlatpaks(sources map[string][]flatpak.SourceSpec, specs map[string][]flatpak.Spec) error {
+	for name, srcs := range sources {
+		if len(srcs) != len(specs[name]) {
+			return fmt.Errorf("pipeline %q: %d flatpak sources resolved to %d flatpaks", name, len(srcs), len(specs[name]))
+		}
+		if len(srcs) == 0 {
+			continue
+		}
+		if lf.Flatpaks == nil {
+			lf.Flatpaks = make(map[string][]Flatpak, len(sources))
+		}
+		flatpaks := make([]Flatpak, 0, len(srcs))
+		for idx, src := range srcs {
+			spec := specs[name][idx]
+			fp := Flatpak{
+				Registry:  src.Registry.URI,
+				Reference: src.Reference.String(),
+			}
+			if spec.ContainerSpec != nil {
+				fp.Container = newContainer(*spec.ContainerSpec)
+			}
+			if spec.CommitSpec != nil {
+				fp.Commit = newCommit(*spec.CommitSpec)
+			}
+			flatpaks = append(flatpaks, fp)
+		}
+		lf.Flatpaks[name] = flatpaks
+	}
+	return nil
+}
+
+// ResolveContainers returns the locked containers of the container sources,
+// or an ErrUnsatisfied error if a container is not locked. The locked
+// containers are checked with the verifier, containers that cannot be
+// fetched anymore are an ErrUnavailable error.
+func (lf *Lockfile) ResolveContainers(sources map[string][]container.SourceSpec, verifier Verifier) (map[string][]container.Spec, error) {
+	results := make(map[string][]container.Spec, len(sources))
+	var errs []error
+	for name, srcs := range sources {
+		specs := make([]container.Spec, 0, len(srcs))
+		for _, src := range srcs {
+			idx := slices.IndexFunc(lf.Containers[name], func(c Container) bool { return c.matches(src) })
+			if idx < 0 {
+				errs = append(errs, fmt.Errorf("%w: pipeline %q: container %s is not locked", ErrUnsatisfied, name, src.Source))
+				continue
+			}
+			spec, err := lf.Containers[name][idx].toSpec()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("pipeline %q: %w", name, err))
+				continue
+			}
+			if err := verifier.VerifyContainer(spec); err != nil {
+				errs = append(errs, fmt.Errorf("%w: pipeline %q: container %s: %w", ErrUnavailable, name, src.Source, err))
+				continue
+			}
+			specs = append(specs, spec)
+		}
+		results[name] = specs
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+// ResolveCommits returns the locked ostree commits of the commit sources,
+// or an ErrUnsatisfied error if a commit is not locked. The locked commits
+// are checked with the verifier, commits that cannot be fetched anymore are
+// an ErrUnavailable error.
+func (lf *Lockfile) ResolveCommits(sources map[string][]ostree.SourceSpec, verifier Verifier) (map[string][]ostree.CommitSpec, error) {
+	results := make(map[string][]ostree.CommitSpec, len(sources))
+	var errs []error
+	for name, srcs := range sources {
+		commits := make([]ostree.CommitSpec, 0, len(srcs))
+		for _, src := range srcs {
+			idx := slices.IndexFunc(lf.Commits[name], func(c Commit) bool {
+				return c.Remote == src.URL && c.Ref == src.Ref
+			})
+			if idx < 0 {
+				errs = append(errs, fmt.Errorf("%w: pipeline %q: ostree commit %s of %s is not locked", ErrUnsatisfied, name, src.Ref, src.URL))
+				continue
+			}
+			commit := lf.Commits[name][idx].toSpec()
+			if err := verifier.VerifyCommit(src, commit); err != nil {
+				errs = append(errs, fmt.Errorf("%w: pipeline %q: ostree commit %s: %w", ErrUnavailable, name, commit.Checksum, err))
+				continue
+			}
+			commits = append(commits, commit)
+		}
+		results[name] = commits
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+// ResolveFlatpaks returns the locked flatpaks of the flatpak sources, or an
+// ErrUnsatisfied error if a flatpak is not locked. The locked containers
+// and commits of the flatpaks are checked with the verifier, flatpaks that
+// cannot be fetched anymore are an ErrUnavailable error.
+func (lf *Lockfile) ResolveFlatpaks(sources map[string][]flatpak.SourceSpec, verifier Verifier) (map[string][]flatpak.Spec, error) {
+	results := make(map[string][]flatpak.Spec, len(sources))
+	var errs []error
+	for name, srcs := range sources {
+		specs := make([]flatpak.Spec, 0, len(srcs))
+		for _, src := range srcs {
+			ref := src.Reference.String()
+			idx := slices.IndexFunc(lf.Flatpaks[name], func(fp Flatpak) bool {
+				return fp.Registry == src.Registry.URI && fp.Reference == ref
+			})
+			if idx < 0 {
+				errs = append(errs, fmt.Errorf("%w: pipeline %q: flatpak %s is not locked", ErrUnsatisfied, name, ref))
+				continue
+			}
+			spec, err := lf.Flatpaks[name][idx].resolve(verifier)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("pipeline %q: flatpak %s: %w", name, ref, err))
+				continue
+			}
+			specs = append(specs, spec)
+		}
+		results[name] = specs
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+func (fp Flatpak) resolve(verifier Verifier) (flatpak.Spec, error) {
+	var spec flatpak.Spec
+	if fp.Container != nil {
+		cs, err := fp.Container.toSpec()
+		if err != nil {
+			return spec, err
+		}
+		if err := verifier.VerifyContainer(cs); err != nil {
+			return spec, fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		spec.ContainerSpec = &cs
+	}
+	if fp.Commit != nil {
+		commit := fp.Commit.toSpec()
+		if err := verifier.VerifyCommit(ostree.SourceSpec{URL: commit.URL, Ref: commit.Ref}, commit); err != nil {
+			return spec, fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		spec.CommitSpec = &commit
+	}
+	return spec, nil
+}
@@ -0,0 +1,189 @@
+package lockfile_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/flatpak"
+	"github.com/osbuild/images/pkg/lockfile"
+	"github.com/osbuild/images/pkg/ostree"
+)
+
+// fakeVerifier fails for the unavailable container digests and commit
+// checksums and records everything it verified
+type fakeVerifier struct {
+	unavailable []string
+	verified    []string
+}
+
+func (v *fakeVerifier) check(id string) error {
+	v.verified = append(v.verified, id)
+	for _, u := range v.unavailable {
+		if u == id {
+			return fmt.Errorf("%s not found", id)
+		}
+	}
+	return nil
+}
+
+func (v *fakeVerifier) VerifyContainer(spec container.Spec) error {
+	return v.check(spec.Digest)
+}
+
+func (v *fakeVerifier) VerifyCommit(source ostree.SourceSpec, commit ostree.CommitSpec) error {
+	return v.check(commit.Checksum)
+}
+
+func digest(s string) string {
+	return "sha256:" + strings.Repeat(s, 64)
+}
+
+var testContainerSources = map[string][]container.SourceSpec{
+	"os": {
+		{Source: "registry.example.com/app:latest", TLSVerify: common.ToPtr(false)},
+		{Source: "registry.example.com/db", Name: "localhost/db", Digest: common.ToPtr(digest("b"))},
+	},
+}
+
+var testContainers = map[string][]container.Spec{
+	"os": {
+		{
+			Source:     "registry.example.com/app",
+			Digest:     digest("a"),
+			TLSVerify:  common.ToPtr(false),
+			ImageID:    digest("1"),
+			LocalName:  "registry.example.com/app:latest",
+			ListDigest: digest("f"),
+			Arch:       arch.ARCH_X86_64,
+		},
+		{
+			Source:    "registry.example.com/db",
+			Digest:    digest("b"),
+			ImageID:   digest("2"),
+			LocalName: "localhost/db",
+			Arch:      arch.ARCH_X86_64,
+		},
+	},
+}
+
+var testCommitSources = map[string][]ostree.SourceSpec{
+	"ostree-deployment": {
+		{URL: "mirrorlist=https://example.com/mirrorlist", Ref: "centos/9/x86_64/edge", RHSM: true},
+	},
+}
+
+var testCommits = map[string][]ostree.CommitSpec{
+	"ostree-deployment": {
+		{
+			Ref:      "centos/9/x86_64/edge",
+			URL:      "https://mirror.example.com/ostree/repo",
+			Secrets:  "org.osbuild.rhsm.consumer",
+			Checksum: strings.Repeat("c", 64),
+		},
+	},
+}
+
+func testFlatpakSources(t *testing.T) map[string][]flatpak.SourceSpec {
+	t.Helper()
+	ref, err := flatpak.NewReferenceFromString("app/org.example.App/x86_64/stable")
+	require.NoError(t, err)
+	return map[string][]flatpak.SourceSpec{
+		"os": {
+			{Registry: flatpak.Registry{Type: flatpak.REGISTRY_TYPE_OCI, URI: "oci+https://flatpaks.example.com"}, Reference: ref},
+		},
+	}
+}
+
+var testFlatpaks = map[string][]flatpak.Spec{
+	"os": {
+		{ContainerSpec: &container.Spec{Source: "flatpaks.example.com/org.example.App", Digest: digest("d"), ImageID: digest("3")}},
+	},
+}
+
+func lockedSources(t *testing.T) *lockfile.Lockfile {
+	t.Helper()
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+	require.NoError(t, lf.LockContainers(testContainerSources, testContainers))
+	require.NoError(t, lf.LockCommits(testCommitSources, testCommits))
+	require.NoError(t, lf.LockFlatpaks(testFlatpakSources(t), testFlatpaks))
+	return roundTrip(t, lf)
+}
+
+func TestLockfileSourcesRoundTrip(t *testing.T) {
+	lf := lockedSources(t)
+	verifier := &fakeVerifier{}
+
+	containers, err := lf.ResolveContainers(testContainerSources, verifier)
+	require.NoError(t, err)
+	assert.Equal(t, testContainers, containers)
+
+	commits, err := lf.ResolveCommits(testCommitSources, verifier)
+	require.NoError(t, err)
+	assert.Equal(t, testCommits, commits)
+
+	flatpaks, err := lf.ResolveFlatpaks(testFlatpakSources(t), verifier)
+	require.NoError(t, err)
+	assert.Equal(t, testFlatpaks, flatpaks)
+
+	assert.Equal(t, []string{digest("a"), digest("b"), strings.Repeat("c", 64), digest("d")}, verifier.verified)
+}
+
+func TestLockfileSourcesUnsatisfied(t *testing.T) {
+	lf := lockedSources(t)
+
+	_, err := lf.ResolveContainers(map[string][]container.SourceSpec{
+		"os": {
+			{Source: "registry.example.com/app:v2"},
+			{Source: "registry.example.com/db", Name: "localhost/db", Digest: common.ToPtr(digest("e"))},
+		},
+		"installer": {{Source: "registry.example.com/app:latest", TLSVerify: common.ToPtr(false)}},
+	}, &fakeVerifier{})
+	assert.ErrorIs(t, err, lockfile.ErrUnsatisfied)
+	assert.ErrorContains(t, err, `pipeline "os": container registry.example.com/app:v2 is not locked`)
+	assert.ErrorContains(t, err, `pipeline "os": container registry.example.com/db is not locked`)
+	assert.ErrorContains(t, err, `pipeline "installer": container registry.example.com/app:latest is not locked`)
+
+	_, err = lf.ResolveCommits(map[string][]ostree.SourceSpec{
+		"ostree-deployment": {{URL: "https://example.com/repo", Ref: "centos/9/x86_64/edge"}},
+	}, &fakeVerifier{})
+	assert.ErrorIs(t, err, lockfile.ErrUnsatisfied)
+	assert.ErrorContains(t, err, `pipeline "ostree-deployment": ostree commit centos/9/x86_64/edge of https://example.com/repo is not locked`)
+
+	sources := testFlatpakSources(t)
+	sources["os"][0].Reference.Branch = "beta"
+	_, err = lf.ResolveFlatpaks(sources, &fakeVerifier{})
+	assert.ErrorIs(t, err, lockfile.ErrUnsatisfied)
+	assert.ErrorContains(t, err, `pipeline "os": flatpak app/org.example.App/x86_64/beta is not locked`)
+}
+
+func TestLockfileSourcesUnavailable(t *testing.T) {
+	lf := lockedSources(t)
+	verifier := &fakeVerifier{unavailable: []string{digest("b"), strings.Repeat("c", 64), digest("d")}}
+
+	_, err := lf.ResolveContainers(testContainerSources, verifier)
+	assert.ErrorIs(t, err, lockfile.ErrUnavailable)
+	assert.ErrorContains(t, err, fmt.Sprintf(`pipeline "os": container registry.example.com/db: %s not found`, digest("b")))
+
+	_, err = lf.ResolveCommits(testCommitSources, verifier)
+	assert.ErrorIs(t, err, lockfile.ErrUnavailable)
+	assert.ErrorContains(t, err, fmt.Sprintf(`pipeline "ostree-deployment": ostree commit %[1]s: %[1]s not found`, strings.Repeat("c", 64)))
+
+	_, err = lf.ResolveFlatpaks(testFlatpakSources(t), verifier)
+	assert.ErrorIs(t, err, lockfile.ErrUnavailable)
+	assert.ErrorContains(t, err, `pipeline "os": flatpak app/org.example.App/x86_64/stable`)
+}
+
+func TestLockfileSourcesMismatch(t *testing.T) {
+	lf, err := lockfile.New("centos-9", "x86_64", "qcow2", testChains(), testDepsolved())
+	require.NoError(t, err)
+	err = lf.LockContainers(testContainerSources, map[string][]container.Spec{"os": testContainers["os"][:1]})
+	assert.EqualError(t, err, `pipeline "os": 2 container sources resolved to 1 containers`)
+}
@@ -10,13 +10,14 @@ import (
 // filesystemConfigStages generates either an org.osbuild.fstab stage or a
 // collection of org.osbuild.systemd.unit.create stages for .mount and .swap
 // units (and an org.osbuild.systemd stage to enable them) depending on the
-// pipeline configuration.
-func filesystemConfigStages(pt *disk.PartitionTable, mountConfiguration osbuild.MountConfiguration) ([]*osbuild.Stage, error) {
+// pipeline configuration. The stages cover the filesystems of all given
+// partition tables.
+func filesystemConfigStages(mountConfiguration osbuild.MountConfiguration, pts ...*disk.PartitionTable) ([]*osbuild.Stage, error) {
 	switch mountConfiguration {
 	case osbuild.MOUNT_CONFIGURATION_UNITS:
-		return osbuild.GenSystemdMountStages(pt)
+		return osbuild.GenSystemdMountStages(pts...)
 	case osbuild.MOUNT_CONFIGURATION_FSTAB:
-		opts, err := osbuild.NewFSTabStageOptions(pt)
+		opts, err := osbuild.NewFSTabStageOptions(pts...)
 		if err != nil {
 			return nil, err
 		}
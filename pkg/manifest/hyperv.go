@@ -0,0 +1,103 @@
+package manifest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// A HyperV copies a vhdx image to its own tree and adds a PowerShell script
+// next to it that creates a Hyper-V generation 2 virtual machine with the
+// disk. The tree is meant to be archived, like the tree of the OVF pipeline.
+type HyperV struct {
+	Base
+
+	imgPipeline *VHDX
+	files       []*fsnode.File
+}
+
+// NewHyperV creates a new HyperV pipeline. imgPipeline is the pipeline
+// producing the vhdx image.
+func NewHyperV(buildPipeline Build, imgPipeline *VHDX) *HyperV {
+	p := &HyperV{
+		Base:        NewBase("hyperv", buildPipeline),
+		imgPipeline: imgPipeline,
+	}
+	// See similar logic in qcow2 to run on the host
+	if buildPipeline != nil {
+		buildPipeline.addDependent(p)
+	} else {
+		imgPipeline.Manifest().addPipeline(p)
+	}
+	return p
+}
+
+// ScriptFilename returns the name of the script that creates the virtual
+// machine, it is named after the vhdx image.
+func (p *HyperV) ScriptFilename() string {
+	vhdx := p.imgPipeline.Filename()
+	return strings.TrimSuffix(vhdx, filepath.Ext(vhdx)) + ".ps1"
+}
+
+func (p *HyperV) serialize() (osbuild.Pipeline, error) {
+	pipeline, err := p.Base.serialize()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+
+	inputName := "vhdx-tree"
+	pipeline.AddStage(osbuild.NewCopyStageSimple(
+		&osbuild.CopyStageOptions{
+			Paths: []osbuild.CopyStagePath{
+				{
+					From: fmt.Sprintf("input://%s/%s", inputName, p.imgPipeline.Export().Filename()),
+					To:   "tree:///",
+				},
+			},
+		},
+		osbuild.NewPipelineTreeInputs(inputName, p.imgPipeline.Name()),
+	))
+
+	stages, err := p.makeScript()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStages(stages...)
+
+	return pipeline, nil
+}
+
+// makeScript returns the stages that create the script for the virtual
+// machine, the default name of the machine is the one of the vhdx image
+func (p *HyperV) makeScript() ([]*osbuild.Stage, error) {
+	template, err := fileDataFS.ReadFile("hyperv/new-vm.ps1")
+	if err != nil {
+		return nil, err
+	}
+
+	vhdx := p.imgPipeline.Filename()
+	script := strings.NewReplacer(
+		"@VHDX@", vhdx,
+		"@SCRIPT@", p.ScriptFilename(),
+		"@NAME@", strings.TrimSuffix(vhdx, filepath.Ext(vhdx)),
+	).Replace(string(template))
+	f, err := fsnode.NewFile("/"+p.ScriptFilename(), nil, nil, nil, []byte(script))
+	if err != nil {
+		return nil, err
+	}
+	p.files = []*fsnode.File{f}
+	return osbuild.GenFileNodesStages(p.files), nil
+}
+
+func (p *HyperV) getInline() []string {
+	inlineData := []string{}
+
+	for _, file := range p.files {
+		inlineData = append(inlineData, string(file.Data()))
+	}
+
+	return inlineData
+}
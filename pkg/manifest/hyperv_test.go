@@ -0,0 +1,42 @@
+package manifest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func TestHyperV(t *testing.T) {
+	mani := manifest.New()
+	build := manifest.NewBuild(&mani, &runner.Linux{}, nil, nil)
+	rawImage := manifest.NewRawImage(build, nil, manifest.DiskCustomizations{})
+	vhdx := manifest.NewVHDX(build, rawImage)
+	vhdx.SetFilename("fedora.vhdx")
+
+	hyperv := manifest.NewHyperV(build, vhdx)
+	assert.Equal(t, "fedora.ps1", hyperv.ScriptFilename())
+
+	pipeline, err := manifest.Serialize(hyperv)
+	require.NoError(t, err)
+	copyStage := findStage("org.osbuild.copy", pipeline.Stages)
+	require.NotNil(t, copyStage)
+	assert.Equal(t, []osbuild.CopyStagePath{
+		{
+			From: "input://vhdx-tree/fedora.vhdx",
+			To:   "tree:///",
+		},
+	}, copyStage.Options.(*osbuild.CopyStageOptions).Paths)
+	assert.Contains(t, collectCopyDestinationPaths(pipeline.Stages), "tree:///fedora.ps1")
+
+	inline := manifest.GetInline(hyperv)
+	require.Len(t, inline, 1)
+	assert.Contains(t, inline[0], `[string]$Name = "fedora",`)
+	assert.Contains(t, inline[0], `$vhdx = Join-Path $PSScriptRoot "fedora.vhdx"`)
+	assert.Contains(t, inline[0], `.\fedora.ps1 -Name my-vm`)
+	assert.Contains(t, inline[0], "-Generation 2")
+}
@@ -115,6 +115,11 @@ type Manifest struct {
 	// "BoostrapContainerRef()" method on this but we cannot because of
 	// circular imports so we use the same workaround as Distro above.
 	DistroBootstrapRef string
+
+	// SourceDateEpoch, if set, is passed to all pipelines, osbuild exports
+	// it as SOURCE_DATE_EPOCH to their stages. Stages that honour it do not
+	// depend on the time of the build.
+	SourceDateEpoch *int64
 }
 
 func New() Manifest {
@@ -223,6 +228,7 @@ func (m Manifest) Serialize(depsolvedSets map[string]depsolvednf.DepsolveResult,
 		if err != nil {
 			return nil, fmt.Errorf("cannot serialize pipeline %q: %w", pipeline.Name(), err)
 		}
+		osbuildPipeline.SourceEpoch = m.SourceDateEpoch
 		osbuildPipelines = append(osbuildPipelines, osbuildPipeline)
 		mergedInputs.Commits = append(mergedInputs.Commits, pipeline.getOSTreeCommits()...)
 		mergedInputs.Depsolved.Transactions = append(mergedInputs.Depsolved.Transactions, depsolvedSets[pipeline.Name()].Transactions...)
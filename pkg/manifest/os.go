@@ -18,6 +18,7 @@ import (
 	"github.com/osbuild/images/pkg/customizations/fsnode"
 	"github.com/osbuild/images/pkg/customizations/ignition"
 	"github.com/osbuild/images/pkg/customizations/oscap"
+	"github.com/osbuild/images/pkg/customizations/secureboot"
 	"github.com/osbuild/images/pkg/customizations/shell"
 	"github.com/osbuild/images/pkg/customizations/subscription"
 	"github.com/osbuild/images/pkg/customizations/users"
@@ -156,6 +157,10 @@ type OSCustomizations struct {
 	OpenSCAPRemediationConfig *oscap.RemediationConfig
 
 	Subscription *subscription.ImageOptions
+
+	// SecureBoot, if set, signs the EFI binaries of the image with the
+	// given key
+	SecureBoot *secureboot.ImageOptions
 	// Indicates if rhc should be set to permissive when creating the registration script
 	PermissiveRHC *bool
 
@@ -231,6 +236,11 @@ type OS struct {
 	// Partition table, if nil the tree cannot be put on a partitioned disk
 	PartitionTable *disk.PartitionTable
 
+	// Partition tables of additional (data) disks of the image. Their
+	// filesystems are mounted by the OS but they are not bootable. The
+	// filesystem UUIDs must be unique across all disks.
+	DataPartitionTables []*disk.PartitionTable
+
 	// content-related fields
 
 	// depsolveRepos holds the repository configuration used by
@@ -277,6 +287,9 @@ func (p *OS) getPackageSetChain(Distro) ([]rpmmd.PackageSet, error) {
 	if p.PartitionTable != nil {
 		partitionTablePackages = p.PartitionTable.GetBuildPackages()
 	}
+	for _, pt := range p.DataPartitionTables {
+		partitionTablePackages = append(partitionTablePackages, pt.GetBuildPackages()...)
+	}
 
 	if p.OSCustomizations.KernelName != "" {
 		// kernel is considered part of the platform package set
@@ -329,6 +342,11 @@ func (p *OS) getPackageSetChain(Distro) ([]rpmmd.PackageSet, error) {
 		customizationPackages = append(customizationPackages, "dnf", "python3-dnf-plugin-versionlock")
 	}
 
+	if p.OSCustomizations.SecureBoot != nil && p.OSCustomizations.SecureBoot.MOKPasswordHash != "" {
+		// the MOK import request is made on the first boot
+		customizationPackages = append(customizationPackages, "mokutil")
+	}
+
 	osRepos := slices.Concat(p.depsolveRepos, p.OSCustomizations.ExtraBaseRepos)
 
 	// merge all package lists for the pipeline
@@ -408,6 +426,9 @@ func (p *OS) getBuildPackages(distro Distro) ([]string, error) {
 	if p.PartitionTable != nil {
 		packages = append(packages, p.PartitionTable.GetBuildPackages()...)
 	}
+	for _, pt := range p.DataPartitionTables {
+		packages = append(packages, pt.GetBuildPackages()...)
+	}
 	packages = append(packages, "rpm")
 	if p.OSTreeRef != "" {
 		packages = append(packages, "rpm-ostree")
@@ -457,6 +478,13 @@ func (p *OS) getBuildPackages(distro Distro) ([]string, error) {
 		packages = append(packages, "libkcapi-hmaccalc")
 	}
 
+	if p.OSCustomizations.SecureBoot != nil {
+		packages = append(packages, "sbsigntools")
+		if p.OSCustomizations.SecureBoot.PKCS11URI != "" {
+			packages = append(packages, "openssl-pkcs11")
+		}
+	}
+
 	if len(p.OSCustomizations.Users)+len(p.OSCustomizations.Groups) > 0 || p.OSCustomizations.LockRootUser {
 		packages = append(packages, "shadow-utils")
 	}
@@ -577,6 +605,21 @@ func (p *OS) serialize() (osbuild.Pipeline, error) {
 			BootRoot: espMountpoint,
 		}
 	}
+	if p.platform.GetBootloader() == platform.BOOTLOADER_SYSTEMD_BOOT && p.PartitionTable != nil {
+		baseRPMOptions.KernelInstallEnv, err = systemdBootKernelInstallEnv(p.PartitionTable)
+		if err != nil {
+			return osbuild.Pipeline{}, err
+		}
+		if err := p.addKernelInstallLayoutStages(&pipeline); err != nil {
+			return osbuild.Pipeline{}, err
+		}
+	}
+	if p.platform.GetBootloader() == platform.BOOTLOADER_UBOOT && p.PartitionTable != nil {
+		baseRPMOptions.KernelInstallEnv = ubootKernelInstallEnv()
+		if err := p.addKernelInstallLayoutStages(&pipeline); err != nil {
+			return osbuild.Pipeline{}, err
+		}
+	}
 
 	rpmStages, err := osbuild.GenRPMStagesFromTransactions(p.depsolveResult.Transactions, baseRPMOptions)
 	if err != nil {
@@ -584,7 +627,10 @@ func (p *OS) serialize() (osbuild.Pipeline, error) {
 	}
 	pipeline.AddStages(rpmStages...)
 
-	if !p.OSCustomizations.NoBLS {
+	// the boot entries of systemd-boot are written by kernel-install
+	// relative to the partition they are on already and U-Boot does not
+	// read them at all
+	if !p.OSCustomizations.NoBLS && p.platform.GetBootloader() != platform.BOOTLOADER_SYSTEMD_BOOT && p.platform.GetBootloader() != platform.BOOTLOADER_UBOOT {
 		// If the /boot is on a separate partition, the prefix for the BLS stage must be ""
 		if p.PartitionTable == nil || p.PartitionTable.FindMountableOnPlain("/boot") == nil {
 			pipeline.AddStage(osbuild.NewFixBLSStage(&osbuild.FixBLSStageOptions{}))
@@ -798,18 +844,45 @@ func (p *OS) serialize() (osbuild.Pipeline, error) {
 			}))
 		}
 
-		fsCfgStages, err := filesystemConfigStages(pt, p.DiskCustomizations.MountConfiguration)
+		// the filesystems of all disks are mounted by the OS
+		allPTs := append([]*disk.PartitionTable{pt}, p.DataPartitionTables...)
+		fsCfgStages, err := filesystemConfigStages(p.DiskCustomizations.MountConfiguration, allPTs...)
 		if err != nil {
 			return osbuild.Pipeline{}, err
 		}
 		pipeline.AddStages(fsCfgStages...)
 
+		mdadmConf, err := mdadmConfFile(allPTs...)
+		if err != nil {
+			return osbuild.Pipeline{}, err
+		}
+		if mdadmConf != nil {
+			p.addStagesForAllFilesAndInlineData(&pipeline, []*fsnode.File{mdadmConf})
+			// the initramfs is generated when the kernel is installed, so
+			// the dracut configuration must come first
+			pipeline = prependStage(pipeline, osbuild.NewDracutConfStage(&osbuild.DracutConfStageOptions{
+				Filename: "90-mdraid.conf",
+				Config: osbuild.DracutConfigFile{
+					AddModules: []string{"mdraid"},
+				},
+			}))
+		}
+
 		switch p.platform.GetBootloader() {
 		case platform.BOOTLOADER_GRUB2:
 			pipeline.AddStage(grubStage(p, pt, kernelOptions))
 			if !p.OSCustomizations.KernelOptionsBootloader {
 				pipeline = prependKernelCmdlineStage(pipeline, rootUUID, kernelOptions)
 			}
+			if p.OSCustomizations.SecureBoot != nil {
+				espMountpoint, err := findESPMountpoint(pt)
+				if err != nil {
+					return osbuild.Pipeline{}, err
+				}
+				if err := p.addSecureBootStages(&pipeline, espMountpoint, false); err != nil {
+					return osbuild.Pipeline{}, err
+				}
+			}
 		case platform.BOOTLOADER_ZIPL:
 			pipeline.AddStage(osbuild.NewZiplStage(new(osbuild.ZiplStageOptions)))
 			pipeline = prependKernelCmdlineStage(pipeline, rootUUID, kernelOptions)
@@ -824,11 +897,40 @@ func (p *OS) serialize() (osbuild.Pipeline, error) {
 			}
 			p.addStagesForAllFilesAndInlineData(&pipeline, []*fsnode.File{csvfile})
 
-			stages, err := maybeAddHMACandDirStage(p.depsolveResult.Transactions.AllPackages(), espMountpoint, p.kernelVer)
+			packages := p.depsolveResult.Transactions.AllPackages()
+			stages, err := maybeAddHMACandDirStage(packages, espMountpoint, p.kernelVer)
 			if err != nil {
 				return osbuild.Pipeline{}, err
 			}
+			if p.OSCustomizations.SecureBoot != nil {
+				if err := p.addSecureBootStages(&pipeline, espMountpoint, true); err != nil {
+					return osbuild.Pipeline{}, err
+				}
+				// the hmac file that uki-direct wrote when the kernel
+				// was installed is for the unsigned UKI
+				if _, err := packages.Package("uki-direct"); err == nil && stages == nil {
+					stages = []*osbuild.Stage{ukiHMACStage(espMountpoint, p.kernelVer)}
+				}
+			}
 			pipeline.AddStages(stages...)
+		case platform.BOOTLOADER_SYSTEMD_BOOT:
+			if p.OSCustomizations.SecureBoot != nil {
+				return osbuild.Pipeline{}, fmt.Errorf("secure boot signing is not supported for the systemd-boot bootloader")
+			}
+			if err := p.addSystemdBootStages(&pipeline, pt); err != nil {
+				return osbuild.Pipeline{}, err
+			}
+			// kernel-install reads the kernel command line of the boot
+			// entry when the kernel is installed
+			pipeline = prependKernelCmdlineStage(pipeline, rootUUID, kernelOptions)
+		case platform.BOOTLOADER_UBOOT:
+			if p.OSCustomizations.SecureBoot != nil {
+				return osbuild.Pipeline{}, fmt.Errorf("secure boot signing is not supported for the uboot bootloader")
+			}
+			if err := p.addUBootStages(&pipeline, pt, rootUUID, kernelOptions); err != nil {
+				return osbuild.Pipeline{}, err
+			}
+			pipeline = prependKernelCmdlineStage(pipeline, rootUUID, kernelOptions)
 		}
 	}
 
@@ -1139,24 +1241,37 @@ func grubStage(p *OS, pt *disk.PartitionTable, kernelOptions []string) *osbuild.
 // command from the python3-virt-firmware package will gain the ability to
 // write these files offline during the RHEL 9.7 / 10.1 development cycle.
 func ukiBootCSVfile(espMountpoint string, architecture arch.Arch, kernelVer, vendor string) (*fsnode.File, error) {
-	shortArch := ""
-	switch architecture {
-	case arch.ARCH_AARCH64:
-		shortArch = "aa64"
-	case arch.ARCH_X86_64:
-		shortArch = "x64"
-	default:
+	if architecture != arch.ARCH_X86_64 && architecture != arch.ARCH_AARCH64 {
 		return nil, fmt.Errorf("ukiBootCSVfile: UKIs are only supported for x86_64 and aarch64")
 	}
+	shortArch := efiArch(architecture)
 
-	kernelFilename := fmt.Sprintf("ffffffffffffffffffffffffffffffff-%s.efi", kernelVer)
-	data := fmt.Sprintf("shim%s.efi,%s,\\EFI\\Linux\\%s ,UKI bootentry\n", shortArch, vendor, kernelFilename)
+	data := fmt.Sprintf("shim%s.efi,%s,\\EFI\\Linux\\%s ,UKI bootentry\n", shortArch, vendor, ukiFilename(kernelVer))
 
 	csvPath := filepath.Join(espMountpoint, "EFI", vendor, fmt.Sprintf("BOOT%s.CSV", strings.ToUpper(shortArch)))
 
 	return fsnode.NewFile(csvPath, nil, nil, nil, common.EncodeUTF16le(data))
 }
 
+// mdadmConfFile creates a file node for /etc/mdadm.conf that lists all md
+// RAID arrays in the partition tables. Returns nil if there are none.
+func mdadmConfFile(pts ...*disk.PartitionTable) (*fsnode.File, error) {
+	var arrays []string
+	for _, pt := range pts {
+		_ = pt.ForEachEntity(func(e disk.Entity, path []disk.Entity) error {
+			if md, ok := e.(*disk.MDRaid); ok {
+				arrays = append(arrays, fmt.Sprintf("ARRAY /dev/md/%s metadata=%s UUID=%s\n", md.Name, md.GetMetadata(), md.MDAdmUUID()))
+			}
+			return nil
+		})
+	}
+	if len(arrays) == 0 {
+		return nil, nil
+	}
+
+	return fsnode.NewFile("/etc/mdadm.conf", nil, nil, nil, []byte(strings.Join(arrays, "")))
+}
+
 func findESPMountpoint(pt *disk.PartitionTable) (string, error) {
 	// the ESP in our images is always at /boot/efi, but let's make this more
 	// flexible and future proof by finding the ESP mountpoint from the
@@ -1210,13 +1325,8 @@ func maybeAddHMACandDirStage(packages rpmmd.PackageList, espMountpoint, kernelVe
 
 	if common.VersionLessThan(ukiDirect.Version, "25.3") {
 		// generate hmac file using stage
-		kernelFilename := fmt.Sprintf("ffffffffffffffffffffffffffffffff-%s.efi", kernelVer)
-		kernelPath := filepath.Join(espMountpoint, "EFI", "Linux", kernelFilename)
-		hmacStage := osbuild.NewHMACStage(&osbuild.HMACStageOptions{
-			Paths:     []string{kernelPath},
-			Algorithm: "sha512",
-		})
-		addonsPath := kernelPath + ".extra.d"
+		hmacStage := ukiHMACStage(espMountpoint, kernelVer)
+		addonsPath := ukiPath(espMountpoint, kernelVer) + ".extra.d"
 		addonsDir, err := fsnode.NewDirectory(addonsPath, nil, nil, nil, true)
 		if err != nil {
 			return nil, err
@@ -1230,6 +1340,43 @@ func maybeAddHMACandDirStage(packages rpmmd.PackageList, espMountpoint, kernelVe
 	return nil, nil
 }
 
+// ukiHMACStage returns the stage that generates the hmac file of the UKI.
+func ukiHMACStage(espMountpoint, kernelVer string) *osbuild.Stage {
+	return osbuild.NewHMACStage(&osbuild.HMACStageOptions{
+		Paths:     []string{ukiPath(espMountpoint, kernelVer)},
+		Algorithm: "sha512",
+	})
+}
+
+// machineIDPlaceholder is the machine-id that is set while the packages are
+// installed, kernel-install uses it as the entry token of the kernel.
+const machineIDPlaceholder = "ffffffffffffffffffffffffffffffff"
+
+// ukiFilename returns the filename of the UKI in the EFI/Linux directory of
+// the ESP.
+func ukiFilename(kernelVer string) string {
+	return fmt.Sprintf("%s-%s.efi", machineIDPlaceholder, kernelVer)
+}
+
+func ukiPath(espMountpoint, kernelVer string) string {
+	return filepath.Join(espMountpoint, "EFI", "Linux", ukiFilename(kernelVer))
+}
+
+// efiArch returns the architecture suffix of the EFI binaries (e.g.
+// shimx64.efi), or an empty string if the architecture has no UEFI
+// support.
+func efiArch(architecture arch.Arch) string {
+	switch architecture {
+	case arch.ARCH_AARCH64:
+		return "aa64"
+	case arch.ARCH_X86_64:
+		return "x64"
+	case arch.ARCH_RISCV64:
+		return "riscv64"
+	}
+	return ""
+}
+
 func (p *OS) Platform() platform.Platform {
 	return p.platform
 }
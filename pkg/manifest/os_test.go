@@ -16,6 +16,7 @@ import (
 	"github.com/osbuild/images/pkg/customizations/fsnode"
 	"github.com/osbuild/images/pkg/customizations/subscription"
 	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/manifest"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/platform"
@@ -373,6 +374,42 @@ func TestOSPipelineMountNoneStages(t *testing.T) {
 	checkStagesForNoMounts(t, common.Must(os.Serialize()).Stages)
 }
 
+func TestOSPipelineMDRaid(t *testing.T) {
+	os := manifest.NewTestOS()
+
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/")
+	os.PartitionTable.Partitions[0].Payload = &disk.MDRaid{
+		Name:    "root",
+		UUID:    "fb180daf-48a7-4ee0-b10d-394651850fd4",
+		Payload: os.PartitionTable.Partitions[0].Payload,
+	}
+
+	pipeline := common.Must(os.Serialize())
+
+	// the dracut configuration comes before the kernel is installed
+	dracutConf := pipeline.Stages[0]
+	require.Equal(t, "org.osbuild.dracut.conf", dracutConf.Type)
+	assert.Equal(t, &osbuild.DracutConfStageOptions{
+		Filename: "90-mdraid.conf",
+		Config: osbuild.DracutConfigFile{
+			AddModules: []string{"mdraid"},
+		},
+	}, dracutConf.Options)
+
+	assert.Contains(t, manifest.GetInline(os), "ARRAY /dev/md/root metadata=1.2 UUID=fb180daf:48a74ee0:b10d3946:51850fd4\n")
+	assert.Contains(t, collectCopyDestinationPaths(pipeline.Stages), "tree:///etc/mdadm.conf")
+}
+
+func TestOSPipelineNoMDRaid(t *testing.T) {
+	os := manifest.NewTestOS()
+
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/")
+
+	pipeline := common.Must(os.Serialize())
+	assert.Nil(t, findStage("org.osbuild.dracut.conf", pipeline.Stages))
+	assert.NotContains(t, collectCopyDestinationPaths(pipeline.Stages), "tree:///etc/mdadm.conf")
+}
+
 func TestLanguageIncludesLocaleStage(t *testing.T) {
 	os := manifest.NewTestOS()
 
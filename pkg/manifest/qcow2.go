@@ -26,8 +26,14 @@ func (p *QCOW2) SetFilename(filename string) {
 // raw image. The pipeline name is the name of the new pipeline. Filename is the name
 // of the produced qcow2 image.
 func NewQCOW2(buildPipeline Build, imgPipeline FilePipeline) *QCOW2 {
+	return NewNamedQCOW2(buildPipeline, imgPipeline, "qcow2")
+}
+
+// NewNamedQCOW2 is NewQCOW2 with a custom pipeline name, for manifests with
+// more than one qcow2 image.
+func NewNamedQCOW2(buildPipeline Build, imgPipeline FilePipeline, pipelinename string) *QCOW2 {
 	p := &QCOW2{
-		Base:        NewBase("qcow2", buildPipeline),
+		Base:        NewBase(pipelinename, buildPipeline),
 		imgPipeline: imgPipeline,
 		filename:    "image.qcow2",
 	}
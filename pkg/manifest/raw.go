@@ -2,10 +2,14 @@ package manifest
 
 import (
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/artifact"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
 )
 
 // A RawImage represents a raw image file which can be booted in a
@@ -15,6 +19,10 @@ type RawImage struct {
 	treePipeline       *OS
 	filename           string
 	DiskCustomizations DiskCustomizations
+
+	// partitionTable is the partition table of a data disk, when nil the
+	// image is the boot disk using the partition table of the treePipeline
+	partitionTable *disk.PartitionTable
 }
 
 func (p RawImage) Filename() string {
@@ -36,6 +44,23 @@ func NewRawImage(buildPipeline Build, treePipeline *OS, diskCustomizations DiskC
 	return p
 }
 
+// NewRawDataImage creates a raw image of a data disk with the given partition
+// table. The content of the treePipeline below the mountpoints of the
+// partition table is copied onto the disk. The partition table must also be
+// one of the DataPartitionTables of the treePipeline for the filesystems to
+// be mounted on boot. The name is used for the pipeline and the filename.
+func NewRawDataImage(buildPipeline Build, treePipeline *OS, pt *disk.PartitionTable, name string, diskCustomizations DiskCustomizations) *RawImage {
+	p := &RawImage{
+		Base:               NewBase(name, buildPipeline),
+		treePipeline:       treePipeline,
+		filename:           name + ".img",
+		DiskCustomizations: diskCustomizations,
+		partitionTable:     pt,
+	}
+	buildPipeline.addDependent(p)
+	return p
+}
+
 func (p *RawImage) getBuildPackages(d Distro) ([]string, error) {
 	pkgs, err := p.treePipeline.getBuildPackages(d)
 	if err != nil {
@@ -53,6 +78,10 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 		return osbuild.Pipeline{}, err
 	}
 
+	if p.partitionTable != nil {
+		return p.serializeDataDisk(pipeline)
+	}
+
 	pt := p.treePipeline.PartitionTable
 	if pt == nil {
 		return osbuild.Pipeline{}, fmt.Errorf("no partition table in live image")
@@ -64,6 +93,14 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 
 	inputName := "root-tree"
 	copyOptions, copyDevices, copyMounts := osbuild.GenCopyFSTreeOptions(inputName, p.treePipeline.Name(), p.Filename(), pt)
+	// the content below the mountpoints of the data disks is copied onto
+	// them, see serializeDataDisk()
+	for _, dataPT := range p.treePipeline.DataPartitionTables {
+		_ = dataPT.ForEachMountable(func(mnt disk.Mountable, _ []disk.Entity) error {
+			copyOptions.Paths[0].Exclude = append(copyOptions.Paths[0].Exclude, strings.TrimPrefix(mnt.GetMountpoint(), "/"))
+			return nil
+		})
+	}
 	copyInputs := osbuild.NewPipelineTreeInputs(inputName, p.treePipeline.Name())
 	pipeline.AddStage(osbuild.NewCopyStage(copyOptions, copyInputs, copyDevices, copyMounts))
 
@@ -99,9 +136,15 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 		pipeline.AddStage(osbuild.NewCopyStage(bootCopyOptions, bootCopyInputs, bootCopyDevices, bootCopyMounts))
 	}
 
-	for _, stage := range osbuild.GenImageFinishStages(pt, p.Filename()) {
-		pipeline.AddStage(stage)
+	verityCmdline, err := p.verityKernelCmdline(pt)
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	finishStages, err := osbuild.GenImageFinishStages(pt, p.Filename(), verityCmdline)
+	if err != nil {
+		return osbuild.Pipeline{}, err
 	}
+	pipeline.AddStages(finishStages...)
 
 	switch p.treePipeline.platform.GetArch() {
 	case arch.ARCH_S390X:
@@ -113,9 +156,85 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 		}
 	}
 
+	embedStages, err := ubootEmbedStages(p.treePipeline.platform.GetUBoot(), pt, p.Filename(), p.treePipeline.Name())
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStages(embedStages...)
+
 	return pipeline, nil
 }
 
+// serializeDataDisk adds the stages for a data disk, which, unlike the boot
+// disk, gets neither boot files nor a bootloader.
+func (p *RawImage) serializeDataDisk(pipeline osbuild.Pipeline) (osbuild.Pipeline, error) {
+	pt := p.partitionTable
+
+	for _, stage := range osbuild.GenImagePrepareStages(pt, p.Filename(), p.DiskCustomizations.PartitioningTool, p.treePipeline.Name()) {
+		pipeline.AddStage(stage)
+	}
+
+	inputName := "root-tree"
+	copyOptions, copyDevices, copyMounts := osbuild.GenCopyDataFSTreeOptions(inputName, p.Filename(), pt)
+	copyInputs := osbuild.NewPipelineTreeInputs(inputName, p.treePipeline.Name())
+	pipeline.AddStage(osbuild.NewCopyStage(copyOptions, copyInputs, copyDevices, copyMounts))
+
+	finishStages, err := osbuild.GenImageFinishStages(pt, p.Filename(), nil)
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStages(finishStages...)
+
+	return pipeline, nil
+}
+
+// verityKernelCmdline returns where the root hashes of the verity protected
+// filesystems of the partition table are added to the kernel command line,
+// or nil if there are none: the boot loader entries of the grub2 and
+// systemd-boot bootloaders or a command line addon of the UKI. The boot
+// configuration of the other bootloaders cannot be changed after the hash
+// tree is generated, so verity is an error for them.
+func (p *RawImage) verityKernelCmdline(pt *disk.PartitionTable) (*osbuild.VerityKernelCmdline, error) {
+	hasVerity := false
+	_ = pt.ForEachEntity(func(e disk.Entity, _ []disk.Entity) error {
+		if _, ok := e.(*disk.Verity); ok {
+			hasVerity = true
+		}
+		return nil
+	})
+	if !hasVerity {
+		return nil, nil
+	}
+
+	bootloader := p.treePipeline.platform.GetBootloader()
+	switch {
+	case bootloader == platform.BOOTLOADER_GRUB2 && !p.treePipeline.OSCustomizations.NoBLS:
+		return &osbuild.VerityKernelCmdline{BootEntries: "/boot/loader/entries"}, nil
+	case bootloader == platform.BOOTLOADER_SYSTEMD_BOOT:
+		espMountpoint, bootPath, err := systemdBootPaths(pt)
+		if err != nil {
+			return nil, err
+		}
+		if bootPath == "" {
+			bootPath = espMountpoint
+		}
+		return &osbuild.VerityKernelCmdline{BootEntries: path.Join(bootPath, "loader/entries")}, nil
+	case bootloader == platform.BOOTLOADER_UKI:
+		// systemd-stub only loads signed addons with Secure Boot
+		if p.treePipeline.OSCustomizations.SecureBoot != nil {
+			return nil, fmt.Errorf("verity protected filesystems are not supported with secure boot signing of the UKI")
+		}
+		espMountpoint, err := findESPMountpoint(pt)
+		if err != nil {
+			return nil, err
+		}
+		addon := ukiPath(espMountpoint, p.treePipeline.kernelVer) + ".extra.d/verity.addon.efi"
+		return &osbuild.VerityKernelCmdline{UKIAddon: addon}, nil
+	default:
+		return nil, fmt.Errorf("verity protected filesystems are only supported with the grub2, systemd-boot and UKI bootloaders")
+	}
+}
+
 func (p *RawImage) Export() *artifact.Artifact {
 	p.Base.export = true
 	return artifact.New(p.Name(), p.Filename(), nil)
@@ -174,9 +174,11 @@ func (p *RawBootcImage) serialize() (osbuild.Pipeline, error) {
 	}
 	pipeline.AddStage(st)
 
-	for _, stage := range osbuild.GenImageFinishStages(pt, p.filename) {
-		pipeline.AddStage(stage)
+	finishStages, err := osbuild.GenImageFinishStages(pt, p.filename, nil)
+	if err != nil {
+		return osbuild.Pipeline{}, err
 	}
+	pipeline.AddStages(finishStages...)
 
 	if !p.UnifiedKernel {
 		// all our customizations work directly on the mounted deployment
@@ -191,7 +193,7 @@ func (p *RawBootcImage) serialize() (osbuild.Pipeline, error) {
 
 		postStages := []*osbuild.Stage{}
 
-		fsCfgStages, err := filesystemConfigStages(pt, p.DiskCustomizations.MountConfiguration)
+		fsCfgStages, err := filesystemConfigStages(p.DiskCustomizations.MountConfiguration, pt)
 		if err != nil {
 			return osbuild.Pipeline{}, err
 		}
@@ -109,9 +109,11 @@ func (p *RawOSTreeImage) serialize() (osbuild.Pipeline, error) {
 		pipeline.AddStage(osbuild.NewCopyStage(bootCopyOptions, bootCopyInputs, bootCopyDevices, bootCopyMounts))
 	}
 
-	for _, stage := range osbuild.GenImageFinishStages(pt, p.Filename()) {
-		pipeline.AddStage(stage)
+	finishStages, err := osbuild.GenImageFinishStages(pt, p.Filename(), nil)
+	if err != nil {
+		return osbuild.Pipeline{}, err
 	}
+	pipeline.AddStages(finishStages...)
 
 	if p.treePipeline.UseBootupd {
 		if err := p.addBootupdStage(&pipeline); err != nil {
@@ -0,0 +1,140 @@
+package manifest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/customizations/secureboot"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+func TestRawDataImage(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot/efi")
+	dataPT := testdisk.MakeFakePartitionTable("/data")
+	os.DataPartitionTables = append(os.DataPartitionTables, dataPT)
+
+	rawData := manifest.NewRawDataImage(os.BuildPipeline(), os, dataPT, "data0", manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	assert.Equal(t, "data0", rawData.Name())
+	assert.Equal(t, "data0.img", rawData.Filename())
+
+	pipeline := common.Must(manifest.Serialize(rawData))
+
+	copyStage := findStage("org.osbuild.copy", pipeline.Stages)
+	require.NotNil(t, copyStage)
+	assert.Equal(t, []osbuild.CopyStagePath{
+		{From: "input://root-tree/data/", To: "mount://data/"},
+	}, copyStage.Options.(*osbuild.CopyStageOptions).Paths)
+
+	// data disks are not bootable
+	assert.Nil(t, findStage("org.osbuild.grub2.inst", pipeline.Stages))
+}
+
+func TestRawImageExcludesDataDisks(t *testing.T) {
+	os := newSystemdBootOS(xbootldrPartitionTable("vfat"))
+	os.DataPartitionTables = append(os.DataPartitionTables, testdisk.MakeFakePartitionTable("/data"))
+
+	rawImage := manifest.NewRawImage(os.BuildPipeline(), os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	pipeline := common.Must(manifest.Serialize(rawImage))
+
+	// the content of the data disk is not copied onto the boot disk
+	copyStage := findStage("org.osbuild.copy", pipeline.Stages)
+	require.NotNil(t, copyStage)
+	assert.Equal(t, []osbuild.CopyStagePath{
+		{From: "input://root-tree/", To: "mount://-/", Exclude: []string{"data"}},
+	}, copyStage.Options.(*osbuild.CopyStageOptions).Paths)
+}
+
+func TestOSPipelineDataPartitionTables(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot/efi")
+	os.DataPartitionTables = append(os.DataPartitionTables, testdisk.MakeFakePartitionTable("/data"))
+
+	pipeline := common.Must(os.Serialize())
+	fstab := findStage("org.osbuild.fstab", pipeline.Stages)
+	require.NotNil(t, fstab)
+	var paths []string
+	for _, fs := range fstab.Options.(*osbuild.FSTabStageOptions).FileSystems {
+		paths = append(paths, fs.Path)
+	}
+	assert.ElementsMatch(t, []string{"/", "/boot/efi", "/data"}, paths)
+}
+
+func TestRawImageVerityBootEntries(t *testing.T) {
+	pt := xbootldrPartitionTable("vfat")
+	require.NoError(t, pt.AddVerity("/", arch.ARCH_X86_64))
+	os := newSystemdBootOS(pt)
+
+	rawImage := manifest.NewRawImage(os.BuildPipeline(), os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	pipeline := common.Must(manifest.Serialize(rawImage))
+
+	verityStage := findStage("org.osbuild.dmverity", pipeline.Stages)
+	require.NotNil(t, verityStage)
+	assert.Equal(t, &osbuild.DMVerityStageOptions{RootHashFile: "disk.img.root.roothash"}, verityStage.Options)
+
+	cmdlineStage := findStage("org.osbuild.dmverity.cmdline", pipeline.Stages)
+	require.NotNil(t, cmdlineStage)
+	assert.Equal(t, &osbuild.DMVerityCmdlineStageOptions{
+		RootHashFile: "disk.img.root.roothash",
+		KernelOption: "roothash",
+		BootEntries:  "mount://boot/loader/entries",
+	}, cmdlineStage.Options)
+	require.Len(t, cmdlineStage.Mounts, 1)
+	assert.Equal(t, "/boot", cmdlineStage.Mounts[0].Target)
+	assert.Less(t, stageIndex("org.osbuild.dmverity", pipeline.Stages), stageIndex("org.osbuild.dmverity.cmdline", pipeline.Stages))
+}
+
+func TestRawImageVerityUKIAddon(t *testing.T) {
+	pt := testdisk.TestPartitionTables()["plain"]
+	require.NoError(t, pt.AddVerity("/", arch.ARCH_X86_64))
+	os := newSecureBootOS(arch.ARCH_X86_64, platform.BOOTLOADER_UKI, nil)
+	os.PartitionTable = &pt
+	_, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	require.NoError(t, err)
+
+	rawImage := manifest.NewRawImage(os.BuildPipeline(), os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	pipeline := common.Must(manifest.Serialize(rawImage))
+
+	cmdlineStage := findStage("org.osbuild.dmverity.cmdline", pipeline.Stages)
+	require.NotNil(t, cmdlineStage)
+	assert.Equal(t, &osbuild.DMVerityCmdlineStageOptions{
+		RootHashFile: "disk.img.root.roothash",
+		KernelOption: "roothash",
+		UKIAddon:     "mount://boot-efi/EFI/Linux/ffffffffffffffffffffffffffffffff-13.3-7.el9.x86_64.efi.extra.d/verity.addon.efi",
+	}, cmdlineStage.Options)
+	require.Len(t, cmdlineStage.Mounts, 1)
+	assert.Equal(t, "/boot/efi", cmdlineStage.Mounts[0].Target)
+}
+
+func TestRawImageVerityUKISecureBoot(t *testing.T) {
+	pt := testdisk.TestPartitionTables()["plain"]
+	require.NoError(t, pt.AddVerity("/", arch.ARCH_X86_64))
+	os := newSecureBootOS(arch.ARCH_X86_64, platform.BOOTLOADER_UKI, &secureboot.ImageOptions{
+		PKCS11URI: "pkcs11:token=secureboot",
+		Cert:      makeSecureBootCert(t),
+	})
+	os.PartitionTable = &pt
+
+	rawImage := manifest.NewRawImage(os.BuildPipeline(), os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	_, err := manifest.Serialize(rawImage)
+	assert.EqualError(t, err, "verity protected filesystems are not supported with secure boot signing of the UKI")
+}
+
+func TestRawImageVerityUnsupportedBootloader(t *testing.T) {
+	pt := testdisk.TestPartitionTables()["plain"]
+	require.NoError(t, pt.AddVerity("/", arch.ARCH_X86_64))
+	os := newSecureBootOS(arch.ARCH_X86_64, platform.BOOTLOADER_GRUB2, nil)
+	os.PartitionTable = &pt
+	os.OSCustomizations.NoBLS = true
+
+	rawImage := manifest.NewRawImage(os.BuildPipeline(), os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	_, err := manifest.Serialize(rawImage)
+	assert.EqualError(t, err, "verity protected filesystems are only supported with the grub2, systemd-boot and UKI bootloaders")
+}
@@ -0,0 +1,110 @@
+package manifest
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/customizations/secureboot"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// secureBootMOKCertPath is the certificate in the OS tree that is enrolled
+// as a machine owner key on the first boot.
+const secureBootMOKCertPath = "/etc/pki/secureboot/secureboot.der"
+
+// secureBootESPCertFilename is the certificate in the vendor directory of
+// the ESP.
+const secureBootESPCertFilename = "secureboot.der"
+
+// addSecureBootStages adds the stages that sign the EFI binaries of the OS
+// with the Secure Boot key and ship or enroll its certificate. Only the
+// certificate is added to the inline data of the pipeline, the key is in a
+// PKCS#11 token on the build host.
+func (p *OS) addSecureBootStages(pipeline *osbuild.Pipeline, espMountpoint string, uki bool) error {
+	sb := p.OSCustomizations.SecureBoot
+	paths, err := secureBootPaths(sb.Targets(uki), espMountpoint, p.platform.GetUEFIVendor(), efiArch(p.platform.GetArch()), p.kernelVer, uki)
+	if err != nil {
+		return err
+	}
+
+	sbsignOptions := &osbuild.SbsignStageOptions{
+		Paths:     paths,
+		PKCS11URI: sb.PKCS11URI,
+	}
+	pipeline.AddStage(osbuild.NewSbsignStage(sbsignOptions, osbuild.NewSbsignStageInputs(sb.Cert)))
+	p.inlineData = append(p.inlineData, sb.Cert)
+
+	certDER, err := sb.CertDER()
+	if err != nil {
+		return err
+	}
+	var certFiles []*fsnode.File
+	if sb.ESPCert {
+		espCert, err := fsnode.NewFile(filepath.Join(espMountpoint, "EFI", p.platform.GetUEFIVendor(), secureBootESPCertFilename), nil, nil, nil, certDER)
+		if err != nil {
+			return err
+		}
+		certFiles = append(certFiles, espCert)
+	}
+	if sb.MOKPasswordHash != "" {
+		mokCert, err := fsnode.NewFile(secureBootMOKCertPath, nil, nil, nil, certDER)
+		if err != nil {
+			return err
+		}
+		certFiles = append(certFiles, mokCert)
+	}
+	if len(certFiles) > 0 {
+		p.addStagesForAllFilesAndInlineData(pipeline, certFiles)
+	}
+	if sb.MOKPasswordHash != "" {
+		pipeline.AddStage(osbuild.NewMokutilStage(&osbuild.MokutilStageOptions{
+			MOKs: []osbuild.MOKImport{{Path: secureBootMOKCertPath, PasswordHash: sb.MOKPasswordHash}},
+		}))
+	}
+	return nil
+}
+
+// secureBootPaths returns the paths of the EFI binaries to sign in the OS
+// tree. The UKI can only be signed if the image boots a UKI, grub and the
+// kernel only if it doesn't.
+func secureBootPaths(targets []secureboot.Target, espMountpoint, vendor, efiArch, kernelVer string, uki bool) ([]string, error) {
+	if efiArch == "" || vendor == "" {
+		return nil, fmt.Errorf("secure boot signing requires a UEFI platform")
+	}
+	if kernelVer == "" && (slices.Contains(targets, secureboot.TargetUKI) || slices.Contains(targets, secureboot.TargetKernel)) {
+		return nil, fmt.Errorf("secure boot signing of the kernel requires a kernel")
+	}
+
+	bootloader := "grub2"
+	if uki {
+		bootloader = "UKI"
+	}
+	var paths []string
+	for _, target := range targets {
+		supported := true
+		switch target {
+		case secureboot.TargetUKI:
+			supported = uki
+			paths = append(paths, ukiPath(espMountpoint, kernelVer))
+		case secureboot.TargetShim:
+			paths = append(paths,
+				filepath.Join(espMountpoint, "EFI", vendor, fmt.Sprintf("shim%s.efi", efiArch)),
+				filepath.Join(espMountpoint, "EFI", "BOOT", fmt.Sprintf("BOOT%s.EFI", strings.ToUpper(efiArch))))
+		case secureboot.TargetGrub:
+			supported = !uki
+			paths = append(paths, filepath.Join(espMountpoint, "EFI", vendor, fmt.Sprintf("grub%s.efi", efiArch)))
+		case secureboot.TargetKernel:
+			supported = !uki
+			paths = append(paths, fmt.Sprintf("/boot/vmlinuz-%s", kernelVer))
+		default:
+			return nil, fmt.Errorf("unknown secure boot sign target %q", target)
+		}
+		if !supported {
+			return nil, fmt.Errorf("secure boot sign target %q is not supported for the %s bootloader", target, bootloader)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,189 @@
+package manifest_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/customizations/secureboot"
+	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func makeSecureBootCert(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fleet db key"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func kernelTestInputs(ukiDirectVersion string) manifest.Inputs {
+	repo := rpmmd.RepoConfig{Id: "dummy-repo-id"}
+	pkgs := rpmmd.PackageList{
+		{
+			Name:     "test-kernel",
+			Version:  "13.3",
+			Release:  "7.el9",
+			Arch:     "x86_64",
+			Checksum: rpmmd.Checksum{Type: "sha256", Value: "7777777777777777777777777777777777777777777777777777777777777777"},
+			RepoID:   repo.Id,
+			Repo:     &repo,
+		},
+	}
+	if ukiDirectVersion != "" {
+		pkgs = append(pkgs, rpmmd.Package{
+			Name:     "uki-direct",
+			Version:  ukiDirectVersion,
+			Release:  "1.el9",
+			Arch:     "noarch",
+			Checksum: rpmmd.Checksum{Type: "sha256", Value: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},
+			RepoID:   repo.Id,
+			Repo:     &repo,
+		})
+	}
+	return manifest.Inputs{
+		Depsolved: depsolvednf.DepsolveResult{
+			Transactions: depsolvednf.TransactionList{pkgs},
+			Repos:        []rpmmd.RepoConfig{repo},
+		},
+	}
+}
+
+func newSecureBootOS(architecture arch.Arch, bootloader platform.Bootloader, sb *secureboot.ImageOptions) *manifest.OS {
+	m := manifest.New()
+	build := manifest.NewBuild(&m, &runner.CentOS{Version: 9}, nil, nil)
+	pf := &platform.Data{
+		Arch:       architecture,
+		Bootloader: bootloader,
+		UEFIVendor: "centos",
+	}
+	os := manifest.NewOS(build, pf, nil)
+	pt := testdisk.TestPartitionTables()["plain"]
+	os.PartitionTable = &pt
+	os.OSCustomizations.KernelName = "test-kernel"
+	os.OSCustomizations.SecureBoot = sb
+	return os
+}
+
+func stageIndex(name string, stages []*osbuild.Stage) int {
+	return slices.IndexFunc(stages, func(s *osbuild.Stage) bool { return s.Type == name })
+}
+
+func TestSecureBootSignUKI(t *testing.T) {
+	cert := makeSecureBootCert(t)
+	os := newSecureBootOS(arch.ARCH_X86_64, platform.BOOTLOADER_UKI, &secureboot.ImageOptions{PKCS11URI: "pkcs11:token=fleet;object=uki", Cert: cert})
+
+	// uki-direct generates the hmac file when the kernel is installed
+	// but it must be generated again for the signed UKI
+	pipeline, err := manifest.SerializeWith(os, kernelTestInputs("25.11"))
+	require.NoError(t, err)
+
+	sbsignStage := findStage("org.osbuild.sbsign", pipeline.Stages)
+	require.NotNil(t, sbsignStage)
+	assert.Equal(t, &osbuild.SbsignStageOptions{
+		Paths:     []string{"/boot/efi/EFI/Linux/ffffffffffffffffffffffffffffffff-13.3-7.el9.x86_64.efi"},
+		PKCS11URI: "pkcs11:token=fleet;object=uki",
+	}, sbsignStage.Options)
+	assert.Equal(t, osbuild.NewSbsignStageInputs(cert), sbsignStage.Inputs)
+	assert.Less(t, stageIndex("org.osbuild.sbsign", pipeline.Stages), stageIndex("org.osbuild.hmac", pipeline.Stages))
+	assert.Nil(t, findStage("org.osbuild.mokutil", pipeline.Stages))
+
+	assert.Contains(t, manifest.GetInline(os), cert)
+}
+
+func TestSecureBootSignGrubWithMOK(t *testing.T) {
+	cert := makeSecureBootCert(t)
+	os := newSecureBootOS(arch.ARCH_X86_64, platform.BOOTLOADER_GRUB2, &secureboot.ImageOptions{
+		PKCS11URI:       "pkcs11:token=fleet;object=db",
+		Cert:            cert,
+		Sign:            []secureboot.Target{secureboot.TargetShim, secureboot.TargetGrub, secureboot.TargetKernel},
+		MOKPasswordHash: "$6$salt$hash",
+		ESPCert:         true,
+	})
+	pipeline, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	require.NoError(t, err)
+
+	sbsignStage := findStage("org.osbuild.sbsign", pipeline.Stages)
+	require.NotNil(t, sbsignStage)
+	assert.Equal(t, &osbuild.SbsignStageOptions{
+		Paths: []string{
+			"/boot/efi/EFI/centos/shimx64.efi",
+			"/boot/efi/EFI/BOOT/BOOTX64.EFI",
+			"/boot/efi/EFI/centos/grubx64.efi",
+			"/boot/vmlinuz-13.3-7.el9.x86_64",
+		},
+		PKCS11URI: "pkcs11:token=fleet;object=db",
+	}, sbsignStage.Options)
+
+	assert.Subset(t, collectCopyDestinationPaths(pipeline.Stages), []string{
+		"tree:///boot/efi/EFI/centos/secureboot.der",
+		"tree:///etc/pki/secureboot/secureboot.der",
+	})
+	mokutilStage := findStage("org.osbuild.mokutil", pipeline.Stages)
+	require.NotNil(t, mokutilStage)
+	assert.Equal(t, &osbuild.MokutilStageOptions{
+		MOKs: []osbuild.MOKImport{{Path: "/etc/pki/secureboot/secureboot.der", PasswordHash: "$6$salt$hash"}},
+	}, mokutilStage.Options)
+	assert.Greater(t, stageIndex("org.osbuild.mokutil", pipeline.Stages), stageIndex("org.osbuild.copy", pipeline.Stages))
+
+	assert.NotContains(t, manifest.GetInline(os), "pkcs11:token=fleet;object=db")
+	assert.Contains(t, manifest.GetInline(os), cert)
+}
+
+func TestSecureBootUnsupportedTarget(t *testing.T) {
+	cert := makeSecureBootCert(t)
+	os := newSecureBootOS(arch.ARCH_X86_64, platform.BOOTLOADER_UKI, &secureboot.ImageOptions{
+		PKCS11URI: "pkcs11:token=fleet;object=db",
+		Cert:      cert,
+		Sign:      []secureboot.Target{secureboot.TargetGrub},
+	})
+	_, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	assert.EqualError(t, err, `secure boot sign target "grub" is not supported for the UKI bootloader`)
+}
+
+func TestSecureBootSignRISCV64(t *testing.T) {
+	cert := makeSecureBootCert(t)
+	os := newSecureBootOS(arch.ARCH_RISCV64, platform.BOOTLOADER_GRUB2, &secureboot.ImageOptions{
+		PKCS11URI: "pkcs11:token=fleet;object=db",
+		Cert:      cert,
+		Sign:      []secureboot.Target{secureboot.TargetShim, secureboot.TargetGrub},
+	})
+	pipeline, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	require.NoError(t, err)
+
+	grubStage := findStage("org.osbuild.grub2", pipeline.Stages)
+	require.NotNil(t, grubStage)
+	assert.Equal(t, "centos", grubStage.Options.(*osbuild.GRUB2StageOptions).UEFI.Vendor)
+
+	sbsignStage := findStage("org.osbuild.sbsign", pipeline.Stages)
+	require.NotNil(t, sbsignStage)
+	assert.Equal(t, []string{
+		"/boot/efi/EFI/centos/shimriscv64.efi",
+		"/boot/efi/EFI/BOOT/BOOTRISCV64.EFI",
+		"/boot/efi/EFI/centos/grubriscv64.efi",
+	}, sbsignStage.Options.(*osbuild.SbsignStageOptions).Paths)
+}
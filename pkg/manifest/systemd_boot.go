@@ -0,0 +1,97 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// systemdBootPaths returns the mountpoints of the ESP and of the XBOOTLDR
+// partition, if the partition table has one. systemd-boot can only find a
+// separate /boot by its partition type and only read boot entries and
+// kernels from FAT filesystems, so any other /boot is an error rather than
+// silently unbootable.
+func systemdBootPaths(pt *disk.PartitionTable) (string, string, error) {
+	espMountpoint, err := findESPMountpoint(pt)
+	if err != nil {
+		return "", "", err
+	}
+	if err := pt.ValidateXBOOTLDR(); err != nil {
+		return "", "", fmt.Errorf("systemd-boot cannot boot from the partition table: %w", err)
+	}
+
+	var bootPath, bootFSType string
+	_ = pt.ForEachMountable(func(mnt disk.Mountable, path []disk.Entity) error {
+		if partition, ok := path[1].(*disk.Partition); ok && partition.Type == disk.XBootLDRPartitionGUID {
+			bootPath = mnt.GetMountpoint()
+			bootFSType = mnt.GetFSType()
+		}
+		return nil
+	})
+	if bootPath != "" && bootFSType != "vfat" {
+		return "", "", fmt.Errorf("systemd-boot cannot read the %s filesystem of the XBOOTLDR partition %q, it must be vfat", bootFSType, bootPath)
+	}
+	return espMountpoint, bootPath, nil
+}
+
+// systemdBootKernelInstallEnv returns the kernel-install environment for the
+// rpm stages, so that the kernel, the initrd and the boot entry are written
+// to the XBOOTLDR partition or, if there is none, to the ESP.
+func systemdBootKernelInstallEnv(pt *disk.PartitionTable) (*osbuild.KernelInstallEnv, error) {
+	espMountpoint, bootPath, err := systemdBootPaths(pt)
+	if err != nil {
+		return nil, err
+	}
+	bootRoot := espMountpoint
+	if bootPath != "" {
+		bootRoot = bootPath
+	}
+	return &osbuild.KernelInstallEnv{
+		BootRoot: bootRoot,
+	}, nil
+}
+
+// addSystemdBootStages installs systemd-boot with the same entry token as
+// the kernel installed when the image was built, so that kernels installed
+// on the running system end up next to it. The bls layout is selected by
+// the kernel-install configuration written before the rpm stages, see
+// addKernelInstallLayoutStages().
+func (p *OS) addSystemdBootStages(pipeline *osbuild.Pipeline, pt *disk.PartitionTable) error {
+	espMountpoint, bootPath, err := systemdBootPaths(pt)
+	if err != nil {
+		return err
+	}
+	pipeline.AddStage(osbuild.NewSystemdBootStage(&osbuild.SystemdBootStageOptions{
+		ESPPath:    espMountpoint,
+		BootPath:   bootPath,
+		EntryToken: "literal:" + machineIDPlaceholder,
+		Loader: &osbuild.SystemdBootLoaderConfig{
+			Editor: common.ToPtr(false),
+		},
+	}))
+	return nil
+}
+
+// addKernelInstallLayoutStages writes the kernel-install configuration that
+// selects the bls layout, for the bootloaders that read the kernels from the
+// boot loader entry directories. kernel-install reads it when the kernel
+// package is installed, so the stages must be added before the rpm stages.
+// It stays in the image so that kernels installed on the running system get
+// the same layout.
+func (p *OS) addKernelInstallLayoutStages(pipeline *osbuild.Pipeline) error {
+	kernelDir, err := fsnode.NewDirectory("/etc/kernel", nil, nil, nil, true)
+	if err != nil {
+		return err
+	}
+	pipeline.AddStages(osbuild.GenDirectoryNodesStages([]*fsnode.Directory{kernelDir})...)
+
+	installConf, err := fsnode.NewFile("/etc/kernel/install.conf", nil, nil, nil, []byte("layout=bls\n"))
+	if err != nil {
+		return err
+	}
+	p.addStagesForAllFilesAndInlineData(pipeline, []*fsnode.File{installConf})
+	return nil
+}
@@ -0,0 +1,109 @@
+package manifest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func newSystemdBootOS(pt disk.PartitionTable) *manifest.OS {
+	m := manifest.New()
+	build := manifest.NewBuild(&m, &runner.Fedora{Version: 42}, nil, nil)
+	pf := &platform.Data{
+		Arch:       arch.ARCH_X86_64,
+		Bootloader: platform.BOOTLOADER_SYSTEMD_BOOT,
+		UEFIVendor: "fedora",
+	}
+	os := manifest.NewOS(build, pf, nil)
+	os.PartitionTable = &pt
+	os.OSCustomizations.KernelName = "test-kernel"
+	return os
+}
+
+// xbootldrPartitionTable returns the "plain" test partition table with the
+// /boot partition turned into an XBOOTLDR partition
+func xbootldrPartitionTable(fsType string) disk.PartitionTable {
+	pt := testdisk.TestPartitionTables()["plain"]
+	pt.Partitions = append([]disk.Partition(nil), pt.Partitions...)
+	boot := pt.Partitions[2]
+	fs := *boot.Payload.(*disk.Filesystem)
+	fs.Type = fsType
+	boot.Type = disk.XBootLDRPartitionGUID
+	boot.Payload = &fs
+	pt.Partitions[2] = boot
+	return pt
+}
+
+func TestSystemdBootESP(t *testing.T) {
+	os := newSystemdBootOS(testdisk.TestPartitionTables()["plain-noboot"])
+	pipeline, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	require.NoError(t, err)
+
+	rpmStage := findStage("org.osbuild.rpm", pipeline.Stages)
+	require.NotNil(t, rpmStage)
+	assert.Equal(t, &osbuild.KernelInstallEnv{BootRoot: "/boot/efi"}, rpmStage.Options.(*osbuild.RPMStageOptions).KernelInstallEnv)
+
+	sdbootStage := findStage("org.osbuild.systemd-boot", pipeline.Stages)
+	require.NotNil(t, sdbootStage)
+	assert.Equal(t, &osbuild.SystemdBootStageOptions{
+		ESPPath:    "/boot/efi",
+		EntryToken: "literal:ffffffffffffffffffffffffffffffff",
+		Loader: &osbuild.SystemdBootLoaderConfig{
+			Editor: common.ToPtr(false),
+		},
+	}, sdbootStage.Options)
+
+	// the command line must be in place before the kernel is installed
+	assert.Equal(t, "org.osbuild.kernel-cmdline", pipeline.Stages[0].Type)
+	assert.Less(t, stageIndex("org.osbuild.kernel-cmdline", pipeline.Stages), stageIndex("org.osbuild.rpm", pipeline.Stages))
+	assert.Nil(t, findStage("org.osbuild.fix-bls", pipeline.Stages))
+	assert.Nil(t, findStage("org.osbuild.grub2", pipeline.Stages))
+
+	// and so must the layout, kernel-install reads it when the kernel
+	// package is installed
+	copyStage := findStage("org.osbuild.copy", pipeline.Stages)
+	require.NotNil(t, copyStage)
+	assert.Equal(t, "tree:///etc/kernel/install.conf", copyStage.Options.(*osbuild.CopyStageOptions).Paths[0].To)
+	assert.Less(t, stageIndex("org.osbuild.copy", pipeline.Stages), stageIndex("org.osbuild.rpm", pipeline.Stages))
+	assert.Contains(t, manifest.GetInline(os), "layout=bls\n")
+}
+
+func TestSystemdBootXBOOTLDR(t *testing.T) {
+	os := newSystemdBootOS(xbootldrPartitionTable("vfat"))
+	pipeline, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	require.NoError(t, err)
+
+	rpmStage := findStage("org.osbuild.rpm", pipeline.Stages)
+	require.NotNil(t, rpmStage)
+	assert.Equal(t, "/boot", rpmStage.Options.(*osbuild.RPMStageOptions).KernelInstallEnv.BootRoot)
+
+	sdbootStage := findStage("org.osbuild.systemd-boot", pipeline.Stages)
+	require.NotNil(t, sdbootStage)
+	options := sdbootStage.Options.(*osbuild.SystemdBootStageOptions)
+	assert.Equal(t, "/boot/efi", options.ESPPath)
+	assert.Equal(t, "/boot", options.BootPath)
+}
+
+func TestSystemdBootXBOOTLDRNotVFAT(t *testing.T) {
+	os := newSystemdBootOS(xbootldrPartitionTable("xfs"))
+	_, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	assert.EqualError(t, err, `systemd-boot cannot boot from the partition table: the XBOOTLDR partition /boot must be vfat, not xfs`)
+}
+
+func TestSystemdBootBootNotXBOOTLDR(t *testing.T) {
+	// systemd-boot does not look for the boot entries on a /boot with the
+	// generic linux data partition type
+	os := newSystemdBootOS(testdisk.TestPartitionTables()["plain"])
+	_, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	assert.EqualError(t, err, `systemd-boot cannot boot from the partition table: /boot must be a GPT partition with the XBOOTLDR partition type BC13C2FF-59E6-4262-A352-B275FD6F7172`)
+}
@@ -0,0 +1,229 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+// ubootKernelInstallEnv returns the kernel-install environment for the rpm
+// stages. Without a bootloader package that installs the kernel to /boot,
+// the bls layout (see addKernelInstallLayoutStages()) is used to get the
+// kernel and the initrd into a directory of /boot that U-Boot can read.
+func ubootKernelInstallEnv() *osbuild.KernelInstallEnv {
+	return &osbuild.KernelInstallEnv{
+		BootRoot: "/boot",
+	}
+}
+
+// ubootFirmwarePath returns the mountpoint of the firmware partition of the
+// board, if it has one. The board firmware can only read FAT filesystems.
+func ubootFirmwarePath(uboot *platform.UBoot, pt *disk.PartitionTable) (string, error) {
+	if uboot == nil || uboot.FirmwarePath == "" {
+		return "", nil
+	}
+	mnt := pt.FindMountable(uboot.FirmwarePath)
+	if mnt == nil {
+		return "", fmt.Errorf("the firmware partition %q of the board is missing from the partition table", uboot.FirmwarePath)
+	}
+	if fsType := mnt.GetFSType(); fsType != "vfat" {
+		return "", fmt.Errorf("the board firmware cannot read the %s filesystem of the firmware partition %q, it must be vfat", fsType, uboot.FirmwarePath)
+	}
+	return uboot.FirmwarePath, nil
+}
+
+// ubootExtlinuxHook is the kernel-install plugin that regenerates the
+// extlinux.conf when a kernel is added or removed on the running system, it
+// is installed after the kernel of the image so the extlinux.conf of that
+// kernel is written by addUBootStages(). The plugins run after
+// 90-loaderentry.install copied the kernel to the entry directory, the entry
+// directory of a removed kernel is only deleted after the plugins ran.
+const ubootExtlinuxHook = "/etc/kernel/install.d/95-extlinux.install"
+
+// ubootExtlinuxHookScript returns the kernel-install plugin that writes the
+// extlinux.conf with an entry for every kernel in the entry directory, the
+// newest kernel is the default. The entries use the same format as the
+// extlinux.conf of addUBootStages() and the kernel command line from
+// /etc/kernel/cmdline.
+func ubootExtlinuxHookScript(uboot *platform.UBoot, firmwarePath, bootPrefix, product string) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+
+	var script strings.Builder
+	fmt.Fprintf(&script, "#!/bin/sh\n")
+	fmt.Fprintf(&script, "# Generated by osbuild, regenerates the extlinux.conf of U-Boot\n")
+	fmt.Fprintf(&script, "set -e\n\n")
+	fmt.Fprintf(&script, "COMMAND=\"$1\"\n")
+	fmt.Fprintf(&script, "KERNEL_VERSION=\"$2\"\n")
+	fmt.Fprintf(&script, "ENTRY_DIR_ABS=\"$3\"\n\n")
+	fmt.Fprintf(&script, "[ \"$KERNEL_INSTALL_LAYOUT\" = bls ] || exit 0\n\n")
+	fmt.Fprintf(&script, "if [ \"$COMMAND\" = add ] && [ -d \"/usr/lib/modules/$KERNEL_VERSION/dtb\" ]; then\n")
+	fmt.Fprintf(&script, "\tcp -rT \"/usr/lib/modules/$KERNEL_VERSION/dtb\" \"$ENTRY_DIR_ABS/dtb\"\n")
+	if firmwarePath != "" {
+		for _, dtb := range uboot.DeviceTrees {
+			fmt.Fprintf(&script, "\tcp -rT \"/usr/lib/modules/$KERNEL_VERSION/dtb\"/%s %s\n",
+				quote(dtb), quote(path.Join(firmwarePath, path.Base(dtb))))
+		}
+	}
+	fmt.Fprintf(&script, "fi\n\n")
+	fmt.Fprintf(&script, "PREFIX=%s/\"$KERNEL_INSTALL_ENTRY_TOKEN\"\n", quote(strings.TrimSuffix(bootPrefix, "/")))
+	fmt.Fprintf(&script, "CMDLINE=\"$(cat /etc/kernel/cmdline)\"\n")
+	fmt.Fprintf(&script, "VERSIONS=\"$(ls -1 \"$KERNEL_INSTALL_BOOT_ROOT/$KERNEL_INSTALL_ENTRY_TOKEN\" | sort -V -r)\"\n")
+	fmt.Fprintf(&script, "CONF=/boot/extlinux/extlinux.conf\n\n")
+	fmt.Fprintf(&script, "DEFAULT=\n")
+	fmt.Fprintf(&script, "for v in $VERSIONS; do\n")
+	fmt.Fprintf(&script, "\t[ \"$COMMAND\" = remove ] && [ \"$v\" = \"$KERNEL_VERSION\" ] && continue\n")
+	fmt.Fprintf(&script, "\t[ -f \"$KERNEL_INSTALL_BOOT_ROOT/$KERNEL_INSTALL_ENTRY_TOKEN/$v/linux\" ] || continue\n")
+	fmt.Fprintf(&script, "\t[ -n \"$DEFAULT\" ] || DEFAULT=\"$v\"\n")
+	fmt.Fprintf(&script, "\tprintf '\\nlabel %%s\\n' \"$v\"\n")
+	fmt.Fprintf(&script, "\tprintf '\\tmenu label %%s (%%s)\\n' %s \"$v\"\n", quote(product))
+	fmt.Fprintf(&script, "\tprintf '\\tkernel %%s\\n' \"$PREFIX/$v/linux\"\n")
+	fmt.Fprintf(&script, "\tprintf '\\tinitrd %%s\\n' \"$PREFIX/$v/initrd\"\n")
+	fmt.Fprintf(&script, "\tprintf '\\tfdtdir %%s\\n' \"$PREFIX/$v/dtb\"\n")
+	fmt.Fprintf(&script, "\tprintf '\\tappend %%s\\n' \"$CMDLINE\"\n")
+	fmt.Fprintf(&script, "done > \"$CONF.entries\"\n\n")
+	fmt.Fprintf(&script, "if [ -z \"$DEFAULT\" ]; then\n")
+	fmt.Fprintf(&script, "\trm -f \"$CONF.entries\"\n")
+	fmt.Fprintf(&script, "\texit 0\n")
+	fmt.Fprintf(&script, "fi\n")
+	fmt.Fprintf(&script, "{\n")
+	fmt.Fprintf(&script, "\tprintf '# Generated by osbuild\\n'\n")
+	fmt.Fprintf(&script, "\tprintf 'default %%s\\n' \"$DEFAULT\"\n")
+	fmt.Fprintf(&script, "\tprintf 'timeout 30\\n'\n")
+	fmt.Fprintf(&script, "\tprintf 'menu title %%s\\n' %s\n", quote(product))
+	fmt.Fprintf(&script, "\tcat \"$CONF.entries\"\n")
+	fmt.Fprintf(&script, "} > \"$CONF.new\"\n")
+	fmt.Fprintf(&script, "rm -f \"$CONF.entries\"\n")
+	fmt.Fprintf(&script, "mv \"$CONF.new\" \"$CONF\"\n")
+	return script.String()
+}
+
+// addUBootStages copies the device trees of the kernel to where the board
+// firmware and U-Boot look for them and writes the extlinux.conf that
+// U-Boot boots the kernel with. The extlinux.conf only has an entry for the
+// kernel of the image, the kernel-install plugin of
+// ubootExtlinuxHookScript() keeps it up to date when kernels are installed
+// or removed on the running system.
+func (p *OS) addUBootStages(pipeline *osbuild.Pipeline, pt *disk.PartitionTable, rootUUID string, kernelOptions []string) error {
+	uboot := p.platform.GetUBoot()
+	firmwarePath, err := ubootFirmwarePath(uboot, pt)
+	if err != nil {
+		return err
+	}
+
+	// paths of the kernel-install entry directory, in the tree and as
+	// seen by U-Boot on the /boot filesystem
+	entryDir := path.Join(machineIDPlaceholder, p.kernelVer)
+	bootPrefix := "/boot"
+	if pt.FindMountable("/boot") != nil {
+		bootPrefix = "/"
+	}
+
+	dtbDir := path.Join("/usr/lib/modules", p.kernelVer, "dtb")
+	copyOptions := &osbuild.CopyStageOptions{
+		Paths: []osbuild.CopyStagePath{
+			{
+				From: "tree://" + dtbDir,
+				To:   "tree://" + path.Join("/boot", entryDir, "dtb"),
+			},
+		},
+	}
+	if firmwarePath != "" {
+		for _, dtb := range uboot.DeviceTrees {
+			copyOptions.Paths = append(copyOptions.Paths, osbuild.CopyStagePath{
+				From: "tree://" + path.Join(dtbDir, dtb),
+				To:   "tree://" + path.Join(firmwarePath, path.Base(dtb)),
+			})
+		}
+	}
+	pipeline.AddStage(osbuild.NewCopyStageSimple(copyOptions, nil))
+
+	extlinuxDir, err := fsnode.NewDirectory("/boot/extlinux", nil, nil, nil, false)
+	if err != nil {
+		return err
+	}
+	pipeline.AddStages(osbuild.GenDirectoryNodesStages([]*fsnode.Directory{extlinuxDir})...)
+
+	cmdline := append([]string{"root=UUID=" + rootUUID}, kernelOptions...)
+	var conf strings.Builder
+	fmt.Fprintf(&conf, "# Generated by osbuild\n")
+	fmt.Fprintf(&conf, "default %s\n", p.kernelVer)
+	fmt.Fprintf(&conf, "timeout 30\n")
+	fmt.Fprintf(&conf, "menu title %s\n\n", p.OSProduct)
+	fmt.Fprintf(&conf, "label %s\n", p.kernelVer)
+	fmt.Fprintf(&conf, "\tmenu label %s (%s)\n", p.OSProduct, p.kernelVer)
+	fmt.Fprintf(&conf, "\tkernel %s\n", path.Join(bootPrefix, entryDir, "linux"))
+	fmt.Fprintf(&conf, "\tinitrd %s\n", path.Join(bootPrefix, entryDir, "initrd"))
+	fmt.Fprintf(&conf, "\tfdtdir %s\n", path.Join(bootPrefix, entryDir, "dtb"))
+	fmt.Fprintf(&conf, "\tappend %s\n", strings.Join(cmdline, " "))
+
+	extlinuxConf, err := fsnode.NewFile("/boot/extlinux/extlinux.conf", nil, nil, nil, []byte(conf.String()))
+	if err != nil {
+		return err
+	}
+	// pin the entry token so that kernels installed on the running system
+	// end up next to the one of the image
+	entryToken, err := fsnode.NewFile("/etc/kernel/entry-token", nil, nil, nil, []byte(machineIDPlaceholder+"\n"))
+	if err != nil {
+		return err
+	}
+	hook, err := fsnode.NewFile(ubootExtlinuxHook, common.ToPtr(os.FileMode(0755)), nil, nil, []byte(ubootExtlinuxHookScript(uboot, firmwarePath, bootPrefix, p.OSProduct)))
+	if err != nil {
+		return err
+	}
+	p.addStagesForAllFilesAndInlineData(pipeline, []*fsnode.File{extlinuxConf, entryToken, hook})
+	return nil
+}
+
+// ubootEmbedStages returns the stages that write the bootloader images of
+// the board to their offsets of the disk image. The images must be placed
+// between the partition table header and the first partition, their size is
+// only known when the image is built so the end is not checked here.
+func ubootEmbedStages(uboot *platform.UBoot, pt *disk.PartitionTable, filename, treePipeline string) ([]*osbuild.Stage, error) {
+	if uboot == nil || len(uboot.Embed) == 0 {
+		return nil, nil
+	}
+
+	firstPartition := pt.Size.Uint64()
+	for _, part := range pt.Partitions {
+		firstPartition = min(firstPartition, part.Start)
+	}
+	var sectorSize *uint64
+	if pt.SectorSize != 0 {
+		sectorSize = &pt.SectorSize
+	}
+
+	inputName := "tree"
+	stages := make([]*osbuild.Stage, 0, len(uboot.Embed))
+	for _, embed := range uboot.Embed {
+		offset := embed.Offset.Uint64()
+		if pt.SectorsToBytes(pt.BytesToSectors(offset)) != offset {
+			return nil, fmt.Errorf("offset %d of the bootloader image %q is not aligned to the sector size", offset, embed.Path)
+		}
+		if offset < pt.HeaderSize().Uint64() || offset >= firstPartition {
+			return nil, fmt.Errorf("offset %d of the bootloader image %q must be between the partition table header (%d) and the first partition (%d)", offset, embed.Path, pt.HeaderSize(), firstPartition)
+		}
+
+		devices := map[string]osbuild.Device{
+			"device": *osbuild.NewLoopbackDevice(&osbuild.LoopbackDeviceOptions{
+				Filename:   filename,
+				Start:      pt.BytesToSectors(offset),
+				SectorSize: sectorSize,
+			}),
+		}
+		options := &osbuild.WriteDeviceStageOptions{
+			From: fmt.Sprintf("input://%s", path.Join(inputName, embed.Path)),
+		}
+		inputs := osbuild.NewPipelineTreeInputs(inputName, treePipeline)
+		stages = append(stages, osbuild.NewWriteDeviceStage(options, inputs, devices))
+	}
+	return stages, nil
+}
@@ -0,0 +1,197 @@
+package manifest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func newUBootOS(pt *disk.PartitionTable, uboot *platform.UBoot) *manifest.OS {
+	m := manifest.New()
+	build := manifest.NewBuild(&m, &runner.Fedora{Version: 42}, nil, nil)
+	pf := &platform.Data{
+		Arch:       arch.ARCH_AARCH64,
+		Bootloader: platform.BOOTLOADER_UBOOT,
+		UBoot:      uboot,
+	}
+	os := manifest.NewOS(build, pf, nil)
+	os.PartitionTable = pt
+	os.OSProduct = "Fedora"
+	os.OSCustomizations.KernelName = "test-kernel"
+	return os
+}
+
+// ubootPartitionTable returns a laid out dos partition table with a
+// firmware partition at 16 MiB
+func ubootPartitionTable() *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_DOS,
+		Size: 2 * datasizes.GiB,
+		Partitions: []disk.Partition{
+			{
+				Start: 16 * datasizes.MiB,
+				Size:  200 * datasizes.MiB,
+				Type:  disk.FAT16BDOSID,
+				Payload: &disk.Filesystem{
+					Type:       "vfat",
+					UUID:       "7B77-95E7",
+					Mountpoint: "/boot/efi",
+				},
+			},
+			{
+				Start:    216 * datasizes.MiB,
+				Size:     1832 * datasizes.MiB,
+				Bootable: true,
+				Type:     disk.FilesystemLinuxDOSID,
+				Payload: &disk.Filesystem{
+					Type:       "ext4",
+					UUID:       "6264D520-3FB9-423F-8AB8-7A0A8E3D3562",
+					Mountpoint: "/",
+				},
+			},
+		},
+	}
+}
+
+func TestUBootOS(t *testing.T) {
+	pt := testdisk.TestPartitionTables()["plain"]
+	pt.Partitions[3].Payload.(*disk.Filesystem).UUID = "6264D520-3FB9-423F-8AB8-7A0A8E3D3562"
+	os := newUBootOS(&pt, &platform.UBoot{
+		FirmwarePath: "/boot/efi",
+		DeviceTrees:  []string{"broadcom/bcm2711-rpi-4-b.dtb", "overlays"},
+	})
+	pipeline, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	require.NoError(t, err)
+
+	rpmStage := findStage("org.osbuild.rpm", pipeline.Stages)
+	require.NotNil(t, rpmStage)
+	assert.Equal(t, &osbuild.KernelInstallEnv{BootRoot: "/boot"}, rpmStage.Options.(*osbuild.RPMStageOptions).KernelInstallEnv)
+	assert.Equal(t, "org.osbuild.kernel-cmdline", pipeline.Stages[0].Type)
+	assert.Nil(t, findStage("org.osbuild.fix-bls", pipeline.Stages))
+	assert.Nil(t, findStage("org.osbuild.grub2", pipeline.Stages))
+
+	// the layout is written before the kernel is installed, the device
+	// trees are copied after it
+	copyStages := findStages("org.osbuild.copy", pipeline.Stages)
+	require.GreaterOrEqual(t, len(copyStages), 2)
+	assert.Equal(t, "tree:///etc/kernel/install.conf", copyStages[0].Options.(*osbuild.CopyStageOptions).Paths[0].To)
+	assert.Less(t, stageIndex("org.osbuild.copy", pipeline.Stages), stageIndex("org.osbuild.rpm", pipeline.Stages))
+	copyStage := copyStages[1]
+	assert.Equal(t, []osbuild.CopyStagePath{
+		{
+			From: "tree:///usr/lib/modules/13.3-7.el9.x86_64/dtb",
+			To:   "tree:///boot/ffffffffffffffffffffffffffffffff/13.3-7.el9.x86_64/dtb",
+		},
+		{
+			From: "tree:///usr/lib/modules/13.3-7.el9.x86_64/dtb/broadcom/bcm2711-rpi-4-b.dtb",
+			To:   "tree:///boot/efi/bcm2711-rpi-4-b.dtb",
+		},
+		{
+			From: "tree:///usr/lib/modules/13.3-7.el9.x86_64/dtb/overlays",
+			To:   "tree:///boot/efi/overlays",
+		},
+	}, copyStage.Options.(*osbuild.CopyStageOptions).Paths)
+
+	// /boot is a separate partition, so the paths are relative to it
+	assert.Contains(t, collectCopyDestinationPaths(pipeline.Stages), "tree:///boot/extlinux/extlinux.conf")
+	assert.Contains(t, manifest.GetInline(os), `# Generated by osbuild
+default 13.3-7.el9.x86_64
+timeout 30
+menu title Fedora
+
+label 13.3-7.el9.x86_64
+	menu label Fedora (13.3-7.el9.x86_64)
+	kernel /ffffffffffffffffffffffffffffffff/13.3-7.el9.x86_64/linux
+	initrd /ffffffffffffffffffffffffffffffff/13.3-7.el9.x86_64/initrd
+	fdtdir /ffffffffffffffffffffffffffffffff/13.3-7.el9.x86_64/dtb
+	append root=UUID=6264D520-3FB9-423F-8AB8-7A0A8E3D3562
+`)
+	assert.Contains(t, manifest.GetInline(os), "ffffffffffffffffffffffffffffffff\n")
+
+	// the kernel-install plugin keeps the extlinux.conf up to date for
+	// the kernels installed on the running system
+	assert.Contains(t, collectCopyDestinationPaths(pipeline.Stages), "tree:///etc/kernel/install.d/95-extlinux.install")
+	var hookMode string
+	for _, stage := range findStages("org.osbuild.chmod", pipeline.Stages) {
+		if item, ok := stage.Options.(*osbuild.ChmodStageOptions).Items["/etc/kernel/install.d/95-extlinux.install"]; ok {
+			hookMode = item.Mode
+		}
+	}
+	assert.Equal(t, "0755", hookMode)
+	var hook string
+	for _, data := range manifest.GetInline(os) {
+		if strings.HasPrefix(data, "#!/bin/sh\n") {
+			hook = data
+		}
+	}
+	assert.Contains(t, hook, `PREFIX=''/"$KERNEL_INSTALL_ENTRY_TOKEN"`)
+	assert.Contains(t, hook, `cp -rT "/usr/lib/modules/$KERNEL_VERSION/dtb"/'broadcom/bcm2711-rpi-4-b.dtb' '/boot/efi/bcm2711-rpi-4-b.dtb'`)
+	assert.Contains(t, hook, `printf 'menu title %s\n' 'Fedora'`)
+}
+
+func TestUBootFirmwareNotVFAT(t *testing.T) {
+	pt := testdisk.TestPartitionTables()["plain"]
+	os := newUBootOS(&pt, &platform.UBoot{FirmwarePath: "/boot"})
+	_, err := manifest.SerializeWith(os, kernelTestInputs(""))
+	assert.EqualError(t, err, `the board firmware cannot read the xfs filesystem of the firmware partition "/boot", it must be vfat`)
+}
+
+func TestUBootEmbed(t *testing.T) {
+	os := newUBootOS(ubootPartitionTable(), &platform.UBoot{
+		FirmwarePath: "/boot/efi",
+		Embed: []platform.UBootEmbed{
+			{Path: "/usr/share/uboot/rock64-rk3328/idbloader.img", Offset: 32 * datasizes.KiB},
+		},
+	})
+	rawImage := manifest.NewRawImage(os.BuildPipeline(), os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	pipeline, err := manifest.Serialize(rawImage)
+	require.NoError(t, err)
+
+	writeStage := findStage("org.osbuild.write-device", pipeline.Stages)
+	require.NotNil(t, writeStage)
+	assert.Equal(t, &osbuild.WriteDeviceStageOptions{
+		From: "input://tree/usr/share/uboot/rock64-rk3328/idbloader.img",
+	}, writeStage.Options)
+	assert.Equal(t, &osbuild.LoopbackDeviceOptions{
+		Filename: "disk.img",
+		Start:    64,
+	}, writeStage.Devices["device"].Options)
+}
+
+func TestUBootEmbedBadOffset(t *testing.T) {
+	for _, tc := range []struct {
+		offset datasizes.Size
+		expErr string
+	}{
+		{
+			offset: 256,
+			expErr: `offset 256 of the bootloader image "/u-boot.bin" is not aligned to the sector size`,
+		},
+		{
+			offset: 0,
+			expErr: `offset 0 of the bootloader image "/u-boot.bin" must be between the partition table header (512) and the first partition (16777216)`,
+		},
+		{
+			offset: 16 * datasizes.MiB,
+			expErr: `offset 16777216 of the bootloader image "/u-boot.bin" must be between the partition table header (512) and the first partition (16777216)`,
+		},
+	} {
+		os := newUBootOS(ubootPartitionTable(), &platform.UBoot{
+			Embed: []platform.UBootEmbed{{Path: "/u-boot.bin", Offset: tc.offset}},
+		})
+		rawImage := manifest.NewRawImage(os.BuildPipeline(), os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+		_, err := manifest.Serialize(rawImage)
+		assert.EqualError(t, err, tc.expErr)
+	}
+}
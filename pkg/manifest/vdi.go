@@ -0,0 +1,64 @@
+package manifest
+
+import (
+	"github.com/osbuild/images/pkg/artifact"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// A VDI turns a raw image file into a vdi image, the disk format of
+// VirtualBox. The image is dynamically allocated.
+type VDI struct {
+	Base
+	filename string
+
+	imgPipeline FilePipeline
+}
+
+func (p VDI) Filename() string {
+	return p.filename
+}
+
+func (p *VDI) SetFilename(filename string) {
+	p.filename = filename
+}
+
+// NewVDI creates a new VDI pipeline. imgPipeline is the pipeline producing the
+// raw image. Filename is the name of the produced image.
+func NewVDI(buildPipeline Build, imgPipeline FilePipeline) *VDI {
+	p := &VDI{
+		Base:        NewBase("vdi", buildPipeline),
+		imgPipeline: imgPipeline,
+		filename:    "image.vdi",
+	}
+	// See similar logic in qcow2 to run on the host
+	if buildPipeline != nil {
+		buildPipeline.addDependent(p)
+	} else {
+		imgPipeline.Manifest().addPipeline(p)
+	}
+	return p
+}
+
+func (p *VDI) serialize() (osbuild.Pipeline, error) {
+	pipeline, err := p.Base.serialize()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+
+	pipeline.AddStage(osbuild.NewQEMUStage(
+		osbuild.NewQEMUStageOptions(p.Filename(), osbuild.QEMUFormatVDI, nil),
+		osbuild.NewQemuStagePipelineFilesInputs(p.imgPipeline.Name(), p.imgPipeline.Filename()),
+	))
+
+	return pipeline, nil
+}
+
+func (p *VDI) getBuildPackages(Distro) ([]string, error) {
+	return []string{"qemu-img"}, nil
+}
+
+func (p *VDI) Export() *artifact.Artifact {
+	p.Base.export = true
+	mimeType := "application/x-virtualbox-vdi"
+	return artifact.New(p.Name(), p.Filename(), &mimeType)
+}
@@ -0,0 +1,64 @@
+package manifest
+
+import (
+	"github.com/osbuild/images/pkg/artifact"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// A VHDX turns a raw image file into a vhdx image, the disk format of
+// Hyper-V.
+type VHDX struct {
+	Base
+	filename string
+
+	imgPipeline FilePipeline
+}
+
+func (p VHDX) Filename() string {
+	return p.filename
+}
+
+func (p *VHDX) SetFilename(filename string) {
+	p.filename = filename
+}
+
+// NewVHDX creates a new VHDX pipeline. imgPipeline is the pipeline producing
+// the raw image. Filename is the name of the produced image.
+func NewVHDX(buildPipeline Build, imgPipeline FilePipeline) *VHDX {
+	p := &VHDX{
+		Base:        NewBase("vhdx", buildPipeline),
+		imgPipeline: imgPipeline,
+		filename:    "image.vhdx",
+	}
+	// See similar logic in qcow2 to run on the host
+	if buildPipeline != nil {
+		buildPipeline.addDependent(p)
+	} else {
+		imgPipeline.Manifest().addPipeline(p)
+	}
+	return p
+}
+
+func (p *VHDX) serialize() (osbuild.Pipeline, error) {
+	pipeline, err := p.Base.serialize()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+
+	pipeline.AddStage(osbuild.NewQEMUStage(
+		osbuild.NewQEMUStageOptions(p.Filename(), osbuild.QEMUFormatVHDX, nil),
+		osbuild.NewQemuStagePipelineFilesInputs(p.imgPipeline.Name(), p.imgPipeline.Filename()),
+	))
+
+	return pipeline, nil
+}
+
+func (p *VHDX) getBuildPackages(Distro) ([]string, error) {
+	return []string{"qemu-img"}, nil
+}
+
+func (p *VHDX) Export() *artifact.Artifact {
+	p.Base.export = true
+	mimeType := "application/x-vhdx"
+	return artifact.New(p.Name(), p.Filename(), &mimeType)
+}
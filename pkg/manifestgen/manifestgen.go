@@ -14,10 +14,12 @@ import (
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/buildpolicy"
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/depsolvednf"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/flatpak"
+	"github.com/osbuild/images/pkg/lockfile"
 	"github.com/osbuild/images/pkg/manifest"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/ostree"
@@ -29,11 +31,20 @@ import (
 
 const (
 	defaultDepsolverSBOMType = sbom.StandardTypeSpdx
-	defaultSBOMExt           = "spdx.json"
 
 	defaultDepsolveCacheDir = "osbuild-depsolve-dnf"
 )
 
+// sbomExt returns the file extension for SBOM documents of the given type.
+func sbomExt(docType sbom.StandardType) string {
+	switch docType {
+	case sbom.StandardTypeCycloneDX:
+		return "cdx.json"
+	default:
+		return "spdx.json"
+	}
+}
+
 var (
 	ErrContainerArchMismatch = errors.New("requested container architecture does not match resolved container")
 )
@@ -55,6 +66,11 @@ type Options struct {
 	// content can be read
 	SBOMWriter SBOMWriterFunc
 
+	// SBOMType selects the standard of the generated SBOMs, if
+	// unset SPDX documents are generated, or CycloneDX documents
+	// when a Lockfile is used.
+	SBOMType sbom.StandardType
+
 	// WarningsOutput will receive any warnings that are part of
 	// the manifest generation. If it is unset any warnings will
 	// generate an error.
@@ -65,6 +81,11 @@ type Options struct {
 	// on the default stdout/stderr.
 	DepsolveWarningsOutput io.Writer
 
+	// PersistentDepsolveCache keeps the depsolve results in the
+	// Cachedir and reuses them for identical requests until the
+	// repository metadata changes.
+	PersistentDepsolveCache bool
+
 	// CustomSeed overrides the default rng seed, this is mostly
 	// useful for testing
 	CustomSeed *int64
@@ -85,6 +106,30 @@ type Options struct {
 	UseBootstrapContainer bool
 
 	RPMListWriter RPMListWriterFunc
+
+	// Policy is checked before the manifest is generated, a
+	// blueprint that violates it results in a *buildpolicy.Error.
+	Policy *buildpolicy.Policy
+
+	// Lockfile is used instead of depsolving and resolving, the
+	// manifest is generated with the locked packages, containers,
+	// ostree commits and flatpaks. Generation fails with
+	// lockfile.ErrUnsatisfied if the package requests or sources
+	// of the image are not satisfied by the lockfile, and with
+	// lockfile.ErrUnavailable if a locked container or commit
+	// cannot be fetched anymore. The SBOMs are CycloneDX
+	// documents of the locked packages, SPDX documents need the
+	// depsolver.
+	Lockfile *lockfile.Lockfile
+
+	// LockVerifier checks that the locked containers and commits
+	// can still be fetched, defaults to lockfile.RemoteVerifier.
+	LockVerifier lockfile.Verifier
+
+	// LockfileWriter will be called with the lockfile of the
+	// depsolved packages and resolved sources of the generated
+	// manifest.
+	LockfileWriter LockfileWriterFunc
 }
 
 // Generator can generate an osbuild manifest from a given repository
@@ -97,9 +142,12 @@ type Generator struct {
 	commitResolver         CommitResolverFunc
 	flatpakResolver        FlatpakResolverFunc
 	sbomWriter             SBOMWriterFunc
+	sbomType               sbom.StandardType
 	warningsOutput         io.Writer
 	depsolveWarningsOutput io.Writer
 
+	persistentDepsolveCache bool
+
 	reporegistry *reporegistry.RepoRegistry
 
 	rpmDownloader osbuild.RpmDownloader
@@ -109,6 +157,10 @@ type Generator struct {
 
 	useBootstrapContainer bool
 	rpmlistWriter         RPMListWriterFunc
+	policy                *buildpolicy.Policy
+	lockfile              *lockfile.Lockfile
+	lockVerifier          lockfile.Verifier
+	lockfileWriter        LockfileWriterFunc
 }
 
 // New will create a new manifest generator
@@ -119,22 +171,37 @@ func New(reporegistry *reporegistry.RepoRegistry, opts *Options) (*Generator, er
 	mg := &Generator{
 		reporegistry: reporegistry,
 
-		cacheDir:               opts.Cachedir,
-		depsolve:               opts.Depsolve,
-		containerResolver:      opts.ContainerResolver,
-		commitResolver:         opts.CommitResolver,
-		rpmDownloader:          opts.RpmDownloader,
-		sbomWriter:             opts.SBOMWriter,
-		warningsOutput:         opts.WarningsOutput,
-		depsolveWarningsOutput: opts.DepsolveWarningsOutput,
-		customSeed:             opts.CustomSeed,
-		overrideRepos:          opts.OverrideRepos,
-		useBootstrapContainer:  opts.UseBootstrapContainer,
-		rpmlistWriter:          opts.RPMListWriter,
+		cacheDir:                opts.Cachedir,
+		depsolve:                opts.Depsolve,
+		containerResolver:       opts.ContainerResolver,
+		commitResolver:          opts.CommitResolver,
+		rpmDownloader:           opts.RpmDownloader,
+		sbomWriter:              opts.SBOMWriter,
+		sbomType:                opts.SBOMType,
+		warningsOutput:          opts.WarningsOutput,
+		depsolveWarningsOutput:  opts.DepsolveWarningsOutput,
+		persistentDepsolveCache: opts.PersistentDepsolveCache,
+		customSeed:              opts.CustomSeed,
+		overrideRepos:           opts.OverrideRepos,
+		useBootstrapContainer:   opts.UseBootstrapContainer,
+		rpmlistWriter:           opts.RPMListWriter,
+		policy:                  opts.Policy,
+		lockfile:                opts.Lockfile,
+		lockVerifier:            opts.LockVerifier,
+		lockfileWriter:          opts.LockfileWriter,
 	}
 	if mg.depsolve == nil {
 		mg.depsolve = DefaultDepsolve
 	}
+	if mg.sbomType == sbom.StandardTypeNone {
+		mg.sbomType = defaultDepsolverSBOMType
+		if mg.lockfile != nil {
+			mg.sbomType = sbom.StandardTypeCycloneDX
+		}
+	}
+	if mg.lockfile != nil && mg.sbomWriter != nil && mg.sbomType != sbom.StandardTypeCycloneDX {
+		return nil, fmt.Errorf("cannot generate %s SBOMs from a lockfile, only %s", mg.sbomType, sbom.StandardTypeCycloneDX)
+	}
 	if mg.containerResolver == nil {
 		mg.containerResolver = func(containerSources map[string][]container.SourceSpec, archName string) (map[string][]container.Spec, error) {
 			return container.NewBlockingResolver(archName).ResolveAll(containerSources)
@@ -146,6 +213,9 @@ func New(reporegistry *reporegistry.RepoRegistry, opts *Options) (*Generator, er
 	if mg.flatpakResolver == nil {
 		mg.flatpakResolver = flatpak.ResolveAll
 	}
+	if mg.lockVerifier == nil {
+		mg.lockVerifier = lockfile.RemoteVerifier
+	}
 	if mg.cacheDir == "" {
 		xdgCacheHomeDir, err := xdgCacheHome()
 		if err != nil {
@@ -177,6 +247,11 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 			return nil, err
 		}
 	}
+	if mg.policy != nil {
+		if err := mg.policy.Check(bp, imgType, repos); err != nil {
+			return nil, err
+		}
+	}
 	// To support "user" a.k.a. "3rd party" repositories, these
 	// will have to be added to the repos with
 	// <repo_item>.PackageSets set to the "payload" pipeline names
@@ -197,29 +272,12 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 	if err != nil {
 		return nil, err
 	}
-	solver := depsolvednf.NewSolver(dist.ModulePlatformID(), dist.Releasever(), a.Name(), dist.Name(), mg.cacheDir)
-	if dd, ok := dist.(distro.CustomDepsolverDistro); ok {
-		// XXX: it would be nice to have access to arch.Arch
-		// from distro.Arch but we dont so we have to do without.
-		archi := common.Must(arch.FromString(a.Name()))
-		customSolver, cleanupFunc, err := dd.Depsolver(mg.cacheDir, archi)
-		if err != nil {
-			return nil, err
-		}
-		if customSolver != nil {
-			solver = customSolver
-		}
-		defer func() {
-			if err := cleanupFunc(); err != nil {
-				fmt.Fprintf(mg.warningsOutput, "WARNING: cleanup failed: %v\n", err)
-			}
-		}()
-	}
-	depsolved, err := mg.depsolve(solver, mg.cacheDir, mg.depsolveWarningsOutput, pkgSetChains, dist, a.Name())
+	depsolved, err := mg.depsolvePackageSets(pkgSetChains, imgType)
 	if err != nil {
 		return nil, err
 	}
-	containerSpecs, err := mg.containerResolver(preManifest.GetContainerSourceSpecs(), a.Name())
+	containerSources := preManifest.GetContainerSourceSpecs()
+	containerSpecs, err := mg.resolveContainers(containerSources, a.Name())
 	if err != nil {
 		return nil, err
 	}
@@ -231,16 +289,43 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 		}
 	}
 
-	commitSpecs, err := mg.commitResolver(preManifest.GetOSTreeSourceSpecs())
+	commitSources := preManifest.GetOSTreeSourceSpecs()
+	commitSpecs, err := mg.resolveCommits(commitSources)
 	if err != nil {
 		return nil, err
 	}
 
-	flatpakSpecs, err := mg.flatpakResolver(preManifest.GetFlatpakSourceSpecs())
+	flatpakSources := preManifest.GetFlatpakSourceSpecs()
+	flatpakSpecs, err := mg.resolveFlatpaks(flatpakSources)
 	if err != nil {
 		return nil, err
 	}
 
+	// XXX: sync with image-builder-cli:build.go name generation - can we have a shared helper?
+	imageName := fmt.Sprintf("%s-%s-%s", dist.Name(), imgType.Name(), a.Name())
+	if mg.lockfileWriter != nil {
+		lf, err := lockfile.New(dist.Name(), a.Name(), imgType.Name(), pkgSetChains, depsolved)
+		if err != nil {
+			return nil, err
+		}
+		if err := lf.LockContainers(containerSources, containerSpecs); err != nil {
+			return nil, err
+		}
+		if err := lf.LockCommits(commitSources, commitSpecs); err != nil {
+			return nil, err
+		}
+		if err := lf.LockFlatpaks(flatpakSources, flatpakSpecs); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := lf.Write(&buf); err != nil {
+			return nil, err
+		}
+		if err := mg.lockfileWriter(imageName+".lock.json", &buf); err != nil {
+			return nil, err
+		}
+	}
+
 	opts := &manifest.SerializeOptions{
 		RpmDownloader: mg.rpmDownloader,
 	}
@@ -263,10 +348,11 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 			case slices.Contains(preManifest.BuildPipelines(), plName):
 				pipelinePurpose = "buildroot"
 			}
-			// XXX: sync with image-builder-cli:build.go name generation - can we have a shared helper?
-			imageName := fmt.Sprintf("%s-%s-%s", dist.Name(), imgType.Name(), a.Name())
 			if mg.sbomWriter != nil {
-				sbomDocOutputFilename := fmt.Sprintf("%s.%s-%s.%s", imageName, pipelinePurpose, plName, defaultSBOMExt)
+				if depsolvedPipeline.SBOM == nil {
+					return nil, fmt.Errorf("no SBOM for pipeline %q", plName)
+				}
+				sbomDocOutputFilename := fmt.Sprintf("%s.%s-%s.%s", imageName, pipelinePurpose, plName, sbomExt(depsolvedPipeline.SBOM.DocType))
 				var buf bytes.Buffer
 				enc := json.NewEncoder(&buf)
 				if err := enc.Encode(depsolvedPipeline.SBOM.Document); err != nil {
@@ -292,6 +378,68 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 	return mf, nil
 }
 
+// depsolvePackageSets returns the packages of the package set chains,
+// from the lockfile if there is one or from the depsolver.
+func (mg *Generator) depsolvePackageSets(pkgSetChains map[string][]rpmmd.PackageSet, imgType distro.ImageType) (map[string]depsolvednf.DepsolveResult, error) {
+	a := imgType.Arch()
+	dist := a.Distro()
+	if mg.lockfile != nil {
+		if err := mg.lockfile.Check(dist.Name(), a.Name(), imgType.Name()); err != nil {
+			return nil, err
+		}
+		return mg.lockfile.Resolve(pkgSetChains, mg.sbomType)
+	}
+
+	solver := depsolvednf.NewSolver(dist.ModulePlatformID(), dist.Releasever(), a.Name(), dist.Name(), mg.cacheDir)
+	if dd, ok := dist.(distro.CustomDepsolverDistro); ok {
+		// XXX: it would be nice to have access to arch.Arch
+		// from distro.Arch but we dont so we have to do without.
+		archi := common.Must(arch.FromString(a.Name()))
+		customSolver, cleanupFunc, err := dd.Depsolver(mg.cacheDir, archi)
+		if err != nil {
+			return nil, err
+		}
+		if customSolver != nil {
+			solver = customSolver
+		}
+		defer func() {
+			if err := cleanupFunc(); err != nil {
+				fmt.Fprintf(mg.warningsOutput, "WARNING: cleanup failed: %v\n", err)
+			}
+		}()
+	}
+	solver.SetSBOMType(mg.sbomType)
+	solver.SetPersistentResultCache(mg.persistentDepsolveCache)
+	return mg.depsolve(solver, mg.cacheDir, mg.depsolveWarningsOutput, pkgSetChains, dist, a.Name())
+}
+
+// resolveContainers returns the container specs of the container sources,
+// from the lockfile if there is one or from the container resolver.
+func (mg *Generator) resolveContainers(sources map[string][]container.SourceSpec, archName string) (map[string][]container.Spec, error) {
+	if mg.lockfile != nil {
+		return mg.lockfile.ResolveContainers(sources, mg.lockVerifier)
+	}
+	return mg.containerResolver(sources, archName)
+}
+
+// resolveCommits returns the ostree commits of the commit sources, from the
+// lockfile if there is one or from the commit resolver.
+func (mg *Generator) resolveCommits(sources map[string][]ostree.SourceSpec) (map[string][]ostree.CommitSpec, error) {
+	if mg.lockfile != nil {
+		return mg.lockfile.ResolveCommits(sources, mg.lockVerifier)
+	}
+	return mg.commitResolver(sources)
+}
+
+// resolveFlatpaks returns the flatpak specs of the flatpak sources, from
+// the lockfile if there is one or from the flatpak resolver.
+func (mg *Generator) resolveFlatpaks(sources map[string][]flatpak.SourceSpec) (map[string][]flatpak.Spec, error) {
+	if mg.lockfile != nil {
+		return mg.lockfile.ResolveFlatpaks(sources, mg.lockVerifier)
+	}
+	return mg.flatpakResolver(sources)
+}
+
 func addUniquePackagesFromPipeline(unique map[string]rpmmd.Package, pipeline depsolvednf.DepsolveResult) {
 	for _, pkg := range pipeline.Transactions.AllPackages() {
 		var key string
@@ -342,12 +490,13 @@ func DefaultDepsolve(solver *depsolvednf.Solver, cacheDir string, depsolveWarnin
 		solver.Stderr = depsolveWarningsOutput
 	}
 
-	// Always generate Spdx SBOMs for now, this makes the
-	// default depsolve slightly slower but it means we
-	// need no extra argument here to select the SBOM
-	// type. Once we have more types than Spdx of course
-	// we need to add a option to select the type.
-	solver.SetSBOMType(sbom.StandardTypeSpdx)
+	// Always generate SBOMs, this makes the default depsolve
+	// slightly slower but it means we need no extra argument
+	// here to select the SBOM type. The type is set on the
+	// solver by the Generator (Options.SBOMType).
+	if solver.SBOMType() == sbom.StandardTypeNone {
+		solver.SetSBOMType(defaultDepsolverSBOMType)
+	}
 	return solver.DepsolveAll(packageSets)
 }
 
@@ -363,4 +512,6 @@ type (
 	SBOMWriterFunc func(filename string, content io.Reader, docType sbom.StandardType) error
 
 	RPMListWriterFunc func(filename string, content io.Reader) error
+
+	LockfileWriterFunc func(filename string, content io.Reader) error
 )
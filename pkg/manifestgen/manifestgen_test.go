@@ -16,11 +16,13 @@ import (
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/buildpolicy"
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/depsolvednf"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distrofactory"
 	"github.com/osbuild/images/pkg/imagefilter"
+	"github.com/osbuild/images/pkg/lockfile"
 	"github.com/osbuild/images/pkg/manifestgen"
 	"github.com/osbuild/images/pkg/manifestgen/manifestmock"
 	"github.com/osbuild/images/pkg/osbuild"
@@ -268,6 +270,60 @@ func TestManifestGeneratorDepsolveWithSbomWriter(t *testing.T) {
 	assert.Equal(t, expected, generatedSboms)
 }
 
+func TestManifestGeneratorDepsolveWithCycloneDXSbomWriter(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+	fac := distrofactory.NewDefault()
+
+	filter, err := imagefilter.New(fac, repos)
+	assert.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+
+	generatedSboms := map[string]string{}
+	opts := &manifestgen.Options{
+		Depsolve: func(solver *depsolvednf.Solver, cacheDir string, depsolveWarningsOutput io.Writer, packageSets map[string][]rpmmd.PackageSet, d distro.Distro, arch string) (map[string]depsolvednf.DepsolveResult, error) {
+			assert.Equal(t, sbom.StandardTypeCycloneDX, solver.SBOMType())
+			depsolvedSets, err := manifestmock.Depsolve(packageSets, arch, nil, false)
+			if err != nil {
+				return nil, err
+			}
+			for name, result := range depsolvedSets {
+				result.SBOM, err = sbom.NewCycloneDXDocument(result.Transactions.AllPackages(), d.Name())
+				if err != nil {
+					return nil, err
+				}
+				depsolvedSets[name] = result
+			}
+			return depsolvedSets, nil
+		},
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+
+		SBOMType: sbom.StandardTypeCycloneDX,
+		SBOMWriter: func(filename string, content io.Reader, docType sbom.StandardType) error {
+			assert.Equal(t, sbom.StandardTypeCycloneDX, docType)
+
+			b, err := io.ReadAll(content)
+			assert.NoError(t, err)
+			generatedSboms[filename] = strings.TrimSpace(string(b))
+			return nil
+		},
+	}
+	mg, err := manifestgen.New(repos, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, mg)
+	var bp blueprint.Blueprint
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	require.NoError(t, err)
+
+	require.Contains(t, generatedSboms, "centos-9-qcow2-x86_64.buildroot-build.cdx.json")
+	require.Contains(t, generatedSboms, "centos-9-qcow2-x86_64.image-os.cdx.json")
+	assert.Contains(t, generatedSboms["centos-9-qcow2-x86_64.image-os.cdx.json"], `"bomFormat":"CycloneDX"`)
+	assert.Contains(t, generatedSboms["centos-9-qcow2-x86_64.image-os.cdx.json"], `"purl":"pkg:rpm/centos/`)
+}
+
 func TestManifestGeneratorWithRPMListWriter(t *testing.T) {
 	repos, err := testrepos.New()
 	assert.NoError(t, err)
@@ -449,3 +505,250 @@ func TestManifestGeneratorUseBootstrapContainer(t *testing.T) {
 		})
 	}
 }
+
+func TestManifestGeneratorPolicy(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+	fac := distrofactory.NewDefault()
+
+	filter, err := imagefilter.New(fac, repos)
+	assert.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+
+	opts := &manifestgen.Options{
+		Depsolve: fakeDepsolve,
+		Policy: &buildpolicy.Policy{
+			ForbiddenPackages: []string{"telnet*"},
+		},
+	}
+	mg, err := manifestgen.New(repos, opts)
+	assert.NoError(t, err)
+
+	var bp blueprint.Blueprint
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	assert.NoError(t, err)
+
+	bp.Packages = []blueprint.Package{{Name: "telnet-server"}}
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	var policyErr *buildpolicy.Error
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, []buildpolicy.Violation{
+		{Rule: buildpolicy.RuleForbiddenPackages, Message: `package "telnet-server" is forbidden ("telnet*")`},
+	}, policyErr.Violations)
+}
+
+func TestManifestGeneratorSourceDateEpoch(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+	fac := distrofactory.NewDefault()
+	filter, err := imagefilter.New(fac, repos)
+	assert.NoError(t, err)
+
+	opts := &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    fakeCommitResolver,
+		ContainerResolver: fakeContainerResolver,
+	}
+	mg, err := manifestgen.New(repos, opts)
+	assert.NoError(t, err)
+
+	for _, imgTypeName := range []string{"qcow2", "tar", "image-installer", "edge-commit", "container"} {
+		t.Run(imgTypeName, func(t *testing.T) {
+			res, err := filter.Filter("distro:centos-9", "type:"+imgTypeName, "arch:x86_64")
+			require.NoError(t, err)
+			require.Equal(t, 1, len(res))
+
+			imgOpts := &distro.ImageOptions{SourceDateEpoch: common.ToPtr(int64(1700000000))}
+			var bp blueprint.Blueprint
+			osbuildManifest, err := mg.Generate(&bp, res[0].ImgType, imgOpts)
+			require.NoError(t, err)
+
+			var mf struct {
+				Pipelines []struct {
+					Name        string `json:"name"`
+					SourceEpoch *int64 `json:"source-epoch"`
+					Stages      []struct {
+						Type    string         `json:"type"`
+						Options map[string]any `json:"options"`
+					} `json:"stages"`
+				} `json:"pipelines"`
+			}
+			require.NoError(t, json.Unmarshal(osbuildManifest, &mf))
+			for _, pl := range mf.Pipelines {
+				// osbuild exports the epoch of the pipeline as
+				// SOURCE_DATE_EPOCH to all of its stages
+				require.NotNil(t, pl.SourceEpoch, pl.Name)
+				assert.Equal(t, int64(1700000000), *pl.SourceEpoch, pl.Name)
+				if pl.Name != "os" {
+					continue
+				}
+				// the machine-id generated while installing the packages
+				// is random, it must be reset
+				var firstBoot []any
+				for _, stage := range pl.Stages {
+					if stage.Type == "org.osbuild.machine-id" {
+						firstBoot = append(firstBoot, stage.Options["first-boot"])
+					}
+				}
+				assert.Equal(t, []any{"yes"}, firstBoot)
+			}
+		})
+	}
+}
+
+// fakeLockVerifier records the verified containers and commits, they are
+// unavailable if set
+type fakeLockVerifier struct {
+	unavailable bool
+	verified    []string
+}
+
+func (v *fakeLockVerifier) check(id string) error {
+	v.verified = append(v.verified, id)
+	if v.unavailable {
+		return fmt.Errorf("%s not found", id)
+	}
+	return nil
+}
+
+func (v *fakeLockVerifier) VerifyContainer(spec container.Spec) error {
+	return v.check(spec.Digest)
+}
+
+func (v *fakeLockVerifier) VerifyCommit(source ostree.SourceSpec, commit ostree.CommitSpec) error {
+	return v.check(commit.Checksum)
+}
+
+func TestManifestGeneratorLockfile(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+	fac := distrofactory.NewDefault()
+
+	filter, err := imagefilter.New(fac, repos)
+	assert.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+
+	generated := map[string][]byte{}
+	opts := &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    fakeCommitResolver,
+		ContainerResolver: fakeContainerResolver,
+		LockfileWriter: func(filename string, content io.Reader) error {
+			b, err := io.ReadAll(content)
+			assert.NoError(t, err)
+			generated[filename] = b
+			return nil
+		},
+	}
+	mg, err := manifestgen.New(repos, opts)
+	require.NoError(t, err)
+	containerSource := "registry.example.com/app:latest"
+	bp := blueprint.Blueprint{
+		Containers: []blueprint.Container{{Source: containerSource}},
+	}
+	lockedManifest, err := mg.Generate(&bp, res[0].ImgType, nil)
+	require.NoError(t, err)
+	require.Contains(t, generated, "centos-9-qcow2-x86_64.lock.json")
+
+	lf, err := lockfile.Parse(bytes.NewReader(generated["centos-9-qcow2-x86_64.lock.json"]))
+	require.NoError(t, err)
+	require.Len(t, lf.Containers["os"], 1)
+	assert.Equal(t, containerSource, lf.Containers["os"][0].Ref)
+
+	verifier := &fakeLockVerifier{}
+	opts = &manifestgen.Options{
+		Depsolve: func(*depsolvednf.Solver, string, io.Writer, map[string][]rpmmd.PackageSet, distro.Distro, string) (map[string]depsolvednf.DepsolveResult, error) {
+			return nil, fmt.Errorf("depsolve must not be called")
+		},
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+		Lockfile:          lf,
+		LockVerifier:      verifier,
+	}
+	mg, err = manifestgen.New(repos, opts)
+	require.NoError(t, err)
+	manifest, err := mg.Generate(&bp, res[0].ImgType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, string(lockedManifest), string(manifest))
+	assert.Equal(t, []string{lf.Containers["os"][0].Digest}, verifier.verified)
+
+	verifier.unavailable = true
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	assert.ErrorIs(t, err, lockfile.ErrUnavailable)
+	assert.ErrorContains(t, err, "container "+containerSource)
+	verifier.unavailable = false
+
+	bp.Containers = []blueprint.Container{{Source: "registry.example.com/app:v2"}}
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	assert.ErrorIs(t, err, lockfile.ErrUnsatisfied)
+	assert.ErrorContains(t, err, "container registry.example.com/app:v2 is not locked")
+
+	bp.Containers = nil
+	bp.Packages = []blueprint.Package{{Name: "tmux"}}
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	assert.ErrorIs(t, err, lockfile.ErrUnsatisfied)
+	assert.ErrorContains(t, err, "missing tmux")
+
+	res, err = filter.Filter("distro:centos-9", "type:ami", "arch:x86_64")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	_, err = mg.Generate(&blueprint.Blueprint{}, res[0].ImgType, nil)
+	assert.ErrorIs(t, err, lockfile.ErrMismatch)
+}
+
+func TestManifestGeneratorLockfileSBOM(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+	fac := distrofactory.NewDefault()
+
+	filter, err := imagefilter.New(fac, repos)
+	assert.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+
+	var lockfileContent []byte
+	mg, err := manifestgen.New(repos, &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    fakeCommitResolver,
+		ContainerResolver: fakeContainerResolver,
+		LockfileWriter: func(filename string, content io.Reader) error {
+			lockfileContent, err = io.ReadAll(content)
+			return err
+		},
+	})
+	require.NoError(t, err)
+	_, err = mg.Generate(&blueprint.Blueprint{}, res[0].ImgType, nil)
+	require.NoError(t, err)
+	lf, err := lockfile.Parse(bytes.NewReader(lockfileContent))
+	require.NoError(t, err)
+
+	// the SBOMs are generated from the locked packages
+	generated := map[string]sbom.StandardType{}
+	opts := &manifestgen.Options{
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+		Lockfile:          lf,
+		LockVerifier:      &fakeLockVerifier{},
+		SBOMWriter: func(filename string, content io.Reader, docType sbom.StandardType) error {
+			generated[filename] = docType
+			return nil
+		},
+	}
+	mg, err = manifestgen.New(repos, opts)
+	require.NoError(t, err)
+	_, err = mg.Generate(&blueprint.Blueprint{}, res[0].ImgType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]sbom.StandardType{
+		"centos-9-qcow2-x86_64.buildroot-build.cdx.json": sbom.StandardTypeCycloneDX,
+		"centos-9-qcow2-x86_64.image-os.cdx.json":        sbom.StandardTypeCycloneDX,
+	}, generated)
+
+	opts.SBOMType = sbom.StandardTypeSpdx
+	_, err = manifestgen.New(repos, opts)
+	assert.EqualError(t, err, "cannot generate spdx SBOMs from a lockfile, only cyclonedx")
+}
@@ -125,7 +125,19 @@ func genMountsForBootupd(source string, pt *disk.PartitionTable) ([]Mount, error
 					return nil, fmt.Errorf("expected LV payload %+[1]v to be mountable or swap, got %[1]T", lv.Payload)
 				}
 			}
-		case *disk.Swap, *disk.Raw:
+		case *disk.Verity:
+			// the data device is used directly during the build
+			mountable, ok := payload.Payload.(disk.Mountable)
+			if !ok {
+				return nil, fmt.Errorf("expected verity payload %+[1]v to be mountable, got %[1]T", payload.Payload)
+			}
+			mount, err := genOsbuildMount(source, mountable)
+			if err != nil {
+				return nil, err
+			}
+			mount.Partition = common.ToPtr(idx + 1)
+			mounts = append(mounts, *mount)
+		case *disk.Swap, *disk.Raw, *disk.VerityHash:
 			// nothing to do
 		default:
 			return nil, fmt.Errorf("type %T not supported by bootupd handling yet", part.Payload)
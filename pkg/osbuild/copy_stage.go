@@ -2,6 +2,9 @@ package osbuild
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/osbuild/images/pkg/disk"
 )
@@ -20,6 +23,11 @@ type CopyStagePath struct {
 	// Remove the destination before copying. Works only for files, not directories.
 	// Default: false
 	RemoveDestination bool `json:"remove_destination,omitempty"`
+
+	// Paths, relative to From, that are not copied. This is not supported
+	// by the upstream osbuild copy stage yet and needs a matching change
+	// there.
+	Exclude []string `json:"exclude,omitempty"`
 }
 
 func (CopyStageOptions) isStageOptions() {}
@@ -66,14 +74,100 @@ func GenCopyFSTreeOptions(inputName, inputPipeline, filename string, pt *disk.Pa
 		panic(err)
 	}
 
+	// Read-only filesystems are generated from the tree when the image is
+	// prepared and cannot be written to, so they are not mounted for the
+	// copy and their content is excluded from it. Otherwise it would end
+	// up in the parent filesystem, hidden by the mount at runtime.
+	var readOnly []string
+	mounts = slices.DeleteFunc(mounts, func(mnt Mount) bool {
+		if !isReadOnlyMount(mnt) {
+			return false
+		}
+		if mnt.Name == fsRootMntName {
+			panic(fmt.Sprintf("cannot copy the tree onto a read-only root filesystem (%s)", mnt.Type))
+		}
+		readOnly = append(readOnly, mnt.Target)
+		return true
+	})
+
 	options := CopyStageOptions{
 		Paths: []CopyStagePath{
 			{
-				From: fmt.Sprintf("input://%s/", inputName),
-				To:   fmt.Sprintf("mount://%s/", fsRootMntName),
+				From:    fmt.Sprintf("input://%s/", inputName),
+				To:      fmt.Sprintf("mount://%s/", fsRootMntName),
+				Exclude: excludedSubtrees("/", readOnly),
 			},
 		},
 	}
 
 	return &options, devices, mounts
 }
+
+// GenCopyDataFSTreeOptions creates the options, devices, and mounts
+// properties for an org.osbuild.copy stage that copies the parts of a source
+// tree that belong on a data disk, i.e. a disk without the root filesystem.
+// The content of the tree under each top level mountpoint of the partition
+// table is copied onto the respective filesystem.
+func GenCopyDataFSTreeOptions(inputName, filename string, pt *disk.PartitionTable) (
+	*CopyStageOptions,
+	map[string]Device,
+	[]Mount,
+) {
+	fsRootMntName, mounts, devices, err := genMountsDevicesFromPT(filename, pt)
+	if err != nil {
+		panic(err)
+	}
+	if fsRootMntName != "" {
+		panic("the partition table of a data disk cannot contain the root filesystem; this is a programming error")
+	}
+	if len(mounts) == 0 {
+		panic("the partition table of a data disk has no filesystems; this is a programming error")
+	}
+
+	// see GenCopyFSTreeOptions()
+	var readOnly []string
+	mounts = slices.DeleteFunc(mounts, func(mnt Mount) bool {
+		if !isReadOnlyMount(mnt) {
+			return false
+		}
+		readOnly = append(readOnly, mnt.Target)
+		return true
+	})
+
+	var options CopyStageOptions
+	// the mounts are sorted so parents always come before their children
+	var topLevel []string
+	for _, mnt := range mounts {
+		if slices.ContainsFunc(topLevel, func(parent string) bool {
+			return strings.HasPrefix(mnt.Target, parent+"/")
+		}) {
+			continue
+		}
+		topLevel = append(topLevel, mnt.Target)
+		options.Paths = append(options.Paths, CopyStagePath{
+			From:    fmt.Sprintf("input://%s%s/", inputName, mnt.Target),
+			To:      fmt.Sprintf("mount://%s/", mnt.Name),
+			Exclude: excludedSubtrees(mnt.Target, readOnly),
+		})
+	}
+
+	return &options, devices, mounts
+}
+
+func isReadOnlyMount(mnt Mount) bool {
+	return mnt.Type == "org.osbuild.erofs" || mnt.Type == "org.osbuild.squashfs"
+}
+
+// excludedSubtrees returns the mountpoints below parent, relative to parent,
+// so they can be excluded from a copy of the tree under parent.
+func excludedSubtrees(parent string, mountpoints []string) []string {
+	var subtrees []string
+	for _, mountpoint := range mountpoints {
+		rel, err := filepath.Rel(parent, mountpoint)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		subtrees = append(subtrees, rel)
+	}
+	return subtrees
+}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/disk"
 )
 
 func TestNewCopyStage(t *testing.T) {
@@ -67,3 +69,71 @@ func TestNewCopyStageSimpleSourcesInputs(t *testing.T) {
 	actualStage := NewCopyStageSimple(&CopyStageOptions{paths}, &filesInputs)
 	assert.Equal(t, expectedStage, actualStage)
 }
+
+func TestGenCopyFSTreeOptionsSkipsReadOnly(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{Type: "ext4", Mountpoint: "/"},
+			},
+			{
+				Payload: &disk.Filesystem{Type: "erofs", Mountpoint: "/usr"},
+			},
+		},
+	}
+	options, devices, mounts := GenCopyFSTreeOptions("tree", "os", "disk.img", pt)
+	assert.Equal(t, []CopyStagePath{{From: "input://tree/", To: "mount://-/", Exclude: []string{"usr"}}}, options.Paths)
+	assert.Equal(t, []Mount{*NewExt4Mount("-", "-", "/")}, mounts)
+	assert.Len(t, devices, 2)
+
+	pt.Partitions[0].Payload = &disk.Filesystem{Type: "squashfs", Mountpoint: "/"}
+	assert.PanicsWithValue(t, "cannot copy the tree onto a read-only root filesystem (org.osbuild.squashfs)", func() {
+		GenCopyFSTreeOptions("tree", "os", "disk.img", pt)
+	})
+}
+
+func TestGenCopyDataFSTreeOptions(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/data"},
+			},
+			{
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/data/logs"},
+			},
+			{
+				Payload: &disk.Filesystem{Type: "ext4", Mountpoint: "/srv"},
+			},
+			{
+				Payload: &disk.Filesystem{Type: "erofs", Mountpoint: "/srv/static"},
+			},
+		},
+	}
+	options, devices, mounts := GenCopyDataFSTreeOptions("tree", "data0.img", pt)
+	assert.Equal(t, []CopyStagePath{
+		{From: "input://tree/data/", To: "mount://data/"},
+		{From: "input://tree/srv/", To: "mount://srv/", Exclude: []string{"static"}},
+	}, options.Paths)
+	assert.Equal(t, []Mount{
+		*NewXfsMount("data", "data", "/data"),
+		*NewXfsMount("data-logs", "data-logs", "/data/logs"),
+		*NewExt4Mount("srv", "srv", "/srv"),
+	}, mounts)
+	assert.Len(t, devices, 4)
+}
+
+func TestGenCopyDataFSTreeOptionsWithRoot(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{Type: "ext4", Mountpoint: "/"},
+			},
+		},
+	}
+	assert.PanicsWithValue(t, "the partition table of a data disk cannot contain the root filesystem; this is a programming error", func() {
+		GenCopyDataFSTreeOptions("tree", "data0.img", pt)
+	})
+}
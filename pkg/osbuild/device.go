@@ -7,6 +7,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/osbuild/images/pkg/datasizes"
 	"github.com/osbuild/images/pkg/disk"
 )
 
@@ -87,6 +88,33 @@ func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage
 				}, stageDevices)
 
 			stages = append(stages, stage)
+
+		case *disk.MDRaid:
+			// do not include us when getting the devices
+			stageDevices, lastName := getDevices(path[:len(path)-1], filename, true)
+
+			// the array is created on the partition holding it and on the
+			// partitions of the other member devices on the member disks,
+			// in order
+			memberDevices := []string{lastName}
+			for idx, member := range pt.MDRaidMembers(ent.Name)[1:] {
+				name := deviceName(member.Payload)
+				stageDevices[name] = partitionLoopbackDevice(pt.MDRaidMemberDisks[idx], member, MDRaidMemberDiskFilename(filename, idx), true)
+				memberDevices = append(memberDevices, name)
+			}
+
+			options := &MDAdmCreateStageOptions{
+				Name:        ent.Name,
+				UUID:        ent.UUID,
+				Level:       ent.GetLevel(),
+				RaidDevices: ent.GetDevices(),
+				Devices:     memberDevices,
+				Metadata:    ent.GetMetadata(),
+			}
+			if options.Metadata == "1.2" {
+				options.DataOffset = fmt.Sprintf("%dK", ent.MetadataSize()/datasizes.KiB)
+			}
+			stages = append(stages, NewMDAdmCreateStage(options, stageDevices))
 		}
 
 		return nil
@@ -96,9 +124,25 @@ func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage
 	return stages
 }
 
-func GenDeviceFinishStages(pt *disk.PartitionTable, filename string) []*Stage {
+// VerityKernelCmdline describes where the root hashes of the verity
+// protected "/" and "/usr" filesystems are added to the kernel command line.
+// Paths are in the tree of the image.
+type VerityKernelCmdline struct {
+	// Directory with the boot loader entries
+	BootEntries string
+
+	// UKI addon that is created with the command line
+	UKIAddon string
+}
+
+// GenDeviceFinishStages generates the stages that finalize the devices of
+// the partition table, after the content is written. If cmdline is not nil,
+// the root hashes of the verity protected "/" and "/usr" filesystems are
+// added to the kernel command line as described by it.
+func GenDeviceFinishStages(pt *disk.PartitionTable, filename string, cmdline *VerityKernelCmdline) ([]*Stage, error) {
 	stages := make([]*Stage, 0)
 	removeKeyStages := make([]*Stage, 0)
+	verityStages := make([]*Stage, 0)
 
 	genStages := func(e disk.Entity, path []disk.Entity) error {
 
@@ -134,17 +178,28 @@ func GenDeviceFinishStages(pt *disk.PartitionTable, filename string) []*Stage {
 				}, stageDevices)
 
 			stages = append(stages, stage)
+		case *disk.Verity:
+			s, err := genDMVerityStages(pt, ent, path, filename, cmdline)
+			if err != nil {
+				return err
+			}
+			verityStages = append(verityStages, s...)
 		}
 
 		return nil
 	}
 
-	_ = pt.ForEachEntity(genStages)
+	if err := pt.ForEachEntity(genStages); err != nil {
+		return nil, err
+	}
 	// Ensure that "org.osbuild.luks2.remove-key" stages are done after
 	// "org.osbuild.lvm2.metadata" stages, we cannot open a device if its
 	// password has changed
 	stages = append(stages, removeKeyStages...)
-	return stages
+	// The hash trees must be generated last, after all other stages that
+	// modify the data devices
+	stages = append(stages, verityStages...)
+	return stages, nil
 }
 
 func deviceName(p disk.Entity) string {
@@ -161,12 +216,21 @@ func deviceName(p disk.Entity) string {
 		return payload.Name
 	case *disk.LVMLogicalVolume:
 		return payload.Name
+	case *disk.MDRaid:
+		return "md-" + payload.Name
+	case *disk.MDRaidMember:
+		return fmt.Sprintf("md-%s-member%d", payload.Name, payload.Member)
 	case *disk.Btrfs:
 		return "btrfs-" + payload.UUID[:4]
 	case *disk.Swap:
 		return "swap-" + payload.UUID[:4]
 	case *disk.Raw:
 		return "raw-" + pathEscape(payload.SourcePath)
+	case *disk.Verity:
+		// the data device is used directly during the build
+		return deviceName(payload.Payload)
+	case *disk.VerityHash:
+		return "verity-hash-" + payload.Name
 	}
 	panic(fmt.Sprintf("unsupported device type in deviceName: '%T'", p))
 }
@@ -196,19 +260,8 @@ func getDevices(path []disk.Entity, filename string, lockLoopback bool) (map[str
 			if pt == nil {
 				panic("path does not contain partition table; this is a programming error")
 			}
-			var sectorSize *uint64
-			if pt.SectorSize != 0 {
-				sectorSize = &pt.SectorSize
-			}
-			lbopt := LoopbackDeviceOptions{
-				Filename:   filename,
-				Start:      pt.BytesToSectors(e.Start),
-				Size:       pt.BytesToSectors(e.Size.Uint64()),
-				SectorSize: sectorSize,
-				Lock:       lockLoopback,
-			}
 			name := deviceName(e.Payload)
-			do[name] = *NewLoopbackDevice(&lbopt)
+			do[name] = partitionLoopbackDevice(pt, e, filename, lockLoopback)
 			parent = name
 		case *disk.LUKSContainer:
 			lo := LUKS2DeviceOptions{
@@ -224,11 +277,174 @@ func getDevices(path []disk.Entity, filename string, lockLoopback bool) (map[str
 			name := deviceName(e.Payload)
 			do[name] = *NewLVM2LVDevice(parent, &lo)
 			parent = name
+		case *disk.MDRaid:
+			// the array is assembled from all its member devices, the
+			// partition holding it is the parent
+			members := []string{parent}
+			for idx, member := range pt.MDRaidMembers(e.Name)[1:] {
+				memberName := deviceName(member.Payload)
+				do[memberName] = partitionLoopbackDevice(pt.MDRaidMemberDisks[idx], member, MDRaidMemberDiskFilename(filename, idx), lockLoopback)
+				members = append(members, memberName)
+			}
+			mo := MDAdmDeviceOptions{
+				UUID:    e.UUID,
+				Devices: members,
+			}
+			name := deviceName(e.Payload)
+			do[name] = *NewMDAdmDevice(parent, &mo)
+			parent = name
 		}
 	}
 	return do, parent
 }
 
+// MDRaidMemberDiskFilename returns the name of the file of the member disk
+// with the given index of the md RAID arrays of the image file, see
+// disk.PartitionTable.MDRaidMemberDisks. Member disks are written next to
+// the image file.
+func MDRaidMemberDiskFilename(filename string, idx int) string {
+	return fmt.Sprintf("%s.member%d", filename, idx+1)
+}
+
+// partitionLoopbackDevice returns the loopback device for the partition of
+// the partition table in the image file.
+func partitionLoopbackDevice(pt *disk.PartitionTable, part *disk.Partition, filename string, lockLoopback bool) Device {
+	var sectorSize *uint64
+	if pt.SectorSize != 0 {
+		sectorSize = &pt.SectorSize
+	}
+	lbopt := LoopbackDeviceOptions{
+		Filename:   filename,
+		Start:      pt.BytesToSectors(part.Start),
+		Size:       pt.BytesToSectors(part.Size.Uint64()),
+		SectorSize: sectorSize,
+		Lock:       lockLoopback,
+	}
+	return *NewLoopbackDevice(&lbopt)
+}
+
+// genDMVerityStages generates the "org.osbuild.dmverity" stage for the
+// Verity container at the end of path, which writes the root hash to
+// VerityRootHashFilename(filename, verity). For "/" and "/usr", an
+// "org.osbuild.dmverity.cmdline" stage adds it as "roothash=" or "usrhash="
+// to the kernel command line described by cmdline.
+func genDMVerityStages(pt *disk.PartitionTable, verity *disk.Verity, path []disk.Entity, filename string, cmdline *VerityKernelCmdline) ([]*Stage, error) {
+	// do not include us when getting the devices
+	stageDevices, lastName := getDevices(path[:len(path)-1], filename, true)
+	lastDevice := stageDevices[lastName]
+	delete(stageDevices, lastName)
+	stageDevices["data_device"] = lastDevice
+
+	hashPart := findVerityHashPartition(pt, verity.Name)
+	if hashPart == nil {
+		panic(fmt.Sprintf("cannot find the hash partition of verity device %q; this is a programming error", verity.Name))
+	}
+	hashDevices, lastName := getDevices([]disk.Entity{pt, hashPart}, filename, true)
+	stageDevices["hash_device"] = hashDevices[lastName]
+
+	rootHashFile := VerityRootHashFilename(filename, verity)
+	stages := []*Stage{
+		NewDMVerityStage(&DMVerityStageOptions{RootHashFile: rootHashFile}, stageDevices),
+	}
+
+	var kernelOption string
+	if mnt, ok := verity.Payload.(disk.Mountable); ok {
+		switch mnt.GetMountpoint() {
+		case "/":
+			kernelOption = "roothash"
+		case "/usr":
+			kernelOption = "usrhash"
+		}
+	}
+	if cmdline == nil || kernelOption == "" {
+		return stages, nil
+	}
+
+	options := &DMVerityCmdlineStageOptions{
+		RootHashFile: rootHashFile,
+		KernelOption: kernelOption,
+	}
+	cmdlineDevices := make(map[string]Device)
+	var mounts []Mount
+	// mountURL returns the "mount://" URL of the path in the tree and adds
+	// the mount of the filesystem that holds it
+	mountURL := func(treePath string) (string, error) {
+		mnt, mntPath := findMountableForPath(pt, treePath)
+		if mnt == nil {
+			return "", fmt.Errorf("cannot find the filesystem of %q", treePath)
+		}
+		for _, ent := range mntPath {
+			if _, ok := ent.(*disk.Verity); ok {
+				return "", fmt.Errorf("cannot add the root hash of verity device %q to %q: %q is verity protected", verity.Name, treePath, mnt.GetMountpoint())
+			}
+		}
+		devices, deviceName := getDevices(mntPath, filename, true)
+		for name, device := range devices {
+			cmdlineDevices[name] = device
+		}
+		mount, err := genOsbuildMount(deviceName, mnt)
+		if err != nil {
+			return "", err
+		}
+		if !slices.ContainsFunc(mounts, func(m Mount) bool { return m.Name == mount.Name }) {
+			mounts = append(mounts, *mount)
+		}
+
+		relPath := strings.TrimPrefix(treePath, mnt.GetMountpoint())
+		if !strings.HasPrefix(relPath, "/") {
+			relPath = "/" + relPath
+		}
+		return fmt.Sprintf("mount://%s%s", mount.Name, relPath), nil
+	}
+
+	var err error
+	if cmdline.BootEntries != "" {
+		if options.BootEntries, err = mountURL(cmdline.BootEntries); err != nil {
+			return nil, err
+		}
+	}
+	if cmdline.UKIAddon != "" {
+		if options.UKIAddon, err = mountURL(cmdline.UKIAddon); err != nil {
+			return nil, err
+		}
+	}
+	if options.BootEntries == "" && options.UKIAddon == "" {
+		return stages, nil
+	}
+	// mounts must be sorted so parents come before their children
+	slices.SortFunc(mounts, func(a, b Mount) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+
+	return append(stages, NewDMVerityCmdlineStage(options, cmdlineDevices, mounts)), nil
+}
+
+// findMountableForPath returns the mountable that holds the given path in
+// the tree, i.e. the one with the longest mountpoint that is a parent of the
+// path, and the path of entities leading to it.
+func findMountableForPath(pt *disk.PartitionTable, treePath string) (disk.Mountable, []disk.Entity) {
+	var found disk.Mountable
+	var foundPath []disk.Entity
+	_ = pt.ForEachMountable(func(mnt disk.Mountable, path []disk.Entity) error {
+		mountpoint := mnt.GetMountpoint()
+		if mountpoint != "/" && treePath != mountpoint && !strings.HasPrefix(treePath, mountpoint+"/") {
+			return nil
+		}
+		if found == nil || len(mountpoint) > len(found.GetMountpoint()) {
+			found = mnt
+			foundPath = slices.Clone(path)
+		}
+		return nil
+	})
+	return found, foundPath
+}
+
+// VerityRootHashFilename returns the name of the file the root hash of the
+// verity device is written to, next to the image file.
+func VerityRootHashFilename(filename string, verity *disk.Verity) string {
+	return fmt.Sprintf("%s.%s.roothash", filename, verity.Name)
+}
+
 // pathEscape implements similar path escaping as used by systemd-escape
 // https://github.com/systemd/systemd/blob/c57ff6230e4e199d40f35a356e834ba99f3f8420/src/basic/unit-name.c#L389
 func pathEscape(path string) string {
@@ -262,8 +478,15 @@ func genOsbuildMount(source string, mnt disk.Mountable) (*Mount, error) {
 		return NewXfsMount(name, source, mountpoint), nil
 	case "vfat":
 		return NewFATMount(name, source, mountpoint), nil
-	case "ext4":
+	case "ext4", "ext3", "ext2":
+		// the ext4 driver mounts all ext filesystem versions
 		return NewExt4Mount(name, source, mountpoint), nil
+	case "f2fs":
+		return NewF2fsMount(name, source, mountpoint), nil
+	case "erofs":
+		return NewErofsMount(name, source, mountpoint), nil
+	case "squashfs":
+		return NewSquashfsMount(name, source, mountpoint), nil
 	case "btrfs":
 		if subvol, isSubvol := mnt.(*disk.BtrfsSubvolume); isSubvol {
 			return NewBtrfsMount(name, source, mountpoint, subvol.Name, subvol.Compress), nil
@@ -284,6 +507,22 @@ func genOsbuildMount(source string, mnt disk.Mountable) (*Mount, error) {
 // 3) generated devices
 // 4) error if any
 func GenMountsDevicesFromPT(filename string, pt *disk.PartitionTable) (string, []Mount, map[string]Device, error) {
+	fsRootMntName, mounts, devices, err := genMountsDevicesFromPT(filename, pt)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if fsRootMntName == "" {
+		return "", nil, nil, fmt.Errorf("no mount found for the filesystem root")
+	}
+
+	return fsRootMntName, mounts, devices, nil
+}
+
+// genMountsDevicesFromPT is GenMountsDevicesFromPT() without requiring a
+// root filesystem, e.g. for the partition table of a data disk. The name of
+// the root mount is empty if there is none.
+func genMountsDevicesFromPT(filename string, pt *disk.PartitionTable) (string, []Mount, map[string]Device, error) {
 	devices := make(map[string]Device, len(pt.Partitions))
 	mounts := make([]Mount, 0, len(pt.Partitions))
 	var fsRootMntName string
@@ -327,9 +566,5 @@ func GenMountsDevicesFromPT(filename string, pt *disk.PartitionTable) (string, [
 		return cmp.Compare(a.Target, b.Target)
 	})
 
-	if fsRootMntName == "" {
-		return "", nil, nil, fmt.Errorf("no mount found for the filesystem root")
-	}
-
 	return fsRootMntName, mounts, devices, nil
 }
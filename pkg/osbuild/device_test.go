@@ -90,7 +90,8 @@ func TestGenDeviceFinishStages(t *testing.T) {
 	pt, err := disk.NewPartitionTable(&luks_lvm, []blueprint.FilesystemCustomization{}, 0, partition.AutoLVMPartitioningMode, arch.ARCH_PPC64LE, make(map[string]datasizes.Size), "", rng)
 	assert.NoError(err)
 
-	stages := GenDeviceFinishStages(pt, "image.raw")
+	stages, err := GenDeviceFinishStages(pt, "image.raw", nil)
+	assert.NoError(err)
 
 	// we should have one stage
 	assert.Equal(1, len(stages))
@@ -121,6 +122,261 @@ func TestGenDeviceFinishStages(t *testing.T) {
 	assert.Equal("root", opts.VGName)
 }
 
+// verityTestPartitionTable returns a partition table with a dm-verity
+// protected root filesystem
+func verityTestPartitionTable() *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Start: 1 * datasizes.MiB,
+				Size:  1 * datasizes.GiB,
+				UUID:  "6264D520-3FB9-423F-8AB8-7A0A8E3D3562",
+				Payload: &disk.Verity{
+					Name: "root",
+					Payload: &disk.Filesystem{
+						Type:         "erofs",
+						UUID:         "f3b5a9a2-cc5c-4c4a-8e6c-0f4f41a0a0b1",
+						Mountpoint:   "/",
+						FSTabOptions: "ro",
+					},
+				},
+			},
+			{
+				Start: 1*datasizes.MiB + 1*datasizes.GiB,
+				Size:  16 * datasizes.MiB,
+				UUID:  "A0B3F5C1-5E5C-4C1F-9C1A-1E4E8B7F0D2E",
+				Payload: &disk.VerityHash{
+					Name: "root",
+				},
+			},
+		},
+	}
+}
+
+func TestGenDeviceFinishStagesVerity(t *testing.T) {
+	pt := verityTestPartitionTable()
+
+	stages, err := GenDeviceFinishStages(pt, "image.raw", nil)
+	require.NoError(t, err)
+	require.Len(t, stages, 1)
+
+	verity := stages[0]
+	assert.Equal(t, "org.osbuild.dmverity", verity.Type)
+	assert.Equal(t, &DMVerityStageOptions{RootHashFile: "image.raw.root.roothash"}, verity.Options)
+	assert.Empty(t, verity.Mounts)
+
+	require.Len(t, verity.Devices, 2)
+	assert.Equal(t, *NewLoopbackDevice(&LoopbackDeviceOptions{
+		Filename: "image.raw",
+		Start:    pt.BytesToSectors(pt.Partitions[0].Start),
+		Size:     pt.BytesToSectors(pt.Partitions[0].Size.Uint64()),
+		Lock:     true,
+	}), verity.Devices["data_device"])
+	assert.Equal(t, *NewLoopbackDevice(&LoopbackDeviceOptions{
+		Filename: "image.raw",
+		Start:    pt.BytesToSectors(pt.Partitions[1].Start),
+		Size:     pt.BytesToSectors(pt.Partitions[1].Size.Uint64()),
+		Lock:     true,
+	}), verity.Devices["hash_device"])
+}
+
+func verityTestPartitionTableWithBoot() *disk.PartitionTable {
+	pt := verityTestPartitionTable()
+	pt.Partitions = append(pt.Partitions,
+		disk.Partition{
+			Start: 1*datasizes.MiB + 1*datasizes.GiB + 16*datasizes.MiB,
+			Size:  512 * datasizes.MiB,
+			Payload: &disk.Filesystem{
+				Type:       "ext4",
+				UUID:       "0194fdc2-fa2f-4cc0-81d3-ff12045b73c8",
+				Mountpoint: "/boot",
+			},
+		},
+		disk.Partition{
+			Start: 1*datasizes.MiB + 1*datasizes.GiB + 528*datasizes.MiB,
+			Size:  200 * datasizes.MiB,
+			Payload: &disk.Filesystem{
+				Type:       "vfat",
+				UUID:       "7B77-95E7",
+				Mountpoint: "/boot/efi",
+			},
+		},
+	)
+	return pt
+}
+
+func TestGenDeviceFinishStagesVerityBootEntries(t *testing.T) {
+	pt := verityTestPartitionTableWithBoot()
+
+	stages, err := GenDeviceFinishStages(pt, "image.raw", &VerityKernelCmdline{BootEntries: "/boot/loader/entries"})
+	require.NoError(t, err)
+	require.Len(t, stages, 2)
+
+	assert.Equal(t, "org.osbuild.dmverity", stages[0].Type)
+	assert.Equal(t, &DMVerityStageOptions{RootHashFile: "image.raw.root.roothash"}, stages[0].Options)
+
+	cmdline := stages[1]
+	assert.Equal(t, "org.osbuild.dmverity.cmdline", cmdline.Type)
+	assert.Equal(t, &DMVerityCmdlineStageOptions{
+		RootHashFile: "image.raw.root.roothash",
+		KernelOption: "roothash",
+		BootEntries:  "mount://boot/loader/entries",
+	}, cmdline.Options)
+	assert.Equal(t, []Mount{*NewExt4Mount("boot", "boot", "/boot")}, cmdline.Mounts)
+
+	require.Len(t, cmdline.Devices, 1)
+	assert.Equal(t, *NewLoopbackDevice(&LoopbackDeviceOptions{
+		Filename: "image.raw",
+		Start:    pt.BytesToSectors(pt.Partitions[2].Start),
+		Size:     pt.BytesToSectors(pt.Partitions[2].Size.Uint64()),
+		Lock:     true,
+	}), cmdline.Devices["boot"])
+}
+
+func TestGenDeviceFinishStagesVerityUKIAddon(t *testing.T) {
+	pt := verityTestPartitionTableWithBoot()
+
+	stages, err := GenDeviceFinishStages(pt, "image.raw", &VerityKernelCmdline{
+		UKIAddon: "/boot/efi/EFI/Linux/ffffffffffffffffffffffffffffffff-6.11.0.efi.extra.d/verity.addon.efi",
+	})
+	require.NoError(t, err)
+	require.Len(t, stages, 2)
+
+	cmdline := stages[1]
+	assert.Equal(t, &DMVerityCmdlineStageOptions{
+		RootHashFile: "image.raw.root.roothash",
+		KernelOption: "roothash",
+		UKIAddon:     "mount://boot-efi/EFI/Linux/ffffffffffffffffffffffffffffffff-6.11.0.efi.extra.d/verity.addon.efi",
+	}, cmdline.Options)
+	assert.Equal(t, []Mount{*NewFATMount("boot-efi", "boot-efi", "/boot/efi")}, cmdline.Mounts)
+	assert.Len(t, cmdline.Devices, 1)
+}
+
+func TestGenDeviceFinishStagesVerityBootEntriesOnVerity(t *testing.T) {
+	pt := verityTestPartitionTable()
+
+	_, err := GenDeviceFinishStages(pt, "image.raw", &VerityKernelCmdline{BootEntries: "/boot/loader/entries"})
+	assert.EqualError(t, err, `cannot add the root hash of verity device "root" to "/boot/loader/entries": "/" is verity protected`)
+}
+
+func TestGenDeviceCreationStagesMDRaid(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Start: 1 * datasizes.MiB,
+				Size:  1 * datasizes.GiB,
+				Payload: &disk.MDRaid{
+					Name:     "boot",
+					UUID:     "fb180daf-48a7-4ee0-b10d-394651850fd4",
+					Metadata: "1.0",
+					Payload:  &disk.Filesystem{Type: "xfs", Mountpoint: "/boot"},
+				},
+			},
+			{
+				Start: 1*datasizes.MiB + 1*datasizes.GiB,
+				Size:  10 * datasizes.GiB,
+				Payload: &disk.MDRaid{
+					Name:    "root",
+					Level:   "raid5",
+					Devices: 3,
+					UUID:    "a2d7a9e5-6cf0-4c43-bc34-2b3b9e3e1f5e",
+					Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"},
+				},
+			},
+		},
+		MDRaidMemberDisks: []*disk.PartitionTable{
+			{
+				Type: disk.PT_GPT,
+				Size: 12 * datasizes.GiB,
+				Partitions: []disk.Partition{
+					{
+						Start:   1 * datasizes.MiB,
+						Size:    1 * datasizes.GiB,
+						Payload: &disk.MDRaidMember{Name: "boot", Member: 1},
+					},
+					{
+						Start:   1*datasizes.MiB + 1*datasizes.GiB,
+						Size:    10 * datasizes.GiB,
+						Payload: &disk.MDRaidMember{Name: "root", Member: 1},
+					},
+				},
+			},
+			{
+				Type: disk.PT_GPT,
+				Size: 11 * datasizes.GiB,
+				Partitions: []disk.Partition{
+					{
+						Start:   1 * datasizes.MiB,
+						Size:    10 * datasizes.GiB,
+						Payload: &disk.MDRaidMember{Name: "root", Member: 2},
+					},
+				},
+			},
+		},
+	}
+
+	stages := GenDeviceCreationStages(pt, "image.raw")
+	require.Len(t, stages, 2)
+
+	for _, stage := range stages {
+		assert.Equal(t, "org.osbuild.mdadm.create", stage.Type)
+		for _, device := range stage.Devices {
+			assert.Equal(t, "org.osbuild.loopback", device.Type)
+		}
+	}
+	assert.Equal(t, &MDAdmCreateStageOptions{
+		Name:        "boot",
+		UUID:        "fb180daf-48a7-4ee0-b10d-394651850fd4",
+		Level:       "raid1",
+		RaidDevices: 2,
+		Devices:     []string{"md-boot", "md-boot-member1"},
+		Metadata:    "1.0",
+	}, stages[0].Options)
+	assert.Len(t, stages[0].Devices, 2)
+	assert.Equal(t, &MDAdmCreateStageOptions{
+		Name:        "root",
+		UUID:        "a2d7a9e5-6cf0-4c43-bc34-2b3b9e3e1f5e",
+		Level:       "raid5",
+		RaidDevices: 3,
+		Devices:     []string{"md-root", "md-root-member1", "md-root-member2"},
+		Metadata:    "1.2",
+		DataOffset:  "8192K",
+	}, stages[1].Options)
+	require.Len(t, stages[1].Devices, 3)
+	// the other members are on the member disks
+	memberDisk := pt.MDRaidMemberDisks[0]
+	assert.Equal(t, *NewLoopbackDevice(&LoopbackDeviceOptions{
+		Filename: "image.raw.member1",
+		Start:    memberDisk.BytesToSectors(memberDisk.Partitions[1].Start),
+		Size:     memberDisk.BytesToSectors(memberDisk.Partitions[1].Size.Uint64()),
+		Lock:     true,
+	}), stages[1].Devices["md-root-member1"])
+	assert.Equal(t, "image.raw.member2", stages[1].Devices["md-root-member2"].Options.(*LoopbackDeviceOptions).Filename)
+
+	// filesystems are created on the array assembled from all members
+	fsStages := GenFsStages(pt, "image.raw", "os")
+	require.Len(t, fsStages, 2)
+	device := fsStages[1].Devices["device"]
+	assert.Equal(t, *NewMDAdmDevice("md-root", &MDAdmDeviceOptions{
+		UUID:    "a2d7a9e5-6cf0-4c43-bc34-2b3b9e3e1f5e",
+		Devices: []string{"md-root", "md-root-member1", "md-root-member2"},
+	}), device)
+	for _, name := range []string{"md-root", "md-root-member1", "md-root-member2"} {
+		assert.Equal(t, "org.osbuild.loopback", fsStages[1].Devices[name].Type)
+	}
+
+	// the member disks are created and partitioned next to the image
+	var truncated []string
+	for _, stage := range GenImagePrepareStages(pt, "image.raw", PTSfdisk, "os") {
+		if stage.Type == "org.osbuild.truncate" {
+			truncated = append(truncated, stage.Options.(*TruncateStageOptions).Filename)
+		}
+	}
+	assert.Equal(t, []string{"image.raw", "image.raw.member1", "image.raw.member2"}, truncated)
+}
+
 func TestGenDeviceFinishStagesOrderWithLVMClevisBind(t *testing.T) {
 	assert := assert.New(t)
 
@@ -133,7 +389,8 @@ func TestGenDeviceFinishStagesOrderWithLVMClevisBind(t *testing.T) {
 	pt, err := disk.NewPartitionTable(&luks_lvm, []blueprint.FilesystemCustomization{}, 0, partition.AutoLVMPartitioningMode, arch.ARCH_S390X, make(map[string]datasizes.Size), "", rng)
 	assert.NoError(err)
 
-	stages := GenDeviceFinishStages(pt, "image.raw")
+	stages, err := GenDeviceFinishStages(pt, "image.raw", nil)
+	assert.NoError(err)
 
 	// we should have two stages
 	assert.Equal(2, len(stages))
@@ -264,7 +521,11 @@ func Test_deviceName(t *testing.T) {
 		{&disk.LUKSContainer{UUID: "fb180daf-48a7-4ee0-b10d-394651850fd4"}, "luks-fb18"},
 		{&disk.LVMVolumeGroup{Name: "vg-main"}, "vg-main"},
 		{&disk.LVMLogicalVolume{Name: "lv-main"}, "lv-main"},
+		{&disk.MDRaid{Name: "root"}, "md-root"},
+		{&disk.MDRaidMember{Name: "root", Member: 1}, "md-root-member1"},
 		{&disk.Btrfs{UUID: "fb180daf-48a7-4ee0-b10d-394651850fd4"}, "btrfs-fb18"},
+		{&disk.Verity{Name: "root", Payload: &disk.Filesystem{Mountpoint: "/"}}, "-"},
+		{&disk.VerityHash{Name: "root"}, "verity-hash-root"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.expectedName, func(t *testing.T) {
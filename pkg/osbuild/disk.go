@@ -123,6 +123,29 @@ const (
 )
 
 func GenImagePrepareStages(pt *disk.PartitionTable, filename string, partTool PartTool, sourcePipeline string) []*Stage {
+	stages := genPartitionTableStages(pt, filename, partTool)
+
+	// the member disks of md RAID arrays are partitioned before the arrays
+	// are created
+	for idx, memberDisk := range pt.MDRaidMemberDisks {
+		stages = append(stages, genPartitionTableStages(memberDisk, MDRaidMemberDiskFilename(filename, idx), partTool)...)
+	}
+
+	// Generate all the needed "devices", like LUKS2 and LVM2
+	s := GenDeviceCreationStages(pt, filename)
+	stages = append(stages, s...)
+
+	// Generate all the filesystems, subvolumes, and swap areas on partitons
+	// and devices
+	s = GenFsStages(pt, filename, sourcePipeline)
+	stages = append(stages, s...)
+
+	return stages
+}
+
+// genPartitionTableStages generates the stages that create the file of the
+// given size and the partition layout in it.
+func genPartitionTableStages(pt *disk.PartitionTable, filename string, partTool PartTool) []*Stage {
 	stages := make([]*Stage, 0)
 
 	// create an empty file of the given size via `org.osbuild.truncate`
@@ -160,20 +183,13 @@ func GenImagePrepareStages(pt *disk.PartitionTable, filename string, partTool Pa
 		panic("programming error: unknown PartTool: " + partTool)
 	}
 
-	// Generate all the needed "devices", like LUKS2 and LVM2
-	s := GenDeviceCreationStages(pt, filename)
-	stages = append(stages, s...)
-
-	// Generate all the filesystems, subvolumes, and swap areas on partitons
-	// and devices
-	s = GenFsStages(pt, filename, sourcePipeline)
-	stages = append(stages, s...)
-
 	return stages
 }
 
-func GenImageFinishStages(pt *disk.PartitionTable, filename string) []*Stage {
-	return GenDeviceFinishStages(pt, filename)
+// GenImageFinishStages generates the stages that finalize the image after
+// its content is written, see GenDeviceFinishStages() for cmdline.
+func GenImageFinishStages(pt *disk.PartitionTable, filename string, cmdline *VerityKernelCmdline) ([]*Stage, error) {
+	return GenDeviceFinishStages(pt, filename, cmdline)
 }
 
 func GenImageKernelOptions(pt *disk.PartitionTable, mountConfiguration MountConfiguration) (string, []string, error) {
@@ -208,6 +224,23 @@ func GenImageKernelOptions(pt *disk.PartitionTable, mountConfiguration MountConf
 		case *disk.LUKSContainer:
 			karg := "luks.uuid=" + ent.UUID
 			cmdline = append(cmdline, karg)
+		case *disk.MDRaid:
+			karg := "rd.md.uuid=" + ent.MDAdmUUID()
+			cmdline = append(cmdline, karg)
+		case *disk.Verity:
+			// The root hash is only known after the image is built, the
+			// "roothash=" or "usrhash=" option is added to the kernel
+			// command line by the stages of GenImageFinishStages().
+			dataPart := path[len(path)-2].(*disk.Partition)
+			hashPart := findVerityHashPartition(pt, ent.Name)
+			if hashPart == nil {
+				return fmt.Errorf("cannot find the hash partition of verity device %q", ent.Name)
+			}
+			cmdline = append(
+				cmdline,
+				fmt.Sprintf("systemd.verity_%s_data=PARTUUID=%s", ent.Name, dataPart.UUID),
+				fmt.Sprintf("systemd.verity_%s_hash=PARTUUID=%s", ent.Name, hashPart.UUID),
+			)
 		case *disk.BtrfsSubvolume:
 			if ent.Mountpoint == "/" && mountConfiguration != MOUNT_CONFIGURATION_UNITS {
 				// if we're using mount units, the rootflags will be added
@@ -249,6 +282,19 @@ func GenImageKernelOptions(pt *disk.PartitionTable, mountConfiguration MountConf
 		}
 	}
 
-	_ = pt.ForEachEntity(genOptions)
+	if err := pt.ForEachEntity(genOptions); err != nil {
+		return "", nil, err
+	}
 	return rootFsUUID, cmdline, nil
 }
+
+// findVerityHashPartition returns the partition holding the hash tree of the
+// verity device with the given name.
+func findVerityHashPartition(pt *disk.PartitionTable, name string) *disk.Partition {
+	for idx := range pt.Partitions {
+		if hash, ok := pt.Partitions[idx].Payload.(*disk.VerityHash); ok && hash.Name == name {
+			return &pt.Partitions[idx]
+		}
+	}
+	return nil
+}
@@ -57,6 +57,37 @@ func TestGenImageKernelOptions(t *testing.T) {
 	assert.Subset(cmdline, []string{"luks.uuid=" + uuids["luks"]})
 }
 
+func TestGenImageKernelOptionsVerity(t *testing.T) {
+	pt := verityTestPartitionTable()
+
+	rootUUID, cmdline, err := GenImageKernelOptions(pt, MOUNT_CONFIGURATION_FSTAB)
+	assert.NoError(t, err)
+	assert.Equal(t, "f3b5a9a2-cc5c-4c4a-8e6c-0f4f41a0a0b1", rootUUID)
+	assert.Equal(t, []string{
+		"systemd.verity_root_data=PARTUUID=6264D520-3FB9-423F-8AB8-7A0A8E3D3562",
+		"systemd.verity_root_hash=PARTUUID=A0B3F5C1-5E5C-4C1F-9C1A-1E4E8B7F0D2E",
+	}, cmdline)
+
+	// the hash partition is missing
+	pt.Partitions = pt.Partitions[:1]
+	_, _, err = GenImageKernelOptions(pt, MOUNT_CONFIGURATION_FSTAB)
+	assert.EqualError(t, err, `cannot find the hash partition of verity device "root"`)
+}
+
+func TestGenImageKernelOptionsMDRaid(t *testing.T) {
+	pt := testdisk.MakeFakePartitionTable("/")
+	pt.Partitions[0].Payload = &disk.MDRaid{
+		Name:    "root",
+		UUID:    "fb180daf-48a7-4ee0-b10d-394651850fd4",
+		Payload: pt.Partitions[0].Payload,
+	}
+
+	rootUUID, cmdline, err := GenImageKernelOptions(pt, MOUNT_CONFIGURATION_FSTAB)
+	assert.NoError(t, err)
+	assert.Equal(t, disk.RootPartitionUUID, rootUUID)
+	assert.Equal(t, []string{"rd.md.uuid=fb180daf:48a74ee0:b10d3946:51850fd4"}, cmdline)
+}
+
 func TestGenImageKernelOptionsBtrfs(t *testing.T) {
 	pt := testdisk.MakeFakeBtrfsPartitionTable("/")
 	_, actual, err := GenImageKernelOptions(pt, MOUNT_CONFIGURATION_FSTAB)
@@ -0,0 +1,37 @@
+package osbuild
+
+// Add the root hash of a dm-verity device, read from the file that the
+// org.osbuild.dmverity stage wrote to the tree, to the kernel command line:
+// as an "options" line of every boot loader entry in a directory and/or as
+// the command line of a UKI addon. The root hash is only known once the hash
+// tree is generated, so this cannot be done when the boot configuration is
+// written.
+//
+// This is a new stage that needs a matching stage in osbuild.
+
+type DMVerityCmdlineStageOptions struct {
+	// Path of the file in the tree with the root hash
+	RootHashFile string `json:"root_hash_file"`
+
+	// Kernel command line option that is set to the root hash, "roothash"
+	// or "usrhash"
+	KernelOption string `json:"kernel_option"`
+
+	// Directory with the boot loader entries, as a "mount://" URL
+	BootEntries string `json:"boot_entries,omitempty"`
+
+	// UKI addon that is created with the kernel command line option, as a
+	// "mount://" URL
+	UKIAddon string `json:"uki_addon,omitempty"`
+}
+
+func (DMVerityCmdlineStageOptions) isStageOptions() {}
+
+func NewDMVerityCmdlineStage(options *DMVerityCmdlineStageOptions, devices map[string]Device, mounts []Mount) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.dmverity.cmdline",
+		Options: options,
+		Devices: devices,
+		Mounts:  mounts,
+	}
+}
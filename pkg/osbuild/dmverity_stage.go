@@ -0,0 +1,19 @@
+package osbuild
+
+// Generate the dm-verity hash tree of the "data_device" on the
+// "hash_device" and write the resulting root hash to a file in the tree.
+
+type DMVerityStageOptions struct {
+	// Path of the file in the tree the root hash is written to
+	RootHashFile string `json:"root_hash_file"`
+}
+
+func (DMVerityStageOptions) isStageOptions() {}
+
+func NewDMVerityStage(options *DMVerityStageOptions, devices map[string]Device) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.dmverity",
+		Options: options,
+		Devices: devices,
+	}
+}
@@ -13,6 +13,9 @@ type ErofsStageOptions struct {
 	Compression     *ErofsCompression `json:"compression,omitempty" yaml:"compression,omitempty"`
 	ExtendedOptions []string          `json:"options,omitempty" yaml:"options,omitempty"`
 	ClusterSize     *int              `json:"cluster-size,omitempty" yaml:"cluster-size,omitempty"`
+
+	UUID  string `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
 }
 
 func (ErofsStageOptions) isStageOptions() {}
@@ -38,6 +38,7 @@ func NewFSTabStage(options *FSTabStageOptions) *Stage {
 type FSTabEntry struct {
 	UUID    string `json:"uuid,omitempty"`
 	Label   string `json:"label,omitempty"`
+	Device  string `json:"device,omitempty"`
 	VFSType string `json:"vfs_type"`
 	Path    string `json:"path,omitempty"`
 	Options string `json:"options,omitempty"`
@@ -57,7 +58,9 @@ func (options *FSTabStageOptions) AddFilesystem(id string, vfsType string, path
 	})
 }
 
-func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
+// NewFSTabStageOptions generates the fstab entries for all filesystems and
+// swap areas in the partition tables, e.g. of all disks of an image.
+func NewFSTabStageOptions(pts ...*disk.PartitionTable) (*FSTabStageOptions, error) {
 	var options FSTabStageOptions
 	genOption := func(mnt disk.FSTabEntity, path []disk.Entity) error {
 		fsSpec := mnt.GetFSSpec()
@@ -65,6 +68,23 @@ func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
 		if err != nil {
 			return err
 		}
+		if mnt.GetFSType() == "squashfs" {
+			// squashfs has neither a uuid nor a label, so it is
+			// identified by the device it is on
+			device, err := fsTabDevice(mnt, path)
+			if err != nil {
+				return err
+			}
+			options.FileSystems = append(options.FileSystems, &FSTabEntry{
+				Device:  device,
+				VFSType: mnt.GetFSType(),
+				Path:    mnt.GetFSFile(),
+				Options: fsOptions.MntOps,
+				Freq:    fsOptions.Freq,
+				PassNo:  fsOptions.PassNo,
+			})
+			return nil
+		}
 		options.AddFilesystem(fsSpec.UUID, mnt.GetFSType(), mnt.GetFSFile(), fsOptions.MntOps, fsOptions.Freq, fsOptions.PassNo)
 		return nil
 	}
@@ -73,9 +93,10 @@ func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
 		return fmt.Sprintf("%d%s", fs.PassNo, fs.Path)
 	}
 
-	err := pt.ForEachFSTabEntity(genOption)
-	if err != nil {
-		return nil, err
+	for _, pt := range pts {
+		if err := pt.ForEachFSTabEntity(genOption); err != nil {
+			return nil, err
+		}
 	}
 
 	// sort the entries by PassNo to maintain backward compatibility
@@ -84,3 +105,22 @@ func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
 	})
 	return &options, nil
 }
+
+// fsTabDevice returns a stable device path for a filesystem that cannot be
+// identified by its uuid or label: the PARTUUID link of its GPT partition or
+// the path of its LVM logical volume.
+func fsTabDevice(mnt disk.FSTabEntity, path []disk.Entity) (string, error) {
+	if len(path) >= 2 {
+		switch parent := path[len(path)-2].(type) {
+		case *disk.Partition:
+			if pt, ok := path[0].(*disk.PartitionTable); ok && pt.Type == disk.PT_GPT && parent.UUID != "" {
+				return "/dev/disk/by-partuuid/" + parent.UUID, nil
+			}
+		case *disk.LVMLogicalVolume:
+			if vg, ok := path[len(path)-3].(*disk.LVMVolumeGroup); ok {
+				return fmt.Sprintf("/dev/%s/%s", vg.Name, parent.Name), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s filesystem on %q must be on a GPT partition or an LVM logical volume to be mounted", mnt.GetFSType(), mnt.GetFSFile())
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -128,3 +129,76 @@ func TestNewFSTabStageOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestNewFSTabStageOptionsReadOnly(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{Type: "ext4", UUID: "root-uuid", Mountpoint: "/", FSTabOptions: "defaults"},
+			},
+			{
+				Payload: &disk.Filesystem{Type: "erofs", UUID: "usr-uuid", Mountpoint: "/usr", FSTabOptions: "defaults"},
+			},
+			{
+				UUID:    "data-partuuid",
+				Payload: &disk.Filesystem{Type: "squashfs", Mountpoint: "/srv/data", FSTabOptions: "defaults"},
+			},
+			{
+				Payload: &disk.LVMVolumeGroup{
+					Name: "vg",
+					LogicalVolumes: []disk.LVMLogicalVolume{
+						{
+							Name:    "toolslv",
+							Payload: &disk.Filesystem{Type: "squashfs", Mountpoint: "/opt/tools", FSTabOptions: "defaults"},
+						},
+					},
+				},
+			},
+		},
+	}
+	options, err := NewFSTabStageOptions(pt)
+	require.NoError(t, err)
+	assert.Equal(t, []*FSTabEntry{
+		{UUID: "root-uuid", VFSType: "ext4", Path: "/", Options: "defaults"},
+		{Device: "/dev/vg/toolslv", VFSType: "squashfs", Path: "/opt/tools", Options: "defaults,ro"},
+		{Device: "/dev/disk/by-partuuid/data-partuuid", VFSType: "squashfs", Path: "/srv/data", Options: "defaults,ro"},
+		{UUID: "usr-uuid", VFSType: "erofs", Path: "/usr", Options: "defaults,ro"},
+	}, options.FileSystems)
+}
+
+func TestNewFSTabStageOptionsSquashfsDOS(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_DOS,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{Type: "squashfs", Mountpoint: "/srv/data"},
+			},
+		},
+	}
+	_, err := NewFSTabStageOptions(pt)
+	assert.EqualError(t, err, `squashfs filesystem on "/srv/data" must be on a GPT partition or an LVM logical volume to be mounted`)
+}
+
+func TestNewFSTabStageOptionsMultiplePartitionTables(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{Type: "ext4", UUID: "root-uuid", Mountpoint: "/", FSTabOptions: "defaults"},
+			},
+		},
+	}
+	dataPT := &disk.PartitionTable{
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{Type: "xfs", UUID: "data-uuid", Mountpoint: "/data", FSTabOptions: "defaults", FSTabPassNo: 2},
+			},
+		},
+	}
+	options, err := NewFSTabStageOptions(pt, dataPT)
+	require.NoError(t, err)
+	assert.Equal(t, []*FSTabEntry{
+		{UUID: "root-uuid", VFSType: "ext4", Path: "/", Options: "defaults"},
+		{UUID: "data-uuid", VFSType: "xfs", Path: "/data", Options: "defaults", PassNo: 2},
+	}, options.FileSystems)
+}
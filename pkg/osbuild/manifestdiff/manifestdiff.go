@@ -0,0 +1,604 @@
+// Package manifestdiff explains the differences between two osbuild
+// manifests, e.g. the manifests of an image type before and after a change
+// to the distro definitions.
+//
+// Pipelines are aligned by name and the stages of a pipeline by type, the
+// n-th stage of a type in one manifest is compared with the n-th stage of
+// the same type in the other. Packages are compared by the file names of
+// the RPMs referenced by the stages (name-version-release.arch) and not by
+// checksum, so that updated packages are reported as such.
+//
+// The manifests are not loaded as osbuild.Manifest as the stage options of
+// the osbuild package cannot be unmarshalled generically, they are compared
+// as plain JSON values instead.
+package manifestdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Change is a changed value in a manifest. From and To are the JSON
+// encoded values and empty if the value is absent.
+type Change struct {
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// PackageUpdate is a package with the same name and architecture that has
+// a different version in the second manifest.
+type PackageUpdate struct {
+	Name string `json:"name"`
+	Arch string `json:"arch"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// StageChanges are the changes of the options, inputs, devices or mounts
+// of a stage.
+type StageChanges struct {
+	// Stage is the type of the stage, followed by "#n" for the n-th stage
+	// of the same type in the pipeline with n > 1.
+	Stage   string   `json:"stage"`
+	Changes []Change `json:"changes"`
+}
+
+// PipelineChanges are the changes of a pipeline that is in both manifests.
+type PipelineChanges struct {
+	Name string `json:"name"`
+
+	// Changes of the attributes of the pipeline, e.g. the build pipeline
+	// or the runner.
+	Changes []Change `json:"changes,omitempty"`
+
+	AddedPackages   []string        `json:"added_packages,omitempty"`
+	RemovedPackages []string        `json:"removed_packages,omitempty"`
+	UpdatedPackages []PackageUpdate `json:"updated_packages,omitempty"`
+
+	AddedStages     []string       `json:"added_stages,omitempty"`
+	RemovedStages   []string       `json:"removed_stages,omitempty"`
+	ReorderedStages []string       `json:"reordered_stages,omitempty"`
+	Stages          []StageChanges `json:"stages,omitempty"`
+}
+
+func (pc *PipelineChanges) empty() bool {
+	return len(pc.Changes) == 0 &&
+		len(pc.AddedPackages) == 0 && len(pc.RemovedPackages) == 0 && len(pc.UpdatedPackages) == 0 &&
+		len(pc.AddedStages) == 0 && len(pc.RemovedStages) == 0 && len(pc.ReorderedStages) == 0 &&
+		len(pc.Stages) == 0
+}
+
+// SourceChanges are the changes of the items of a source type. Items are
+// identified by their file name (for URLs and paths) or URL (for ostree
+// commits). Added and removed RPMs are not listed as they are part of the
+// package changes of the pipelines.
+type SourceChanges struct {
+	Source  string   `json:"source"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	// Changed are items with a different checksum, From and To are the
+	// checksums.
+	Changed []Change `json:"changed,omitempty"`
+}
+
+// Report are the differences between two manifests.
+type Report struct {
+	AddedPipelines   []string          `json:"added_pipelines,omitempty"`
+	RemovedPipelines []string          `json:"removed_pipelines,omitempty"`
+	Pipelines        []PipelineChanges `json:"pipelines,omitempty"`
+	Sources          []SourceChanges   `json:"sources,omitempty"`
+}
+
+// Empty returns true if the manifests are equivalent.
+func (r *Report) Empty() bool {
+	return len(r.AddedPipelines) == 0 && len(r.RemovedPipelines) == 0 && len(r.Pipelines) == 0 && len(r.Sources) == 0
+}
+
+// manifest is the generic representation of an osbuild.Manifest
+type manifest struct {
+	Version   string                                `json:"version"`
+	Pipelines []map[string]any                      `json:"pipelines"`
+	Sources   map[string]map[string]json.RawMessage `json:"sources"`
+}
+
+// sourceItem is an item of any source type
+type sourceItem struct {
+	checksum string
+	// name is the file name or URL of the item
+	name string
+}
+
+func (m *manifest) sourceItems() map[string][]sourceItem {
+	items := make(map[string][]sourceItem)
+	for srcType, src := range m.Sources {
+		var srcItems map[string]any
+		if err := json.Unmarshal(src["items"], &srcItems); err != nil {
+			continue
+		}
+		for checksum, item := range srcItems {
+			items[srcType] = append(items[srcType], sourceItem{checksum: checksum, name: itemName(checksum, item)})
+		}
+		sort.Slice(items[srcType], func(i, j int) bool {
+			return items[srcType][i].name < items[srcType][j].name
+		})
+	}
+	return items
+}
+
+// itemName returns the name of a source item, which is the file name of
+// the URL or path (curl, librepo), the URL of the remote (ostree) or the
+// checksum otherwise.
+func itemName(checksum string, item any) string {
+	switch item := item.(type) {
+	case string:
+		return path.Base(item)
+	case map[string]any:
+		for _, key := range []string{"url", "path"} {
+			if s, ok := item[key].(string); ok {
+				return path.Base(s)
+			}
+		}
+		if remote, ok := item["remote"].(map[string]any); ok {
+			if s, ok := remote["url"].(string); ok {
+				return s
+			}
+		}
+	}
+	return checksum
+}
+
+// Diff compares two osbuild manifests in their JSON encoding.
+func Diff(from, to []byte) (*Report, error) {
+	var a, b manifest
+	if err := json.Unmarshal(from, &a); err != nil {
+		return nil, fmt.Errorf("cannot load first manifest: %w", err)
+	}
+	if err := json.Unmarshal(to, &b); err != nil {
+		return nil, fmt.Errorf("cannot load second manifest: %w", err)
+	}
+	if a.Version != "2" || b.Version != "2" {
+		return nil, fmt.Errorf("only version 2 manifests are supported, got %q and %q", a.Version, b.Version)
+	}
+
+	aItems := a.sourceItems()
+	bItems := b.sourceItems()
+	aNames := itemNames(aItems)
+	bNames := itemNames(bItems)
+
+	report := &Report{}
+	aPipelines := pipelinesByName(a.Pipelines)
+	bPipelines := pipelinesByName(b.Pipelines)
+	for _, pl := range a.Pipelines {
+		name := pipelineName(pl)
+		if _, ok := bPipelines[name]; !ok {
+			report.RemovedPipelines = append(report.RemovedPipelines, name)
+		}
+	}
+	for _, pl := range b.Pipelines {
+		name := pipelineName(pl)
+		aPipeline, ok := aPipelines[name]
+		if !ok {
+			report.AddedPipelines = append(report.AddedPipelines, name)
+			continue
+		}
+		changes := diffPipeline(name, aPipeline, pl, aNames, bNames)
+		if !changes.empty() {
+			report.Pipelines = append(report.Pipelines, *changes)
+		}
+	}
+	report.Sources = diffSources(aItems, bItems)
+	return report, nil
+}
+
+func pipelineName(pl map[string]any) string {
+	name, _ := pl["name"].(string)
+	return name
+}
+
+func pipelinesByName(pipelines []map[string]any) map[string]map[string]any {
+	byName := make(map[string]map[string]any, len(pipelines))
+	for _, pl := range pipelines {
+		byName[pipelineName(pl)] = pl
+	}
+	return byName
+}
+
+// itemNames maps the checksums of all source items to their names.
+func itemNames(items map[string][]sourceItem) map[string]string {
+	names := make(map[string]string)
+	for _, srcItems := range items {
+		for _, item := range srcItems {
+			names[item.checksum] = item.name
+		}
+	}
+	return names
+}
+
+// stage is a stage of a pipeline with the references to sources resolved.
+type stage struct {
+	key string
+	// packages are the names of the RPMs referenced by the stage
+	packages []string
+	// value is the stage without type and package references
+	value map[string]any
+}
+
+func stagesOf(pl map[string]any, names map[string]string) []stage {
+	rawStages, _ := pl["stages"].([]any)
+	count := make(map[string]int)
+	var stages []stage
+	for _, raw := range rawStages {
+		s, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		typ, _ := s["type"].(string)
+		count[typ]++
+		st := stage{key: typ, value: make(map[string]any)}
+		if count[typ] > 1 {
+			st.key = fmt.Sprintf("%s#%d", typ, count[typ])
+		}
+		for k, v := range s {
+			if k != "type" && k != "inputs" {
+				st.value[k] = v
+			}
+		}
+		if inputs, ok := s["inputs"].(map[string]any); ok {
+			st.value["inputs"] = resolveInputs(inputs, names, &st.packages)
+		}
+		stages = append(stages, st)
+	}
+	return stages
+}
+
+// resolveInputs replaces the checksums in the references of inputs from
+// sources with the names of the items, RPMs are moved to packages.
+func resolveInputs(inputs map[string]any, names map[string]string, packages *[]string) map[string]any {
+	resolved := make(map[string]any, len(inputs))
+	for name, raw := range inputs {
+		input, ok := raw.(map[string]any)
+		if !ok || input["origin"] != "org.osbuild.source" {
+			resolved[name] = raw
+			continue
+		}
+		var refs []string
+		for _, id := range referenceIDs(input["references"]) {
+			itemName, ok := names[id]
+			if !ok {
+				itemName = id
+			}
+			if strings.HasSuffix(itemName, ".rpm") {
+				*packages = append(*packages, strings.TrimSuffix(itemName, ".rpm"))
+				continue
+			}
+			refs = append(refs, itemName)
+		}
+		sort.Strings(refs)
+		in := make(map[string]any, len(input))
+		for k, v := range input {
+			in[k] = v
+		}
+		if len(refs) > 0 {
+			in["references"] = refs
+		} else {
+			delete(in, "references")
+		}
+		resolved[name] = in
+	}
+	return resolved
+}
+
+// referenceIDs returns the ids of input references, which are either a
+// list of ids, a list of objects with an id or an object with ids as keys.
+func referenceIDs(refs any) []string {
+	var ids []string
+	switch refs := refs.(type) {
+	case []any:
+		for _, ref := range refs {
+			switch ref := ref.(type) {
+			case string:
+				ids = append(ids, ref)
+			case map[string]any:
+				if id, ok := ref["id"].(string); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+	case map[string]any:
+		for id := range refs {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func diffPipeline(name string, a, b map[string]any, aNames, bNames map[string]string) *PipelineChanges {
+	changes := &PipelineChanges{Name: name}
+
+	// attributes of the pipeline
+	aAttrs := make(map[string]any)
+	bAttrs := make(map[string]any)
+	for k, v := range a {
+		if k != "stages" {
+			aAttrs[k] = v
+		}
+	}
+	for k, v := range b {
+		if k != "stages" {
+			bAttrs[k] = v
+		}
+	}
+	changes.Changes = diffValues("", aAttrs, bAttrs)
+
+	aStages := stagesOf(a, aNames)
+	bStages := stagesOf(b, bNames)
+
+	var aPkgs, bPkgs []string
+	for _, s := range aStages {
+		aPkgs = append(aPkgs, s.packages...)
+	}
+	for _, s := range bStages {
+		bPkgs = append(bPkgs, s.packages...)
+	}
+	changes.AddedPackages, changes.RemovedPackages, changes.UpdatedPackages = diffPackages(aPkgs, bPkgs)
+
+	aByKey := make(map[string]stage, len(aStages))
+	for _, s := range aStages {
+		aByKey[s.key] = s
+	}
+	bByKey := make(map[string]stage, len(bStages))
+	for _, s := range bStages {
+		bByKey[s.key] = s
+	}
+	var aCommon, bCommon []string
+	for _, s := range aStages {
+		if _, ok := bByKey[s.key]; ok {
+			aCommon = append(aCommon, s.key)
+		} else {
+			changes.RemovedStages = append(changes.RemovedStages, s.key)
+		}
+	}
+	for _, s := range bStages {
+		aStage, ok := aByKey[s.key]
+		if !ok {
+			changes.AddedStages = append(changes.AddedStages, s.key)
+			continue
+		}
+		bCommon = append(bCommon, s.key)
+		if stageChanges := diffValues("", aStage.value, s.value); len(stageChanges) > 0 {
+			changes.Stages = append(changes.Stages, StageChanges{Stage: s.key, Changes: stageChanges})
+		}
+	}
+	changes.ReorderedStages = reordered(aCommon, bCommon)
+	return changes
+}
+
+// reordered returns the elements of b that are not in the longest common
+// subsequence of a and b, which contain the same elements.
+func reordered(a, b []string) []string {
+	// lengths[i][j] is the length of the LCS of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	inLCS := make(map[string]bool)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			inLCS[b[j]] = true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	var moved []string
+	for _, key := range b {
+		if !inLCS[key] {
+			moved = append(moved, key)
+		}
+	}
+	return moved
+}
+
+// splitNVRA splits name-version-release.arch into name.arch and
+// version-release.
+func splitNVRA(nvra string) (name, arch, vr string) {
+	idx := strings.LastIndex(nvra, ".")
+	if idx < 0 {
+		return nvra, "", ""
+	}
+	nvr, arch := nvra[:idx], nvra[idx+1:]
+	// the release and the version do not contain dashes
+	rIdx := strings.LastIndex(nvr, "-")
+	if rIdx < 0 {
+		return nvra, "", ""
+	}
+	vIdx := strings.LastIndex(nvr[:rIdx], "-")
+	if vIdx < 0 {
+		return nvra, "", ""
+	}
+	return nvr[:vIdx], arch, nvr[vIdx+1:]
+}
+
+func diffPackages(a, b []string) (added, removed []string, updated []PackageUpdate) {
+	aSet := make(map[string]bool, len(a))
+	for _, pkg := range a {
+		aSet[pkg] = true
+	}
+	bSet := make(map[string]bool, len(b))
+	for _, pkg := range b {
+		bSet[pkg] = true
+	}
+	// packages only in one of the manifests, by name.arch
+	onlyA := make(map[string][]string)
+	onlyB := make(map[string][]string)
+	for pkg := range aSet {
+		if !bSet[pkg] {
+			name, arch, _ := splitNVRA(pkg)
+			onlyA[name+"."+arch] = append(onlyA[name+"."+arch], pkg)
+		}
+	}
+	for pkg := range bSet {
+		if !aSet[pkg] {
+			name, arch, _ := splitNVRA(pkg)
+			onlyB[name+"."+arch] = append(onlyB[name+"."+arch], pkg)
+		}
+	}
+	for key, aPkgs := range onlyA {
+		bPkgs := onlyB[key]
+		// packages that are installed in multiple versions, like the
+		// kernel, are reported as added and removed
+		if len(aPkgs) == 1 && len(bPkgs) == 1 {
+			name, arch, fromVR := splitNVRA(aPkgs[0])
+			_, _, toVR := splitNVRA(bPkgs[0])
+			updated = append(updated, PackageUpdate{Name: name, Arch: arch, From: fromVR, To: toVR})
+			delete(onlyB, key)
+			continue
+		}
+		removed = append(removed, aPkgs...)
+	}
+	for _, bPkgs := range onlyB {
+		added = append(added, bPkgs...)
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Slice(updated, func(i, j int) bool {
+		if updated[i].Name != updated[j].Name {
+			return updated[i].Name < updated[j].Name
+		}
+		return updated[i].Arch < updated[j].Arch
+	})
+	return added, removed, updated
+}
+
+func diffSources(a, b map[string][]sourceItem) []SourceChanges {
+	var srcTypes []string
+	for srcType := range a {
+		srcTypes = append(srcTypes, srcType)
+	}
+	for srcType := range b {
+		if _, ok := a[srcType]; !ok {
+			srcTypes = append(srcTypes, srcType)
+		}
+	}
+	sort.Strings(srcTypes)
+
+	var changes []SourceChanges
+	for _, srcType := range srcTypes {
+		sc := SourceChanges{Source: srcType}
+		aByName := make(map[string][]string)
+		for _, item := range a[srcType] {
+			aByName[item.name] = append(aByName[item.name], item.checksum)
+		}
+		bByName := make(map[string][]string)
+		for _, item := range b[srcType] {
+			bByName[item.name] = append(bByName[item.name], item.checksum)
+		}
+		for _, name := range sortedKeys(aByName) {
+			bSums, ok := bByName[name]
+			switch {
+			case !ok:
+				if !strings.HasSuffix(name, ".rpm") {
+					sc.Removed = append(sc.Removed, name)
+				}
+			case !slices.Equal(aByName[name], bSums):
+				sc.Changed = append(sc.Changed, Change{
+					Path: name,
+					From: strings.Join(aByName[name], ","),
+					To:   strings.Join(bSums, ","),
+				})
+			}
+		}
+		for _, name := range sortedKeys(bByName) {
+			if _, ok := aByName[name]; !ok && !strings.HasSuffix(name, ".rpm") {
+				sc.Added = append(sc.Added, name)
+			}
+		}
+		if len(sc.Added) > 0 || len(sc.Removed) > 0 || len(sc.Changed) > 0 {
+			changes = append(changes, sc)
+		}
+	}
+	return changes
+}
+
+// sortedKeys returns the sorted keys of m and sorts its values.
+func sortedKeys(m map[string][]string) []string {
+	for _, v := range m {
+		sort.Strings(v)
+	}
+	return slices.Sorted(maps.Keys(m))
+}
+
+func encode(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// diffValues returns the changes between two JSON values. Objects are
+// compared key by key and lists of the same length element by element.
+func diffValues(p string, a, b any) []Change {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	aMap, aIsMap := a.(map[string]any)
+	bMap, bIsMap := b.(map[string]any)
+	if aIsMap && bIsMap {
+		keys := make(map[string]bool)
+		for k := range aMap {
+			keys[k] = true
+		}
+		for k := range bMap {
+			keys[k] = true
+		}
+		var changes []Change
+		for _, k := range slices.Sorted(maps.Keys(keys)) {
+			aVal, aOK := aMap[k]
+			bVal, bOK := bMap[k]
+			kp := k
+			if p != "" {
+				kp = p + "." + k
+			}
+			switch {
+			case !aOK:
+				changes = append(changes, Change{Path: kp, To: encode(bVal)})
+			case !bOK:
+				changes = append(changes, Change{Path: kp, From: encode(aVal)})
+			default:
+				changes = append(changes, diffValues(kp, aVal, bVal)...)
+			}
+		}
+		return changes
+	}
+	aList, aIsList := a.([]any)
+	bList, bIsList := b.([]any)
+	if aIsList && bIsList && len(aList) == len(bList) {
+		var changes []Change
+		for i := range aList {
+			changes = append(changes, diffValues(fmt.Sprintf("%s[%d]", p, i), aList[i], bList[i])...)
+		}
+		return changes
+	}
+	return []Change{{Path: p, From: encode(a), To: encode(b)}}
+}
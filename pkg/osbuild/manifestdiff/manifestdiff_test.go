@@ -0,0 +1,178 @@
+package manifestdiff_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/osbuild/manifestdiff"
+)
+
+const oldManifest = `{
+  "version": "2",
+  "pipelines": [
+    {"name": "build", "runner": "org.osbuild.fedora42", "stages": [
+      {"type": "org.osbuild.rpm", "inputs": {"packages": {"type": "org.osbuild.files", "origin": "org.osbuild.source",
+        "references": [{"id": "sha256:01"}, {"id": "sha256:02"}]}}}
+    ]},
+    {"name": "os", "build": "name:build", "stages": [
+      {"type": "org.osbuild.rpm", "inputs": {"packages": {"type": "org.osbuild.files", "origin": "org.osbuild.source",
+        "references": {"sha256:01": {}, "sha256:03": {}, "sha256:04": {}}}}},
+      {"type": "org.osbuild.kernel-cmdline", "options": {"root_fs_uuid": "6e4ff95f", "kernel_opts": "console=tty0"}},
+      {"type": "org.osbuild.copy", "options": {"paths": [{"from": "input://a", "to": "tree:///a"}]}},
+      {"type": "org.osbuild.locale", "options": {"language": "C.UTF-8"}},
+      {"type": "org.osbuild.copy", "options": {"paths": [{"from": "input://b", "to": "tree:///b"}]}},
+      {"type": "org.osbuild.selinux", "options": {"file_contexts": "etc/selinux/targeted/contexts/files/file_contexts"}}
+    ]},
+    {"name": "qcow2", "build": "name:build", "stages": []}
+  ],
+  "sources": {
+    "org.osbuild.curl": {"items": {
+      "sha256:01": {"url": "https://example.com/repo/Packages/bash-5.2.37-1.fc42.x86_64.rpm"},
+      "sha256:02": {"url": "https://example.com/repo/Packages/dnf5-5.2.13.1-1.fc42.x86_64.rpm"},
+      "sha256:03": {"url": "https://example.com/repo/Packages/kernel-6.14.0-63.fc42.x86_64.rpm"},
+      "sha256:04": "https://example.com/repo/Packages/telnet-0.17-94.fc42.x86_64.rpm",
+      "sha256:0a": {"url": "https://example.com/files/key.gpg"}
+    }}
+  }
+}`
+
+const newManifest = `{
+  "version": "2",
+  "pipelines": [
+    {"name": "build", "runner": "org.osbuild.fedora43", "stages": [
+      {"type": "org.osbuild.rpm", "inputs": {"packages": {"type": "org.osbuild.files", "origin": "org.osbuild.source",
+        "references": [{"id": "sha256:11"}, {"id": "sha256:02"}]}}}
+    ]},
+    {"name": "os", "build": "name:build", "stages": [
+      {"type": "org.osbuild.rpm", "inputs": {"packages": {"type": "org.osbuild.files", "origin": "org.osbuild.source",
+        "references": {"sha256:11": {}, "sha256:13": {}, "sha256:15": {}}}}},
+      {"type": "org.osbuild.locale", "options": {"language": "C.UTF-8"}},
+      {"type": "org.osbuild.kernel-cmdline", "options": {"root_fs_uuid": "6e4ff95f", "kernel_opts": "console=ttyS0"}},
+      {"type": "org.osbuild.copy", "options": {"paths": [{"from": "input://a", "to": "tree:///a"}]}},
+      {"type": "org.osbuild.copy", "options": {"paths": [{"from": "input://b", "to": "tree:///c"}]}},
+      {"type": "org.osbuild.chrony", "options": {"servers": [{"hostname": "ntp.example.com"}]}},
+      {"type": "org.osbuild.selinux", "options": {"file_contexts": "etc/selinux/targeted/contexts/files/file_contexts"}}
+    ]},
+    {"name": "vmdk", "build": "name:build", "stages": []}
+  ],
+  "sources": {
+    "org.osbuild.curl": {"items": {
+      "sha256:11": {"url": "https://example.com/repo/Packages/bash-5.2.37-2.fc43.x86_64.rpm"},
+      "sha256:02": {"url": "https://example.com/repo/Packages/dnf5-5.2.13.1-1.fc42.x86_64.rpm"},
+      "sha256:13": {"url": "https://example.com/repo/Packages/kernel-6.15.0-1.fc43.x86_64.rpm"},
+      "sha256:15": {"url": "https://example.com/repo/Packages/tmux-3.5a-4.fc43.x86_64.rpm"},
+      "sha256:1a": {"url": "https://example.com/files/key.gpg"}
+    }}
+  }
+}`
+
+func TestDiff(t *testing.T) {
+	report, err := manifestdiff.Diff([]byte(oldManifest), []byte(newManifest))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"qcow2"}, report.RemovedPipelines)
+	assert.Equal(t, []string{"vmdk"}, report.AddedPipelines)
+	require.Len(t, report.Pipelines, 2)
+
+	build := report.Pipelines[0]
+	assert.Equal(t, "build", build.Name)
+	assert.Equal(t, []manifestdiff.Change{
+		{Path: "runner", From: `"org.osbuild.fedora42"`, To: `"org.osbuild.fedora43"`},
+	}, build.Changes)
+	assert.Equal(t, []manifestdiff.PackageUpdate{
+		{Name: "bash", Arch: "x86_64", From: "5.2.37-1.fc42", To: "5.2.37-2.fc43"},
+	}, build.UpdatedPackages)
+	assert.Empty(t, build.Stages)
+
+	osPipeline := report.Pipelines[1]
+	assert.Equal(t, "os", osPipeline.Name)
+	assert.Empty(t, osPipeline.Changes)
+	assert.Equal(t, []string{"tmux-3.5a-4.fc43.x86_64"}, osPipeline.AddedPackages)
+	assert.Equal(t, []string{"telnet-0.17-94.fc42.x86_64"}, osPipeline.RemovedPackages)
+	assert.Equal(t, []manifestdiff.PackageUpdate{
+		{Name: "bash", Arch: "x86_64", From: "5.2.37-1.fc42", To: "5.2.37-2.fc43"},
+		{Name: "kernel", Arch: "x86_64", From: "6.14.0-63.fc42", To: "6.15.0-1.fc43"},
+	}, osPipeline.UpdatedPackages)
+	assert.Equal(t, []string{"org.osbuild.chrony"}, osPipeline.AddedStages)
+	assert.Empty(t, osPipeline.RemovedStages)
+	assert.Equal(t, []string{"org.osbuild.locale"}, osPipeline.ReorderedStages)
+	assert.Equal(t, []manifestdiff.StageChanges{
+		{
+			Stage: "org.osbuild.kernel-cmdline",
+			Changes: []manifestdiff.Change{
+				{Path: "options.kernel_opts", From: `"console=tty0"`, To: `"console=ttyS0"`},
+			},
+		},
+		{
+			Stage: "org.osbuild.copy#2",
+			Changes: []manifestdiff.Change{
+				{Path: "options.paths[0].to", From: `"tree:///b"`, To: `"tree:///c"`},
+			},
+		},
+	}, osPipeline.Stages)
+
+	assert.Equal(t, []manifestdiff.SourceChanges{
+		{
+			Source: "org.osbuild.curl",
+			Changed: []manifestdiff.Change{
+				{Path: "key.gpg", From: "sha256:0a", To: "sha256:1a"},
+			},
+		},
+	}, report.Sources)
+
+	assert.Equal(t, `- pipeline "qcow2"
++ pipeline "vmdk"
+pipeline "build":
+  ~ runner: "org.osbuild.fedora42" -> "org.osbuild.fedora43"
+  packages:
+    ~ bash.x86_64: 5.2.37-1.fc42 -> 5.2.37-2.fc43
+pipeline "os":
+  packages:
+    - telnet-0.17-94.fc42.x86_64
+    + tmux-3.5a-4.fc43.x86_64
+    ~ bash.x86_64: 5.2.37-1.fc42 -> 5.2.37-2.fc43
+    ~ kernel.x86_64: 6.14.0-63.fc42 -> 6.15.0-1.fc43
+  + stage org.osbuild.chrony
+  ~ stage org.osbuild.locale moved
+  stage org.osbuild.kernel-cmdline:
+    ~ options.kernel_opts: "console=tty0" -> "console=ttyS0"
+  stage org.osbuild.copy#2:
+    ~ options.paths[0].to: "tree:///b" -> "tree:///c"
+source org.osbuild.curl:
+  ~ key.gpg: sha256:0a -> sha256:1a
+`, report.String())
+}
+
+func TestDiffIdentical(t *testing.T) {
+	report, err := manifestdiff.Diff([]byte(oldManifest), []byte(oldManifest))
+	require.NoError(t, err)
+	assert.True(t, report.Empty())
+	assert.Equal(t, "", report.String())
+}
+
+func TestDiffAddedOption(t *testing.T) {
+	a := `{"version": "2", "pipelines": [{"name": "os", "stages": [{"type": "org.osbuild.tar", "options": {"filename": "a.tar"}}]}]}`
+	b := `{"version": "2", "pipelines": [{"name": "os", "source-epoch": 0, "stages": [{"type": "org.osbuild.tar", "options": {"filename": "a.tar", "source-date-epoch": 0}}]}]}`
+	report, err := manifestdiff.Diff([]byte(a), []byte(b))
+	require.NoError(t, err)
+	require.Len(t, report.Pipelines, 1)
+	assert.Equal(t, []manifestdiff.Change{{Path: "source-epoch", To: "0"}}, report.Pipelines[0].Changes)
+	assert.Equal(t, []manifestdiff.StageChanges{
+		{Stage: "org.osbuild.tar", Changes: []manifestdiff.Change{{Path: "options.source-date-epoch", To: "0"}}},
+	}, report.Pipelines[0].Stages)
+
+	report, err = manifestdiff.Diff([]byte(b), []byte(a))
+	require.NoError(t, err)
+	assert.Equal(t, []manifestdiff.StageChanges{
+		{Stage: "org.osbuild.tar", Changes: []manifestdiff.Change{{Path: "options.source-date-epoch", From: "0"}}},
+	}, report.Pipelines[0].Stages)
+}
+
+func TestDiffErrors(t *testing.T) {
+	_, err := manifestdiff.Diff([]byte("{"), []byte(oldManifest))
+	assert.ErrorContains(t, err, "cannot load first manifest")
+	_, err = manifestdiff.Diff([]byte(oldManifest), []byte(`{"pipelines": []}`))
+	assert.ErrorContains(t, err, `only version 2 manifests are supported, got "2" and ""`)
+}
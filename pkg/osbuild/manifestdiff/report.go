@@ -0,0 +1,82 @@
+package manifestdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+func writeChange(sb *strings.Builder, indent string, c Change) {
+	switch {
+	case c.From == "":
+		fmt.Fprintf(sb, "%s+ %s: %s\n", indent, c.Path, c.To)
+	case c.To == "":
+		fmt.Fprintf(sb, "%s- %s: %s\n", indent, c.Path, c.From)
+	default:
+		fmt.Fprintf(sb, "%s~ %s: %s -> %s\n", indent, c.Path, c.From, c.To)
+	}
+}
+
+// String renders the report for humans, e.g.
+//
+//	pipeline "os":
+//	  packages:
+//	    + tmux-3.3a-9.el9.x86_64
+//	    ~ kernel.x86_64: 5.14.0-570.el9 -> 5.14.0-580.el9
+//	  + stage org.osbuild.chrony
+//	  stage org.osbuild.kernel-cmdline:
+//	    ~ options.kernel_opts: "console=tty0" -> "console=ttyS0"
+func (r *Report) String() string {
+	var sb strings.Builder
+	for _, name := range r.RemovedPipelines {
+		fmt.Fprintf(&sb, "- pipeline %q\n", name)
+	}
+	for _, name := range r.AddedPipelines {
+		fmt.Fprintf(&sb, "+ pipeline %q\n", name)
+	}
+	for _, pc := range r.Pipelines {
+		fmt.Fprintf(&sb, "pipeline %q:\n", pc.Name)
+		for _, c := range pc.Changes {
+			writeChange(&sb, "  ", c)
+		}
+		if len(pc.AddedPackages) > 0 || len(pc.RemovedPackages) > 0 || len(pc.UpdatedPackages) > 0 {
+			sb.WriteString("  packages:\n")
+			for _, pkg := range pc.RemovedPackages {
+				fmt.Fprintf(&sb, "    - %s\n", pkg)
+			}
+			for _, pkg := range pc.AddedPackages {
+				fmt.Fprintf(&sb, "    + %s\n", pkg)
+			}
+			for _, pkg := range pc.UpdatedPackages {
+				fmt.Fprintf(&sb, "    ~ %s.%s: %s -> %s\n", pkg.Name, pkg.Arch, pkg.From, pkg.To)
+			}
+		}
+		for _, key := range pc.RemovedStages {
+			fmt.Fprintf(&sb, "  - stage %s\n", key)
+		}
+		for _, key := range pc.AddedStages {
+			fmt.Fprintf(&sb, "  + stage %s\n", key)
+		}
+		for _, key := range pc.ReorderedStages {
+			fmt.Fprintf(&sb, "  ~ stage %s moved\n", key)
+		}
+		for _, sc := range pc.Stages {
+			fmt.Fprintf(&sb, "  stage %s:\n", sc.Stage)
+			for _, c := range sc.Changes {
+				writeChange(&sb, "    ", c)
+			}
+		}
+	}
+	for _, sc := range r.Sources {
+		fmt.Fprintf(&sb, "source %s:\n", sc.Source)
+		for _, item := range sc.Removed {
+			fmt.Fprintf(&sb, "  - %s\n", item)
+		}
+		for _, item := range sc.Added {
+			fmt.Fprintf(&sb, "  + %s\n", item)
+		}
+		for _, c := range sc.Changed {
+			writeChange(&sb, "  ", c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package osbuild
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// Create an md RAID array on the member devices.
+
+const mdadmNameRegex = `^[a-zA-Z0-9_.-]+$`
+
+type MDAdmCreateStageOptions struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+
+	// RAID level
+	Level string `json:"level"`
+
+	// Total number of member devices of the array
+	RaidDevices uint `json:"raid_devices"`
+
+	// Names of the devices of the members, in the order of the array
+	Devices []string `json:"devices"`
+
+	// Superblock format ("1.0" or "1.2")
+	Metadata string `json:"metadata"`
+
+	// Offset of the data on the member devices (metadata 1.2 only), in a
+	// format understood by mdadm(8), e.g. "8M"
+	DataOffset string `json:"data_offset,omitempty"`
+}
+
+func (MDAdmCreateStageOptions) isStageOptions() {}
+
+func (o MDAdmCreateStageOptions) validate() error {
+	nameRegex := regexp.MustCompile(mdadmNameRegex)
+	if !nameRegex.MatchString(o.Name) {
+		return fmt.Errorf("array name %q doesn't conform to schema (%s)", o.Name, nameRegex.String())
+	}
+	if !slices.Contains([]string{"raid0", "raid1", "raid5", "raid6", "raid10"}, o.Level) {
+		return fmt.Errorf("unsupported raid level %q for array %q", o.Level, o.Name)
+	}
+	if o.RaidDevices < 2 {
+		return fmt.Errorf("array %q requires at least 2 devices, got %d", o.Name, o.RaidDevices)
+	}
+	if uint(len(o.Devices)) != o.RaidDevices {
+		return fmt.Errorf("array %q has %d raid devices but %d member devices", o.Name, o.RaidDevices, len(o.Devices))
+	}
+	switch o.Metadata {
+	case "1.0":
+		if o.DataOffset != "" {
+			return fmt.Errorf("data offset is not supported with metadata %q for array %q", o.Metadata, o.Name)
+		}
+	case "1.2":
+	default:
+		return fmt.Errorf("unsupported metadata %q for array %q", o.Metadata, o.Name)
+	}
+	return nil
+}
+
+func NewMDAdmCreateStage(options *MDAdmCreateStageOptions, devices map[string]Device) *Stage {
+	if err := options.validate(); err != nil {
+		panic(err)
+	}
+
+	return &Stage{
+		Type:    "org.osbuild.mdadm.create",
+		Options: options,
+		Devices: devices,
+	}
+}
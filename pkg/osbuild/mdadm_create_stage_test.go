@@ -0,0 +1,32 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMDAdmCreateStageValidation(t *testing.T) {
+	okOptions := []MDAdmCreateStageOptions{
+		{Name: "root", Level: "raid1", RaidDevices: 2, Devices: []string{"a", "b"}, Metadata: "1.2", DataOffset: "8192K"},
+		{Name: "boot", Level: "raid1", RaidDevices: 3, Devices: []string{"a", "b", "c"}, Metadata: "1.0"},
+		{Name: "var-log_1.0", Level: "raid1", RaidDevices: 2, Devices: []string{"a", "b"}, Metadata: "1.2"},
+		{Name: "data", Level: "raid5", RaidDevices: 3, Devices: []string{"a", "b", "c"}, Metadata: "1.2"},
+	}
+	for _, options := range okOptions {
+		assert.NoError(t, options.validate(), options.Name)
+	}
+
+	badOptions := map[string]MDAdmCreateStageOptions{
+		`array name "" doesn't conform to schema (^[a-zA-Z0-9_.-]+$)`:        {Level: "raid1", RaidDevices: 2, Devices: []string{"a", "b"}, Metadata: "1.2"},
+		`array name "md/root" doesn't conform to schema (^[a-zA-Z0-9_.-]+$)`: {Name: "md/root", Level: "raid1", RaidDevices: 2, Devices: []string{"a", "b"}, Metadata: "1.2"},
+		`unsupported raid level "linear" for array "root"`:                   {Name: "root", Level: "linear", RaidDevices: 2, Devices: []string{"a", "b"}, Metadata: "1.2"},
+		`array "root" requires at least 2 devices, got 1`:                    {Name: "root", Level: "raid1", RaidDevices: 1, Devices: []string{"a"}, Metadata: "1.2"},
+		`array "root" has 2 raid devices but 1 member devices`:               {Name: "root", Level: "raid1", RaidDevices: 2, Devices: []string{"a"}, Metadata: "1.2"},
+		`unsupported metadata "0.90" for array "root"`:                       {Name: "root", Level: "raid1", RaidDevices: 2, Devices: []string{"a", "b"}, Metadata: "0.90"},
+		`data offset is not supported with metadata "1.0" for array "root"`:  {Name: "root", Level: "raid1", RaidDevices: 2, Devices: []string{"a", "b"}, Metadata: "1.0", DataOffset: "8192K"},
+	}
+	for expectedErr, options := range badOptions {
+		assert.EqualError(t, options.validate(), expectedErr)
+	}
+}
@@ -0,0 +1,21 @@
+package osbuild
+
+// Assemble an md RAID array from its member devices
+
+type MDAdmDeviceOptions struct {
+	UUID string `json:"uuid"`
+
+	// Names of the devices of all members of the array, including the
+	// parent
+	Devices []string `json:"devices"`
+}
+
+func (MDAdmDeviceOptions) isDeviceOptions() {}
+
+func NewMDAdmDevice(parent string, options *MDAdmDeviceOptions) *Device {
+	return &Device{
+		Type:    "org.osbuild.mdadm",
+		Parent:  parent,
+		Options: options,
+	}
+}
@@ -0,0 +1,16 @@
+package osbuild
+
+type MkfsExt2StageOptions struct {
+	UUID  string `json:"uuid"`
+	Label string `json:"label,omitempty"`
+}
+
+func (MkfsExt2StageOptions) isStageOptions() {}
+
+func NewMkfsExt2Stage(options *MkfsExt2StageOptions, devices map[string]Device) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.mkfs.ext2",
+		Options: options,
+		Devices: devices,
+	}
+}
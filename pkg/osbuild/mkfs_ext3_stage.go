@@ -0,0 +1,16 @@
+package osbuild
+
+type MkfsExt3StageOptions struct {
+	UUID  string `json:"uuid"`
+	Label string `json:"label,omitempty"`
+}
+
+func (MkfsExt3StageOptions) isStageOptions() {}
+
+func NewMkfsExt3Stage(options *MkfsExt3StageOptions, devices map[string]Device) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.mkfs.ext3",
+		Options: options,
+		Devices: devices,
+	}
+}
@@ -0,0 +1,16 @@
+package osbuild
+
+type MkfsF2fsStageOptions struct {
+	UUID  string `json:"uuid"`
+	Label string `json:"label,omitempty"`
+}
+
+func (MkfsF2fsStageOptions) isStageOptions() {}
+
+func NewMkfsF2fsStage(options *MkfsF2fsStageOptions, devices map[string]Device) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.mkfs.f2fs",
+		Options: options,
+		Devices: devices,
+	}
+}
@@ -27,6 +27,10 @@ func getDevicesForFsStage(path []disk.Entity, filename string) map[string]Device
 // GenFsStages generates a list of stages that create the filesystem and other
 // related entities. Specifically, it creates stages for:
 //   - org.osbuild.mkfs.*: for all filesystems and btrfs volumes
+//   - org.osbuild.erofs and org.osbuild.squashfs followed by
+//     org.osbuild.write-device: for read-only filesystems, which are
+//     generated from the content of the source pipeline under their
+//     mountpoint
 //   - org.osbuild.btrfs.subvol: for all btrfs subvolumes
 //   - org.osbuild.mkswap: for swap areas
 func GenFsStages(pt *disk.PartitionTable, filename string, soucePipeline string) []*Stage {
@@ -71,6 +75,26 @@ func GenFsStages(pt *disk.PartitionTable, filename string, soucePipeline string)
 				}
 
 				stages = append(stages, NewMkfsExt4Stage(options, stageDevices))
+			case "ext2":
+				options := &MkfsExt2StageOptions{
+					UUID:  e.UUID,
+					Label: e.Label,
+				}
+				stages = append(stages, NewMkfsExt2Stage(options, stageDevices))
+			case "ext3":
+				options := &MkfsExt3StageOptions{
+					UUID:  e.UUID,
+					Label: e.Label,
+				}
+				stages = append(stages, NewMkfsExt3Stage(options, stageDevices))
+			case "f2fs":
+				options := &MkfsF2fsStageOptions{
+					UUID:  e.UUID,
+					Label: e.Label,
+				}
+				stages = append(stages, NewMkfsF2fsStage(options, stageDevices))
+			case "erofs", "squashfs":
+				stages = append(stages, genReadOnlyFsStages(e, filename, soucePipeline, stageDevices)...)
 			default:
 				panic(fmt.Sprintf("unknown fs type: %s for %s", e.GetFSType(), e.GetMountpoint()))
 			}
@@ -127,3 +151,48 @@ func GenFsStages(pt *disk.PartitionTable, filename string, soucePipeline string)
 	return stages
 
 }
+
+// readOnlyFsImageFilename returns the name of the file that the image of a
+// read-only filesystem is generated into before it is written onto its
+// device.
+func readOnlyFsImageFilename(filename string, fs *disk.Filesystem) string {
+	return fmt.Sprintf("%s.%s.%s", filename, pathEscape(fs.Mountpoint), fs.Type)
+}
+
+// genReadOnlyFsStages generates the stages for a read-only filesystem: the
+// filesystem image is created from the source pipeline tree under the
+// mountpoint of the filesystem and then written onto the device.
+func genReadOnlyFsStages(fs *disk.Filesystem, filename, sourcePipeline string, devices map[string]Device) []*Stage {
+	inputName := "tree"
+	inputs := NewPipelineTreeInputs(inputName, sourcePipeline)
+	source := fmt.Sprintf("input://%s/%s", inputName, strings.TrimLeft(fs.Mountpoint, "/"))
+	image := readOnlyFsImageFilename(filename, fs)
+
+	var stage *Stage
+	switch fs.Type {
+	case "erofs":
+		options := &ErofsStageOptions{
+			Filename: image,
+			Source:   source,
+			UUID:     fs.UUID,
+			Label:    fs.Label,
+		}
+		stage = NewErofsWithMountsStage(options, inputs, nil, nil)
+	case "squashfs":
+		options := &SquashfsStageOptions{
+			Filename: image,
+			Source:   source,
+			Compression: FSCompression{
+				Method: "xz",
+			},
+		}
+		stage = NewSquashfsWithMountsStage(options, inputs, nil, nil)
+	default:
+		panic(fmt.Sprintf("fs type: %s is not a read-only filesystem", fs.Type))
+	}
+
+	writeOptions := &WriteDeviceStageOptions{
+		From: fmt.Sprintf("tree:///%s", image),
+	}
+	return []*Stage{stage, NewWriteDeviceStage(writeOptions, nil, devices)}
+}
@@ -476,6 +476,104 @@ func TestGenFsStagesUnitExt4Verity(t *testing.T) {
 	}, stages)
 }
 
+func TestGenFsStagesUnitExtF2fs(t *testing.T) {
+	for fsType, expected := range map[string]*Stage{
+		"ext2": {
+			Type:    "org.osbuild.mkfs.ext2",
+			Options: &MkfsExt2StageOptions{UUID: "uuid", Label: "label"},
+			Devices: defaultStageDevices,
+		},
+		"ext3": {
+			Type:    "org.osbuild.mkfs.ext3",
+			Options: &MkfsExt3StageOptions{UUID: "uuid", Label: "label"},
+			Devices: defaultStageDevices,
+		},
+		"f2fs": {
+			Type:    "org.osbuild.mkfs.f2fs",
+			Options: &MkfsF2fsStageOptions{UUID: "uuid", Label: "label"},
+			Devices: defaultStageDevices,
+		},
+	} {
+		t.Run(fsType, func(t *testing.T) {
+			pt := &disk.PartitionTable{
+				Type: disk.PT_GPT,
+				Partitions: []disk.Partition{
+					{
+						Payload: &disk.Filesystem{
+							Type:       fsType,
+							UUID:       "uuid",
+							Label:      "label",
+							Mountpoint: "/data",
+						},
+					},
+				},
+			}
+			stages := GenFsStages(pt, "file.img", "build")
+			assert.Equal(t, []*Stage{expected}, stages)
+		})
+	}
+}
+
+func TestGenFsStagesUnitReadOnly(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{
+					Type:       "erofs",
+					UUID:       "uuid",
+					Label:      "usr",
+					Mountpoint: "/usr",
+				},
+			},
+			{
+				Payload: &disk.Filesystem{
+					Type:       "squashfs",
+					Mountpoint: "/srv/data",
+				},
+			},
+		},
+	}
+	stages := GenFsStages(pt, "file.img", "build")
+	assert.Equal(t, []*Stage{
+		{
+			Type: "org.osbuild.erofs",
+			Options: &ErofsStageOptions{
+				Filename: "file.img.usr.erofs",
+				Source:   "input://tree/usr",
+				UUID:     "uuid",
+				Label:    "usr",
+			},
+			Inputs: NewPipelineTreeInputs("tree", "build"),
+		},
+		{
+			Type: "org.osbuild.write-device",
+			Options: &WriteDeviceStageOptions{
+				From: "tree:///file.img.usr.erofs",
+			},
+			Devices: defaultStageDevices,
+		},
+		{
+			Type: "org.osbuild.squashfs",
+			Options: &SquashfsStageOptions{
+				Filename: "file.img.srv-data.squashfs",
+				Source:   "input://tree/srv/data",
+				Compression: FSCompression{
+					Method: "xz",
+				},
+			},
+			Inputs: NewPipelineTreeInputs("tree", "build"),
+		},
+		{
+			Type: "org.osbuild.write-device",
+			Options: &WriteDeviceStageOptions{
+				From: "tree:///file.img.srv-data.squashfs",
+			},
+			Devices: defaultStageDevices,
+		},
+	}, stages)
+}
+
 func TestGenFsStagesUnitVfatGeometry(t *testing.T) {
 	pt := &disk.PartitionTable{
 		Type: disk.PT_GPT,
@@ -515,14 +613,14 @@ func TestGenFsStagesUnhappy(t *testing.T) {
 		Partitions: []disk.Partition{
 			{
 				Payload: &disk.Filesystem{
-					Type:       "ext2",
+					Type:       "ntfs",
 					Mountpoint: "/",
 				},
 			},
 		},
 	}
 
-	assert.PanicsWithValue(t, "unknown fs type: ext2 for /", func() {
+	assert.PanicsWithValue(t, "unknown fs type: ntfs for /", func() {
 		GenFsStages(pt, "file.img", "build")
 	})
 }
@@ -0,0 +1,58 @@
+package osbuild
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// MokutilStageOptions are the options of the org.osbuild.mokutil stage. EFI
+// variables cannot be written when the image is built, so the stage sets up
+// an import request of the machine owner keys that is made on the first
+// boot; the enrollment is then confirmed in MokManager on the next boot.
+//
+// NOTE: org.osbuild.mokutil is a new stage, it does not exist in osbuild yet
+// and needs a matching stage there (stages/org.osbuild.mokutil) before
+// manifests with it can be built.
+type MokutilStageOptions struct {
+	MOKs []MOKImport `json:"moks"`
+}
+
+// MOKImport is a DER encoded certificate in the tree to enroll as a machine
+// owner key.
+type MOKImport struct {
+	Path string `json:"path"`
+
+	// PasswordHash is the crypt(3) hash of the password that confirms
+	// the enrollment in MokManager (mokutil --hash-file), the password
+	// itself is never part of the manifest
+	PasswordHash string `json:"password_hash"`
+}
+
+func (MokutilStageOptions) isStageOptions() {}
+
+func (o *MokutilStageOptions) validate() error {
+	if len(o.MOKs) == 0 {
+		return fmt.Errorf("mokutil: 'moks' is a required property")
+	}
+	for _, mok := range o.MOKs {
+		if !filepath.IsAbs(mok.Path) {
+			return fmt.Errorf("mokutil: path %q must be absolute", mok.Path)
+		}
+		if mok.PasswordHash == "" {
+			return fmt.Errorf("mokutil: a password hash is required to enroll %q", mok.Path)
+		}
+	}
+	return nil
+}
+
+// NewMokutilStage creates a new org.osbuild.mokutil stage
+func NewMokutilStage(options *MokutilStageOptions) *Stage {
+	if err := options.validate(); err != nil {
+		panic(err)
+	}
+
+	return &Stage{
+		Type:    "org.osbuild.mokutil",
+		Options: options,
+	}
+}
@@ -0,0 +1,51 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMokutilStage(t *testing.T) {
+	options := &MokutilStageOptions{
+		MOKs: []MOKImport{{Path: "/etc/pki/secureboot/secureboot.der", PasswordHash: "$6$salt$hash"}},
+	}
+	expectedStage := &Stage{
+		Type:    "org.osbuild.mokutil",
+		Options: options,
+	}
+	assert.Equal(t, expectedStage, NewMokutilStage(options))
+}
+
+func TestMokutilStageOptionsValidate(t *testing.T) {
+	testCases := map[string]struct {
+		options *MokutilStageOptions
+		expErr  string
+	}{
+		"good": {
+			options: &MokutilStageOptions{MOKs: []MOKImport{{Path: "/etc/pki/mok.der", PasswordHash: "$6$salt$hash"}}},
+		},
+		"no-moks": {
+			options: &MokutilStageOptions{},
+			expErr:  "mokutil: 'moks' is a required property",
+		},
+		"relative": {
+			options: &MokutilStageOptions{MOKs: []MOKImport{{Path: "mok.der", PasswordHash: "$6$salt$hash"}}},
+			expErr:  `mokutil: path "mok.der" must be absolute`,
+		},
+		"no-password": {
+			options: &MokutilStageOptions{MOKs: []MOKImport{{Path: "/etc/pki/mok.der"}}},
+			expErr:  `mokutil: a password hash is required to enroll "/etc/pki/mok.der"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.options.validate()
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expErr)
+			}
+		})
+	}
+}
@@ -92,6 +92,11 @@ type StatusScanner struct {
 	stageContextMap map[string]*stageContextJSON
 	resultMap       map[string]*resultJSON
 	metadataMap     map[string]json.RawMessage
+
+	// context and result of the current line, used by the
+	// ProgressTracker
+	currentContext *contextJSON
+	currentResult  *resultJSON
 }
 
 // Status returns a single status struct from the scanner or nil
@@ -122,6 +127,8 @@ func (sr *StatusScanner) Status() (*Status, error) {
 		sr.contextMap[id] = &status.Context
 		context = &status.Context
 	}
+	sr.currentContext = context
+	sr.currentResult = nil
 	ts := time.UnixMilli(int64(status.Timestamp * 1000))
 	pipelineName := context.Pipeline.Name
 
@@ -178,6 +185,7 @@ func (sr *StatusScanner) Status() (*Status, error) {
 	// add result if set
 	if status.Result.ID != "" {
 		sr.resultMap[id] = &status.Result
+		sr.currentResult = &status.Result
 	}
 	if len(status.Metadata) > 0 {
 		sr.metadataMap[id] = status.Metadata
@@ -48,6 +48,17 @@ func TestNewMounts(t *testing.T) {
 		assert.Equal(expected, actual)
 	}
 
+	{ // f2fs
+		actual := osbuild.NewF2fsMount("f2fs", "/dev/sda5", "/mnt/f2fs")
+		expected := &osbuild.Mount{
+			Name:   "f2fs",
+			Type:   "org.osbuild.f2fs",
+			Source: "/dev/sda5",
+			Target: "/mnt/f2fs",
+		}
+		assert.Equal(expected, actual)
+	}
+
 	{ // xfs
 		actual := osbuild.NewXfsMount("xfs", "/dev/sda4", "/mnt/xfs")
 		expected := &osbuild.Mount{
@@ -49,6 +49,12 @@ type OSBuildOptions struct {
 	Monitor     MonitorType
 	MonitorFile *os.File
 
+	// If Progress is set, RunOSBuild monitors the build and calls it
+	// with the progress events, see ProgressTracker. It cannot be used
+	// together with MonitorFile. The wall time of the stages is then
+	// recorded in the result as well.
+	Progress func(*Event) error
+
 	JSONOutput bool
 
 	CacheMaxSize int64
@@ -146,6 +152,33 @@ func RunOSBuild(manifest []byte, optsPtr *OSBuildOptions) (*Result, error) {
 		return nil, err
 	}
 
+	var progressDone chan error
+	var timings TimingRecorder
+	if opts.Progress != nil {
+		if opts.MonitorFile != nil {
+			return nil, fmt.Errorf("progress cannot be used with a monitor file")
+		}
+		rp, wp, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("error creating monitor pipe: %v", err)
+		}
+		defer wp.Close()
+		opts.Monitor = MonitorJSONSeq
+		opts.MonitorFile = wp
+
+		progressDone = make(chan error, 1)
+		go func() {
+			defer rp.Close()
+			err := NewProgressTracker(rp).Run(func(ev *Event) error {
+				_ = timings.Record(ev)
+				return opts.Progress(ev)
+			})
+			// keep reading so osbuild never blocks on the monitor
+			_, _ = io.Copy(io.Discard, rp)
+			progressDone <- err
+		}()
+	}
+
 	var stdoutBuffer bytes.Buffer
 	var res Result
 	cmd := NewOSBuildCmd(manifest, &opts)
@@ -154,10 +187,19 @@ func RunOSBuild(manifest []byte, optsPtr *OSBuildOptions) (*Result, error) {
 		cmd.Stdout = &stdoutBuffer
 	}
 	err := cmd.Start()
+	if progressDone != nil {
+		// only osbuild writes to the monitor now, the progress
+		// tracker gets an EOF when it exits
+		opts.MonitorFile.Close()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error starting osbuild: %v", err)
 	}
 	err = cmd.Wait()
+	var progressErr error
+	if progressDone != nil {
+		progressErr = <-progressDone
+	}
 
 	if opts.JSONOutput {
 		// try to decode the output even though the job could have failed
@@ -168,14 +210,23 @@ func RunOSBuild(manifest []byte, optsPtr *OSBuildOptions) (*Result, error) {
 		if decodeErr != nil {
 			return nil, fmt.Errorf("error decoding osbuild output: %v\nthe raw output:\n%s", decodeErr, stdoutBuffer.String())
 		}
+		if progressDone != nil {
+			res.setStageDurations(timings.Durations())
+		}
 	}
 
 	if err != nil {
 		// ignore ExitError if output could be decoded correctly (only if running with --json)
 		if _, isExitError := err.(*exec.ExitError); !isExitError || !opts.JSONOutput {
+			if progressErr != nil {
+				return nil, fmt.Errorf("running osbuild failed: %v (error reporting osbuild progress: %w)", err, progressErr)
+			}
 			return nil, fmt.Errorf("running osbuild failed: %v", err)
 		}
 	}
+	if progressErr != nil {
+		return nil, fmt.Errorf("error reporting osbuild progress: %w", progressErr)
+	}
 
 	return &res, nil
 }
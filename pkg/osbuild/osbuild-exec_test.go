@@ -3,6 +3,7 @@ package osbuild_test
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/osbuild/images/pkg/datasizes"
 	"github.com/osbuild/images/pkg/osbuild"
@@ -199,6 +201,106 @@ fi
 	assert.Equal(t, "osbuild-stderr-output", stderr.String())
 }
 
+func TestRunOSBuildProgress(t *testing.T) {
+	fakeOSBuildBinary := makeFakeOSBuild(t, `
+if [ "$1" = "--version" ]; then
+    echo '90000.0'
+    exit 0
+fi
+>&3 echo '{"message": "Starting pipeline os", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1"}, "id": "c1"}, "progress": {"name": "pipelines/sources", "total": 1, "done": 0}, "timestamp": 1000.0}'
+>&3 echo '{"message": "Finished pipeline os", "context": {"id": "c1"}, "progress": {"name": "pipelines/sources", "total": 1, "done": 1}, "timestamp": 1002.0}'
+`)
+	restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+	defer restore()
+
+	var events []osbuild.Event
+	opts := &osbuild.OSBuildOptions{
+		Progress: func(ev *osbuild.Event) error {
+			events = append(events, *ev)
+			return nil
+		},
+	}
+	_, err := osbuild.RunOSBuild(nil, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []osbuild.Event{
+		{
+			Type:      osbuild.EventPipelineStart,
+			Timestamp: time.UnixMilli(1000000),
+			Pipeline:  "os",
+			Message:   "Starting pipeline os",
+		},
+		{
+			Type:      osbuild.EventPipelineEnd,
+			Timestamp: time.UnixMilli(1002000),
+			Pipeline:  "os",
+			Percent:   100,
+			Duration:  2 * time.Second,
+			Success:   true,
+		},
+	}, events)
+
+	opts.Progress = func(ev *osbuild.Event) error {
+		return fmt.Errorf("cannot send %s", ev.Type)
+	}
+	_, err = osbuild.RunOSBuild(nil, opts)
+	assert.EqualError(t, err, "error reporting osbuild progress: cannot send pipeline-start")
+}
+
+func TestRunOSBuildProgressBuildFailure(t *testing.T) {
+	fakeOSBuildBinary := makeFakeOSBuild(t, `
+if [ "$1" = "--version" ]; then
+    echo '90000.0'
+    exit 0
+fi
+>&3 echo '{"message": "Starting pipeline os", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1"}, "id": "c1"}, "progress": {"name": "pipelines/sources", "total": 1, "done": 0}, "timestamp": 1000.0}'
+exit 1
+`)
+	restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+	defer restore()
+
+	// the build error is reported first, the progress error is wrapped
+	errProgress := errors.New("cannot send progress")
+	opts := &osbuild.OSBuildOptions{
+		Progress: func(ev *osbuild.Event) error {
+			return errProgress
+		},
+	}
+	_, err := osbuild.RunOSBuild(nil, opts)
+	assert.EqualError(t, err, "running osbuild failed: exit status 1 (error reporting osbuild progress: cannot send progress)")
+	assert.ErrorIs(t, err, errProgress)
+
+	opts.Progress = func(ev *osbuild.Event) error {
+		return nil
+	}
+	_, err = osbuild.RunOSBuild(nil, opts)
+	assert.EqualError(t, err, "running osbuild failed: exit status 1")
+}
+
+func TestRunOSBuildProgressStageDurations(t *testing.T) {
+	fakeOSBuildBinary := makeFakeOSBuild(t, `
+if [ "$1" = "--version" ]; then
+    echo '90000.0'
+    exit 0
+fi
+>&3 echo '{"message": "Starting pipeline os", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1"}, "id": "c1"}, "progress": {"name": "pipelines/sources", "total": 1, "done": 0}, "timestamp": 1000.0}'
+>&3 echo '{"message": "Starting module org.osbuild.rpm", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1", "stage": {"name": "org.osbuild.rpm", "id": "s1"}}, "id": "c2"}, "progress": {"name": "pipelines/sources", "total": 1, "done": 0}, "timestamp": 1000.5}'
+>&3 echo '{"message": "Finished module org.osbuild.rpm", "result": {"name": "org.osbuild.rpm", "id": "s1", "success": true, "output": ""}, "context": {"id": "c2"}, "duration": 1.25, "progress": {"name": "pipelines/sources", "total": 1, "done": 1}, "timestamp": 1002.0}'
+echo '{"type": "result", "success": true, "log": {"os": [{"id": "s1", "type": "org.osbuild.rpm", "output": "", "success": true}]}, "metadata": {}}'
+`)
+	restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+	defer restore()
+
+	res, err := osbuild.RunOSBuild(nil, &osbuild.OSBuildOptions{
+		JSONOutput: true,
+		Progress: func(ev *osbuild.Event) error {
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Log["os"], 1)
+	assert.Equal(t, 1250*time.Millisecond, res.Log["os"][0].Duration)
+}
+
 func TestSyncWriter(t *testing.T) {
 	var mu sync.Mutex
 	var buf bytes.Buffer
@@ -28,6 +28,10 @@ type Pipeline struct {
 
 	Runner string `json:"runner,omitempty"`
 
+	// SourceEpoch is exported as SOURCE_DATE_EPOCH to the stages of the
+	// pipeline, in seconds since the Unix epoch.
+	SourceEpoch *int64 `json:"source-epoch,omitempty"`
+
 	// Sequence of stages that produce the filesystem tree, which is the
 	// payload of the produced image.
 	Stages []*Stage `json:"stages,omitempty"`
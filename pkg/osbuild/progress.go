@@ -0,0 +1,273 @@
+package osbuild
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// EventType is the type of a progress Event.
+type EventType string
+
+const (
+	EventPipelineStart EventType = "pipeline-start"
+	EventPipelineEnd   EventType = "pipeline-end"
+	EventStageStart    EventType = "stage-start"
+	EventStageEnd      EventType = "stage-end"
+	EventLog           EventType = "log"
+)
+
+// Event is a structured progress event of an osbuild build, as produced by
+// a ProgressTracker from the osbuild monitor output.
+type Event struct {
+	Type EventType
+
+	// Timestamp of the event as reported by osbuild
+	Timestamp time.Time
+
+	// Pipeline is the name of the current pipeline, sources are
+	// reported as pipelines as well (e.g. "source org.osbuild.curl")
+	Pipeline string
+	// Stage is the name of the current stage (e.g. "org.osbuild.rpm"),
+	// empty for pipeline events
+	Stage string
+	// StageID is the osbuild ID of the current stage
+	StageID string
+
+	// Percent is the overall progress of the build, from 0 to 100
+	Percent float64
+
+	// Duration of the pipeline or stage, only set for end events
+	Duration time.Duration
+	// Success of the pipeline or stage, only set for end events
+	Success bool
+
+	// Message is the log line for log events and the osbuild status
+	// message for other events
+	Message string
+}
+
+type eventJSON struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Pipeline  string    `json:"pipeline,omitempty"`
+	Stage     string    `json:"stage,omitempty"`
+	StageID   string    `json:"stage-id,omitempty"`
+	Percent   float64   `json:"percent"`
+	// Duration is in seconds
+	Duration float64 `json:"duration,omitempty"`
+	Success  *bool   `json:"success,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// MarshalJSON encodes the event with the duration in seconds, the success
+// is only included for end events.
+func (ev Event) MarshalJSON() ([]byte, error) {
+	evj := eventJSON{
+		Type:      ev.Type,
+		Timestamp: ev.Timestamp,
+		Pipeline:  ev.Pipeline,
+		Stage:     ev.Stage,
+		StageID:   ev.StageID,
+		Percent:   ev.Percent,
+		Duration:  ev.Duration.Seconds(),
+		Message:   ev.Message,
+	}
+	if ev.Type == EventPipelineEnd || ev.Type == EventStageEnd {
+		evj.Success = &ev.Success
+	}
+	return json.Marshal(evj)
+}
+
+// ProgressJSONWriter writes progress events as JSON lines, e.g. to forward
+// them to web clients.
+type ProgressJSONWriter struct {
+	enc *json.Encoder
+}
+
+// NewProgressJSONWriter returns a ProgressJSONWriter that writes to w.
+func NewProgressJSONWriter(w io.Writer) *ProgressJSONWriter {
+	return &ProgressJSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes a single event as a line of JSON, it can be used as the
+// callback of ProgressTracker.Run.
+func (pw *ProgressJSONWriter) Write(ev *Event) error {
+	return pw.enc.Encode(ev)
+}
+
+// ProgressTracker turns the status entries of a StatusScanner into progress
+// events: start and end events for every pipeline and stage and log events
+// for the output of the stages.
+type ProgressTracker struct {
+	scanner *StatusScanner
+
+	pipeline       string
+	pipelineStart  time.Time
+	pipelineFailed bool
+
+	stageID    string
+	stage      string
+	stageStart time.Time
+
+	percent   float64
+	timestamp time.Time
+
+	// contexts are the IDs of the monitor contexts seen so far, only
+	// new contexts start pipelines and stages
+	contexts map[string]bool
+
+	queue []*Event
+	done  bool
+}
+
+// NewProgressTracker returns a ProgressTracker for the osbuild jsonseq
+// monitor output in r.
+func NewProgressTracker(r io.Reader) *ProgressTracker {
+	return &ProgressTracker{
+		scanner:  NewStatusScanner(r),
+		contexts: make(map[string]bool),
+	}
+}
+
+// Next returns the next progress event or nil if the end of the monitor
+// output is reached.
+func (pt *ProgressTracker) Next() (*Event, error) {
+	for len(pt.queue) == 0 {
+		if pt.done {
+			return nil, nil
+		}
+		if err := pt.scan(); err != nil {
+			return nil, err
+		}
+	}
+	ev := pt.queue[0]
+	pt.queue = pt.queue[1:]
+	return ev, nil
+}
+
+// Run calls fn with every progress event until the end of the monitor
+// output is reached or fn returns an error.
+func (pt *ProgressTracker) Run(fn func(*Event) error) error {
+	for {
+		ev, err := pt.Next()
+		if err != nil {
+			return err
+		}
+		if ev == nil {
+			return nil
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// Stream sends every progress event to the events channel and closes it
+// when the end of the monitor output is reached.
+func (pt *ProgressTracker) Stream(events chan<- *Event) error {
+	defer close(events)
+	return pt.Run(func(ev *Event) error {
+		events <- ev
+		return nil
+	})
+}
+
+func (pt *ProgressTracker) emit(ev *Event) {
+	ev.Timestamp = pt.timestamp
+	ev.Percent = pt.percent
+	if ev.Pipeline == "" {
+		ev.Pipeline = pt.pipeline
+	}
+	pt.queue = append(pt.queue, ev)
+}
+
+func (pt *ProgressTracker) endStage(success bool, duration time.Duration) {
+	if pt.stageID == "" {
+		return
+	}
+	if duration == 0 {
+		duration = pt.timestamp.Sub(pt.stageStart)
+	}
+	if !success {
+		pt.pipelineFailed = true
+	}
+	pt.emit(&Event{
+		Type:     EventStageEnd,
+		Stage:    pt.stage,
+		StageID:  pt.stageID,
+		Duration: duration,
+		Success:  success,
+	})
+	pt.stageID = ""
+	pt.stage = ""
+}
+
+func (pt *ProgressTracker) endPipeline() {
+	if pt.pipeline == "" {
+		return
+	}
+	// a stage without a result did not finish
+	pt.endStage(false, 0)
+	pt.emit(&Event{
+		Type:     EventPipelineEnd,
+		Duration: pt.timestamp.Sub(pt.pipelineStart),
+		Success:  !pt.pipelineFailed,
+	})
+	pt.pipeline = ""
+	pt.pipelineFailed = false
+}
+
+func (pt *ProgressTracker) scan() error {
+	st, err := pt.scanner.Status()
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		pt.done = true
+		pt.endPipeline()
+		return nil
+	}
+	if !st.Timestamp.IsZero() {
+		pt.timestamp = st.Timestamp
+	}
+	pt.percent = max(pt.percent, 100*progressFraction(st.Progress))
+
+	context := pt.scanner.currentContext
+	newContext := !pt.contexts[context.ID]
+	pt.contexts[context.ID] = true
+	if newContext && context.Origin == "osbuild.monitor" {
+		if name := context.Pipeline.Name; name != "" && name != pt.pipeline {
+			pt.endPipeline()
+			pt.pipeline = name
+			pt.pipelineStart = pt.timestamp
+			pt.emit(&Event{Type: EventPipelineStart, Message: st.Message})
+		}
+		if stage := context.Pipeline.Stage; stage.ID != "" && stage.ID != pt.stageID {
+			pt.endStage(false, 0)
+			pt.stageID = stage.ID
+			pt.stage = stage.Name
+			pt.stageStart = pt.timestamp
+			pt.emit(&Event{Type: EventStageStart, Stage: stage.Name, StageID: stage.ID, Message: st.Message})
+		}
+	}
+	if st.Trace != "" {
+		pt.emit(&Event{Type: EventLog, Stage: pt.stage, StageID: pt.stageID, Message: st.Trace})
+	}
+	if result := pt.scanner.currentResult; result != nil && pt.stageID != "" && context.Pipeline.Stage.ID == pt.stageID {
+		pt.endStage(result.Success, st.Duration)
+	}
+	if context.Origin == "osbuild.monitor" && pt.pipeline != "" && st.Message == "Finished pipeline "+pt.pipeline {
+		pt.endPipeline()
+	}
+	return nil
+}
+
+// progressFraction returns the fraction of the work done of the progress,
+// including its sub-progress.
+func progressFraction(p *Progress) float64 {
+	if p == nil || p.Total <= 0 {
+		return 0
+	}
+	return min((float64(p.Done)+progressFraction(p.SubProgress))/float64(p.Total), 1)
+}
@@ -0,0 +1,141 @@
+package osbuild_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	_ "embed"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+//go:embed testdata/monitor-fedora-42-raw-v197.seq.json
+var osbuildMonitorLines_fedora42 []byte
+
+// eventSummary is an event without the timestamp, percent and message
+type eventSummary struct {
+	Type     osbuild.EventType
+	Pipeline string
+	Stage    string
+	Success  bool
+}
+
+func TestProgressTracker(t *testing.T) {
+	tracker := osbuild.NewProgressTracker(bytes.NewBuffer(osbuildMonitorLines_fedora42))
+
+	var events []eventSummary
+	var logs []string
+	var rpmEnd *osbuild.Event
+	var lastPercent float64
+	err := tracker.Run(func(ev *osbuild.Event) error {
+		assert.GreaterOrEqual(t, ev.Percent, lastPercent)
+		lastPercent = ev.Percent
+		if ev.Type == osbuild.EventLog {
+			logs = append(logs, ev.Message)
+			return nil
+		}
+		if ev.Type == osbuild.EventStageEnd && ev.Stage == "org.osbuild.rpm" {
+			rpmEnd = ev
+		}
+		events = append(events, eventSummary{ev.Type, ev.Pipeline, ev.Stage, ev.Success})
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []eventSummary{
+		{osbuild.EventPipelineStart, "source org.osbuild.inline", "", false},
+		{osbuild.EventPipelineEnd, "source org.osbuild.inline", "", true},
+		{osbuild.EventPipelineStart, "source org.osbuild.librepo", "", false},
+		{osbuild.EventPipelineEnd, "source org.osbuild.librepo", "", true},
+		{osbuild.EventPipelineStart, "build", "", false},
+		{osbuild.EventStageStart, "build", "org.osbuild.rpm", false},
+		{osbuild.EventStageEnd, "build", "org.osbuild.rpm", true},
+		{osbuild.EventStageStart, "build", "org.osbuild.selinux", false},
+		{osbuild.EventStageEnd, "build", "org.osbuild.selinux", true},
+		{osbuild.EventPipelineEnd, "build", "", true},
+	}, events)
+
+	require.NotNil(t, rpmEnd)
+	// the duration of stages is measured by osbuild
+	assert.Equal(t, time.Duration(14.584695479*float64(time.Second)), rpmEnd.Duration)
+	assert.InDelta(t, 83.3, rpmEnd.Percent, 0.1)
+	assert.Equal(t, 100.0, lastPercent)
+	assert.Contains(t, logs, "manifest ./manitest.json finished successfully")
+}
+
+func TestProgressTrackerFailedStage(t *testing.T) {
+	input := `{"message": "Starting pipeline os", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1"}, "id": "c1"}, "progress": {"name": "pipelines/sources", "total": 2, "done": 1, "progress": {"name": "pipeline: os", "total": 2, "done": 0}}, "timestamp": 1000.0}
+{"message": "Starting module org.osbuild.rpm", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1", "stage": {"name": "org.osbuild.rpm", "id": "s1"}}, "id": "c2"}, "progress": {"name": "pipelines/sources", "total": 2, "done": 1, "progress": {"name": "pipeline: os", "total": 2, "done": 0}}, "timestamp": 1001.0}
+{"message": "error: no space left on device\n", "context": {"origin": "stages/org.osbuild.rpm", "pipeline": {"name": "os", "id": "p1", "stage": {"name": "org.osbuild.rpm", "id": "s1"}}, "id": "c3"}, "progress": {"name": "pipelines/sources", "total": 2, "done": 1, "progress": {"name": "pipeline: os", "total": 2, "done": 0}}, "timestamp": 1002.0}
+{"message": "Finished module org.osbuild.rpm", "result": {"name": "org.osbuild.rpm", "id": "s1", "success": false, "output": "error: no space left on device\n"}, "context": {"id": "c2"}, "progress": {"name": "pipelines/sources", "total": 2, "done": 1, "progress": {"name": "pipeline: os", "total": 2, "done": 1}}, "timestamp": 1003.5}
+`
+	events := make(chan *osbuild.Event)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- osbuild.NewProgressTracker(strings.NewReader(input)).Stream(events)
+	}()
+	var got []*osbuild.Event
+	for ev := range events {
+		got = append(got, ev)
+	}
+	require.NoError(t, <-errs)
+
+	require.Len(t, got, 5)
+	assert.Equal(t, &osbuild.Event{
+		Type:      osbuild.EventLog,
+		Timestamp: time.UnixMilli(1002000),
+		Pipeline:  "os",
+		Stage:     "org.osbuild.rpm",
+		StageID:   "s1",
+		Percent:   50,
+		Message:   "error: no space left on device",
+	}, got[2])
+	assert.Equal(t, &osbuild.Event{
+		Type:      osbuild.EventStageEnd,
+		Timestamp: time.UnixMilli(1003500),
+		Pipeline:  "os",
+		Stage:     "org.osbuild.rpm",
+		StageID:   "s1",
+		Percent:   75,
+		Duration:  2500 * time.Millisecond,
+		Success:   false,
+	}, got[3])
+	// the pipeline ends with the monitor output
+	assert.Equal(t, &osbuild.Event{
+		Type:      osbuild.EventPipelineEnd,
+		Timestamp: time.UnixMilli(1003500),
+		Pipeline:  "os",
+		Percent:   75,
+		Duration:  3500 * time.Millisecond,
+		Success:   false,
+	}, got[4])
+}
+
+func TestProgressJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	pw := osbuild.NewProgressJSONWriter(&buf)
+	require.NoError(t, pw.Write(&osbuild.Event{
+		Type:      osbuild.EventStageEnd,
+		Timestamp: time.Date(2025, 10, 16, 19, 19, 36, 0, time.UTC),
+		Pipeline:  "build",
+		Stage:     "org.osbuild.selinux",
+		Percent:   100,
+		Duration:  1500 * time.Millisecond,
+		Success:   true,
+	}))
+	require.NoError(t, pw.Write(&osbuild.Event{
+		Type:      osbuild.EventLog,
+		Timestamp: time.Date(2025, 10, 16, 19, 19, 37, 0, time.UTC),
+		Pipeline:  "build",
+		Percent:   100,
+		Message:   "done",
+	}))
+	assert.Equal(t, `{"type":"stage-end","timestamp":"2025-10-16T19:19:36Z","pipeline":"build","stage":"org.osbuild.selinux","percent":100,"duration":1.5,"success":true}
+{"type":"log","timestamp":"2025-10-16T19:19:37Z","pipeline":"build","percent":100,"message":"done"}
+`, buf.String())
+}
@@ -0,0 +1,399 @@
+package osbuild
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// StageTiming is the wall time of a single stage of a build.
+type StageTiming struct {
+	Pipeline string  `json:"pipeline"`
+	Stage    string  `json:"stage"`
+	ID       string  `json:"id"`
+	Seconds  float64 `json:"seconds"`
+	Success  bool    `json:"success"`
+
+	// TreeSize is the size of the tree after the stage in bytes, it is
+	// only known for the stages that were checkpointed in the store
+	TreeSize uint64 `json:"tree-size,omitempty"`
+}
+
+// ReportEntry is the aggregated wall time of a pipeline or of all stages
+// of the same type.
+type ReportEntry struct {
+	Name string `json:"name"`
+	// Count is the number of stages
+	Count   int     `json:"count"`
+	Seconds float64 `json:"seconds"`
+
+	// TreeSize is the size of the last checkpointed tree of a pipeline
+	TreeSize uint64 `json:"tree-size,omitempty"`
+}
+
+// BuildReport is the timing and resource report of a build.
+type BuildReport struct {
+	Seconds float64 `json:"seconds"`
+
+	// Stages in the order they were run
+	Stages []StageTiming `json:"stages"`
+	// Pipelines in the order they were run, sources are reported as
+	// pipelines as well
+	Pipelines []ReportEntry `json:"pipelines"`
+	// StageTypes sorted by their wall time, slowest first
+	StageTypes []ReportEntry `json:"stage-types"`
+}
+
+// TimingRecorder records the wall time of the pipelines and stages of a
+// build from its progress events, e.g.:
+//
+//	recorder := &osbuild.TimingRecorder{}
+//	opts.Progress = recorder.Record
+type TimingRecorder struct {
+	stages    []StageTiming
+	pipelines []ReportEntry
+
+	start time.Time
+	end   time.Time
+}
+
+// Record records a single progress event, it never fails.
+func (tr *TimingRecorder) Record(ev *Event) error {
+	if !ev.Timestamp.IsZero() {
+		if tr.start.IsZero() {
+			tr.start = ev.Timestamp
+		}
+		tr.end = ev.Timestamp
+	}
+
+	switch ev.Type {
+	case EventStageEnd:
+		tr.stages = append(tr.stages, StageTiming{
+			Pipeline: ev.Pipeline,
+			Stage:    ev.Stage,
+			ID:       ev.StageID,
+			Seconds:  seconds(ev.Duration),
+			Success:  ev.Success,
+		})
+	case EventPipelineEnd:
+		tr.pipelines = append(tr.pipelines, ReportEntry{
+			Name:    ev.Pipeline,
+			Seconds: seconds(ev.Duration),
+		})
+	}
+	return nil
+}
+
+// Durations returns the recorded wall time of the stages by their ID.
+func (tr *TimingRecorder) Durations() map[string]time.Duration {
+	durations := make(map[string]time.Duration, len(tr.stages))
+	for _, st := range tr.stages {
+		durations[st.ID] = time.Duration(st.Seconds * float64(time.Second))
+	}
+	return durations
+}
+
+// Report returns the report of the recorded build. If storeDir is set, the
+// size of the trees that were checkpointed in the osbuild store is added.
+func (tr *TimingRecorder) Report(storeDir string) (*BuildReport, error) {
+	report := &BuildReport{
+		Seconds:    seconds(tr.end.Sub(tr.start)),
+		Stages:     slices.Clone(tr.stages),
+		Pipelines:  slices.Clone(tr.pipelines),
+		StageTypes: []ReportEntry{},
+	}
+	if report.Stages == nil {
+		report.Stages = []StageTiming{}
+	}
+	if report.Pipelines == nil {
+		report.Pipelines = []ReportEntry{}
+	}
+
+	if storeDir != "" {
+		for i := range report.Stages {
+			size, err := checkpointSize(storeDir, report.Stages[i].ID)
+			if err != nil {
+				return nil, err
+			}
+			report.Stages[i].TreeSize = size
+		}
+	}
+
+	pipelines := make(map[string]*ReportEntry, len(report.Pipelines))
+	for i := range report.Pipelines {
+		pipelines[report.Pipelines[i].Name] = &report.Pipelines[i]
+	}
+	stageTypes := make(map[string]*ReportEntry)
+	for _, st := range report.Stages {
+		if p := pipelines[st.Pipeline]; p != nil {
+			p.Count++
+			if st.TreeSize > 0 {
+				p.TreeSize = st.TreeSize
+			}
+		}
+		entry := stageTypes[st.Stage]
+		if entry == nil {
+			entry = &ReportEntry{Name: st.Stage}
+			stageTypes[st.Stage] = entry
+		}
+		entry.Count++
+		entry.Seconds = roundSeconds(entry.Seconds + st.Seconds)
+	}
+	for _, entry := range stageTypes {
+		report.StageTypes = append(report.StageTypes, *entry)
+	}
+	slices.SortFunc(report.StageTypes, func(a, b ReportEntry) int {
+		if c := cmp.Compare(b.Seconds, a.Seconds); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return report, nil
+}
+
+// Write writes the report as human readable text.
+func (r *BuildReport) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Total build time: %s\n\n", formatSeconds(r.Seconds))
+
+	fmt.Fprintln(tw, "PIPELINE\tSTAGES\tTIME\tTREE SIZE")
+	for _, p := range r.Pipelines {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", p.Name, p.Count, formatSeconds(p.Seconds), formatSize(p.TreeSize))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "STAGE TYPE\tCOUNT\tTIME\tSHARE")
+	for _, st := range r.StageTypes {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", st.Name, st.Count, formatSeconds(st.Seconds), formatShare(st.Seconds, r.Seconds))
+	}
+	return tw.Flush()
+}
+
+// CompareOptions define when a difference between two reports is a
+// regression.
+type CompareOptions struct {
+	// Threshold is the relative increase of the time or tree size
+	// that is a regression, defaults to 0.2 (20%)
+	Threshold float64
+	// MinDelta is the minimal increase of the time that is a
+	// regression, defaults to one second
+	MinDelta time.Duration
+}
+
+// ComparisonEntry is the difference of the total time, a pipeline or a
+// stage type between two reports.
+type ComparisonEntry struct {
+	// Kind is "total", "pipeline" or "stage-type"
+	Kind string `json:"kind"`
+	Name string `json:"name,omitempty"`
+
+	OldSeconds  float64 `json:"old-seconds"`
+	NewSeconds  float64 `json:"new-seconds"`
+	OldTreeSize uint64  `json:"old-tree-size,omitempty"`
+	NewTreeSize uint64  `json:"new-tree-size,omitempty"`
+
+	Regression bool `json:"regression"`
+}
+
+// ReportComparison is the comparison of a build report with the report of
+// a previous build.
+type ReportComparison struct {
+	Entries []ComparisonEntry `json:"entries"`
+}
+
+// CompareReports compares the report of a build with the report of a
+// previous build and flags the regressions. Pipelines and stage types that
+// are new are never regressions.
+func CompareReports(old, new *BuildReport, optsPtr *CompareOptions) *ReportComparison {
+	opts := CompareOptions{Threshold: 0.2, MinDelta: time.Second}
+	if optsPtr != nil {
+		if optsPtr.Threshold > 0 {
+			opts.Threshold = optsPtr.Threshold
+		}
+		if optsPtr.MinDelta > 0 {
+			opts.MinDelta = optsPtr.MinDelta
+		}
+	}
+
+	comparison := &ReportComparison{}
+	add := func(entry ComparisonEntry) {
+		entry.Regression = opts.isRegression(entry)
+		comparison.Entries = append(comparison.Entries, entry)
+	}
+	add(ComparisonEntry{Kind: "total", OldSeconds: old.Seconds, NewSeconds: new.Seconds})
+	for _, entry := range compareEntries(old.Pipelines, new.Pipelines) {
+		entry.Kind = "pipeline"
+		add(entry)
+	}
+	for _, entry := range compareEntries(old.StageTypes, new.StageTypes) {
+		entry.Kind = "stage-type"
+		add(entry)
+	}
+	return comparison
+}
+
+func (opts CompareOptions) isRegression(entry ComparisonEntry) bool {
+	if entry.OldSeconds == 0 && entry.OldTreeSize == 0 {
+		return false
+	}
+	delta := entry.NewSeconds - entry.OldSeconds
+	if delta >= opts.MinDelta.Seconds() && delta > entry.OldSeconds*opts.Threshold {
+		return true
+	}
+	if entry.OldTreeSize > 0 && float64(entry.NewTreeSize) > float64(entry.OldTreeSize)*(1+opts.Threshold) {
+		return true
+	}
+	return false
+}
+
+// compareEntries pairs the entries by name, in the order of the new entries
+// followed by the entries that only exist in the old ones.
+func compareEntries(old, new []ReportEntry) []ComparisonEntry {
+	oldByName := make(map[string]ReportEntry, len(old))
+	for _, entry := range old {
+		oldByName[entry.Name] = entry
+	}
+	var entries []ComparisonEntry
+	seen := make(map[string]bool, len(new))
+	for _, entry := range new {
+		seen[entry.Name] = true
+		prev := oldByName[entry.Name]
+		entries = append(entries, ComparisonEntry{
+			Name:        entry.Name,
+			OldSeconds:  prev.Seconds,
+			NewSeconds:  entry.Seconds,
+			OldTreeSize: prev.TreeSize,
+			NewTreeSize: entry.TreeSize,
+		})
+	}
+	for _, entry := range old {
+		if !seen[entry.Name] {
+			entries = append(entries, ComparisonEntry{
+				Name:        entry.Name,
+				OldSeconds:  entry.Seconds,
+				OldTreeSize: entry.TreeSize,
+			})
+		}
+	}
+	return entries
+}
+
+// Regressions returns the entries that are regressions.
+func (c *ReportComparison) Regressions() []ComparisonEntry {
+	var regressions []ComparisonEntry
+	for _, entry := range c.Entries {
+		if entry.Regression {
+			regressions = append(regressions, entry)
+		}
+	}
+	return regressions
+}
+
+// Write writes the comparison as human readable text, regressions are
+// marked with "!".
+func (c *ReportComparison) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tKIND\tNAME\tOLD TIME\tNEW TIME\tCHANGE\tOLD TREE SIZE\tNEW TREE SIZE")
+	for _, entry := range c.Entries {
+		mark := ""
+		if entry.Regression {
+			mark = "!"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", mark, entry.Kind, entry.Name,
+			formatSeconds(entry.OldSeconds), formatSeconds(entry.NewSeconds),
+			formatChange(entry.OldSeconds, entry.NewSeconds),
+			formatSize(entry.OldTreeSize), formatSize(entry.NewTreeSize))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d regression(s)\n", len(c.Regressions()))
+	return err
+}
+
+// checkpointSize returns the size of the tree that was checkpointed in the
+// osbuild store for the given stage, or 0 if there is no checkpoint.
+func checkpointSize(storeDir, id string) (uint64, error) {
+	if id == "" {
+		return 0, nil
+	}
+	root, err := filepath.EvalSymlinks(filepath.Join(storeDir, "refs", id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot find checkpoint of stage %s: %w", id, err)
+	}
+
+	var size uint64
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot get size of checkpoint of stage %s: %w", id, err)
+	}
+	return size, nil
+}
+
+func seconds(d time.Duration) float64 {
+	return roundSeconds(d.Seconds())
+}
+
+// roundSeconds rounds to milliseconds to keep the reports readable
+func roundSeconds(s float64) float64 {
+	return math.Round(s*1000) / 1000
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
+
+func formatShare(part, total float64) string {
+	if total <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*part/total)
+}
+
+func formatChange(old, new float64) string {
+	if old <= 0 {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", 100*(new-old)/old)
+}
+
+func formatSize(size uint64) string {
+	if size == 0 {
+		return "-"
+	}
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
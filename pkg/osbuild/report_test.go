@@ -0,0 +1,169 @@
+package osbuild_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+const (
+	fedora42RPMStageID     = "c7d6b5d068dacd23b846cae2af5d461d57d953faf2f1b799ac6493f69721431c"
+	fedora42SELinuxStageID = "d2ee82f32cbc86ba38dc12faa123110fdf6774574d7165d651ad9fbab6b58ac5"
+)
+
+func fedora42Timings(t *testing.T) *osbuild.TimingRecorder {
+	t.Helper()
+	recorder := &osbuild.TimingRecorder{}
+	tracker := osbuild.NewProgressTracker(bytes.NewBuffer(osbuildMonitorLines_fedora42))
+	require.NoError(t, tracker.Run(recorder.Record))
+	return recorder
+}
+
+// makeFakeStore creates an osbuild store with a checkpoint of the given
+// size for the selinux stage
+func makeFakeStore(t *testing.T, size int) string {
+	t.Helper()
+	storeDir := t.TempDir()
+	tree := filepath.Join(storeDir, "objects", "a1b2c3", "data", "tree")
+	require.NoError(t, os.MkdirAll(filepath.Join(tree, "usr"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tree, "usr", "file"), make([]byte, size), 0644))
+	require.NoError(t, os.Symlink("file", filepath.Join(tree, "usr", "link")))
+	require.NoError(t, os.MkdirAll(filepath.Join(storeDir, "refs"), 0755))
+	require.NoError(t, os.Symlink("../objects/a1b2c3", filepath.Join(storeDir, "refs", fedora42SELinuxStageID)))
+	return storeDir
+}
+
+func TestTimingRecorderReport(t *testing.T) {
+	report, err := fedora42Timings(t).Report(makeFakeStore(t, 4096))
+	require.NoError(t, err)
+
+	assert.Equal(t, &osbuild.BuildReport{
+		Seconds: 297.948,
+		Stages: []osbuild.StageTiming{
+			{Pipeline: "build", Stage: "org.osbuild.rpm", ID: fedora42RPMStageID, Seconds: 14.585, Success: true},
+			{Pipeline: "build", Stage: "org.osbuild.selinux", ID: fedora42SELinuxStageID, Seconds: 0.425, Success: true, TreeSize: 4096},
+		},
+		Pipelines: []osbuild.ReportEntry{
+			{Name: "source org.osbuild.inline", Seconds: 0.056},
+			{Name: "source org.osbuild.librepo", Seconds: 282.86},
+			{Name: "build", Count: 2, Seconds: 15.031, TreeSize: 4096},
+		},
+		StageTypes: []osbuild.ReportEntry{
+			{Name: "org.osbuild.rpm", Count: 1, Seconds: 14.585},
+			{Name: "org.osbuild.selinux", Count: 1, Seconds: 0.425},
+		},
+	}, report)
+
+	// the durations are recorded in the osbuild result as well
+	assert.Equal(t, map[string]time.Duration{
+		fedora42RPMStageID:     14585 * time.Millisecond,
+		fedora42SELinuxStageID: 425 * time.Millisecond,
+	}, fedora42Timings(t).Durations())
+}
+
+func TestBuildReportJSONRoundTrip(t *testing.T) {
+	report, err := fedora42Timings(t).Report("")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	var decoded osbuild.BuildReport
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, report, &decoded)
+}
+
+func TestBuildReportWrite(t *testing.T) {
+	report, err := fedora42Timings(t).Report(makeFakeStore(t, 3*1024*1024))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf))
+	assert.Equal(t, `Total build time: 4m57.9s
+
+PIPELINE                    STAGES  TIME     TREE SIZE
+source org.osbuild.inline   0       100ms    -
+source org.osbuild.librepo  0       4m42.9s  -
+build                       2       15s      3.0 MiB
+
+STAGE TYPE           COUNT  TIME   SHARE
+org.osbuild.rpm      1      14.6s  4.9%
+org.osbuild.selinux  1      400ms  0.1%
+`, buf.String())
+}
+
+func TestCompareReports(t *testing.T) {
+	old := &osbuild.BuildReport{
+		Seconds: 100,
+		Pipelines: []osbuild.ReportEntry{
+			{Name: "build", Count: 2, Seconds: 30, TreeSize: 1000},
+			{Name: "os", Count: 10, Seconds: 60, TreeSize: 5000},
+			{Name: "qcow2", Count: 1, Seconds: 10},
+		},
+		StageTypes: []osbuild.ReportEntry{
+			{Name: "org.osbuild.rpm", Count: 2, Seconds: 70},
+			{Name: "org.osbuild.selinux", Count: 2, Seconds: 0.5},
+		},
+	}
+	new := &osbuild.BuildReport{
+		Seconds: 110,
+		Pipelines: []osbuild.ReportEntry{
+			{Name: "build", Count: 2, Seconds: 31, TreeSize: 1000},
+			{Name: "os", Count: 10, Seconds: 59, TreeSize: 7000},
+			{Name: "image", Count: 1, Seconds: 20},
+		},
+		StageTypes: []osbuild.ReportEntry{
+			{Name: "org.osbuild.rpm", Count: 2, Seconds: 72},
+			// doubled, but by less than the minimal delta
+			{Name: "org.osbuild.selinux", Count: 2, Seconds: 1},
+			{Name: "org.osbuild.qemu", Count: 1, Seconds: 20},
+		},
+	}
+
+	comparison := osbuild.CompareReports(old, new, nil)
+	assert.Equal(t, []osbuild.ComparisonEntry{
+		{Kind: "total", OldSeconds: 100, NewSeconds: 110},
+		{Kind: "pipeline", Name: "build", OldSeconds: 30, NewSeconds: 31, OldTreeSize: 1000, NewTreeSize: 1000},
+		{Kind: "pipeline", Name: "os", OldSeconds: 60, NewSeconds: 59, OldTreeSize: 5000, NewTreeSize: 7000, Regression: true},
+		{Kind: "pipeline", Name: "image", NewSeconds: 20},
+		{Kind: "pipeline", Name: "qcow2", OldSeconds: 10},
+		{Kind: "stage-type", Name: "org.osbuild.rpm", OldSeconds: 70, NewSeconds: 72},
+		{Kind: "stage-type", Name: "org.osbuild.selinux", OldSeconds: 0.5, NewSeconds: 1},
+		{Kind: "stage-type", Name: "org.osbuild.qemu", NewSeconds: 20},
+	}, comparison.Entries)
+
+	comparison = osbuild.CompareReports(old, new, &osbuild.CompareOptions{Threshold: 0.02, MinDelta: 100 * time.Millisecond})
+	var regressions []string
+	for _, entry := range comparison.Regressions() {
+		regressions = append(regressions, entry.Kind+" "+entry.Name)
+	}
+	assert.Equal(t, []string{
+		"total ",
+		"pipeline build",
+		"pipeline os",
+		"stage-type org.osbuild.rpm",
+		"stage-type org.osbuild.selinux",
+	}, regressions)
+
+	var buf bytes.Buffer
+	require.NoError(t, osbuild.CompareReports(old, new, nil).Write(&buf))
+	assert.Equal(t, `   KIND        NAME                 OLD TIME  NEW TIME  CHANGE   OLD TREE SIZE  NEW TREE SIZE
+   total                            1m40s     1m50s     +10.0%   -              -
+   pipeline    build                30s       31s       +3.3%    1000 B         1000 B
+!  pipeline    os                   1m0s      59s       -1.7%    4.9 KiB        6.8 KiB
+   pipeline    image                0s        20s       new      -              -
+   pipeline    qcow2                10s       0s        -100.0%  -              -
+   stage-type  org.osbuild.rpm      1m10s     1m12s     +2.9%    -              -
+   stage-type  org.osbuild.selinux  500ms     1s        +100.0%  -              -
+   stage-type  org.osbuild.qemu     0s        20s       new      -              -
+
+1 regression(s)
+`, buf.String())
+}
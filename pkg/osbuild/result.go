@@ -6,6 +6,7 @@ import (
 	"io"
 	"slices"
 	"strings"
+	"time"
 )
 
 type Result struct {
@@ -31,6 +32,11 @@ type StageResult struct {
 	Output  string `json:"output"`
 	Success bool   `json:"success,omitempty"`
 	Error   string `json:"string,omitempty"`
+
+	// Duration is the wall time of the stage, it is not part of the
+	// osbuild result and only known if the build was monitored (see
+	// OSBuildOptions.Progress)
+	Duration time.Duration `json:"-"`
 }
 
 type PipelineMetadata map[string]StageMetadata
@@ -151,6 +157,9 @@ func (res *Result) Write(writer io.Writer) error {
 		pipelineMD := res.Metadata[pipelineName]
 		for _, stage := range res.Log[pipelineName] {
 			fmt.Fprintf(writer, "Stage: %s\n", stage.Type)
+			if stage.Duration > 0 {
+				fmt.Fprintf(writer, "Duration: %s\n", stage.Duration)
+			}
 			fmt.Fprintf(writer, "Output:\n%s\n", stage.Output)
 
 			// print structured stage metadata if available
@@ -202,3 +211,13 @@ func (ve *ValidationError) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// setStageDurations sets the wall time of the stages from the given
+// durations by stage ID.
+func (res *Result) setStageDurations(durations map[string]time.Duration) {
+	for _, pipeline := range res.Log {
+		for i := range pipeline {
+			pipeline[i].Duration = durations[pipeline[i].ID]
+		}
+	}
+}
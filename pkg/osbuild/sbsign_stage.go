@@ -0,0 +1,76 @@
+package osbuild
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SbsignStageOptions are the options of the org.osbuild.sbsign stage, which
+// signs EFI binaries (UKIs, shim, grub, kernels) in place for Secure Boot.
+//
+// NOTE: org.osbuild.sbsign is a new stage, it does not exist in osbuild yet
+// and needs a matching stage there (stages/org.osbuild.sbsign) before
+// manifests with it can be built. The private key is never passed in the
+// manifest, it is in a PKCS#11 token on the build host.
+type SbsignStageOptions struct {
+	// Paths of the EFI binaries in the tree
+	Paths []string `json:"paths"`
+
+	// PKCS11URI of the signing key
+	PKCS11URI string `json:"pkcs11_uri"`
+}
+
+func (SbsignStageOptions) isStageOptions() {}
+
+func (o *SbsignStageOptions) validate() error {
+	if len(o.Paths) == 0 {
+		return fmt.Errorf("sbsign: 'paths' is a required property")
+	}
+	for _, path := range o.Paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("sbsign: path %q must be absolute", path)
+		}
+	}
+	if o.PKCS11URI == "" {
+		return fmt.Errorf("sbsign: 'pkcs11_uri' is a required property")
+	}
+	if !strings.HasPrefix(o.PKCS11URI, "pkcs11:") {
+		return fmt.Errorf("sbsign: %q is not a PKCS#11 URI", o.PKCS11URI)
+	}
+	return nil
+}
+
+// SbsignStageInputs is the PEM encoded certificate of the signing key.
+type SbsignStageInputs struct {
+	Cert *FilesInput `json:"cert"`
+}
+
+func (SbsignStageInputs) isStageInputs() {}
+
+// NewSbsignStageInputs returns the inputs for the given certificate data,
+// which must be added to the inline sources of the manifest.
+func NewSbsignStageInputs(certData string) *SbsignStageInputs {
+	return &SbsignStageInputs{
+		Cert: NewFilesInput(NewFilesInputSourcePlainRef([]string{
+			fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(certData))),
+		})),
+	}
+}
+
+// NewSbsignStage creates a new org.osbuild.sbsign stage
+func NewSbsignStage(options *SbsignStageOptions, inputs *SbsignStageInputs) *Stage {
+	if err := options.validate(); err != nil {
+		panic(err)
+	}
+	if inputs == nil || inputs.Cert == nil {
+		panic("sbsign: the 'cert' input is required")
+	}
+
+	return &Stage{
+		Type:    "org.osbuild.sbsign",
+		Options: options,
+		Inputs:  inputs,
+	}
+}
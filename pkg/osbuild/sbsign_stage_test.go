@@ -0,0 +1,84 @@
+package osbuild
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSbsignStage(t *testing.T) {
+	options := &SbsignStageOptions{
+		Paths:     []string{"/boot/efi/EFI/Linux/ffffffffffffffffffffffffffffffff-6.12.0.efi"},
+		PKCS11URI: "pkcs11:token=fleet;object=db",
+	}
+	stage := NewSbsignStage(options, NewSbsignStageInputs("cert\n"))
+
+	data, err := json.Marshal(stage)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "org.osbuild.sbsign",
+		"inputs": {
+			"cert": {
+				"type": "org.osbuild.files",
+				"origin": "org.osbuild.source",
+				"references": ["sha256:489d969a85a540712e95e8b4fb52ccca764773b02083b8779088bbb66087f98c"]
+			}
+		},
+		"options": {
+			"paths": ["/boot/efi/EFI/Linux/ffffffffffffffffffffffffffffffff-6.12.0.efi"],
+			"pkcs11_uri": "pkcs11:token=fleet;object=db"
+		}
+	}`, string(data))
+}
+
+func TestNewSbsignStagePanics(t *testing.T) {
+	options := &SbsignStageOptions{
+		Paths:     []string{"/boot/vmlinuz-6.12.0"},
+		PKCS11URI: "pkcs11:token=fleet;object=db",
+	}
+	assert.NotPanics(t, func() {
+		NewSbsignStage(options, NewSbsignStageInputs("cert\n"))
+	})
+	assert.PanicsWithValue(t, "sbsign: the 'cert' input is required", func() {
+		NewSbsignStage(options, nil)
+	})
+}
+
+func TestSbsignStageOptionsValidate(t *testing.T) {
+	testCases := map[string]struct {
+		options *SbsignStageOptions
+		expErr  string
+	}{
+		"good-pkcs11": {
+			options: &SbsignStageOptions{Paths: []string{"/boot/vmlinuz-6.12.0"}, PKCS11URI: "pkcs11:token=fleet;object=db"},
+		},
+		"no-key": {
+			options: &SbsignStageOptions{Paths: []string{"/boot/vmlinuz-6.12.0"}},
+			expErr:  "sbsign: 'pkcs11_uri' is a required property",
+		},
+		"no-paths": {
+			options: &SbsignStageOptions{},
+			expErr:  "sbsign: 'paths' is a required property",
+		},
+		"relative": {
+			options: &SbsignStageOptions{Paths: []string{"boot/vmlinuz-6.12.0"}, PKCS11URI: "pkcs11:token=fleet"},
+			expErr:  `sbsign: path "boot/vmlinuz-6.12.0" must be absolute`,
+		},
+		"bad-uri": {
+			options: &SbsignStageOptions{Paths: []string{"/boot/vmlinuz-6.12.0"}, PKCS11URI: "/dev/hsm"},
+			expErr:  `sbsign: "/dev/hsm" is not a PKCS#11 URI`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.options.validate()
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expErr)
+			}
+		})
+	}
+}
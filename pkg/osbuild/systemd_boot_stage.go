@@ -0,0 +1,79 @@
+package osbuild
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// SystemdBootStageOptions are the options of the org.osbuild.systemd-boot
+// stage, which installs systemd-boot into the ESP of the tree with `bootctl
+// install` and writes its loader.conf. The boot entries are not written by
+// the stage, they are created by kernel-install (BLS type #1 layout) when
+// the kernel is installed.
+type SystemdBootStageOptions struct {
+	// Mountpoint of the ESP in the tree
+	ESPPath string `json:"esp_path"`
+
+	// Mountpoint of the XBOOTLDR partition in the tree, if any, which holds
+	// the boot entries, kernels and initrds instead of the ESP
+	BootPath string `json:"boot_path,omitempty"`
+
+	// The entry token that prefixes the boot entries and the directory of
+	// the kernels, written to /etc/kernel/entry-token (see bootctl(1))
+	EntryToken string `json:"entry_token,omitempty"`
+
+	// Configuration written to loader/loader.conf in the ESP
+	Loader *SystemdBootLoaderConfig `json:"loader,omitempty"`
+}
+
+// SystemdBootLoaderConfig is the loader.conf of systemd-boot, see
+// loader.conf(5).
+type SystemdBootLoaderConfig struct {
+	// Glob pattern of the default entry
+	Default string `json:"default,omitempty"`
+
+	// Menu timeout in seconds
+	Timeout *int `json:"timeout,omitempty"`
+
+	// Allow editing the kernel command line in the menu
+	Editor *bool `json:"editor,omitempty"`
+
+	ConsoleMode string `json:"console_mode,omitempty"`
+}
+
+func (SystemdBootStageOptions) isStageOptions() {}
+
+var systemdBootConsoleModes = []string{"0", "1", "2", "auto", "max", "keep"}
+
+func (o *SystemdBootStageOptions) validate() error {
+	if o.ESPPath == "" {
+		return fmt.Errorf("systemd-boot: 'esp_path' is a required property")
+	}
+	for _, path := range []string{o.ESPPath, o.BootPath} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("systemd-boot: path %q must be absolute", path)
+		}
+	}
+	if o.Loader != nil {
+		if o.Loader.Timeout != nil && *o.Loader.Timeout < 0 {
+			return fmt.Errorf("systemd-boot: timeout must not be negative")
+		}
+		if o.Loader.ConsoleMode != "" && !slices.Contains(systemdBootConsoleModes, o.Loader.ConsoleMode) {
+			return fmt.Errorf("systemd-boot: console mode %q is not one of %v", o.Loader.ConsoleMode, systemdBootConsoleModes)
+		}
+	}
+	return nil
+}
+
+// NewSystemdBootStage creates a new org.osbuild.systemd-boot stage
+func NewSystemdBootStage(options *SystemdBootStageOptions) *Stage {
+	if err := options.validate(); err != nil {
+		panic(err)
+	}
+
+	return &Stage{
+		Type:    "org.osbuild.systemd-boot",
+		Options: options,
+	}
+}
@@ -0,0 +1,75 @@
+package osbuild
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+)
+
+func TestNewSystemdBootStage(t *testing.T) {
+	stage := NewSystemdBootStage(&SystemdBootStageOptions{
+		ESPPath:    "/boot/efi",
+		BootPath:   "/boot",
+		EntryToken: "os-id",
+		Loader: &SystemdBootLoaderConfig{
+			Timeout: common.ToPtr(0),
+			Editor:  common.ToPtr(false),
+		},
+	})
+
+	data, err := json.Marshal(stage)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "org.osbuild.systemd-boot",
+		"options": {
+			"esp_path": "/boot/efi",
+			"boot_path": "/boot",
+			"entry_token": "os-id",
+			"loader": {
+				"timeout": 0,
+				"editor": false
+			}
+		}
+	}`, string(data))
+}
+
+func TestSystemdBootStageOptionsValidate(t *testing.T) {
+	testCases := map[string]struct {
+		options *SystemdBootStageOptions
+		expErr  string
+	}{
+		"good": {
+			options: &SystemdBootStageOptions{ESPPath: "/boot/efi"},
+		},
+		"no-esp": {
+			options: &SystemdBootStageOptions{BootPath: "/boot"},
+			expErr:  "systemd-boot: 'esp_path' is a required property",
+		},
+		"relative-boot": {
+			options: &SystemdBootStageOptions{ESPPath: "/efi", BootPath: "boot"},
+			expErr:  `systemd-boot: path "boot" must be absolute`,
+		},
+		"negative-timeout": {
+			options: &SystemdBootStageOptions{ESPPath: "/efi", Loader: &SystemdBootLoaderConfig{Timeout: common.ToPtr(-1)}},
+			expErr:  "systemd-boot: timeout must not be negative",
+		},
+		"bad-console-mode": {
+			options: &SystemdBootStageOptions{ESPPath: "/efi", Loader: &SystemdBootLoaderConfig{ConsoleMode: "huge"}},
+			expErr:  `systemd-boot: console mode "huge" is not one of [0 1 2 auto max keep]`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.options.validate()
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expErr)
+			}
+		})
+	}
+}
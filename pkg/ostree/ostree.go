@@ -310,6 +310,24 @@ func resolveRef(ss SourceSpec) (string, string, error) {
 	return ss.URL, checksum, nil
 }
 
+// rhsmMTLS returns the MTLS options for the RHSM consumer certificates of
+// the system.
+func rhsmMTLS() (*MTLS, error) {
+	subs, err := rhsm.LoadSystemSubscriptions()
+	if err != nil {
+		return nil, NewResolveRefError("error adding rhsm certificates when resolving ref: %s", err)
+	}
+
+	if subs.Consumer == nil {
+		return nil, NewResolveRefError("error adding rhsm certificates when resolving ref")
+	}
+
+	return &MTLS{
+		ClientCert: subs.Consumer.ConsumerCert,
+		ClientKey:  subs.Consumer.ConsumerKey,
+	}, nil
+}
+
 // Resolve the ostree source specification to a commit specification.
 //
 // If a URL is defined in the source specification, the checksum of the ref is
@@ -331,24 +349,12 @@ func Resolve(source SourceSpec) (CommitSpec, error) {
 	}
 
 	if source.RHSM {
-		var subs *rhsm.Subscriptions
-		var err error
-
 		commit.Secrets = "org.osbuild.rhsm.consumer"
-		subs, err = rhsm.LoadSystemSubscriptions()
-
+		mtls, err := rhsmMTLS()
 		if err != nil {
-			return commit, NewResolveRefError("error adding rhsm certificates when resolving ref: %s", err)
-		}
-
-		if subs.Consumer == nil {
-			return commit, NewResolveRefError("error adding rhsm certificates when resolving ref")
-		}
-
-		source.MTLS = &MTLS{
-			ClientCert: subs.Consumer.ConsumerCert,
-			ClientKey:  subs.Consumer.ConsumerKey,
+			return commit, err
 		}
+		source.MTLS = mtls
 	} else if source.MTLS != nil {
 		commit.Secrets = "org.osbuild.mtls"
 	}
@@ -377,6 +383,56 @@ func Resolve(source SourceSpec) (CommitSpec, error) {
 	return commit, nil
 }
 
+// Verify checks that the commit of the commit specification can still be
+// fetched from its repository (location+"objects/"+commit object path). The
+// source specification of the commit provides the TLS and proxy settings.
+//
+// Commits without a URL are not checked. Failure to fetch the commit results
+// in a ResolveRefError.
+func Verify(source SourceSpec, commit CommitSpec) error {
+	if commit.URL == "" {
+		return nil
+	}
+	if !verifyChecksum(commit.Checksum) {
+		return NewRefError("Invalid ostree commit %q", commit.Checksum)
+	}
+
+	if source.RHSM {
+		mtls, err := rhsmMTLS()
+		if err != nil {
+			return err
+		}
+		source.MTLS = mtls
+	}
+
+	u, err := url.Parse(commit.URL)
+	if err != nil {
+		return NewResolveRefError("error parsing ostree repository location: %v", err)
+	}
+	u.Path = path.Join(u.Path, "objects", commit.Checksum[:2], commit.Checksum[2:]+".commit")
+
+	client, err := httpClientForRef(u.Scheme, source)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+	if err != nil {
+		return NewResolveRefError("error preparing ostree commit request: %s", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return NewResolveRefError("error sending request to ostree repository %q: %v", u.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return NewResolveRefError("ostree commit %s in repository %q returned status: %s", commit.Checksum, commit.URL, resp.Status)
+	}
+	return nil
+}
+
 // ResolveAll calls [Resolve] with each commit slice in the map and returns a
 // map of results with the corresponding keys as the input argument.
 func ResolveAll(commitSources map[string][]SourceSpec) (map[string][]CommitSpec, error) {
@@ -297,3 +297,34 @@ func TestClientForRefCA(t *testing.T) {
 	// no certificates got added
 	assert.Equal(t, 0, len(tlsConf.Certificates))
 }
+
+func TestVerify(t *testing.T) {
+	commit := "5330bb1b8820944567f519de66ad6354c729b6b490dea1c5a7ba320c9f147c58"
+
+	handler := http.NewServeMux()
+	handler.HandleFunc("/repo/objects/53/30bb1b8820944567f519de66ad6354c729b6b490dea1c5a7ba320c9f147c58.commit", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "commit")
+	})
+	mTLSSrv, err := test_mtls_server.NewMTLSServer(handler)
+	require.NoError(t, err)
+	defer mTLSSrv.Server.Close()
+	source := SourceSpec{
+		MTLS: &MTLS{mTLSSrv.CAPath, mTLSSrv.ClientCrtPath, mTLSSrv.ClientKeyPath},
+	}
+	repoURL := mTLSSrv.Server.URL + "/repo"
+
+	assert.NoError(t, Verify(source, CommitSpec{URL: repoURL, Checksum: commit}))
+	// commits without a repository are not checked
+	assert.NoError(t, Verify(source, CommitSpec{Checksum: commit}))
+
+	missing := strings.Repeat("a", 64)
+	err = Verify(source, CommitSpec{URL: repoURL, Checksum: missing})
+	assert.EqualError(t, err, fmt.Sprintf("ostree commit %s in repository %q returned status: 404 Not Found", missing, repoURL))
+	assert.IsType(t, ResolveRefError{}, err)
+
+	err = Verify(source, CommitSpec{URL: repoURL, Checksum: "rhel/9/x86_64/edge"})
+	assert.IsType(t, RefError{}, err)
+
+	err = Verify(SourceSpec{}, CommitSpec{URL: repoURL, Checksum: commit})
+	assert.ErrorContains(t, err, "error sending request to ostree repository")
+}
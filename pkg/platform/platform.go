@@ -22,6 +22,9 @@ const ( // image format enum
 	FORMAT_OVA
 	FORMAT_VAGRANT_LIBVIRT
 	FORMAT_VAGRANT_VIRTUALBOX
+	FORMAT_VHDX
+	FORMAT_VDI
+	FORMAT_HYPERV
 )
 
 type Bootloader int
@@ -31,6 +34,8 @@ const ( // bootloader enum
 	BOOTLOADER_GRUB2
 	BOOTLOADER_ZIPL
 	BOOTLOADER_UKI
+	BOOTLOADER_SYSTEMD_BOOT
+	BOOTLOADER_UBOOT
 )
 
 func (b *Bootloader) UnmarshalJSON(data []byte) (err error) {
@@ -55,6 +60,10 @@ func FromString(b string) (Bootloader, error) {
 		return BOOTLOADER_ZIPL, nil
 	case "uki":
 		return BOOTLOADER_UKI, nil
+	case "systemd-boot":
+		return BOOTLOADER_SYSTEMD_BOOT, nil
+	case "uboot":
+		return BOOTLOADER_UBOOT, nil
 	case "", "none":
 		return BOOTLOADER_NONE, nil
 	default:
@@ -84,6 +93,12 @@ func (f ImageFormat) String() string {
 		return "vagrant_libvirt"
 	case FORMAT_VAGRANT_VIRTUALBOX:
 		return "vagrant_virtualbox"
+	case FORMAT_VHDX:
+		return "vhdx"
+	case FORMAT_VDI:
+		return "vdi"
+	case FORMAT_HYPERV:
+		return "hyperv"
 	default:
 		panic(fmt.Errorf("unknown image format %d", f))
 	}
@@ -115,6 +130,12 @@ func (f *ImageFormat) UnmarshalJSON(data []byte) error {
 		*f = FORMAT_VAGRANT_LIBVIRT
 	case "vagrant_virtualbox":
 		*f = FORMAT_VAGRANT_VIRTUALBOX
+	case "vhdx":
+		*f = FORMAT_VHDX
+	case "vdi":
+		*f = FORMAT_VDI
+	case "hyperv":
+		*f = FORMAT_HYPERV
 	default:
 		panic(fmt.Errorf("unknown image format %q", s))
 	}
@@ -138,4 +159,5 @@ type Platform interface {
 	GetBootFiles() [][2]string
 	GetBootloader() Bootloader
 	GetFIPSMenu() bool
+	GetUBoot() *UBoot
 }
@@ -32,6 +32,11 @@ func TestImageFormatUnmarshal(t *testing.T) {
 		platform.FORMAT_VHD,
 		platform.FORMAT_GCE,
 		platform.FORMAT_OVA,
+		platform.FORMAT_VAGRANT_LIBVIRT,
+		platform.FORMAT_VAGRANT_VIRTUALBOX,
+		platform.FORMAT_VHDX,
+		platform.FORMAT_VDI,
+		platform.FORMAT_HYPERV,
 	}
 	for _, ifmt := range ifmts {
 		inpJSON := fmt.Sprintf("%q", ifmt.String())
@@ -47,3 +52,25 @@ func TestImageFormatUnmarshal(t *testing.T) {
 		assert.Equal(t, ifmt, f)
 	}
 }
+
+func TestBootloaderUnmarshal(t *testing.T) {
+	for inp, expected := range map[string]platform.Bootloader{
+		"none":         platform.BOOTLOADER_NONE,
+		"grub2":        platform.BOOTLOADER_GRUB2,
+		"zipl":         platform.BOOTLOADER_ZIPL,
+		"uki":          platform.BOOTLOADER_UKI,
+		"systemd-boot": platform.BOOTLOADER_SYSTEMD_BOOT,
+		"uboot":        platform.BOOTLOADER_UBOOT,
+	} {
+		var b platform.Bootloader
+		err := json.Unmarshal([]byte(fmt.Sprintf("%q", inp)), &b)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, b)
+		err = yaml.Unmarshal([]byte(inp), &b)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, b)
+	}
+
+	var b platform.Bootloader
+	assert.EqualError(t, json.Unmarshal([]byte(`"lilo"`), &b), `unsupported bootloader "lilo"`)
+}
@@ -0,0 +1,35 @@
+package platform
+
+import (
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// UBoot describes a board that boots without UEFI, with U-Boot or with the
+// Raspberry Pi firmware, which read their files from a FAT firmware
+// partition. U-Boot then boots the kernel through the extlinux.conf that is
+// written for the "uboot" bootloader.
+type UBoot struct {
+	// Mountpoint of the firmware partition, which must be a vfat
+	// filesystem. The board firmware is installed there by the platform
+	// packages or copied with the boot files.
+	FirmwarePath string `yaml:"firmware_path"`
+
+	// Device trees copied to the firmware partition, as paths relative to
+	// the dtb directory of the kernel. Directories, e.g. "overlays", are
+	// copied recursively.
+	DeviceTrees []string `yaml:"device_trees"`
+
+	// Bootloader images written to fixed offsets of the disk
+	Embed []UBootEmbed `yaml:"embed"`
+}
+
+// UBootEmbed is a bootloader image, e.g. the U-Boot SPL of a board whose
+// boot ROM loads it from a fixed offset of the disk.
+type UBootEmbed struct {
+	// Path of the image in the OS tree
+	Path string `yaml:"path"`
+
+	// Offset from the start of the disk, which must be before the first
+	// partition
+	Offset datasizes.Size `yaml:"offset"`
+}
@@ -24,6 +24,9 @@ type Data struct {
 
 	Bootloader Bootloader `yaml:"bootloader"`
 	FIPSMenu   bool       `yaml:"fips_menu"` // Add FIPS entry to iso bootloader menu
+
+	// UBoot describes the board of the "uboot" bootloader
+	UBoot *UBoot `yaml:"uboot"`
 }
 
 // ensure platform.Data implements the Platform interface
@@ -76,3 +79,8 @@ func (d *Data) GetBootloader() Bootloader {
 func (d *Data) GetFIPSMenu() bool {
 	return d.FIPSMenu
 }
+
+// GetUBoot returns the board configuration of the "uboot" bootloader
+func (d *Data) GetUBoot() *UBoot {
+	return d.UBoot
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
 	"github.com/osbuild/images/pkg/platform"
 )
 
@@ -72,3 +73,33 @@ func TestPlatformYamlFIPSMenu(t *testing.T) {
 	}
 	assert.Equal(t, expected, pd)
 }
+
+func TestPlatformYamlUBoot(t *testing.T) {
+	inputYAML := []byte(`
+        arch: "aarch64"
+        bootloader: "uboot"
+        uboot:
+          firmware_path: "/boot/firmware"
+          device_trees:
+            - "broadcom/bcm2711-rpi-4-b.dtb"
+            - "overlays"
+          embed:
+            - path: "/usr/share/uboot/rock64-rk3328/idbloader.img"
+              offset: "32 KiB"
+`)
+	var pd platform.Data
+	err := yaml.Unmarshal(inputYAML, &pd)
+	assert.NoError(t, err)
+	expected := platform.Data{
+		Arch:       common.Must(arch.FromString("aarch64")),
+		Bootloader: platform.BOOTLOADER_UBOOT,
+		UBoot: &platform.UBoot{
+			FirmwarePath: "/boot/firmware",
+			DeviceTrees:  []string{"broadcom/bcm2711-rpi-4-b.dtb", "overlays"},
+			Embed: []platform.UBootEmbed{
+				{Path: "/usr/share/uboot/rock64-rk3328/idbloader.img", Offset: 32 * datasizes.KiB},
+			},
+		},
+	}
+	assert.Equal(t, expected, pd)
+}
@@ -0,0 +1,205 @@
+package repodata
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// fetchTimeout is the timeout for fetching a single metadata file
+const fetchTimeout = 5 * time.Minute
+
+// metalink is the part of a metalink document with the repomd.xml hashes
+// and mirrors
+type metalink struct {
+	Files []struct {
+		Name   string `xml:"name,attr"`
+		Hashes []struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"verification>hash"`
+		URLs []string `xml:"resources>url"`
+	} `xml:"files>file"`
+}
+
+func httpClient(repo rpmmd.RepoConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if repo.IgnoreSSL != nil && *repo.IgnoreSSL {
+		// #nosec G402
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if repo.SSLCACert != "" {
+		caCert, err := os.ReadFile(repo.SSLCACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates in %s", repo.SSLCACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if repo.SSLClientCert != "" && repo.SSLClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(repo.SSLClientCert, repo.SSLClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: fetchTimeout}, nil
+}
+
+func fetch(client *http.Client, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "file" {
+		return os.ReadFile(u.Path)
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch %s: %s", rawURL, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func joinURL(baseURL, href string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(href, "/")
+}
+
+const repomdPath = "repodata/repomd.xml"
+
+func parseMetalink(data []byte, rawURL string) (*metalink, error) {
+	var ml metalink
+	if err := xml.Unmarshal(data, &ml); err != nil {
+		return nil, fmt.Errorf("cannot parse metalink %s: %w", rawURL, err)
+	}
+	return &ml, nil
+}
+
+// baseURLs returns the base URLs of a repository, from its configuration
+// or from its metalink or mirrorlist.
+func baseURLs(client *http.Client, repo rpmmd.RepoConfig) ([]string, error) {
+	switch {
+	case len(repo.BaseURLs) > 0:
+		return repo.BaseURLs, nil
+	case repo.Metalink != "":
+		data, err := fetch(client, repo.Metalink)
+		if err != nil {
+			return nil, err
+		}
+		ml, err := parseMetalink(data, repo.Metalink)
+		if err != nil {
+			return nil, err
+		}
+		var urls []string
+		for _, file := range ml.Files {
+			if file.Name != "repomd.xml" {
+				continue
+			}
+			for _, u := range file.URLs {
+				u = strings.TrimSpace(u)
+				urls = append(urls, strings.TrimSuffix(u, repomdPath))
+			}
+		}
+		return urls, nil
+	case repo.MirrorList != "":
+		data, err := fetch(client, repo.MirrorList)
+		if err != nil {
+			return nil, err
+		}
+		var urls []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				urls = append(urls, line)
+			}
+		}
+		return urls, nil
+	}
+	return nil, nil
+}
+
+// fetchRepomd returns the repomd.xml of the first working base URL of a
+// repository and that base URL.
+func fetchRepomd(client *http.Client, repo rpmmd.RepoConfig) ([]byte, string, error) {
+	if repo.RHSM {
+		// the entitlement certificates are only known to the depsolver
+		return nil, "", fmt.Errorf("repository %s uses RHSM secrets", repo.Id)
+	}
+	urls, err := baseURLs(client, repo)
+	if err != nil {
+		return nil, "", err
+	}
+	errs := []error{fmt.Errorf("no repomd.xml found for repository %s", repo.Id)}
+	for _, baseURL := range urls {
+		data, err := fetch(client, joinURL(baseURL, repomdPath))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return data, baseURL, nil
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// Revision returns a checksum of the current metadata of a repository, the
+// sha256 of its repomd.xml. For repositories with a metalink the checksum
+// is taken from the metalink without fetching the repomd.xml.
+//
+// Repositories with RHSM secrets are not supported.
+func Revision(repo rpmmd.RepoConfig) (string, error) {
+	if repo.RHSM {
+		return "", fmt.Errorf("repository %s uses RHSM secrets", repo.Id)
+	}
+	client, err := httpClient(repo)
+	if err != nil {
+		return "", err
+	}
+	if len(repo.BaseURLs) == 0 && repo.Metalink != "" {
+		data, err := fetch(client, repo.Metalink)
+		if err != nil {
+			return "", err
+		}
+		ml, err := parseMetalink(data, repo.Metalink)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range ml.Files {
+			if file.Name != "repomd.xml" {
+				continue
+			}
+			for _, hash := range file.Hashes {
+				if hash.Type == "sha256" {
+					return "sha256:" + strings.TrimSpace(hash.Value), nil
+				}
+			}
+		}
+		return "", fmt.Errorf("no repomd.xml checksum in metalink %s", repo.Metalink)
+	}
+	data, _, err := fetchRepomd(client, repo)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
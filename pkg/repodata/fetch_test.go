@@ -0,0 +1,102 @@
+package repodata_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/repodata"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+func TestRevision(t *testing.T) {
+	repo := fixtureRepo(t)
+	repomd, err := os.ReadFile(filepath.Join("testdata", "repo", "repodata", "repomd.xml"))
+	require.NoError(t, err)
+	revision := fmt.Sprintf("sha256:%x", sha256.Sum256(repomd))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metalink":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/" xmlns:mm0="http://fedorahosted.org/mirrormanager">
+ <files>
+  <file name="repomd.xml">
+   <verification>
+    <hash type="md5">d41d8cd98f00b204e9800998ecf8427e</hash>
+    <hash type="sha256">e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855</hash>
+   </verification>
+  </file>
+ </files>
+</metalink>`)
+		case "/mirrorlist":
+			fmt.Fprintf(w, "# mirrors\nhttp://%s/missing/\nhttp://%s/repo/\n", r.Host, r.Host)
+		case "/repo/repodata/repomd.xml":
+			_, _ = w.Write(repomd)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name     string
+		repo     rpmmd.RepoConfig
+		expected string
+		expErr   string
+	}{
+		{"file", repo, revision, ""},
+		{"http", rpmmd.RepoConfig{BaseURLs: []string{srv.URL + "/missing", srv.URL + "/repo/"}}, revision, ""},
+		{"metalink", rpmmd.RepoConfig{Metalink: srv.URL + "/metalink"}, "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", ""},
+		{"mirrorlist", rpmmd.RepoConfig{MirrorList: srv.URL + "/mirrorlist"}, revision, ""},
+		{"missing", rpmmd.RepoConfig{Id: "missing", BaseURLs: []string{srv.URL + "/missing"}}, "", "no repomd.xml found for repository missing"},
+		{"rhsm", rpmmd.RepoConfig{Id: "rhel", BaseURLs: []string{srv.URL + "/repo"}, RHSM: true}, "", "repository rhel uses RHSM secrets"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rev, err := repodata.Revision(tc.repo)
+			if tc.expErr != "" {
+				assert.ErrorContains(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, rev)
+		})
+	}
+}
+
+func TestReaderMetalink(t *testing.T) {
+	var srvURL string
+	fileServer := http.FileServer(http.Dir("testdata/repo"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metalink" {
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+ <files>
+  <file name="repomd.xml">
+   <resources maxconnections="1">
+    <url protocol="http" type="http" preference="100">%[1]s/missing/repodata/repomd.xml</url>
+    <url protocol="http" type="http" preference="99">%[1]s/repodata/repomd.xml</url>
+   </resources>
+  </file>
+ </files>
+</metalink>`, srvURL)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	reader := repodata.NewReader("x86_64", t.TempDir())
+	pkgs, err := reader.SearchMetadata([]rpmmd.RepoConfig{{Id: "metalink", Metalink: srv.URL + "/metalink"}}, []string{"bash"})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	assert.Equal(t, []string{srv.URL + "/Packages/b/bash-5.2.37-1.fc42.x86_64.rpm"}, pkgs[0].RemoteLocations)
+}
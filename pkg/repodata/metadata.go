@@ -0,0 +1,270 @@
+package repodata
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// repomd is the index of the metadata files of a repository, as found in
+// repodata/repomd.xml
+type repomd struct {
+	Revision string       `xml:"revision"`
+	Data     []repomdData `xml:"data"`
+}
+
+type repomdData struct {
+	Type     string `xml:"type,attr"`
+	Checksum struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"checksum"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Size int64 `xml:"size"`
+}
+
+func parseRepomd(data []byte) (*repomd, error) {
+	var md repomd
+	if err := xml.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("cannot parse repomd.xml: %w", err)
+	}
+	return &md, nil
+}
+
+// find returns the data of the given type, e.g. "primary".
+func (md *repomd) find(dataType string) *repomdData {
+	for idx := range md.Data {
+		if md.Data[idx].Type == dataType {
+			return &md.Data[idx]
+		}
+	}
+	return nil
+}
+
+// decompress returns a reader for the decompressed content of a metadata
+// file, the compression is detected from the magic bytes of the content.
+func decompress(data []byte) (io.Reader, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		dec, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case bytes.HasPrefix(data, []byte("BZh")):
+		return bzip2.NewReader(bytes.NewReader(data)), nil
+	case bytes.HasPrefix(data, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return nil, fmt.Errorf("xz compressed metadata is not supported")
+	}
+	return bytes.NewReader(data), nil
+}
+
+type primaryEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr"`
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+	Pre   string `xml:"pre,attr"`
+}
+
+// primaryPackage is a <package> element of primary.xml
+type primaryPackage struct {
+	Type    string `xml:"type,attr"`
+	Name    string `xml:"name"`
+	Arch    string `xml:"arch"`
+	Version struct {
+		Epoch string `xml:"epoch,attr"`
+		Ver   string `xml:"ver,attr"`
+		Rel   string `xml:"rel,attr"`
+	} `xml:"version"`
+	Checksum struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"checksum"`
+	Summary     string `xml:"summary"`
+	Description string `xml:"description"`
+	Packager    string `xml:"packager"`
+	URL         string `xml:"url"`
+	Time        struct {
+		Build int64 `xml:"build,attr"`
+	} `xml:"time"`
+	Size struct {
+		Package   uint64 `xml:"package,attr"`
+		Installed uint64 `xml:"installed,attr"`
+	} `xml:"size"`
+	Location struct {
+		Href string `xml:"href,attr"`
+		Base string `xml:"base,attr"`
+	} `xml:"location"`
+	Format struct {
+		License     string         `xml:"license"`
+		Vendor      string         `xml:"vendor"`
+		Group       string         `xml:"group"`
+		SourceRPM   string         `xml:"sourcerpm"`
+		Provides    []primaryEntry `xml:"provides>entry"`
+		Requires    []primaryEntry `xml:"requires>entry"`
+		Conflicts   []primaryEntry `xml:"conflicts>entry"`
+		Obsoletes   []primaryEntry `xml:"obsoletes>entry"`
+		Recommends  []primaryEntry `xml:"recommends>entry"`
+		Suggests    []primaryEntry `xml:"suggests>entry"`
+		Enhances    []primaryEntry `xml:"enhances>entry"`
+		Supplements []primaryEntry `xml:"supplements>entry"`
+		Files       []string       `xml:"file"`
+	} `xml:"format"`
+}
+
+// filelistsPackage is a <package> element of filelists.xml
+type filelistsPackage struct {
+	PkgID string   `xml:"pkgid,attr"`
+	Files []string `xml:"file"`
+}
+
+// decodePackages calls fn for all the <package> elements of a primary.xml
+// or filelists.xml document, without loading the whole document.
+func decodePackages[T any](r io.Reader, fn func(*T) error) error {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "package" {
+			continue
+		}
+		var pkg T
+		if err := dec.DecodeElement(&pkg, &start); err != nil {
+			return err
+		}
+		if err := fn(&pkg); err != nil {
+			return err
+		}
+	}
+}
+
+// parseFilelists returns the files of the packages by package checksum.
+func parseFilelists(r io.Reader) (map[string][]string, error) {
+	files := make(map[string][]string)
+	err := decodePackages(r, func(pkg *filelistsPackage) error {
+		files[pkg.PkgID] = pkg.Files
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse filelists.xml: %w", err)
+	}
+	return files, nil
+}
+
+var relationships = map[string]string{
+	"EQ": "=",
+	"LT": "<",
+	"GT": ">",
+	"LE": "<=",
+	"GE": ">=",
+}
+
+func toRelDepList(entries []primaryEntry, filter func(primaryEntry) bool) rpmmd.RelDepList {
+	var deps rpmmd.RelDepList
+	for _, e := range entries {
+		if filter != nil && !filter(e) {
+			continue
+		}
+		dep := rpmmd.RelDep{
+			Name:         e.Name,
+			Relationship: relationships[e.Flags],
+		}
+		if e.Ver != "" {
+			// the same format as the depsolver, with the epoch only if
+			// it is not 0
+			if e.Epoch != "" && e.Epoch != "0" {
+				dep.Version = e.Epoch + ":"
+			}
+			dep.Version += e.Ver
+			if e.Rel != "" {
+				dep.Version += "-" + e.Rel
+			}
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+func isPre(e primaryEntry) bool {
+	return e.Pre == "1" || e.Pre == "true"
+}
+
+func isRegular(e primaryEntry) bool {
+	return !isPre(e)
+}
+
+// toPackage converts a package of primary.xml, baseURL is used for the
+// remote location of packages without a xml:base of their own.
+func (p *primaryPackage) toPackage(baseURL string) (rpmmd.Package, error) {
+	pkg := rpmmd.Package{
+		Name:         p.Name,
+		Version:      p.Version.Ver,
+		Release:      p.Version.Rel,
+		Arch:         p.Arch,
+		Group:        p.Format.Group,
+		DownloadSize: p.Size.Package,
+		InstallSize:  p.Size.Installed,
+		License:      p.Format.License,
+		SourceRpm:    p.Format.SourceRPM,
+		Packager:     p.Packager,
+		Vendor:       p.Format.Vendor,
+		URL:          p.URL,
+		Summary:      p.Summary,
+		Description:  p.Description,
+
+		Provides:        toRelDepList(p.Format.Provides, nil),
+		Requires:        toRelDepList(p.Format.Requires, nil),
+		RequiresPre:     toRelDepList(p.Format.Requires, isPre),
+		Conflicts:       toRelDepList(p.Format.Conflicts, nil),
+		Obsoletes:       toRelDepList(p.Format.Obsoletes, nil),
+		RegularRequires: toRelDepList(p.Format.Requires, isRegular),
+		Recommends:      toRelDepList(p.Format.Recommends, nil),
+		Suggests:        toRelDepList(p.Format.Suggests, nil),
+		Enhances:        toRelDepList(p.Format.Enhances, nil),
+		Supplements:     toRelDepList(p.Format.Supplements, nil),
+
+		Files:    p.Format.Files,
+		Location: p.Location.Href,
+		Checksum: rpmmd.Checksum{
+			Type:  p.Checksum.Type,
+			Value: p.Checksum.Value,
+		},
+	}
+	if p.Version.Epoch != "" {
+		epoch, err := strconv.ParseUint(p.Version.Epoch, 10, 32)
+		if err != nil {
+			return rpmmd.Package{}, fmt.Errorf("invalid epoch %q for package %s", p.Version.Epoch, p.Name)
+		}
+		pkg.Epoch = uint(epoch)
+	}
+	if p.Time.Build != 0 {
+		pkg.BuildTime = time.Unix(p.Time.Build, 0).UTC()
+	}
+	base := baseURL
+	if p.Location.Base != "" {
+		base = p.Location.Base
+	}
+	pkg.RemoteLocations = []string{joinURL(base, p.Location.Href)}
+	return pkg, nil
+}
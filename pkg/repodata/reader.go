@@ -0,0 +1,298 @@
+// Package repodata reads the metadata of rpm-md repositories without the
+// depsolver. It is meant for read-only queries, like listing or searching
+// the packages of repositories, where running osbuild-depsolve-dnf would be
+// too expensive or is not available.
+//
+// Only the repomd.xml, primary.xml and filelists.xml files are read, so
+// there is no support for modules, comps groups or updateinfo.
+package repodata
+
+import (
+	"cmp"
+	"crypto/sha1" // #nosec G505
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gobwas/glob"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// Reader reads the packages of repositories from their metadata. The
+// metadata files are stored in the cache directory and only fetched again
+// when the repomd.xml of the repository changes.
+//
+// A Reader can be used concurrently.
+type Reader struct {
+	arch      string
+	cacheDir  string
+	filelists bool
+
+	mu sync.Mutex
+	// parsed packages by repository hash, repomd.xml checksum and
+	// filelists setting
+	packages map[string]rpmmd.PackageList
+}
+
+// NewReader returns a Reader for packages of the given architecture, using
+// cacheDir for the metadata files. Packages of other architectures than
+// arch and noarch, and source packages are ignored. If arch is empty the
+// packages of all architectures are read.
+func NewReader(arch, cacheDir string) *Reader {
+	return &Reader{
+		arch:      arch,
+		cacheDir:  cacheDir,
+		filelists: true,
+		packages:  make(map[string]rpmmd.PackageList),
+	}
+}
+
+// SetFilelists sets whether the full list of files of the packages is read
+// from filelists.xml (the default). Without it the packages only have the
+// files listed in primary.xml, which saves fetching and parsing the
+// biggest metadata file.
+func (r *Reader) SetFilelists(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filelists = enabled
+}
+
+// FetchMetadata returns the list of all the available packages in repos and
+// their info.
+func (r *Reader) FetchMetadata(repos []rpmmd.RepoConfig) (rpmmd.PackageList, error) {
+	return r.search(repos, nil)
+}
+
+// SearchMetadata returns the packages in repos with one of the given names,
+// names can be globs like "kernel-*".
+func (r *Reader) SearchMetadata(repos []rpmmd.RepoConfig, packages []string) (rpmmd.PackageList, error) {
+	globs := make([]glob.Glob, 0, len(packages))
+	for _, name := range packages {
+		g, err := glob.Compile(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid package name %q: %w", name, err)
+		}
+		globs = append(globs, g)
+	}
+	return r.search(repos, func(pkg *rpmmd.Package) bool {
+		return slices.ContainsFunc(globs, func(g glob.Glob) bool {
+			return g.Match(pkg.Name)
+		})
+	})
+}
+
+func (r *Reader) search(repos []rpmmd.RepoConfig, match func(*rpmmd.Package) bool) (rpmmd.PackageList, error) {
+	var pkgs rpmmd.PackageList
+	for _, repo := range repos {
+		repoPkgs, err := r.load(repo)
+		if err != nil {
+			return nil, err
+		}
+		for idx := range repoPkgs {
+			if match == nil || match(&repoPkgs[idx]) {
+				pkgs = append(pkgs, repoPkgs[idx])
+			}
+		}
+	}
+	slices.SortFunc(pkgs, func(a, b rpmmd.Package) int {
+		return cmp.Compare(a.NVR(), b.NVR())
+	})
+	return pkgs, nil
+}
+
+func (r *Reader) archMatches(arch string) bool {
+	if arch == "src" || arch == "nosrc" {
+		return false
+	}
+	return r.arch == "" || arch == r.arch || arch == "noarch"
+}
+
+// load returns the packages of a repository, the list is shared between
+// calls so it must not be modified.
+func (r *Reader) load(repo rpmmd.RepoConfig) (rpmmd.PackageList, error) {
+	client, err := httpClient(repo)
+	if err != nil {
+		return nil, err
+	}
+	repomdData, baseURL, err := fetchRepomd(client, repo)
+	if err != nil {
+		return nil, err
+	}
+	md, err := parseRepomd(repomdData)
+	if err != nil {
+		return nil, fmt.Errorf("repository %s: %w", repo.Id, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	repoHash := repo.Hash()
+	key := fmt.Sprintf("%s:%x:%t", repoHash, sha256.Sum256(repomdData), r.filelists)
+	if pkgs, ok := r.packages[key]; ok {
+		return pkgs, nil
+	}
+
+	repoDir := filepath.Join(r.cacheDir, repoHash)
+	if err := os.MkdirAll(repoDir, 0o755); err != nil {
+		return nil, err
+	}
+	// metadata files of this revision, other files in repoDir are stale
+	current := make(map[string]bool)
+	fetchData := func(dataType string) ([]byte, error) {
+		data := md.find(dataType)
+		if data == nil {
+			return nil, fmt.Errorf("no %s metadata in repository %s", dataType, repo.Id)
+		}
+		name := filepath.Base(data.Location.Href)
+		current[name] = true
+		return r.fetchData(client, baseURL, filepath.Join(repoDir, name), data)
+	}
+
+	primary, err := fetchData("primary")
+	if err != nil {
+		return nil, err
+	}
+	var files map[string][]string
+	if r.filelists {
+		filelists, err := fetchData("filelists")
+		if err != nil {
+			return nil, err
+		}
+		rd, err := decompress(filelists)
+		if err != nil {
+			return nil, fmt.Errorf("repository %s: %w", repo.Id, err)
+		}
+		files, err = parseFilelists(rd)
+		if err != nil {
+			return nil, fmt.Errorf("repository %s: %w", repo.Id, err)
+		}
+	}
+
+	// the packages point to a copy of the configuration that is not
+	// modified by the caller
+	repoConfig := repo
+	var pkgs rpmmd.PackageList
+	rd, err := decompress(primary)
+	if err != nil {
+		return nil, fmt.Errorf("repository %s: %w", repo.Id, err)
+	}
+	err = decodePackages(rd, func(p *primaryPackage) error {
+		if p.Type != "" && p.Type != "rpm" || !r.archMatches(p.Arch) {
+			return nil
+		}
+		pkg, err := p.toPackage(baseURL)
+		if err != nil {
+			return err
+		}
+		if files != nil {
+			pkg.Files = files[p.Checksum.Value]
+		}
+		pkg.RepoID = repoHash
+		pkg.Repo = &repoConfig
+		if repo.CheckGPG != nil {
+			pkg.CheckGPG = *repo.CheckGPG
+		}
+		if repo.IgnoreSSL != nil {
+			pkg.IgnoreSSL = *repo.IgnoreSSL
+		}
+		if repo.SSLClientKey != "" {
+			pkg.Secrets = "org.osbuild.mtls"
+		}
+		pkgs = append(pkgs, pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("repository %s: cannot parse primary.xml: %w", repo.Id, err)
+	}
+
+	pruneCache(repoDir, current)
+	r.packages[key] = pkgs
+	return pkgs, nil
+}
+
+// fetchData returns the content of a metadata file, from path if it is
+// cached there with the expected checksum, or from the repository.
+func (r *Reader) fetchData(client *http.Client, baseURL, path string, data *repomdData) ([]byte, error) {
+	if content, err := os.ReadFile(path); err == nil && verifyChecksum(content, data) == nil {
+		return content, nil
+	}
+	content, err := fetch(client, joinURL(baseURL, data.Location.Href))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(content, data); err != nil {
+		return nil, err
+	}
+	if err := writeFile(path, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func newHash(checksumType string) (hash.Hash, error) {
+	switch checksumType {
+	case "sha", "sha1":
+		return sha1.New(), nil // #nosec G401
+	case "sha224":
+		return sha256.New224(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum type %q", checksumType)
+}
+
+func verifyChecksum(content []byte, data *repomdData) error {
+	h, err := newHash(data.Checksum.Type)
+	if err != nil {
+		return err
+	}
+	h.Write(content)
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.TrimSpace(data.Checksum.Value) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", data.Location.Href, data.Checksum.Value, sum)
+	}
+	return nil
+}
+
+// writeFile writes the file atomically, so concurrent readers never see
+// partial content.
+func writeFile(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".repodata-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// pruneCache removes the metadata files of previous revisions from dir.
+func pruneCache(dir string, current map[string]bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !current[e.Name()] && !strings.HasPrefix(e.Name(), ".") {
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package repodata_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/repodata"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+func fixtureRepo(t *testing.T) rpmmd.RepoConfig {
+	t.Helper()
+	path, err := filepath.Abs("testdata/repo")
+	require.NoError(t, err)
+	return rpmmd.RepoConfig{Id: "fixture", BaseURLs: []string{"file://" + path}}
+}
+
+func names(pkgs rpmmd.PackageList) []string {
+	var res []string
+	for _, pkg := range pkgs {
+		res = append(res, pkg.Name+"."+pkg.Arch)
+	}
+	return res
+}
+
+func TestReaderFetchMetadata(t *testing.T) {
+	repo := fixtureRepo(t)
+	reader := repodata.NewReader("x86_64", t.TempDir())
+	pkgs, err := reader.FetchMetadata([]rpmmd.RepoConfig{repo})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bash.x86_64", "bash-completion.noarch"}, names(pkgs))
+
+	bash := pkgs[0]
+	assert.Equal(t, "5.2.37-1.fc42.x86_64", bash.EVRA())
+	assert.Equal(t, "GPL-3.0-or-later", bash.License)
+	assert.Equal(t, "Fedora Project", bash.Vendor)
+	assert.Equal(t, "bash-5.2.37-1.fc42.src.rpm", bash.SourceRpm)
+	assert.Equal(t, uint64(1843201), bash.DownloadSize)
+	assert.Equal(t, uint64(8623465), bash.InstallSize)
+	assert.Equal(t, time.Date(2025, 1, 26, 0, 0, 0, 0, time.UTC), bash.BuildTime)
+	assert.Equal(t, "sha256:9a3e3c4b1f6c2a6d7e8f90123456789abcdef0123456789abcdef0123456789a", bash.Checksum.String())
+	assert.Equal(t, "Packages/b/bash-5.2.37-1.fc42.x86_64.rpm", bash.Location)
+	assert.Equal(t, []string{repo.BaseURLs[0] + "/Packages/b/bash-5.2.37-1.fc42.x86_64.rpm"}, bash.RemoteLocations)
+	assert.Equal(t, rpmmd.RelDepList{
+		{Name: "/bin/bash"},
+		{Name: "bash", Relationship: "=", Version: "5.2.37-1.fc42"},
+	}, bash.Provides)
+	assert.Equal(t, rpmmd.RelDepList{{Name: "/usr/bin/sh"}}, bash.RequiresPre)
+	assert.Equal(t, rpmmd.RelDepList{
+		{Name: "filesystem", Relationship: ">=", Version: "3"},
+		{Name: "libc.so.6(GLIBC_2.38)(64bit)"},
+	}, bash.RegularRequires)
+	assert.Len(t, bash.Requires, 3)
+	assert.Equal(t, rpmmd.RelDepList{{Name: "bash-completion"}}, bash.Suggests)
+	assert.Equal(t, []string{"/etc/skel", "/etc/skel/.bashrc", "/usr/bin/bash", "/usr/bin/sh"}, bash.Files)
+	assert.Equal(t, repo.Hash(), bash.RepoID)
+	require.NotNil(t, bash.Repo)
+	assert.Equal(t, "fixture", bash.Repo.Id)
+
+	completion := pkgs[1]
+	assert.Equal(t, uint(1), completion.Epoch)
+	assert.Equal(t, []string{"https://mirror.example.com/fedora/Packages/b/bash-completion-2.16-1.fc42.noarch.rpm"}, completion.RemoteLocations)
+	assert.Equal(t, rpmmd.RelDepList{
+		{Name: "bash-completion-extras", Relationship: "<", Version: "1:2.0"},
+	}, completion.Obsoletes)
+}
+
+func TestReaderAllArches(t *testing.T) {
+	reader := repodata.NewReader("", t.TempDir())
+	pkgs, err := reader.FetchMetadata([]rpmmd.RepoConfig{fixtureRepo(t)})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"bash.x86_64", "bash.aarch64", "bash-completion.noarch"}, names(pkgs))
+}
+
+func TestReaderNoFilelists(t *testing.T) {
+	cacheDir := t.TempDir()
+	reader := repodata.NewReader("x86_64", cacheDir)
+	reader.SetFilelists(false)
+	pkgs, err := reader.FetchMetadata([]rpmmd.RepoConfig{fixtureRepo(t)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/usr/bin/bash", "/usr/bin/sh"}, pkgs[0].Files)
+
+	cached, err := filepath.Glob(filepath.Join(cacheDir, "*", "*"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+	assert.True(t, strings.HasSuffix(cached[0], "-primary.xml.gz"))
+}
+
+func TestReaderSearchMetadata(t *testing.T) {
+	reader := repodata.NewReader("x86_64", t.TempDir())
+	repos := []rpmmd.RepoConfig{fixtureRepo(t)}
+
+	pkgs, err := reader.SearchMetadata(repos, []string{"bash"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bash.x86_64"}, names(pkgs))
+
+	pkgs, err = reader.SearchMetadata(repos, []string{"bash-*", "tmux"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bash-completion.noarch"}, names(pkgs))
+
+	pkgs, err = reader.SearchMetadata(repos, []string{"vim"})
+	require.NoError(t, err)
+	assert.Empty(t, pkgs)
+}
+
+// repoServer serves the fixture repository and counts the requests by path
+func repoServer(t *testing.T) (*httptest.Server, map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	fileServer := http.FileServer(http.Dir("testdata/repo"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		fileServer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func TestReaderCache(t *testing.T) {
+	srv, requests := repoServer(t)
+	cacheDir := t.TempDir()
+	repos := []rpmmd.RepoConfig{{Id: "http", BaseURLs: []string{srv.URL}}}
+
+	pkgs, err := repodata.NewReader("x86_64", cacheDir).FetchMetadata(repos)
+	require.NoError(t, err)
+	assert.Len(t, pkgs, 2)
+	assert.Equal(t, []string{srv.URL + "/Packages/b/bash-5.2.37-1.fc42.x86_64.rpm"}, pkgs[0].RemoteLocations)
+	assert.Len(t, requests, 3)
+
+	// a new reader only fetches the repomd.xml
+	pkgs, err = repodata.NewReader("x86_64", cacheDir).FetchMetadata(repos)
+	require.NoError(t, err)
+	assert.Len(t, pkgs, 2)
+	assert.Equal(t, 2, requests["/repodata/repomd.xml"])
+	for path, count := range requests {
+		if path != "/repodata/repomd.xml" {
+			assert.Equal(t, 1, count, path)
+		}
+	}
+
+	// corrupted cache files are fetched again
+	cached, err := filepath.Glob(filepath.Join(cacheDir, repos[0].Hash(), "*-primary.xml.gz"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+	require.NoError(t, os.WriteFile(cached[0], []byte("garbage"), 0o644))
+	_, err = repodata.NewReader("x86_64", cacheDir).FetchMetadata(repos)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests["/repodata/"+filepath.Base(cached[0])])
+}
+
+func TestReaderChecksumMismatch(t *testing.T) {
+	repoDir := t.TempDir()
+	require.NoError(t, os.CopyFS(repoDir, os.DirFS("testdata/repo")))
+	primary, err := filepath.Glob(filepath.Join(repoDir, "repodata", "*-primary.xml.gz"))
+	require.NoError(t, err)
+	require.Len(t, primary, 1)
+	require.NoError(t, os.WriteFile(primary[0], []byte("garbage"), 0o644))
+
+	reader := repodata.NewReader("x86_64", t.TempDir())
+	_, err = reader.FetchMetadata([]rpmmd.RepoConfig{{Id: "broken", BaseURLs: []string{"file://" + repoDir}}})
+	assert.ErrorContains(t, err, "checksum mismatch for repodata/")
+}
+
+func TestReaderErrors(t *testing.T) {
+	reader := repodata.NewReader("x86_64", t.TempDir())
+	_, err := reader.FetchMetadata([]rpmmd.RepoConfig{{Id: "missing", BaseURLs: []string{"file:///nonexistent"}}})
+	assert.ErrorContains(t, err, "no repomd.xml found for repository missing")
+
+	_, err = reader.FetchMetadata([]rpmmd.RepoConfig{{Id: "rhel", BaseURLs: []string{"https://cdn.example.com"}, RHSM: true}})
+	assert.ErrorContains(t, err, "repository rhel uses RHSM secrets")
+
+	_, err = reader.SearchMetadata([]rpmmd.RepoConfig{fixtureRepo(t)}, []string{"bash["})
+	assert.ErrorContains(t, err, `invalid package name "bash["`)
+}
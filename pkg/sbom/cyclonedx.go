@@ -0,0 +1,241 @@
+package sbom
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// CycloneDXSpecVersion is the version of the CycloneDX specification the
+// generated documents conform to.
+const CycloneDXSpecVersion = "1.6"
+
+// cycloneDXNamespace is used to derive the serial number of a document from
+// its content, so that the same packages always result in the same document.
+var cycloneDXNamespace = uuid.MustParse("2c9d5a43-5d3c-4b43-9f4d-3a8c6bd1c5a2")
+
+type cdxDocument struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Tools cdxTools `json:"tools"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Supplier           *cdxOrganization       `json:"supplier,omitempty"`
+	Group              string                 `json:"group,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	Description        string                 `json:"description,omitempty"`
+	Hashes             []cdxHash              `json:"hashes,omitempty"`
+	Licenses           []cdxLicenseChoice     `json:"licenses,omitempty"`
+	PURL               string                 `json:"purl,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty          `json:"properties,omitempty"`
+}
+
+type cdxOrganization struct {
+	Name string `json:"name"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicenseChoice struct {
+	License cdxLicense `json:"license"`
+}
+
+type cdxLicense struct {
+	Name string `json:"name"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// cdxHashAlgs maps the checksum types of the rpm metadata to the CycloneDX
+// hash algorithms.
+var cdxHashAlgs = map[string]string{
+	"md5":    "MD5",
+	"sha1":   "SHA-1",
+	"sha256": "SHA-256",
+	"sha384": "SHA-384",
+	"sha512": "SHA-512",
+}
+
+// NewCycloneDXDocument creates a CycloneDX document that lists the given
+// packages as components, with their package URLs, licenses, checksums and
+// the repositories they were resolved from. The distro (e.g. "fedora-42") is
+// used for the namespace and the distro qualifier of the package URLs and
+// can be empty.
+//
+// Unlike SPDX documents, which are generated by the depsolver, CycloneDX
+// documents are generated from the depsolved packages. The document does not
+// contain a timestamp and its serial number is derived from the packages, so
+// the same packages always result in the same document.
+func NewCycloneDXDocument(pkgs rpmmd.PackageList, distro string) (*Document, error) {
+	components := make([]cdxComponent, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		components = append(components, cycloneDXComponent(pkg, distro))
+	}
+	slices.SortFunc(components, func(a, b cdxComponent) int {
+		return cmp.Compare(a.PURL, b.PURL)
+	})
+	components = slices.CompactFunc(components, func(a, b cdxComponent) bool {
+		return a.PURL == b.PURL
+	})
+
+	purls := make([]string, 0, len(components))
+	for _, c := range components {
+		purls = append(purls, c.PURL)
+	}
+	serial := uuid.NewSHA1(cycloneDXNamespace, []byte(strings.Join(purls, "\n")))
+
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  CycloneDXSpecVersion,
+		SerialNumber: "urn:uuid:" + serial.String(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Tools: cdxTools{
+				Components: []cdxComponent{
+					{
+						Type:  "application",
+						Group: "github.com/osbuild",
+						Name:  "images",
+					},
+				},
+			},
+		},
+		Components: components,
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal CycloneDX document: %w", err)
+	}
+	return NewDocument(StandardTypeCycloneDX, raw)
+}
+
+func cycloneDXComponent(pkg rpmmd.Package, distro string) cdxComponent {
+	version := fmt.Sprintf("%s-%s", pkg.Version, pkg.Release)
+	if pkg.Epoch != 0 {
+		version = fmt.Sprintf("%d:%s", pkg.Epoch, version)
+	}
+	purl := PackageURL(pkg, distro)
+
+	c := cdxComponent{
+		Type:        "library",
+		BOMRef:      purl,
+		Name:        pkg.Name,
+		Version:     version,
+		Description: pkg.Summary,
+		PURL:        purl,
+	}
+	if pkg.Vendor != "" {
+		c.Supplier = &cdxOrganization{Name: pkg.Vendor}
+	}
+	if alg, ok := cdxHashAlgs[pkg.Checksum.Type]; ok && pkg.Checksum.Value != "" {
+		c.Hashes = append(c.Hashes, cdxHash{Alg: alg, Content: pkg.Checksum.Value})
+	}
+	// rpm license tags are not necessarily valid SPDX expressions, so they
+	// are only recorded as names
+	if pkg.License != "" {
+		c.Licenses = append(c.Licenses, cdxLicenseChoice{License: cdxLicense{Name: pkg.License}})
+	}
+	if pkg.URL != "" {
+		c.ExternalReferences = append(c.ExternalReferences, cdxExternalReference{Type: "website", URL: pkg.URL})
+	}
+	for _, location := range pkg.RemoteLocations {
+		c.ExternalReferences = append(c.ExternalReferences, cdxExternalReference{Type: "distribution", URL: location})
+	}
+
+	repoID := pkg.RepoID
+	if pkg.Repo != nil && pkg.Repo.Id != "" {
+		repoID = pkg.Repo.Id
+	}
+	if repoID != "" {
+		c.Properties = append(c.Properties, cdxProperty{Name: "osbuild:repository:id", Value: repoID})
+	}
+	if pkg.Repo != nil {
+		for _, baseURL := range pkg.Repo.BaseURLs {
+			c.Properties = append(c.Properties, cdxProperty{Name: "osbuild:repository:baseurl", Value: baseURL})
+		}
+		if pkg.Repo.Metalink != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "osbuild:repository:metalink", Value: pkg.Repo.Metalink})
+		}
+		if pkg.Repo.MirrorList != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "osbuild:repository:mirrorlist", Value: pkg.Repo.MirrorList})
+		}
+	}
+	if pkg.SourceRpm != "" {
+		c.Properties = append(c.Properties, cdxProperty{Name: "osbuild:rpm:sourcerpm", Value: pkg.SourceRpm})
+	}
+
+	return c
+}
+
+// PackageURL returns the package URL of the rpm package, see
+// https://github.com/package-url/purl-spec. The namespace is the name of the
+// distro without the version, e.g. "fedora" for "fedora-42", and is omitted
+// if the distro is empty.
+func PackageURL(pkg rpmmd.Package, distro string) string {
+	var b strings.Builder
+	b.WriteString("pkg:rpm/")
+	if distro != "" {
+		namespace, _, _ := strings.Cut(distro, "-")
+		b.WriteString(purlEscape(strings.ToLower(namespace)))
+		b.WriteString("/")
+	}
+	b.WriteString(purlEscape(pkg.Name))
+	b.WriteString("@")
+	b.WriteString(purlEscape(fmt.Sprintf("%s-%s", pkg.Version, pkg.Release)))
+
+	// qualifiers are sorted by key
+	var qualifiers []string
+	if pkg.Arch != "" {
+		qualifiers = append(qualifiers, "arch="+purlEscape(pkg.Arch))
+	}
+	if distro != "" {
+		qualifiers = append(qualifiers, "distro="+purlEscape(distro))
+	}
+	if pkg.Epoch != 0 {
+		qualifiers = append(qualifiers, fmt.Sprintf("epoch=%d", pkg.Epoch))
+	}
+	if len(qualifiers) > 0 {
+		b.WriteString("?")
+		b.WriteString(strings.Join(qualifiers, "&"))
+	}
+	return b.String()
+}
+
+func purlEscape(s string) string {
+	// "+" is not escaped in paths but it has to be in package URLs
+	return strings.ReplaceAll(url.PathEscape(s), "+", "%2B")
+}
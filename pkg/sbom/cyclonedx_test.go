@@ -0,0 +1,105 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+func TestPackageURL(t *testing.T) {
+	pkg := rpmmd.Package{
+		Name:    "libstdc++",
+		Version: "14.2.1",
+		Release: "3.fc42",
+		Arch:    "x86_64",
+	}
+	assert.Equal(t, "pkg:rpm/fedora/libstdc%2B%2B@14.2.1-3.fc42?arch=x86_64&distro=fedora-42", PackageURL(pkg, "fedora-42"))
+
+	pkg.Epoch = 2
+	assert.Equal(t, "pkg:rpm/libstdc%2B%2B@14.2.1-3.fc42?arch=x86_64&epoch=2", PackageURL(pkg, ""))
+}
+
+func TestNewCycloneDXDocument(t *testing.T) {
+	repo := &rpmmd.RepoConfig{
+		Id:       "baseos",
+		BaseURLs: []string{"https://example.com/baseos"},
+	}
+	pkgs := rpmmd.PackageList{
+		{
+			Name:            "zlib",
+			Epoch:           1,
+			Version:         "1.3",
+			Release:         "1.el10",
+			Arch:            "x86_64",
+			License:         "Zlib",
+			Vendor:          "CentOS",
+			Summary:         "Compression library",
+			URL:             "https://zlib.net",
+			SourceRpm:       "zlib-1.3-1.el10.src.rpm",
+			RemoteLocations: []string{"https://example.com/baseos/Packages/zlib-1.3-1.el10.x86_64.rpm"},
+			Checksum:        rpmmd.Checksum{Type: "sha256", Value: "abcd"},
+			Repo:            repo,
+		},
+		{
+			Name:     "bash",
+			Version:  "5.2",
+			Release:  "2.el10",
+			Arch:     "x86_64",
+			Checksum: rpmmd.Checksum{Type: "unknown", Value: "1234"},
+			RepoID:   "appstream",
+		},
+	}
+
+	doc, err := NewCycloneDXDocument(pkgs, "centos-10")
+	require.NoError(t, err)
+	assert.Equal(t, StandardTypeCycloneDX, doc.DocType)
+
+	var cdx cdxDocument
+	require.NoError(t, json.Unmarshal(doc.Document, &cdx))
+	assert.Equal(t, "CycloneDX", cdx.BOMFormat)
+	assert.Equal(t, CycloneDXSpecVersion, cdx.SpecVersion)
+	assert.Regexp(t, "^urn:uuid:[0-9a-f-]{36}$", cdx.SerialNumber)
+
+	// components are sorted by purl
+	assert.Equal(t, []cdxComponent{
+		{
+			Type:    "library",
+			BOMRef:  "pkg:rpm/centos/bash@5.2-2.el10?arch=x86_64&distro=centos-10",
+			Name:    "bash",
+			Version: "5.2-2.el10",
+			PURL:    "pkg:rpm/centos/bash@5.2-2.el10?arch=x86_64&distro=centos-10",
+			Properties: []cdxProperty{
+				{Name: "osbuild:repository:id", Value: "appstream"},
+			},
+		},
+		{
+			Type:        "library",
+			BOMRef:      "pkg:rpm/centos/zlib@1.3-1.el10?arch=x86_64&distro=centos-10&epoch=1",
+			Supplier:    &cdxOrganization{Name: "CentOS"},
+			Name:        "zlib",
+			Version:     "1:1.3-1.el10",
+			Description: "Compression library",
+			Hashes:      []cdxHash{{Alg: "SHA-256", Content: "abcd"}},
+			Licenses:    []cdxLicenseChoice{{License: cdxLicense{Name: "Zlib"}}},
+			PURL:        "pkg:rpm/centos/zlib@1.3-1.el10?arch=x86_64&distro=centos-10&epoch=1",
+			ExternalReferences: []cdxExternalReference{
+				{Type: "website", URL: "https://zlib.net"},
+				{Type: "distribution", URL: "https://example.com/baseos/Packages/zlib-1.3-1.el10.x86_64.rpm"},
+			},
+			Properties: []cdxProperty{
+				{Name: "osbuild:repository:id", Value: "baseos"},
+				{Name: "osbuild:repository:baseurl", Value: "https://example.com/baseos"},
+				{Name: "osbuild:rpm:sourcerpm", Value: "zlib-1.3-1.el10.src.rpm"},
+			},
+		},
+	}, cdx.Components)
+
+	// the document only depends on the packages
+	doc2, err := NewCycloneDXDocument(rpmmd.PackageList{pkgs[1], pkgs[0]}, "centos-10")
+	require.NoError(t, err)
+	assert.Equal(t, doc.Document, doc2.Document)
+}